@@ -1,18 +1,44 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+	"github.com/dhavalsavalia/kbflash/internal/agent"
+	"github.com/dhavalsavalia/kbflash/internal/backup"
+	"github.com/dhavalsavalia/kbflash/internal/bundle"
+	"github.com/dhavalsavalia/kbflash/internal/components"
 	"github.com/dhavalsavalia/kbflash/internal/config"
 	"github.com/dhavalsavalia/kbflash/internal/device"
 	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/flashlog"
+	"github.com/dhavalsavalia/kbflash/internal/flow"
+	"github.com/dhavalsavalia/kbflash/internal/git"
+	"github.com/dhavalsavalia/kbflash/internal/job"
+	"github.com/dhavalsavalia/kbflash/internal/remote"
+	"github.com/dhavalsavalia/kbflash/internal/report"
+	"github.com/dhavalsavalia/kbflash/internal/sim"
+	"github.com/dhavalsavalia/kbflash/internal/status"
+	"github.com/dhavalsavalia/kbflash/internal/tags"
 	"github.com/dhavalsavalia/kbflash/internal/ui"
+	"github.com/dhavalsavalia/kbflash/internal/web"
 )
 
 var version = "dev"
@@ -21,36 +47,238 @@ func main() {
 	versionFlag := flag.Bool("version", false, "Print version and exit")
 	flag.BoolVar(versionFlag, "v", false, "Print version and exit (shorthand)")
 
-	configPath := flag.String("config", "", "Path to config file")
+	configPath := flag.String("config", "", "Path to config file (default: $KBFLASH_CONFIG)")
+	configDir := flag.String("config-dir", "", "Directory holding config.toml, instead of --config")
 	initConfig := flag.Bool("init", false, "Generate example config file")
 	noTUI := flag.Bool("no-tui", false, "Headless mode for CI/scripting")
+	westUpdate := flag.Bool("west-update", false, "Run west update in the working directory and exit")
+	keyboard := flag.String("keyboard", "", "Keyboard profile to use when several are configured")
+	simulate := flag.Bool("simulate", false, "Preview the flow with a simulated keyboard, build and flash")
+	watchFiles := flag.Bool("watch", false, "TUI: rebuild when the keymap or its config changes (build.watch)")
+	quiet := flag.Bool("q", false, "Headless: print errors only")
+	verbose := flag.Bool("vv", false, "Headless: also print detector events, copy blocks and docker commands")
+	flag.BoolVar(&assumeYes, "assume-yes", false, "Headless: answer yes to every prompt")
+	flag.BoolVar(&assumeYes, "y", false, "Headless: answer yes to every prompt (shorthand)")
 
 	flag.Parse()
 
+	switch {
+	case *quiet:
+		output = levelQuiet
+	case *verbose:
+		output = levelVerbose
+	}
+
+	var err error
+	var cfg *config.Config
+
 	if *versionFlag {
 		fmt.Printf("kbflash %s\n", version)
 		os.Exit(0)
 	}
 
+	if *configPath == "" && *configDir != "" {
+		*configPath = config.PathInDir(*configDir)
+	}
+
+	if flag.Arg(0) == "diff" {
+		if err := runDiff(flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The agent runs on device.host, which may have no config of its own
+	if flag.Arg(0) == "agent" {
+		if err := runAgent(flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "config" {
+		if err := runConfig(*configPath, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "devices" {
+		if err := runDevices(*configPath, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *initConfig {
 		path, err := config.GenerateExampleConfig(*configPath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			printError(err)
 			os.Exit(1)
 		}
 		fmt.Printf("Created config at %s\n", path)
 		os.Exit(0)
 	}
 
-	cfg, err := config.Load(*configPath)
+	if *simulate && flag.Arg(0) == "web" {
+		if err := runSimulatedWeb(flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *simulate {
+		var target string
+		if flag.Arg(0) == "run" {
+			target, err = parseRunArgs(flag.Args()[1:])
+		}
+		if err == nil {
+			err = runSimulation(*noTUI, target)
+		}
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err = config.Load(*configPath)
+	if err != nil {
+		printError(err)
+		os.Exit(1)
+	}
+	for _, w := range cfg.Warnings {
+		printWarning(w)
+	}
+
+	if *watchFiles {
+		cfg.Build.Watch.Enabled = true
+		for _, profile := range cfg.Profiles {
+			profile.Build.Watch.Enabled = true
+		}
+	}
+
+	root := cfg
+	if len(root.Profiles) > 1 && *keyboard == "" && !*noTUI && !*westUpdate && flag.Arg(0) == "" {
+		// Let the user pick the keyboard on launch
+		if err := runTUI(ui.NewKeyboardSelector(root)); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err = selectProfile(cfg, *keyboard)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError(err)
 		os.Exit(1)
 	}
 
+	if flag.Arg(0) == "latest" {
+		if err := runLatest(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "flash" {
+		if err := runFlashFile(cfg, root, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "clean" {
+		if err := runClean(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "sign" {
+		if err := runSign(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "remote" {
+		if err := runRemote(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "export" {
+		if err := runExport(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "import" {
+		if err := runImport(cfg, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "job" {
+		if err := runJob(cfg, root, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "web" {
+		if err := runWeb(cfg, flag.Args()[1:], webComponents(cfg)); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "run" {
+		if err := runPipeline(cfg, root, *noTUI, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "setup-udev" {
+		if err := runSetupUdev(root, flag.Args()[1:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *westUpdate {
+		if err := runWestUpdate(cfg); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *noTUI {
-		if err := runHeadless(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		detector := components.NewDetector(cfg)
+		if err := runHeadless(cfg, detector, components.NewFlasher(cfg), openFlashLog(), runOptions{}); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 		return
@@ -58,102 +286,1756 @@ func main() {
 
 	// Launch TUI
 	model := ui.NewModel(cfg)
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	model.SetProfiles(root)
+	if err := runTUI(model); err != nil {
+		printError(err)
 		os.Exit(1)
 	}
 }
 
-// runHeadless runs the flash operation without TUI
-func runHeadless(cfg *config.Config) error {
-	fmt.Printf("kbflash %s - Headless mode\n", version)
-	fmt.Printf("Keyboard: %s (%s)\n", cfg.Keyboard.Name, cfg.Keyboard.Type)
+// runTUI runs the full-screen interface starting from model
+func runTUI(model tea.Model) error {
+	p := tea.NewProgram(model, tea.WithAltScreen())
+	_, err := p.Run()
+	return err
+}
 
-	// Scan for firmware
-	scanner := firmware.NewScanner(cfg.Build.FirmwareDir, cfg.Build.FilePattern)
-	ctx := context.Background()
+// selectProfile returns the config for the named keyboard profile, or the
+// first profile when none is named. Single-keyboard configs pass through.
+func selectProfile(cfg *config.Config, name string) (*config.Config, error) {
+	if len(cfg.Profiles) == 0 {
+		if name != "" && name != cfg.Keyboard.Name {
+			return nil, fmt.Errorf("no keyboard profile %q: config defines no [profiles]", name)
+		}
+		return cfg, nil
+	}
+	if name == "" {
+		name = cfg.ProfileNames()[0]
+	}
+	return cfg.Profile(name)
+}
 
-	builds, err := scanner.Scan(ctx)
+// runSimulation runs the TUI or headless flow against a simulated keyboard,
+// builder and flasher, using a throwaway firmware directory. A target runs
+// the kbflash run pipeline for it.
+func runSimulation(noTUI bool, target string) error {
+	dir, err := os.MkdirTemp("", "kbflash-sim-")
 	if err != nil {
-		return fmt.Errorf("scan firmware: %w", err)
+		return err
 	}
-	if len(builds) == 0 {
-		return fmt.Errorf("no firmware found in %s", cfg.Build.FirmwareDir)
+	defer os.RemoveAll(dir)
+
+	cfg := sim.DemoConfig(dir)
+	if target != "" {
+		if err := checkRunTarget(cfg, target); err != nil {
+			return err
+		}
+	}
+	if err := sim.Seed(dir, cfg.Build.Shield, cfg.Keyboard.Sides); err != nil {
+		return fmt.Errorf("seed firmware: %w", err)
+	}
+
+	dev := sim.NewDevice()
+	builder := sim.NewBuilder(dir, cfg.Build.Shield, cfg.Keyboard.Sides)
+	if noTUI {
+		run := runOptions{target: target}
+		if target != "" {
+			run.builder = builder
+		}
+		return runHeadless(cfg, sim.NewDetector(dev), sim.NewFlasher(dev), flashlog.New(), run)
+	}
+
+	model := ui.NewModelWith(cfg, ui.Components{
+		Detector: sim.NewDetector(dev),
+		Builder:  builder,
+		Flasher:  sim.NewFlasher(dev),
+	})
+	if target != "" {
+		model.SetRun(target)
+	}
+	return runTUI(model)
+}
+
+// runSimulatedWeb serves the web dashboard for a simulated keyboard, which
+// connects a few seconds after each flash is started
+func runSimulatedWeb(args []string) error {
+	dir, err := os.MkdirTemp("", "kbflash-sim-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := sim.DemoConfig(dir)
+	if err := sim.Seed(dir, cfg.Build.Shield, cfg.Keyboard.Sides); err != nil {
+		return fmt.Errorf("seed firmware: %w", err)
+	}
+	dev := sim.NewDevice()
+	return runWeb(cfg, args, web.Components{
+		Detector: sim.NewDetector(dev),
+		Flasher:  sim.NewFlasher(dev),
+		Scanner:  components.NewScanner(cfg),
+		Flashes:  flashlog.New(),
+	})
+}
+
+// runOptions turns a headless session into kbflash run: build target first,
+// then flash that build to target's sides
+type runOptions struct {
+	builder  firmware.FirmwareBuilder // nil flashes the newest existing build
+	target   string                   // side to build and flash, or "all"
+	onReport func(*report.Report)     // receives the session's report once it ends
+	dir      string                   // build directory to flash instead of the newest
+}
+
+// parseRunArgs returns the target of kbflash run, every side by default
+func parseRunArgs(args []string) (string, error) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	target := fs.String("target", "all", "Side to build and flash, or all")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("usage: kbflash run [--target <side|all>]")
+	}
+	return *target, nil
+}
+
+// checkRunTarget checks that cfg can build and flash target in one go
+func checkRunTarget(cfg *config.Config, target string) error {
+	if !cfg.Build.Enabled {
+		return fmt.Errorf("kbflash run needs build.enabled = true")
+	}
+	if cfg.Flash.Mode == "qmk" {
+		return fmt.Errorf("kbflash run needs flash.mode = \"copy\" or \"dfu\"; qmk flash already builds before flashing")
+	}
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	if target != "all" && !slices.Contains(sides, target) {
+		return fmt.Errorf("unknown target %q, expected all or one of %s", target, strings.Join(sides, ", "))
+	}
+	return nil
+}
+
+// runPipeline builds a target and flashes the result in one invocation, in
+// the TUI or headless with --no-tui
+func runPipeline(cfg, root *config.Config, noTUI bool, args []string) error {
+	target, err := parseRunArgs(args)
+	if err != nil {
+		return err
+	}
+	if err := checkRunTarget(cfg, target); err != nil {
+		return err
+	}
+
+	if noTUI {
+		detector := components.NewDetector(cfg)
+		return runHeadless(cfg, detector, components.NewFlasher(cfg), openFlashLog(), runOptions{builder: components.NewBuilder(cfg), target: target})
 	}
 
-	build := builds[0] // Use latest
-	fmt.Printf("Using firmware: %s (%d files)\n", formatBuildDate(build.Date), len(build.Files))
+	model := ui.NewModel(cfg)
+	model.SetProfiles(root)
+	model.SetRun(target)
+	return runTUI(model)
+}
+
+// runHeadless runs the flash operation without TUI. flashes is the history
+// each flashed side is recorded in; run builds the firmware first.
+func runHeadless(cfg *config.Config, detector device.Detector, flasher firmware.FirmwareFlasher, flashes *flashlog.Log, run runOptions) (err error) {
+	logf("kbflash %s - Headless mode\n", version)
+	logf("Keyboard: %s (%s)\n", cfg.Keyboard.Name, cfg.Keyboard.Type)
+
+	rep := report.New(cfg.Keyboard.Name)
+	defer func() {
+		writeReport(cfg, rep, err)
+		if run.onReport != nil {
+			run.onReport(rep)
+		}
+	}()
+	defer endGroup()
+	openStatus(cfg)
+	defer closeStatus()
+
+	flashes.SetBackup("")
+	if cfg.Backup.Enabled {
+		dir, err := backup.Archive(context.Background(), cfg.Build.WorkingDir, cfg.Backup.Patterns, cfg.Backup.Dir, time.Now())
+		if err != nil {
+			return fmt.Errorf("backup keymap: %w", err)
+		}
+		logf("Keymap backed up to %s\n", dir)
+		flashes.SetBackup(dir)
+	}
+
+	if cfg.Flash.Mode == "qmk" {
+		return runHeadlessQMK(cfg, rep)
+	}
 
 	// Get sides to flash
 	sides := cfg.Keyboard.Sides
 	if len(sides) == 0 {
 		sides = []string{"main"}
 	}
+	if run.target != "" && run.target != "all" {
+		sides = []string{run.target}
+	}
 
-	detector := device.New()
-	flasher := firmware.NewFlasher()
-	pollInterval := time.Duration(cfg.Device.PollInterval)
+	// kbflash run numbers the build and each side's flash as one sequence
+	step := func(n int) string {
+		if run.builder == nil {
+			return ""
+		}
+		return fmt.Sprintf("[%d/%d] ", n, len(sides)+1)
+	}
 
-	for _, side := range sides {
-		fmt.Printf("\nFlashing %s...\n", side)
+	ctx := context.Background()
+	builtDir := run.dir
+	if run.builder != nil {
+		groupf("%sBuilding %s", step(1), run.target)
+		builtDir, err = buildHeadless(ctx, cfg, run.builder, run.target)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fetch builds made on other machines; local ones still flash when the
+	// cache cannot be reached
+	cache, err := newRemote(cfg)
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		if err := pullRemote(ctx, cache); err != nil {
+			warnf(rep, "%v", err)
+		}
+	}
+
+	// Scan for firmware
+	scanner := components.NewScanner(cfg)
+
+	builds, err := scanner.Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("scan firmware: %w", err)
+	}
+	if len(builds) == 0 {
+		return fmt.Errorf("no firmware found in %s", cfg.Build.FirmwareDir)
+	}
 
-		// Find firmware file for this side
-		var filePath string
-		target := strings.ToLower(side)
-		for _, f := range build.Files {
-			fname := strings.ToLower(f.Name)
-			if strings.Contains(fname, target) {
-				filePath = f.Path
-				break
+	build := builds[0] // Use latest, or the build just made
+	for _, b := range builds {
+		if builtDir != "" && b.Path == builtDir {
+			build = b
+			break
+		}
+	}
+	// Share the build just made, not one from another source
+	local := build.Source == "" || build.Source == "local"
+	if run.builder != nil && cache != nil && cfg.Build.Remote.Upload && local {
+		if err := pushRemote(ctx, cache, build); err != nil {
+			warnf(rep, "%v", err)
+		}
+	}
+	if build.Source != "" {
+		logf("Using firmware: %s [%s] (%d files)\n", build.Title(), build.Source, len(build.Files))
+	} else {
+		logf("Using firmware: %s (%d files)\n", build.Title(), len(build.Files))
+	}
+	if summary := build.Summary(); summary != "" {
+		logf("  %s\n", summary)
+	}
+	if built := build.Time(); !built.IsZero() {
+		if days := firmware.AgeDays(built, time.Now()); days > cfg.Build.StaleDays {
+			warnf(rep, "%s is %d days old", build.Title(), days)
+			if !confirmf("Flash it anyway?") {
+				return errCancelled
 			}
 		}
-		if filePath == "" && len(build.Files) == 1 {
-			filePath = build.Files[0].Path
+	}
+	rep.SetBuild(report.Build{
+		Name:   build.Title(),
+		Path:   build.Path,
+		Source: build.Source,
+		Notes:  build.Summary(),
+	})
+
+	matcher, err := firmware.NewSideMatcher(cfg.Keyboard.SidePatterns)
+	if err != nil {
+		return err
+	}
+	matcher.SetStudio(cfg.Build.Studio)
+	for _, name := range matcher.Ambiguous(sides, build.Files) {
+		warnf(rep, "%s matches more than one side", name)
+	}
+	// Fail before flashing anything rather than halfway through
+	if missing := matcher.Missing(sides, build.Files); len(missing) > 0 {
+		return fmt.Errorf("no firmware file for %s in %s", strings.Join(missing, ", "), build.Title())
+	}
+	for _, side := range sides {
+		for _, path := range cfg.Flash.FilesFor(side, matcher.Match(side, build.Files).Path) {
+			if err := firmware.CheckFirmwareFile(path, cfg.Flash.Extension(), cfg.Flash.MinSize); err != nil {
+				return fmt.Errorf("cannot flash %s: %w", side, err)
+			}
 		}
-		if filePath == "" {
-			return fmt.Errorf("no firmware file for %s", side)
+	}
+
+	pollInterval := time.Duration(cfg.Device.PollInterval)
+
+	// dfu-util waits for each bootloader itself, so there is no volume to watch
+	var dfu *firmware.DFUFlasher
+	if cfg.Flash.Mode == "dfu" {
+		dfu = components.NewDFUFlasher(cfg)
+	}
+
+	// Settle every side's questions before anyone unplugs a keyboard
+	var steps []flow.Step
+	for _, side := range sides {
+		filePath := matcher.Match(side, build.Files).Path
+		logf("%s: %s\n", side, filePath)
+		if size, ok, err := firmware.CheckImageSize(filePath, cfg.Build.BoardFor(side)); err == nil && ok {
+			logf("  Size: %s\n", size)
+			if size.Exceeds() {
+				warnf(rep, "%s firmware is larger than the %s flash", side, cfg.Build.BoardFor(side))
+				if !confirmf("Flash %s anyway?", side) {
+					return errCancelled
+				}
+			} else if size.NearLimit() {
+				warnf(rep, "%s firmware is close to the flash limit", side)
+			}
 		}
 
-		fmt.Printf("File: %s\n", filePath)
+		// Extra files for this side are flashed in order, one per connection
+		files := cfg.Flash.FilesFor(side, filePath)
+		if last, ok := flashes.Flashed(flashlog.Key(cfg.Keyboard.Name, side), files[len(files)-1]); ok {
+			logf("This exact firmware is already on %s (flashed %s)\n", side, last.Time.Format("2006-01-02 15:04"))
+			if !confirmf("Flash %s anyway?", side) {
+				logf("Skipped %s\n", side)
+				continue
+			}
+		}
+		steps = append(steps, flow.Step{Side: side, Files: files})
+	}
 
-		// Wait for device
-		fmt.Printf("Waiting for %s...\n", cfg.Device.Name)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var events <-chan device.Event
+	if dfu == nil {
+		events = detector.Detect(ctx, cfg.Device.Name, pollInterval)
+	}
 
-		detectCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-		events := detector.Detect(detectCtx, cfg.Device.Name, pollInterval)
+	var next flow.Event // the flash the sequence asked for
+	var failed error
+	var volume device.Event // the latest detector event
+	var unreadable string   // the last unreadable volume warned about
+	var seq *flow.Flow
+	unplug := func(side string) {
+		logf("Unplug %s, then connect %s...\n", cfg.Device.Name, side)
+	}
+	seq = flow.New(steps, flow.Options{
+		SelfWaiting: dfu != nil,
+		Ready:       true,
+		Boards:      cfg.Build.Boards(sides),
+	}, func(e flow.Event) {
+		switch e.Kind {
+		case flow.EventSideStarted:
+			groupf("%sFlashing %s", step(slices.Index(sides, e.Side)+2), e.Side)
+		case flow.EventWaitDisconnect:
+			setStatus(status.Waiting, e.Side, 0)
+			// A flashed bootloader unmounts as it reboots, unless it times out
+			if !seq.Rebooting() {
+				unplug(e.Side)
+			}
+		case flow.EventWaitDevice:
+			setStatus(status.Waiting, e.Side, 0)
+			if e.File > 0 {
+				logf("Waiting for %s to reconnect...\n", cfg.Device.Name)
+			} else {
+				logf("Waiting for %s...\n", cfg.Device.Name)
+			}
+		case flow.EventFlash:
+			next = e
+			setStatus(status.Flashing, e.Side, e.File*100/max(e.Files, 1))
+		case flow.EventRebooted:
+			logf("Device rebooted\n")
+		case flow.EventRebootTimeout:
+			warnf(rep, "%s still mounted after %s; the flash may not have taken", cfg.Device.Name, device.RebootTimeout)
+			if seq.State() == flow.StateWaitingDisconnect {
+				unplug(seq.Side())
+			}
+		case flow.EventFailed:
+			failed = e.Err
+			setStatus(status.Failed, e.Side, 0)
+		}
+	})
 
-		var devicePath string
-		for event := range events {
-			if event.Connected {
-				devicePath = event.Path
-				break
+	seq.Start()
+	timeout := time.After(5 * time.Minute)
+	var rebootTimeout <-chan time.Time
+	for {
+		switch seq.State() {
+		case flow.StateFailed:
+			if errors.Is(failed, firmware.ErrDeviceRemoved) {
+				return fmt.Errorf("%w (the bootloader rebooted early or the cable was disconnected; re-enter the bootloader and retry)", failed)
+			}
+			return failed
+		case flow.StateFlashing:
+			start := time.Now()
+			result := flashStep(ctx, next, volume, flasher, dfu)
+			if !result.Success {
+				seq.Done(fmt.Errorf("flash failed: %w", result.Error))
+				continue
+			}
+			rep.AddFlash(next.Side, next.Path, result, time.Since(start))
+			recordFlash(flashes, cfg, next.Side, next.Path)
+			if next.Files > 1 {
+				logf("Flashed %s: %s (%d bytes)\n", next.Side, filepath.Base(next.Path), result.BytesWritten)
+			} else {
+				logf("Flashed %s (%d bytes)\n", next.Side, result.BytesWritten)
+			}
+			logResult(result)
+			seq.Done(nil)
+			if seq.Rebooting() {
+				rebootTimeout = time.After(device.RebootTimeout)
+			}
+			timeout = time.After(5 * time.Minute)
+			continue
+		case flow.StateComplete:
+			setStatus(status.Complete, "", 0)
+			if !seq.Rebooting() {
+				endGroup()
+				logf("\nFlash complete!\n")
+				return nil
 			}
 		}
-		cancel()
 
-		if devicePath == "" {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("device detection stopped")
+			}
+			debugEvent(event)
+			unreadable = warnUnreadable(event, unreadable)
+			volume = event
+			if event.Connected && event.Path != "" {
+				seq.Connected(event.Path)
+			} else if !event.Connected {
+				seq.Disconnected()
+			}
+		case <-rebootTimeout:
+			rebootTimeout = nil
+			seq.RebootTimeout()
+		case <-timeout:
 			return fmt.Errorf("timeout waiting for device")
 		}
+	}
+}
+
+// flashStep writes the file a flash sequence asked for, with dfu-util or
+// by copying it to the bootloader volume described by volume
+func flashStep(ctx context.Context, e flow.Event, volume device.Event, flasher firmware.FirmwareFlasher, dfu *firmware.DFUFlasher) firmware.FlashResult {
+	if e.Files > 1 {
+		logf("File %d/%d: %s\n", e.File+1, e.Files, e.Path)
+	}
+	if dfu != nil {
+		logf("Put %s into DFU mode...\n", e.Side)
+		return dfu.Flash(ctx, e.Path, func(p firmware.QMKProgress) {
+			logf("%s\n", p.Output)
+		})
+	}
 
-		fmt.Printf("Device found at %s\n", devicePath)
+	logf("Device found at %s\n", e.Device)
+	if volume.FSType != "" || volume.Capacity > 0 {
+		logf("Volume: %s, %s, %s\n", volume.Label, volume.FSType, firmware.FormatSize(volume.Capacity))
+	}
 
-		// Flash
-		result := flasher.Flash(ctx, filePath, devicePath)
-		if !result.Success {
-			return fmt.Errorf("flash failed: %w", result.Error)
+	// Progress is spread across the side's files
+	show, done := flashProgress()
+	defer done()
+	progressFn := func(p firmware.FlashProgress) {
+		p.Percent = (e.File*100 + p.Percent) / max(e.Files, 1)
+		setStatus(status.Flashing, e.Side, p.Percent)
+		if show != nil {
+			show(p)
 		}
+	}
+	return flasher.Flash(ctx, e.Path, e.Device, progressFn)
+}
 
-		fmt.Printf("Flashed %s (%d bytes)\n", side, result.BytesWritten)
+// buildHeadless builds target, printing its progress, and returns the
+// directory of the build it made ("" when the builder does not say)
+func buildHeadless(ctx context.Context, cfg *config.Config, builder firmware.FirmwareBuilder, target string) (string, error) {
+	// Without the TUI there is no one to ask, so only "always" pulls
+	if cfg.Build.Pull == "always" {
+		if _, err := git.GetStatus(ctx, cfg.Build.WorkingDir); err == nil {
+			logf("Pulling zmk-config...\n")
+			if err := git.Pull(ctx, cfg.Build.WorkingDir); err != nil {
+				return "", fmt.Errorf("pull failed: %w", err)
+			}
+		}
 	}
 
-	fmt.Println("\nFlash complete!")
-	return nil
-}
+	if dockerBuilder, ok := builder.(*firmware.DockerBuilder); ok {
+		if err := firmware.CheckDocker(ctx); err != nil {
+			return "", err
+		}
+		dockerBuilder.SetStudio(cfg.Build.Studio)
+		var done int
+		if err := dockerBuilder.EnsureImage(ctx, func(p firmware.PullProgress) {
+			if p.Line == "" {
+				return // byte progress, too chatty for a log
+			}
+			if p.Done == done {
+				logf("%s\n", p.Line)
+				return
+			}
+			done = p.Done
+			logf("%s (%s)\n", p.Line, p.Summary())
+		}); err != nil {
+			if errors.Is(err, firmware.ErrPullTimeout) {
+				return "", fmt.Errorf("%w (raise build.docker.pull_timeout on a slow connection)", err)
+			}
+			return "", err
+		}
+	}
 
-func formatBuildDate(date string) string {
-	if date == "" {
-		return "current"
+	show, done := buildProgress()
+	percent := 0
+	setStatus(status.Building, target, 0)
+	result := builder.Build(ctx, target, func(p firmware.BuildProgress) {
+		if p.Percent >= 0 && p.Percent != percent {
+			percent = p.Percent
+			setStatus(status.Building, target, percent)
+		}
+		if show != nil {
+			show(p)
+		}
+	})
+	done()
+	for _, w := range result.Warnings {
+		debugf("Warning: %s\n", w)
+	}
+	if !result.Success {
+		return "", fmt.Errorf("build failed: %w", result.Error)
+	}
+	logf("Built %s in %s", target, result.Duration.Round(time.Second))
+	if n := len(result.Warnings); n > 0 {
+		logf(" (%d warnings, -vv lists them)", n)
 	}
-	return firmware.FormatDate(date)
+	logf("\n")
+
+	if result.OutputPath == "" {
+		return "", nil
+	}
+	return filepath.Dir(result.OutputPath), nil
+}
+
+// statusFile is kept up to date by headless commands when status.enabled
+// is set
+var statusFile *status.File
+
+// statusKeyboard names the keyboard in the status file
+var statusKeyboard string
+
+// openStatus starts writing the status file if the config asks for it
+func openStatus(cfg *config.Config) {
+	if !cfg.Status.Enabled {
+		return
+	}
+	path := cfg.Status.Path
+	if path == "" {
+		var err error
+		if path, err = status.DefaultPath(); err != nil {
+			printWarning("Status file off: " + err.Error())
+			return
+		}
+	}
+	statusFile, statusKeyboard = status.NewFile(path), cfg.Keyboard.Name
+	setStatus(status.Idle, "", 0)
+}
+
+// setStatus writes what a headless command is doing to the status file,
+// turning it off if it cannot be written
+func setStatus(state status.State, side string, percent int) {
+	err := statusFile.Set(status.Status{State: state, Keyboard: statusKeyboard, Side: side, Percent: percent})
+	if err != nil {
+		printWarning("Status file off: " + err.Error())
+		statusFile = nil
+	}
+}
+
+// closeStatus removes the status file as the command ends
+func closeStatus() {
+	statusFile.Remove()
+	statusFile = nil
+}
+
+// assumeYes answers every headless prompt without asking, set with --assume-yes
+var assumeYes bool
+
+// errCancelled is returned when a headless prompt is answered no
+var errCancelled = errors.New("cancelled")
+
+// stdin reads answers to headless prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirmf asks a yes/no question on stderr and reads the answer from stdin,
+// defaulting to no. Without a terminal on stdin (cron, CI) or with
+// --assume-yes it answers yes without asking, so scripted runs carry on past
+// the warning printed before the question.
+func confirmf(format string, args ...any) bool {
+	if assumeYes || !isTerminal(os.Stdin) {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, format+" [y/N] ", args...)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// openFlashLog loads the history of flashed firmware, starting an empty one
+// if it cannot be read
+func openFlashLog() *flashlog.Log {
+	path, err := flashlog.DefaultPath()
+	if err != nil {
+		return flashlog.New()
+	}
+	flashes, err := flashlog.Load(path)
+	if err != nil {
+		logf("Warning: ignoring flash history: %v\n", err)
+	}
+	return flashes
+}
+
+// recordFlash notes the file flashed to side. A history that cannot be
+// saved only costs the already-flashed check.
+func recordFlash(flashes *flashlog.Log, cfg *config.Config, side, path string) {
+	err := flashes.Record(flashlog.Key(cfg.Keyboard.Name, side), path, time.Now())
+	if err == nil {
+		err = flashes.Save()
+	}
+	if err != nil {
+		logf("Warning: cannot save flash history: %v\n", err)
+	}
+}
+
+// logResult prints what a flash wrote where, to tie the board to the artifact
+func logResult(result firmware.FlashResult) {
+	if result.SHA256 != "" {
+		logf("SHA-256: %s\n", result.SHA256)
+	}
+	if result.Destination != "" {
+		logf("Written to: %s\n", result.Destination)
+	}
+}
+
+// warnf prints a headless warning and records it in the session report
+func warnf(rep *report.Report, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	rep.Warn(msg)
+	if ci == ciGitHub {
+		logf("::warning::%s\n", escapeAnnotation(msg))
+		return
+	}
+	logf("Warning: %s\n", msg)
+}
+
+// writeReport finishes the session report and writes it when enabled.
+// A report that cannot be written does not fail the session.
+func writeReport(cfg *config.Config, rep *report.Report, err error) {
+	rep.Finish(err)
+	if !cfg.Report.Enabled {
+		return
+	}
+	path, werr := rep.Write(cfg.Report.Dir, cfg.Report.Format)
+	if werr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot write report: %v\n", werr)
+		return
+	}
+	logf("Report written to %s\n", path)
+}
+
+// waitForDevice waits up to five minutes for the bootloader volume. With
+// reconnect, the volume must disappear first, as it does when the bootloader
+// reboots after a flash.
+func waitForDevice(ctx context.Context, detector device.Detector, name string, pollInterval time.Duration, reconnect bool) (device.Event, error) {
+	detectCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	gone := !reconnect
+	var unreadable string
+	for event := range detector.Detect(detectCtx, name, pollInterval) {
+		debugEvent(event)
+		unreadable = warnUnreadable(event, unreadable)
+		if !event.Connected {
+			gone = true
+		} else if gone && event.Path != "" {
+			return event, nil
+		}
+	}
+	return device.Event{}, fmt.Errorf("timeout waiting for device")
+}
+
+// waitForReboot reports whether the bootloader volume unmounts within
+// device.RebootTimeout
+func waitForReboot(ctx context.Context, detector device.Detector, name string, pollInterval time.Duration) bool {
+	rebootCtx, cancel := context.WithTimeout(ctx, device.RebootTimeout)
+	defer cancel()
+
+	for event := range detector.Detect(rebootCtx, name, pollInterval) {
+		debugEvent(event)
+		if !event.Connected {
+			return true
+		}
+	}
+	return false
+}
+
+// debugEvent prints a detector event with -vv
+func debugEvent(event device.Event) {
+	if event.Connected {
+		debugf("Detector: %s connected (label %q, %s, serial %q)\n", event.Path, event.Label, event.FSType, event.Serial)
+	} else {
+		debugf("Detector: not connected (expected at %s)\n", event.Path)
+	}
+}
+
+// warnUnreadable warns about a bootloader mounted where it cannot be used,
+// unless last already said the same, and returns the warning for the next
+// event to compare with
+func warnUnreadable(event device.Event, last string) string {
+	if event.Err == nil {
+		return ""
+	}
+	msg := event.Err.Error()
+	if msg != last {
+		printWarning(msg)
+	}
+	return msg
+}
+
+// runHeadlessQMK flashes each side with the qmk CLI, streaming its output
+func runHeadlessQMK(cfg *config.Config, rep *report.Report) error {
+	defer endGroup()
+
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+
+	flasher := firmware.NewQMKFlasher(cfg.Flash.QMKKeyboard, cfg.Flash.QMKKeymap, cfg.Build.WorkingDir)
+	ctx := context.Background()
+
+	for _, side := range sides {
+		groupf("Flashing %s with qmk (%s:%s)", side, cfg.Flash.QMKKeyboard, cfg.Flash.QMKKeymap)
+
+		start := time.Now()
+		result := flasher.Flash(ctx, func(p firmware.QMKProgress) {
+			logf("%s\n", p.Output)
+		})
+		if !result.Success {
+			return fmt.Errorf("flash failed: %w", result.Error)
+		}
+		rep.AddFlash(side, "", result, time.Since(start))
+
+		logf("Flashed %s\n", side)
+	}
+
+	endGroup()
+	logf("\nFlash complete!\n")
+	return nil
+}
+
+// runDiff compares the payloads of two UF2 files
+func runDiff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: kbflash diff <a.uf2> <b.uf2>")
+	}
+
+	diff, err := firmware.DiffUF2Files(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d blocks, %s payload\n", args[0], diff.BlocksA, firmware.FormatSize(diff.PayloadA))
+	fmt.Printf("%s: %d blocks, %s payload\n", args[1], diff.BlocksB, firmware.FormatSize(diff.PayloadB))
+	if diff.Identical() {
+		fmt.Println("Identical")
+		return nil
+	}
+	fmt.Printf("%d blocks differ, size delta %+d bytes\n", diff.DifferentBlocks, diff.SizeDelta())
+	return nil
+}
+
+// runFlashFile waits for the device and flashes one UF2 file, bypassing the
+// firmware scanner. With --all-keyboards it flashes the newest build of
+// every keyboard in root instead.
+func runFlashFile(cfg, root *config.Config, args []string) error {
+	fs := flag.NewFlagSet("flash", flag.ExitOnError)
+	side := fs.String("side", "", "Side the file is for, to check the bootloader's board (default: guessed from the file name)")
+	allKeyboards := fs.Bool("all-keyboards", false, "Flash the newest build of every configured keyboard, one after another")
+	fs.Parse(args)
+	path := fs.Arg(0)
+	fs.Parse(fs.Args()[min(1, fs.NArg()):]) // flags may follow the file
+	if *allKeyboards {
+		if path != "" || *side != "" {
+			return fmt.Errorf("usage: kbflash flash --all-keyboards")
+		}
+		return runAllKeyboards(root)
+	}
+	if path == "" || fs.NArg() > 0 {
+		return fmt.Errorf("usage: kbflash flash <file.uf2> [--side <side>] | --all-keyboards")
+	}
+	if cfg.Flash.Mode != "copy" {
+		return fmt.Errorf("kbflash flash needs flash.mode = \"copy\"")
+	}
+
+	if err := firmware.CheckFirmwareFile(path, cfg.Flash.Extension(), cfg.Flash.MinSize); err != nil {
+		return err
+	}
+	if cfg.Flash.Extension() == ".uf2" {
+		if _, err := firmware.UF2PayloadSize(path); err != nil {
+			return err
+		}
+	}
+
+	sides := cfg.Keyboard.Sides
+	if *side == "" {
+		*side = guessSide(cfg, sides, path)
+	} else if len(sides) > 0 && !slices.Contains(sides, *side) {
+		return fmt.Errorf("unknown side %q, expected one of %s", *side, strings.Join(sides, ", "))
+	}
+
+	logf("File: %s\n", path)
+	if *side != "" {
+		logf("Side: %s\n", *side)
+		if size, ok, err := firmware.CheckImageSize(path, cfg.Build.BoardFor(*side)); err == nil && ok {
+			logf("Size: %s\n", size)
+			if size.Exceeds() {
+				logf("Warning: firmware is larger than the %s flash\n", cfg.Build.BoardFor(*side))
+			}
+		}
+	}
+	flashes := openFlashLog()
+	if *side != "" {
+		if last, ok := flashes.Flashed(flashlog.Key(cfg.Keyboard.Name, *side), path); ok {
+			logf("This exact firmware is already on %s (flashed %s)\n", *side, last.Time.Format("2006-01-02 15:04"))
+			if !confirmf("Flash %s anyway?", *side) {
+				return errCancelled
+			}
+		}
+	}
+
+	ctx := context.Background()
+	detector := components.NewDetector(cfg)
+	pollInterval := time.Duration(cfg.Device.PollInterval)
+
+	logf("Waiting for %s...\n", cfg.Device.Name)
+	found, err := waitForDevice(ctx, detector, cfg.Device.Name, pollInterval, false)
+	if err != nil {
+		return err
+	}
+	logf("Device found at %s\n", found.Path)
+
+	if info, err := firmware.ReadBootloaderInfo(found.Path); err == nil && *side != "" {
+		if err := firmware.CheckSideBoard(info, *side, cfg.Build.Boards(sides)); err != nil {
+			return err
+		}
+	}
+
+	show, done := flashProgress()
+	result := components.NewFlasher(cfg).Flash(ctx, path, found.Path, show)
+	done()
+	if !result.Success {
+		return fmt.Errorf("flash failed: %w", result.Error)
+	}
+	logf("Flashed %s (%d bytes)\n", filepath.Base(path), result.BytesWritten)
+	logResult(result)
+	if *side != "" {
+		recordFlash(flashes, cfg, *side, path)
+	}
+
+	if waitForReboot(ctx, detector, cfg.Device.Name, pollInterval) {
+		logf("Device rebooted\n")
+	} else {
+		logf("Warning: %s still mounted after %s; the flash may not have taken\n", cfg.Device.Name, device.RebootTimeout)
+	}
+	return nil
+}
+
+// runAllKeyboards flashes the newest build of each keyboard profile in
+// turn, asking before each one, and writes a combined JSON report of the
+// sessions to report.dir. A keyboard that fails does not stop the others.
+func runAllKeyboards(root *config.Config) error {
+	names := root.ProfileNames()
+	if len(names) == 0 {
+		names = []string{root.Keyboard.Name}
+	}
+	batch := report.NewBatch()
+	flashes := openFlashLog()
+	for i, name := range names {
+		cfg, err := selectProfile(root, name)
+		if err != nil {
+			return err
+		}
+		logf("\n[%d/%d] %s\n", i+1, len(names), name)
+		if !confirmf("Flash %s?", name) {
+			logf("Skipped %s\n", name)
+			batch.Skip(name)
+			continue
+		}
+		run := runOptions{onReport: batch.Add}
+		if err := runHeadless(cfg, components.NewDetector(cfg), components.NewFlasher(cfg), flashes, run); err != nil {
+			printError(fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	batch.Finish()
+
+	path, err := batch.Write(root.Report.Dir)
+	if err != nil {
+		printWarning("Cannot write report: " + err.Error())
+	} else {
+		logf("\nReport written to %s\n", path)
+	}
+	logf("Flashed %d of %d keyboards\n", len(batch.Sessions)-len(batch.Failed()), len(names))
+	if failed := batch.Failed(); len(failed) > 0 {
+		return fmt.Errorf("flashing failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runJob runs the steps of a job file in order, headless, then prints how
+// each went. A failed step stops the job unless it sets continue_on_error.
+// Every step's keyboard and target are checked before the first one runs.
+func runJob(cfg, root *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: kbflash job <job.toml>")
+	}
+	j, err := job.Load(args[0])
+	if err != nil {
+		return err
+	}
+	cfgs := make([]*config.Config, len(j.Steps))
+	for i, step := range j.Steps {
+		cfgs[i] = cfg
+		if step.Keyboard != "" {
+			if cfgs[i], err = selectProfile(root, step.Keyboard); err != nil {
+				return fmt.Errorf("steps[%d]: %w", i, err)
+			}
+		}
+		if err := checkJobStep(cfgs[i], step); err != nil {
+			return fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+
+	flashes := openFlashLog()
+	built := make(map[string]string) // build directory the job made, by keyboard
+	results := make([]string, len(j.Steps))
+	var failed []string
+	stopped := false
+	for i, step := range j.Steps {
+		if stopped {
+			results[i] = "skipped"
+			continue
+		}
+		groupf("[%d/%d] %s", i+1, len(j.Steps), step.Title())
+		start := time.Now()
+		err := runJobStep(cfgs[i], step, flashes, built)
+		took := time.Since(start).Round(time.Second)
+		if err != nil {
+			printError(fmt.Errorf("%s: %w", step.Title(), err))
+			results[i] = fmt.Sprintf("failed after %s: %v", took, err)
+			failed = append(failed, step.Title())
+			stopped = !step.ContinueOnError
+			continue
+		}
+		results[i] = fmt.Sprintf("done in %s", took)
+	}
+	endGroup()
+
+	logf("\nJob %s:\n", filepath.Base(args[0]))
+	for i, step := range j.Steps {
+		logf("  [%d/%d] %s: %s\n", i+1, len(j.Steps), step.Title(), results[i])
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("job failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkJobStep reports a step that cannot run with cfg, before any step runs
+func checkJobStep(cfg *config.Config, step job.Step) error {
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	if step.Target != "all" && !slices.Contains(sides, step.Target) {
+		return fmt.Errorf("unknown target %q for %s, expected all or one of %s", step.Target, cfg.Keyboard.Name, strings.Join(sides, ", "))
+	}
+	switch step.Action {
+	case job.ActionClean, job.ActionBuild:
+		if !cfg.Build.Enabled {
+			return fmt.Errorf("%s needs build.enabled = true for %s", step.Action, cfg.Keyboard.Name)
+		}
+		if step.Action == job.ActionBuild && cfg.Flash.Mode == "qmk" {
+			return fmt.Errorf("qmk builds as it flashes; use a flash step for %s", cfg.Keyboard.Name)
+		}
+	}
+	return nil
+}
+
+// runJobStep runs one step of a job. Flash steps flash the build an earlier
+// step of the job made for the keyboard, recorded in built, or the newest.
+func runJobStep(cfg *config.Config, step job.Step, flashes *flashlog.Log, built map[string]string) error {
+	ctx := context.Background()
+	switch step.Action {
+	case job.ActionWestUpdate:
+		return runWestUpdate(cfg)
+	case job.ActionClean:
+		return runClean(cfg, []string{"--target", step.Target})
+	case job.ActionBuild:
+		if step.Pristine {
+			if err := runClean(cfg, []string{"--target", step.Target}); err != nil {
+				return err
+			}
+		}
+		dir, err := buildHeadless(ctx, cfg, components.NewBuilder(cfg), step.Target)
+		if err != nil {
+			return err
+		}
+		built[cfg.Keyboard.Name] = dir
+		return nil
+	case job.ActionFlash:
+		if step.AssumeYes {
+			defer func(was bool) { assumeYes = was }(assumeYes)
+			assumeYes = true
+		}
+		run := runOptions{target: step.Target, dir: built[cfg.Keyboard.Name]}
+		return runHeadless(cfg, components.NewDetector(cfg), components.NewFlasher(cfg), flashes, run)
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
+
+// runConfig runs config file tooling: schema prints the JSON Schema for
+// editors and taplo, migrate rewrites renamed keys to their current names
+func runConfig(configPath string, args []string) error {
+	usage := fmt.Errorf("usage: kbflash config schema|migrate")
+	if len(args) != 1 {
+		return usage
+	}
+	switch args[0] {
+	case "schema":
+		schema, err := config.Schema()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(schema))
+		return nil
+	case "migrate":
+		changes, err := config.Migrate(configPath)
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if err == nil && len(changes) == 0 {
+			fmt.Println("Config is up to date")
+		}
+		return err
+	}
+	return usage
+}
+
+// runAgent serves `kbflash agent`, run over ssh by a kbflash whose
+// device.host is this machine: detection and flashing happen here with the
+// options the other side sends
+func runAgent(args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	return agent.Serve(ctx, args, agent.Tools{
+		Detector: device.NewWithOptions,
+		Flasher: func(opts agent.FlashOptions) firmware.FirmwareFlasher {
+			cfg := &config.Config{}
+			cfg.Device.Name = opts.DeviceName
+			cfg.Device.Profile = opts.Profile
+			cfg.Flash.WriteStrategy = opts.WriteStrategy
+			cfg.Flash.SyncEvery = opts.SyncEvery
+			if cfg.Device.Profile == "" {
+				cfg.Device.Profile = config.DefaultDeviceProfile
+			}
+			return components.NewFlasher(cfg)
+		},
+	}, os.Stdin, os.Stdout)
+}
+
+// runDevices lists the removable volumes mounted right now, marking the one
+// device.name matches, so the bootloader's label can be found before the
+// config is written. With device.host set they are listed on that host.
+func runDevices(configPath string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: kbflash devices")
+	}
+
+	var name string
+	var lister device.Detector = device.NewWithOptions(device.Options{})
+	if cfg, err := config.Load(configPath); err == nil {
+		name = cfg.Device.Name
+		lister = components.NewDetector(cfg)
+	}
+	volumes, err := lister.List(context.Background())
+	if err != nil {
+		return fmt.Errorf("list devices: %w", err)
+	}
+	if len(volumes) == 0 {
+		fmt.Println("No removable volumes mounted. Double-tap reset to enter the bootloader and try again.")
+		return nil
+	}
+
+	matched := false
+	for _, v := range volumes {
+		mark := " "
+		if name != "" && strings.EqualFold(v.Label, name) {
+			mark, matched = "*", true
+		}
+		var details []string
+		if v.FSType != "" {
+			details = append(details, v.FSType)
+		}
+		if v.Capacity > 0 {
+			details = append(details, firmware.FormatSize(v.Capacity))
+		}
+		if v.Serial != "" {
+			details = append(details, "serial "+v.Serial)
+		}
+		line := fmt.Sprintf("%s %-12s %s", mark, v.Label, v.Path)
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	if matched {
+		fmt.Printf("\n* matches device.name = %q\n", name)
+	} else if name != "" {
+		fmt.Printf("\nNone matches device.name = %q; set it to the bootloader's label\n", name)
+	}
+	return nil
+}
+
+// runLatest prints the absolute paths of the newest build's firmware files
+func runLatest(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("latest", flag.ExitOnError)
+	side := fs.String("side", "", "Print only the file for this side")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: kbflash latest [--side <side>]")
+	}
+
+	builds, err := components.NewScanner(cfg).Scan(context.Background())
+	if err != nil {
+		return fmt.Errorf("scan firmware: %w", err)
+	}
+	if len(builds) == 0 {
+		return fmt.Errorf("no firmware found in %s", cfg.Build.FirmwareDir)
+	}
+
+	files := builds[0].Files
+	if *side != "" {
+		matcher, err := firmware.NewSideMatcher(cfg.Keyboard.SidePatterns)
+		if err != nil {
+			return err
+		}
+		matcher.SetStudio(cfg.Build.Studio)
+		file := matcher.Match(*side, files)
+		if file == nil {
+			return fmt.Errorf("no firmware file for %s", *side)
+		}
+		files = []firmware.File{*file}
+	}
+
+	for _, f := range files {
+		path, err := filepath.Abs(f.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// runClean removes the build directories of a target, every side by
+// default, and in Docker mode for all also the build container and named
+// cache volumes
+func runClean(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	target := fs.String("target", "all", "Side to clean, or all")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: kbflash clean [--target <side|all>]")
+	}
+	if !cfg.Build.Enabled {
+		return fmt.Errorf("kbflash clean needs build.enabled = true")
+	}
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	if *target != "all" && !slices.Contains(sides, *target) {
+		return fmt.Errorf("unknown target %q, expected all or one of %s", *target, strings.Join(sides, ", "))
+	}
+
+	ctx := context.Background()
+	if cfg.Build.Mode == "docker" {
+		if err := firmware.CheckDocker(ctx); err != nil {
+			return err
+		}
+	}
+	if err := components.NewBuilder(cfg).Clean(ctx, *target); err != nil {
+		return fmt.Errorf("clean %s: %w", *target, err)
+	}
+	logf("Cleaned build files for %s\n", *target)
+	return nil
+}
+
+// runSign writes SHA256SUMS for a build and signs it with signing.key: the
+// newest build in firmware_dir, or the build directory given. Docker builds
+// are signed as they are made; this covers native builds and older ones.
+func runSign(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: kbflash sign [build-dir]")
+	}
+	signer := components.NewSigner(cfg)
+	if !signer.CanSign() {
+		return fmt.Errorf("kbflash sign needs signing.method and signing.key")
+	}
+
+	ctx := context.Background()
+	build, err := localBuild(ctx, cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := signer.SignBuild(ctx, build); err != nil {
+		return fmt.Errorf("sign %s: %w", build.Title(), err)
+	}
+	logf("Signed %d file(s) in %s\n", len(build.Files), build.Path)
+	return nil
+}
+
+// localBuild returns the build in dir, or the newest one for "", out of the
+// builds in firmware_dir: builds made here, not ones from build.sources
+func localBuild(ctx context.Context, cfg *config.Config, dir string) (firmware.Build, error) {
+	local := *cfg
+	local.Build.Sources = nil
+	builds, err := components.NewScanner(&local).Scan(ctx)
+	if err != nil {
+		return firmware.Build{}, fmt.Errorf("scan firmware: %w", err)
+	}
+	if len(builds) == 0 {
+		return firmware.Build{}, fmt.Errorf("no firmware found in %s", cfg.Build.FirmwareDir)
+	}
+	if dir == "" {
+		return builds[0], nil
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return firmware.Build{}, err
+	}
+	i := slices.IndexFunc(builds, func(b firmware.Build) bool {
+		path, err := filepath.Abs(b.Path)
+		return err == nil && path == abs
+	})
+	if i < 0 {
+		return firmware.Build{}, fmt.Errorf("no build with firmware in %s", dir)
+	}
+	return builds[i], nil
+}
+
+// runRemote lists, downloads or uploads builds in the remote cache
+func runRemote(cfg *config.Config, args []string) error {
+	usage := fmt.Errorf("usage: kbflash remote list|pull|push [build-dir]")
+	if len(args) == 0 {
+		return usage
+	}
+	cache, err := newRemote(cfg)
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		return fmt.Errorf("kbflash remote needs build.remote.url")
+	}
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names, err := cache.List(ctx)
+		if err != nil {
+			return fmt.Errorf("list %s: %w", cache, err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+
+	case args[0] == "pull" && len(args) == 1:
+		return pullRemote(ctx, cache)
+
+	case args[0] == "push" && len(args) <= 2:
+		var dir string
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		build, err := localBuild(ctx, cfg, dir)
+		if err != nil {
+			return err
+		}
+		return pushRemote(ctx, cache, build)
+	}
+	return usage
+}
+
+// pullRemote downloads new builds from the remote cache
+func pullRemote(ctx context.Context, cache *remote.Cache) error {
+	logf("Checking %s for new builds...\n", cache)
+	names, err := cache.Pull(ctx)
+	for _, name := range names {
+		logf("Downloaded %s\n", name)
+	}
+	if err != nil {
+		return fmt.Errorf("pull from %s: %w", cache, err)
+	}
+	if len(names) == 0 {
+		logf("Remote builds are up to date\n")
+	}
+	return nil
+}
+
+// pushRemote uploads a build to the remote cache
+func pushRemote(ctx context.Context, cache *remote.Cache, build firmware.Build) error {
+	logf("Uploading %s to %s...\n", build.Title(), cache)
+	if err := cache.Push(ctx, build); err != nil {
+		return fmt.Errorf("upload %s: %w", build.Title(), err)
+	}
+	logf("Uploaded %s\n", build.Title())
+	return nil
+}
+
+// runExport packs a build, the newest by default, into a bundle file
+func runExport(cfg *config.Config, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: kbflash export [build-dir] bundle.tar.gz")
+	}
+	dest := args[len(args)-1]
+	var dir string
+	if len(args) == 2 {
+		dir = args[0]
+	}
+	build, err := localBuild(context.Background(), cfg, dir)
+	if err != nil {
+		return err
+	}
+	info, err := bundle.Export(build, bundle.Info{
+		Keyboard: cfg.Keyboard.Name,
+		Tags:     openTags().For(build.Path),
+	}, dest)
+	if err != nil {
+		return fmt.Errorf("export %s: %w", build.Title(), err)
+	}
+	logf("Exported %s (%d files) to %s\n", build.Title(), len(info.Files), dest)
+	return nil
+}
+
+// runImport unpacks a bundle into firmware_dir, restoring its tags
+func runImport(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: kbflash import bundle.tar.gz")
+	}
+	// Bundles come from elsewhere, so their firmware must be signed by a
+	// trusted key whenever signing.trusted_keys is set
+	var verify func(path string) error
+	if check := components.NewSigner(cfg).Check([]string{cfg.Build.FirmwareDir}); check != nil {
+		verify = func(path string) error {
+			if ok, _ := filepath.Match(cfg.Build.FilePattern, filepath.Base(path)); !ok {
+				return nil
+			}
+			return check(context.Background(), path)
+		}
+	}
+	info, err := bundle.Import(args[0], cfg.Build.FirmwareDir, verify)
+	if err != nil {
+		return fmt.Errorf("import %s: %w", args[0], err)
+	}
+	if info.Keyboard != "" && info.Keyboard != cfg.Keyboard.Name {
+		printWarning(fmt.Sprintf("%s was exported for %s, not %s", args[0], info.Keyboard, cfg.Keyboard.Name))
+	}
+	path := filepath.Join(cfg.Build.FirmwareDir, info.Name)
+	if len(info.Tags) > 0 {
+		store := openTags()
+		for _, tag := range info.Tags {
+			if tag = tags.Normalize(tag); tag != "" && !store.Has(path, tag) {
+				store.Toggle(path, tag)
+			}
+		}
+		if err := store.Save(); err != nil {
+			printWarning("Cannot save tags: " + err.Error())
+		}
+	}
+	logf("Imported %s into %s\n", info.Name, path)
+	return nil
+}
+
+// openTags loads the tags of builds, starting an empty store if they
+// cannot be read
+func openTags() *tags.Store {
+	path, err := tags.DefaultPath()
+	if err != nil {
+		return tags.New()
+	}
+	store, err := tags.Load(path)
+	if err != nil {
+		logf("Warning: ignoring tags: %v\n", err)
+	}
+	return store
+}
+
+// guessSide returns the only side the file name belongs to, or ""
+func guessSide(cfg *config.Config, sides []string, path string) string {
+	matcher, err := firmware.NewSideMatcher(cfg.Keyboard.SidePatterns)
+	if err != nil {
+		return ""
+	}
+	return matcher.SideOf(sides, filepath.Base(path))
+}
+
+// defaultWebAddr is where kbflash web listens unless --addr says otherwise.
+const defaultWebAddr = "127.0.0.1:7878"
+
+// runWeb serves the web dashboard until interrupted. Listening beyond
+// localhost requires a random token, printed as part of the URL.
+func runWeb(cfg *config.Config, args []string, c web.Components) error {
+	fs := flag.NewFlagSet("web", flag.ExitOnError)
+	addr := fs.String("addr", defaultWebAddr, "Address to listen on; use 0.0.0.0:7878 to flash from another device")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: kbflash web [--addr <host:port>]")
+	}
+
+	server, err := web.NewServer(cfg, c)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	url := "http://" + listener.Addr().String() + "/"
+	if host, port, _ := net.SplitHostPort(listener.Addr().String()); !web.IsLoopback(host) {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		server.SetToken(hex.EncodeToString(token))
+		if name, err := os.Hostname(); err == nil && net.ParseIP(host).IsUnspecified() {
+			host = name
+		}
+		url = "http://" + net.JoinHostPort(host, port) + "/?token=" + hex.EncodeToString(token)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server.Start(ctx)
+	srv := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("kbflash %s - %s dashboard at %s (Ctrl+C to stop)\n", version, cfg.Keyboard.Name, url)
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// webComponents creates the detector, flashers and scanner the web
+// dashboard drives, as configured
+func webComponents(cfg *config.Config) web.Components {
+	c := web.Components{
+		Detector: components.NewDetector(cfg),
+		Flasher:  components.NewFlasher(cfg),
+		Scanner:  components.NewScanner(cfg),
+		Flashes:  openFlashLog(),
+	}
+	if cfg.Flash.Mode == "dfu" {
+		c.DFU = components.NewDFUFlasher(cfg)
+	}
+	return c
+}
+
+// runSetupUdev prints udev rules for the configured bootloaders (every
+// profile's), or installs them with --install and reloads udev
+func runSetupUdev(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("setup-udev", flag.ExitOnError)
+	install := fs.Bool("install", false, "Install the rules to "+device.UdevRulesPath+" (uses sudo)")
+	fs.Parse(args)
+
+	configs := []*config.Config{cfg}
+	if len(cfg.Profiles) > 0 {
+		configs = configs[:0]
+		for _, name := range cfg.ProfileNames() {
+			configs = append(configs, cfg.Profiles[name])
+		}
+	}
+
+	var devices []device.UdevDevice
+	seen := make(map[device.USBID]bool)
+	for _, c := range configs {
+		if c.Device.Name == "" && c.Device.USBID == "" {
+			continue // qmk mode, no UF2 volume
+		}
+		id := device.USBID(c.Device.USBID)
+		if id == "" {
+			known, ok := device.BootloaderUSBID(c.Device.Name)
+			if !ok {
+				return fmt.Errorf("unknown USB ID for %s: set device.usb_id (find it with lsusb while the bootloader is connected)", c.Device.Name)
+			}
+			id = known
+		}
+		if !seen[id] {
+			seen[id] = true
+			devices = append(devices, device.UdevDevice{Name: c.Device.Name, ID: id})
+		}
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no UF2 bootloader configured")
+	}
+	rules := device.UdevRules(devices)
+
+	if !*install {
+		fmt.Print(rules)
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "kbflash-udev-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(rules); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"install", "-m", "0644", tmp.Name(), device.UdevRulesPath},
+		{"udevadm", "control", "--reload-rules"},
+		{"udevadm", "trigger"},
+	} {
+		if os.Geteuid() != 0 {
+			args = append([]string{"sudo"}, args...)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+		}
+	}
+
+	fmt.Printf("Installed %s; reconnect the bootloader to apply\n", device.UdevRulesPath)
+	return nil
+}
+
+// runWestUpdate refreshes the west workspace modules, printing west's output
+func runWestUpdate(cfg *config.Config) error {
+	ctx := context.Background()
+	if cfg.Build.Mode == "docker" {
+		if err := firmware.CheckDocker(ctx); err != nil {
+			return err
+		}
+	}
+
+	updater := firmware.NewWestUpdater(cfg.Build.Mode, cfg.Build.Docker.Image, cfg.Build.WorkingDir)
+	updater.SetUser(firmware.ResolveDockerUser(cfg.Build.Docker.User))
+	updater.SetCommandLog(func(args []string) {
+		debugf("$ %s\n", strings.Join(args, " "))
+	})
+	var projects int
+	result := updater.Update(ctx, func(p firmware.BuildProgress) {
+		projects = p.Current
+		logf("%s\n", p.Output)
+	})
+	if !result.Success {
+		return result.Error
+	}
+
+	logf("\nwest update complete: %d projects in %s\n", projects, result.Duration.Round(time.Second))
+	return nil
+}
+
+// newRemote opens the configured remote cache, or returns nil without one
+func newRemote(cfg *config.Config) (*remote.Cache, error) {
+	if cfg.Build.Remote.URL == "" {
+		return nil, nil
+	}
+	return remote.New(cfg.Build.Remote.URL, cfg.Build.Remote.Dir)
+}
+
+// Output levels for headless commands, set with -q and -vv
+type outputLevel int
+
+const (
+	levelQuiet   outputLevel = iota // errors only
+	levelNormal                     // progress and results
+	levelVerbose                    // also detector events, copy blocks and commands
+)
+
+var output = levelNormal
+
+// logf prints unless -q is set
+func logf(format string, args ...any) {
+	if output >= levelNormal {
+		fmt.Printf(format, args...)
+	}
+}
+
+// debugf prints only with -vv
+func debugf(format string, args ...any) {
+	if output >= levelVerbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+// CI services headless output is formatted for
+type ciService int
+
+const (
+	ciNone   ciService = iota
+	ciOther            // CI is set: plain output, no live progress bars
+	ciGitHub           // GitHub Actions: also log groups and annotations
+)
+
+var ci = detectCI()
+
+// detectCI returns the CI service kbflash runs under, from the variables
+// CI services set for every job
+func detectCI() ciService {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return ciGitHub
+	case os.Getenv("CI") != "" && os.Getenv("CI") != "false":
+		return ciOther
+	}
+	return ciNone
+}
+
+// inGroup is set while a GitHub Actions log group is open
+var inGroup bool
+
+// groupf starts a headless step. On GitHub Actions each step's output is
+// folded into a group, which ends at the next step or endGroup.
+func groupf(format string, args ...any) {
+	title := fmt.Sprintf(format, args...)
+	if ci != ciGitHub {
+		logf("\n%s...\n", title)
+		return
+	}
+	endGroup()
+	logf("::group::%s\n", title)
+	inGroup = true
+}
+
+// endGroup closes the open log group, if any
+func endGroup() {
+	if inGroup {
+		logf("::endgroup::\n")
+		inGroup = false
+	}
+}
+
+// printError reports a failed command: an error annotation on GitHub
+// Actions, which links it from the run summary, or a line on stderr
+func printError(err error) {
+	if ci == ciGitHub {
+		fmt.Printf("::error::%s\n", escapeAnnotation(err.Error()))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+}
+
+// printWarning prints a warning on stderr, or as an annotation on GitHub
+func printWarning(msg string) {
+	if ci == ciGitHub {
+		fmt.Printf("::warning::%s\n", escapeAnnotation(msg))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+}
+
+// escapeAnnotation escapes a message for a GitHub Actions workflow command,
+// which ends at the first newline
+func escapeAnnotation(msg string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(msg)
+}
+
+// flashProgress returns how copy progress is shown: a line per block with
+// -vv, a live bar on terminals outside CI, or nothing. done ends the output after the copy.
+func flashProgress() (show func(firmware.FlashProgress), done func()) {
+	switch {
+	case output >= levelVerbose:
+		return func(p firmware.FlashProgress) {
+			debugf("Wrote %s of %s (%d%%)\n", firmware.FormatSize(p.Written), firmware.FormatSize(p.Total), p.Percent)
+		}, func() {}
+	case output == levelNormal && isTerminal(os.Stdout) && ci == ciNone:
+		return printFlashProgress, func() { fmt.Println() }
+	}
+	return nil, func() {}
+}
+
+// buildProgress returns how build progress is shown: every output line with
+// -vv or on GitHub Actions (folded into the build's group), a live bar with
+// the build stage on terminals outside CI, or nothing. done ends the output
+// after the build.
+func buildProgress() (show func(firmware.BuildProgress), done func()) {
+	switch {
+	case output >= levelVerbose || output == levelNormal && ci == ciGitHub:
+		return func(p firmware.BuildProgress) {
+			if p.Output != "" {
+				logf("%s\n", p.Output)
+			}
+		}, func() {}
+	case output == levelNormal && isTerminal(os.Stdout) && ci == ciNone:
+		percent := 0
+		return func(p firmware.BuildProgress) {
+			if p.Percent >= 0 {
+				percent = p.Percent
+			}
+			printBar(percent, fmt.Sprintf("%-20s", p.Stage.String()))
+		}, func() { fmt.Println() }
+	}
+	return nil, func() {}
+}
+
+// printFlashProgress redraws a one-line progress bar in place
+func printFlashProgress(p firmware.FlashProgress) {
+	printBar(p.Percent, firmware.FormatSize(p.Written)+" / "+firmware.FormatSize(p.Total))
+}
+
+// printBar redraws a one-line progress bar at percent, followed by detail
+func printBar(percent int, detail string) {
+	const width = 30
+	filled := percent * width / 100
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+	fmt.Printf("\r[%s] %3d%% %s", bar, percent, detail)
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
 }
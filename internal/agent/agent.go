@@ -0,0 +1,225 @@
+// Package agent flashes a keyboard plugged into another machine, such as a
+// Raspberry Pi next to the keyboard, while builds and the UI stay local.
+// Host runs `kbflash agent` on that machine over ssh and stands in for the
+// local detector and flasher; Serve is the agent's side. Messages are JSON
+// objects, one per line.
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// maxInfoSize bounds the bootloader info file sent with each event.
+const maxInfoSize = 4096
+
+// event is a detector event sent by `kbflash agent detect`.
+type event struct {
+	Connected bool   `json:"connected"`
+	Path      string `json:"path,omitempty"`
+	Label     string `json:"label,omitempty"`
+	FSType    string `json:"fstype,omitempty"`
+	Capacity  int64  `json:"capacity,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	Info      string `json:"info,omitempty"` // content of the bootloader's INFO_UF2.TXT
+	// Unreadable says why a volume the host mounted cannot be used
+	Unreadable string `json:"unreadable,omitempty"`
+}
+
+// flashMessage is a line of `kbflash agent flash` output: progress, then
+// the result with Done set.
+type flashMessage struct {
+	Written int64 `json:"written,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+	Percent int   `json:"percent,omitempty"`
+
+	Done         bool   `json:"done,omitempty"`
+	Success      bool   `json:"success,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Removed      bool   `json:"removed,omitempty"` // the error was firmware.ErrDeviceRemoved
+	BytesWritten int64  `json:"bytes_written,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+}
+
+// FlashOptions configures the flasher on the host, from the client's
+// device and flash config.
+type FlashOptions struct {
+	DeviceName    string
+	Profile       string
+	WriteStrategy string
+	SyncEvery     int64
+}
+
+// Tools create the detector and flasher the agent drives.
+type Tools struct {
+	Detector func(device.Options) device.Detector
+	Flasher  func(FlashOptions) firmware.FirmwareFlasher
+}
+
+// Serve runs the agent command in args, `kbflash agent` having been
+// stripped: "detect" streams detector events until ctx is done, "list"
+// prints the mounted volumes and "flash" writes the firmware read from in
+// to the bootloader, streaming progress.
+func Serve(ctx context.Context, args []string, tools Tools, in io.Reader, out io.Writer) error {
+	usage := errors.New("usage: kbflash agent detect|list|flash [flags]; run by kbflash over ssh for device.host")
+	if len(args) == 0 {
+		return usage
+	}
+	fs := flag.NewFlagSet("agent "+args[0], flag.ContinueOnError)
+	var mountPaths stringList
+	fs.Var(&mountPaths, "mount-path", "Where volumes appear (repeatable)")
+	autoMount := fs.Bool("auto-mount", false, "Mount the bootloader with udisksctl")
+	switch args[0] {
+	case "detect":
+		name := fs.String("name", "", "Bootloader volume label")
+		poll := fs.Duration("poll", 500*time.Millisecond, "Detection interval")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		detector := tools.Detector(device.Options{MountPaths: mountPaths, AutoMount: *autoMount})
+		return serveDetect(ctx, detector, *name, *poll, out)
+
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		volumes, err := tools.Detector(device.Options{MountPaths: mountPaths}).List(ctx)
+		if err != nil {
+			return err
+		}
+		if volumes == nil {
+			volumes = []device.DeviceInfo{}
+		}
+		return json.NewEncoder(out).Encode(volumes)
+
+	case "flash":
+		var opts FlashOptions
+		dir := fs.String("dir", "", "Mount point of the bootloader")
+		name := fs.String("name", "", "Name of the firmware file")
+		fs.StringVar(&opts.DeviceName, "device-name", "", "Bootloader volume label, for its write quirks")
+		fs.StringVar(&opts.Profile, "profile", "", "Bootloader write quirks")
+		fs.StringVar(&opts.WriteStrategy, "strategy", "", "Write strategy: end, chunked or direct")
+		fs.Int64Var(&opts.SyncEvery, "sync-every", 0, "Bytes between syncs for chunked writes")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *dir == "" || *name == "" || *name != filepath.Base(*name) {
+			return errors.New("usage: kbflash agent flash --dir <mount point> --name <file>")
+		}
+		return serveFlash(ctx, tools.Flasher(opts), in, *dir, *name, out)
+	}
+	return usage
+}
+
+// serveDetect writes an event for every change of the bootloader's state
+func serveDetect(ctx context.Context, detector device.Detector, name string, poll time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	enc := json.NewEncoder(out)
+	for e := range detector.Detect(ctx, name, poll) {
+		msg := event{
+			Connected: e.Connected,
+			Path:      e.Path,
+			Label:     e.Label,
+			FSType:    e.FSType,
+			Capacity:  e.Capacity,
+			Serial:    e.Serial,
+		}
+		if e.Connected && e.Path != "" {
+			msg.Info = readInfo(e.Path)
+		}
+		if e.Err != nil {
+			msg.Unreadable = e.Err.Error()
+		}
+		// A failed write means ssh went away
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readInfo returns the bootloader's info file, "" without one
+func readInfo(path string) string {
+	f, err := os.Open(filepath.Join(path, firmware.InfoFileName))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(io.LimitReader(f, maxInfoSize))
+	return string(data)
+}
+
+// serveFlash saves the firmware read from in under its name and flashes it
+// to dir, writing progress and then the result
+func serveFlash(ctx context.Context, flasher firmware.FirmwareFlasher, in io.Reader, dir, name string, out io.Writer) error {
+	tmp, err := os.MkdirTemp("", "kbflash-agent-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, in); err != nil {
+		f.Close()
+		return fmt.Errorf("receive firmware: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	result := flasher.Flash(ctx, path, dir, func(p firmware.FlashProgress) {
+		enc.Encode(flashMessage{Written: p.Written, Total: p.Total, Percent: p.Percent})
+	})
+	msg := flashMessage{
+		Done:         true,
+		Success:      result.Success,
+		BytesWritten: result.BytesWritten,
+		SHA256:       result.SHA256,
+		Destination:  result.Destination,
+	}
+	if result.Error != nil {
+		msg.Error = result.Error.Error()
+		msg.Removed = errors.Is(result.Error, firmware.ErrDeviceRemoved)
+	}
+	return enc.Encode(msg)
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// scanLines calls fn with each line of r until fn returns false
+func scanLines(r io.Reader, fn func([]byte) bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if !fn(scanner.Bytes()) {
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// TestAgentHelper is the agent on the host: the fake ssh runs the test
+// binary with only this test, which serves the command after "--".
+func TestAgentHelper(t *testing.T) {
+	mount := os.Getenv("KBFLASH_AGENT_MOUNT")
+	if mount == "" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	if len(args) == 0 || args[0] != "agent" {
+		os.Exit(2)
+	}
+	err := Serve(context.Background(), args[1:], Tools{
+		Detector: func(device.Options) device.Detector { return dirDetector(mount) },
+		Flasher:  func(FlashOptions) firmware.FirmwareFlasher { return firmware.NewFlasher() },
+	}, os.Stdin, os.Stdout)
+	if err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// dirDetector reports the bootloader connected while its mount point exists.
+type dirDetector string
+
+func (d dirDetector) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan device.Event {
+	events := make(chan device.Event)
+	go func() {
+		defer close(events)
+		connected := false
+		for {
+			_, err := os.Stat(string(d))
+			if now := err == nil; now != connected {
+				connected = now
+				e := device.Event{Connected: now}
+				if now {
+					e.Path, e.Label = string(d), volumeName
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+	return events
+}
+
+func (d dirDetector) List(ctx context.Context) ([]device.DeviceInfo, error) {
+	return []device.DeviceInfo{{Path: string(d), Label: filepath.Base(string(d))}}, nil
+}
+
+// testHost returns a Host whose ssh runs the agent helper locally against
+// the bootloader mount point mount
+func testHost(t *testing.T, mount string) *Host {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	bin := t.TempDir()
+	ssh := `#!/bin/bash
+if [ -n "$FAKE_SSH_FAIL" ]; then
+	echo "ssh: connect to host pi port 22: Connection refused" >&2
+	exit 255
+fi
+exec bash -c "${@: -1}"
+`
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(ssh), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("KBFLASH_AGENT_MOUNT", mount)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	host, err := NewHost("pi@keyboard-pi:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.SetCommand(quote(os.Args[0]) + " -test.run='^TestAgentHelper$' --")
+	return host
+}
+
+func next(t *testing.T, events <-chan device.Event) device.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return device.Event{}
+}
+
+func TestHost_DetectAndFlash(t *testing.T) {
+	mount := filepath.Join(t.TempDir(), "media", "NICENANO")
+	if err := os.MkdirAll(mount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	info := "UF2 Bootloader 0.6.0\nModel: nice!nano\nBoard-ID: nRF52840-nicenano\n"
+	if err := os.WriteFile(filepath.Join(mount, firmware.InfoFileName), []byte(info), 0644); err != nil {
+		t.Fatal(err)
+	}
+	host := testHost(t, mount)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := host.Detect(ctx, "NICENANO", 10*time.Millisecond)
+	e := next(t, events)
+	if !e.Connected || e.Label != "NICENANO" {
+		t.Fatalf("first event = %+v, want NICENANO connected", e)
+	}
+
+	// The event's path holds the host's info file, for board checks
+	if e.Path == mount {
+		t.Errorf("event path is the host's mount point, want a local copy")
+	}
+	got, err := firmware.ReadBootloaderInfo(e.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BoardID != "nRF52840-nicenano" {
+		t.Errorf("board ID = %q, want the host's", got.BoardID)
+	}
+
+	src := filepath.Join(t.TempDir(), "corne_left.uf2")
+	data := []byte(strings.Repeat("firmware", 4096))
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var progress []firmware.FlashProgress
+	result := host.Flash(ctx, src, e.Path, func(p firmware.FlashProgress) { progress = append(progress, p) })
+	if !result.Success {
+		t.Fatalf("Flash failed: %v", result.Error)
+	}
+	flashed, err := os.ReadFile(filepath.Join(mount, "corne_left.uf2"))
+	if err != nil || string(flashed) != string(data) {
+		t.Fatalf("firmware on the host = %d bytes (%v), want %d", len(flashed), err, len(data))
+	}
+	if result.BytesWritten != int64(len(data)) || len(progress) == 0 || progress[len(progress)-1].Percent != 100 {
+		t.Errorf("result = %+v, progress = %+v", result, progress)
+	}
+	if want := "pi@keyboard-pi:" + filepath.Join(mount, "corne_left.uf2"); result.Destination != want {
+		t.Errorf("destination = %q, want %q", result.Destination, want)
+	}
+
+	// The bootloader reboots and unmounts
+	if err := os.RemoveAll(mount); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events); e.Connected {
+		t.Errorf("after unmount = %+v, want disconnected", e)
+	}
+}
+
+func TestHost_List(t *testing.T) {
+	mount := filepath.Join(t.TempDir(), "NICENANO")
+	host := testHost(t, mount)
+	volumes, err := host.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].Path != mount || volumes[0].Label != "NICENANO" {
+		t.Errorf("List = %+v, want the host's volume", volumes)
+	}
+}
+
+func TestHost_Unreachable(t *testing.T) {
+	host := testHost(t, t.TempDir())
+	t.Setenv("FAKE_SSH_FAIL", "1")
+
+	src := filepath.Join(t.TempDir(), "corne_left.uf2")
+	if err := os.WriteFile(src, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result := host.Flash(context.Background(), src, "/media/pi/NICENANO", nil)
+	if result.Success || result.Error == nil || !strings.Contains(result.Error.Error(), "Connection refused") {
+		t.Errorf("Flash = %+v, want ssh's error", result)
+	}
+	if errors.Is(result.Error, firmware.ErrDeviceRemoved) {
+		t.Errorf("an unreachable host was reported as a removed device")
+	}
+	if _, err := host.List(context.Background()); err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("List error = %v, want ssh's error", err)
+	}
+}
+
+func TestNewHost(t *testing.T) {
+	tests := []struct {
+		spec, target, port string
+		wantErr            bool
+	}{
+		{spec: "keyboard-pi", target: "keyboard-pi"},
+		{spec: "pi@keyboard-pi.local:2222", target: "pi@keyboard-pi.local", port: "2222"},
+		{spec: "ssh://pi@10.0.0.5", target: "pi@10.0.0.5"},
+		{spec: "-oProxyCommand=evil", wantErr: true},
+		{spec: "pi@host/path", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		h, err := NewHost(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewHost(%q) succeeded, want an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewHost(%q): %v", tt.spec, err)
+			continue
+		}
+		if h.target != tt.target || h.port != tt.port {
+			t.Errorf("NewHost(%q) = %q port %q, want %q port %q", tt.spec, h.target, h.port, tt.target, tt.port)
+		}
+	}
+}
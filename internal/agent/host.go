@@ -0,0 +1,356 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// retryDelay is how long Detect waits before reconnecting after the ssh
+// session ends, e.g. when the host reboots or the network drops.
+var retryDelay = 3 * time.Second
+
+// Host is a machine the bootloader is plugged into, reached over ssh. It
+// detects and flashes the bootloader there through `kbflash agent`,
+// implementing device.Detector and firmware.FirmwareFlasher.
+//
+// Event paths are local directories holding a copy of the bootloader's
+// INFO_UF2.TXT, so board checks work as for a local volume; Flash maps
+// them back to the mount point on the host.
+type Host struct {
+	target  string // [user@]host
+	port    string // empty for the ssh config's port
+	command string // kbflash on the host
+	mirror  string // local root of the info file copies
+	device  device.Options
+	flash   FlashOptions
+	verify  func(ctx context.Context, path string) error
+}
+
+// NewHost returns the host named by spec: [user@]host[:port] or
+// ssh://[user@]host[:port].
+func NewHost(spec string) (*Host, error) {
+	raw := spec
+	if !strings.HasPrefix(raw, "ssh://") {
+		raw = "ssh://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || strings.HasPrefix(u.Hostname(), "-") || strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid device host %q: want [user@]host[:port]", spec)
+	}
+	h := &Host{target: u.Hostname(), port: u.Port(), command: "kbflash"}
+	if u.User != nil {
+		h.target = u.User.Username() + "@" + h.target
+	}
+
+	root, err := os.UserCacheDir()
+	if err != nil {
+		root = os.TempDir()
+	}
+	name := h.target
+	if h.port != "" {
+		name += "_" + h.port
+	}
+	h.mirror = filepath.Join(root, "kbflash", "hosts", name)
+	return h, nil
+}
+
+// String returns the ssh target.
+func (h *Host) String() string {
+	return h.target
+}
+
+// SetCommand sets how kbflash is run on the host, e.g. ~/go/bin/kbflash.
+// It is passed to the remote shell as is.
+func (h *Host) SetCommand(command string) {
+	if command != "" {
+		h.command = command
+	}
+}
+
+// SetDeviceOptions sets where volumes appear on the host and whether the
+// agent mounts the bootloader.
+func (h *Host) SetDeviceOptions(opts device.Options) {
+	h.device = opts
+}
+
+// SetFlashOptions sets how the agent writes firmware.
+func (h *Host) SetFlashOptions(opts FlashOptions) {
+	h.flash = opts
+}
+
+// SetVerify sets a check run on each file before it is sent, such as a
+// signature check.
+func (h *Host) SetVerify(verify func(ctx context.Context, path string) error) {
+	h.verify = verify
+}
+
+// Detect watches for the named volume on the host. The ssh session is
+// started again after it ends, reporting the device as disconnected in
+// between; the channel is closed when ctx is done.
+func (h *Host) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan device.Event {
+	events := make(chan device.Event)
+	args := append([]string{"--name", volumeName, "--poll", pollInterval.String()}, h.deviceArgs()...)
+
+	go func() {
+		defer close(events)
+		for {
+			connected := false
+			h.detect(ctx, args, func(e device.Event) bool {
+				select {
+				case events <- e:
+					connected = e.Connected
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+			if connected {
+				select {
+				case events <- device.Event{Connected: false}:
+				case <-ctx.Done():
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+		}
+	}()
+	return events
+}
+
+// detect runs one `kbflash agent detect` session, passing its events to
+// send until it ends or send returns false
+func (h *Host) detect(ctx context.Context, args []string, send func(device.Event) bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ssh", h.sshArgs("detect", args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
+	}
+	defer cmd.Wait()
+
+	scanLines(stdout, func(line []byte) bool {
+		var msg event
+		if json.Unmarshal(line, &msg) != nil {
+			return true
+		}
+		e := device.Event{
+			Connected: msg.Connected,
+			Label:     msg.Label,
+			FSType:    msg.FSType,
+			Capacity:  msg.Capacity,
+			Serial:    msg.Serial,
+		}
+		if msg.Connected && msg.Path != "" {
+			e.Path = h.mirrorInfo(msg.Path, msg.Info)
+		}
+		if msg.Unreadable != "" {
+			e.Err = unreadableError(h.target + ":" + msg.Unreadable)
+		}
+		return send(e)
+	})
+	cancel()
+}
+
+// mirrorInfo keeps a local copy of the bootloader info file of the volume
+// mounted at path on the host, returning the local directory holding it
+func (h *Host) mirrorInfo(path, info string) string {
+	dir := h.localPath(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return dir
+	}
+	file := filepath.Join(dir, firmware.InfoFileName)
+	if info == "" {
+		os.Remove(file)
+	} else {
+		os.WriteFile(file, []byte(info), 0644)
+	}
+	return dir
+}
+
+// localPath returns the local directory standing in for path on the host
+func (h *Host) localPath(path string) string {
+	return filepath.Join(h.mirror, filepath.FromSlash(path))
+}
+
+// remotePath maps a directory from localPath back to the host's path.
+// Other paths are taken to be paths on the host already.
+func (h *Host) remotePath(path string) string {
+	rel, err := filepath.Rel(h.mirror, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return path
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// List returns the removable volumes mounted on the host, with the host's
+// paths.
+func (h *Host) List(ctx context.Context) ([]device.DeviceInfo, error) {
+	cmd := exec.CommandContext(ctx, "ssh", h.sshArgs("list", h.deviceArgs()...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, h.commandError(err, stderr.Bytes())
+	}
+	var volumes []device.DeviceInfo
+	if err := json.Unmarshal(stdout.Bytes(), &volumes); err != nil {
+		return nil, fmt.Errorf("%s: unexpected agent output: %w", h.target, err)
+	}
+	return volumes, nil
+}
+
+// Flash sends the file at srcPath to the host and writes it to the
+// bootloader there. The file is checked against its build's SHA256SUMS and
+// the verify check first, as the local flasher does.
+func (h *Host) Flash(ctx context.Context, srcPath, devicePath string, progressFn func(firmware.FlashProgress)) firmware.FlashResult {
+	if progressFn == nil {
+		progressFn = func(firmware.FlashProgress) {}
+	}
+	if err := firmware.VerifyManifest(srcPath); err != nil {
+		return firmware.FlashResult{Success: false, Error: fmt.Errorf("verify source: %w", err)}
+	}
+	if h.verify != nil {
+		if err := h.verify(ctx, srcPath); err != nil {
+			return firmware.FlashResult{Success: false, Error: fmt.Errorf("verify source: %w", err)}
+		}
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return firmware.FlashResult{Success: false, Error: fmt.Errorf("open source: %w", err)}
+	}
+	defer src.Close()
+
+	args := []string{"--dir", h.remotePath(devicePath), "--name", filepath.Base(srcPath)}
+	if h.flash.DeviceName != "" {
+		args = append(args, "--device-name", h.flash.DeviceName)
+	}
+	if h.flash.Profile != "" {
+		args = append(args, "--profile", h.flash.Profile)
+	}
+	if h.flash.WriteStrategy != "" {
+		args = append(args, "--strategy", h.flash.WriteStrategy)
+	}
+	if h.flash.SyncEvery > 0 {
+		args = append(args, "--sync-every", strconv.FormatInt(h.flash.SyncEvery, 10))
+	}
+	cmd := exec.CommandContext(ctx, "ssh", h.sshArgs("flash", args...)...)
+	cmd.Stdin = src
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return firmware.FlashResult{Success: false, Error: err}
+	}
+	if err := cmd.Start(); err != nil {
+		return firmware.FlashResult{Success: false, Error: fmt.Errorf("ssh %s: %w", h.target, err)}
+	}
+
+	var result *flashMessage
+	scanLines(stdout, func(line []byte) bool {
+		var msg flashMessage
+		if json.Unmarshal(line, &msg) != nil {
+			return true
+		}
+		if msg.Done {
+			result = &msg
+			return false
+		}
+		progressFn(firmware.FlashProgress{Written: msg.Written, Total: msg.Total, Percent: msg.Percent})
+		return true
+	})
+	io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+
+	switch {
+	case result == nil && ctx.Err() != nil:
+		return firmware.FlashResult{Success: false, Error: ctx.Err()}
+	case result == nil:
+		if err == nil {
+			err = errors.New("agent exited without a result")
+		}
+		return firmware.FlashResult{Success: false, Error: h.commandError(err, stderr.Bytes())}
+	case !result.Success:
+		err := errors.New(result.Error)
+		if result.Removed {
+			err = fmt.Errorf("%s: %w", h.target, firmware.ErrDeviceRemoved)
+		}
+		return firmware.FlashResult{Success: false, Error: err}
+	}
+	return firmware.FlashResult{
+		Success:      true,
+		BytesWritten: result.BytesWritten,
+		SHA256:       result.SHA256,
+		Destination:  h.target + ":" + result.Destination,
+	}
+}
+
+// deviceArgs passes the host's mount paths and automount setting to the agent
+func (h *Host) deviceArgs() []string {
+	var args []string
+	for _, path := range h.device.MountPaths {
+		args = append(args, "--mount-path", path)
+	}
+	if h.device.AutoMount {
+		args = append(args, "--auto-mount")
+	}
+	return args
+}
+
+// sshArgs returns the ssh arguments running `kbflash agent <command> args`
+// on the host. BatchMode fails rather than prompt for a password the TUI
+// cannot show; use keys or an agent.
+func (h *Host) sshArgs(command string, args ...string) []string {
+	ssh := []string{"-T", "-o", "BatchMode=yes"}
+	if h.port != "" {
+		ssh = append(ssh, "-p", h.port)
+	}
+	remote := h.command + " agent " + command
+	for _, arg := range args {
+		remote += " " + quote(arg)
+	}
+	return append(ssh, h.target, remote)
+}
+
+// commandError describes a failed ssh command with the last line of its
+// stderr, which usually says why
+func (h *Host) commandError(err error, stderr []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(stderr)), "\n")
+	if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" {
+		return fmt.Errorf("ssh %s: %w: %s", h.target, err, msg)
+	}
+	return fmt.Errorf("ssh %s: %w", h.target, err)
+}
+
+// unreadableError is the host's report of a volume it cannot use, which
+// is device.ErrUnreadable here
+type unreadableError string
+
+func (e unreadableError) Error() string { return string(e) }
+
+func (e unreadableError) Unwrap() error { return device.ErrUnreadable }
+
+// quote quotes an argument for the remote shell
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// timestampFormat names backup directories so they sort chronologically.
+const timestampFormat = "20060102-150405"
+
+// Archive copies keymap sources matching patterns (relative to sourceDir)
+// into a new timestamped directory under destDir, preserving relative paths.
+// Returns the backup directory path.
+func Archive(ctx context.Context, sourceDir string, patterns []string, destDir string, now time.Time) (string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(sourceDir, pattern))
+		if err != nil {
+			return "", fmt.Errorf("invalid backup pattern %q: %w", pattern, err)
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || info.IsDir() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+
+	if len(files) == 0 {
+		return "", fmt.Errorf("no keymap sources found in %s", sourceDir)
+	}
+
+	backupDir := filepath.Join(destDir, now.Format(timestampFormat))
+	for _, src := range files {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(sourceDir, src)
+		if err != nil {
+			return "", err
+		}
+		dst := filepath.Join(backupDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", fmt.Errorf("cannot create backup directory: %w", err)
+		}
+		if err := copyFile(src, dst); err != nil {
+			return "", fmt.Errorf("backup %s: %w", rel, err)
+		}
+	}
+
+	return backupDir, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
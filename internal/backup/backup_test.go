@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+
+	configDir := filepath.Join(srcDir, "config")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"corne.keymap": "keymap",
+		"corne.conf":   "conf",
+		"README.md":    "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(configDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	dir, err := Archive(context.Background(), srcDir, []string{"config/*.keymap", "config/*.conf"}, destDir, now)
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+
+	if dir != filepath.Join(destDir, "20250115-103000") {
+		t.Errorf("backup dir = %q, want timestamped dir", dir)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config", "corne.keymap"))
+	if err != nil {
+		t.Fatalf("keymap not backed up: %v", err)
+	}
+	if string(data) != "keymap" {
+		t.Errorf("keymap content = %q, want %q", data, "keymap")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "config", "corne.conf")); err != nil {
+		t.Errorf("conf not backed up: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config", "README.md")); !os.IsNotExist(err) {
+		t.Error("unmatched file should not be backed up")
+	}
+}
+
+func TestArchive_NoSources(t *testing.T) {
+	_, err := Archive(context.Background(), t.TempDir(), []string{"config/*.keymap"}, t.TempDir(), time.Now())
+	if err == nil {
+		t.Fatal("expected error when no sources match")
+	}
+}
+
+func TestArchive_ContextCancellation(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "corne.keymap"), []byte("keymap"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Archive(ctx, srcDir, []string{"*.keymap"}, t.TempDir(), time.Now())
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
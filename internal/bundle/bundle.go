@@ -0,0 +1,260 @@
+// Package bundle packs a build into a single .tar.gz file and unpacks it
+// into another firmware directory, so a build can be handed to someone or
+// carried to another machine without a remote cache. The bundle keeps the
+// build's SHA256SUMS, signatures, notes and keymap preview beside the
+// firmware, and the tags kbflash keeps for it outside the build.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// InfoName is the bundle's description, at the top of the archive beside
+// the build's directory.
+const InfoName = "kbflash-bundle.json"
+
+// Version is the bundle format written by Export.
+const Version = 1
+
+// maxFileSize bounds each file read from a bundle; firmware and its
+// metadata are far smaller.
+const maxFileSize = 64 << 20
+
+// partialPrefix marks a build still being unpacked. Names starting with a
+// dot are never scanned as builds.
+const partialPrefix = ".partial-"
+
+// ErrExists is returned by Import when the firmware directory already has a
+// build of the bundle's name.
+var ErrExists = errors.New("build already exists")
+
+// Info describes a bundle.
+type Info struct {
+	Version  int       `json:"version"`
+	Name     string    `json:"name"` // build directory name
+	Keyboard string    `json:"keyboard,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Created  time.Time `json:"created"`
+	Files    []string  `json:"files"` // files of the build directory, sorted
+}
+
+// Export writes build to dest as a gzipped tarball, first recording every
+// firmware file in its SHA256SUMS so Import can verify them. The build
+// directory's files are packed, not its subdirectories.
+func Export(build firmware.Build, info Info, dest string) (Info, error) {
+	for _, f := range build.Files {
+		if err := firmware.UpdateManifest(f.Path); err != nil {
+			return Info{}, err
+		}
+	}
+	entries, err := os.ReadDir(build.Path)
+	if err != nil {
+		return Info{}, err
+	}
+	info.Version = Version
+	if info.Created.IsZero() {
+		info.Created = time.Now()
+	}
+	info.Name = filepath.Base(build.Path)
+	info.Files = nil
+	if !firmware.ValidName(info.Name) {
+		return Info{}, fmt.Errorf("cannot export %s: not a build directory", build.Path)
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			info.Files = append(info.Files, e.Name())
+		}
+	}
+	sort.Strings(info.Files)
+
+	tmp := dest + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return Info{}, err
+	}
+	err = write(f, build.Path, info)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return Info{}, err
+	}
+	return info, os.Rename(tmp, dest)
+}
+
+// write packs info and the files of dir it lists into w
+func write(w io.Writer, dir string, info Info) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: InfoName, Mode: 0644, Size: int64(len(data)), ModTime: info.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, name := range info.Files {
+		if err := addFile(tw, filepath.Join(dir, name), path.Join(info.Name, name)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addFile writes the file at src to tw as name
+func addFile(tw *tar.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: st.Size(), ModTime: st.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import unpacks the bundle at src into a build directory of its name under
+// dir and returns its description. Every file listed in the build's
+// SHA256SUMS is verified, and passed to verify unless it is nil, before the
+// build is renamed into place, so scans never see a damaged, untrusted or
+// half-unpacked build. Returns ErrExists if dir already has a build of that
+// name.
+func Import(src, dir string, verify func(path string) error) (Info, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Info{}, fmt.Errorf("%s is not a kbflash bundle: %w", src, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	// The description comes first, naming the build directory
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != InfoName {
+		return Info{}, fmt.Errorf("%s is not a kbflash bundle", src)
+	}
+	var info Info
+	if err := json.NewDecoder(io.LimitReader(tr, maxFileSize)).Decode(&info); err != nil {
+		return Info{}, fmt.Errorf("cannot parse %s: %w", InfoName, err)
+	}
+	if info.Version > Version {
+		return Info{}, fmt.Errorf("bundle format %d is newer than this kbflash supports (%d)", info.Version, Version)
+	}
+	if !firmware.ValidName(info.Name) {
+		return Info{}, fmt.Errorf("bundle names an invalid build directory %q", info.Name)
+	}
+
+	dest := filepath.Join(dir, info.Name)
+	if _, err := os.Stat(dest); err == nil {
+		return info, fmt.Errorf("%s: %w", dest, ErrExists)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return info, err
+	}
+	partial := filepath.Join(dir, partialPrefix+info.Name)
+	if err := os.RemoveAll(partial); err != nil {
+		return info, err
+	}
+	if err := os.Mkdir(partial, 0755); err != nil {
+		return info, err
+	}
+	if err := unpack(tr, info, partial, verify); err != nil {
+		os.RemoveAll(partial)
+		return info, err
+	}
+	return info, os.Rename(partial, dest)
+}
+
+// unpack writes the files of the build in tr to dir and verifies them
+// against its SHA256SUMS and with verify
+func unpack(tr *tar.Reader, info Info, dir string, verify func(path string) error) error {
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		build, name, ok := strings.Cut(hdr.Name, "/")
+		if !ok || build != info.Name || !firmware.ValidName(name) || hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("bundle has an unexpected entry %q", hdr.Name)
+		}
+		if hdr.Size > maxFileSize {
+			return fmt.Errorf("%s is too large for a build file", name)
+		}
+		if err := extract(tr, filepath.Join(dir, name), hdr.ModTime); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	for _, name := range info.Files {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("bundle is missing %s", name)
+		}
+	}
+	for _, name := range names {
+		if err := firmware.VerifyManifest(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		if verify != nil {
+			if err := verify(filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// extract writes the current entry of tr to dest, keeping its modification
+// time
+func extract(tr *tar.Reader, dest string, modTime time.Time) error {
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, tr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest, modTime, modTime)
+}
@@ -0,0 +1,162 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// writeBuild writes a build directory with firmware, notes and a keymap
+// preview, returning it as scanned
+func writeBuild(t *testing.T, dir string) firmware.Build {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"corne_left.uf2":  "left firmware",
+		"corne_right.uf2": "right firmware",
+		"NOTES.md":        "home row mods",
+		"keymap.svg":      "<svg/>",
+		"logs/build.log":  "not bundled",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return firmware.Build{Path: dir, Files: []firmware.File{
+		{Name: "corne_left.uf2", Path: filepath.Join(dir, "corne_left.uf2")},
+		{Name: "corne_right.uf2", Path: filepath.Join(dir, "corne_right.uf2")},
+	}}
+}
+
+func TestExportImport(t *testing.T) {
+	build := writeBuild(t, filepath.Join(t.TempDir(), "20250102"))
+	dest := filepath.Join(t.TempDir(), "corne.tar.gz")
+
+	info, err := Export(build, Info{Keyboard: "corne", Tags: []string{"stable"}}, dest)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	want := []string{"NOTES.md", firmware.ManifestName, "corne_left.uf2", "corne_right.uf2", "keymap.svg"}
+	if !slices.Equal(info.Files, want) {
+		t.Errorf("exported files = %v, want %v", info.Files, want)
+	}
+
+	dir := filepath.Join(t.TempDir(), "firmware")
+	got, err := Import(dest, dir, nil)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if got.Name != "20250102" || got.Keyboard != "corne" || !slices.Equal(got.Tags, []string{"stable"}) {
+		t.Errorf("imported info = %+v", got)
+	}
+	for _, name := range want {
+		if _, err := os.Stat(filepath.Join(dir, "20250102", name)); err != nil {
+			t.Errorf("imported build is missing %s", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20250102", "logs")); err == nil {
+		t.Error("subdirectories were bundled")
+	}
+	if err := firmware.VerifyManifest(filepath.Join(dir, "20250102", "corne_left.uf2")); err != nil {
+		t.Errorf("imported firmware does not match its manifest: %v", err)
+	}
+
+	if _, err := Import(dest, dir, nil); !errors.Is(err, ErrExists) {
+		t.Errorf("second Import = %v, want ErrExists", err)
+	}
+}
+
+func TestImport_Verify(t *testing.T) {
+	build := writeBuild(t, filepath.Join(t.TempDir(), "20250102"))
+	dest := filepath.Join(t.TempDir(), "corne.tar.gz")
+	if _, err := Export(build, Info{}, dest); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	var checked []string
+	_, err := Import(dest, dir, func(path string) error {
+		checked = append(checked, filepath.Base(path))
+		if filepath.Base(path) == "corne_right.uf2" {
+			return firmware.ErrUnsigned
+		}
+		return nil
+	})
+	if !errors.Is(err, firmware.ErrUnsigned) || !strings.Contains(err.Error(), "corne_right.uf2") {
+		t.Fatalf("Import = %v, want the verify error for corne_right.uf2", err)
+	}
+	if !slices.Contains(checked, "corne_left.uf2") {
+		t.Errorf("verify saw %v, want every file", checked)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("an untrusted bundle left %d entries behind", len(entries))
+	}
+}
+
+// writeTar writes a bundle with the given entries, in order
+func writeTar(t *testing.T, entries [][2]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0644, Size: int64(len(e[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImport_Rejects(t *testing.T) {
+	info := `{"version": 1, "name": "20250102", "files": ["corne_left.uf2"]}`
+	sums := "0000000000000000000000000000000000000000000000000000000000000000  corne_left.uf2\n"
+	tests := []struct {
+		name    string
+		entries [][2]string
+		want    string
+	}{
+		{"not a bundle", [][2]string{{"corne_left.uf2", "firmware"}}, "not a kbflash bundle"},
+		{"escaping path", [][2]string{{InfoName, info}, {"20250102/../../evil", "x"}}, "unexpected entry"},
+		{"other build", [][2]string{{InfoName, info}, {"other/corne_left.uf2", "x"}}, "unexpected entry"},
+		{"missing file", [][2]string{{InfoName, info}}, "missing corne_left.uf2"},
+		{"damaged firmware", [][2]string{{InfoName, info}, {"20250102/SHA256SUMS", sums}, {"20250102/corne_left.uf2", "firmware"}}, "checksum mismatch"},
+		{"newer format", [][2]string{{InfoName, `{"version": 99, "name": "x"}`}}, "newer"},
+		{"invalid name", [][2]string{{InfoName, `{"version": 1, "name": ".."}`}}, "invalid build directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := Import(writeTar(t, tt.entries), dir, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Import = %v, want an error containing %q", err, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("a rejected bundle left %d entries behind", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Package components creates the firmware builder, scanner, signer, device
+// detector and flasher a configuration describes, so the TUI, the headless
+// commands, the web dashboard and the Go library wire them up identically.
+package components
+
+import (
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/agent"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// NewBuilder creates the configured native or Docker firmware builder.
+func NewBuilder(cfg *config.Config) firmware.FirmwareBuilder {
+	if cfg.Build.Mode != "docker" {
+		builder := firmware.NewBuilder(cfg.Build.Command, cfg.Build.Args, cfg.Build.WorkingDir)
+		builder.SetSides(cfg.Keyboard.Sides)
+		return builder
+	}
+	builder := firmware.NewDockerBuilder(
+		cfg.Build.Docker.Image,
+		cfg.Build.Board,
+		cfg.Build.Shield,
+		cfg.Build.WorkingDir,
+		cfg.Build.FirmwareDir,
+	)
+	targets := make(map[string]firmware.Target, len(cfg.Build.Targets))
+	for side, t := range cfg.Build.Targets {
+		targets[side] = firmware.Target{Board: t.Board, Shield: t.Shield}
+	}
+	builder.SetSideTargets(targets)
+	builder.SetSides(cfg.Keyboard.Sides)
+	builder.SetRunOptions(firmware.DockerRunOptions{
+		CPUs:    cfg.Build.Docker.CPUs,
+		Memory:  cfg.Build.Docker.Memory,
+		Env:     cfg.Build.Docker.Env,
+		Volumes: cfg.Build.Docker.Volumes,
+		User:    firmware.ResolveDockerUser(cfg.Build.Docker.User),
+	})
+	builder.SetContainer(cfg.Build.Docker.Container)
+	builder.SetPullTimeout(time.Duration(cfg.Build.Docker.PullTimeout))
+	builder.SetStudio(cfg.Build.Studio)
+	builder.SetSigner(NewSigner(cfg))
+	return builder
+}
+
+// NewScanner creates a scanner over every configured firmware source.
+func NewScanner(cfg *config.Config) *firmware.Scanner {
+	var sources []firmware.Source
+	for _, src := range cfg.Build.AllSources() {
+		sources = append(sources, firmware.Source{Label: src.Label, Dir: src.Dir})
+	}
+	formats := make([]firmware.DirFormat, len(cfg.Build.DirFormats))
+	for i, name := range cfg.Build.DirFormats {
+		formats[i] = firmware.DirFormat(name)
+	}
+	scanner := firmware.NewMultiScanner(sources, cfg.Build.FilePattern)
+	scanner.SetDirFormats(formats)
+	return scanner
+}
+
+// NewSigner creates a signer for the configured key and trusted keys.
+func NewSigner(cfg *config.Config) *firmware.Signer {
+	return firmware.NewSigner(cfg.Signing.Method, cfg.Signing.Key, cfg.Signing.TrustedKeys)
+}
+
+// NewDetector creates a device detector from the device config, detecting
+// on device.host when one is set.
+func NewDetector(cfg *config.Config) device.Detector {
+	if host := NewHost(cfg); host != nil {
+		return host
+	}
+	return device.NewWithOptions(device.Options{
+		MountPaths:    cfg.Device.MountPaths,
+		WSLPowerShell: cfg.Device.WSLPowerShell,
+		AutoMount:     cfg.Device.AutoMountEnabled(),
+	})
+}
+
+// NewHost returns the machine the bootloader is plugged into, reached over
+// ssh, or nil when it is plugged in here.
+func NewHost(cfg *config.Config) *agent.Host {
+	if cfg.Device.Host == "" {
+		return nil
+	}
+	// device.host is validated by config, so parsing cannot fail
+	host, _ := agent.NewHost(cfg.Device.Host)
+	host.SetCommand(cfg.Device.HostCommand)
+	host.SetDeviceOptions(device.Options{
+		MountPaths: cfg.Device.MountPaths,
+		AutoMount:  cfg.Device.AutoMountEnabled(),
+	})
+	host.SetFlashOptions(agent.FlashOptions{
+		DeviceName:    cfg.Device.Name,
+		Profile:       cfg.Device.Profile,
+		WriteStrategy: cfg.Flash.WriteStrategy,
+		SyncEvery:     cfg.Flash.SyncEvery,
+	})
+	host.SetVerify(NewSigner(cfg).Check(cfg.Build.SourceDirs()))
+	return host
+}
+
+// NewFlasher creates a copy-mode flasher using the configured write
+// strategy and bootloader profile, refusing unsigned firmware from other
+// sources, or flashes on device.host when one is set.
+func NewFlasher(cfg *config.Config) firmware.FirmwareFlasher {
+	if host := NewHost(cfg); host != nil {
+		return host
+	}
+	// device.profile is validated by config, so the lookup cannot miss
+	profile, _ := firmware.LookupFlashProfile(cfg.Device.Profile, cfg.Device.Name)
+	opts := firmware.FlasherOptions{Profile: profile}
+	opts.Verify = NewSigner(cfg).Check(cfg.Build.SourceDirs())
+	switch cfg.Flash.WriteStrategy {
+	case "chunked":
+		opts.SyncEvery = cfg.Flash.SyncEvery
+	case "direct":
+		// chunked syncs cover platforms where O_DIRECT is unavailable
+		opts.SyncEvery = cfg.Flash.SyncEvery
+		opts.Direct = true
+	}
+	return firmware.NewFlasherWithOptions(opts)
+}
+
+// NewDFUFlasher creates a dfu-util flasher for the configured address and
+// alt setting, refusing unsigned firmware from other sources.
+func NewDFUFlasher(cfg *config.Config) *firmware.DFUFlasher {
+	dfu := firmware.NewDFUFlasher(cfg.Flash.Address, cfg.Flash.DFUAlt)
+	dfu.SetVerify(NewSigner(cfg).Check(cfg.Build.SourceDirs()))
+	return dfu
+}
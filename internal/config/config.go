@@ -3,10 +3,18 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
 	"github.com/pelletier/go-toml/v2"
 )
 
@@ -23,39 +31,350 @@ func (d *Duration) UnmarshalText(text []byte) error {
 }
 
 // Config represents the complete kbflash configuration.
+//
+// Every key carries a doc tag, and keys taking a fixed set of values an enum
+// tag, which Schema turns into the JSON Schema editors complete the file from.
 type Config struct {
-	Keyboard KeyboardConfig `toml:"keyboard"`
-	Build    BuildConfig    `toml:"build"`
-	Device   DeviceConfig   `toml:"device"`
+	Keyboard KeyboardConfig `toml:"keyboard" doc:"Keyboard identification and layout"`
+	Build    BuildConfig    `toml:"build" doc:"Firmware build settings"`
+	Device   DeviceConfig   `toml:"device" doc:"How the bootloader is detected"`
+	Flash    FlashConfig    `toml:"flash" doc:"How firmware is written to the keyboard"`
+	Backup   BackupConfig   `toml:"backup" doc:"Keymap backups taken before flashing"`
+	Report   ReportConfig   `toml:"report" doc:"Report written at the end of each flash session"`
+	Status   StatusConfig   `toml:"status" doc:"Status file for tmux status lines and status bars"`
+	Signing  SigningConfig  `toml:"signing" doc:"Signing builds and verifying builds from other machines"`
+	UI       UIConfig       `toml:"ui" doc:"TUI layout"`
+
+	// Keyboard profiles by name, each the base config with its
+	// [profiles.<name>] overrides applied. Empty for single-keyboard configs.
+	Profiles map[string]*Config `toml:"-"`
+
+	// Renamed keys and environment variables the config was loaded with
+	Warnings []string `toml:"-"`
 }
 
+// KeyboardPlaceholder is replaced with the profile name in build.firmware_dir.
+const KeyboardPlaceholder = "{{keyboard}}"
+
 // KeyboardConfig defines keyboard identification and layout.
 type KeyboardConfig struct {
-	Name  string   `toml:"name"`
-	Type  string   `toml:"type"`
-	Sides []string `toml:"sides"`
+	Name  string   `toml:"name" doc:"Keyboard name (required)"`
+	Type  string   `toml:"type" enum:"split,uni" doc:"Split or single-piece keyboard"`
+	Sides []string `toml:"sides" doc:"Side names, flashed in this order"`
+
+	// Per-side filename patterns: globs, or regexes prefixed with "re:".
+	// Sides without patterns match files containing the side name.
+	SidePatterns map[string][]string `toml:"side_patterns" doc:"Filename globs per side, or regexes prefixed with re:"`
 }
 
 // BuildConfig defines firmware build settings.
 type BuildConfig struct {
-	Enabled     bool     `toml:"enabled"`
-	Mode        string   `toml:"mode"`         // "native" or "docker"
-	Command     string   `toml:"command"`      // for native mode
-	Args        []string `toml:"args"`         // for native mode
-	WorkingDir  string   `toml:"working_dir"`
-	FirmwareDir string   `toml:"firmware_dir"`
-	FilePattern string   `toml:"file_pattern"`
+	Enabled     bool     `toml:"enabled" doc:"Build firmware from kbflash (false for flash-only use)"`
+	Mode        string   `toml:"mode" enum:"native,docker" doc:"Build with a local command or in Docker"`
+	Command     string   `toml:"command" doc:"Build command for native mode"`
+	Args        []string `toml:"args" doc:"Build command arguments for native mode"`
+	WorkingDir  string   `toml:"working_dir" doc:"zmk-config checkout builds run in"`
+	FirmwareDir string   `toml:"firmware_dir" doc:"Where builds are written and scanned for"`
+	FilePattern string   `toml:"file_pattern" doc:"Glob matching firmware files in a build"`
+	Pull        string   `toml:"pull" enum:"never,always,ask" doc:"git pull --ff-only before building"`
+
+	// Build directory naming schemes to recognise (default: DefaultDirFormats)
+	DirFormats []string `toml:"dir_formats" enum:"date,iso-date,semver,hash" doc:"Build directory naming schemes to recognise"`
+
+	// Dated builds older than this are offered for cleanup
+	RetentionDays int `toml:"retention_days" doc:"Days after which dated builds are offered for cleanup"`
+
+	// Builds older than this are flagged as stale in the firmware list
+	StaleDays int `toml:"stale_days" doc:"Days after which builds are flagged as stale"`
+
+	// Extra firmware directories merged into the firmware list
+	Sources []FirmwareSource `toml:"sources" doc:"Extra firmware directories merged into the firmware list"`
 
 	// Docker mode settings
-	Image  string `toml:"image"`  // Docker image (default: zmkfirmware/zmk-dev-arm:stable)
-	Board  string `toml:"board"`  // ZMK board (e.g., nice_nano_v2)
-	Shield string `toml:"shield"` // ZMK shield (e.g., corne) - _left/_right added automatically
+	Board  string `toml:"board" doc:"ZMK board, e.g. nice_nano_v2"`
+	Shield string `toml:"shield" doc:"ZMK shield, e.g. corne; _left/_right are added per side"`
+
+	// Build ZMK Studio-enabled firmware (named <shield>_<side>_studio.uf2)
+	// and prefer it when flashing
+	Studio bool `toml:"studio" doc:"Build ZMK Studio-enabled firmware and prefer it when flashing"`
+
+	// Per-side board/shield overrides, e.g. a dongle or a half with another MCU
+	Targets map[string]SideTarget `toml:"targets" doc:"Per-side board and shield overrides"`
+
+	// Docker image and extra docker run settings
+	Docker DockerConfig `toml:"docker" doc:"Docker image and extra docker run settings for builds"`
+
+	// Keymap preview rendered after each build
+	KeymapDrawer KeymapDrawerConfig `toml:"keymap_drawer" doc:"Keymap preview rendered after each build"`
+
+	// Remote cache builds are shared between machines through
+	Remote RemoteConfig `toml:"remote" doc:"Remote cache builds are shared between machines through"`
+
+	// Builds started by the TUI when the keymap or its config is saved
+	Watch WatchConfig `toml:"watch" doc:"Rebuild in the TUI when the keymap or its config changes"`
+}
+
+// WatchConfig rebuilds the firmware when files in the working directory
+// change, once they have been quiet for Debounce.
+type WatchConfig struct {
+	Enabled  bool     `toml:"enabled" doc:"Rebuild when watched files change (also --watch)"`
+	Patterns []string `toml:"patterns" doc:"Globs relative to build.working_dir that trigger a rebuild"`
+	Debounce Duration `toml:"debounce" doc:"How long files must stay unchanged before the rebuild starts"`
+}
+
+// RemoteConfig defines a remote artifact cache: builds are uploaded after
+// they complete, and builds made on other machines are downloaded into Dir,
+// which is scanned as the "remote" source.
+type RemoteConfig struct {
+	URL    string `toml:"url" doc:"s3://bucket/prefix, ssh://host/path or a WebDAV https:// URL; empty turns the cache off"`
+	Upload bool   `toml:"upload" doc:"Upload each build after it completes"`
+	Dir    string `toml:"dir" doc:"Where downloaded builds are kept (default: firmware_dir-remote)"`
+}
+
+// RemoteSourceLabel labels builds downloaded from the remote cache.
+const RemoteSourceLabel = "remote"
+
+// KeymapDrawerConfig renders the keymap with keymap-drawer after builds.
+type KeymapDrawerConfig struct {
+	Enabled bool   `toml:"enabled" doc:"Render a keymap preview after each build"`
+	Mode    string `toml:"mode" enum:"native,docker" doc:"Run the keymap CLI from PATH or in Docker"`
+	Image   string `toml:"image" doc:"Docker image with keymap-drawer installed"`
+	Keymap  string `toml:"keymap" doc:"Keymap file relative to build.working_dir, also opened by e in the TUI (default: config/<shield>.keymap)"`
+	Config  string `toml:"config" doc:"keymap-drawer config file relative to build.working_dir"`
+}
+
+// DockerConfig holds the image builds run in and extra settings appended to
+// `docker run`.
+type DockerConfig struct {
+	Image   string   `toml:"image" doc:"Docker image for docker mode"`
+	CPUs    string   `toml:"cpus" doc:"docker run --cpus, e.g. 2 or 1.5"`
+	Memory  string   `toml:"memory" doc:"docker run --memory, e.g. 4g"`
+	Env     []string `toml:"env" doc:"KEY=value to set, or KEY to pass through from the host"`
+	Volumes []string `toml:"volumes" doc:"Extra mounts as host:container[:options]"`
+	User    string   `toml:"user" doc:"auto, none or an explicit uid:gid"`
+
+	// Name of a long-lived container to exec builds into (empty: docker run --rm)
+	Container string `toml:"container" doc:"Long-lived container to exec builds into (empty: docker run --rm)"`
+
+	// How long pulling a missing image may take before it is abandoned
+	PullTimeout Duration `toml:"pull_timeout" doc:"How long pulling a missing image may take before it is abandoned"`
+}
+
+// containerNameRegex matches names docker accepts for --name.
+var containerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// SideTarget overrides the ZMK board and/or shield for one side.
+// An overridden shield is used as-is, without the side suffix.
+type SideTarget struct {
+	Board  string `toml:"board" doc:"ZMK board for this side"`
+	Shield string `toml:"shield" doc:"Full ZMK shield for this side, used without a side suffix"`
+}
+
+// BoardFor returns the ZMK board to build for side.
+func (b BuildConfig) BoardFor(side string) string {
+	if t, ok := b.Targets[side]; ok && t.Board != "" {
+		return t.Board
+	}
+	return b.Board
+}
+
+// ShieldFor returns the ZMK shield configured for side: its override, used
+// as-is, or build.shield, which builds add the side suffix to.
+func (b BuildConfig) ShieldFor(side string) string {
+	if t, ok := b.Targets[side]; ok && t.Shield != "" {
+		return t.Shield
+	}
+	return b.Shield
+}
+
+// KeymapPath returns the keymap source: build.keymap_drawer.keymap under
+// working_dir, config/<shield>.keymap by default, or "" without either.
+func (b BuildConfig) KeymapPath() string {
+	keymap := b.KeymapDrawer.Keymap
+	if keymap == "" || filepath.IsAbs(keymap) {
+		return keymap
+	}
+	return filepath.Join(b.WorkingDir, keymap)
+}
+
+// KeymapTargets returns the sides built from the keymap at KeymapPath. ZMK
+// reads config/<name>.keymap for a shield named <name> or <name>_<side>, so
+// a side whose shield is overridden with another keyboard's is left out.
+func (b BuildConfig) KeymapTargets(sides []string) []string {
+	name := strings.TrimSuffix(filepath.Base(b.KeymapDrawer.Keymap), ".keymap")
+	var targets []string
+	for _, side := range sides {
+		shields := []string{b.Shield}
+		if t, ok := b.Targets[side]; ok && t.Shield != "" {
+			shields = strings.Fields(t.Shield)
+		}
+		for _, shield := range shields {
+			if shield == name || strings.HasPrefix(shield, name+"_") {
+				targets = append(targets, side)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+// Boards maps each side to the ZMK board it is built for.
+func (b BuildConfig) Boards(sides []string) map[string]string {
+	boards := make(map[string]string, len(sides))
+	for _, side := range sides {
+		boards[side] = b.BoardFor(side)
+	}
+	return boards
+}
+
+// FirmwareSource is an additional labelled directory to scan for firmware.
+type FirmwareSource struct {
+	Label string `toml:"label" doc:"Label shown next to builds from this directory"`
+	Dir   string `toml:"dir" doc:"Directory to scan for builds"`
+}
+
+// SourceDirs returns the directories of the extra sources.
+func (b BuildConfig) SourceDirs() []string {
+	dirs := make([]string, 0, len(b.Sources))
+	for _, src := range b.Sources {
+		dirs = append(dirs, src.Dir)
+	}
+	return dirs
+}
+
+// AllSources returns firmware_dir followed by the extra sources.
+// firmware_dir is labelled "local" when extra sources are configured.
+func (b BuildConfig) AllSources() []FirmwareSource {
+	if len(b.Sources) == 0 {
+		return []FirmwareSource{{Dir: b.FirmwareDir}}
+	}
+	return append([]FirmwareSource{{Label: "local", Dir: b.FirmwareDir}}, b.Sources...)
 }
 
 // DeviceConfig defines device detection settings.
 type DeviceConfig struct {
-	Name         string   `toml:"name"`
-	PollInterval Duration `toml:"poll_interval"`
+	Name             string   `toml:"name" doc:"Bootloader volume label, e.g. NICENANO"`
+	PollInterval     Duration `toml:"poll_interval" doc:"Detection interval while waiting for the device"`
+	IdlePollInterval Duration `toml:"idle_poll_interval" doc:"Detection interval while the TUI is idle"`
+	MountPaths       []string `toml:"mount_paths" doc:"Where volumes appear (default: platform automount dirs)"`
+	WSLPowerShell    bool     `toml:"wsl_powershell" doc:"Under WSL, find the drive letter by label via powershell.exe"`
+	USBID            string   `toml:"usb_id" doc:"Bootloader vendor:product for setup-udev, e.g. 239a:00b3"`
+	AutoMount        *bool    `toml:"auto_mount" doc:"Linux: mount the bootloader with udisksctl (default: true)"`
+	Profile          string   `toml:"profile" enum:"auto,generic,adafruit,nicenano,rp2040" doc:"Bootloader write quirks"`
+
+	// The bootloader is plugged into this machine, reached over ssh:
+	// detection and flashing run there through `kbflash agent`, with
+	// mount_paths and auto_mount applying to it
+	Host        string `toml:"host" doc:"Detect and flash on this machine over ssh: [user@]host[:port]"`
+	HostCommand string `toml:"host_command" doc:"How kbflash is run on the host (default: kbflash)"`
+}
+
+// AutoMountEnabled reports whether unmounted bootloaders should be mounted.
+func (d DeviceConfig) AutoMountEnabled() bool {
+	return d.AutoMount == nil || *d.AutoMount
+}
+
+// hostRegex matches an ssh destination, [ssh://][user@]host[:port]. A
+// leading dash would be taken as an ssh option.
+var hostRegex = regexp.MustCompile(`^(ssh://)?([A-Za-z0-9._-]+@)?[A-Za-z0-9_][A-Za-z0-9._-]*(:[0-9]+)?$`)
+
+// usbIDRegex matches a USB vendor:product ID as printed by lsusb.
+var usbIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{4}$`)
+
+// FlashConfig defines how firmware is written to the keyboard.
+type FlashConfig struct {
+	Mode        string `toml:"mode" enum:"copy,dfu,qmk" doc:"Copy to a mass-storage bootloader, write with dfu-util, or run qmk flash"`
+	QMKKeyboard string `toml:"qmk_keyboard" doc:"qmk mode: keyboard, e.g. crkbd/rev1"`
+	QMKKeymap   string `toml:"qmk_keymap" doc:"qmk mode: keymap"`
+
+	// Firmware files the bootloader takes: "uf2" or "bin" (default: bin in
+	// dfu mode, uf2 in copy mode)
+	FileType string `toml:"file_type" enum:"uf2,bin" doc:"Firmware files the bootloader takes (default: bin in dfu mode)"`
+
+	// dfu mode: the flash address images are written at and the DFU
+	// alternate setting to write through
+	Address string `toml:"address" doc:"dfu mode: flash address images are written at (default: 0x08000000)"`
+	DFUAlt  int    `toml:"dfu_alt" doc:"dfu mode: DFU alternate setting to write through"`
+
+	WriteStrategy string `toml:"write_strategy" enum:"end,chunked,direct" doc:"When copied firmware is synced to the bootloader"`
+	SyncEvery     int64  `toml:"sync_every" doc:"Bytes between fsyncs for chunked and direct writes"`
+
+	// Smaller files are refused before waiting for the bootloader
+	MinSize int64 `toml:"min_size" doc:"Smallest firmware file in bytes that is flashed"`
+
+	// Per-side files flashed in order, reconnecting the bootloader between
+	// them. FirmwarePlaceholder stands for the side's file from the build.
+	Files map[string][]string `toml:"files" doc:"Per-side files flashed in order; {{firmware}} is the side's build file"`
+}
+
+// Extension returns the extension of files the bootloader takes, such as
+// ".uf2", or "" when the mode flashes no files.
+func (f FlashConfig) Extension() string {
+	if f.FileType == "" {
+		return ""
+	}
+	return "." + f.FileType
+}
+
+// FirmwarePlaceholder is replaced with the side's firmware in flash.files.
+const FirmwarePlaceholder = "{{firmware}}"
+
+// FilesFor returns the files to flash to side, in order, given the side's
+// firmware from the selected build.
+func (f FlashConfig) FilesFor(side, firmware string) []string {
+	files, ok := f.Files[side]
+	if !ok {
+		return []string{firmware}
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		if file == FirmwarePlaceholder {
+			file = firmware
+		}
+		paths[i] = file
+	}
+	return paths
+}
+
+// BackupConfig defines keymap backups taken before flashing.
+type BackupConfig struct {
+	Enabled  bool     `toml:"enabled" doc:"Back up the keymap before flashing"`
+	Dir      string   `toml:"dir" doc:"Where timestamped backups are written"`
+	Patterns []string `toml:"patterns" doc:"Globs relative to build.working_dir"`
+}
+
+// ReportConfig defines the report written at the end of each flash session.
+type ReportConfig struct {
+	Enabled bool   `toml:"enabled" doc:"Write a report at the end of each flash session"`
+	Dir     string `toml:"dir" doc:"Where timestamped reports are written"`
+	Format  string `toml:"format" enum:"markdown,json" doc:"Report file format"`
+}
+
+// StatusConfig defines the status file kbflash keeps up to date while it
+// runs, for status bars to show its progress.
+type StatusConfig struct {
+	Enabled bool   `toml:"enabled" doc:"Write the current state to a status file while kbflash runs"`
+	Path    string `toml:"path" doc:"Status JSON file, with a .txt beside it (default: $XDG_STATE_HOME/kbflash/status.json)"`
+}
+
+// SigningConfig defines how builds are signed and which signatures are
+// trusted on firmware from build.sources.
+type SigningConfig struct {
+	Method string `toml:"method" enum:"minisign,ssh" doc:"Sign with minisign or ssh-keygen; empty turns signing off"`
+
+	// Secret key builds are signed with: a minisign key file, or for ssh a
+	// private key or the public key of one held by ssh-agent
+	Key string `toml:"key" doc:"Key file builds are signed with; empty only verifies"`
+
+	// Public keys whose signatures are accepted: minisign's base64 key
+	// ("RW...") or an ssh-ed25519 authorized_keys line
+	TrustedKeys []string `toml:"trusted_keys" doc:"Public keys whose signatures are accepted on builds from build.sources"`
+}
+
+// UIConfig defines how the TUI is laid out.
+type UIConfig struct {
+	// Show only the focused panel, with a tab bar, for small terminals
+	Compact bool `toml:"compact" doc:"Show only the focused panel, with a tab bar, for small terminals"`
 }
 
 // DefaultPath returns the default config file path following XDG conventions.
@@ -77,56 +396,365 @@ func DefaultPath() (string, error) {
 // LocalConfigName is the filename looked for in the current directory.
 const LocalConfigName = "config.kbflash.toml"
 
+// DirConfigName is the filename looked for in a --config-dir directory.
+const DirConfigName = "config.toml"
+
+// EnvConfig is the environment variable that overrides the config path.
+const EnvConfig = "KBFLASH_CONFIG"
+
+// PathInDir returns the config file path inside a config directory.
+func PathInDir(dir string) string {
+	return filepath.Join(dir, DirConfigName)
+}
+
 // Load reads and parses a config file from the given path.
-// If path is empty, it looks for config.kbflash.toml in the current directory first,
-// then falls back to the default XDG path (~/.config/kbflash/config.toml).
+// If path is empty, it uses $KBFLASH_CONFIG, then config.kbflash.toml in the
+// current directory, then the default XDG path (~/.config/kbflash/config.toml).
 func Load(path string) (*Config, error) {
-	if path == "" {
-		// Check for local config first
-		if _, err := os.Stat(LocalConfigName); err == nil {
-			path = LocalConfigName
-		} else {
-			// Fall back to XDG default
-			defaultPath, err := DefaultPath()
+	path, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, files, err := readConfig(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := toml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse config file: %w", err)
+	}
+	cfg.Warnings = renameWarnings(files)
+
+	var raw struct {
+		Profiles map[string]map[string]any `toml:"profiles"`
+	}
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("cannot parse config file: %w", err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment override: %w", err)
+	}
+	applyDefaults(cfg)
+
+	if len(raw.Profiles) > 0 {
+		// The top-level sections are shared defaults, not a keyboard
+		cfg.Profiles = make(map[string]*Config, len(raw.Profiles))
+		var errs []error
+		for name, overrides := range raw.Profiles {
+			profile, err := loadProfile(data, name, overrides)
 			if err != nil {
-				return nil, err
+				err = locate(err, files, "profiles."+name+".")
+				errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+				continue
 			}
-			path = defaultPath
+			profile.Warnings = cfg.Warnings
+			cfg.Profiles[name] = profile
 		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+		}
+		return cfg, nil
+	}
+
+	if err := validate(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", locate(err, files, ""))
+	}
+
+	return cfg, nil
+}
+
+// resolvePath returns the config file Load reads for path: path itself,
+// else $KBFLASH_CONFIG, config.kbflash.toml in the current directory or the
+// default XDG path.
+func resolvePath(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	if path != "" {
+		return path, nil
 	}
+	// Check for local config first
+	if _, err := os.Stat(LocalConfigName); err == nil {
+		return LocalConfigName, nil
+	}
+	// Fall back to XDG default
+	return DefaultPath()
+}
 
+// readConfig reads the config file at path. A top-level extends key names
+// a base config (relative to path, ~ for the home directory) whose tables
+// are merged underneath this file's, so a repo-local config only needs the
+// sections it changes. Renamed keys are moved to their current names and
+// each section's table for this OS is merged over it, before extends. seen
+// guards against extends cycles. The files read, this one first, are
+// returned to point validation errors at their lines.
+func readConfig(path string, seen []string) ([]byte, []*configFile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read config file: %w", err)
+		return nil, nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	f := newConfigFile(path, data)
+	if err := checkFile(f, data); err != nil {
+		return nil, nil, err
+	}
+	files := []*configFile{f}
+
+	var tables map[string]any
+	if err := toml.Unmarshal(data, &tables); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse config file: %w", err)
+	}
+	if f.renamed, err = migrateTables(f, tables); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	hasOSTables := applyOSTables(tables, runtime.GOOS)
+	extends, ok := tables["extends"]
+	if !ok {
+		if len(f.renamed) > 0 || hasOSTables {
+			data, err = toml.Marshal(tables)
+		}
+		return data, files, err
+	}
+	base, ok := extends.(string)
+	if !ok || base == "" {
+		return nil, nil, fmt.Errorf("invalid config: %s: extends must be a file path", path)
+	}
+
+	base, err = resolveExtends(path, base)
+	if err != nil {
+		return nil, nil, err
+	}
+	abs, _ := filepath.Abs(path)
+	seen = append(seen, abs)
+	if slices.Contains(seen, base) {
+		return nil, nil, fmt.Errorf("invalid config: %s: extends cycle through %s", path, base)
+	}
+
+	baseData, baseFiles, err := readConfig(base, seen)
+	if err != nil {
+		return nil, nil, fmt.Errorf("extends %s: %w", base, err)
+	}
+	var merged map[string]any
+	if err := toml.Unmarshal(baseData, &merged); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse config file: %w", err)
+	}
+	delete(tables, "extends")
+	mergeTables(merged, tables)
+	data, err = toml.Marshal(merged)
+	return data, append(files, baseFiles...), err
+}
+
+// resolveExtends returns the absolute path of a base config named in the
+// config file at path.
+func resolveExtends(path, base string) (string, error) {
+	if base == "~" || strings.HasPrefix(base, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
+		}
+		base = filepath.Join(home, base[1:])
 	}
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(filepath.Dir(path), base)
+	}
+	return filepath.Abs(base)
+}
 
+// mergeTables merges override into base: tables are merged key by key,
+// anything else (values, lists) replaces the base value.
+func mergeTables(base, override map[string]any) {
+	for key, value := range override {
+		if table, ok := value.(map[string]any); ok {
+			if baseTable, ok := base[key].(map[string]any); ok {
+				mergeTables(baseTable, table)
+				continue
+			}
+		}
+		base[key] = value
+	}
+}
+
+// loadProfile builds a profile's config: the base sections decoded from
+// data with the profile's overrides decoded on top. Profiles without their
+// own build.firmware_dir get a per-keyboard subdirectory of the base one.
+func loadProfile(data []byte, name string, overrides map[string]any) (*Config, error) {
 	cfg := &Config{}
 	if err := toml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("cannot parse config file: %w", err)
+		return nil, err
 	}
 
-	applyDefaults(cfg)
+	override, err := toml.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	if err := toml.Unmarshal(override, cfg); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
 
-	if err := validate(cfg); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+	if cfg.Keyboard.Name == "" {
+		cfg.Keyboard.Name = name
+	}
+
+	build, _ := overrides["build"].(map[string]any)
+	if _, ok := build["firmware_dir"]; !ok && !strings.Contains(cfg.Build.FirmwareDir, KeyboardPlaceholder) {
+		cfg.Build.FirmwareDir = filepath.Join(cfg.Build.FirmwareDir, KeyboardPlaceholder)
 	}
+	cfg.Build.FirmwareDir = strings.ReplaceAll(cfg.Build.FirmwareDir, KeyboardPlaceholder, name)
+	cfg.Build.Remote.URL = strings.ReplaceAll(cfg.Build.Remote.URL, KeyboardPlaceholder, name)
+	cfg.Build.Remote.Dir = strings.ReplaceAll(cfg.Build.Remote.Dir, KeyboardPlaceholder, name)
 
+	applyDefaults(cfg)
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// ProfileNames returns the configured keyboard profile names, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the config for the named keyboard profile.
+func (c *Config) Profile(name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyboard profile %q (have: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
 // applyDefaults sets default values for optional fields.
 func applyDefaults(cfg *Config) {
 	if cfg.Device.PollInterval == 0 {
 		cfg.Device.PollInterval = DefaultPollInterval
 	}
-	if cfg.Build.FilePattern == "" {
-		cfg.Build.FilePattern = DefaultFilePattern
+	if cfg.Device.IdlePollInterval == 0 {
+		cfg.Device.IdlePollInterval = DefaultIdlePollInterval
+	}
+	if cfg.Device.Profile == "" {
+		cfg.Device.Profile = DefaultDeviceProfile
+	}
+	if len(cfg.Build.DirFormats) == 0 {
+		cfg.Build.DirFormats = DefaultDirFormats
 	}
 	if cfg.Build.Mode == "" {
 		cfg.Build.Mode = "native" // default to native for backwards compatibility
 	}
-	if cfg.Build.Image == "" {
-		cfg.Build.Image = DefaultDockerImage
+	if cfg.Build.Docker.Image == "" {
+		cfg.Build.Docker.Image = DefaultDockerImage
+	}
+	if cfg.Build.Docker.User == "" {
+		cfg.Build.Docker.User = DefaultDockerUser
+	}
+	if cfg.Build.Docker.PullTimeout == 0 {
+		cfg.Build.Docker.PullTimeout = DefaultPullTimeout
+	}
+	if cfg.Build.KeymapDrawer.Mode == "" {
+		cfg.Build.KeymapDrawer.Mode = "native"
+	}
+	if cfg.Build.KeymapDrawer.Keymap == "" && cfg.Build.Shield != "" {
+		cfg.Build.KeymapDrawer.Keymap = "config/" + cfg.Build.Shield + ".keymap"
+	}
+	if cfg.Build.Pull == "" {
+		cfg.Build.Pull = "never"
+	}
+	if cfg.Build.RetentionDays == 0 {
+		cfg.Build.RetentionDays = DefaultRetentionDays
+	}
+	if cfg.Build.StaleDays == 0 {
+		cfg.Build.StaleDays = DefaultStaleDays
+	}
+	if cfg.Flash.Mode == "" {
+		cfg.Flash.Mode = "copy"
+	}
+	if cfg.Flash.QMKKeymap == "" {
+		cfg.Flash.QMKKeymap = DefaultQMKKeymap
+	}
+	if cfg.Flash.FileType == "" {
+		switch cfg.Flash.Mode {
+		case "copy":
+			cfg.Flash.FileType = "uf2"
+		case "dfu":
+			cfg.Flash.FileType = "bin"
+		}
+	}
+	if cfg.Flash.Address == "" && cfg.Flash.Mode == "dfu" {
+		cfg.Flash.Address = DefaultDFUAddress
+	}
+	if cfg.Build.FilePattern == "" {
+		cfg.Build.FilePattern = DefaultFilePattern
+		if cfg.Flash.FileType != "" {
+			cfg.Build.FilePattern = "*." + cfg.Flash.FileType
+		}
+	}
+	if cfg.Flash.WriteStrategy == "" {
+		cfg.Flash.WriteStrategy = "end"
+	}
+	if cfg.Flash.SyncEvery == 0 {
+		cfg.Flash.SyncEvery = DefaultSyncEvery
+	}
+	if cfg.Flash.MinSize == 0 {
+		cfg.Flash.MinSize = DefaultMinFirmwareSize
+	}
+	if cfg.Backup.Dir == "" {
+		cfg.Backup.Dir = DefaultBackupDir
+	}
+	if cfg.Build.Remote.URL != "" {
+		if cfg.Build.Remote.Dir == "" {
+			cfg.Build.Remote.Dir = DefaultRemoteDir
+			if dir := filepath.Clean(cfg.Build.FirmwareDir); dir != "." {
+				cfg.Build.Remote.Dir = dir + "-remote"
+			}
+		}
+		// Downloaded builds are listed like any other source
+		remote := FirmwareSource{Label: RemoteSourceLabel, Dir: cfg.Build.Remote.Dir}
+		if !slices.Contains(cfg.Build.Sources, remote) {
+			cfg.Build.Sources = append(cfg.Build.Sources, remote)
+		}
+	}
+	for i := range cfg.Build.Sources {
+		if cfg.Build.Sources[i].Label == "" {
+			cfg.Build.Sources[i].Label = filepath.Base(cfg.Build.Sources[i].Dir)
+		}
+	}
+	if len(cfg.Backup.Patterns) == 0 {
+		cfg.Backup.Patterns = DefaultBackupPatterns
+	}
+	if len(cfg.Build.Watch.Patterns) == 0 {
+		cfg.Build.Watch.Patterns = DefaultWatchPatterns
+	}
+	if cfg.Build.Watch.Debounce == 0 {
+		cfg.Build.Watch.Debounce = DefaultWatchDebounce
+	}
+	if cfg.Report.Dir == "" {
+		cfg.Report.Dir = DefaultReportDir
+	}
+	if cfg.Report.Format == "" {
+		cfg.Report.Format = "markdown"
+	}
+	// Key files usually live in the home directory, e.g. ~/.minisign
+	if rest, ok := strings.CutPrefix(cfg.Signing.Key, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			cfg.Signing.Key = filepath.Join(home, rest)
+		}
+	}
+	// One status file per keyboard when several run at once
+	cfg.Status.Path = strings.ReplaceAll(cfg.Status.Path, KeyboardPlaceholder, cfg.Keyboard.Name)
+	if rest, ok := strings.CutPrefix(cfg.Status.Path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			cfg.Status.Path = filepath.Join(home, rest)
+		}
 	}
 }
 
@@ -137,8 +765,216 @@ func validate(cfg *Config) error {
 	if cfg.Keyboard.Name == "" {
 		errs = append(errs, errors.New("keyboard.name is required"))
 	}
-	if cfg.Device.Name == "" {
-		errs = append(errs, errors.New("device.name is required"))
+
+	// Keyboards without sides flash a single "main" side
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	switch cfg.Keyboard.Type {
+	case "":
+	case "split":
+		if len(cfg.Keyboard.Sides) < 2 {
+			errs = append(errs, fmt.Errorf("keyboard.sides: a split keyboard needs at least two sides, got %d", len(cfg.Keyboard.Sides)))
+		}
+	case "uni":
+		if len(cfg.Keyboard.Sides) > 1 {
+			errs = append(errs, fmt.Errorf("keyboard.sides: a uni keyboard has at most one side, got %d", len(cfg.Keyboard.Sides)))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("keyboard.type must be \"split\" or \"uni\", got %q", cfg.Keyboard.Type))
+	}
+
+	for side, patterns := range cfg.Keyboard.SidePatterns {
+		if !slices.Contains(sides, side) {
+			errs = append(errs, fmt.Errorf("keyboard.side_patterns.%s: not one of keyboard.sides", side))
+		}
+		for _, p := range patterns {
+			if err := firmware.ValidateSidePattern(p); err != nil {
+				errs = append(errs, fmt.Errorf("keyboard.side_patterns.%s: %w", side, err))
+			}
+		}
+	}
+
+	for side := range cfg.Build.Targets {
+		if !slices.Contains(sides, side) {
+			errs = append(errs, fmt.Errorf("build.targets.%s: not one of keyboard.sides", side))
+		}
+	}
+
+	// Docker builds need a board and a shield for every side
+	if cfg.Build.Enabled && cfg.Build.Mode == "docker" {
+		var noBoard, noShield []string
+		for _, side := range sides {
+			if cfg.Build.BoardFor(side) == "" {
+				noBoard = append(noBoard, side)
+			}
+			if cfg.Build.ShieldFor(side) == "" {
+				noShield = append(noShield, side)
+			}
+		}
+		if len(noBoard) > 0 {
+			errs = append(errs, fmt.Errorf("build.board is required for docker mode (no board for %s)", strings.Join(noBoard, ", ")))
+		}
+		if len(noShield) > 0 {
+			errs = append(errs, fmt.Errorf("build.shield is required for docker mode (no shield for %s)", strings.Join(noShield, ", ")))
+		}
+	}
+
+	if cpus := cfg.Build.Docker.CPUs; cpus != "" {
+		if n, err := strconv.ParseFloat(cpus, 64); err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("build.docker.cpus must be a positive number, got %q", cpus))
+		}
+	}
+	for _, env := range cfg.Build.Docker.Env {
+		if key, _, _ := strings.Cut(env, "="); key == "" {
+			errs = append(errs, fmt.Errorf("build.docker.env: missing variable name in %q", env))
+		}
+	}
+	for _, vol := range cfg.Build.Docker.Volumes {
+		if !strings.Contains(vol, ":") {
+			errs = append(errs, fmt.Errorf("build.docker.volumes: %q must be host:container", vol))
+		}
+	}
+
+	if name := cfg.Build.Docker.Container; name != "" && !containerNameRegex.MatchString(name) {
+		errs = append(errs, fmt.Errorf("build.docker.container: invalid container name %q", name))
+	}
+	if cfg.Build.Docker.PullTimeout < 0 {
+		errs = append(errs, fmt.Errorf("build.docker.pull_timeout must be positive, got %s", time.Duration(cfg.Build.Docker.PullTimeout)))
+	}
+
+	if cfg.Build.Watch.Debounce < 0 {
+		errs = append(errs, fmt.Errorf("build.watch.debounce must be positive, got %s", time.Duration(cfg.Build.Watch.Debounce)))
+	}
+	for _, pattern := range cfg.Build.Watch.Patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("build.watch.patterns: %q: %w", pattern, err))
+		}
+	}
+
+	if kd := cfg.Build.KeymapDrawer; kd.Enabled {
+		switch kd.Mode {
+		case "native":
+		case "docker":
+			if kd.Image == "" {
+				errs = append(errs, errors.New("build.keymap_drawer.image is required for docker mode"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("build.keymap_drawer.mode must be \"native\" or \"docker\", got %q", kd.Mode))
+		}
+		if kd.Keymap == "" {
+			errs = append(errs, errors.New("build.keymap_drawer.keymap is required without build.shield"))
+		}
+	}
+
+	for i, src := range cfg.Build.Sources {
+		if src.Dir == "" {
+			errs = append(errs, fmt.Errorf("build.sources[%d].dir is required", i))
+		}
+	}
+
+	if raw := cfg.Build.Remote.URL; raw != "" {
+		if u, err := url.Parse(raw); err != nil {
+			errs = append(errs, fmt.Errorf("build.remote.url: %w", err))
+		} else if u.Scheme != "s3" && u.Scheme != "ssh" && u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("build.remote.url must start with s3://, ssh://, http:// or https://, got %q", u.Redacted()))
+		}
+	}
+
+	for _, format := range cfg.Build.DirFormats {
+		if !slices.Contains(DefaultDirFormats, format) {
+			errs = append(errs, fmt.Errorf("build.dir_formats: %q must be \"date\", \"iso-date\", \"semver\" or \"hash\"", format))
+		}
+	}
+
+	if f := cfg.Report.Format; f != "markdown" && f != "json" {
+		errs = append(errs, fmt.Errorf("report.format must be \"markdown\" or \"json\", got %q", f))
+	}
+
+	switch cfg.Signing.Method {
+	case "", "minisign", "ssh":
+	default:
+		errs = append(errs, fmt.Errorf("signing.method must be \"minisign\" or \"ssh\", got %q", cfg.Signing.Method))
+	}
+	if cfg.Signing.Method == "" && (cfg.Signing.Key != "" || len(cfg.Signing.TrustedKeys) > 0) {
+		errs = append(errs, errors.New("signing.method is required with signing.key or signing.trusted_keys"))
+	}
+
+	if cfg.Build.RetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("build.retention_days must be positive, got %d", cfg.Build.RetentionDays))
+	}
+	if cfg.Build.StaleDays < 0 {
+		errs = append(errs, fmt.Errorf("build.stale_days must be positive, got %d", cfg.Build.StaleDays))
+	}
+
+	if cfg.Device.USBID != "" && !usbIDRegex.MatchString(cfg.Device.USBID) {
+		errs = append(errs, fmt.Errorf("device.usb_id must be vendor:product in hex (e.g. \"239a:00b3\"), got %q", cfg.Device.USBID))
+	}
+	if cfg.Device.Host != "" && !hostRegex.MatchString(cfg.Device.Host) {
+		errs = append(errs, fmt.Errorf("device.host must be [user@]host[:port], got %q", cfg.Device.Host))
+	}
+	if cfg.Device.Host != "" && cfg.Flash.Mode != "copy" {
+		errs = append(errs, fmt.Errorf("device.host needs flash.mode \"copy\", got %q", cfg.Flash.Mode))
+	}
+	switch cfg.Device.Profile {
+	case "auto", "generic", "adafruit", "nicenano", "rp2040":
+	default:
+		errs = append(errs, fmt.Errorf("device.profile must be \"auto\", \"generic\", \"adafruit\", \"nicenano\" or \"rp2040\", got %q", cfg.Device.Profile))
+	}
+
+	switch cfg.Build.Pull {
+	case "never", "always", "ask":
+	default:
+		errs = append(errs, fmt.Errorf("build.pull must be \"never\", \"always\" or \"ask\", got %q", cfg.Build.Pull))
+	}
+
+	switch cfg.Flash.Mode {
+	case "copy":
+		// qmk mode lets the qmk CLI find the bootloader, so only copy needs a volume name
+		if cfg.Device.Name == "" {
+			errs = append(errs, errors.New("device.name is required"))
+		}
+	case "dfu":
+		// dfu-util finds the bootloader by USB, like qmk
+		if cfg.Flash.FileType != "bin" {
+			errs = append(errs, fmt.Errorf("flash.file_type must be \"bin\" in dfu mode, got %q", cfg.Flash.FileType))
+		}
+		if _, err := strconv.ParseUint(cfg.Flash.Address, 0, 32); err != nil {
+			errs = append(errs, fmt.Errorf("flash.address must be an address such as %s, got %q", DefaultDFUAddress, cfg.Flash.Address))
+		}
+		if cfg.Flash.DFUAlt < 0 {
+			errs = append(errs, fmt.Errorf("flash.dfu_alt must be positive, got %d", cfg.Flash.DFUAlt))
+		}
+	case "qmk":
+		if cfg.Flash.QMKKeyboard == "" {
+			errs = append(errs, errors.New("flash.qmk_keyboard is required for qmk mode"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("flash.mode must be \"copy\", \"dfu\" or \"qmk\", got %q", cfg.Flash.Mode))
+	}
+	if cfg.Flash.Mode == "copy" && cfg.Flash.FileType != "uf2" && cfg.Flash.FileType != "bin" {
+		errs = append(errs, fmt.Errorf("flash.file_type must be \"uf2\" or \"bin\", got %q", cfg.Flash.FileType))
+	}
+
+	switch cfg.Flash.WriteStrategy {
+	case "end", "chunked", "direct":
+	default:
+		errs = append(errs, fmt.Errorf("flash.write_strategy must be \"end\", \"chunked\" or \"direct\", got %q", cfg.Flash.WriteStrategy))
+	}
+	if cfg.Flash.SyncEvery < 0 {
+		errs = append(errs, fmt.Errorf("flash.sync_every must be positive, got %d", cfg.Flash.SyncEvery))
+	}
+	if cfg.Flash.MinSize < 0 {
+		errs = append(errs, fmt.Errorf("flash.min_size must be positive, got %d", cfg.Flash.MinSize))
+	}
+	for side, files := range cfg.Flash.Files {
+		if !slices.Contains(sides, side) {
+			errs = append(errs, fmt.Errorf("flash.files.%s: not one of keyboard.sides", side))
+		}
+		if len(files) == 0 {
+			errs = append(errs, fmt.Errorf("flash.files.%s: no files", side))
+		}
 	}
 
 	if len(errs) > 0 {
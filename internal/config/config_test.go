@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -79,56 +81,1119 @@ name = "TEST-DEVICE"
 	if cfg.Device.PollInterval != DefaultPollInterval {
 		t.Errorf("poll_interval = %v, want default %v", cfg.Device.PollInterval, DefaultPollInterval)
 	}
+	if cfg.Device.IdlePollInterval != DefaultIdlePollInterval {
+		t.Errorf("idle_poll_interval = %v, want default %v", cfg.Device.IdlePollInterval, DefaultIdlePollInterval)
+	}
 	if cfg.Build.FilePattern != DefaultFilePattern {
 		t.Errorf("file_pattern = %q, want default %q", cfg.Build.FilePattern, DefaultFilePattern)
 	}
+	if cfg.Backup.Dir != DefaultBackupDir {
+		t.Errorf("backup.dir = %q, want default %q", cfg.Backup.Dir, DefaultBackupDir)
+	}
+	if cfg.Build.RetentionDays != DefaultRetentionDays {
+		t.Errorf("retention_days = %d, want default %d", cfg.Build.RetentionDays, DefaultRetentionDays)
+	}
+	if cfg.Build.StaleDays != DefaultStaleDays {
+		t.Errorf("stale_days = %d, want default %d", cfg.Build.StaleDays, DefaultStaleDays)
+	}
+	if cfg.Device.Profile != DefaultDeviceProfile {
+		t.Errorf("device.profile = %q, want default %q", cfg.Device.Profile, DefaultDeviceProfile)
+	}
+	if cfg.Build.Docker.User != DefaultDockerUser {
+		t.Errorf("build.docker.user = %q, want default %q", cfg.Build.Docker.User, DefaultDockerUser)
+	}
+	if cfg.Build.Docker.PullTimeout != DefaultPullTimeout {
+		t.Errorf("build.docker.pull_timeout = %v, want default %v", cfg.Build.Docker.PullTimeout, DefaultPullTimeout)
+	}
+	if cfg.Flash.WriteStrategy != "end" {
+		t.Errorf("write_strategy = %q, want default %q", cfg.Flash.WriteStrategy, "end")
+	}
+	if cfg.Flash.SyncEvery != DefaultSyncEvery {
+		t.Errorf("sync_every = %d, want default %d", cfg.Flash.SyncEvery, DefaultSyncEvery)
+	}
+	if cfg.Flash.MinSize != DefaultMinFirmwareSize {
+		t.Errorf("min_size = %d, want default %d", cfg.Flash.MinSize, DefaultMinFirmwareSize)
+	}
+	if cfg.Flash.FileType != "uf2" {
+		t.Errorf("file_type = %q, want default %q", cfg.Flash.FileType, "uf2")
+	}
+	if len(cfg.Backup.Patterns) != len(DefaultBackupPatterns) {
+		t.Errorf("backup.patterns len = %d, want %d", len(cfg.Backup.Patterns), len(DefaultBackupPatterns))
+	}
+}
+
+func TestLoad_MissingKeyboardName(t *testing.T) {
+	content := `
+[keyboard]
+type = "split"
+
+[device]
+name = "RPI-RP2"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for missing keyboard.name")
+	}
+}
+
+func TestLoad_MissingDeviceName(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+poll_interval = "500ms"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for missing device.name")
+	}
+}
+
+func TestLoad_MissingBothRequired(t *testing.T) {
+	content := `
+[keyboard]
+type = "split"
+
+[device]
+poll_interval = "500ms"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for missing required fields")
+	}
+}
+
+func TestLoad_QMKMode(t *testing.T) {
+	content := `
+[keyboard]
+name = "crkbd"
+
+[flash]
+mode = "qmk"
+qmk_keyboard = "crkbd/rev1"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Flash.QMKKeyboard != "crkbd/rev1" {
+		t.Errorf("flash.qmk_keyboard = %q, want %q", cfg.Flash.QMKKeyboard, "crkbd/rev1")
+	}
+	if cfg.Flash.QMKKeymap != DefaultQMKKeymap {
+		t.Errorf("flash.qmk_keymap = %q, want default %q", cfg.Flash.QMKKeymap, DefaultQMKKeymap)
+	}
+}
+
+func TestLoad_QMKModeMissingKeyboard(t *testing.T) {
+	content := `
+[keyboard]
+name = "crkbd"
+
+[flash]
+mode = "qmk"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for missing flash.qmk_keyboard")
+	}
+}
+
+func TestLoad_InvalidFlashMode(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[flash]
+mode = "serial"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown flash.mode")
+	}
+}
+
+func TestLoad_DFUMode(t *testing.T) {
+	// dfu-util finds the bootloader by USB, so no device.name is needed
+	content := `
+[keyboard]
+name = "planck"
+
+[flash]
+mode = "dfu"
+`
+	cfg, err := Load(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Flash.FileType != "bin" || cfg.Flash.Extension() != ".bin" {
+		t.Errorf("file_type = %q, want bin", cfg.Flash.FileType)
+	}
+	if cfg.Flash.Address != DefaultDFUAddress {
+		t.Errorf("address = %q, want default %q", cfg.Flash.Address, DefaultDFUAddress)
+	}
+	if cfg.Build.FilePattern != "*.bin" {
+		t.Errorf("file_pattern = %q, want *.bin to match the file type", cfg.Build.FilePattern)
+	}
+}
+
+func TestLoad_InvalidDFUSettings(t *testing.T) {
+	content := `
+[keyboard]
+name = "planck"
+
+[flash]
+mode = "dfu"
+file_type = "uf2"
+address = "flash start"
+dfu_alt = -1
+`
+	_, err := Load(writeTempConfig(t, content))
+	if err == nil {
+		t.Fatal("expected errors for invalid dfu settings")
+	}
+	for _, want := range []string{"flash.file_type", "flash.address", "flash.dfu_alt"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestLoad_CopyModeBinaries(t *testing.T) {
+	content := `
+[keyboard]
+name = "bluepill"
+
+[device]
+name = "STM32"
+
+[build]
+file_pattern = "*_app.bin"
+
+[flash]
+file_type = "bin"
+`
+	cfg, err := Load(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Flash.Extension() != ".bin" || cfg.Build.FilePattern != "*_app.bin" {
+		t.Errorf("extension = %q, file_pattern = %q", cfg.Flash.Extension(), cfg.Build.FilePattern)
+	}
+
+	content = strings.Replace(content, `file_type = "bin"`, `file_type = "hex"`, 1)
+	if _, err := Load(writeTempConfig(t, content)); err == nil {
+		t.Error("expected an error for an unknown file_type")
+	}
+}
+
+func TestLoad_InvalidWriteStrategy(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[flash]
+write_strategy = "eventually"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown flash.write_strategy")
+	}
+}
+
+func TestLoad_InvalidUSBID(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+usb_id = "239a-00b3"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "device.usb_id") {
+		t.Fatalf("expected device.usb_id error, got %v", err)
+	}
+}
+
+func TestLoad_DeviceHost(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+host = "pi@keyboard-pi.local:2222"
+host_command = "~/go/bin/kbflash"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Device.Host != "pi@keyboard-pi.local:2222" || cfg.Device.HostCommand != "~/go/bin/kbflash" {
+		t.Errorf("Device = %+v", cfg.Device)
+	}
+
+	// A leading dash would reach ssh as an option
+	path = writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+host = "-oProxyCommand=touch /tmp/x"
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "device.host") {
+		t.Errorf("expected device.host error, got %v", err)
+	}
+
+	// Only copy mode flashes through the agent
+	path = writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+host = "keyboard-pi"
+
+[flash]
+mode = "qmk"
+qmk_keyboard = "crkbd/rev1"
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "device.host needs") {
+		t.Errorf("expected flash.mode error, got %v", err)
+	}
+}
+
+func TestLoad_InvalidDeviceProfile(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+profile = "samd21"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "device.profile") {
+		t.Fatalf("expected device.profile error, got %v", err)
+	}
+}
+
+func TestLoad_InvalidPull(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build]
+pull = "sometimes"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown build.pull")
+	}
+}
+
+func TestLoad_SideTargets(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+sides = ["left", "right", "dongle"]
+
+[build]
+board = "nice_nano_v2"
+shield = "corne"
+
+[build.targets.dongle]
+board = "xiao_ble"
+shield = "corne_dongle"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	boards := cfg.Build.Boards(cfg.Keyboard.Sides)
+	if boards["left"] != "nice_nano_v2" || boards["dongle"] != "xiao_ble" {
+		t.Errorf("boards = %v, want dongle override only", boards)
+	}
+}
+
+func TestLoad_SideTargetUnknownSide(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[build.targets.dongle]
+board = "xiao_ble"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for target on an unknown side")
+	}
+}
+
+func TestLoad_FlashFiles(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[device]
+name = "NICENANO"
+
+[flash.files]
+left = ["update-bootloader.uf2", "{{firmware}}", "settings_reset.uf2"]
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := cfg.Flash.FilesFor("left", "corne_left.uf2")
+	want := []string{"update-bootloader.uf2", "corne_left.uf2", "settings_reset.uf2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("FilesFor(left) = %v, want %v", got, want)
+	}
+	if got := cfg.Flash.FilesFor("right", "corne_right.uf2"); !slices.Equal(got, []string{"corne_right.uf2"}) {
+		t.Errorf("FilesFor(right) = %v, want firmware only", got)
+	}
+}
+
+func TestLoad_InvalidFlashFiles(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[device]
+name = "NICENANO"
+
+[flash.files]
+dongle = ["{{firmware}}"]
+right = []
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "flash.files.dongle") || !strings.Contains(err.Error(), "flash.files.right") {
+		t.Fatalf("expected flash.files errors, got %v", err)
+	}
+}
+
+func TestLoad_DockerOptions(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build.docker]
+cpus = "1.5"
+memory = "4g"
+env = ["FOO=bar", "TOKEN"]
+volumes = ["/modules:/modules:ro"]
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Build.Docker.CPUs != "1.5" || len(cfg.Build.Docker.Env) != 2 || len(cfg.Build.Docker.Volumes) != 1 {
+		t.Errorf("build.docker = %+v", cfg.Build.Docker)
+	}
+}
+
+func TestLoad_InvalidDockerOptions(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build.docker]
+cpus = "lots"
+env = ["=value"]
+volumes = ["/modules"]
+container = "my container"
+pull_timeout = "-1m"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for invalid build.docker settings")
+	}
+	for _, key := range []string{"cpus", "env", "volumes", "container", "pull_timeout"} {
+		if !strings.Contains(err.Error(), "build.docker."+key) {
+			t.Errorf("error %q does not mention build.docker.%s", err, key)
+		}
+	}
+}
+
+func TestLoad_FirmwareSources(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build]
+firmware_dir = "./firmware"
+
+[[build.sources]]
+label = "ci"
+dir = "/tmp/ci-artifacts"
+
+[[build.sources]]
+dir = "/tmp/Downloads"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources := cfg.Build.AllSources()
+	if len(sources) != 3 {
+		t.Fatalf("sources len = %d, want 3", len(sources))
+	}
+	if sources[0].Label != "local" || sources[0].Dir != "./firmware" {
+		t.Errorf("primary source = %+v, want local ./firmware", sources[0])
+	}
+	if sources[1].Label != "ci" {
+		t.Errorf("sources[1].label = %q, want %q", sources[1].Label, "ci")
+	}
+	if sources[2].Label != "Downloads" {
+		t.Errorf("sources[2].label = %q, want default %q", sources[2].Label, "Downloads")
+	}
+}
+
+func TestLoad_FirmwareSourceMissingDir(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[[build.sources]]
+label = "ci"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for source without dir")
+	}
+}
+
+func TestLoad_SidePatterns(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[keyboard.side_patterns]
+left = ["*_l.uf2"]
+right = ['re:_r\.uf2$']
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Keyboard.SidePatterns["right"]; len(got) != 1 || got[0] != `re:_r\.uf2$` {
+		t.Errorf("side_patterns.right = %v", got)
+	}
+}
+
+func TestLoad_InvalidSidePattern(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[keyboard.side_patterns]
+left = ["re:("]
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for invalid side pattern")
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	content := `
+[build]
+firmware_dir = "./firmware"
+
+[device]
+name = "NICENANO"
+
+[profiles.corne.keyboard]
+type = "split"
+sides = ["left", "right"]
+
+[profiles.planck.keyboard]
+name = "Planck"
+
+[profiles.planck.build]
+firmware_dir = "/tmp/planck"
+
+[profiles.planck.device]
+name = "RPI-RP2"
+poll_interval = "1s"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := cfg.ProfileNames()
+	if len(names) != 2 || names[0] != "corne" || names[1] != "planck" {
+		t.Fatalf("profile names = %v, want [corne planck]", names)
+	}
+
+	corne, err := cfg.Profile("corne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corne.Keyboard.Name != "corne" {
+		t.Errorf("corne keyboard.name = %q, want profile name", corne.Keyboard.Name)
+	}
+	if corne.Build.FirmwareDir != filepath.Join("firmware", "corne") {
+		t.Errorf("corne firmware_dir = %q, want per-keyboard subdirectory", corne.Build.FirmwareDir)
+	}
+	if corne.Device.Name != "NICENANO" {
+		t.Errorf("corne device.name = %q, want inherited NICENANO", corne.Device.Name)
+	}
+
+	planck, err := cfg.Profile("planck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if planck.Build.FirmwareDir != "/tmp/planck" {
+		t.Errorf("planck firmware_dir = %q, want explicit /tmp/planck", planck.Build.FirmwareDir)
+	}
+	if planck.Device.Name != "RPI-RP2" || planck.Device.PollInterval != Duration(time.Second) {
+		t.Errorf("planck device = %+v, want overridden name and poll interval", planck.Device)
+	}
+
+	if _, err := cfg.Profile("missing"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoad_ProfileFirmwareDirPlaceholder(t *testing.T) {
+	content := `
+[build]
+firmware_dir = "/srv/firmware/{{keyboard}}/builds"
+
+[device]
+name = "NICENANO"
+
+[profiles.corne.keyboard]
+sides = ["left", "right"]
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	corne, err := cfg.Profile("corne")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corne.Build.FirmwareDir != "/srv/firmware/corne/builds" {
+		t.Errorf("firmware_dir = %q, want placeholder replaced", corne.Build.FirmwareDir)
+	}
 }
 
-func TestLoad_MissingKeyboardName(t *testing.T) {
-	content := `
+func TestLoad_CrossFieldValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "split with one side",
+			content: `
+[keyboard]
+name = "corne"
+type = "split"
+sides = ["left"]`,
+			want: []string{"a split keyboard needs at least two sides, got 1"},
+		},
+		{
+			name: "uni with two sides",
+			content: `
+[keyboard]
+name = "planck"
+type = "uni"
+sides = ["left", "right"]`,
+			want: []string{"a uni keyboard has at most one side, got 2"},
+		},
+		{
+			name: "unknown type",
+			content: `
+[keyboard]
+name = "corne"
+type = "splt"`,
+			want: []string{`keyboard.type must be "split" or "uni", got "splt"`},
+		},
+		{
+			name: "docker without board and shield",
+			content: `
 [keyboard]
+name = "corne"
 type = "split"
+sides = ["left", "right"]
+
+[build]
+enabled = true
+mode = "docker"
+
+[build.targets.right]
+board = "xiao_ble"`,
+			want: []string{
+				"build.board is required for docker mode (no board for left)",
+				"build.shield is required for docker mode (no shield for left, right)",
+			},
+		},
+		{
+			name: "unknown sides in mappings without keyboard.sides",
+			content: `
+[keyboard]
+name = "planck"
+type = "uni"
+
+[keyboard.side_patterns]
+left = ["*_left.uf2"]
+
+[flash.files]
+right = ["{{firmware}}"]`,
+			want: []string{
+				"keyboard.side_patterns.left: not one of keyboard.sides",
+				"flash.files.right: not one of keyboard.sides",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempConfig(t, tt.content+`
 
 [device]
-name = "RPI-RP2"
-`
-	path := writeTempConfig(t, content)
+name = "NICENANO"
+`)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_DirFormats(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[build]
+dir_formats = ["semver", "timestamp"]
 
+[device]
+name = "NICENANO"
+`)
 	_, err := Load(path)
-	if err == nil {
-		t.Fatal("expected error for missing keyboard.name")
+	if err == nil || !strings.Contains(err.Error(), `build.dir_formats: "timestamp"`) {
+		t.Errorf("expected an unknown dir format error, got %v", err)
 	}
 }
 
-func TestLoad_MissingDeviceName(t *testing.T) {
-	content := `
+func TestLoad_KeymapDrawer(t *testing.T) {
+	path := writeTempConfig(t, `
 [keyboard]
 name = "corne"
 
+[build]
+shield = "corne"
+
+[build.keymap_drawer]
+enabled = true
+
 [device]
-poll_interval = "500ms"
-`
-	path := writeTempConfig(t, content)
+name = "NICENANO"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Build.KeymapDrawer.Mode != "native" {
+		t.Errorf("Mode = %q, want native", cfg.Build.KeymapDrawer.Mode)
+	}
+	if cfg.Build.KeymapDrawer.Keymap != "config/corne.keymap" {
+		t.Errorf("Keymap = %q, want config/corne.keymap", cfg.Build.KeymapDrawer.Keymap)
+	}
+}
+
+func TestLoad_KeymapDrawerInvalid(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[build.keymap_drawer]
+enabled = true
+mode = "docker"
 
+[device]
+name = "NICENANO"
+`)
 	_, err := Load(path)
 	if err == nil {
-		t.Fatal("expected error for missing device.name")
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"build.keymap_drawer.image", "build.keymap_drawer.keymap"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
 	}
 }
 
-func TestLoad_MissingBothRequired(t *testing.T) {
-	content := `
+func TestLoad_Remote(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[build]
+firmware_dir = "./firmware"
+
+[build.remote]
+url = "s3://team-firmware/{{keyboard}}"
+upload = true
+
+[device]
+name = "NICENANO"
+
+[profiles.lily58.keyboard]
+sides = ["left", "right"]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Build.Remote.Dir != "firmware-remote" {
+		t.Errorf("Remote.Dir = %q, want firmware-remote", cfg.Build.Remote.Dir)
+	}
+	remote := FirmwareSource{Label: RemoteSourceLabel, Dir: "firmware-remote"}
+	if !slices.Contains(cfg.Build.Sources, remote) {
+		t.Errorf("Sources = %+v, want the remote cache's directory", cfg.Build.Sources)
+	}
+
+	lily := cfg.Profiles["lily58"]
+	if lily.Build.Remote.URL != "s3://team-firmware/lily58" {
+		t.Errorf("profile Remote.URL = %q, want the keyboard name filled in", lily.Build.Remote.URL)
+	}
+	if want := filepath.Join("firmware", "lily58") + "-remote"; lily.Build.Remote.Dir != want {
+		t.Errorf("profile Remote.Dir = %q, want %q", lily.Build.Remote.Dir, want)
+	}
+	if len(lily.Build.Sources) != 1 {
+		t.Errorf("profile Sources = %+v, want one remote source", lily.Build.Sources)
+	}
+}
+
+func TestLoad_RemoteInvalid(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[build.remote]
+url = "ftp://nas/firmware"
+
+[device]
+name = "NICENANO"
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "build.remote.url") {
+		t.Errorf("expected a build.remote.url error, got %v", err)
+	}
+}
+
+func TestLoad_Signing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[signing]
+method = "minisign"
+key = "~/.minisign/kbflash.key"
+trusted_keys = ["RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if want := filepath.Join(home, ".minisign", "kbflash.key"); cfg.Signing.Key != want {
+		t.Errorf("Key = %q, want %q", cfg.Signing.Key, want)
+	}
+	if len(cfg.Signing.TrustedKeys) != 1 {
+		t.Errorf("TrustedKeys = %q, want one key", cfg.Signing.TrustedKeys)
+	}
+}
+
+func TestLoad_SigningInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing string
+		want    string
+	}{
+		{"unknown method", `method = "gpg"`, "signing.method must be"},
+		{"key without method", `key = "kbflash.key"`, "signing.method is required"},
+		{"trusted keys without method", `trusted_keys = ["RWQ"]`, "signing.method is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[signing]
+`+tt.signing+`
+`)
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_DockerTargetsCoverBoard(t *testing.T) {
+	path := writeTempConfig(t, `
 [keyboard]
+name = "corne"
 type = "split"
+sides = ["left", "right"]
+
+[build]
+enabled = true
+mode = "docker"
+shield = "corne"
+
+[build.targets.left]
+board = "nice_nano_v2"
+
+[build.targets.right]
+board = "xiao_ble"
 
 [device]
-poll_interval = "500ms"
+name = "NICENANO"
+`)
+	if _, err := Load(path); err != nil {
+		t.Errorf("per-side boards should satisfy docker mode: %v", err)
+	}
+}
+
+func TestLoad_DockerPerSideShields(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+type = "split"
+sides = ["left", "right"]
+
+[build]
+enabled = true
+mode = "docker"
+board = "nice_nano_v2"
+
+[build.targets.left]
+shield = "corne_left nice_view_adapter nice_view"
+
+[build.targets.right]
+shield = "corne_right"
+
+[device]
+name = "NICENANO"
+`)
+	if _, err := Load(path); err != nil {
+		t.Errorf("per-side shields should satisfy docker mode: %v", err)
+	}
+}
+
+func TestLoad_InvalidProfile(t *testing.T) {
+	content := `
+[keyboard]
+name = "base"
+
+[profiles.corne.keyboard]
+sides = ["left", "right"]
 `
 	path := writeTempConfig(t, content)
 
 	_, err := Load(path)
 	if err == nil {
-		t.Fatal("expected error for missing required fields")
+		t.Fatal("expected error for profile missing device.name")
+	}
+}
+
+func TestLoad_Extends(t *testing.T) {
+	base := writeTempConfig(t, `
+[keyboard]
+name = "base"
+sides = ["left", "right"]
+
+[build]
+mode = "docker"
+board = "nice_nano_v2"
+shield = "corne"
+
+[device]
+name = "XIAO-SENSE"
+poll_interval = "250ms"
+`)
+	dir := t.TempDir()
+	path := filepath.Join(dir, LocalConfigName)
+	local := `extends = "` + filepath.ToSlash(base) + `"
+
+[keyboard]
+name = "sofle"
+
+[build]
+shield = "sofle"
+`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Keyboard.Name != "sofle" || cfg.Build.Shield != "sofle" {
+		t.Errorf("local values not applied: name=%q shield=%q", cfg.Keyboard.Name, cfg.Build.Shield)
+	}
+	if len(cfg.Keyboard.Sides) != 2 || cfg.Build.Board != "nice_nano_v2" || cfg.Build.Mode != "docker" {
+		t.Errorf("base keys within overridden tables not inherited: %+v", cfg.Build)
+	}
+	if cfg.Device.Name != "XIAO-SENSE" || time.Duration(cfg.Device.PollInterval) != 250*time.Millisecond {
+		t.Errorf("device section not inherited: %+v", cfg.Device)
+	}
+}
+
+func TestLoad_ExtendsRelative(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.toml"), []byte("[device]\nname = \"NICENANO\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "local.toml")
+	if err := os.WriteFile(path, []byte("extends = \"base.toml\"\n[keyboard]\nname = \"corne\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Device.Name != "NICENANO" {
+		t.Errorf("device.name = %q, want NICENANO from base.toml", cfg.Device.Name)
+	}
+}
+
+func TestLoad_ExtendsCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.toml")
+	b := filepath.Join(dir, "b.toml")
+	if err := os.WriteFile(a, []byte("extends = \"b.toml\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("extends = \"a.toml\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(a)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected an extends cycle error, got %v", err)
+	}
+}
+
+func TestLoad_ExtendsMissing(t *testing.T) {
+	path := writeTempConfig(t, `extends = "does-not-exist.toml"`)
+
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for a missing base config")
 	}
 }
 
@@ -196,6 +1261,49 @@ func TestDefaultPath(t *testing.T) {
 	}
 }
 
+func TestLoad_EnvConfig(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "from-env"
+
+[device]
+name = "NICENANO"
+`)
+	t.Setenv(EnvConfig, path)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Keyboard.Name != "from-env" {
+		t.Errorf("keyboard.name = %q, want the $%s config", cfg.Keyboard.Name, EnvConfig)
+	}
+
+	// An explicit path wins over the environment
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("expected an error loading an explicit missing path")
+	}
+}
+
+func TestGenerateExampleConfig_EnvConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env", "kbflash.toml")
+	t.Setenv(EnvConfig, path)
+
+	written, err := GenerateExampleConfig("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != path {
+		t.Errorf("wrote %q, want %q", written, path)
+	}
+}
+
+func TestPathInDir(t *testing.T) {
+	if got := PathInDir("/etc/kbflash"); got != filepath.Join("/etc/kbflash", "config.toml") {
+		t.Errorf("PathInDir = %q", got)
+	}
+}
+
 func TestDefaultPath_XDGConfigHome(t *testing.T) {
 	// Save and restore original value
 	original := os.Getenv("XDG_CONFIG_HOME")
@@ -238,3 +1346,88 @@ func writeTempConfig(t *testing.T, content string) string {
 	}
 	return path
 }
+
+func TestLoad_Status(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[status]
+enabled = true
+path = "~/.cache/kbflash-{{keyboard}}.json"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.Status.Enabled {
+		t.Error("Enabled = false, want true")
+	}
+	if want := filepath.Join(home, ".cache", "kbflash-corne.json"); cfg.Status.Path != want {
+		t.Errorf("Path = %q, want %q", cfg.Status.Path, want)
+	}
+}
+
+func TestBuildConfig_KeymapTargets(t *testing.T) {
+	b := BuildConfig{
+		Shield:       "corne",
+		WorkingDir:   "/src/zmk-config",
+		KeymapDrawer: KeymapDrawerConfig{Keymap: "config/corne.keymap"},
+	}
+	if want := filepath.Join("/src/zmk-config", "config", "corne.keymap"); b.KeymapPath() != want {
+		t.Errorf("KeymapPath = %q, want %q", b.KeymapPath(), want)
+	}
+	sides := []string{"left", "right", "reset"}
+	b.Targets = map[string]SideTarget{
+		"right": {Shield: "corne_right nice_view_adapter nice_view"},
+		"reset": {Shield: "settings_reset"},
+	}
+	if got := b.KeymapTargets(sides); !slices.Equal(got, []string{"left", "right"}) {
+		t.Errorf("KeymapTargets = %v, want left and right", got)
+	}
+
+	// A keymap of another keyboard builds into nothing
+	b.KeymapDrawer.Keymap = "config/lily58.keymap"
+	if got := b.KeymapTargets(sides); len(got) != 0 {
+		t.Errorf("KeymapTargets = %v, want none", got)
+	}
+}
+
+func TestLoad_Watch(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[build.watch]
+enabled = true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !slices.Equal(cfg.Build.Watch.Patterns, DefaultWatchPatterns) || cfg.Build.Watch.Debounce != DefaultWatchDebounce {
+		t.Errorf("Watch = %+v, want the defaults", cfg.Build.Watch)
+	}
+
+	path = writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[build.watch]
+patterns = ["config/[.keymap"]
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "build.watch.patterns") {
+		t.Errorf("expected build.watch.patterns error, got %v", err)
+	}
+}
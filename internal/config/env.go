@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts every environment variable that overrides a config key.
+// The rest of the name is the key's TOML path upper-cased with dots as
+// underscores: device.name is KBFLASH_DEVICE_NAME, build.docker.cpus is
+// KBFLASH_BUILD_DOCKER_CPUS. Lists are comma-separated.
+const EnvPrefix = "KBFLASH_"
+
+// EnvOverride maps an environment variable to the config key it overrides.
+type EnvOverride struct {
+	Env string // e.g. KBFLASH_DEVICE_NAME
+	Key string // e.g. device.name
+
+	field []int
+}
+
+// EnvOverrides lists every config key that can be set from the environment,
+// sorted by variable name. Tables keyed by side and lists of tables
+// (build.targets, build.sources, ...) can only be set in the file.
+func EnvOverrides() []EnvOverride {
+	var overrides []EnvOverride
+	collectEnvOverrides(reflect.TypeOf(Config{}), "", nil, &overrides)
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Env < overrides[j].Env })
+	return overrides
+}
+
+func collectEnvOverrides(t reflect.Type, prefix string, index []int, out *[]EnvOverride) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("toml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+		path := append(append([]int{}, index...), i)
+
+		ft := f.Type
+		switch {
+		case ft.Kind() == reflect.Struct:
+			collectEnvOverrides(ft, key+".", path, out)
+			continue
+		case ft.Kind() == reflect.Map,
+			ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.String:
+			continue
+		}
+		*out = append(*out, EnvOverride{
+			Env:   envName(key),
+			Key:   key,
+			field: path,
+		})
+	}
+}
+
+// envName returns the environment variable overriding key.
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// lookupEnv returns the variable overriding o, falling back to the variable
+// for the key's old name if it has been renamed.
+func lookupEnv(o EnvOverride) (string, bool) {
+	if value, ok := os.LookupEnv(o.Env); ok {
+		return value, true
+	}
+	for _, r := range renamedKeys {
+		if r.to == o.Key {
+			if value, ok := os.LookupEnv(envName(r.from)); ok {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// applyEnv overrides config values with any set KBFLASH_* variables.
+func applyEnv(cfg *Config) error {
+	var errs []error
+	v := reflect.ValueOf(cfg).Elem()
+	for _, o := range EnvOverrides() {
+		value, ok := lookupEnv(o)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(v.FieldByIndex(o.field), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", o.Env, o.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setEnvValue parses value into a config field.
+func setEnvValue(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("not a boolean: %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("not an integer: %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Pointer:
+		p := reflect.New(field.Type().Elem())
+		if err := setEnvValue(p.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(p)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvOverrides_Mapping(t *testing.T) {
+	want := map[string]string{
+		"KBFLASH_DEVICE_NAME":        "device.name",
+		"KBFLASH_BUILD_MODE":         "build.mode",
+		"KBFLASH_BUILD_FILE_PATTERN": "build.file_pattern",
+		"KBFLASH_BUILD_DOCKER_CPUS":  "build.docker.cpus",
+		"KBFLASH_KEYBOARD_SIDES":     "keyboard.sides",
+	}
+	got := make(map[string]string)
+	for _, o := range EnvOverrides() {
+		got[o.Env] = o.Key
+	}
+	for env, key := range want {
+		if got[env] != key {
+			t.Errorf("%s maps to %q, want %q", env, got[env], key)
+		}
+	}
+	for _, env := range []string{"KBFLASH_BUILD_TARGETS", "KBFLASH_BUILD_SOURCES", "KBFLASH_FLASH_FILES"} {
+		if _, ok := got[env]; ok {
+			t.Errorf("%s should not be overridable", env)
+		}
+	}
+}
+
+func TestLoad_EnvOverrides(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[build]
+mode = "native"
+
+[device]
+name = "NICENANO"
+`)
+	t.Setenv("KBFLASH_DEVICE_NAME", "XIAO-SENSE")
+	t.Setenv("KBFLASH_BUILD_MODE", "docker")
+	t.Setenv("KBFLASH_BUILD_SHIELD", "corne")
+	t.Setenv("KBFLASH_BUILD_BOARD", "nice_nano_v2")
+	t.Setenv("KBFLASH_DEVICE_POLL_INTERVAL", "250ms")
+	t.Setenv("KBFLASH_DEVICE_AUTO_MOUNT", "false")
+	t.Setenv("KBFLASH_BUILD_RETENTION_DAYS", "3")
+	t.Setenv("KBFLASH_KEYBOARD_SIDES", "left, right, dongle")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Device.Name != "XIAO-SENSE" {
+		t.Errorf("device.name = %q, want XIAO-SENSE", cfg.Device.Name)
+	}
+	if cfg.Build.Mode != "docker" {
+		t.Errorf("build.mode = %q, want docker", cfg.Build.Mode)
+	}
+	if time.Duration(cfg.Device.PollInterval) != 250*time.Millisecond {
+		t.Errorf("device.poll_interval = %v, want 250ms", time.Duration(cfg.Device.PollInterval))
+	}
+	if cfg.Device.AutoMountEnabled() {
+		t.Error("device.auto_mount should be disabled")
+	}
+	if cfg.Build.RetentionDays != 3 {
+		t.Errorf("build.retention_days = %d, want 3", cfg.Build.RetentionDays)
+	}
+	if strings.Join(cfg.Keyboard.Sides, ",") != "left,right,dongle" {
+		t.Errorf("keyboard.sides = %v", cfg.Keyboard.Sides)
+	}
+}
+
+func TestLoad_EnvOverrideInvalid(t *testing.T) {
+	path := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+`)
+	t.Setenv("KBFLASH_BUILD_RETENTION_DAYS", "soon")
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "KBFLASH_BUILD_RETENTION_DAYS") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestLoad_EnvOverridesProfiles(t *testing.T) {
+	path := writeTempConfig(t, `
+[device]
+name = "NICENANO"
+
+[profiles.corne.keyboard]
+name = "corne"
+
+[profiles.sofle.keyboard]
+name = "sofle"
+`)
+	t.Setenv("KBFLASH_DEVICE_NAME", "XIAO-SENSE")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range cfg.ProfileNames() {
+		if got := cfg.Profiles[name].Device.Name; got != "XIAO-SENSE" {
+			t.Errorf("profile %s device.name = %q, want XIAO-SENSE", name, got)
+		}
+	}
+}
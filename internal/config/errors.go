@@ -0,0 +1,321 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// fileError points a config error at the line of the file it comes from.
+type fileError struct {
+	path   string
+	line   int
+	column int    // 0 when only the line is known
+	text   string // the offending line
+	err    error
+}
+
+func (e *fileError) Error() string {
+	loc := fmt.Sprintf("%s:%d", e.path, e.line)
+	if e.column > 0 {
+		loc += fmt.Sprintf(":%d", e.column)
+	}
+	msg := loc + ": " + e.err.Error() + "\n" + fmt.Sprintf("%5d | %s", e.line, e.text)
+	if e.column > 0 {
+		msg += "\n      | " + strings.Repeat(" ", e.column-1) + "^"
+	}
+	return msg
+}
+
+func (e *fileError) Unwrap() error {
+	return e.err
+}
+
+// configFile is a config file's text, kept to point errors at its lines.
+type configFile struct {
+	path    string
+	lines   []string
+	keys    map[string]int // dotted key or table path to the line it is set on
+	renamed []renamedKey   // old keys moved to their current names
+}
+
+func newConfigFile(path string, data []byte) *configFile {
+	lines := strings.Split(string(data), "\n")
+	return &configFile{path: path, lines: lines, keys: keyLines(lines)}
+}
+
+// where returns path:line for key, or just the path if its line is unknown.
+func (f *configFile) where(key string) string {
+	if line, ok := f.keys[key]; ok {
+		return fmt.Sprintf("%s:%d", f.path, line)
+	}
+	return f.path
+}
+
+// at returns err pointed at line and column (0 for the whole line).
+func (f *configFile) at(line, column int, err error) error {
+	if line < 1 || line > len(f.lines) {
+		return err
+	}
+	return &fileError{
+		path:   f.path,
+		line:   line,
+		column: column,
+		text:   strings.TrimRight(f.lines[line-1], "\r"),
+		err:    err,
+	}
+}
+
+var (
+	tableLineRegex = regexp.MustCompile(`^\s*\[\[?\s*([A-Za-z0-9_-]+(?:\s*\.\s*[A-Za-z0-9_-]+)*)\s*\]`)
+	keyLineRegex   = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+(?:\s*\.\s*[A-Za-z0-9_-]+)*)\s*=`)
+)
+
+// keyLines maps the dotted path of every table and bare key in a TOML file
+// to the line it first appears on. Reading line by line covers configs
+// written by hand; quoted keys and values spanning lines are skipped.
+func keyLines(lines []string) map[string]int {
+	keys := make(map[string]int)
+	table := ""
+	for i, line := range lines {
+		var key string
+		if m := tableLineRegex.FindStringSubmatch(line); m != nil {
+			table = strings.Join(strings.Fields(m[1]), "")
+			key = table
+		} else if m := keyLineRegex.FindStringSubmatch(line); m != nil {
+			key = strings.Join(strings.Fields(m[1]), "")
+			if table != "" {
+				key = table + "." + key
+			}
+		} else {
+			continue
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = i + 1
+		}
+	}
+	return keys
+}
+
+// fileType is the struct type of what a config file may contain: the
+// config's tables, each with its per-OS tables, plus the keys Load handles
+// before decoding into Config.
+var fileType = fileKeysType()
+
+func fileKeysType() reflect.Type {
+	t := reflect.TypeOf(Config{})
+	var tables []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if key := f.Tag.Get("toml"); key == "" || key == "-" {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			f.Type = withOSTables(f.Type)
+		}
+		tables = append(tables, f)
+	}
+	profile := reflect.StructOf(tables)
+	return reflect.StructOf(append(tables,
+		reflect.StructField{Name: "Extends", Type: reflect.TypeOf(""), Tag: `toml:"extends"`},
+		reflect.StructField{Name: "Profiles", Type: reflect.MapOf(reflect.TypeOf(""), profile), Tag: `toml:"profiles"`},
+	))
+}
+
+// checkFile decodes a config file strictly, reporting syntax errors, values
+// of the wrong type and unknown keys at their line, with the closest known
+// key for likely typos.
+func checkFile(f *configFile, data []byte) error {
+	dec := toml.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(reflect.New(fileType).Interface())
+
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, column := decodeErr.Position()
+		msg := strings.TrimPrefix(decodeErr.Error(), "toml: ")
+		return fmt.Errorf("cannot parse config file: %w", f.at(line, column, errors.New(msg)))
+	}
+
+	var strictErr *toml.StrictMissingError
+	if errors.As(err, &strictErr) {
+		var errs []error
+		for _, e := range strictErr.Errors {
+			key := e.Key()
+			if _, ok := renamedTo(strings.Join(key, ".")); ok {
+				continue // moved by migrateTables
+			}
+			msg := "unknown key " + strings.Join(key, ".")
+			if s := suggestKey(key); s != "" {
+				msg += ", did you mean " + s + "?"
+			}
+			line, column := e.Position()
+			errs = append(errs, f.at(line, column, errors.New(msg)))
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse config file: %w", err)
+	}
+	return nil
+}
+
+// suggestKey returns the known key closest to the last element of an
+// unknown key path, or "" if none is close enough to be a typo.
+func suggestKey(key []string) string {
+	if len(key) == 0 {
+		return ""
+	}
+	t := fileType
+	path := key[:len(key)-1]
+	for i := 0; i < len(path); i++ {
+		field, ok := tomlField(t, path[i])
+		if !ok {
+			return ""
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Map {
+			i++ // tables keyed by side or profile name: skip the name
+			ft = ft.Elem()
+		}
+		for ft.Kind() == reflect.Slice || ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			return ""
+		}
+		t = ft
+	}
+
+	unknown := normalizeKey(key[len(key)-1])
+	best, bestDist := "", len(unknown)/3+1
+	for _, name := range tomlKeys(t) {
+		if d := editDistance(unknown, normalizeKey(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// tomlField returns the field of struct t (or a struct it embeds) decoded
+// from the TOML key name.
+func tomlField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			if inner, ok := tomlField(f.Type, name); ok {
+				return inner, true
+			}
+			continue
+		}
+		if f.Tag.Get("toml") == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// tomlKeys returns the TOML keys of struct t, including embedded structs'.
+func tomlKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			keys = append(keys, tomlKeys(f.Type)...)
+			continue
+		}
+		if key := f.Tag.Get("toml"); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// normalizeKey lowercases a key and drops separators, so firmwaredir and
+// firmware-dir both match firmware_dir.
+func normalizeKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// editDistance returns the edit distance between a and b, counting a swap
+// of adjacent characters (mdoe for mode) as a single edit.
+func editDistance(a, b string) int {
+	var prev2 []int
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev = prev, cur
+	}
+	return prev[len(b)]
+}
+
+// errorKeyRegex matches the key a validation error starts with.
+var errorKeyRegex = regexp.MustCompile(`^[a-z_]+(\.[A-Za-z0-9_-]+)*`)
+
+// locate points each validation error in err at the line setting the key it
+// names, looking in files in order (the config, then the bases it extends)
+// and under prefix first, e.g. "profiles.corne.". Errors about keys no
+// file sets are left as they are.
+func locate(err error, files []*configFile, prefix string) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return locateOne(err, files, prefix)
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, locateOne(e, files, prefix))
+	}
+	return errors.Join(errs...)
+}
+
+func locateOne(err error, files []*configFile, prefix string) error {
+	key := errorKeyRegex.FindString(err.Error())
+	if key == "" {
+		return err
+	}
+	// A missing key is pointed at its table, e.g. build for build.board.
+	// This OS's table, which wins over the section, is looked in first.
+	for k := key; k != ""; k = parentKey(k) {
+		inOS := osKey(k, runtime.GOOS)
+		for _, candidate := range []string{prefix + inOS, prefix + k, inOS, k} {
+			for _, f := range files {
+				if line, ok := f.keys[candidate]; ok {
+					return f.at(line, 0, err)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// parentKey returns the table holding key, "" for a top-level key.
+func parentKey(key string) string {
+	i := strings.LastIndexByte(key, '.')
+	if i < 0 {
+		return ""
+	}
+	return key[:i]
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLoad_UnknownKeySuggestion(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[build]
+firmwaredir = "~/firmware"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown key build.firmwaredir")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		path + ":9:1: unknown key build.firmwaredir, did you mean firmware_dir?",
+		`    9 | firmwaredir = "~/firmware"`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_UnknownKeyInProfile(t *testing.T) {
+	content := `
+[device]
+name = "NICENANO"
+
+[profiles.corne.flash]
+mdoe = "copy"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown key profiles.corne.flash.mdoe")
+	}
+	if want := path + ":6:1: unknown key profiles.corne.flash.mdoe, did you mean mode?"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error missing %q:\n%s", want, err)
+	}
+}
+
+func TestLoad_UnknownKeyNoSuggestion(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+colour = "blue"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown key keyboard.colour")
+	}
+	if strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("unexpected suggestion: %v", err)
+	}
+}
+
+func TestLoad_WrongTypePosition(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+poll_interval = 500
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for numeric device.poll_interval")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		path + ":7:",
+		"    7 | poll_interval = 500",
+		"^",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_ValidationErrorLine(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[flash]
+mode = "serial"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown flash.mode")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		path + ":9: flash.mode",
+		`    9 | mode = "serial"`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoad_ValidationErrorInBase(t *testing.T) {
+	base := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[flash]
+write_strategy = "sometimes"
+`)
+	path := writeTempConfig(t, fmt.Sprintf(`
+extends = %q
+
+[device]
+name = "NICENANO"
+`, base))
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for base flash.write_strategy")
+	}
+	if want := base + ":6: flash.write_strategy"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error missing %q:\n%s", want, err)
+	}
+}
+
+func TestKeyLines(t *testing.T) {
+	lines := strings.Split(`extends = "base.toml"
+
+[keyboard]
+name = "corne"
+  sides = ["left", "right"]
+
+[[build.sources]]
+dir = "a"
+
+[[build.sources]]
+dir = "b"
+
+[profiles.lily]
+device.name = "NICENANO"`, "\n")
+
+	got := keyLines(lines)
+	want := map[string]int{
+		"extends":                   1,
+		"keyboard":                  3,
+		"keyboard.name":             4,
+		"keyboard.sides":            5,
+		"build.sources":             7,
+		"build.sources.dir":         8,
+		"profiles.lily":             13,
+		"profiles.lily.device.name": 14,
+	}
+	for key, line := range want {
+		if got[key] != line {
+			t.Errorf("keyLines()[%q] = %d, want %d", key, got[key], line)
+		}
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"build.firmwaredir", "firmware_dir"},
+		{"build.Firmware-Dir", "firmware_dir"},
+		{"keybaord", "keyboard"},
+		{"device.pol_interval", "poll_interval"},
+		{"build.targets.left.bord", "board"},
+		{"profiles.corne.flash.mdoe", "mode"},
+		{"build.sources.lable", "label"},
+		{"keyboard.colour", ""},
+		{"nonsense.name", ""},
+	}
+	for _, tt := range tests {
+		if got := suggestKey(strings.Split(tt.key, ".")); got != tt.want {
+			t.Errorf("suggestKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"mode", "mode", 0},
+		{"mdoe", "mode", 1},
+		{"lable", "label", 1},
+		{"bord", "board", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// renamedKey is a config key that has been renamed or moved.
+type renamedKey struct {
+	from, to string // dotted paths, e.g. build.image
+}
+
+// renamedKeys lists the keys that have been renamed or moved, oldest first.
+// Files still using an old key load with a warning until Migrate rewrites
+// them; the old key's environment variable keeps working too.
+var renamedKeys = []renamedKey{
+	{from: "build.image", to: "build.docker.image"},
+}
+
+// renames returns renamedKeys with, for keys moved within their section, the
+// same move in each of the section's per-OS tables.
+func renames() []renamedKey {
+	var renames []renamedKey
+	for _, r := range renamedKeys {
+		renames = append(renames, r)
+		section, from, _ := strings.Cut(r.from, ".")
+		toSection, to, _ := strings.Cut(r.to, ".")
+		if section != toSection {
+			continue
+		}
+		for _, goos := range osNames {
+			prefix := section + "." + goos + "."
+			renames = append(renames, renamedKey{from: prefix + from, to: prefix + to})
+		}
+	}
+	return renames
+}
+
+// renamedTo returns the current name of key, which may be under a profile,
+// if it has been renamed.
+func renamedTo(key string) (string, bool) {
+	prefix, rest := "", key
+	if parts := strings.SplitN(key, ".", 3); len(parts) == 3 && parts[0] == "profiles" {
+		prefix, rest = parts[0]+"."+parts[1]+".", parts[2]
+	}
+	for _, r := range renames() {
+		if rest == r.from {
+			return prefix + r.to, true
+		}
+	}
+	return "", false
+}
+
+// migrateTables moves renamed keys in a decoded config file, at the top level
+// and in each profile, to their current names. It returns the keys moved,
+// with their full paths, and fails if a file sets both names.
+func migrateTables(f *configFile, tables map[string]any) ([]renamedKey, error) {
+	prefixes := []string{""}
+	profiles, _ := tables["profiles"].(map[string]any)
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prefixes = append(prefixes, "profiles."+name+".")
+	}
+
+	var moves []renamedKey
+	var errs []error
+	for _, prefix := range prefixes {
+		for _, r := range renames() {
+			m := renamedKey{from: prefix + r.from, to: prefix + r.to}
+			value, ok := lookupTable(tables, m.from)
+			if !ok {
+				continue
+			}
+			if _, ok := lookupTable(tables, m.to); ok {
+				err := fmt.Errorf("%s was renamed to %s, which is also set; remove %s", m.from, m.to, m.from)
+				errs = append(errs, f.at(f.keys[m.from], 0, err))
+				continue
+			}
+			deleteTable(tables, m.from)
+			setTable(tables, m.to, value)
+			moves = append(moves, m)
+		}
+	}
+	return moves, errors.Join(errs...)
+}
+
+// lookupTable returns the value at a dotted key in decoded TOML tables.
+func lookupTable(tables map[string]any, key string) (any, bool) {
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		next, ok := tables[name].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		tables = next
+	}
+	value, ok := tables[path[len(path)-1]]
+	return value, ok
+}
+
+// deleteTable removes a dotted key from decoded TOML tables.
+func deleteTable(tables map[string]any, key string) {
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		next, ok := tables[name].(map[string]any)
+		if !ok {
+			return
+		}
+		tables = next
+	}
+	delete(tables, path[len(path)-1])
+}
+
+// setTable sets a dotted key in decoded TOML tables, creating tables on the
+// way.
+func setTable(tables map[string]any, key string, value any) {
+	path := strings.Split(key, ".")
+	for _, name := range path[:len(path)-1] {
+		next, ok := tables[name].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			tables[name] = next
+		}
+		tables = next
+	}
+	tables[path[len(path)-1]] = value
+}
+
+// renameWarnings describes the renamed keys a config was loaded with, where
+// they were set, and renamed environment variables that are set.
+func renameWarnings(files []*configFile) []string {
+	var warnings []string
+	for _, f := range files {
+		for _, m := range f.renamed {
+			warnings = append(warnings, fmt.Sprintf("%s: %s is now %s; run kbflash config migrate to update the file", f.where(m.from), m.from, m.to))
+		}
+	}
+	for _, r := range renamedKeys {
+		if _, ok := os.LookupEnv(envName(r.from)); ok {
+			warnings = append(warnings, fmt.Sprintf("%s is now %s", envName(r.from), envName(r.to)))
+		}
+	}
+	return warnings
+}
+
+// Migrate rewrites the config file at path (resolved as Load does) and the
+// base configs it extends to use the current names of renamed keys,
+// returning a line per key moved. Comments and layout are kept; the file is
+// left alone if the rewritten text would not decode to the same config.
+func Migrate(path string) ([]string, error) {
+	path, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return migrateFile(path, nil)
+}
+
+func migrateFile(path string, seen []string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	f := newConfigFile(path, data)
+	if err := checkFile(f, data); err != nil {
+		return nil, err
+	}
+	var tables map[string]any
+	if err := toml.Unmarshal(data, &tables); err != nil {
+		return nil, fmt.Errorf("cannot parse config file: %w", err)
+	}
+	moves, err := migrateTables(f, tables)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var changes []string
+	if len(moves) > 0 {
+		lines := f.lines
+		for _, m := range moves {
+			var ok bool
+			if lines, ok = moveKey(lines, m); !ok {
+				return nil, fmt.Errorf("%s: cannot move %s to %s automatically; rename it by hand", f.where(m.from), m.from, m.to)
+			}
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", f.where(m.from), m.from, m.to))
+		}
+
+		migrated := []byte(strings.Join(lines, "\n"))
+		var check map[string]any
+		if err := toml.Unmarshal(migrated, &check); err != nil || !reflect.DeepEqual(pruneTables(check), pruneTables(tables)) {
+			return nil, fmt.Errorf("%s: cannot move renamed keys automatically; rename them by hand:\n%s", path, strings.Join(changes, "\n"))
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+			return nil, fmt.Errorf("cannot write config file: %w", err)
+		}
+	}
+
+	base, ok := tables["extends"].(string)
+	if !ok || base == "" {
+		return changes, nil
+	}
+	base, err = resolveExtends(path, base)
+	if err != nil {
+		return changes, err
+	}
+	abs, _ := filepath.Abs(path)
+	seen = append(seen, abs)
+	if slices.Contains(seen, base) {
+		return changes, fmt.Errorf("invalid config: %s: extends cycle through %s", path, base)
+	}
+	baseChanges, err := migrateFile(base, seen)
+	if err != nil {
+		return changes, fmt.Errorf("extends %s: %w", base, err)
+	}
+	return append(changes, baseChanges...), nil
+}
+
+// moveKey rewrites the line setting m.from to set m.to instead. A key
+// renamed within its table is renamed in place; a key moved to another
+// table is added under that table's header, or a new one at the end.
+func moveKey(lines []string, m renamedKey) ([]string, bool) {
+	n, ok := keyLines(lines)[m.from]
+	if !ok {
+		return nil, false
+	}
+	line := lines[n-1]
+	loc := keyLineRegex.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return nil, false
+	}
+	leaf := m.to[strings.LastIndexByte(m.to, '.')+1:]
+
+	if parentKey(m.from) == parentKey(m.to) {
+		key := line[loc[2]:loc[3]]
+		if i := strings.LastIndexByte(key, '.'); i >= 0 {
+			key = key[:i+1] + leaf
+		} else {
+			key = leaf
+		}
+		lines = slices.Clone(lines)
+		lines[n-1] = line[:loc[2]] + key + line[loc[3]:]
+		return lines, true
+	}
+
+	value := strings.TrimSpace(line[loc[1]:])
+	lines = slices.Delete(slices.Clone(lines), n-1, n)
+	set := leaf + " = " + value
+	table := parentKey(m.to)
+	if header, ok := keyLines(lines)[table]; ok && tableLineRegex.MatchString(lines[header-1]) {
+		return slices.Insert(lines, header, set), true
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return append(lines, "", "["+table+"]", set, ""), true
+}
+
+// pruneTables returns tables without empty tables, which a moved key can
+// leave behind in the decoded config but not in the rewritten text.
+func pruneTables(tables map[string]any) map[string]any {
+	pruned := make(map[string]any, len(tables))
+	for key, value := range tables {
+		if table, ok := value.(map[string]any); ok {
+			table = pruneTables(table)
+			if len(table) == 0 {
+				continue
+			}
+			value = table
+		}
+		pruned[key] = value
+	}
+	return pruned
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_RenamedKey(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build]
+mode = "docker"
+image = "my/zmk:latest"
+board = "nice_nano_v2"
+shield = "corne"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Build.Docker.Image != "my/zmk:latest" {
+		t.Errorf("Build.Docker.Image = %q, want %q", cfg.Build.Docker.Image, "my/zmk:latest")
+	}
+	if len(cfg.Warnings) != 1 {
+		t.Fatalf("Warnings = %q, want one", cfg.Warnings)
+	}
+	if want := path + ":7: build.image is now build.docker.image"; !strings.HasPrefix(cfg.Warnings[0], want) {
+		t.Errorf("Warnings[0] = %q, want prefix %q", cfg.Warnings[0], want)
+	}
+}
+
+func TestLoad_RenamedKeyInProfile(t *testing.T) {
+	content := `
+[device]
+name = "NICENANO"
+
+[profiles.corne.build]
+image = "my/zmk:latest"
+`
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	corne := cfg.Profiles["corne"]
+	if corne.Build.Docker.Image != "my/zmk:latest" {
+		t.Errorf("corne Build.Docker.Image = %q, want %q", corne.Build.Docker.Image, "my/zmk:latest")
+	}
+	if len(corne.Warnings) != 1 || !strings.Contains(corne.Warnings[0], "profiles.corne.build.image is now profiles.corne.build.docker.image") {
+		t.Errorf("corne Warnings = %q", corne.Warnings)
+	}
+}
+
+func TestLoad_RenamedKeyConflict(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[build]
+image = "old/zmk"
+
+[build.docker]
+image = "new/zmk"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for build.image set alongside build.docker.image")
+	}
+	if want := path + ":6: build.image was renamed to build.docker.image"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error missing %q:\n%s", want, err)
+	}
+}
+
+func TestLoad_RenamedEnv(t *testing.T) {
+	content := `
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+	t.Setenv("KBFLASH_BUILD_IMAGE", "env/zmk")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Build.Docker.Image != "env/zmk" {
+		t.Errorf("Build.Docker.Image = %q, want %q", cfg.Build.Docker.Image, "env/zmk")
+	}
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0] != "KBFLASH_BUILD_IMAGE is now KBFLASH_BUILD_DOCKER_IMAGE" {
+		t.Errorf("Warnings = %q", cfg.Warnings)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	content := `[keyboard]
+name = "corne"
+
+[build]
+mode = "docker"
+image = "my/zmk:latest"  # pinned
+board = "nice_nano_v2"
+shield = "corne"
+
+# Keep builds warm
+[build.docker]
+container = "kbflash-corne"
+
+[device]
+name = "NICENANO"
+
+[profiles.lily.build]
+image = "other/zmk"
+`
+	path := writeTempConfig(t, content)
+
+	changes, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("changes = %q, want two", changes)
+	}
+	if want := path + ":6: build.image -> build.docker.image"; changes[0] != want {
+		t.Errorf("changes[0] = %q, want %q", changes[0], want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Keep builds warm\n[build.docker]\nimage = \"my/zmk:latest\"  # pinned\ncontainer",
+		"\n[profiles.lily.build.docker]\nimage = \"other/zmk\"\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("migrated file missing %q:\n%s", want, data)
+		}
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("Warnings = %q, want none after migrating", cfg.Warnings)
+	}
+	if got := cfg.Profiles["lily"].Build.Docker.Image; got != "other/zmk" {
+		t.Errorf("lily Build.Docker.Image = %q, want %q", got, "other/zmk")
+	}
+
+	changes, err = Migrate(path)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("second Migrate() = %q, %v; want no changes", changes, err)
+	}
+}
+
+func TestMigrate_Extends(t *testing.T) {
+	base := writeTempConfig(t, `
+[keyboard]
+name = "corne"
+
+[build]
+image = "my/zmk"
+`)
+	path := writeTempConfig(t, fmt.Sprintf(`
+extends = %q
+
+[device]
+name = "NICENANO"
+`, base))
+	before, _ := os.ReadFile(path)
+
+	changes, err := Migrate(path)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if len(changes) != 1 || !strings.HasPrefix(changes[0], base+":6:") {
+		t.Errorf("changes = %q, want the base's build.image", changes)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("config without renamed keys was rewritten:\n%s", after)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Build.Docker.Image != "my/zmk" || len(cfg.Warnings) != 0 {
+		t.Errorf("after Migrate: image %q, warnings %q", cfg.Build.Docker.Image, cfg.Warnings)
+	}
+}
+
+func TestMigrate_Unmovable(t *testing.T) {
+	content := `
+keyboard = { name = "corne" }
+build = { image = "my/zmk" }
+
+[device]
+name = "NICENANO"
+`
+	path := writeTempConfig(t, content)
+
+	if _, err := Migrate(path); err == nil {
+		t.Fatal("expected error for build.image in an inline table")
+	}
+	if data, _ := os.ReadFile(path); string(data) != content {
+		t.Errorf("file changed after failed Migrate():\n%s", data)
+	}
+}
+
+func TestMigrate_NoConfig(t *testing.T) {
+	if _, err := Migrate(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Fatal("expected error for missing config")
+	}
+}
+
+func TestMoveKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		move  renamedKey
+		want  string
+	}{
+		{
+			name:  "rename in place",
+			lines: "[flash]\n  strategy = \"end\" # sync\n",
+			move:  renamedKey{from: "flash.strategy", to: "flash.write_strategy"},
+			want:  "[flash]\n  write_strategy = \"end\" # sync\n",
+		},
+		{
+			name:  "rename dotted key in place",
+			lines: "flash.strategy = \"end\"\n",
+			move:  renamedKey{from: "flash.strategy", to: "flash.write_strategy"},
+			want:  "flash.write_strategy = \"end\"\n",
+		},
+		{
+			name:  "move under existing header",
+			lines: "[build]\nimage = \"x\"\n\n[build.docker]\ncpus = \"2\"\n",
+			move:  renamedKey{from: "build.image", to: "build.docker.image"},
+			want:  "[build]\n\n[build.docker]\nimage = \"x\"\ncpus = \"2\"\n",
+		},
+		{
+			name:  "move to new table",
+			lines: "[build]\nimage = \"x\"\nboard = \"b\"\n\n",
+			move:  renamedKey{from: "build.image", to: "build.docker.image"},
+			want:  "[build]\nboard = \"b\"\n\n[build.docker]\nimage = \"x\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := moveKey(strings.Split(tt.lines, "\n"), tt.move)
+			if !ok {
+				t.Fatal("moveKey() failed")
+			}
+			if s := strings.Join(got, "\n"); s != tt.want {
+				t.Errorf("moveKey() =\n%q\nwant\n%q", s, tt.want)
+			}
+		})
+	}
+}
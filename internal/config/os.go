@@ -0,0 +1,74 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// osNames are the operating systems a section can be overridden for, named
+// as runtime.GOOS names them. A [device.darwin] table is merged over
+// [device] on macOS and ignored elsewhere, so one config can be shared
+// between machines whose device names and mount paths differ.
+var osNames = []string{"darwin", "linux", "freebsd", "openbsd", "netbsd", "dragonfly"}
+
+// applyOSTables merges each section's table for goos over the section, at
+// the top level and in each profile, and drops the tables for other
+// systems. It reports whether any were found.
+func applyOSTables(tables map[string]any, goos string) bool {
+	found := false
+	scopes := []map[string]any{tables}
+	if profiles, ok := tables["profiles"].(map[string]any); ok {
+		for _, profile := range profiles {
+			if profile, ok := profile.(map[string]any); ok {
+				scopes = append(scopes, profile)
+			}
+		}
+	}
+	for _, scope := range scopes {
+		for name, section := range scope {
+			section, ok := section.(map[string]any)
+			if !ok || name == "profiles" {
+				continue
+			}
+			for _, name := range osNames {
+				override, ok := section[name].(map[string]any)
+				if !ok {
+					continue
+				}
+				found = true
+				delete(section, name)
+				if name == goos {
+					mergeTables(section, override)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// osKey returns key with goos's table inserted after its section, e.g.
+// device.darwin.name for device.name.
+func osKey(key, goos string) string {
+	section, rest, ok := strings.Cut(key, ".")
+	if !ok {
+		return key
+	}
+	return section + "." + goos + "." + rest
+}
+
+// withOSTables returns the struct type of a config section with a table
+// per osNames entry, each holding the section's keys.
+func withOSTables(t reflect.Type) reflect.Type {
+	fields := make([]reflect.StructField, 0, t.NumField()+len(osNames))
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, t.Field(i))
+	}
+	for _, goos := range osNames {
+		fields = append(fields, reflect.StructField{
+			Name: strings.ToUpper(goos[:1]) + goos[1:],
+			Type: t,
+			Tag:  reflect.StructTag(`toml:"` + goos + `"`),
+		})
+	}
+	return reflect.StructOf(fields)
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// otherOS returns an OS name from osNames that is not the one running.
+func otherOS() string {
+	for _, goos := range osNames {
+		if goos != runtime.GOOS {
+			return goos
+		}
+	}
+	return ""
+}
+
+func TestLoad_OSTables(t *testing.T) {
+	content := fmt.Sprintf(`
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+poll_interval = "200ms"
+
+[device.%s]
+name = "THISOS"
+mount_paths = ["/this"]
+
+[device.%s]
+name = "OTHEROS"
+`, runtime.GOOS, otherOS())
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Device.Name != "THISOS" {
+		t.Errorf("Device.Name = %q, want %q", cfg.Device.Name, "THISOS")
+	}
+	if len(cfg.Device.MountPaths) != 1 || cfg.Device.MountPaths[0] != "/this" {
+		t.Errorf("Device.MountPaths = %v, want [/this]", cfg.Device.MountPaths)
+	}
+	if got := time.Duration(cfg.Device.PollInterval); got != 200*time.Millisecond {
+		t.Errorf("Device.PollInterval = %v, want the base section's 200ms", got)
+	}
+}
+
+func TestLoad_OSTablesInProfile(t *testing.T) {
+	content := fmt.Sprintf(`
+[device]
+name = "NICENANO"
+
+[profiles.corne.device.%s]
+name = "CORNE"
+
+[profiles.lily]
+`, runtime.GOOS)
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Profiles["corne"].Device.Name; got != "CORNE" {
+		t.Errorf("corne Device.Name = %q, want %q", got, "CORNE")
+	}
+	if got := cfg.Profiles["lily"].Device.Name; got != "NICENANO" {
+		t.Errorf("lily Device.Name = %q, want %q", got, "NICENANO")
+	}
+}
+
+func TestLoad_OSTablesExtends(t *testing.T) {
+	base := writeTempConfig(t, fmt.Sprintf(`
+[keyboard]
+name = "corne"
+
+[device.%s]
+name = "BASE"
+mount_paths = ["/base"]
+`, runtime.GOOS))
+	path := writeTempConfig(t, fmt.Sprintf(`
+extends = %q
+
+[device]
+name = "LOCAL"
+`, base))
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// Each file's OS tables are merged before extends, so this file wins
+	if cfg.Device.Name != "LOCAL" {
+		t.Errorf("Device.Name = %q, want %q", cfg.Device.Name, "LOCAL")
+	}
+	if len(cfg.Device.MountPaths) != 1 || cfg.Device.MountPaths[0] != "/base" {
+		t.Errorf("Device.MountPaths = %v, want [/base]", cfg.Device.MountPaths)
+	}
+}
+
+func TestLoad_OSTableUnknownKey(t *testing.T) {
+	content := fmt.Sprintf(`
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[device.%s]
+mount_path = ["/mnt"]
+`, otherOS())
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown key in an OS table")
+	}
+	want := fmt.Sprintf("%s:9:1: unknown key device.%s.mount_path, did you mean mount_paths?", path, otherOS())
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("error missing %q:\n%s", want, err)
+	}
+}
+
+func TestLoad_OSTableValidationLine(t *testing.T) {
+	content := fmt.Sprintf(`
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+profile = "auto"
+
+[device.%s]
+profile = "unknown"
+`, runtime.GOOS)
+	path := writeTempConfig(t, content)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected error for unknown device.profile")
+	}
+	if want := path + ":10: device.profile"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error missing %q:\n%s", want, err)
+	}
+}
+
+func TestApplyOSTables(t *testing.T) {
+	tables := map[string]any{
+		"device": map[string]any{
+			"name":   "BASE",
+			"darwin": map[string]any{"name": "MAC"},
+			"linux":  map[string]any{"name": "LINUX", "auto_mount": false},
+		},
+		"keyboard": map[string]any{"name": "corne"},
+	}
+	if !applyOSTables(tables, "linux") {
+		t.Fatal("applyOSTables() = false, want true")
+	}
+	device := tables["device"].(map[string]any)
+	if device["name"] != "LINUX" || device["auto_mount"] != false {
+		t.Errorf("device = %v, want the linux table merged", device)
+	}
+	if _, ok := device["darwin"]; ok {
+		t.Error("darwin table not dropped")
+	}
+
+	if applyOSTables(map[string]any{"device": map[string]any{"name": "X"}}, "linux") {
+		t.Error("applyOSTables() = true for a config without OS tables")
+	}
+}
+
+func TestSchema_OSTables(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	var schema schemaNode
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	darwin := schema.Properties["device"].Properties["darwin"]
+	if darwin == nil || darwin.Properties["name"] == nil {
+		t.Fatalf("device.darwin missing from schema or without keys: %+v", darwin)
+	}
+	if darwin.Properties["poll_interval"].Default != nil {
+		t.Error("OS table keys should not carry defaults")
+	}
+}
+
+func TestLoad_RenamedKeyInOSTable(t *testing.T) {
+	content := fmt.Sprintf(`
+[keyboard]
+name = "corne"
+
+[device]
+name = "NICENANO"
+
+[build.%s]
+image = "local/zmk"
+`, runtime.GOOS)
+	path := writeTempConfig(t, content)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Build.Docker.Image != "local/zmk" {
+		t.Errorf("Build.Docker.Image = %q, want %q", cfg.Build.Docker.Image, "local/zmk")
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "build."+runtime.GOOS+".image is now build."+runtime.GOOS+".docker.image") {
+		t.Errorf("Warnings = %q", cfg.Warnings)
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaDialect is the JSON Schema draft Schema is written in.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations Duration parses, such as "2s" or "1m30s".
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaNode is one JSON Schema keyword set, for a table or a key.
+type schemaNode struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Items                *schemaNode            `json:"items,omitempty"`
+	Properties           map[string]*schemaNode `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"` // false or a *schemaNode
+}
+
+// Schema returns a JSON Schema describing the config file, generated from
+// the config structs' toml, doc and enum tags, with the defaults
+// applyDefaults fills in. Editors and taplo use it to complete and check
+// config files; unknown keys are flagged.
+func Schema() ([]byte, error) {
+	defaults := &Config{}
+	applyDefaults(defaults)
+
+	root := structSchema(reflect.TypeOf(*defaults), reflect.ValueOf(*defaults))
+	root.Schema = SchemaDialect
+	root.Title = "kbflash configuration"
+	// Per-OS tables take their section's keys, without defaults of their own
+	t := reflect.TypeOf(*defaults)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		section, ok := root.Properties[f.Tag.Get("toml")]
+		if !ok || f.Type.Kind() != reflect.Struct {
+			continue
+		}
+		for _, goos := range osNames {
+			node := structSchema(f.Type, reflect.Value{})
+			node.Description = "Overrides applied on " + goos
+			section.Properties[goos] = node
+		}
+	}
+	root.Properties["extends"] = &schemaNode{
+		Type:        "string",
+		Description: "Base config whose tables are merged underneath this file's",
+	}
+	root.Properties["profiles"] = &schemaNode{
+		Type:                 "object",
+		Description:          "Keyboard profiles by name, each overriding the sections above",
+		AdditionalProperties: &schemaNode{Ref: "#"},
+	}
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// structSchema describes a config table, defaults holding its default values.
+func structSchema(t reflect.Type, defaults reflect.Value) *schemaNode {
+	node := &schemaNode{
+		Type:                 "object",
+		Properties:           make(map[string]*schemaNode),
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("toml")
+		if key == "" || key == "-" {
+			continue
+		}
+		var value reflect.Value
+		if defaults.IsValid() {
+			value = defaults.Field(i)
+		}
+
+		prop := typeSchema(f.Type, value)
+		prop.Description = f.Tag.Get("doc")
+		if enum := f.Tag.Get("enum"); enum != "" {
+			values := strings.Split(enum, ",")
+			if prop.Items != nil {
+				prop.Items.Enum = values
+			} else {
+				prop.Enum = values
+			}
+		}
+		node.Properties[key] = prop
+	}
+	return node
+}
+
+// typeSchema describes a value of type t, with value as its default unless
+// that is the zero value.
+func typeSchema(t reflect.Type, value reflect.Value) *schemaNode {
+	hasDefault := value.IsValid() && !value.IsZero()
+
+	if t == reflect.TypeOf(Duration(0)) {
+		node := &schemaNode{Type: "string", Pattern: durationPattern}
+		if hasDefault {
+			node.Default = time.Duration(value.Int()).String()
+		}
+		return node
+	}
+
+	var node *schemaNode
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, value)
+	case reflect.Pointer:
+		// Optional values whose default is applied where they are read
+		return typeSchema(t.Elem(), reflect.Value{})
+	case reflect.Map:
+		return &schemaNode{Type: "object", AdditionalProperties: typeSchema(t.Elem(), reflect.Value{})}
+	case reflect.Slice:
+		node = &schemaNode{Type: "array", Items: typeSchema(t.Elem(), reflect.Value{})}
+	case reflect.String:
+		node = &schemaNode{Type: "string"}
+	case reflect.Bool:
+		node = &schemaNode{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		// Every count and size in the config is validated as positive
+		minimum := 0
+		node = &schemaNode{Type: "integer", Minimum: &minimum}
+	default:
+		node = &schemaNode{}
+	}
+	if hasDefault {
+		node.Default = value.Interface()
+	}
+	return node
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+	if schema["$schema"] != SchemaDialect {
+		t.Errorf("$schema = %v", schema["$schema"])
+	}
+
+	prop := func(path string) map[string]any {
+		t.Helper()
+		node := schema
+		for _, key := range strings.Split(path, ".") {
+			props, _ := node["properties"].(map[string]any)
+			next, ok := props[key].(map[string]any)
+			if !ok {
+				t.Fatalf("schema has no %s", path)
+			}
+			node = next
+		}
+		return node
+	}
+
+	mode := prop("flash.mode")
+	if mode["type"] != "string" || !reflect.DeepEqual(mode["enum"], []any{"copy", "dfu", "qmk"}) {
+		t.Errorf("flash.mode = %v", mode)
+	}
+	if mode["default"] != "copy" || mode["description"] == "" {
+		t.Errorf("flash.mode default/description = %v", mode)
+	}
+	if poll := prop("device.poll_interval"); poll["default"] != "100ms" || poll["pattern"] == nil {
+		t.Errorf("device.poll_interval = %v", poll)
+	}
+	if stale := prop("build.stale_days"); stale["type"] != "integer" || stale["default"] != float64(DefaultStaleDays) {
+		t.Errorf("build.stale_days = %v", stale)
+	}
+	formats := prop("build.dir_formats")
+	if items, _ := formats["items"].(map[string]any); !reflect.DeepEqual(items["enum"], []any{"date", "iso-date", "semver", "hash"}) {
+		t.Errorf("build.dir_formats items = %v", formats["items"])
+	}
+	if targets := prop("build.targets"); targets["type"] != "object" {
+		t.Errorf("build.targets = %v", targets)
+	} else if side, _ := targets["additionalProperties"].(map[string]any); side["properties"] == nil {
+		t.Errorf("build.targets sides have no properties: %v", targets)
+	}
+	if prop("build")["additionalProperties"] != false {
+		t.Error("unknown keys in [build] should be flagged")
+	}
+	if profiles := prop("profiles"); profiles["additionalProperties"].(map[string]any)["$ref"] != "#" {
+		t.Errorf("profiles = %v", profiles)
+	}
+}
+
+// Every key needs a doc tag for the schema, and enum tags must list
+// values validate accepts.
+func TestSchema_Tags(t *testing.T) {
+	var walk func(t *testing.T, typ reflect.Type, prefix string)
+	walk = func(t *testing.T, typ reflect.Type, prefix string) {
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			key := f.Tag.Get("toml")
+			if key == "" || key == "-" {
+				continue
+			}
+			if f.Tag.Get("doc") == "" {
+				t.Errorf("%s%s has no doc tag", prefix, key)
+			}
+			ft := f.Type
+			for ft.Kind() == reflect.Map || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(Config{}) {
+				walk(t, ft, prefix+key+".")
+			}
+		}
+	}
+	walk(t, reflect.TypeOf(Config{}), "")
+
+	// A config using every enum value of flash.write_strategy is valid
+	for _, strategy := range strings.Split(fieldTag(t, reflect.TypeOf(FlashConfig{}), "WriteStrategy", "enum"), ",") {
+		cfg := &Config{Keyboard: KeyboardConfig{Name: "corne"}, Device: DeviceConfig{Name: "NICENANO"}}
+		cfg.Flash.WriteStrategy = strategy
+		applyDefaults(cfg)
+		if err := validate(cfg); err != nil {
+			t.Errorf("write_strategy %q: %v", strategy, err)
+		}
+	}
+	if formats := strings.Split(fieldTag(t, reflect.TypeOf(BuildConfig{}), "DirFormats", "enum"), ","); !slices.Equal(formats, DefaultDirFormats) {
+		t.Errorf("dir_formats enum = %v, want %v", formats, DefaultDirFormats)
+	}
+}
+
+func fieldTag(t *testing.T, typ reflect.Type, field, tag string) string {
+	t.Helper()
+	f, ok := typ.FieldByName(field)
+	if !ok {
+		t.Fatalf("no field %s", field)
+	}
+	return f.Tag.Get(tag)
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package device
+
+import "golang.org/x/sys/unix"
+
+// accessible returns an error if this user cannot list and write the
+// directory at path
+func accessible(path string) error {
+	return unix.Access(path, unix.R_OK|unix.W_OK|unix.X_OK)
+}
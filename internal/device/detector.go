@@ -2,6 +2,11 @@ package device
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
 	"time"
 )
 
@@ -9,12 +14,135 @@ import (
 type Event struct {
 	Connected bool
 	Path      string
+
+	// Volume metadata for connected devices, filled in as far as the
+	// platform can tell; zero values are unknown.
+	Label    string
+	FSType   string
+	Capacity int64  // bytes
+	Serial   string // USB serial number
+
+	// Err is set on a disconnected event when the volume is mounted but
+	// kbflash cannot use it, wrapping ErrUnreadable with what to do about it
+	Err error
+}
+
+// ErrUnreadable is wrapped by Event.Err when the bootloader volume is
+// mounted but this user may not read or write it, as when root mounted it
+// without udisks.
+var ErrUnreadable = errors.New("mounted but unreadable")
+
+// DeviceInfo describes a mounted removable volume, filled in as far as the
+// platform can tell; zero values are unknown.
+type DeviceInfo struct {
+	Path     string // mount point
+	Label    string
+	FSType   string
+	Capacity int64  // bytes
+	Serial   string // USB serial number
 }
 
+// labelCacheTTL limits how often the slow volume listings of lsblk and
+// diskutil are run while polling.
+const labelCacheTTL = time.Second
+
+// RebootTimeout is how long a bootloader volume may stay mounted after a
+// flash; one still mounted after this usually means the flash didn't take.
+const RebootTimeout = 10 * time.Second
+
 // Detector watches for device connection/disconnection.
 type Detector interface {
 	// Detect starts watching for the named volume and sends events on state changes.
 	// Returns a channel that emits events when device connects or disconnects.
 	// The channel is closed when the context is cancelled.
 	Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan Event
+
+	// List returns the removable volumes mounted right now, for one-off
+	// lookups that don't need to watch for changes.
+	List(ctx context.Context) ([]DeviceInfo, error)
+}
+
+// Options configures platform detectors.
+type Options struct {
+	// MountPaths are parent directories where bootloader volumes appear,
+	// checked in order. $USER and other environment variables are expanded.
+	// Empty uses the platform defaults.
+	MountPaths []string
+
+	// WSLPowerShell looks up Windows drive letters by volume label with
+	// powershell.exe when running under WSL.
+	WSLPowerShell bool
+
+	// AutoMount mounts the bootloader with udisksctl on Linux when its block
+	// device appears without anything mounting it.
+	AutoMount bool
+}
+
+// New returns a Detector for the current platform with default options.
+func New() Detector {
+	return NewWithOptions(Options{})
+}
+
+// checkAccess returns an error if the volume mounted at path cannot be
+// listed and written by this user. Tests replace it.
+var checkAccess = accessible
+
+// usable reports whether a volume found at path can be flashed. One this
+// user cannot use is not connected, and comes with an error wrapping
+// ErrUnreadable that says what to do.
+func usable(found bool, path string) (bool, error) {
+	if !found {
+		return false, nil
+	}
+	if err := checkAccess(path); err != nil {
+		return false, fmt.Errorf("%s is %w: %s", path, ErrUnreadable, accessHint)
+	}
+	return true, nil
+}
+
+// listMountPaths returns every directory under the mount paths as a volume
+// named after it, for platforms without a volume listing to ask.
+func listMountPaths(mountPaths []string) []DeviceInfo {
+	var volumes []DeviceInfo
+	for _, mp := range mountPaths {
+		dir := expandPath(mp)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				volumes = append(volumes, DeviceInfo{Path: filepath.Join(dir, e.Name()), Label: e.Name()})
+			}
+		}
+	}
+	return volumes
+}
+
+// expandPath expands environment variables in p, resolving $USER even
+// when the variable is unset.
+func expandPath(p string) string {
+	return os.Expand(p, func(key string) string {
+		if key == "USER" {
+			return getUsername()
+		}
+		return os.Getenv(key)
+	})
+}
+
+// getUsername returns the current username, trying multiple methods.
+func getUsername() string {
+	// Try USER env var first (most common)
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	// Try LOGNAME as fallback
+	if u := os.Getenv("LOGNAME"); u != "" {
+		return u
+	}
+	// Last resort: use os/user package
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
 }
@@ -0,0 +1,191 @@
+//go:build freebsd || openbsd || netbsd || dragonfly
+
+package device
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultBSDMountPaths covers automount(8)/dsbmd media mounts and manual /mnt mounts.
+var defaultBSDMountPaths = []string{"/media", "/mnt"}
+
+// accessHint is what to do about a volume mounted without access, usually
+// by root with mount_msdosfs defaults.
+const accessHint = "mount it with -u and -g set to your user, or through automount"
+
+type bsdDetector struct {
+	mountPaths []string
+}
+
+// NewWithOptions returns a Detector for the BSDs.
+func NewWithOptions(opts Options) Detector {
+	mountPaths := opts.MountPaths
+	if len(mountPaths) == 0 {
+		mountPaths = defaultBSDMountPaths
+	}
+	return &bsdDetector{mountPaths: mountPaths}
+}
+
+func (d *bsdDetector) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		var paths []string
+		for _, mp := range d.mountPaths {
+			paths = append(paths, filepath.Join(expandPath(mp), volumeName))
+		}
+
+		var lastConnected, lastUnreadable bool
+		var lastPath string
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		// Check immediately on start
+		connected, path := d.findDevice(volumeName, paths)
+		connected, err := usable(connected, path)
+		lastConnected = connected
+		lastPath = path
+		lastUnreadable = err != nil
+		select {
+		case events <- d.event(volumeName, connected, path, err):
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				connected, path := d.findDevice(volumeName, paths)
+				connected, err := usable(connected, path)
+				if connected != lastConnected || path != lastPath || (err != nil) != lastUnreadable {
+					lastConnected = connected
+					lastPath = path
+					lastUnreadable = err != nil
+					select {
+					case events <- d.event(volumeName, connected, path, err):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// event describes a detection result; only the label is known here.
+func (d *bsdDetector) event(volumeName string, connected bool, path string, err error) Event {
+	if !connected {
+		return Event{Path: path, Err: err}
+	}
+	return Event{Connected: true, Path: path, Label: volumeName}
+}
+
+func (d *bsdDetector) findDevice(volumeName string, paths []string) (bool, string) {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return true, p
+		}
+	}
+	// Fall back to the mount table (volumes mounted by device name, e.g. /media/da0)
+	out, err := exec.Command("mount").Output()
+	if err == nil {
+		if p := findInMountOutput(out, volumeName); p != "" {
+			return true, p
+		}
+	}
+	// Return first path as the expected location when not connected
+	if len(paths) > 0 {
+		return false, paths[0]
+	}
+	return false, ""
+}
+
+// List returns the volumes mounted under the mount paths, labelled with
+// their glabel name where FreeBSD has one.
+func (d *bsdDetector) List(ctx context.Context) ([]DeviceInfo, error) {
+	out, err := exec.CommandContext(ctx, "mount").Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return listMountPaths(d.mountPaths), nil
+	}
+	var roots []string
+	for _, mp := range d.mountPaths {
+		roots = append(roots, expandPath(mp))
+	}
+	return listMountOutput(out, roots), nil
+}
+
+// listMountOutput returns the mounts in mount(8) output whose mount point
+// is directly under one of roots.
+func listMountOutput(out []byte, roots []string) []DeviceInfo {
+	var volumes []DeviceInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		dev, mountPoint, ok := parseMountLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		for _, root := range roots {
+			if filepath.Dir(mountPoint) != filepath.Clean(root) {
+				continue
+			}
+			label := filepath.Base(mountPoint)
+			if name, ok := strings.CutPrefix(dev, "/dev/msdosfs/"); ok {
+				label = name
+			}
+			volumes = append(volumes, DeviceInfo{Path: mountPoint, Label: label})
+			break
+		}
+	}
+	return volumes
+}
+
+// findInMountOutput searches mount(8) output for the volume. Matches a
+// FreeBSD glabel device (/dev/msdosfs/<label>) or a mount point named after
+// the volume.
+func findInMountOutput(out []byte, volumeName string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		dev, mountPoint, ok := parseMountLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if dev == "/dev/msdosfs/"+volumeName || filepath.Base(mountPoint) == volumeName {
+			return mountPoint
+		}
+	}
+	return ""
+}
+
+// parseMountLine splits a mount(8) line into its device and mount point.
+// Handles both the FreeBSD "dev on mnt (type, ...)" and the OpenBSD
+// "dev on mnt type fs (...)" formats.
+func parseMountLine(line string) (dev, mountPoint string, ok bool) {
+	dev, mountPoint, ok = strings.Cut(line, " on ")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.Index(mountPoint, " ("); i >= 0 {
+		mountPoint = mountPoint[:i]
+	}
+	if i := strings.Index(mountPoint, " type "); i >= 0 {
+		mountPoint = mountPoint[:i]
+	}
+	return dev, mountPoint, true
+}
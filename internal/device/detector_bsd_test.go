@@ -0,0 +1,55 @@
+//go:build freebsd || openbsd || netbsd || dragonfly
+
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindInMountOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "freebsd glabel device",
+			output: "/dev/ada0p2 on / (ufs, local)\n/dev/msdosfs/NICENANO on /media/da0 (msdosfs, local, nosuid)\n",
+			want:   "/media/da0",
+		},
+		{
+			name:   "openbsd mount point",
+			output: "/dev/sd0a on / type ffs (local)\n/dev/sd1i on /mnt/NICENANO type msdos (local, nodev, nosuid)\n",
+			want:   "/mnt/NICENANO",
+		},
+		{
+			name:   "not mounted",
+			output: "/dev/ada0p2 on / (ufs, local)\n",
+			want:   "",
+		},
+	}
+
+	for _, tc := range tests {
+		got := findInMountOutput([]byte(tc.output), "NICENANO")
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestListMountOutput(t *testing.T) {
+	output := "/dev/ada0p2 on / (ufs, local)\n" +
+		"/dev/msdosfs/NICENANO on /media/da0 (msdosfs, local, nosuid)\n" +
+		"/dev/sd1i on /mnt/KEEBART type msdos (local, nodev, nosuid)\n" +
+		"/dev/sd2i on /mnt/a/b type msdos (local)\n"
+
+	got := listMountOutput([]byte(output), []string{"/media", "/mnt/"})
+	want := []DeviceInfo{
+		{Path: "/media/da0", Label: "NICENANO"},
+		{Path: "/mnt/KEEBART", Label: "KEEBART"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listMountOutput = %+v, want %+v", got, want)
+	}
+}
@@ -6,14 +6,30 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
-type darwinDetector struct{}
+// accessHint is what to do about a volume the user may not use, usually
+// the terminal lacking macOS's permission for removable volumes.
+const accessHint = "allow your terminal access to removable volumes in System Settings > Privacy & Security"
 
-// New returns a Detector for macOS.
-func New() Detector {
-	return &darwinDetector{}
+type darwinDetector struct {
+	mountPaths []string
+
+	// diskutil volume listing, cached for labelCacheTTL
+	mu        sync.Mutex
+	volumes   []volume
+	volumesAt time.Time
+}
+
+// NewWithOptions returns a Detector for macOS.
+func NewWithOptions(opts Options) Detector {
+	mountPaths := opts.MountPaths
+	if len(mountPaths) == 0 {
+		mountPaths = []string{"/Volumes"}
+	}
+	return &darwinDetector{mountPaths: mountPaths}
 }
 
 func (d *darwinDetector) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan Event {
@@ -22,17 +38,25 @@ func (d *darwinDetector) Detect(ctx context.Context, volumeName string, pollInte
 	go func() {
 		defer close(events)
 
-		path := filepath.Join("/Volumes", volumeName)
-		var lastConnected bool
+		var paths []string
+		for _, mp := range d.mountPaths {
+			paths = append(paths, filepath.Join(expandPath(mp), volumeName))
+		}
+
+		var lastConnected, lastUnreadable bool
+		var lastPath string
 
 		ticker := time.NewTicker(pollInterval)
 		defer ticker.Stop()
 
 		// Check immediately on start
-		connected := d.exists(path)
+		connected, path := d.findDevice(volumeName, paths)
+		connected, err := usable(connected, path)
 		lastConnected = connected
+		lastPath = path
+		lastUnreadable = err != nil
 		select {
-		case events <- Event{Connected: connected, Path: path}:
+		case events <- d.event(volumeName, connected, path, err):
 		case <-ctx.Done():
 			return
 		}
@@ -42,11 +66,14 @@ func (d *darwinDetector) Detect(ctx context.Context, volumeName string, pollInte
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				connected := d.exists(path)
-				if connected != lastConnected {
+				connected, path := d.findDevice(volumeName, paths)
+				connected, err := usable(connected, path)
+				if connected != lastConnected || path != lastPath || (err != nil) != lastUnreadable {
 					lastConnected = connected
+					lastPath = path
+					lastUnreadable = err != nil
 					select {
-					case events <- Event{Connected: connected, Path: path}:
+					case events <- d.event(volumeName, connected, path, err):
 					case <-ctx.Done():
 						return
 					}
@@ -58,7 +85,20 @@ func (d *darwinDetector) Detect(ctx context.Context, volumeName string, pollInte
 	return events
 }
 
-func (d *darwinDetector) exists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
+// findDevice looks the volume up by label with diskutil, which also finds
+// renamed mounts like "/Volumes/NICENANO 1", then falls back to the mount paths.
+func (d *darwinDetector) findDevice(volumeName string, paths []string) (bool, string) {
+	if p := d.findByLabel(volumeName); p != "" {
+		return true, p
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return true, p
+		}
+	}
+	// Return first path as the expected location when not connected
+	if len(paths) > 0 {
+		return false, paths[0]
+	}
+	return false, ""
 }
@@ -3,18 +3,54 @@
 package device
 
 import (
+	"bufio"
 	"context"
 	"os"
-	"os/user"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
-type linuxDetector struct{}
+// defaultLinuxMountPaths are where udisks2 automounts removable volumes.
+var defaultLinuxMountPaths = []string{"/run/media/$USER", "/media/$USER"}
 
-// New returns a Detector for Linux.
-func New() Detector {
-	return &linuxDetector{}
+// accessHint is what to do about a volume mounted without access, usually
+// by root through fstab or a plain mount rather than udisks.
+const accessHint = "run kbflash setup-udev --install, or let udisks mount it"
+
+type linuxDetector struct {
+	mountPaths []string
+	procMounts string // mount table consulted when no mount path matches
+
+	// WSL: Windows drives are mounted at <wslMountRoot>/<letter>
+	wsl           bool
+	wslMountRoot  string
+	wslPowerShell bool
+	driveLetters  map[string]driveLetter // recent lookups by label, guarded by mu
+
+	// Mount labelled but unmounted block devices with udisksctl
+	autoMount  bool
+	mu         sync.Mutex
+	mountTried map[string]bool // device paths already tried while present
+	devices    []blockDevice   // lsblk listing, see blockDevices
+	devicesAt  time.Time
+}
+
+// NewWithOptions returns a Detector for Linux.
+func NewWithOptions(opts Options) Detector {
+	mountPaths := opts.MountPaths
+	if len(mountPaths) == 0 {
+		mountPaths = defaultLinuxMountPaths
+	}
+	return &linuxDetector{
+		mountPaths:    mountPaths,
+		procMounts:    "/proc/mounts",
+		wsl:           isWSL(),
+		wslMountRoot:  "/mnt",
+		wslPowerShell: opts.WSLPowerShell,
+		autoMount:     opts.AutoMount,
+	}
 }
 
 func (d *linuxDetector) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan Event {
@@ -23,24 +59,25 @@ func (d *linuxDetector) Detect(ctx context.Context, volumeName string, pollInter
 	go func() {
 		defer close(events)
 
-		username := getUsername()
-		paths := []string{
-			filepath.Join("/run/media", username, volumeName),
-			filepath.Join("/media", username, volumeName),
+		var paths []string
+		for _, mp := range d.mountPaths {
+			paths = append(paths, filepath.Join(expandPath(mp), volumeName))
 		}
 
-		var lastConnected bool
+		var lastConnected, lastUnreadable bool
 		var lastPath string
 
 		ticker := time.NewTicker(pollInterval)
 		defer ticker.Stop()
 
 		// Check immediately on start
-		connected, path := d.findDevice(paths)
+		connected, path := d.findDevice(volumeName, paths)
+		connected, err := usable(connected, path)
 		lastConnected = connected
 		lastPath = path
+		lastUnreadable = err != nil
 		select {
-		case events <- Event{Connected: connected, Path: path}:
+		case events <- d.event(volumeName, connected, path, err):
 		case <-ctx.Done():
 			return
 		}
@@ -50,12 +87,14 @@ func (d *linuxDetector) Detect(ctx context.Context, volumeName string, pollInter
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				connected, path := d.findDevice(paths)
-				if connected != lastConnected || path != lastPath {
+				connected, path := d.findDevice(volumeName, paths)
+				connected, err := usable(connected, path)
+				if connected != lastConnected || path != lastPath || (err != nil) != lastUnreadable {
 					lastConnected = connected
 					lastPath = path
+					lastUnreadable = err != nil
 					select {
-					case events <- Event{Connected: connected, Path: path}:
+					case events <- d.event(volumeName, connected, path, err):
 					case <-ctx.Done():
 						return
 					}
@@ -67,12 +106,28 @@ func (d *linuxDetector) Detect(ctx context.Context, volumeName string, pollInter
 	return events
 }
 
-func (d *linuxDetector) findDevice(paths []string) (bool, string) {
+// findDevice looks the volume up by filesystem label first, then falls back
+// to the mount paths, WSL drives and the mount table when lsblk is unavailable.
+func (d *linuxDetector) findDevice(volumeName string, paths []string) (bool, string) {
+	if !d.wsl {
+		if p := d.findByLabel(volumeName); p != "" {
+			return true, p
+		}
+	}
 	for _, p := range paths {
 		if _, err := os.Stat(p); err == nil {
 			return true, p
 		}
 	}
+	if d.wsl {
+		if p := d.findWSLDrive(volumeName); p != "" {
+			return true, p
+		}
+	}
+	// Fall back to any mount point named after the volume (devmon, /mnt, ...)
+	if p := d.findInMountTable(volumeName); p != "" {
+		return true, p
+	}
 	// Return first path as the expected location when not connected
 	if len(paths) > 0 {
 		return false, paths[0]
@@ -80,19 +135,47 @@ func (d *linuxDetector) findDevice(paths []string) (bool, string) {
 	return false, ""
 }
 
-// getUsername returns the current username, trying multiple methods.
-func getUsername() string {
-	// Try USER env var first (most common)
-	if u := os.Getenv("USER"); u != "" {
-		return u
-	}
-	// Try LOGNAME as fallback
-	if u := os.Getenv("LOGNAME"); u != "" {
-		return u
+// findInMountTable returns the first mount point in the mount table whose
+// directory name is volumeName, ignoring case, or "" if none.
+func (d *linuxDetector) findInMountTable(volumeName string) string {
+	f, err := os.Open(d.procMounts)
+	if err != nil {
+		return ""
 	}
-	// Last resort: use os/user package
-	if u, err := user.Current(); err == nil {
-		return u.Username
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// device mountpoint fstype options dump pass
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mountPoint := unescapeMountField(fields[1])
+		if strings.EqualFold(filepath.Base(mountPoint), volumeName) {
+			return mountPoint
+		}
 	}
 	return ""
 }
+
+// unescapeMountField decodes the octal escapes (\040 for space etc.) used in /proc/mounts.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
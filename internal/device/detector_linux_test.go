@@ -0,0 +1,339 @@
+//go:build linux
+
+package device
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLinuxDetector_CustomMountPaths(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("KBFLASH_TEST_MNT", baseDir)
+
+	volumePath := filepath.Join(baseDir, "NICENANO")
+	if err := os.Mkdir(volumePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	detector := NewWithOptions(Options{
+		MountPaths: []string{"/nonexistent/$USER", "$KBFLASH_TEST_MNT"},
+	}).(*linuxDetector)
+	detector.procMounts = filepath.Join(baseDir, "mounts")
+
+	paths := []string{
+		filepath.Join(expandPath(detector.mountPaths[0]), "NICENANO"),
+		filepath.Join(expandPath(detector.mountPaths[1]), "NICENANO"),
+	}
+	connected, path := detector.findDevice("NICENANO", paths)
+	if !connected {
+		t.Fatal("expected device found under custom mount path")
+	}
+	if path != volumePath {
+		t.Errorf("path = %q, want %q", path, volumePath)
+	}
+}
+
+func TestLinuxDetector_MountTableFallback(t *testing.T) {
+	baseDir := t.TempDir()
+	mounts := filepath.Join(baseDir, "mounts")
+	table := "sysfs /sys sysfs rw 0 0\n" +
+		"/dev/sdb /mnt/usb\\040drive/NICENANO vfat rw 0 0\n"
+	if err := os.WriteFile(mounts, []byte(table), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	detector := &linuxDetector{procMounts: mounts}
+
+	connected, path := detector.findDevice("NICENANO", []string{"/nonexistent/NICENANO"})
+	if !connected {
+		t.Fatal("expected device found via mount table")
+	}
+	if path != "/mnt/usb drive/NICENANO" {
+		t.Errorf("path = %q, want unescaped mount point", path)
+	}
+
+	connected, path = detector.findDevice("RPI-RP2", []string{"/nonexistent/RPI-RP2"})
+	if connected {
+		t.Error("expected no match for unmounted volume")
+	}
+	if path != "/nonexistent/RPI-RP2" {
+		t.Errorf("path = %q, want first candidate", path)
+	}
+}
+
+func TestLinuxDetector_WSLInfoFile(t *testing.T) {
+	mntRoot := t.TempDir()
+	for _, letter := range []string{"c", "d"} {
+		if err := os.Mkdir(filepath.Join(mntRoot, letter), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info := "UF2 Bootloader 0.6.0\nModel: nice!nano\nBoard-ID: nRF52840-nicenano\n"
+	if err := os.WriteFile(filepath.Join(mntRoot, "d", "INFO_UF2.TXT"), []byte(info), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	detector := &linuxDetector{
+		procMounts:   filepath.Join(mntRoot, "mounts"),
+		wsl:          true,
+		wslMountRoot: mntRoot,
+	}
+
+	connected, path := detector.findDevice("NICENANO", []string{"/nonexistent/NICENANO"})
+	if !connected {
+		t.Fatal("expected UF2 drive found under WSL mount root")
+	}
+	if path != filepath.Join(mntRoot, "d") {
+		t.Errorf("path = %q, want %q", path, filepath.Join(mntRoot, "d"))
+	}
+
+	// Another bootloader's drive is not taken for this one
+	if connected, _ := detector.findDevice("RPI-RP2", []string{"/nonexistent/RPI-RP2"}); connected {
+		t.Error("a UF2 drive that does not mention RPI-RP2 matched it")
+	}
+}
+
+func TestLinuxDetector_WSLPowerShell(t *testing.T) {
+	mntRoot := t.TempDir()
+	if err := os.Mkdir(filepath.Join(mntRoot, "e"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake powershell.exe that reports drive E for the label
+	binDir := t.TempDir()
+	calls := filepath.Join(binDir, "calls")
+	script := "#!/bin/sh\necho >> " + calls + "\ncase \"$*\" in *\"'NICENANO'\"*) echo E ;; esac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "powershell.exe"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	detector := &linuxDetector{
+		wsl:           true,
+		wslMountRoot:  mntRoot,
+		wslPowerShell: true,
+	}
+
+	if got := detector.findWSLDrive("NICENANO"); got != filepath.Join(mntRoot, "e") {
+		t.Errorf("findWSLDrive = %q, want %q", got, filepath.Join(mntRoot, "e"))
+	}
+	if got := detector.findWSLDrive("RPI-RP2"); got != "" {
+		t.Errorf("findWSLDrive for unknown label = %q, want empty", got)
+	}
+
+	// Polling again reuses the lookups instead of starting PowerShell
+	detector.findWSLDrive("NICENANO")
+	detector.findWSLDrive("RPI-RP2")
+	if data, _ := os.ReadFile(calls); strings.Count(string(data), "\n") != 2 {
+		t.Errorf("powershell.exe ran %d times for two labels, want 2", strings.Count(string(data), "\n"))
+	}
+}
+
+func TestLinuxDetector_AutoMount(t *testing.T) {
+	binDir := t.TempDir()
+	mounted := filepath.Join(binDir, "mounted")
+	calls := filepath.Join(binDir, "calls")
+
+	// Fake lsblk reports the bootloader unmounted until udisksctl mounts it
+	lsblk := `#!/bin/bash
+if [ -e "` + mounted + `" ]; then mp='"/media/me/NICENANO"'; else mp=null; fi
+echo '{"blockdevices": [{"path": "/dev/sda1", "label": "root", "mountpoint": "/"},'
+echo '{"path": "/dev/sdb", "label": "NICENANO", "mountpoint": '"$mp"'}]}'
+`
+	udisksctl := `#!/bin/bash
+echo "$@" >> "` + calls + `"
+touch "` + mounted + `"
+`
+	for name, script := range map[string]string{"lsblk": lsblk, "udisksctl": udisksctl} {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	detector := &linuxDetector{procMounts: filepath.Join(binDir, "no-mounts"), autoMount: true}
+
+	connected, path := detector.findDevice("NICENANO", []string{"/nonexistent/NICENANO"})
+	if !connected || path != "/media/me/NICENANO" {
+		t.Fatalf("findDevice = %v, %q; want mounted at /media/me/NICENANO", connected, path)
+	}
+	data, _ := os.ReadFile(calls)
+	if string(data) != "mount --no-user-interaction -b /dev/sdb\n" {
+		t.Errorf("udisksctl calls = %q", data)
+	}
+
+	if connected, _ := detector.findDevice("RPI-RP2", []string{"/nonexistent/RPI-RP2"}); connected {
+		t.Error("expected no match for a label lsblk doesn't list")
+	}
+}
+
+func TestLinuxDetector_FindByLabel(t *testing.T) {
+	binDir := t.TempDir()
+
+	// Label differs in case from the configured name and from the mount directory
+	lsblk := `#!/bin/bash
+echo >> "$(dirname "$0")/calls"
+echo '{"blockdevices": [{"path": "/dev/sdc", "label": "NiceNano", "mountpoint": "/mnt/keyboard boot"}]}'
+`
+	if err := os.WriteFile(filepath.Join(binDir, "lsblk"), []byte(lsblk), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	detector := &linuxDetector{procMounts: filepath.Join(binDir, "no-mounts")}
+
+	connected, path := detector.findDevice("NICENANO", []string{"/nonexistent/NICENANO"})
+	if !connected || path != "/mnt/keyboard boot" {
+		t.Errorf("findDevice = %v, %q; want /mnt/keyboard boot", connected, path)
+	}
+
+	// Polling again and describing the volume reuse the listing
+	detector.findDevice("NICENANO", []string{"/nonexistent/NICENANO"})
+	detector.event("NICENANO", true, path, nil)
+	if data, _ := os.ReadFile(filepath.Join(binDir, "calls")); len(data) != 1 {
+		t.Errorf("lsblk ran %d times within labelCacheTTL, want 1", len(data))
+	}
+}
+
+func TestLinuxDetector_EventMetadata(t *testing.T) {
+	binDir := t.TempDir()
+
+	// Older lsblk prints sizes as strings; the serial is on the parent disk
+	lsblk := `#!/bin/bash
+echo '{"blockdevices": ['
+echo '{"name": "sdb", "path": "/dev/sdb", "label": null, "mountpoint": null, "fstype": null, "size": "33554432", "serial": "E6A1B2C3", "pkname": null},'
+echo '{"name": "sdb1", "path": "/dev/sdb1", "label": "NICENANO", "mountpoint": "/media/me/NICENANO", "fstype": "vfat", "size": 33488896, "serial": null, "pkname": "sdb"}'
+echo ']}'
+`
+	if err := os.WriteFile(filepath.Join(binDir, "lsblk"), []byte(lsblk), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	detector := &linuxDetector{}
+	got := detector.event("NICENANO", true, "/media/me/NICENANO", nil)
+	want := Event{
+		Connected: true,
+		Path:      "/media/me/NICENANO",
+		Label:     "NICENANO",
+		FSType:    "vfat",
+		Capacity:  33488896,
+		Serial:    "E6A1B2C3",
+	}
+	if got != want {
+		t.Errorf("event = %+v, want %+v", got, want)
+	}
+
+	if got := detector.event("NICENANO", false, "/media/me/NICENANO", nil); got != (Event{Path: "/media/me/NICENANO"}) {
+		t.Errorf("disconnected event = %+v, want path only", got)
+	}
+}
+
+func TestLinuxDetector_List(t *testing.T) {
+	binDir := t.TempDir()
+
+	// The system disk is skipped; older lsblk prints flags as "0"/"1" and
+	// only the disk, not its partition, as hot-pluggable
+	lsblk := `#!/bin/bash
+echo '{"blockdevices": ['
+echo '{"name": "nvme0n1p2", "path": "/dev/nvme0n1p2", "label": null, "mountpoint": "/", "fstype": "ext4", "size": 500000000000, "rm": false, "hotplug": false},'
+echo '{"name": "sdb", "path": "/dev/sdb", "label": null, "mountpoint": null, "size": "33554432", "serial": "E6A1B2C3", "rm": "0", "hotplug": "1"},'
+echo '{"name": "sdb1", "path": "/dev/sdb1", "label": "NICENANO", "mountpoint": "/media/me/NICENANO", "fstype": "vfat", "size": 33488896, "pkname": "sdb", "rm": "0", "hotplug": "0"},'
+echo '{"name": "sdc1", "path": "/dev/sdc1", "label": "RPI-RP2", "mountpoint": null, "fstype": "vfat", "rm": true, "hotplug": true}'
+echo ']}'
+`
+	if err := os.WriteFile(filepath.Join(binDir, "lsblk"), []byte(lsblk), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	detector := &linuxDetector{}
+	got, err := detector.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []DeviceInfo{{
+		Path:     "/media/me/NICENANO",
+		Label:    "NICENANO",
+		FSType:   "vfat",
+		Capacity: 33488896,
+		Serial:   "E6A1B2C3",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinuxDetector_ListWithoutLsblk(t *testing.T) {
+	mountDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(mountDir, "NICENANO"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	detector := &linuxDetector{mountPaths: []string{mountDir}}
+	got, err := detector.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []DeviceInfo{{Path: filepath.Join(mountDir, "NICENANO"), Label: "NICENANO"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinuxDetector_Unreadable(t *testing.T) {
+	mountDir := t.TempDir()
+	volumePath := filepath.Join(mountDir, "NICENANO")
+	if err := os.Mkdir(volumePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	// Tests run as root, who may use any directory
+	var denied atomic.Bool
+	denied.Store(true)
+	checkAccess = func(path string) error {
+		if denied.Load() && path == volumePath {
+			return os.ErrPermission
+		}
+		return nil
+	}
+	defer func() { checkAccess = accessible }()
+
+	detector := &linuxDetector{mountPaths: []string{mountDir}, procMounts: filepath.Join(mountDir, "mounts")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := detector.Detect(ctx, "NICENANO", time.Millisecond)
+
+	e := <-events
+	if e.Connected || !errors.Is(e.Err, ErrUnreadable) || e.Path != volumePath {
+		t.Fatalf("event = %+v, want an unreadable volume", e)
+	}
+	if !strings.Contains(e.Err.Error(), "kbflash setup-udev") {
+		t.Errorf("error %q does not say what to do", e.Err)
+	}
+
+	denied.Store(false)
+	select {
+	case e = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the volume to become usable")
+	}
+	if !e.Connected || e.Err != nil {
+		t.Errorf("event after fixing permissions = %+v, want connected", e)
+	}
+
+	// The detector stops before checkAccess is restored
+	cancel()
+	for range events {
+	}
+}
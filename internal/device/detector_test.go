@@ -225,6 +225,10 @@ func (d *testDetector) Detect(ctx context.Context, volumeName string, pollInterv
 	return events
 }
 
+func (d *testDetector) List(ctx context.Context) ([]DeviceInfo, error) {
+	return listMountPaths([]string{d.basePath}), nil
+}
+
 func (d *testDetector) exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
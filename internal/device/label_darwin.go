@@ -0,0 +1,185 @@
+//go:build darwin
+
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// volume is a mounted or unmounted filesystem reported by diskutil.
+type volume struct {
+	Label      string
+	MountPoint string
+	Content    string // partition type, e.g. "DOS_FAT_12"
+	Size       int64
+}
+
+// findByLabel returns the mount point of the external volume named
+// volumeName, ignoring case, or "" if there is none or diskutil failed.
+func (d *darwinDetector) findByLabel(volumeName string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if time.Since(d.volumesAt) > labelCacheTTL {
+		out, err := exec.Command("diskutil", "list", "-plist", "external").Output()
+		if err != nil {
+			return ""
+		}
+		d.volumes, _ = parseDiskutilList(out)
+		d.volumesAt = time.Now()
+	}
+
+	for _, v := range d.volumes {
+		if v.MountPoint != "" && strings.EqualFold(v.Label, volumeName) {
+			return v.MountPoint
+		}
+	}
+	return ""
+}
+
+// List returns the mounted external volumes reported by diskutil.
+func (d *darwinDetector) List(ctx context.Context) ([]DeviceInfo, error) {
+	out, err := exec.CommandContext(ctx, "diskutil", "list", "-plist", "external").Output()
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := parseDiskutilList(out)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.volumes, d.volumesAt = volumes, time.Now()
+	d.mu.Unlock()
+
+	var mounted []DeviceInfo
+	for _, v := range volumes {
+		if v.MountPoint != "" {
+			mounted = append(mounted, DeviceInfo{Path: v.MountPoint, Label: v.Label, FSType: v.Content, Capacity: v.Size})
+		}
+	}
+	return mounted, nil
+}
+
+// event describes a detection result with the volume's diskutil metadata.
+func (d *darwinDetector) event(volumeName string, connected bool, path string, err error) Event {
+	if !connected {
+		return Event{Path: path, Err: err}
+	}
+	e := Event{Connected: true, Path: path, Label: volumeName}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, v := range d.volumes {
+		if v.MountPoint == path {
+			e.Label = v.Label
+			e.FSType = v.Content
+			e.Capacity = v.Size
+			break
+		}
+	}
+	return e
+}
+
+// parseDiskutilList extracts the volumes from `diskutil list -plist` output.
+func parseDiskutilList(data []byte) ([]volume, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root any
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			if root, err = decodePlist(dec, start); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	top, ok := root.(map[string]any)
+	if !ok {
+		return nil, errors.New("diskutil: unexpected plist")
+	}
+	var volumes []volume
+	var walk func(entries any)
+	walk = func(entries any) {
+		list, _ := entries.([]any)
+		for _, e := range list {
+			dict, ok := e.(map[string]any)
+			if !ok {
+				continue
+			}
+			if name, _ := dict["VolumeName"].(string); name != "" {
+				v := volume{Label: name}
+				v.MountPoint, _ = dict["MountPoint"].(string)
+				v.Content, _ = dict["Content"].(string)
+				if size, ok := dict["Size"].(string); ok {
+					v.Size, _ = strconv.ParseInt(size, 10, 64)
+				}
+				volumes = append(volumes, v)
+			}
+			walk(dict["Partitions"])
+		}
+	}
+	walk(top["AllDisksAndPartitions"])
+	return volumes, nil
+}
+
+// decodePlist decodes the plist value starting at start: dicts become
+// map[string]any, arrays []any and anything else its text.
+func decodePlist(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict", "array":
+		dict := make(map[string]any)
+		var array []any
+		var key string
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := decodePlist(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				if start.Name.Local == "dict" {
+					dict[key] = v
+				} else {
+					array = append(array, v)
+				}
+			case xml.EndElement:
+				if start.Name.Local == "dict" {
+					return dict, nil
+				}
+				return array, nil
+			}
+		}
+	}
+
+	var text string
+	if err := dec.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	return text, nil
+}
@@ -0,0 +1,63 @@
+//go:build darwin
+
+package device
+
+import "testing"
+
+func TestParseDiskutilList(t *testing.T) {
+	out := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AllDisks</key>
+	<array><string>disk4</string></array>
+	<key>AllDisksAndPartitions</key>
+	<array>
+		<dict>
+			<key>Content</key>
+			<string></string>
+			<key>DeviceIdentifier</key>
+			<string>disk4</string>
+			<key>MountPoint</key>
+			<string>/Volumes/NICENANO 1</string>
+			<key>OSInternal</key>
+			<false/>
+			<key>Size</key>
+			<integer>33554432</integer>
+			<key>VolumeName</key>
+			<string>NICENANO</string>
+		</dict>
+		<dict>
+			<key>DeviceIdentifier</key>
+			<string>disk5</string>
+			<key>Partitions</key>
+			<array>
+				<dict>
+					<key>DeviceIdentifier</key>
+					<string>disk5s1</string>
+					<key>VolumeName</key>
+					<string>RPI-RP2</string>
+				</dict>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>`
+
+	volumes, err := parseDiskutilList([]byte(out))
+	if err != nil {
+		t.Fatalf("parseDiskutilList failed: %v", err)
+	}
+	want := []volume{
+		{Label: "NICENANO", MountPoint: "/Volumes/NICENANO 1", Size: 33554432},
+		{Label: "RPI-RP2"},
+	}
+	if len(volumes) != len(want) {
+		t.Fatalf("volumes = %+v, want %+v", volumes, want)
+	}
+	for i := range want {
+		if volumes[i] != want[i] {
+			t.Errorf("volume %d = %+v, want %+v", i, volumes[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,219 @@
+//go:build linux
+
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockDevice is a block device as listed by lsblk.
+type blockDevice struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Label      string    `json:"label"`
+	MountPoint string    `json:"mountpoint"`
+	FSType     string    `json:"fstype"`
+	Size       lsblkSize `json:"size"`
+	Serial     string    `json:"serial"`
+	Parent     string    `json:"pkname"` // name of the disk a partition is on
+	Removable  lsblkBool `json:"rm"`
+	Hotplug    lsblkBool `json:"hotplug"` // USB and other hot-pluggable disks
+}
+
+// lsblkSize is a byte count, which older lsblk versions print as a string.
+type lsblkSize int64
+
+func (s *lsblkSize) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" || text == "" {
+		*s = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	*s = lsblkSize(n)
+	return err
+}
+
+// lsblkBool is a flag, which older lsblk versions print as "0" or "1".
+type lsblkBool bool
+
+func (b *lsblkBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// listBlockDevices returns every block device and partition with lsblk.
+func listBlockDevices(ctx context.Context) ([]blockDevice, error) {
+	out, err := exec.CommandContext(ctx, "lsblk", "--json", "--list", "--bytes",
+		"-o", "NAME,PATH,LABEL,MOUNTPOINT,FSTYPE,SIZE,SERIAL,PKNAME,RM,HOTPLUG").Output()
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		BlockDevices []blockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+	return result.BlockDevices, nil
+}
+
+// event describes a detection result with the volume's lsblk metadata.
+// The serial number of a partition comes from the disk it is on.
+func (d *linuxDetector) event(volumeName string, connected bool, path string, err error) Event {
+	if !connected {
+		return Event{Path: path, Err: err}
+	}
+	e := Event{Connected: true, Path: path, Label: volumeName}
+
+	devices, err := d.blockDevices()
+	if err != nil {
+		return e
+	}
+	for _, dev := range devices {
+		if dev.MountPoint != path {
+			continue
+		}
+		if dev.Label != "" {
+			e.Label = dev.Label
+		}
+		e.FSType = dev.FSType
+		e.Capacity = int64(dev.Size)
+		e.Serial = dev.Serial
+		for _, parent := range devices {
+			if e.Serial == "" && dev.Parent != "" && parent.Name == dev.Parent {
+				e.Serial = parent.Serial
+			}
+		}
+		break
+	}
+	return e
+}
+
+// blockDevices returns every block device and partition, reusing an lsblk
+// listing made within labelCacheTTL.
+func (d *linuxDetector) blockDevices() ([]blockDevice, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.devicesAt) > labelCacheTTL {
+		devices, err := listBlockDevices(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		d.devices, d.devicesAt = devices, time.Now()
+	}
+	return d.devices, nil
+}
+
+// findByLabel returns the mount point of the block device whose filesystem
+// label is volumeName, ignoring case, or "" if there is none or lsblk is
+// unavailable. With auto-mount enabled, an unmounted device is mounted with
+// udisksctl, for systems without a desktop automounter. Each device is tried
+// once per appearance so a failing mount (e.g. no polkit permission) isn't
+// retried every poll.
+func (d *linuxDetector) findByLabel(volumeName string) string {
+	devices, err := d.blockDevices()
+	if err != nil {
+		return ""
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := make(map[string]bool)
+	var target *blockDevice
+	for i, dev := range devices {
+		if dev.Label == "" || !strings.EqualFold(dev.Label, volumeName) {
+			continue
+		}
+		present[dev.Path] = true
+		if dev.MountPoint != "" {
+			return dev.MountPoint
+		}
+		if target == nil && !d.mountTried[dev.Path] {
+			target = &devices[i]
+		}
+	}
+	// Forget devices that went away so they are mounted again on reconnect
+	for path := range d.mountTried {
+		if !present[path] {
+			delete(d.mountTried, path)
+		}
+	}
+	if target == nil || !d.autoMount {
+		return ""
+	}
+
+	if d.mountTried == nil {
+		d.mountTried = make(map[string]bool)
+	}
+	d.mountTried[target.Path] = true
+	if err := exec.Command("udisksctl", "mount", "--no-user-interaction", "-b", target.Path).Run(); err != nil {
+		return ""
+	}
+
+	devices, err = listBlockDevices(context.Background())
+	if err != nil {
+		return ""
+	}
+	d.devices, d.devicesAt = devices, time.Now()
+	for _, dev := range devices {
+		if dev.Path == target.Path {
+			return dev.MountPoint
+		}
+	}
+	return ""
+}
+
+// List returns the mounted partitions of removable or hot-pluggable disks
+// with their lsblk metadata. Without lsblk, every directory under the mount
+// paths is listed instead.
+func (d *linuxDetector) List(ctx context.Context) ([]DeviceInfo, error) {
+	devices, err := listBlockDevices(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return listMountPaths(d.mountPaths), nil
+	}
+	d.mu.Lock()
+	d.devices, d.devicesAt = devices, time.Now()
+	d.mu.Unlock()
+
+	disks := make(map[string]blockDevice)
+	for _, dev := range devices {
+		disks[dev.Name] = dev
+	}
+	var volumes []DeviceInfo
+	for _, dev := range devices {
+		if dev.MountPoint == "" {
+			continue
+		}
+		parent := disks[dev.Parent]
+		if !dev.Removable && !dev.Hotplug && !parent.Removable && !parent.Hotplug {
+			continue
+		}
+		v := DeviceInfo{
+			Path:     dev.MountPoint,
+			Label:    dev.Label,
+			FSType:   dev.FSType,
+			Capacity: int64(dev.Size),
+			Serial:   dev.Serial,
+		}
+		if v.Serial == "" {
+			v.Serial = parent.Serial
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
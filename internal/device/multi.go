@@ -0,0 +1,48 @@
+package device
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// VolumeEvent is an Event for one of several watched volumes.
+type VolumeEvent struct {
+	Volume string // volume name the event belongs to
+	Event
+}
+
+// DetectAll watches several volumes at once with d and merges their events,
+// tagged with the volume they belong to. Duplicate names are watched once.
+// The channel is closed once ctx is cancelled and every watcher has stopped.
+func DetectAll(ctx context.Context, d Detector, volumeNames []string, pollInterval time.Duration) <-chan VolumeEvent {
+	out := make(chan VolumeEvent)
+
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for _, name := range volumeNames {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		wg.Add(1)
+		go func(name string, events <-chan Event) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case out <- VolumeEvent{Volume: name, Event: event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(name, d.Detect(ctx, name, pollInterval))
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
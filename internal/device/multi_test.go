@@ -0,0 +1,55 @@
+package device
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectAll(t *testing.T) {
+	base := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "NICENANO"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := DetectAll(ctx, &testDetector{basePath: base}, []string{"NICENANO", "RPI-RP2", "NICENANO"}, 10*time.Millisecond)
+
+	// One initial event per distinct volume
+	initial := make(map[string]VolumeEvent)
+	for len(initial) < 2 {
+		select {
+		case e := <-events:
+			if _, dup := initial[e.Volume]; dup {
+				t.Fatalf("duplicate initial event for %s", e.Volume)
+			}
+			initial[e.Volume] = e
+		case <-time.After(time.Second):
+			t.Fatalf("timed out with initial events %v", initial)
+		}
+	}
+	if !initial["NICENANO"].Connected || initial["RPI-RP2"].Connected {
+		t.Errorf("initial events = %+v", initial)
+	}
+
+	// A second volume appearing is reported under its own name
+	if err := os.Mkdir(filepath.Join(base, "RPI-RP2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Volume != "RPI-RP2" || !e.Connected {
+			t.Errorf("event = %+v, want RPI-RP2 connected", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for RPI-RP2")
+	}
+
+	cancel()
+	for range events {
+	}
+}
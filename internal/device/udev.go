@@ -0,0 +1,57 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UdevRulesPath is where udev rules for kbflash are installed.
+const UdevRulesPath = "/etc/udev/rules.d/99-kbflash.rules"
+
+// USBID is a USB vendor:product ID pair in lowercase hex, e.g. "239a:00b3".
+type USBID string
+
+// Vendor returns the vendor half of the ID.
+func (id USBID) Vendor() string {
+	vendor, _, _ := strings.Cut(string(id), ":")
+	return strings.ToLower(vendor)
+}
+
+// Product returns the product half of the ID.
+func (id USBID) Product() string {
+	_, product, _ := strings.Cut(string(id), ":")
+	return strings.ToLower(product)
+}
+
+// knownBootloaders maps UF2 bootloader volume names to their USB IDs.
+var knownBootloaders = map[string]USBID{
+	"NICENANO":   "239a:00b3", // Adafruit nRF52 bootloader on nice!nano
+	"XIAO-SENSE": "2886:0045", // Seeed XIAO nRF52840
+	"RPI-RP2":    "2e8a:0003", // RP2040 boot ROM
+}
+
+// BootloaderUSBID returns the USB ID of a well-known bootloader volume.
+func BootloaderUSBID(volumeName string) (USBID, bool) {
+	id, ok := knownBootloaders[strings.ToUpper(volumeName)]
+	return id, ok
+}
+
+// UdevDevice is a bootloader to write rules for.
+type UdevDevice struct {
+	Name string // volume name, used in comments and as the udisks name
+	ID   USBID
+}
+
+// UdevRules renders rules that give the logged-in user access to each
+// bootloader and let udisks automount its volume without admin rights.
+func UdevRules(devices []UdevDevice) string {
+	var b strings.Builder
+	b.WriteString("# Generated by kbflash setup-udev\n")
+	for _, d := range devices {
+		match := fmt.Sprintf(`ATTRS{idVendor}=="%s", ATTRS{idProduct}=="%s"`, d.ID.Vendor(), d.ID.Product())
+		fmt.Fprintf(&b, "\n# %s UF2 bootloader (%s)\n", d.Name, d.ID)
+		fmt.Fprintf(&b, "SUBSYSTEMS==\"usb\", %s, MODE=\"0660\", TAG+=\"uaccess\"\n", match)
+		fmt.Fprintf(&b, "SUBSYSTEM==\"block\", SUBSYSTEMS==\"usb\", %s, ENV{UDISKS_AUTO}=\"1\", ENV{UDISKS_SYSTEM}=\"0\", ENV{UDISKS_NAME}=\"%s\"\n", match, d.Name)
+	}
+	return b.String()
+}
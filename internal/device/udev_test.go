@@ -0,0 +1,33 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBootloaderUSBID(t *testing.T) {
+	id, ok := BootloaderUSBID("nicenano")
+	if !ok || id.Vendor() != "239a" || id.Product() != "00b3" {
+		t.Errorf("BootloaderUSBID(nicenano) = %q, %v", id, ok)
+	}
+	if _, ok := BootloaderUSBID("MYBOARD"); ok {
+		t.Error("expected unknown volume to have no USB ID")
+	}
+}
+
+func TestUdevRules(t *testing.T) {
+	rules := UdevRules([]UdevDevice{
+		{Name: "NICENANO", ID: "239A:00B3"},
+		{Name: "RPI-RP2", ID: "2e8a:0003"},
+	})
+
+	for _, want := range []string{
+		`ATTRS{idVendor}=="239a", ATTRS{idProduct}=="00b3", MODE="0660", TAG+="uaccess"`,
+		`ENV{UDISKS_AUTO}="1", ENV{UDISKS_SYSTEM}="0", ENV{UDISKS_NAME}="NICENANO"`,
+		`# RPI-RP2 UF2 bootloader (2e8a:0003)`,
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("rules missing %q:\n%s", want, rules)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package device
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// driveLetterTTL is how long a drive letter lookup is reused while polling:
+// powershell.exe takes most of a second to start.
+const driveLetterTTL = 2 * time.Second
+
+// driveLetter is the result of a drive letter lookup, "" if none was found.
+type driveLetter struct {
+	letter string
+	at     time.Time
+}
+
+// isWSL reports whether we are running under Windows Subsystem for Linux.
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+// findWSLDrive returns the /mnt/<drive> path of the Windows volume named
+// volumeName, or "" if it is not mounted.
+//
+// drvfs does not expose volume labels, so without PowerShell a drive matches
+// when the INFO_UF2.TXT at its root mentions volumeName, ignoring case and
+// punctuation, as the Board-ID of RPI-RP2 and NICENANO bootloaders does.
+func (d *linuxDetector) findWSLDrive(volumeName string) string {
+	if d.wslPowerShell {
+		letter := d.driveLetter(volumeName)
+		if letter == "" {
+			return ""
+		}
+		p := filepath.Join(d.wslMountRoot, strings.ToLower(letter))
+		if _, err := os.Stat(p); err != nil {
+			return ""
+		}
+		return p
+	}
+
+	entries, err := os.ReadDir(d.wslMountRoot)
+	if err != nil {
+		return ""
+	}
+	name := alphanumeric(volumeName)
+	for _, entry := range entries {
+		if len(entry.Name()) != 1 || !entry.IsDir() {
+			continue
+		}
+		p := filepath.Join(d.wslMountRoot, entry.Name())
+		info, err := os.ReadFile(filepath.Join(p, "INFO_UF2.TXT"))
+		if err == nil && name != "" && strings.Contains(alphanumeric(string(info)), name) {
+			return p
+		}
+	}
+	return ""
+}
+
+// alphanumeric lowercases s and drops everything but letters and digits.
+func alphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// driveLetter returns the drive letter of the volume labelled label,
+// reusing a lookup made within driveLetterTTL.
+func (d *linuxDetector) driveLetter(label string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if found, ok := d.driveLetters[label]; ok && time.Since(found.at) < driveLetterTTL {
+		return found.letter
+	}
+	letter := powershellDriveLetter(label)
+	if d.driveLetters == nil {
+		d.driveLetters = make(map[string]driveLetter)
+	}
+	d.driveLetters[label] = driveLetter{letter: letter, at: time.Now()}
+	return letter
+}
+
+// powershellDriveLetter asks Windows for the drive letter of the volume
+// with the given label. Returns "" if PowerShell is unavailable or no
+// volume has that label.
+func powershellDriveLetter(label string) string {
+	quoted := "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		"(Get-Volume -FileSystemLabel "+quoted+" -ErrorAction SilentlyContinue).DriveLetter")
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+
+	letter := strings.TrimSpace(stdout.String())
+	if len(letter) != 1 {
+		return ""
+	}
+	return letter
+}
@@ -0,0 +1,500 @@
+// Package dockertest serves a fake Docker Engine API for tests, covering the
+// calls kbflash makes: ping, image inspect and pull, and running containers
+// by create, attach and start or by exec into a long-lived one.
+package dockertest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/jsonstream"
+)
+
+// APIVersion is the Engine API version the fake daemon reports.
+const APIVersion = "1.51"
+
+// Engine is a fake Docker daemon. Set its fields before the code under test
+// runs; they are not safe to change while it does.
+type Engine struct {
+	// Images present locally, e.g. "zmk-image:latest"
+	Images map[string]bool
+
+	// Named volumes that exist
+	Volumes map[string]bool
+
+	// Pull pulls image, sending its progress messages; an error fails the
+	// pull as the daemon reports it. The image is added once Pull returns
+	// nil. A nil Pull succeeds straight away.
+	Pull func(ctx context.Context, image string, send func(jsonstream.Message)) error
+
+	// Run is the process of a started container, or of an exec into one,
+	// returning its exit code. A nil Run exits 0 without output.
+	Run func(p *Process) int
+
+	mu         sync.Mutex
+	calls      []string
+	containers map[string]*Container // by ID
+	execs      map[string]*execution
+	nextID     int
+}
+
+// Container is a container created on the fake daemon.
+type Container struct {
+	ID     string
+	Name   string
+	Config container.Config
+	Host   container.HostConfig
+
+	running  bool
+	started  chan struct{}
+	stopped  chan struct{}
+	exited   chan struct{}
+	exitCode int
+}
+
+// Process is a command run in a container.
+type Process struct {
+	Container *Container
+	Cmd       []string
+	Stdin     []byte
+	Stdout    io.Writer
+	Stderr    io.Writer
+	Stopped   <-chan struct{} // closed when the container is stopped
+}
+
+// execution is a command created by exec
+type execution struct {
+	container *Container
+	cmd       []string
+	running   bool
+	exitCode  int
+}
+
+// Start serves a fake daemon for the rest of the test and points DOCKER_HOST
+// at it.
+func Start(t testing.TB) *Engine {
+	t.Helper()
+	e := &Engine{
+		Images:     make(map[string]bool),
+		Volumes:    make(map[string]bool),
+		containers: make(map[string]*Container),
+		execs:      make(map[string]*execution),
+	}
+	server := httptest.NewServer(http.HandlerFunc(e.serve))
+	t.Cleanup(server.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+server.Listener.Addr().String())
+	return e
+}
+
+// Calls returns the API calls made so far, e.g. "POST /containers/create",
+// without the API version prefix.
+func (e *Engine) Calls() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.calls...)
+}
+
+// Container returns the container with the given name, or the only
+// container when name is "", or nil.
+func (e *Engine) Container(name string) *Container {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, c := range e.containers {
+		if name == "" || c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Containers returns the number of containers that exist.
+func (e *Engine) Containers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.containers)
+}
+
+// AddContainer adds a container named name, running when running is set.
+func (e *Engine) AddContainer(name string, running bool) *Container {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := e.newContainer(name, container.Config{}, container.HostConfig{})
+	if running {
+		c.start()
+	}
+	return c
+}
+
+// versionRe matches the API version prefix of a request path
+var versionRe = regexp.MustCompile(`^/v[0-9.]+`)
+
+func (e *Engine) serve(w http.ResponseWriter, r *http.Request) {
+	path := versionRe.ReplaceAllString(r.URL.Path, "")
+	e.mu.Lock()
+	e.calls = append(e.calls, r.Method+" "+path)
+	e.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case path == "/_ping":
+		w.Header().Set("Api-Version", APIVersion)
+		w.Header().Set("Ostype", "linux")
+		io.WriteString(w, "OK")
+	case parts[0] == "images" && path == "/images/create":
+		e.pull(w, r)
+	case parts[0] == "images" && strings.HasSuffix(path, "/json"):
+		e.inspectImage(w, strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json"))
+	case path == "/containers/create":
+		e.create(w, r)
+	case parts[0] == "containers" && len(parts) >= 2:
+		c := e.lookup(parts[1])
+		if c == nil {
+			writeError(w, http.StatusNotFound, "No such container: "+parts[1])
+			return
+		}
+		action := ""
+		if len(parts) > 2 {
+			action = parts[2]
+		}
+		e.container(w, r, c, action)
+	case parts[0] == "volumes" && len(parts) == 2 && r.Method == http.MethodDelete:
+		e.mu.Lock()
+		ok := e.Volumes[parts[1]]
+		delete(e.Volumes, parts[1])
+		e.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "get "+parts[1]+": no such volume")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "exec" && len(parts) == 3:
+		e.mu.Lock()
+		x := e.execs[parts[1]]
+		e.mu.Unlock()
+		if x == nil {
+			writeError(w, http.StatusNotFound, "No such exec instance: "+parts[1])
+			return
+		}
+		e.exec(w, r, parts[1], x, parts[2])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (e *Engine) inspectImage(w http.ResponseWriter, image string) {
+	e.mu.Lock()
+	ok := e.Images[normalize(image)]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: "+image)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"Id": "sha256:" + strings.Repeat("0", 64)})
+}
+
+func (e *Engine) pull(w http.ResponseWriter, r *http.Request) {
+	image := r.URL.Query().Get("fromImage")
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		image += ":" + tag
+	}
+	image = normalize(image)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	send := func(msg jsonstream.Message) {
+		enc.Encode(msg)
+		w.(http.Flusher).Flush()
+	}
+	if e.Pull != nil {
+		if err := e.Pull(r.Context(), image, send); err != nil {
+			send(jsonstream.Message{Error: &jsonstream.Error{Message: err.Error()}})
+			return
+		}
+	}
+	e.mu.Lock()
+	e.Images[image] = true
+	e.mu.Unlock()
+	send(jsonstream.Message{Status: "Status: Downloaded newer image for " + image})
+}
+
+func (e *Engine) create(w http.ResponseWriter, r *http.Request) {
+	var req container.CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name != "" && e.Container(name) != nil {
+		writeError(w, http.StatusConflict, "Conflict. The container name \"/"+name+"\" is already in use")
+		return
+	}
+
+	// The daemon never pulls on create; clients pull and retry
+	e.mu.Lock()
+	ok := e.Images[normalize(req.Config.Image)]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: "+req.Config.Image)
+		return
+	}
+
+	var host container.HostConfig
+	if req.HostConfig != nil {
+		host = *req.HostConfig
+	}
+	e.mu.Lock()
+	c := e.newContainer(name, *req.Config, host)
+	e.mu.Unlock()
+	writeJSON(w, http.StatusCreated, container.CreateResponse{ID: c.ID, Warnings: []string{}})
+}
+
+// newContainer adds a container; e.mu must be held
+func (e *Engine) newContainer(name string, cfg container.Config, host container.HostConfig) *Container {
+	e.nextID++
+	c := &Container{
+		ID:      fmt.Sprintf("%064x", e.nextID),
+		Name:    name,
+		Config:  cfg,
+		Host:    host,
+		started: make(chan struct{}),
+		stopped: make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	e.containers[c.ID] = c
+	return c
+}
+
+// lookup finds a container by ID or name
+func (e *Engine) lookup(ref string) *Container {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.containers[ref]; ok {
+		return c
+	}
+	for _, c := range e.containers {
+		if c.Name == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *Engine) container(w http.ResponseWriter, r *http.Request, c *Container, action string) {
+	switch action {
+	case "json":
+		e.mu.Lock()
+		running := c.running
+		e.mu.Unlock()
+		status := "exited"
+		if running {
+			status = "running"
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"Id":    c.ID,
+			"Name":  "/" + c.Name,
+			"State": map[string]any{"Running": running, "Status": status},
+		})
+	case "start":
+		e.mu.Lock()
+		c.start()
+		e.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case "attach":
+		stdin := r.URL.Query().Get("stdin") == "1"
+		e.hijack(w, func(conn net.Conn, rw io.Reader) {
+			select {
+			case <-c.started:
+			case <-c.stopped:
+			}
+			code := e.run(&Process{Container: c, Cmd: c.Config.Cmd, Stopped: c.stopped}, conn, rw, stdin)
+			e.mu.Lock()
+			c.exitCode = code
+			c.running = false
+			e.mu.Unlock()
+			close(c.exited)
+		})
+	case "wait":
+		select {
+		case <-c.exited:
+		case <-r.Context().Done():
+			return
+		}
+		writeJSON(w, http.StatusOK, container.WaitResponse{StatusCode: int64(c.exitCode)})
+	case "stop":
+		e.mu.Lock()
+		c.stop()
+		e.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case "exec":
+		var req container.ExecCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if !c.running {
+			writeError(w, http.StatusConflict, "container "+c.ID+" is not running")
+			return
+		}
+		e.nextID++
+		id := fmt.Sprintf("%064x", e.nextID)
+		e.execs[id] = &execution{container: c, cmd: req.Cmd}
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": id})
+	case "":
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+			return
+		}
+		e.mu.Lock()
+		c.stop()
+		delete(e.containers, c.ID)
+		e.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (e *Engine) exec(w http.ResponseWriter, r *http.Request, id string, x *execution, action string) {
+	switch action {
+	case "start":
+		e.mu.Lock()
+		x.running = true
+		e.mu.Unlock()
+		e.hijack(w, func(conn net.Conn, rw io.Reader) {
+			code := e.run(&Process{Container: x.container, Cmd: x.cmd, Stopped: x.container.stopped}, conn, rw, false)
+			e.mu.Lock()
+			x.exitCode = code
+			x.running = false
+			e.mu.Unlock()
+		})
+	case "json":
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"ID":          id,
+			"ContainerID": x.container.ID,
+			"Running":     x.running,
+			"ExitCode":    x.exitCode,
+		})
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+// run runs p with its output multiplexed onto conn as the daemon does
+func (e *Engine) run(p *Process, conn net.Conn, rw io.Reader, stdin bool) int {
+	if stdin {
+		p.Stdin, _ = io.ReadAll(rw)
+	}
+	var mu sync.Mutex
+	p.Stdout = &frameWriter{w: conn, stream: 1, mu: &mu}
+	p.Stderr = &frameWriter{w: conn, stream: 2, mu: &mu}
+	if e.Run == nil {
+		return 0
+	}
+	return e.Run(p)
+}
+
+// hijack upgrades the connection to a raw stream and runs fn on it, closing
+// it once fn returns
+func (e *Engine) hijack(w http.ResponseWriter, fn func(conn net.Conn, rw io.Reader)) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	io.WriteString(conn, "HTTP/1.1 101 UPGRADED\r\n"+
+		"Content-Type: application/vnd.docker.multiplexed-stream\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: tcp\r\n\r\n")
+	fn(conn, rw)
+}
+
+// start marks c running; e.mu must be held
+func (c *Container) start() {
+	if c.running {
+		return
+	}
+	c.running = true
+	select {
+	case <-c.started:
+	default:
+		close(c.started)
+	}
+}
+
+// stop stops c; e.mu must be held
+func (c *Container) stop() {
+	c.running = false
+	select {
+	case <-c.stopped:
+	default:
+		close(c.stopped)
+	}
+}
+
+// Mount returns the host directory bound to target in the container, or "".
+func (c *Container) Mount(target string) string {
+	for _, bind := range c.Host.Binds {
+		host, rest, _ := strings.Cut(bind, ":")
+		if dest, _, _ := strings.Cut(rest, ":"); dest == target {
+			return host
+		}
+	}
+	return ""
+}
+
+// frameWriter writes a stream of the multiplexed attach protocol: each write
+// is framed by an 8-byte header holding the stream and the payload length
+type frameWriter struct {
+	w      io.Writer
+	stream byte
+	mu     *sync.Mutex
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	header := make([]byte, 8)
+	header[0] = f.stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	if _, err := f.w.Write(header); err != nil {
+		return 0, err
+	}
+	return f.w.Write(p)
+}
+
+// normalize turns an image reference into its short form with a tag, so
+// "docker.io/library/zmk-image" matches "zmk-image:latest"
+func normalize(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+	if i := strings.LastIndex(image, "/"); !strings.Contains(image[i+1:], ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"message": msg})
+}
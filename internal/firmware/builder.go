@@ -3,18 +3,111 @@ package firmware
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// warningRegex matches compiler diagnostics like "src/foo.c:12:5: warning: ...".
+var warningRegex = regexp.MustCompile(`^(\S+?):(\d+)(?::\d+)?: warning: (.*)$`)
+
+// parseWarning reports whether line is a compiler warning and returns it with
+// the directory trimmed from its path, which is mostly container noise.
+func parseWarning(line string) (string, bool) {
+	m := warningRegex.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	return filepath.Base(m[1]) + ":" + m[2] + ": " + m[3], true
+}
+
+// addWarning appends the warning on line, if any, unless already seen.
+// Headers included from several files repeat the same warning.
+func addWarning(warnings []string, line string) []string {
+	if w, ok := parseWarning(line); ok && !slices.Contains(warnings, w) {
+		return append(warnings, w)
+	}
+	return warnings
+}
+
+// BuildStage identifies which phase of a firmware build is running.
+type BuildStage int
+
+const (
+	BuildPreparing   BuildStage = iota // git pull, Docker image check/pull
+	BuildConfiguring                   // CMake configure
+	BuildCompiling                     // Zephyr/ninja build
+	BuildCopying                       // copying artifacts to the firmware dir
+)
+
+// stageRanges is the share of the overall progress bar given to each stage.
+var stageRanges = [...][2]int{
+	BuildPreparing:   {0, 5},
+	BuildConfiguring: {5, 20},
+	BuildCompiling:   {20, 95},
+	BuildCopying:     {95, 100},
+}
+
+// String returns a label for the status panel.
+func (s BuildStage) String() string {
+	switch s {
+	case BuildPreparing:
+		return "Preparing"
+	case BuildConfiguring:
+		return "Configuring (CMake)"
+	case BuildCompiling:
+		return "Compiling"
+	case BuildCopying:
+		return "Copying firmware"
+	}
+	return ""
+}
+
+// Percent maps done/total steps within the stage onto the overall progress bar.
+func (s BuildStage) Percent(done, total int) int {
+	r := stageRanges[s]
+	if total <= 0 {
+		return r[0]
+	}
+	done = min(done, total)
+	return r[0] + (r[1]-r[0])*done/total
+}
+
+// configureSteps paces the configure stage, which announces no total: after
+// n lines of CMake output it sits at n/(n+configureSteps) of its range.
+const configureSteps = 50
+
+// parseBuildStage advances the stage based on well-known west/CMake output.
+// Stages only move forward.
+func parseBuildStage(line string, current BuildStage) BuildStage {
+	next := current
+	switch {
+	case progressRegex.MatchString(line):
+		next = BuildCompiling
+	case strings.Contains(line, "west build: generating a build system"),
+		strings.HasPrefix(line, "Loading Zephyr"),
+		strings.HasPrefix(line, "-- Zephyr version"):
+		next = BuildConfiguring
+	}
+	if next > current {
+		return next
+	}
+	return current
+}
+
 // BuildProgress represents the current build state.
 type BuildProgress struct {
 	Current int
 	Total   int
 	Percent int
+	Stage   BuildStage
 	Output  string
 	Message string // Human-readable message
 }
@@ -25,11 +118,16 @@ type BuildResult struct {
 	Error      error
 	Duration   time.Duration
 	OutputPath string
+	Warnings   []string // distinct compiler warnings, see parseWarning
 }
 
 // FirmwareBuilder is the interface for building firmware.
 type FirmwareBuilder interface {
 	Build(ctx context.Context, side string, progressFn func(BuildProgress)) BuildResult
+
+	// Clean removes what builds of side left behind, or of every side for
+	// "all", for when an incremental build gets into a bad state.
+	Clean(ctx context.Context, side string) error
 }
 
 // progressRegex matches ninja's [current/total] output.
@@ -40,6 +138,7 @@ type Builder struct {
 	command    string
 	args       []string
 	workingDir string
+	sides      []string // cleaned one at a time for "all", see Clean
 }
 
 // NewBuilder creates a new builder with the specified configuration.
@@ -51,6 +150,12 @@ func NewBuilder(command string, args []string, workingDir string) *Builder {
 	}
 }
 
+// SetSides sets the sides Clean removes in turn for "all" when the build
+// directory has no parent of its own holding every side's.
+func (b *Builder) SetSides(sides []string) {
+	b.sides = sides
+}
+
 // Build executes the build command for the specified side.
 // The progressFn callback is called for each progress update.
 // Returns when the build completes or context is cancelled.
@@ -83,6 +188,8 @@ func (b *Builder) Build(ctx context.Context, side string, progressFn func(BuildP
 	}
 
 	var maxTotal int
+	var warnings []string
+	stage := BuildPreparing
 	scanner := bufio.NewScanner(stdout)
 	for scanner.Scan() {
 		if ctx.Err() != nil {
@@ -91,6 +198,8 @@ func (b *Builder) Build(ctx context.Context, side string, progressFn func(BuildP
 		}
 
 		line := scanner.Text()
+		stage = parseBuildStage(line, stage)
+		warnings = addWarning(warnings, line)
 
 		// Parse ninja progress [current/total]
 		if matches := progressRegex.FindStringSubmatch(line); len(matches) == 3 {
@@ -111,19 +220,90 @@ func (b *Builder) Build(ctx context.Context, side string, progressFn func(BuildP
 				Current: current,
 				Total:   maxTotal,
 				Percent: percent,
+				Stage:   stage,
 				Output:  line,
 			})
 		} else {
 			// Non-progress output
 			progressFn(BuildProgress{
+				Stage:  stage,
 				Output: line,
 			})
 		}
 	}
 
 	if err := cmd.Wait(); err != nil {
-		return BuildResult{Success: false, Error: err}
+		return BuildResult{Success: false, Error: err, Warnings: warnings}
+	}
+
+	return BuildResult{Success: true, Warnings: warnings}
+}
+
+// buildDirArg returns the build directory passed to the build command with
+// -d or --build-dir, as west build takes it, with {{side}} unsubstituted.
+func (b *Builder) buildDirArg() string {
+	for i, arg := range b.args {
+		switch {
+		case (arg == "-d" || arg == "--build-dir") && i+1 < len(b.args):
+			return b.args[i+1]
+		case strings.HasPrefix(arg, "--build-dir="):
+			return strings.TrimPrefix(arg, "--build-dir=")
+		}
+	}
+	return ""
+}
+
+// Clean removes the build directory the build command is given with -d,
+// with {{side}} substituted as for Build. For "all" it removes the directory
+// holding every side's when {{side}} is the whole last element, e.g. build
+// for build/{{side}}, and otherwise each side's directory in turn.
+func (b *Builder) Clean(ctx context.Context, side string) error {
+	template := b.buildDirArg()
+	if template == "" {
+		return errors.New("no build directory to clean: build.args has no -d <dir>")
 	}
+	if side != "all" {
+		return os.RemoveAll(b.resolve(strings.ReplaceAll(template, "{{side}}", side)))
+	}
+	if !strings.Contains(template, "{{side}}") {
+		return fmt.Errorf("cannot tell which directory holds every side's build in %s; clean one side at a time", template)
+	}
+	if parent := sharedBuildDir(template); parent != "" {
+		return os.RemoveAll(b.resolve(parent))
+	}
+	if len(b.sides) == 0 {
+		return fmt.Errorf("cannot tell which directory holds every side's build in %s; clean one side at a time", template)
+	}
+	for _, s := range b.sides {
+		if err := os.RemoveAll(b.resolve(strings.ReplaceAll(template, "{{side}}", s))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedBuildDir returns the directory holding only the sides' build
+// directories of template: its parent when {{side}} is the whole last
+// element and the parent is below the working directory or absolute, else "".
+// The working directory itself, / and anything above the working directory
+// hold more than builds.
+func sharedBuildDir(template string) string {
+	if filepath.Base(template) != "{{side}}" {
+		return ""
+	}
+	parent := filepath.Dir(filepath.Clean(template))
+	if strings.Contains(parent, "{{side}}") || parent == "." || parent == string(filepath.Separator) ||
+		parent == ".." || strings.HasPrefix(parent, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return parent
+}
 
-	return BuildResult{Success: true}
+// resolve makes dir relative to the working directory, as the build command
+// sees it.
+func (b *Builder) resolve(dir string) string {
+	if !filepath.IsAbs(dir) && b.workingDir != "" {
+		return filepath.Join(b.workingDir, dir)
+	}
+	return dir
 }
@@ -298,3 +298,190 @@ func TestProgressRegex(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildStage_Percent(t *testing.T) {
+	tests := []struct {
+		stage       BuildStage
+		done, total int
+		want        int
+	}{
+		{BuildPreparing, 0, 0, 0},
+		{BuildConfiguring, 0, 1, 5},
+		{BuildConfiguring, 50, 100, 12},
+		{BuildCompiling, 0, 100, 20},
+		{BuildCompiling, 100, 100, 95},
+		{BuildCompiling, 150, 100, 95},
+		{BuildCopying, 1, 1, 100},
+	}
+
+	for _, tt := range tests {
+		if got := tt.stage.Percent(tt.done, tt.total); got != tt.want {
+			t.Errorf("%v.Percent(%d, %d) = %d, want %d", tt.stage, tt.done, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestParseBuildStage(t *testing.T) {
+	lines := []struct {
+		line string
+		want BuildStage
+	}{
+		{"-- west build: making build dir /workdir/build/left pristine", BuildPreparing},
+		{"-- west build: generating a build system", BuildConfiguring},
+		{"Loading Zephyr default modules (Zephyr base).", BuildConfiguring},
+		{"[1/250] Preparing syscall dependency handling", BuildCompiling},
+		{"-- west build: generating a build system", BuildCompiling}, // never moves back
+	}
+
+	stage := BuildPreparing
+	for _, tt := range lines {
+		stage = parseBuildStage(tt.line, stage)
+		if stage != tt.want {
+			t.Errorf("after %q: stage = %v, want %v", tt.line, stage, tt.want)
+		}
+	}
+}
+
+func TestBuilder_Build_Warnings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "build.sh")
+	script := `#!/bin/bash
+echo "[1/3] Building C object foo.c.obj"
+echo "/workdir/zmk/app/src/foo.c:12:5: warning: unused variable 'x' [-Wunused-variable]"
+echo "[2/3] Building C object bar.c.obj"
+echo "/workdir/zmk/app/src/foo.c:12:5: warning: unused variable 'x' [-Wunused-variable]"
+echo "/workdir/config/corne.keymap:40: warning: redefined"
+echo "[3/3] Linking"
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewBuilder(scriptPath, nil, "").Build(context.Background(), "left", nil)
+	if !result.Success {
+		t.Fatalf("Build failed: %v", result.Error)
+	}
+
+	want := []string{
+		"foo.c:12: unused variable 'x' [-Wunused-variable]",
+		"corne.keymap:40: redefined",
+	}
+	if len(result.Warnings) != len(want) {
+		t.Fatalf("warnings = %q, want %q", result.Warnings, want)
+	}
+	for i := range want {
+		if result.Warnings[i] != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, result.Warnings[i], want[i])
+		}
+	}
+}
+
+func TestParseWarning(t *testing.T) {
+	for _, line := range []string{
+		"[12/250] Building C object foo.c.obj",
+		"error: something broke",
+		"CMake Warning at cmake/foo.cmake:10 (message):",
+	} {
+		if w, ok := parseWarning(line); ok {
+			t.Errorf("parseWarning(%q) = %q, want no warning", line, w)
+		}
+	}
+}
+
+func TestBuilder_Clean(t *testing.T) {
+	workDir := t.TempDir()
+	for _, side := range []string{"left", "right"} {
+		if err := os.MkdirAll(filepath.Join(workDir, "build", side, "zephyr"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builder := NewBuilder("west", []string{"build", "-d", "build/{{side}}", "--", "-DSHIELD=corne_{{side}}"}, workDir)
+
+	if err := builder.Clean(context.Background(), "left"); err != nil {
+		t.Fatalf("Clean(left) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "left")); !os.IsNotExist(err) {
+		t.Error("build/left was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "right")); err != nil {
+		t.Error("cleaning left removed build/right")
+	}
+
+	if err := builder.Clean(context.Background(), "all"); err != nil {
+		t.Fatalf("Clean(all) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build")); !os.IsNotExist(err) {
+		t.Error("build was not removed for all")
+	}
+}
+
+func TestBuilder_Clean_SideInName(t *testing.T) {
+	// -d zmk/build_{{side}}: the parent holds the workspace, not just builds
+	zmk := filepath.Join(t.TempDir(), "zmk")
+	for _, dir := range []string{"build_left", "build_right", "app"} {
+		if err := os.MkdirAll(filepath.Join(zmk, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builder := NewBuilder("west", []string{"build", "-d", filepath.Join(zmk, "build_{{side}}")}, t.TempDir())
+	if err := builder.Clean(context.Background(), "all"); err == nil {
+		t.Error("Clean(all) without sides: expected an error")
+	}
+
+	builder.SetSides([]string{"left", "right"})
+	if err := builder.Clean(context.Background(), "all"); err != nil {
+		t.Fatalf("Clean(all) error = %v", err)
+	}
+	for _, side := range []string{"left", "right"} {
+		if _, err := os.Stat(filepath.Join(zmk, "build_"+side)); !os.IsNotExist(err) {
+			t.Errorf("build_%s was not removed", side)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(zmk, "app")); err != nil {
+		t.Error("Clean(all) removed the directory holding the builds")
+	}
+}
+
+func TestBuilder_Clean_OutsideWorkingDir(t *testing.T) {
+	// -d ../{{side}}: the parent is the working directory's
+	root := t.TempDir()
+	workDir := filepath.Join(root, "config")
+	for _, dir := range []string{"config", "left", "right"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builder := NewBuilder("west", []string{"build", "-d", "../{{side}}"}, workDir)
+	builder.SetSides([]string{"left", "right"})
+	if err := builder.Clean(context.Background(), "all"); err != nil {
+		t.Fatalf("Clean(all) error = %v", err)
+	}
+	for _, side := range []string{"left", "right"} {
+		if _, err := os.Stat(filepath.Join(root, side)); !os.IsNotExist(err) {
+			t.Errorf("../%s was not removed", side)
+		}
+	}
+	if _, err := os.Stat(workDir); err != nil {
+		t.Error("Clean(all) removed the working directory")
+	}
+}
+
+func TestBuilder_Clean_NoBuildDir(t *testing.T) {
+	tests := []struct {
+		args []string
+		side string
+	}{
+		{[]string{"{{side}}"}, "left"},
+		{[]string{"--build-dir={{side}}"}, "all"},
+		{[]string{"-d", "build"}, "all"},
+	}
+	for _, tt := range tests {
+		if err := NewBuilder("build.sh", tt.args, t.TempDir()).Clean(context.Background(), tt.side); err == nil {
+			t.Errorf("Clean(%q) with args %q: expected an error", tt.side, tt.args)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package firmware
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nrf52AdafruitCapacity is the application space on nRF52840 boards with the
+// Adafruit UF2 bootloader and S140 v6 SoftDevice (0x26000-0xF4000).
+const nrf52AdafruitCapacity = 0xF4000 - 0x26000
+
+// boardCapacities is the flash space left for the application on common
+// ZMK boards, keyed by boardKey. Boards not listed are not checked.
+var boardCapacities = map[string]int64{
+	"nicenano":               nrf52AdafruitCapacity,
+	"nrfmicro":               nrf52AdafruitCapacity,
+	"bluemicro840":           nrf52AdafruitCapacity,
+	"puchible":               nrf52AdafruitCapacity,
+	"mikoto":                 nrf52AdafruitCapacity,
+	"seeeduinoxiaoble":       0xF4000 - 0x27000, // S140 v7
+	"seeeduinoxiaorp2040":    2 << 20,
+	"rpipico":                2 << 20,
+	"adafruitkb2040":         8 << 20,
+	"sparkfunpromicrorp2040": 16 << 20,
+}
+
+// nearLimitPercent is the usage at which a firmware image is flagged.
+const nearLimitPercent = 90
+
+// BoardCapacity returns the application flash space for a ZMK board.
+func BoardCapacity(board string) (int64, bool) {
+	capacity, ok := boardCapacities[boardKey(board)]
+	return capacity, ok
+}
+
+// SizeReport compares a firmware image with its board's flash capacity.
+type SizeReport struct {
+	Size     int64 // UF2 payload bytes
+	Capacity int64
+}
+
+// Percent is the share of the capacity used, rounded down.
+func (r SizeReport) Percent() int {
+	if r.Capacity <= 0 {
+		return 0
+	}
+	return int(r.Size * 100 / r.Capacity)
+}
+
+// NearLimit reports whether the image uses most of the available flash.
+func (r SizeReport) NearLimit() bool {
+	return r.Percent() >= nearLimitPercent
+}
+
+// Exceeds reports whether the image does not fit.
+func (r SizeReport) Exceeds() bool {
+	return r.Size > r.Capacity
+}
+
+// String formats the report, e.g. "312.4 KB of 824 KB (37%)".
+func (r SizeReport) String() string {
+	return FormatSize(r.Size) + " of " + FormatSize(r.Capacity) + " (" + formatInt(int64(r.Percent())) + "%)"
+}
+
+// CheckImageSize reads the UF2 or .bin image at path and compares its
+// payload with board's capacity. ok is false, without reading the file, for unknown boards.
+func CheckImageSize(path, board string) (report SizeReport, ok bool, err error) {
+	capacity, ok := BoardCapacity(board)
+	if !ok {
+		return SizeReport{}, false, nil
+	}
+	size, err := imageSize(path)
+	if err != nil {
+		return SizeReport{}, true, err
+	}
+	return SizeReport{Size: size, Capacity: capacity}, true, nil
+}
+
+// boardKey normalizes a board name for lookups, dropping a trailing _vN revision.
+func boardKey(board string) string {
+	return normalizeBoard(boardRevisionRegex.ReplaceAllString(strings.ToLower(board), ""))
+}
+
+// imageSize returns the bytes an image occupies in flash: the payload of a
+// UF2 file, or the whole of a raw .bin image.
+func imageSize(path string) (int64, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".bin") {
+		return UF2PayloadSize(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,65 @@
+package firmware
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoardCapacity(t *testing.T) {
+	for _, board := range []string{"nice_nano_v2", "nice_nano", "Seeeduino_XIAO_BLE"} {
+		if _, ok := BoardCapacity(board); !ok {
+			t.Errorf("BoardCapacity(%q) unknown, want known", board)
+		}
+	}
+	if _, ok := BoardCapacity("custom_board"); ok {
+		t.Error("BoardCapacity(custom_board) known, want unknown")
+	}
+}
+
+func TestSizeReport(t *testing.T) {
+	tests := []struct {
+		size, capacity int64
+		near, exceeds  bool
+	}{
+		{500, 1000, false, false},
+		{950, 1000, true, false},
+		{1200, 1000, true, true},
+	}
+
+	for _, tt := range tests {
+		r := SizeReport{Size: tt.size, Capacity: tt.capacity}
+		if r.NearLimit() != tt.near || r.Exceeds() != tt.exceeds {
+			t.Errorf("%d/%d: near=%v exceeds=%v, want %v %v", tt.size, tt.capacity, r.NearLimit(), r.Exceeds(), tt.near, tt.exceeds)
+		}
+	}
+}
+
+func TestCheckImageSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corne_left.uf2")
+	if err := os.WriteFile(path, makeUF2(bytes.Repeat([]byte{1}, 256), bytes.Repeat([]byte{2}, 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, ok, err := CheckImageSize(path, "nice_nano_v2")
+	if err != nil || !ok {
+		t.Fatalf("CheckImageSize = ok %v, err %v", ok, err)
+	}
+	if report.Size != 356 || report.Capacity != nrf52AdafruitCapacity {
+		t.Errorf("report = %+v, want 356 bytes of %d", report, nrf52AdafruitCapacity)
+	}
+
+	// Raw images are written as-is, so their whole size counts
+	bin := filepath.Join(t.TempDir(), "corne_left.bin")
+	if err := os.WriteFile(bin, bytes.Repeat([]byte{1}, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, _, err := CheckImageSize(bin, "nice_nano_v2"); err != nil || report.Size != 1000 {
+		t.Errorf("bin report = %+v, err %v; want 1000 bytes", report, err)
+	}
+
+	if _, ok, err := CheckImageSize(filepath.Join(t.TempDir(), "missing.uf2"), "custom_board"); ok || err != nil {
+		t.Errorf("unknown board: ok %v, err %v; want skipped", ok, err)
+	}
+}
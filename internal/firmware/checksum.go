@@ -0,0 +1,115 @@
+package firmware
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestName is the checksum manifest written next to built firmware,
+// in the format produced by `sha256sum`.
+const ManifestName = "SHA256SUMS"
+
+// ErrChecksumMismatch is returned when firmware does not match its manifest entry.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// UpdateManifest records path's SHA-256 in the SHA256SUMS file of its
+// directory, replacing any existing entry for the same file name.
+func UpdateManifest(path string) error {
+	sum, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	manifestPath := filepath.Join(filepath.Dir(path), ManifestName)
+	sums, err := readManifest(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if sums == nil {
+		sums = make(map[string]string)
+	}
+	sums[filepath.Base(path)] = sum
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return os.WriteFile(manifestPath, []byte(b.String()), 0644)
+}
+
+// VerifyManifest checks path against the SHA256SUMS file in its directory.
+// Files without a manifest or manifest entry are not checked.
+func VerifyManifest(path string) error {
+	sums, err := readManifest(filepath.Join(filepath.Dir(path), ManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	want, ok := sums[filepath.Base(path)]
+	if !ok {
+		return nil
+	}
+
+	got, err := FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, filepath.Base(path))
+	}
+	return nil
+}
+
+// readManifest parses a sha256sum-style manifest into name -> hex digest.
+func readManifest(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		// sha256sum marks binary mode with '*' before the name
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, scanner.Err()
+}
+
+// FileSHA256 returns the hex SHA-256 digest of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,93 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	left := filepath.Join(tmpDir, "corne_left.uf2")
+	right := filepath.Join(tmpDir, "corne_right.uf2")
+	for _, p := range []string{left, right} {
+		if err := os.WriteFile(p, []byte(filepath.Base(p)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := UpdateManifest(right); err != nil {
+		t.Fatalf("UpdateManifest failed: %v", err)
+	}
+	if err := UpdateManifest(left); err != nil {
+		t.Fatalf("UpdateManifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 manifest entries, got %q", data)
+	}
+	if !strings.HasSuffix(lines[0], "  corne_left.uf2") || !strings.HasSuffix(lines[1], "  corne_right.uf2") {
+		t.Errorf("manifest not sorted by name: %q", data)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "firmware.uf2")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No manifest: nothing to check
+	if err := VerifyManifest(path); err != nil {
+		t.Errorf("VerifyManifest without manifest = %v, want nil", err)
+	}
+
+	if err := UpdateManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyManifest(path); err != nil {
+		t.Errorf("VerifyManifest = %v, want nil", err)
+	}
+
+	if err := os.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyManifest(path); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyManifest after corruption = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestFlasher_Flash_ChecksumMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "firmware.uf2")
+	if err := os.WriteFile(srcPath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateManifest(srcPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(srcPath, []byte("truncated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dstDir := t.TempDir()
+	result := NewFlasher().Flash(context.Background(), srcPath, dstDir, nil)
+	if result.Success {
+		t.Fatal("expected Flash to fail on checksum mismatch")
+	}
+	if !errors.Is(result.Error, ErrChecksumMismatch) {
+		t.Errorf("error = %v, want ErrChecksumMismatch", result.Error)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "firmware.uf2")); !os.IsNotExist(err) {
+		t.Error("nothing should be written to the device on mismatch")
+	}
+}
@@ -0,0 +1,77 @@
+package firmware
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DirSize returns the total size of the regular files under dir.
+// A missing directory has size 0.
+func DirSize(ctx context.Context, dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// ExpiredBuilds returns the dated builds directly inside dir whose date is
+// before cutoff. Flat builds and builds from other sources never expire.
+func ExpiredBuilds(builds []Build, dir string, cutoff time.Time) []Build {
+	dir = filepath.Clean(dir)
+	cutoffDate := cutoff.Format("20060102")
+
+	var expired []Build
+	for _, b := range builds {
+		if b.Date == "" || filepath.Dir(b.Path) != dir {
+			continue
+		}
+		if b.Date < cutoffDate {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
+
+// RemoveBuilds deletes the build directories, returning how many were
+// removed and the bytes freed. It stops at the first directory that cannot
+// be removed.
+func RemoveBuilds(ctx context.Context, builds []Build) (int, int64, error) {
+	var removed int
+	var freed int64
+	for _, b := range builds {
+		if err := ctx.Err(); err != nil {
+			return removed, freed, err
+		}
+		size, err := DirSize(ctx, b.Path)
+		if err != nil {
+			return removed, freed, err
+		}
+		if err := os.RemoveAll(b.Path); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += size
+	}
+	return removed, freed, nil
+}
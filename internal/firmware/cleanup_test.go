@@ -0,0 +1,75 @@
+package firmware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirSize(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.uf2"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(tmpDir, "20250101")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "b.uf2"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := DirSize(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatalf("DirSize failed: %v", err)
+	}
+	if size != 150 {
+		t.Errorf("DirSize = %d, want 150", size)
+	}
+
+	size, err = DirSize(context.Background(), filepath.Join(tmpDir, "missing"))
+	if err != nil || size != 0 {
+		t.Errorf("DirSize(missing) = %d, %v; want 0, nil", size, err)
+	}
+}
+
+func TestExpiredBuilds(t *testing.T) {
+	dir := "/fw"
+	builds := []Build{
+		{Date: "20250301", Path: "/fw/20250301"},
+		{Date: "20250110", Path: "/fw/20250110"},
+		{Date: "20250101", Path: "/ci/20250101", Source: "ci"},
+		{Date: "", Path: "/fw"},
+	}
+	cutoff := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	expired := ExpiredBuilds(builds, dir, cutoff)
+	if len(expired) != 1 || expired[0].Date != "20250110" {
+		t.Errorf("ExpiredBuilds = %+v, want only /fw/20250110", expired)
+	}
+}
+
+func TestRemoveBuilds(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := filepath.Join(tmpDir, "20250101")
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(old, "left.uf2"), make([]byte, 64), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, freed, err := RemoveBuilds(context.Background(), []Build{{Date: "20250101", Path: old}})
+	if err != nil {
+		t.Fatalf("RemoveBuilds failed: %v", err)
+	}
+	if removed != 1 || freed != 64 {
+		t.Errorf("removed %d builds freeing %d bytes, want 1 and 64", removed, freed)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected build directory to be removed")
+	}
+}
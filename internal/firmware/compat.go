@@ -0,0 +1,107 @@
+package firmware
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// InfoFileName is the info file UF2 bootloaders expose on their volume.
+const InfoFileName = "INFO_UF2.TXT"
+
+// BootloaderInfo is parsed from a bootloader volume's INFO_UF2.TXT.
+type BootloaderInfo struct {
+	Model   string // e.g. "nice!nano"
+	BoardID string // e.g. "nRF52840-nicenano"
+}
+
+// ReadBootloaderInfo reads INFO_UF2.TXT from a mounted bootloader volume.
+func ReadBootloaderInfo(devicePath string) (BootloaderInfo, error) {
+	f, err := os.Open(filepath.Join(devicePath, InfoFileName))
+	if err != nil {
+		return BootloaderInfo{}, err
+	}
+	defer f.Close()
+
+	var info BootloaderInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Model":
+			info.Model = strings.TrimSpace(value)
+		case "Board-ID":
+			info.BoardID = strings.TrimSpace(value)
+		}
+	}
+	return info, scanner.Err()
+}
+
+// boardRevisionRegex matches a trailing ZMK board revision like "_v2".
+var boardRevisionRegex = regexp.MustCompile(`_v\d+$`)
+
+// normalizeBoard lowercases s and drops everything but letters and digits.
+func normalizeBoard(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// MatchesBoard reports whether the bootloader identifies as the ZMK board,
+// comparing names without case, punctuation or a trailing _vN revision
+// (so nice_nano_v2 matches "Board-ID: nRF52840-nicenano").
+func (i BootloaderInfo) MatchesBoard(board string) bool {
+	want := boardKey(board)
+	if want == "" {
+		return false
+	}
+	return strings.Contains(normalizeBoard(i.BoardID), want) || strings.Contains(normalizeBoard(i.Model), want)
+}
+
+// SideOfBoard returns the one side in sides whose board the bootloader
+// identifies as, or "" when no side or several sides (halves on the same
+// board) match.
+func SideOfBoard(info BootloaderInfo, sides []string, boards map[string]string) string {
+	var match string
+	for _, side := range sides {
+		if !info.MatchesBoard(boards[side]) {
+			continue
+		}
+		if match != "" {
+			return ""
+		}
+		match = side
+	}
+	return match
+}
+
+// CheckSideBoard catches flashing one side's firmware onto another side's
+// controller when sides use different boards (e.g. a dongle). It only fails
+// when the bootloader matches another side's board but not this one's;
+// unknown bootloaders pass.
+func CheckSideBoard(info BootloaderInfo, side string, boards map[string]string) error {
+	board := boards[side]
+	if board == "" || info.MatchesBoard(board) {
+		return nil
+	}
+	for other, otherBoard := range boards {
+		if other == side || otherBoard == board {
+			continue
+		}
+		if info.MatchesBoard(otherBoard) {
+			return fmt.Errorf("connected %s looks like the %s controller (%s), but %s is built for %s",
+				info.Model, other, otherBoard, side, board)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package firmware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBootloaderInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "UF2 Bootloader 0.6.0 lib/nrfx (v2.0.0)\r\nModel: nice!nano\r\nBoard-ID: nRF52840-nicenano\r\nDate: Jan 24 2021\r\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, InfoFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ReadBootloaderInfo(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadBootloaderInfo failed: %v", err)
+	}
+	if info.Model != "nice!nano" || info.BoardID != "nRF52840-nicenano" {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestBootloaderInfo_MatchesBoard(t *testing.T) {
+	nano := BootloaderInfo{Model: "nice!nano", BoardID: "nRF52840-nicenano"}
+	xiao := BootloaderInfo{Model: "Seeed XIAO nRF52840", BoardID: "nRF52840-SeeedXiaoBLE-rev1"}
+
+	tests := []struct {
+		info  BootloaderInfo
+		board string
+		want  bool
+	}{
+		{nano, "nice_nano_v2", true},
+		{nano, "nice_nano", true},
+		{nano, "seeeduino_xiao_ble", false},
+		{xiao, "xiao_ble", true},
+		{xiao, "nice_nano_v2", false},
+		{nano, "", false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.info.MatchesBoard(tc.board); got != tc.want {
+			t.Errorf("%s.MatchesBoard(%q) = %v, want %v", tc.info.Model, tc.board, got, tc.want)
+		}
+	}
+}
+
+func TestSideOfBoard(t *testing.T) {
+	sides := []string{"left", "right", "dongle"}
+	boards := map[string]string{
+		"dongle": "xiao_ble",
+		"left":   "nice_nano_v2",
+		"right":  "nice_nano_v2",
+	}
+	xiao := BootloaderInfo{Model: "Seeed XIAO nRF52840", BoardID: "nRF52840-Seeed-XIAO-BLE"}
+	nano := BootloaderInfo{Model: "nice!nano", BoardID: "nRF52840-nicenano"}
+	unknown := BootloaderInfo{Model: "Something", BoardID: "custom"}
+
+	if got := SideOfBoard(xiao, sides, boards); got != "dongle" {
+		t.Errorf("xiao: got %q, want dongle", got)
+	}
+	if got := SideOfBoard(nano, sides, boards); got != "" {
+		t.Errorf("nice!nano matches both halves: got %q, want \"\"", got)
+	}
+	if got := SideOfBoard(unknown, sides, boards); got != "" {
+		t.Errorf("unknown: got %q, want \"\"", got)
+	}
+}
+
+func TestCheckSideBoard(t *testing.T) {
+	boards := map[string]string{
+		"dongle": "xiao_ble",
+		"left":   "nice_nano_v2",
+		"right":  "nice_nano_v2",
+	}
+	nano := BootloaderInfo{Model: "nice!nano", BoardID: "nRF52840-nicenano"}
+	unknown := BootloaderInfo{Model: "Something", BoardID: "custom"}
+
+	if err := CheckSideBoard(nano, "left", boards); err != nil {
+		t.Errorf("left on nice!nano: unexpected error %v", err)
+	}
+	if err := CheckSideBoard(nano, "dongle", boards); err == nil {
+		t.Error("dongle on nice!nano: expected mismatch error")
+	}
+	if err := CheckSideBoard(unknown, "dongle", boards); err != nil {
+		t.Errorf("unknown bootloader should pass, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// DFUFlasher writes raw .bin images at a flash address with dfu-util, for
+// STM32 and other boards whose bootloader is a USB DFU device rather than
+// a volume to copy to.
+type DFUFlasher struct {
+	address string // e.g. 0x08000000
+	alt     int    // DFU alternate setting, 0 for internal flash
+
+	verify func(ctx context.Context, path string) error
+}
+
+// NewDFUFlasher creates a flasher that downloads images to address
+// through the alternate setting alt.
+func NewDFUFlasher(address string, alt int) *DFUFlasher {
+	return &DFUFlasher{address: address, alt: alt}
+}
+
+// SetVerify sets a check run on the source before it is downloaded, as
+// FlasherOptions.Verify does for copy mode.
+func (f *DFUFlasher) SetVerify(fn func(ctx context.Context, path string) error) {
+	f.verify = fn
+}
+
+// Flash downloads srcPath with dfu-util, then leaves DFU so the board
+// boots the new firmware. dfu-util waits for the bootloader itself;
+// progressFn is called for every output line with the stage it belongs to.
+func (f *DFUFlasher) Flash(ctx context.Context, srcPath string, progressFn func(QMKProgress)) FlashResult {
+	if progressFn == nil {
+		progressFn = func(QMKProgress) {}
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return FlashResult{Success: false, Error: fmt.Errorf("stat source: %w", err)}
+	}
+	if f.verify != nil {
+		if err := f.verify(ctx, srcPath); err != nil {
+			return FlashResult{Success: false, Error: fmt.Errorf("verify source: %w", err)}
+		}
+	}
+	sum, err := FileSHA256(srcPath)
+	if err != nil {
+		return FlashResult{Success: false, Error: fmt.Errorf("hash source: %w", err)}
+	}
+
+	cmd := exec.CommandContext(ctx, "dfu-util", f.args(srcPath)...)
+	if err := runStages(ctx, cmd, "dfu-util", QMKWaitingDevice, progressFn); err != nil {
+		return FlashResult{Success: false, Error: err}
+	}
+	return FlashResult{Success: true, BytesWritten: info.Size(), SHA256: sum, Destination: f.address}
+}
+
+// args returns the dfu-util arguments to download srcPath.
+func (f *DFUFlasher) args(srcPath string) []string {
+	return []string{
+		"--wait",
+		"-a", strconv.Itoa(f.alt),
+		"-s", f.address + ":leave",
+		"-D", srcPath,
+	}
+}
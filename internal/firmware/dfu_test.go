@@ -0,0 +1,100 @@
+package firmware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDFUFlasher_Flash(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+
+	// Fake dfu-util that mimics an STM32 download
+	script := `#!/bin/bash
+echo "args: $@"
+echo "Waiting for device, exit with ctrl-C"
+printf "Download	[=============            ]  50%%        11264 bytes\r"
+printf "Download	[=========================] 100%%        22528 bytes\n"
+echo "Download done."
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "dfu-util"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	src := filepath.Join(tmpDir, "planck.bin")
+	if err := os.WriteFile(src, []byte("test firmware content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []QMKProgress
+	result := NewDFUFlasher("0x08000000", 0).Flash(context.Background(), src, func(p QMKProgress) {
+		updates = append(updates, p)
+	})
+
+	if !result.Success {
+		t.Fatalf("Flash failed: %v", result.Error)
+	}
+	if len(updates) != 5 {
+		t.Fatalf("expected 5 progress updates, got %d: %+v", len(updates), updates)
+	}
+	if want := "args: --wait -a 0 -s 0x08000000:leave -D " + src; updates[0].Output != want {
+		t.Errorf("args line = %q, want %q", updates[0].Output, want)
+	}
+	if updates[1].Stage != QMKWaitingDevice {
+		t.Errorf("wait line stage = %v, want waiting", updates[1].Stage)
+	}
+	if updates[2].Stage != QMKFlashing || updates[2].Percent != 50 {
+		t.Errorf("first download update = %+v, want flashing at 50%%", updates[2])
+	}
+	if updates[3].Percent != 100 {
+		t.Errorf("final percent = %d, want 100", updates[3].Percent)
+	}
+
+	if result.BytesWritten != int64(len("test firmware content")) {
+		t.Errorf("BytesWritten = %d", result.BytesWritten)
+	}
+	if result.SHA256 != "5a480434c0b55f930ae01a7d38579893889eec0be56c478385c941f736f66e89" {
+		t.Errorf("SHA256 = %q", result.SHA256)
+	}
+	if result.Destination != "0x08000000" {
+		t.Errorf("Destination = %q, want the flash address", result.Destination)
+	}
+}
+
+func TestDFUFlasher_Flash_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+	script := `#!/bin/bash
+echo "dfu-util: No DFU capable USB device available"
+exit 74
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "dfu-util"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	src := filepath.Join(tmpDir, "planck.bin")
+	if err := os.WriteFile(src, []byte("test firmware content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewDFUFlasher("0x08000000", 0).Flash(context.Background(), src, nil)
+	if result.Success || result.Error == nil {
+		t.Errorf("expected Flash to fail, got %+v", result)
+	}
+
+	missing := NewDFUFlasher("0x08000000", 0).Flash(context.Background(), filepath.Join(tmpDir, "missing.bin"), nil)
+	if missing.Success || missing.Error == nil {
+		t.Error("expected Flash to fail for a missing image")
+	}
+}
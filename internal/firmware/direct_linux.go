@@ -0,0 +1,25 @@
+//go:build linux
+
+package firmware
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openDirect creates path with O_DIRECT and returns a write buffer of size
+// bytes aligned for it. Filesystems without O_DIRECT support return an error.
+func openDirect(path string, size int) (*os.File, []byte, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_DIRECT, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := make([]byte, size+directAlign)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) & (directAlign - 1))
+	if off != 0 {
+		off = directAlign - off
+	}
+	return f, buf[off : off+size], nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package firmware
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirect is unsupported here; callers fall back to a regular write.
+func openDirect(path string, size int) (*os.File, []byte, error) {
+	return nil, nil, errors.New("O_DIRECT is not supported on this platform")
+}
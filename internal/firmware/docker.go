@@ -1,24 +1,100 @@
 package firmware
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/moby/moby/api/types/jsonstream"
+	"github.com/moby/moby/client"
 )
 
+// Target is a per-side board/shield override.
+// An empty field falls back to the builder's default.
+type Target struct {
+	Board  string
+	Shield string // used as-is, without the side suffix
+}
+
 // DockerBuilder builds ZMK firmware using Docker.
 type DockerBuilder struct {
-	image      string
-	board      string
-	shield     string
-	workingDir string
-	outputDir  string
+	image       string
+	board       string
+	shield      string
+	workingDir  string
+	outputDir   string
+	targets     map[string]Target
+	sides       []string // built in turn for "all"
+	studio      bool
+	runOpts     DockerRunOptions
+	container   string // long-lived container to exec into, empty for docker run --rm
+	pullTimeout time.Duration
+	signer      *Signer // signs each build's manifest, nil to leave builds unsigned
+}
+
+// DockerRunOptions are extra container settings, named after the docker
+// run flags they mirror.
+type DockerRunOptions struct {
+	CPUs    string   // --cpus
+	Memory  string   // --memory
+	Env     []string // -e KEY=value, or -e KEY to pass through from the host
+	Volumes []string // -v host:container[:options]
+	User    string   // --user, see ResolveDockerUser
+}
+
+// ResolveDockerUser maps a build.docker.user setting to a --user value.
+// "auto" is the invoking uid:gid on Linux, where bind-mounted files created
+// in the container would otherwise be owned by root, and empty elsewhere.
+// "none" is empty; anything else is passed through.
+func ResolveDockerUser(setting string) string {
+	switch setting {
+	case "none":
+		return ""
+	case "", "auto":
+		if runtime.GOOS != "linux" {
+			return ""
+		}
+		return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	}
+	return setting
+}
+
+// userArgs returns the docker flags to run as user. HOME points somewhere
+// writable since the uid usually has no home directory in the image.
+func userArgs(user string) []string {
+	if user == "" {
+		return nil
+	}
+	return []string{"--user", user, "-e", "HOME=/tmp"}
+}
+
+// args returns the docker run flags for the options.
+func (o DockerRunOptions) args() []string {
+	args := userArgs(o.User)
+	if o.CPUs != "" {
+		args = append(args, "--cpus", o.CPUs)
+	}
+	if o.Memory != "" {
+		args = append(args, "--memory", o.Memory)
+	}
+	for _, env := range o.Env {
+		args = append(args, "-e", env)
+	}
+	for _, vol := range o.Volumes {
+		args = append(args, "-v", vol)
+	}
+	return args
 }
 
 // NewDockerBuilder creates a new Docker-based builder.
@@ -32,62 +108,287 @@ func NewDockerBuilder(image, board, shield, workingDir, outputDir string) *Docke
 	}
 }
 
-// CheckDocker verifies Docker is installed and running.
+// SetSideTargets sets per-side board/shield overrides.
+func (b *DockerBuilder) SetSideTargets(targets map[string]Target) {
+	b.targets = targets
+}
+
+// SetRunOptions sets extra docker run flags for builds.
+func (b *DockerBuilder) SetRunOptions(opts DockerRunOptions) {
+	b.runOpts = opts
+}
+
+// SetContainer makes builds `docker exec` into a long-lived container with
+// the given name instead of starting a fresh one each time. The container is
+// created with the run options on first use and restarted if stopped.
+func (b *DockerBuilder) SetContainer(name string) {
+	b.container = name
+}
+
+// SetPullTimeout bounds how long EnsureImage waits for docker pull. Zero
+// waits as long as ctx allows.
+func (b *DockerBuilder) SetPullTimeout(d time.Duration) {
+	b.pullTimeout = d
+}
+
+// SetSigner signs the SHA256SUMS manifest after each build. Signers without
+// a key are ignored.
+func (b *DockerBuilder) SetSigner(s *Signer) {
+	if s != nil && !s.CanSign() {
+		s = nil
+	}
+	b.signer = s
+}
+
+// SetSides sets the sides Build builds in turn for "all". Without sides,
+// "all" builds the unsplit shield.
+func (b *DockerBuilder) SetSides(sides []string) {
+	b.sides = sides
+}
+
+// SetStudio enables ZMK Studio support in subsequent builds.
+func (b *DockerBuilder) SetStudio(studio bool) {
+	b.studio = studio
+}
+
+// target returns the board and full shield name to build for side.
+func (b *DockerBuilder) target(side string) (board, shield string) {
+	board = b.board
+	shield = b.shield
+	if side != "" && side != "all" && side != "main" {
+		shield = b.shield + "_" + side
+	}
+
+	if t, ok := b.targets[side]; ok {
+		if t.Board != "" {
+			board = t.Board
+		}
+		if t.Shield != "" {
+			shield = t.Shield
+		}
+	}
+	return board, shield
+}
+
+// outputName returns the firmware file name for side, without extension:
+// <shield>_<side>, or just the side when every side overrides the shield.
+func (b *DockerBuilder) outputName(side string) string {
+	switch {
+	case side == "" || side == "all" || side == "main":
+		return b.shield
+	case b.shield == "":
+		return side
+	}
+	return b.shield + "_" + side
+}
+
+// buildDirName names side's build directory under build/ in the working
+// directory. An unsplit keyboard builds into main.
+func buildDirName(side string) string {
+	if side == "" || side == "all" || side == "main" {
+		return "main"
+	}
+	return side
+}
+
+// CheckDocker verifies the Docker daemon is running and reachable.
 func CheckDocker(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "docker", "info")
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("Docker is not running. Please start Docker Desktop and try again")
+	cli, err := dockerClient()
+	if err != nil {
+		return err
 	}
-	return nil
+	defer cli.Close()
+	_, err = cli.Ping(ctx, client.PingOptions{NegotiateAPIVersion: true})
+	return daemonError(err)
 }
 
-// EnsureImage pulls the Docker image if not present.
-func (b *DockerBuilder) EnsureImage(ctx context.Context, progress func(string)) error {
-	// Check if image exists locally
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", b.image)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	if cmd.Run() == nil {
-		progress("Image ready: " + b.image)
+// ensureContainer starts the long-lived build container, creating it if needed.
+func (b *DockerBuilder) ensureContainer(ctx context.Context, cli *client.Client, workDir string) error {
+	inspect, err := cli.ContainerInspect(ctx, b.container, client.ContainerInspectOptions{})
+	if err == nil {
+		if inspect.Container.State != nil && inspect.Container.State.Running {
+			return nil
+		}
+		if _, err := cli.ContainerStart(ctx, b.container, client.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("cannot start container %s: %w", b.container, err)
+		}
 		return nil
 	}
+	if !cerrdefs.IsNotFound(err) {
+		return daemonError(err)
+	}
 
-	// Pull the image
-	progress("Pulling " + b.image + " (this may take a few minutes)...")
-
-	cmd = exec.CommandContext(ctx, "docker", "pull", b.image)
-	stdout, err := cmd.StdoutPipe()
+	run := dockerRun{image: b.image, cmd: []string{"sleep", "infinity"}, workDir: workDir, opts: b.runOpts}
+	cfg, host, err := run.configs()
 	if err != nil {
 		return err
 	}
-	cmd.Stderr = cmd.Stdout
+	created, err := createContainer(ctx, cli, client.ContainerCreateOptions{Config: cfg, HostConfig: host, Name: b.container})
+	if err != nil {
+		return fmt.Errorf("cannot create container %s: %w", b.container, err)
+	}
+	if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("cannot start container %s: %w", b.container, err)
+	}
+	return nil
+}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+// ErrPullTimeout is returned by EnsureImage when docker pull outlasts the
+// pull timeout.
+var ErrPullTimeout = errors.New("docker pull timed out")
+
+// PullProgress reports a docker pull as it advances.
+type PullProgress struct {
+	Line       string // status change, as docker pull prints it; "" for byte progress
+	Layers     int    // image layers listed so far
+	Done       int    // layers pulled, or already present from an earlier pull
+	Downloaded int64  // bytes of the layers downloading or downloaded
+	Size       int64  // total size of those layers, as far as known
+}
+
+// Summary describes the progress, e.g. "3/9 layers, 45.2 MB of 120 MB"; ""
+// until docker has listed any layers.
+func (p PullProgress) Summary() string {
+	if p.Layers == 0 {
+		return ""
+	}
+	summary := fmt.Sprintf("%d/%d layers", p.Done, p.Layers)
+	if p.Size > 0 {
+		summary += ", " + FormatSize(p.Downloaded) + " of " + FormatSize(p.Size)
 	}
+	return summary
+}
 
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Parse Docker pull progress
-		if strings.Contains(line, "Pulling") || strings.Contains(line, "Download") ||
-			strings.Contains(line, "Pull complete") || strings.Contains(line, "Already exists") {
-			progress(line)
+// pullLayer is the state of one layer of a pull
+type pullLayer struct {
+	status            string
+	done              bool
+	downloaded, total int64
+}
+
+// layerTracker follows the layers of a pull from its progress messages
+type layerTracker struct {
+	layers map[string]*pullLayer
+	order  []string
+}
+
+// update records msg and returns the progress so far
+func (t *layerTracker) update(msg jsonstream.Message) PullProgress {
+	line := msg.Status
+	if msg.ID != "" {
+		line = msg.ID + ": " + msg.Status
+	}
+
+	// Messages about a layer carry its ID; "<tag>: Pulling from <repo>" is
+	// about the image
+	if msg.ID != "" && !strings.HasPrefix(msg.Status, "Pulling from") {
+		if t.layers == nil {
+			t.layers = make(map[string]*pullLayer)
+		}
+		layer, ok := t.layers[msg.ID]
+		if !ok {
+			layer = &pullLayer{}
+			t.layers[msg.ID] = layer
+			t.order = append(t.order, msg.ID)
+		}
+		if msg.Status == layer.status {
+			line = "" // more bytes, already reported as progress
 		}
+		layer.status = msg.Status
+		switch msg.Status {
+		case "Downloading":
+			if msg.Progress != nil {
+				layer.downloaded, layer.total = msg.Progress.Current, msg.Progress.Total
+			}
+		case "Download complete":
+			layer.downloaded = layer.total
+		case "Pull complete", "Already exists":
+			layer.downloaded = layer.total
+			layer.done = true
+		}
+	}
+
+	p := PullProgress{Line: line, Layers: len(t.order)}
+	for _, id := range t.order {
+		layer := t.layers[id]
+		if layer.done {
+			p.Done++
+		}
+		p.Downloaded += layer.downloaded
+		p.Size += layer.total
+	}
+	return p
+}
+
+// EnsureImage pulls the Docker image if not present, reporting each status
+// change and the bytes downloaded. Docker keeps the layers of an
+// interrupted pull, so calling it again resumes.
+func (b *DockerBuilder) EnsureImage(ctx context.Context, progress func(PullProgress)) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
 	}
+	defer cli.Close()
 
-	if err := cmd.Wait(); err != nil {
+	// Check if image exists locally
+	if _, err := cli.ImageInspect(ctx, b.image); err == nil {
+		progress(PullProgress{Line: "Image ready: " + b.image})
+		return nil
+	} else if !cerrdefs.IsNotFound(err) {
+		return daemonError(err)
+	}
+
+	// Pull the image
+	progress(PullProgress{Line: "Pulling " + b.image + " (this may take a few minutes)..."})
+
+	pullCtx := ctx
+	if b.pullTimeout > 0 {
+		var cancel context.CancelFunc
+		pullCtx, cancel = context.WithTimeout(ctx, b.pullTimeout)
+		defer cancel()
+	}
+
+	var tracker layerTracker
+	var last PullProgress
+	err = func() error {
+		resp, err := cli.ImagePull(pullCtx, b.image, client.ImagePullOptions{})
+		if err != nil {
+			return daemonError(err)
+		}
+		for msg, err := range resp.JSONMessages(pullCtx) {
+			if err != nil {
+				return err
+			}
+			if msg.Error != nil {
+				return msg.Error
+			}
+			last = tracker.update(msg)
+			progress(last)
+		}
+		return nil
+	}()
+	if err != nil {
+		if errors.Is(pullCtx.Err(), context.DeadlineExceeded) {
+			pulled := ""
+			if summary := last.Summary(); summary != "" {
+				pulled = " with " + summary + " pulled"
+			}
+			return fmt.Errorf("%w after %s%s; pulled layers are kept, so a retry resumes", ErrPullTimeout, b.pullTimeout, pulled)
+		}
 		return fmt.Errorf("failed to pull image: %w", err)
 	}
 
-	progress("Image ready: " + b.image)
+	last.Line = "Image ready: " + b.image
+	progress(last)
 	return nil
 }
 
-// Build builds firmware for the given side using Docker.
+// Build builds firmware for the given side using Docker, or for each side
+// set with SetSides for "all".
 func (b *DockerBuilder) Build(ctx context.Context, side string, progress func(BuildProgress)) BuildResult {
+	if side == "all" && len(b.sides) > 0 {
+		return combineResults(b.BuildAll(ctx, b.sides, progress))
+	}
 	startTime := time.Now()
 
 	// Resolve working directory to absolute path
@@ -107,84 +408,100 @@ func (b *DockerBuilder) Build(ctx context.Context, side string, progress func(Bu
 		return BuildResult{Success: false, Error: fmt.Errorf("cannot create output directory: %w", err)}
 	}
 
-	// Determine shield name with side suffix
-	shieldName := b.shield
-	if side != "" && side != "all" && side != "main" {
-		shieldName = b.shield + "_" + side
-	}
+	// Determine board and shield name with side suffix
+	board, shieldName := b.target(side)
 
 	// Build directory inside container
-	buildDir := fmt.Sprintf("/workdir/build/%s", side)
-	if side == "" || side == "all" || side == "main" {
-		buildDir = "/workdir/build/main"
-	}
+	buildDir := "/workdir/build/" + buildDirName(side)
 
 	// Construct west build command
 	// west build -s zmk/app -p -b <board> -d <build_dir> -- -DSHIELD=<shield> -DZMK_CONFIG=/workdir/config
-	westCmd := []string{
-		"west", "build",
-		"-s", "zmk/app",
-		"-p", // pristine build
-		"-b", b.board,
-		"-d", buildDir,
+	westCmd := []string{"west", "build", "-s", "zmk/app"}
+	if b.container == "" {
+		// A fresh container starts pristine anyway; the long-lived one
+		// keeps its build directory for incremental builds
+		westCmd = append(westCmd, "-p")
+	}
+	westCmd = append(westCmd, "-b", board, "-d", buildDir)
+	if b.studio {
+		westCmd = append(westCmd, "-S", "studio-rpc-usb-uart")
+	}
+	westCmd = append(westCmd,
 		"--",
-		"-DSHIELD=" + shieldName,
+		"-DSHIELD="+shieldName,
 		"-DZMK_CONFIG=/workdir/config",
+	)
+	if b.studio {
+		westCmd = append(westCmd, "-DCONFIG_ZMK_STUDIO=y")
 	}
 
-	// Docker run command
-	args := []string{
-		"run", "--rm",
-		"-v", workDir + ":/workdir",
-		"-w", "/workdir",
-		b.image,
-	}
-	args = append(args, westCmd...)
-
-	progress(BuildProgress{Percent: 5, Message: "Starting Docker build for " + side})
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	stdout, err := cmd.StdoutPipe()
+	cli, err := dockerClient()
 	if err != nil {
 		return BuildResult{Success: false, Error: err}
 	}
-	cmd.Stderr = cmd.Stdout
-
-	if err := cmd.Start(); err != nil {
-		return BuildResult{Success: false, Error: fmt.Errorf("failed to start Docker: %w", err)}
+	defer cli.Close()
+	if b.container != "" {
+		if err := b.ensureContainer(ctx, cli, workDir); err != nil {
+			return BuildResult{Success: false, Error: err}
+		}
 	}
 
-	// Parse ninja progress
+	progress(BuildProgress{
+		Stage:   BuildConfiguring,
+		Percent: BuildConfiguring.Percent(0, 1),
+		Message: "Starting Docker build for " + side,
+	})
+
+	// Run in a fresh container, or exec into the long-lived one
+	scanner, wait := outputLines(func(w io.Writer) error {
+		if b.container != "" {
+			return execContainer(ctx, cli, b.container, westCmd, w, w)
+		}
+		return runContainer(ctx, cli, dockerRun{image: b.image, cmd: westCmd, workDir: workDir, opts: b.runOpts}, w, w)
+	})
+
+	// Everything before ninja's first [current/total] is CMake configuring
 	ninjaRe := regexp.MustCompile(`\[(\d+)/(\d+)\]`)
-	scanner := bufio.NewScanner(stdout)
+	stage := BuildConfiguring
+	var configureLines int
+	var warnings []string
 	for scanner.Scan() {
 		line := scanner.Text()
+		warnings = addWarning(warnings, line)
 
 		// Parse ninja progress: [current/total]
 		if matches := ninjaRe.FindStringSubmatch(line); len(matches) == 3 {
 			var current, total int
 			fmt.Sscanf(matches[1], "%d", &current)
 			fmt.Sscanf(matches[2], "%d", &total)
+			stage = BuildCompiling
+			percent := -1
 			if total > 0 {
-				pct := 10 + (current * 85 / total) // 10-95%
-				progress(BuildProgress{Percent: pct, Message: line})
+				percent = stage.Percent(current, total)
 			}
+			progress(BuildProgress{Stage: stage, Percent: percent, Output: line, Message: line})
 		} else if strings.Contains(line, "error:") || strings.Contains(line, "Error:") {
-			progress(BuildProgress{Percent: -1, Message: line})
+			progress(BuildProgress{Stage: stage, Percent: -1, Output: line, Message: line})
+		} else if stage == BuildConfiguring {
+			configureLines++
+			progress(BuildProgress{
+				Stage:   stage,
+				Percent: stage.Percent(configureLines, configureLines+configureSteps),
+				Output:  line,
+			})
+		} else {
+			progress(BuildProgress{Stage: stage, Percent: -1, Output: line})
 		}
 	}
 
-	if err := cmd.Wait(); err != nil {
-		return BuildResult{Success: false, Error: fmt.Errorf("build failed: %w", err), Duration: time.Since(startTime)}
+	if err := wait(); err != nil {
+		return BuildResult{Success: false, Error: fmt.Errorf("build failed: %w", err), Duration: time.Since(startTime), Warnings: warnings}
 	}
 
-	progress(BuildProgress{Percent: 95, Message: "Copying firmware..."})
+	progress(BuildProgress{Stage: BuildCopying, Percent: BuildCopying.Percent(0, 1), Message: "Copying firmware..."})
 
 	// Copy UF2 from build directory to output
-	uf2Path := filepath.Join(workDir, "build", side, "zephyr", "zmk.uf2")
-	if side == "" || side == "all" || side == "main" {
-		uf2Path = filepath.Join(workDir, "build", "main", "zephyr", "zmk.uf2")
-	}
+	uf2Path := filepath.Join(workDir, "build", buildDirName(side), "zephyr", "zmk.uf2")
 
 	// Create dated output directory
 	dateStr := time.Now().Format("20060102")
@@ -193,11 +510,11 @@ func (b *DockerBuilder) Build(ctx context.Context, side string, progress func(Bu
 		return BuildResult{Success: false, Error: fmt.Errorf("cannot create dated output directory: %w", err)}
 	}
 
-	// Determine output filename
-	outputName := fmt.Sprintf("%s_%s.uf2", b.shield, side)
-	if side == "" || side == "all" || side == "main" {
-		outputName = b.shield + ".uf2"
+	outputName := b.outputName(side)
+	if b.studio {
+		outputName += StudioSuffix
 	}
+	outputName += ".uf2"
 	outputPath := filepath.Join(datedOutputDir, outputName)
 
 	// Copy the file
@@ -208,14 +525,105 @@ func (b *DockerBuilder) Build(ctx context.Context, side string, progress func(Bu
 	if err := os.WriteFile(outputPath, data, 0644); err != nil {
 		return BuildResult{Success: false, Error: fmt.Errorf("cannot write firmware to output: %w", err)}
 	}
+	if err := UpdateManifest(outputPath); err != nil {
+		return BuildResult{Success: false, Error: fmt.Errorf("cannot write checksum manifest: %w", err)}
+	}
+	if b.signer != nil {
+		if err := b.signer.Sign(ctx, datedOutputDir); err != nil {
+			return BuildResult{Success: false, Error: err}
+		}
+	}
 
-	progress(BuildProgress{Percent: 100, Message: "Build complete: " + outputName})
+	progress(BuildProgress{Stage: BuildCopying, Percent: 100, Message: "Build complete: " + outputName})
 
 	return BuildResult{
 		Success:    true,
 		Duration:   time.Since(startTime),
 		OutputPath: outputPath,
+		Warnings:   warnings,
+	}
+}
+
+// volumeNameRegex matches the named volumes docker accepts in -v, as opposed
+// to host paths.
+var volumeNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// namedVolumes returns the names of the named volumes among -v mounts.
+func namedVolumes(mounts []string) []string {
+	var names []string
+	for _, mount := range mounts {
+		if src, _, ok := strings.Cut(mount, ":"); ok && volumeNameRegex.MatchString(src) {
+			names = append(names, src)
+		}
 	}
+	return names
+}
+
+// Clean removes side's build directory, so the next build starts from
+// scratch. "all" removes the whole build directory, along with the
+// long-lived container and the named volumes among the run options, such as
+// a ccache. Files the container created as root are removed in a container.
+func (b *DockerBuilder) Clean(ctx context.Context, side string) error {
+	workDir, err := filepath.Abs(b.workingDir)
+	if err != nil {
+		return fmt.Errorf("invalid working directory: %w", err)
+	}
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	dir := "build/" + buildDirName(side)
+	if side == "all" {
+		dir = "build"
+		// The container keeps the volumes in use
+		if b.container != "" {
+			if _, err := cli.ContainerRemove(ctx, b.container, client.ContainerRemoveOptions{Force: true}); err != nil && !cerrdefs.IsNotFound(err) {
+				return fmt.Errorf("cannot remove container %s: %w", b.container, daemonError(err))
+			}
+		}
+		for _, name := range namedVolumes(b.runOpts.Volumes) {
+			if _, err := cli.VolumeRemove(ctx, name, client.VolumeRemoveOptions{}); err != nil && !cerrdefs.IsNotFound(err) {
+				return fmt.Errorf("cannot remove volume %s: %w", name, daemonError(err))
+			}
+		}
+	}
+
+	err = os.RemoveAll(filepath.Join(workDir, filepath.FromSlash(dir)))
+	if !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	var stderr bytes.Buffer
+	run := dockerRun{image: b.image, cmd: []string{"rm", "-rf", "/workdir/" + dir}, workDir: workDir}
+	if err := runContainer(ctx, cli, run, io.Discard, &stderr); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("cannot remove %s: %w: %s", dir, err, lastLine(msg))
+		}
+		return fmt.Errorf("cannot remove %s: %w", dir, err)
+	}
+	return nil
+}
+
+// combineResults reports the builds of several sides as one, failing with
+// the first failure. The output path is the last side's, in the same dated
+// directory as the others.
+func combineResults(results []BuildResult) BuildResult {
+	combined := BuildResult{Success: true}
+	for _, r := range results {
+		combined.Duration += r.Duration
+		for _, w := range r.Warnings {
+			if !slices.Contains(combined.Warnings, w) {
+				combined.Warnings = append(combined.Warnings, w)
+			}
+		}
+		if !r.Success {
+			combined.Success, combined.Error = false, r.Error
+			break
+		}
+		combined.OutputPath = r.OutputPath
+	}
+	return combined
 }
 
 // BuildAll builds firmware for all sides (for split keyboards).
@@ -226,7 +634,10 @@ func (b *DockerBuilder) BuildAll(ctx context.Context, sides []string, progress f
 		sideProgress := func(p BuildProgress) {
 			// Scale progress for this side
 			scaledPercent := basePercent + (p.Percent * 100 / len(sides) / 100)
-			progress(BuildProgress{Percent: scaledPercent, Message: fmt.Sprintf("[%s] %s", side, p.Message)})
+			if p.Percent < 0 {
+				scaledPercent = -1
+			}
+			progress(BuildProgress{Percent: scaledPercent, Stage: p.Stage, Output: p.Output, Message: fmt.Sprintf("[%s] %s", side, p.Message)})
 		}
 		results[i] = b.Build(ctx, side, sideProgress)
 		if !results[i].Success {
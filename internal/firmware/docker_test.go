@@ -0,0 +1,534 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/dockertest"
+	"github.com/moby/moby/api/types/jsonstream"
+)
+
+func TestDockerBuilder_Target(t *testing.T) {
+	b := NewDockerBuilder("image", "nice_nano_v2", "corne", ".", "firmware")
+	b.SetSideTargets(map[string]Target{
+		"dongle": {Board: "xiao_ble", Shield: "corne_dongle"},
+		"right":  {Board: "nice_nano"},
+	})
+
+	tests := []struct {
+		side, board, shield string
+	}{
+		{"left", "nice_nano_v2", "corne_left"},
+		{"right", "nice_nano", "corne_right"},
+		{"dongle", "xiao_ble", "corne_dongle"},
+		{"main", "nice_nano_v2", "corne"},
+	}
+
+	for _, tc := range tests {
+		board, shield := b.target(tc.side)
+		if board != tc.board || shield != tc.shield {
+			t.Errorf("target(%q) = %s/%s, want %s/%s", tc.side, board, shield, tc.board, tc.shield)
+		}
+	}
+}
+
+func TestDockerBuilder_OutputName(t *testing.T) {
+	b := NewDockerBuilder("image", "nice_nano_v2", "corne", ".", "firmware")
+	if got := b.outputName("left"); got != "corne_left" {
+		t.Errorf("outputName(left) = %q, want corne_left", got)
+	}
+	if got := b.outputName("main"); got != "corne" {
+		t.Errorf("outputName(main) = %q, want corne", got)
+	}
+
+	// Sides that all override the shield are named after the side
+	b = NewDockerBuilder("image", "nice_nano_v2", "", ".", "firmware")
+	b.SetSideTargets(map[string]Target{"left": {Shield: "corne_left nice_view"}})
+	if got := b.outputName("left"); got != "left" {
+		t.Errorf("outputName(left) without build.shield = %q, want left", got)
+	}
+}
+
+func TestDockerRunOptions_Args(t *testing.T) {
+	opts := DockerRunOptions{
+		CPUs:    "2",
+		Memory:  "4g",
+		Env:     []string{"FOO=bar", "TOKEN"},
+		Volumes: []string{"/modules:/modules:ro"},
+	}
+
+	want := []string{"--cpus", "2", "--memory", "4g", "-e", "FOO=bar", "-e", "TOKEN", "-v", "/modules:/modules:ro"}
+	if got := opts.args(); !slices.Equal(got, want) {
+		t.Errorf("args() = %v, want %v", got, want)
+	}
+
+	if got := (DockerRunOptions{}).args(); len(got) != 0 {
+		t.Errorf("empty options args() = %v, want none", got)
+	}
+}
+
+func TestDockerRunOptions_User(t *testing.T) {
+	got := DockerRunOptions{User: "1000:1000", CPUs: "2"}.args()
+	want := []string{"--user", "1000:1000", "-e", "HOME=/tmp", "--cpus", "2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("args() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveDockerUser(t *testing.T) {
+	auto := ""
+	if runtime.GOOS == "linux" {
+		auto = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	}
+
+	tests := []struct {
+		setting string
+		want    string
+	}{
+		{"auto", auto},
+		{"", auto},
+		{"none", ""},
+		{"1001:1001", "1001:1001"},
+	}
+	for _, tt := range tests {
+		if got := ResolveDockerUser(tt.setting); got != tt.want {
+			t.Errorf("ResolveDockerUser(%q) = %q, want %q", tt.setting, got, tt.want)
+		}
+	}
+}
+
+// writeUF2 "builds" the firmware for side in workDir, as west would
+func writeUF2(p *dockertest.Process, side string) {
+	dir := filepath.Join(p.Container.Mount("/workdir"), "build", side, "zephyr")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "zmk.uf2"), []byte("uf2"), 0644)
+}
+
+func TestDockerRun_Configs(t *testing.T) {
+	t.Setenv("TOKEN", "secret")
+	run := dockerRun{
+		image:   "zmk-image",
+		cmd:     []string{"west", "update"},
+		workDir: "/zmk",
+		opts: DockerRunOptions{
+			CPUs:    "1.5",
+			Memory:  "4g",
+			Env:     []string{"FOO=bar", "TOKEN", "UNSET_VAR"},
+			Volumes: []string{"/modules:/modules:ro"},
+			User:    "1000:1000",
+		},
+	}
+
+	cfg, host, err := run.configs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"HOME=/tmp", "FOO=bar", "TOKEN=secret"}; !slices.Equal(cfg.Env, want) {
+		t.Errorf("Env = %q, want %q", cfg.Env, want)
+	}
+	if want := []string{"/zmk:/workdir", "/modules:/modules:ro"}; !slices.Equal(host.Binds, want) {
+		t.Errorf("Binds = %q, want %q", host.Binds, want)
+	}
+	if host.NanoCPUs != 1.5e9 || host.Memory != 4<<30 {
+		t.Errorf("NanoCPUs, Memory = %d, %d; want 1.5 CPUs and 4 GiB", host.NanoCPUs, host.Memory)
+	}
+	if cfg.User != "1000:1000" || cfg.WorkingDir != "/workdir" || cfg.OpenStdin {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	run.opts.Memory = "lots"
+	if _, _, err := run.configs(); err == nil {
+		t.Error("expected an invalid memory limit to fail")
+	}
+}
+
+func TestDockerBuilder_Build_Container(t *testing.T) {
+	engine := dockertest.Start(t)
+	var pristine bool
+	engine.Run = func(p *dockertest.Process) int {
+		if p.Cmd[0] == "sleep" {
+			<-p.Stopped
+			return 137
+		}
+		pristine = pristine || slices.Contains(p.Cmd, "-p")
+		writeUF2(p, "left")
+		return 0
+	}
+	engine.Images["zmk-image:latest"] = true
+	workDir := t.TempDir()
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", workDir, t.TempDir())
+	b.SetRunOptions(DockerRunOptions{CPUs: "2"})
+	b.SetContainer("kbflash-corne")
+
+	for range 2 {
+		result := b.Build(context.Background(), "left", func(BuildProgress) {})
+		if !result.Success {
+			t.Fatalf("Build failed: %v", result.Error)
+		}
+	}
+
+	c := engine.Container("kbflash-corne")
+	if c == nil {
+		t.Fatal("no kbflash-corne container was created")
+	}
+	if c.Mount("/workdir") != workDir || c.Host.NanoCPUs != 2e9 || !slices.Equal(c.Config.Cmd, []string{"sleep", "infinity"}) {
+		t.Errorf("container = %+v, %+v; want %s mounted with 2 CPUs", c.Config, c.Host, workDir)
+	}
+	var creates, execs int
+	for _, call := range engine.Calls() {
+		switch {
+		case call == "POST /containers/create":
+			creates++
+		case strings.HasSuffix(call, "/exec"):
+			execs++
+		}
+	}
+	if creates != 1 || execs != 2 {
+		t.Errorf("calls = %q, want the container created once and exec'd into per build", engine.Calls())
+	}
+	if pristine {
+		t.Error("builds in the long-lived container were pristine, losing the incremental build")
+	}
+}
+
+func TestDockerBuilder_Build_Output(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		fmt.Fprintln(p.Stdout, "-- Zephyr version: 3.5.0")
+		fmt.Fprintln(p.Stdout, "[1/2] Building C object main.c.obj")
+		fmt.Fprintln(p.Stderr, "note: in expansion of macro")
+		fmt.Fprintln(p.Stdout, "[2/2] Linking C executable zmk.elf")
+		writeUF2(p, "left")
+		return 0
+	}
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", t.TempDir(), t.TempDir())
+	var output []string
+	result := b.Build(context.Background(), "left", func(p BuildProgress) {
+		if p.Output != "" {
+			output = append(output, p.Output)
+		}
+	})
+	if !result.Success {
+		t.Fatalf("Build failed: %v", result.Error)
+	}
+
+	want := []string{
+		"-- Zephyr version: 3.5.0",
+		"[1/2] Building C object main.c.obj",
+		"note: in expansion of macro",
+		"[2/2] Linking C executable zmk.elf",
+	}
+	if !slices.Equal(output, want) {
+		t.Errorf("output = %q, want every line %q", output, want)
+	}
+	if engine.Containers() != 0 {
+		t.Error("the build container was not removed")
+	}
+}
+
+func TestDockerBuilder_Build_AllSides(t *testing.T) {
+	engine := dockertest.Start(t)
+	var shields []string
+	engine.Run = func(p *dockertest.Process) int {
+		shields = append(shields, p.Cmd[len(p.Cmd)-2])
+		side := filepath.Base(p.Cmd[slices.Index(p.Cmd, "-d")+1])
+		writeUF2(p, side)
+		return 0
+	}
+
+	outputDir := t.TempDir()
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", t.TempDir(), outputDir)
+	b.SetSides([]string{"left", "right"})
+	result := b.Build(context.Background(), "all", func(BuildProgress) {})
+	if !result.Success {
+		t.Fatalf("Build failed: %v", result.Error)
+	}
+	if want := []string{"-DSHIELD=corne_left", "-DSHIELD=corne_right"}; !slices.Equal(shields, want) {
+		t.Errorf("built %q, want every side %q", shields, want)
+	}
+	for _, name := range []string{"corne_left.uf2", "corne_right.uf2"} {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(result.OutputPath), name)); err != nil {
+			t.Errorf("%s was not built: %v", name, err)
+		}
+	}
+}
+
+func TestDockerBuilder_Build_Signed(t *testing.T) {
+	fakeMinisign(t)
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		writeUF2(p, "left")
+		return 0
+	}
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "keys"), 0755)
+	os.WriteFile(filepath.Join(root, "keys", "alice"), []byte("secret"), 0600)
+	signer := NewSigner("minisign", filepath.Join(root, "keys", "alice"), []string{"RWalice"})
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", t.TempDir(), filepath.Join(root, "firmware"))
+	b.SetSigner(signer)
+	result := b.Build(context.Background(), "left", func(BuildProgress) {})
+	if !result.Success {
+		t.Fatalf("Build failed: %v", result.Error)
+	}
+	if err := signer.Verify(context.Background(), result.OutputPath); err != nil {
+		t.Errorf("the build is not signed: %v", err)
+	}
+}
+
+func TestDockerBuilder_Build_Failure(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		fmt.Fprintln(p.Stderr, "error: shield corne_left not found")
+		return 2
+	}
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", t.TempDir(), t.TempDir())
+	result := b.Build(context.Background(), "left", func(BuildProgress) {})
+	if result.Success || !strings.Contains(result.Error.Error(), "exit status 2") {
+		t.Errorf("Build() error = %v, want exit status 2", result.Error)
+	}
+}
+
+func TestDockerBuilder_Build_Cancel(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		fmt.Fprintln(p.Stdout, "[1/200] Building C object main.c.obj")
+		<-p.Stopped
+		return 143
+	}
+
+	// Cancel once the build is under way
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", t.TempDir(), t.TempDir())
+	result := b.Build(ctx, "left", func(p BuildProgress) {
+		if p.Output != "" {
+			cancel()
+		}
+	})
+	if result.Success || !errors.Is(result.Error, context.Canceled) {
+		t.Fatalf("Build() error = %v, want it cancelled", result.Error)
+	}
+	if !slices.ContainsFunc(engine.Calls(), func(call string) bool { return strings.HasSuffix(call, "/stop") }) {
+		t.Errorf("calls = %q, want the container stopped", engine.Calls())
+	}
+	if engine.Containers() != 0 {
+		t.Error("the cancelled container was not removed")
+	}
+}
+
+func TestNamedVolumes(t *testing.T) {
+	got := namedVolumes([]string{"zmk-ccache:/root/.ccache", "/modules:/modules:ro", "./zmk:/zmk", "C:\\zmk:/zmk", "zmk-cache"})
+	if want := []string{"zmk-ccache"}; !slices.Equal(got, want) {
+		t.Errorf("namedVolumes() = %q, want %q", got, want)
+	}
+}
+
+func TestDockerBuilder_Clean(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Volumes["zmk-ccache"] = true
+	engine.AddContainer("kbflash-corne", true)
+	workDir := t.TempDir()
+	for _, side := range []string{"left", "right"} {
+		if err := os.MkdirAll(filepath.Join(workDir, "build", side, "zephyr"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", workDir, t.TempDir())
+	b.SetRunOptions(DockerRunOptions{Volumes: []string{"zmk-ccache:/root/.ccache", "/modules:/modules:ro"}})
+	b.SetContainer("kbflash-corne")
+
+	if err := b.Clean(context.Background(), "left"); err != nil {
+		t.Fatalf("Clean(left) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "left")); !os.IsNotExist(err) {
+		t.Error("build/left was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "right")); err != nil {
+		t.Error("cleaning left removed build/right")
+	}
+	if !engine.Volumes["zmk-ccache"] || engine.Container("kbflash-corne") == nil {
+		t.Fatal("cleaning one side removed the shared volume or container")
+	}
+
+	if err := b.Clean(context.Background(), "all"); err != nil {
+		t.Fatalf("Clean(all) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build")); !os.IsNotExist(err) {
+		t.Error("build was not removed for all")
+	}
+	if engine.Volumes["zmk-ccache"] || engine.Container("kbflash-corne") != nil {
+		t.Error("cleaning all kept the ccache volume or the build container")
+	}
+
+	// Nothing left to clean is not an error
+	if err := b.Clean(context.Background(), "all"); err != nil {
+		t.Errorf("second Clean(all) error = %v", err)
+	}
+}
+
+func TestDockerBuilder_Clean_RootOwned(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs file permissions to deny the removal")
+	}
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		// Stands in for root in the container
+		dir := filepath.Join(p.Container.Mount("/workdir"), strings.TrimPrefix(p.Cmd[2], "/workdir/"))
+		os.Chmod(filepath.Join(dir, "zephyr"), 0755)
+		if p.Container.Config.User != "" || os.RemoveAll(dir) != nil {
+			return 1
+		}
+		return 0
+	}
+	workDir := t.TempDir()
+	zephyr := filepath.Join(workDir, "build", "left", "zephyr")
+	if err := os.MkdirAll(zephyr, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(zephyr, "zmk.uf2"), []byte("uf2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(zephyr, 0555)
+	t.Cleanup(func() { os.Chmod(zephyr, 0755) })
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", workDir, t.TempDir())
+	b.SetRunOptions(DockerRunOptions{User: "1000:1000"})
+	if err := b.Clean(context.Background(), "left"); err != nil {
+		t.Fatalf("Clean(left) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "left")); !os.IsNotExist(err) {
+		t.Error("build/left was not removed")
+	}
+}
+
+func TestCheckDocker_NotRunning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "docker.sock"))
+
+	err := CheckDocker(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Docker is not running") {
+		t.Errorf("CheckDocker() error = %v, want Docker is not running", err)
+	}
+}
+
+func TestCheckDocker(t *testing.T) {
+	dockertest.Start(t)
+	if err := CheckDocker(context.Background()); err != nil {
+		t.Errorf("CheckDocker() error = %v", err)
+	}
+}
+
+// downloading is a layer's byte progress message
+func downloading(id string, current, total int64) jsonstream.Message {
+	return jsonstream.Message{ID: id, Status: "Downloading", Progress: &jsonstream.Progress{Current: current, Total: total}}
+}
+
+func TestDockerBuilder_EnsureImage_Layers(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Pull = func(ctx context.Context, image string, send func(jsonstream.Message)) error {
+		send(jsonstream.Message{ID: "stable", Status: "Pulling from zmkfirmware/zmk-dev-arm"})
+		send(jsonstream.Message{ID: "a1b2c3d4e5f6", Status: "Already exists"})
+		send(jsonstream.Message{ID: "0123456789ab", Status: "Pulling fs layer"})
+		send(jsonstream.Message{ID: "fedcba987654", Status: "Pulling fs layer"})
+		send(downloading("0123456789ab", 1000, 4000))
+		send(downloading("0123456789ab", 4000, 4000))
+		send(jsonstream.Message{ID: "0123456789ab", Status: "Pull complete"})
+		send(downloading("fedcba987654", 2000, 6000))
+		send(jsonstream.Message{ID: "fedcba987654", Status: "Pull complete"})
+		return nil
+	}
+
+	b := NewDockerBuilder("zmkfirmware/zmk-dev-arm:stable", "nice_nano_v2", "corne", ".", "firmware")
+	var lines, summaries []string
+	err := b.EnsureImage(context.Background(), func(p PullProgress) {
+		if p.Line != "" {
+			lines = append(lines, p.Line)
+		}
+		summaries = append(summaries, fmt.Sprintf("%d/%d %d/%d", p.Done, p.Layers, p.Downloaded, p.Size))
+	})
+	if err != nil {
+		t.Fatalf("EnsureImage() error = %v", err)
+	}
+
+	wantLines := []string{
+		"Pulling zmkfirmware/zmk-dev-arm:stable (this may take a few minutes)...",
+		"stable: Pulling from zmkfirmware/zmk-dev-arm",
+		"a1b2c3d4e5f6: Already exists",
+		"0123456789ab: Pulling fs layer",
+		"fedcba987654: Pulling fs layer",
+		"0123456789ab: Downloading",
+		"0123456789ab: Pull complete",
+		"fedcba987654: Downloading",
+		"fedcba987654: Pull complete",
+		"Status: Downloaded newer image for zmkfirmware/zmk-dev-arm:stable",
+		"Image ready: zmkfirmware/zmk-dev-arm:stable",
+	}
+	if !slices.Equal(lines, wantLines) {
+		t.Errorf("lines = %q, want %q", lines, wantLines)
+	}
+	wantSummaries := []string{
+		"0/0 0/0", "0/0 0/0", "1/1 0/0", "1/2 0/0", "1/3 0/0",
+		"1/3 1000/4000", "1/3 4000/4000", "2/3 4000/4000", "2/3 6000/10000", "3/3 10000/10000",
+		"3/3 10000/10000", "3/3 10000/10000",
+	}
+	if !slices.Equal(summaries, wantSummaries) {
+		t.Errorf("progress = %q, want %q", summaries, wantSummaries)
+	}
+
+	// Pulled once, the image is ready straight away
+	lines = nil
+	if err := b.EnsureImage(context.Background(), func(p PullProgress) { lines = append(lines, p.Line) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != "Image ready: zmkfirmware/zmk-dev-arm:stable" {
+		t.Errorf("lines = %q, want the image ready without a pull", lines)
+	}
+}
+
+func TestDockerBuilder_EnsureImage_Failure(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Pull = func(ctx context.Context, image string, send func(jsonstream.Message)) error {
+		return errors.New("manifest unknown")
+	}
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", ".", "firmware")
+	err := b.EnsureImage(context.Background(), func(PullProgress) {})
+	if err == nil || !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("EnsureImage() error = %v, want the daemon's error", err)
+	}
+}
+
+func TestDockerBuilder_EnsureImage_Timeout(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Pull = func(ctx context.Context, image string, send func(jsonstream.Message)) error {
+		send(jsonstream.Message{ID: "a1b2c3d4e5f6", Status: "Pull complete"})
+		send(downloading("0123456789ab", 1<<20, 4<<20))
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	b := NewDockerBuilder("zmk-image", "nice_nano_v2", "corne", ".", "firmware")
+	b.SetPullTimeout(100 * time.Millisecond)
+	err := b.EnsureImage(context.Background(), func(PullProgress) {})
+	if !errors.Is(err, ErrPullTimeout) {
+		t.Fatalf("EnsureImage() error = %v, want ErrPullTimeout", err)
+	}
+	if !strings.Contains(err.Error(), "1/2 layers, 1.0 MB of 4.0 MB") {
+		t.Errorf("error %q does not say how far the pull got", err)
+	}
+}
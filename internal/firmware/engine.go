@@ -0,0 +1,341 @@
+package firmware
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/go-units"
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+// stopTimeout is how long a cancelled container gets to exit before it is
+// killed.
+const stopTimeout = 5 * time.Second
+
+// dockerClient connects to the Docker daemon the docker CLI would use:
+// DOCKER_HOST when set, otherwise the endpoint of the current docker
+// context (Docker Desktop and colima listen on a per-user socket), falling
+// back to the default socket.
+func dockerClient() (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if os.Getenv(client.EnvOverrideHost) == "" {
+		if host := contextHost(); host != "" {
+			opts = append(opts, client.WithHost(host))
+		}
+	}
+	cli, err := client.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host: %w", err)
+	}
+	return cli, nil
+}
+
+// contextHost returns the daemon endpoint of the current docker context, or
+// "" for the default context.
+func contextHost() string {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	name := os.Getenv("DOCKER_CONTEXT")
+	if name == "" {
+		var cfg struct {
+			CurrentContext string `json:"currentContext"`
+		}
+		data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+		if err != nil || json.Unmarshal(data, &cfg) != nil {
+			return ""
+		}
+		name = cfg.CurrentContext
+	}
+	if name == "" || name == "default" {
+		return ""
+	}
+
+	// Context metadata lives in a directory named after the name's digest
+	digest := sha256.Sum256([]byte(name))
+	data, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(digest[:]), "meta.json"))
+	if err != nil {
+		return ""
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host string `json:"Host"`
+		} `json:"Endpoints"`
+	}
+	if json.Unmarshal(data, &meta) != nil {
+		return ""
+	}
+	return meta.Endpoints["docker"].Host
+}
+
+// daemonError explains a failure to reach the Docker daemon.
+func daemonError(err error) error {
+	if err == nil || !client.IsErrConnectionFailed(err) {
+		return err
+	}
+	if strings.Contains(err.Error(), "permission denied") {
+		return fmt.Errorf("%w: add yourself to the docker group (sudo usermod -aG docker $USER) and log in again", err)
+	}
+	return fmt.Errorf("Docker is not running. Please start Docker Desktop and try again (%w)", err)
+}
+
+// dockerRun describes a throwaway container, like the flags of docker run.
+type dockerRun struct {
+	image   string
+	cmd     []string
+	workDir string // absolute host directory mounted at /workdir and run in
+	opts    DockerRunOptions
+	stdin   []byte // written to the container's stdin, as with docker run -i
+}
+
+// args returns the docker run command line equivalent to r, for logging.
+func (r dockerRun) args() []string {
+	args := []string{"docker", "run", "--rm"}
+	if r.stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(args, "-v", r.workDir+":/workdir", "-w", "/workdir")
+	args = append(args, r.opts.args()...)
+	args = append(args, r.image)
+	return append(args, r.cmd...)
+}
+
+// configs returns the container and host configs for r.
+func (r dockerRun) configs() (*container.Config, *container.HostConfig, error) {
+	cfg := &container.Config{
+		Image:        r.image,
+		Cmd:          r.cmd,
+		WorkingDir:   "/workdir",
+		User:         r.opts.User,
+		Env:          r.opts.env(),
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	if r.stdin != nil {
+		cfg.AttachStdin = true
+		cfg.OpenStdin = true
+		cfg.StdinOnce = true
+	}
+
+	host := &container.HostConfig{
+		Binds: append([]string{r.workDir + ":/workdir"}, r.opts.Volumes...),
+	}
+	if r.opts.CPUs != "" {
+		cpus, err := strconv.ParseFloat(r.opts.CPUs, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CPU limit %q", r.opts.CPUs)
+		}
+		host.NanoCPUs = int64(cpus * 1e9)
+	}
+	if r.opts.Memory != "" {
+		memory, err := units.RAMInBytes(r.opts.Memory)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid memory limit %q", r.opts.Memory)
+		}
+		host.Memory = memory
+	}
+	return cfg, host, nil
+}
+
+// env returns the container environment for the options. Bare names pass
+// the host's value through and are left out when it is unset, as docker
+// run -e does.
+func (o DockerRunOptions) env() []string {
+	var env []string
+	if o.User != "" {
+		// The uid usually has no home directory in the image
+		env = append(env, "HOME=/tmp")
+	}
+	for _, e := range o.Env {
+		if strings.Contains(e, "=") {
+			env = append(env, e)
+		} else if value, ok := os.LookupEnv(e); ok {
+			env = append(env, e+"="+value)
+		}
+	}
+	return env
+}
+
+// runContainer runs r to completion, streaming its stdout and stderr as they
+// are written, and removes the container. Cancelling ctx stops it.
+func runContainer(ctx context.Context, cli *client.Client, r dockerRun, stdout, stderr io.Writer) error {
+	cfg, host, err := r.configs()
+	if err != nil {
+		return err
+	}
+	created, err := createContainer(ctx, cli, client.ContainerCreateOptions{Config: cfg, HostConfig: host})
+	if err != nil {
+		return daemonError(err)
+	}
+	id := created.ID
+	defer cli.ContainerRemove(context.WithoutCancel(ctx), id, client.ContainerRemoveOptions{Force: true})
+
+	// Attach before starting so no output is missed
+	attach, err := cli.ContainerAttach(ctx, id, client.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  r.stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return daemonError(err)
+	}
+	defer attach.Close()
+
+	if _, err := cli.ContainerStart(ctx, id, client.ContainerStartOptions{}); err != nil {
+		return err
+	}
+	if r.stdin != nil {
+		go func() {
+			attach.Conn.Write(r.stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	if err := copyOutput(ctx, attach.HijackedResponse, stdout, stderr, func() { stopContainer(cli, id) }); err != nil {
+		return err
+	}
+
+	wait := cli.ContainerWait(ctx, id, client.ContainerWaitOptions{Condition: container.WaitConditionNotRunning})
+	select {
+	case result := <-wait.Result:
+		if result.Error != nil {
+			return fmt.Errorf("container failed: %s", result.Error.Message)
+		}
+		if result.StatusCode != 0 {
+			return fmt.Errorf("exit status %d", result.StatusCode)
+		}
+		return nil
+	case err := <-wait.Error:
+		return err
+	}
+}
+
+// createContainer creates a container, pulling its image first when it is
+// missing, as docker run does; the daemon never pulls on create.
+func createContainer(ctx context.Context, cli *client.Client, opts client.ContainerCreateOptions) (client.ContainerCreateResult, error) {
+	created, err := cli.ContainerCreate(ctx, opts)
+	if !cerrdefs.IsNotFound(err) {
+		return created, err
+	}
+	if err := pullImage(ctx, cli, opts.Config.Image); err != nil {
+		return created, err
+	}
+	return cli.ContainerCreate(ctx, opts)
+}
+
+// pullImage pulls image, waiting for the pull to finish.
+func pullImage(ctx context.Context, cli *client.Client, image string) error {
+	resp, err := cli.ImagePull(ctx, image, client.ImagePullOptions{})
+	if err != nil {
+		return daemonError(err)
+	}
+	for msg, err := range resp.JSONMessages(ctx) {
+		if err != nil {
+			return fmt.Errorf("failed to pull image: %w", err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("failed to pull image: %w", msg.Error)
+		}
+	}
+	return nil
+}
+
+// execContainer runs cmd in the running container name, streaming its
+// output. Cancelling ctx stops the container, since a process started by
+// exec cannot be signalled on its own; it is restarted on next use.
+func execContainer(ctx context.Context, cli *client.Client, name string, cmd []string, stdout, stderr io.Writer) error {
+	created, err := cli.ExecCreate(ctx, name, client.ExecCreateOptions{
+		Cmd:          cmd,
+		WorkingDir:   "/workdir",
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return daemonError(err)
+	}
+
+	attach, err := cli.ExecAttach(ctx, created.ID, client.ExecAttachOptions{})
+	if err != nil {
+		return daemonError(err)
+	}
+	defer attach.Close()
+
+	if err := copyOutput(ctx, attach.HijackedResponse, stdout, stderr, func() { stopContainer(cli, name) }); err != nil {
+		return err
+	}
+
+	inspect, err := cli.ExecInspect(ctx, created.ID, client.ExecInspectOptions{})
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", inspect.ExitCode)
+	}
+	return nil
+}
+
+// copyOutput demultiplexes an attached stream into stdout and stderr until
+// it ends, calling stop and returning ctx's error if ctx is cancelled first.
+func copyOutput(ctx context.Context, attach client.HijackedResponse, stdout, stderr io.Writer, stop func()) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, attach.Reader)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		stop()
+		attach.Close()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// stopContainer stops a container, giving it stopTimeout to exit.
+func stopContainer(cli *client.Client, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout+5*time.Second)
+	defer cancel()
+	timeout := int(stopTimeout.Seconds())
+	cli.ContainerStop(ctx, id, client.ContainerStopOptions{Timeout: &timeout})
+}
+
+// outputLines runs fn with a writer, returning a scanner over the lines it
+// writes and a function returning fn's error once the lines are read.
+func outputLines(fn func(w io.Writer) error) (*bufio.Scanner, func() error) {
+	r, w := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := fn(w)
+		w.Close()
+		errc <- err
+	}()
+	wait := func() error {
+		// Drain anything left unread so fn can finish
+		io.Copy(io.Discard, r)
+		return <-errc
+	}
+	return bufio.NewScanner(r), wait
+}
@@ -2,10 +2,12 @@ package firmware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 )
 
 // FlashResult represents the outcome of a flash operation.
@@ -13,22 +15,83 @@ type FlashResult struct {
 	Success      bool
 	Error        error
 	BytesWritten int64
+	SHA256       string // hex digest of the source file, set on success
+	Destination  string // file written on the device, set on success
+}
+
+// ErrDeviceRemoved reports that the bootloader volume went away before the
+// copy finished, e.g. the bootloader rebooted early or the cable was pulled.
+var ErrDeviceRemoved = errors.New("device removed during flash")
+
+// FlashProgress reports how much of the firmware has been written.
+type FlashProgress struct {
+	Written int64
+	Total   int64
+	Percent int
+}
+
+// FirmwareFlasher is the interface for writing firmware to a device.
+// progressFn, which may be nil, is called as the copy advances.
+type FirmwareFlasher interface {
+	Flash(ctx context.Context, srcPath, devicePath string, progressFn func(FlashProgress)) FlashResult
+}
+
+// copyBufferSize is the chunk size used when copying to the device.
+const copyBufferSize = 32 * 1024
+
+// directAlign is the buffer and length alignment O_DIRECT writes require.
+const directAlign = 512
+
+// FlasherOptions tunes how firmware is written to the device.
+type FlasherOptions struct {
+	// SyncEvery fsyncs after every SyncEvery bytes; 0 syncs once at the end.
+	SyncEvery int64
+	// Direct bypasses the page cache with O_DIRECT where the platform and
+	// filesystem support it, falling back to a regular write otherwise.
+	Direct bool
+	// Profile works around the connected bootloader's write quirks.
+	Profile FlashProfile
+	// Verify, when set, is called with the source before anything is
+	// written and refuses the flash by returning an error, e.g. a
+	// Signer's Check.
+	Verify func(ctx context.Context, path string) error
 }
 
 // Flasher handles copying firmware files to devices.
-type Flasher struct{}
+type Flasher struct {
+	opts FlasherOptions
+}
 
-// NewFlasher creates a new flasher.
+// NewFlasher creates a new flasher that syncs once after the copy.
 func NewFlasher() *Flasher {
-	return &Flasher{}
+	return NewFlasherWithOptions(FlasherOptions{})
 }
 
-// Flash copies a firmware file to the device path with size validation.
-func (f *Flasher) Flash(ctx context.Context, srcPath, devicePath string) FlashResult {
+// NewFlasherWithOptions creates a new flasher with the given write options.
+func NewFlasherWithOptions(opts FlasherOptions) *Flasher {
+	return &Flasher{opts: opts}
+}
+
+// Flash copies a firmware file to the device path with size validation,
+// reporting progress after every chunk written.
+func (f *Flasher) Flash(ctx context.Context, srcPath, devicePath string, progressFn func(FlashProgress)) FlashResult {
+	if progressFn == nil {
+		progressFn = func(FlashProgress) {}
+	}
 	if err := ctx.Err(); err != nil {
 		return FlashResult{Success: false, Error: err}
 	}
 
+	// Catch corruption between build and flash (e.g. firmware synced from another machine)
+	if err := VerifyManifest(srcPath); err != nil {
+		return FlashResult{Success: false, Error: fmt.Errorf("verify source: %w", err)}
+	}
+	if f.opts.Verify != nil {
+		if err := f.opts.Verify(ctx, srcPath); err != nil {
+			return FlashResult{Success: false, Error: fmt.Errorf("verify source: %w", err)}
+		}
+	}
+
 	src, err := os.Open(srcPath)
 	if err != nil {
 		return FlashResult{Success: false, Error: fmt.Errorf("open source: %w", err)}
@@ -40,16 +103,50 @@ func (f *Flasher) Flash(ctx context.Context, srcPath, devicePath string) FlashRe
 		return FlashResult{Success: false, Error: fmt.Errorf("stat source: %w", err)}
 	}
 
-	dstPath := filepath.Join(devicePath, filepath.Base(srcPath))
-	dst, err := os.Create(dstPath)
+	// Recorded so what went onto the board can be traced to an exact artifact
+	sum, err := FileSHA256(srcPath)
 	if err != nil {
-		return FlashResult{Success: false, Error: fmt.Errorf("create destination: %w", err)}
+		return FlashResult{Success: false, Error: fmt.Errorf("hash source: %w", err)}
+	}
+
+	dstPath := filepath.Join(devicePath, filepath.Base(srcPath))
+
+	profile := f.opts.Profile
+	blockSize := copyBufferSize
+	if profile.BlockSize > 0 {
+		blockSize = profile.BlockSize
+	}
+
+	// O_DIRECT needs every write to be block aligned, which UF2 files are
+	var dst *os.File
+	var buf []byte
+	if f.opts.Direct && srcInfo.Size()%directAlign == 0 && blockSize%directAlign == 0 {
+		dst, buf, _ = openDirect(dstPath, blockSize)
+	}
+	if dst == nil {
+		dst, err = os.Create(dstPath)
+		if err != nil {
+			return FlashResult{Success: false, Error: fmt.Errorf("create destination: %w", err)}
+		}
+		buf = make([]byte, blockSize)
 	}
 	defer dst.Close()
 
+	var w io.Writer = dst
+	if f.opts.SyncEvery > 0 && !profile.NoSync {
+		w = &syncWriter{dst: dst, every: f.opts.SyncEvery}
+	}
+	w = &progressWriter{w: w, total: srcInfo.Size(), progressFn: progressFn}
+
 	// Use a cancellable copy
-	written, err := copyWithContext(ctx, dst, src)
+	written, err := copyWithContext(ctx, w, src, buf)
 	if err != nil {
+		if ctx.Err() == nil && profile.benign(written, srcInfo.Size(), devicePath) {
+			return FlashResult{Success: true, BytesWritten: written, SHA256: sum, Destination: dstPath}
+		}
+		if deviceRemoved(err, devicePath) {
+			err = fmt.Errorf("%w: %w", ErrDeviceRemoved, err)
+		}
 		return FlashResult{Success: false, Error: fmt.Errorf("copy: %w", err), BytesWritten: written}
 	}
 
@@ -62,21 +159,84 @@ func (f *Flasher) Flash(ctx context.Context, srcPath, devicePath string) FlashRe
 		}
 	}
 
-	// Sync to ensure data is written
-	if err := dst.Sync(); err != nil {
-		return FlashResult{
-			Success:      false,
-			Error:        fmt.Errorf("sync: %w", err),
-			BytesWritten: written,
+	// Sync to ensure the tail is written
+	if !profile.NoSync {
+		if err := dst.Sync(); err != nil {
+			if profile.benign(written, srcInfo.Size(), devicePath) {
+				return FlashResult{Success: true, BytesWritten: written, SHA256: sum, Destination: dstPath}
+			}
+			if deviceRemoved(err, devicePath) {
+				err = fmt.Errorf("%w: %w", ErrDeviceRemoved, err)
+			}
+			return FlashResult{
+				Success:      false,
+				Error:        fmt.Errorf("sync: %w", err),
+				BytesWritten: written,
+			}
 		}
 	}
 
-	return FlashResult{Success: true, BytesWritten: written}
+	// The data is on the device; close before unmounting so the volume isn't busy
+	dst.Close()
+	unmountVolume(devicePath)
+
+	return FlashResult{Success: true, BytesWritten: written, SHA256: sum, Destination: dstPath}
+}
+
+// deviceRemoved reports whether a write error means the volume has gone.
+func deviceRemoved(err error, devicePath string) bool {
+	return errors.Is(err, syscall.ENODEV) || errors.Is(err, syscall.EIO) || volumeGone(devicePath)
+}
+
+// syncer is a writer that can flush its data to stable storage.
+type syncer interface {
+	io.Writer
+	Sync() error
+}
+
+// syncWriter fsyncs dst after every `every` bytes written.
+type syncWriter struct {
+	dst     syncer
+	every   int64
+	pending int64
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.pending += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.pending >= w.every {
+		w.pending = 0
+		if err := w.dst.Sync(); err != nil {
+			return n, fmt.Errorf("sync: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// progressWriter reports the bytes written so far after every write.
+type progressWriter struct {
+	w          io.Writer
+	total      int64
+	written    int64
+	progressFn func(FlashProgress)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	percent := 100
+	if w.total > 0 {
+		percent = int(w.written * 100 / w.total)
+	}
+	w.progressFn(FlashProgress{Written: w.written, Total: w.total, Percent: percent})
+	return n, err
 }
 
-// copyWithContext copies from src to dst, respecting context cancellation.
-func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
-	buf := make([]byte, 32*1024)
+// copyWithContext copies from src to dst through buf, respecting context cancellation.
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader, buf []byte) (int64, error) {
 	var written int64
 
 	for {
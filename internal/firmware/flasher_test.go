@@ -1,9 +1,13 @@
 package firmware
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 )
 
@@ -24,7 +28,7 @@ func TestFlasher_Flash_Success(t *testing.T) {
 	}
 
 	flasher := NewFlasher()
-	result := flasher.Flash(context.Background(), srcPath, dstDir)
+	result := flasher.Flash(context.Background(), srcPath, dstDir, nil)
 
 	if !result.Success {
 		t.Fatalf("Flash failed: %v", result.Error)
@@ -34,8 +38,16 @@ func TestFlasher_Flash_Success(t *testing.T) {
 		t.Errorf("expected %d bytes written, got %d", len(content), result.BytesWritten)
 	}
 
+	// sha256("test firmware content")
+	if want := "5a480434c0b55f930ae01a7d38579893889eec0be56c478385c941f736f66e89"; result.SHA256 != want {
+		t.Errorf("SHA256 = %s, want %s", result.SHA256, want)
+	}
+
 	// Verify file was copied
 	dstPath := filepath.Join(dstDir, "firmware.uf2")
+	if result.Destination != dstPath {
+		t.Errorf("Destination = %s, want %s", result.Destination, dstPath)
+	}
 	dstContent, err := os.ReadFile(dstPath)
 	if err != nil {
 		t.Fatalf("failed to read destination file: %v", err)
@@ -50,7 +62,7 @@ func TestFlasher_Flash_SourceNotFound(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	flasher := NewFlasher()
-	result := flasher.Flash(context.Background(), "/nonexistent/file.uf2", tmpDir)
+	result := flasher.Flash(context.Background(), "/nonexistent/file.uf2", tmpDir, nil)
 
 	if result.Success {
 		t.Error("expected Flash to fail for nonexistent source")
@@ -71,7 +83,7 @@ func TestFlasher_Flash_DestinationNotFound(t *testing.T) {
 	}
 
 	flasher := NewFlasher()
-	result := flasher.Flash(context.Background(), srcPath, "/nonexistent/path")
+	result := flasher.Flash(context.Background(), srcPath, "/nonexistent/path", nil)
 
 	if result.Success {
 		t.Error("expected Flash to fail for nonexistent destination")
@@ -100,7 +112,7 @@ func TestFlasher_Flash_ContextCancellation(t *testing.T) {
 	cancel() // Cancel immediately
 
 	flasher := NewFlasher()
-	result := flasher.Flash(ctx, srcPath, dstDir)
+	result := flasher.Flash(ctx, srcPath, dstDir, nil)
 
 	if result.Success {
 		t.Error("expected Flash to fail when context is cancelled")
@@ -130,7 +142,7 @@ func TestFlasher_Flash_LargeFile(t *testing.T) {
 	}
 
 	flasher := NewFlasher()
-	result := flasher.Flash(context.Background(), srcPath, dstDir)
+	result := flasher.Flash(context.Background(), srcPath, dstDir, nil)
 
 	if !result.Success {
 		t.Fatalf("Flash failed: %v", result.Error)
@@ -150,3 +162,127 @@ func TestFlasher_Flash_LargeFile(t *testing.T) {
 		t.Errorf("size mismatch: got %d, want %d", len(dstContent), len(content))
 	}
 }
+
+func TestFlasher_Flash_WriteStrategies(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Block aligned for O_DIRECT, with a short final chunk
+	content := make([]byte, 3*copyBufferSize+2*directAlign)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	srcPath := filepath.Join(tmpDir, "firmware.uf2")
+	if err := os.WriteFile(srcPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts FlasherOptions
+	}{
+		{"chunked", FlasherOptions{SyncEvery: 4096}},
+		{"direct", FlasherOptions{SyncEvery: 4096, Direct: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dstDir := t.TempDir()
+			result := NewFlasherWithOptions(tc.opts).Flash(context.Background(), srcPath, dstDir, nil)
+			if !result.Success {
+				t.Fatalf("Flash failed: %v", result.Error)
+			}
+
+			got, err := os.ReadFile(filepath.Join(dstDir, "firmware.uf2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error("destination content does not match source")
+			}
+		})
+	}
+}
+
+func TestFlasher_Flash_Progress(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := make([]byte, 2*copyBufferSize+100)
+	srcPath := filepath.Join(tmpDir, "firmware.uf2")
+	if err := os.WriteFile(srcPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []FlashProgress
+	result := NewFlasher().Flash(context.Background(), srcPath, t.TempDir(), func(p FlashProgress) {
+		updates = append(updates, p)
+	})
+	if !result.Success {
+		t.Fatalf("Flash failed: %v", result.Error)
+	}
+
+	if len(updates) != 3 {
+		t.Fatalf("expected 3 progress updates, got %d", len(updates))
+	}
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Written <= updates[i-1].Written {
+			t.Errorf("progress went backwards: %d after %d", updates[i].Written, updates[i-1].Written)
+		}
+	}
+	last := updates[len(updates)-1]
+	if last.Written != int64(len(content)) || last.Total != int64(len(content)) || last.Percent != 100 {
+		t.Errorf("final progress = %+v, want %d/%d at 100%%", last, len(content), len(content))
+	}
+}
+
+func TestDeviceRemoved(t *testing.T) {
+	present := t.TempDir()
+	gone := filepath.Join(present, "NICENANO")
+
+	tests := []struct {
+		name   string
+		err    error
+		device string
+		want   bool
+	}{
+		{"no such device", &os.PathError{Op: "write", Path: "f", Err: syscall.ENODEV}, present, true},
+		{"i/o error", fmt.Errorf("sync: %w", syscall.EIO), present, true},
+		{"volume gone", errors.New("bad file descriptor"), gone, true},
+		{"disk full", &os.PathError{Op: "write", Path: "f", Err: syscall.ENOSPC}, present, false},
+	}
+
+	for _, tc := range tests {
+		if got := deviceRemoved(tc.err, tc.device); got != tc.want {
+			t.Errorf("%s: deviceRemoved = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// countingSyncer records writes and syncs for syncWriter tests.
+type countingSyncer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (c *countingSyncer) Sync() error {
+	c.syncs++
+	return nil
+}
+
+func TestSyncWriter(t *testing.T) {
+	dst := &countingSyncer{}
+	w := &syncWriter{dst: dst, every: 1000}
+
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write(make([]byte, 512)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 2560 bytes in 512-byte writes syncs after the 2nd and 4th writes
+	if dst.syncs != 2 {
+		t.Errorf("syncs = %d, want 2", dst.syncs)
+	}
+	if dst.Len() != 2560 {
+		t.Errorf("written = %d, want 2560", dst.Len())
+	}
+}
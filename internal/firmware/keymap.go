@@ -0,0 +1,135 @@
+package firmware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Keymap preview files written next to a build by KeymapDrawer.
+const (
+	KeymapYAML = "keymap.yaml"
+	KeymapSVG  = "keymap.svg"
+)
+
+// KeymapDrawer renders a ZMK keymap with keymap-drawer
+// (https://github.com/caksoylar/keymap-drawer), natively or in Docker.
+type KeymapDrawer struct {
+	mode       string // "native" or "docker"
+	image      string
+	workingDir string
+	keymap     string // .keymap file, relative to workingDir
+	config     string // keymap-drawer config file, relative to workingDir
+	user       string // docker --user, empty for the image default
+}
+
+// NewKeymapDrawer creates a drawer for the keymap file in workingDir.
+func NewKeymapDrawer(mode, image, workingDir, keymap string) *KeymapDrawer {
+	return &KeymapDrawer{
+		mode:       mode,
+		image:      image,
+		workingDir: workingDir,
+		keymap:     keymap,
+	}
+}
+
+// SetConfig sets a keymap-drawer config file passed to every command.
+func (d *KeymapDrawer) SetConfig(config string) {
+	d.config = config
+}
+
+// SetUser sets the user the docker container runs as.
+func (d *KeymapDrawer) SetUser(user string) {
+	d.user = user
+}
+
+// Draw parses the keymap and writes KeymapYAML and KeymapSVG into outDir,
+// returning the path of the SVG.
+func (d *KeymapDrawer) Draw(ctx context.Context, outDir string) (string, error) {
+	yaml, err := d.run(ctx, nil, "parse", "-z", d.keymap)
+	if err != nil {
+		return "", fmt.Errorf("keymap parse failed: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, KeymapYAML), yaml, 0644); err != nil {
+		return "", err
+	}
+
+	// The parsed keymap is piped back in, so Docker needs no output mount
+	svg, err := d.run(ctx, yaml, "draw", "-")
+	if err != nil {
+		return "", fmt.Errorf("keymap draw failed: %w", err)
+	}
+	svgPath := filepath.Join(outDir, KeymapSVG)
+	if err := os.WriteFile(svgPath, svg, 0644); err != nil {
+		return "", err
+	}
+	return svgPath, nil
+}
+
+// run runs a keymap-drawer subcommand in the working directory, returning
+// its stdout.
+func (d *KeymapDrawer) run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	keymapArgs := []string{"keymap"}
+	if d.config != "" {
+		keymapArgs = append(keymapArgs, "-c", d.config)
+	}
+	keymapArgs = append(keymapArgs, args...)
+
+	var stdout, stderr bytes.Buffer
+	var err error
+	if d.mode == "docker" {
+		err = d.runDocker(ctx, stdin, keymapArgs, &stdout, &stderr)
+	} else {
+		cmd := exec.CommandContext(ctx, keymapArgs[0], keymapArgs[1:]...)
+		cmd.Dir = d.workingDir
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, lastLine(msg))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// runDocker runs the keymap command in the image, with the working
+// directory mounted
+func (d *KeymapDrawer) runDocker(ctx context.Context, stdin []byte, args []string, stdout, stderr io.Writer) error {
+	workDir, err := filepath.Abs(d.workingDir)
+	if err != nil {
+		return fmt.Errorf("invalid working directory: %w", err)
+	}
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	if stdin == nil {
+		stdin = []byte{}
+	}
+	run := dockerRun{
+		image:   d.image,
+		cmd:     args,
+		workDir: workDir,
+		opts:    DockerRunOptions{User: d.user},
+		stdin:   stdin,
+	}
+	return runContainer(ctx, cli, run, stdout, stderr)
+}
+
+// lastLine returns the last line of s, where CLIs usually print the error.
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,114 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhavalsavalia/kbflash/internal/dockertest"
+)
+
+func TestKeymapDrawer_Draw_Native(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	binDir := t.TempDir()
+	workDir := t.TempDir()
+	outDir := t.TempDir()
+
+	// Fake keymap-drawer: parse echoes its args, draw wraps stdin in an SVG
+	script := `#!/bin/bash
+echo "$@" >> "` + filepath.Join(binDir, "calls") + `"
+case "$3" in
+parse) echo "layers: {Base: [Q, W]}  # $*" ;;
+draw) echo "<svg>$(cat)</svg>" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "keymap"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	drawer := NewKeymapDrawer("native", "", workDir, "config/corne.keymap")
+	drawer.SetConfig("keymap_drawer.yaml")
+	svgPath, err := drawer.Draw(context.Background(), outDir)
+	if err != nil {
+		t.Fatalf("Draw failed: %v", err)
+	}
+
+	if svgPath != filepath.Join(outDir, KeymapSVG) {
+		t.Errorf("svg path = %s", svgPath)
+	}
+	svg, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg>layers: {Base: [Q, W]}") {
+		t.Errorf("svg = %q, want the parsed keymap drawn", svg)
+	}
+	yaml, err := os.ReadFile(filepath.Join(outDir, KeymapYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(yaml), "-c keymap_drawer.yaml parse -z config/corne.keymap") {
+		t.Errorf("yaml = %q, want parse of the configured keymap", yaml)
+	}
+}
+
+func TestKeymapDrawer_Draw_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/bash\necho 'Traceback...' >&2\necho 'FileNotFoundError: config/corne.keymap' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(binDir, "keymap"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	outDir := t.TempDir()
+	_, err := NewKeymapDrawer("native", "", t.TempDir(), "config/corne.keymap").Draw(context.Background(), outDir)
+	if err == nil || !strings.Contains(err.Error(), "FileNotFoundError: config/corne.keymap") {
+		t.Errorf("expected the CLI's last error line, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, KeymapSVG)); !os.IsNotExist(err) {
+		t.Error("no preview should be written when parsing fails")
+	}
+}
+
+func TestKeymapDrawer_Draw_Docker(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		switch p.Cmd[len(p.Cmd)-2] {
+		case "-z":
+			fmt.Fprintln(p.Stdout, "layers: {Base: [Q, W]}")
+		case "draw":
+			fmt.Fprintf(p.Stdout, "<svg>%s</svg>", p.Stdin)
+		}
+		return 0
+	}
+
+	outDir := t.TempDir()
+	drawer := NewKeymapDrawer("docker", "keymap-drawer", t.TempDir(), "config/corne.keymap")
+	svgPath, err := drawer.Draw(context.Background(), outDir)
+	if err != nil {
+		t.Fatalf("Draw failed: %v", err)
+	}
+	svg, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(svg) != "<svg>layers: {Base: [Q, W]}\n</svg>" {
+		t.Errorf("svg = %q, want the parsed keymap piped into draw", svg)
+	}
+	if !slices.Contains(engine.Calls(), "POST /images/create") {
+		t.Errorf("calls = %q, want the missing image pulled", engine.Calls())
+	}
+}
@@ -0,0 +1,69 @@
+package firmware
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FlashProfile describes how a UF2 bootloader misbehaves while its volume is
+// written. The zero value is the generic copy path.
+type FlashProfile struct {
+	// BlockSize is the copy chunk size; 0 uses the default.
+	BlockSize int
+	// NoSync skips fsync for bootloaders that reboot before a sync completes.
+	NoSync bool
+	// MayVanish expects the volume to disappear mid-copy, as the bootloader
+	// reboots once it has every UF2 block while the OS is still writing.
+	MayVanish bool
+	// BenignTail ignores errors after every byte has been written, such as
+	// a failed sync when the bootloader resets on the last block.
+	BenignTail bool
+}
+
+// flashProfiles are the built-in bootloader profiles selected by device.profile.
+var flashProfiles = map[string]FlashProfile{
+	"generic": {},
+	// Adafruit nRF52 bootloader: resets as soon as the last block lands
+	"adafruit": {BlockSize: 4096, BenignTail: true},
+	// nice!nano fork of the Adafruit bootloader: may also unmount before close
+	"nicenano": {BlockSize: 4096, MayVanish: true, BenignTail: true},
+	// RP2040 boot ROM: reboots mid-write and fails any fsync
+	"rp2040": {NoSync: true, MayVanish: true, BenignTail: true},
+}
+
+// bootloaderProfiles picks a profile for "auto" from the volume name.
+var bootloaderProfiles = map[string]string{
+	"NICENANO":   "nicenano",
+	"XIAO-SENSE": "adafruit",
+	"RPI-RP2":    "rp2040",
+}
+
+// LookupFlashProfile returns the named profile. "auto" picks one from the
+// bootloader volume name, falling back to generic.
+func LookupFlashProfile(name, volumeName string) (FlashProfile, bool) {
+	if name == "auto" {
+		name = bootloaderProfiles[strings.ToUpper(volumeName)]
+		if name == "" {
+			name = "generic"
+		}
+	}
+	profile, ok := flashProfiles[name]
+	return profile, ok
+}
+
+// benign reports whether a write error is an expected quirk of the
+// bootloader rather than a failed flash.
+func (p FlashProfile) benign(written, total int64, devicePath string) bool {
+	if p.BenignTail && written == total {
+		return true
+	}
+	return p.MayVanish && volumeGone(devicePath)
+}
+
+// volumeGone reports whether the device volume has been unmounted.
+func volumeGone(devicePath string) bool {
+	_, err := os.Stat(devicePath)
+	return errors.Is(err, fs.ErrNotExist)
+}
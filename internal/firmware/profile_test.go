@@ -0,0 +1,81 @@
+package firmware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupFlashProfile(t *testing.T) {
+	tests := []struct {
+		name, volume string
+		want         FlashProfile
+		ok           bool
+	}{
+		{"auto", "NICENANO", flashProfiles["nicenano"], true},
+		{"auto", "rpi-rp2", flashProfiles["rp2040"], true},
+		{"auto", "XIAO-SENSE", flashProfiles["adafruit"], true},
+		{"auto", "MYBOARD", FlashProfile{}, true},
+		{"rp2040", "NICENANO", flashProfiles["rp2040"], true},
+		{"samd21", "NICENANO", FlashProfile{}, false},
+	}
+
+	for _, tc := range tests {
+		got, ok := LookupFlashProfile(tc.name, tc.volume)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("LookupFlashProfile(%q, %q) = %+v, %v; want %+v, %v", tc.name, tc.volume, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestFlashProfile_Benign(t *testing.T) {
+	present := t.TempDir()
+	gone := filepath.Join(present, "NICENANO")
+
+	tests := []struct {
+		name    string
+		profile FlashProfile
+		written int64
+		device  string
+		want    bool
+	}{
+		{"generic after write", FlashProfile{}, 100, gone, false},
+		{"tail after write", FlashProfile{BenignTail: true}, 100, present, true},
+		{"tail mid-copy", FlashProfile{BenignTail: true}, 50, present, false},
+		{"vanished mid-copy", FlashProfile{MayVanish: true}, 50, gone, true},
+		{"still mounted", FlashProfile{MayVanish: true}, 50, present, false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.profile.benign(tc.written, 100, tc.device); got != tc.want {
+			t.Errorf("%s: benign = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFlasher_Flash_Profile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	content := make([]byte, 3*4096+100)
+	srcPath := filepath.Join(tmpDir, "firmware.uf2")
+	if err := os.WriteFile(srcPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"adafruit", "nicenano", "rp2040"} {
+		profile, _ := LookupFlashProfile(name, "")
+		var updates int
+		result := NewFlasherWithOptions(FlasherOptions{SyncEvery: 4096, Profile: profile}).
+			Flash(context.Background(), srcPath, t.TempDir(), func(FlashProgress) { updates++ })
+		if !result.Success {
+			t.Fatalf("%s: Flash failed: %v", name, result.Error)
+		}
+		if result.BytesWritten != int64(len(content)) {
+			t.Errorf("%s: wrote %d bytes, want %d", name, result.BytesWritten, len(content))
+		}
+		if profile.BlockSize == 4096 && updates != 4 {
+			t.Errorf("%s: expected 4 block writes, got %d", name, updates)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package firmware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QMKStage identifies which phase of `qmk flash` is running.
+type QMKStage int
+
+const (
+	QMKCompiling QMKStage = iota
+	QMKWaitingDevice
+	QMKFlashing
+)
+
+// QMKProgress represents a parsed line of `qmk flash` output.
+type QMKProgress struct {
+	Stage   QMKStage
+	Percent int // -1 when the line carries no percentage
+	Output  string
+}
+
+// percentRegex matches percentages printed by avrdude, dfu-util and friends.
+var percentRegex = regexp.MustCompile(`(\d{1,3})%`)
+
+// QMKFlasher drives `qmk flash` for QMK keyboards.
+type QMKFlasher struct {
+	keyboard   string
+	keymap     string
+	workingDir string
+}
+
+// NewQMKFlasher creates a flasher that runs `qmk flash -kb <keyboard> -km <keymap>`.
+func NewQMKFlasher(keyboard, keymap, workingDir string) *QMKFlasher {
+	return &QMKFlasher{
+		keyboard:   keyboard,
+		keymap:     keymap,
+		workingDir: workingDir,
+	}
+}
+
+// Flash compiles and flashes the keymap with the qmk CLI.
+// The qmk CLI waits for the bootloader itself; progressFn is called for
+// every output line with the stage it belongs to.
+func (f *QMKFlasher) Flash(ctx context.Context, progressFn func(QMKProgress)) FlashResult {
+	if progressFn == nil {
+		progressFn = func(QMKProgress) {}
+	}
+
+	cmd := exec.CommandContext(ctx, "qmk", "flash", "-kb", f.keyboard, "-km", f.keymap)
+	if f.workingDir != "" {
+		cmd.Dir = f.workingDir
+	}
+	if err := runStages(ctx, cmd, "qmk flash", QMKCompiling, progressFn); err != nil {
+		return FlashResult{Success: false, Error: err}
+	}
+	return FlashResult{Success: true}
+}
+
+// runStages runs a flashing CLI, calling progressFn for every output line
+// with the stage it belongs to, from stage on. name labels its errors.
+func runStages(ctx context.Context, cmd *exec.Cmd, name string, stage QMKStage, progressFn func(QMKProgress)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", name, err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	// avrdude and dfu-util redraw their progress bars with carriage returns
+	scanner.Split(scanLinesOrCR)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		stage = parseQMKStage(line, stage)
+		progressFn(QMKProgress{
+			Stage:   stage,
+			Percent: parsePercent(line),
+			Output:  line,
+		})
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// parseQMKStage advances the stage based on well-known qmk/bootloader output.
+// Stages only move forward, so noise after flashing starts is ignored.
+func parseQMKStage(line string, current QMKStage) QMKStage {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "waiting for") && (strings.Contains(lower, "bootloader") ||
+		strings.Contains(lower, "reset") || strings.Contains(lower, "port")):
+		if current < QMKWaitingDevice {
+			return QMKWaitingDevice
+		}
+	case strings.Contains(lower, "writing") || strings.Contains(lower, "download") ||
+		strings.Contains(lower, "erasing") || strings.Contains(lower, "flashing"):
+		// "Flashing for bootloader: X" is printed before the wait starts
+		if strings.Contains(lower, "for bootloader") {
+			return current
+		}
+		if current < QMKFlashing {
+			return QMKFlashing
+		}
+	}
+	return current
+}
+
+// parsePercent returns the last percentage in the line, or -1 if none.
+func parsePercent(line string) int {
+	matches := percentRegex.FindAllStringSubmatch(line, -1)
+	if len(matches) == 0 {
+		return -1
+	}
+	percent, err := strconv.Atoi(matches[len(matches)-1][1])
+	if err != nil || percent > 100 {
+		return -1
+	}
+	return percent
+}
+
+// scanLinesOrCR is a bufio.SplitFunc that splits on '\n' or '\r'.
+func scanLinesOrCR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
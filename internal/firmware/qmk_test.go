@@ -0,0 +1,104 @@
+package firmware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestQMKFlasher_Flash_Stages(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+
+	// Fake qmk CLI that mimics a caterina flash
+	script := `#!/bin/bash
+echo "args: $@"
+echo "Compiling: keyboards/crkbd/crkbd.c"
+echo "Flashing for bootloader: caterina"
+echo "Waiting for USB serial port - reset your controller now (Ctrl+C to cancel)...."
+printf "Writing | ##########                  | 50%%\r"
+printf "Writing | #################################################### | 100%%\n"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "qmk"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	flasher := NewQMKFlasher("crkbd/rev1", "default", "")
+
+	var updates []QMKProgress
+	result := flasher.Flash(context.Background(), func(p QMKProgress) {
+		updates = append(updates, p)
+	})
+
+	if !result.Success {
+		t.Fatalf("Flash failed: %v", result.Error)
+	}
+
+	if len(updates) != 6 {
+		t.Fatalf("expected 6 progress updates, got %d: %+v", len(updates), updates)
+	}
+	if updates[0].Output != "args: flash -kb crkbd/rev1 -km default" {
+		t.Errorf("unexpected args line: %q", updates[0].Output)
+	}
+	if updates[2].Stage != QMKCompiling {
+		t.Errorf("bootloader announcement stage = %v, want compiling", updates[2].Stage)
+	}
+	if updates[3].Stage != QMKWaitingDevice {
+		t.Errorf("wait line stage = %v, want waiting", updates[3].Stage)
+	}
+	if updates[4].Stage != QMKFlashing || updates[4].Percent != 50 {
+		t.Errorf("first write update = %+v, want flashing at 50%%", updates[4])
+	}
+	if updates[5].Percent != 100 {
+		t.Errorf("final percent = %d, want 100", updates[5].Percent)
+	}
+}
+
+func TestQMKFlasher_Flash_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+	script := `#!/bin/bash
+echo "Invalid keyboard"
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "qmk"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := NewQMKFlasher("nope", "default", "").Flash(context.Background(), nil)
+	if result.Success {
+		t.Error("expected Flash to fail")
+	}
+	if result.Error == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"Writing | ####     | 42%", 42},
+		{"Download	[=========================] 100%        28672 bytes", 100},
+		{"Compiling: quantum/keymap.c", -1},
+		{"", -1},
+	}
+
+	for _, tc := range tests {
+		got := parsePercent(tc.input)
+		if got != tc.expected {
+			t.Errorf("parsePercent(%q) = %d, want %d", tc.input, got, tc.expected)
+		}
+	}
+}
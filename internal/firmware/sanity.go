@@ -0,0 +1,33 @@
+package firmware
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckFirmwareFile rejects a file that cannot be flashed before anyone
+// unplugs a keyboard for it: a missing or empty file, one smaller than
+// minSize bytes, or one without the extension ext the bootloader takes.
+// An empty ext accepts any file.
+func CheckFirmwareFile(path, ext string, minSize int64) error {
+	name := filepath.Base(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, not a firmware file", name)
+	}
+	if ext != "" && !strings.EqualFold(filepath.Ext(path), ext) {
+		return fmt.Errorf("%s is not a %s file, which the bootloader takes", name, ext)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%s is empty", name)
+	}
+	if info.Size() < minSize {
+		return fmt.Errorf("%s is only %s, too small to be firmware (minimum %s)", name, FormatSize(info.Size()), FormatSize(minSize))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package firmware
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckFirmwareFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		ext     string
+		wantErr string
+	}{
+		{"valid", write("corne_left.uf2", 8192), ".uf2", ""},
+		{"upper-case extension", write("CURRENT.UF2", 8192), ".uf2", ""},
+		{"empty", write("empty.uf2", 0), ".uf2", "is empty"},
+		{"too small", write("tiny.uf2", 512), ".uf2", "too small"},
+		{"wrong extension", write("corne.hex", 8192), ".uf2", "not a .uf2 file"},
+		{"binary image", write("planck.bin", 8192), ".bin", ""},
+		{"any extension", write("corne.bin", 8192), "", ""},
+		{"missing", filepath.Join(dir, "missing.uf2"), ".uf2", "no such file"},
+		{"directory", dir, ".uf2", "is a directory"},
+	}
+
+	for _, tc := range tests {
+		err := CheckFirmwareFile(tc.path, tc.ext, 4096)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: error = %v, want one containing %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package firmware
 
 import (
+	"cmp"
 	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // File represents a firmware file.
@@ -15,120 +23,363 @@ type File struct {
 	Size int64
 }
 
-// Build represents a firmware build (dated directory or flat).
+// Build represents a firmware build (a build directory or flat).
 type Build struct {
-	Date  string // YYYYMMDD format or empty for flat structure
-	Path  string
-	Files []File
+	Date   string // YYYYMMDD for dated directories, empty otherwise
+	Name   string // build directory name, empty for flat structure
+	Path   string
+	Source string // label of the firmware source, empty for a single source
+	Files  []File
+	Notes  string // text of the directory's notes file, if any
+	Keymap string // path of the rendered keymap preview (KeymapSVG), if any
+
+	modTime time.Time // directory mtime, orders builds named by hash
+}
+
+// Title returns a human-readable name for the build: its date, its
+// directory name, or "current" for flat structure.
+func (b Build) Title() string {
+	switch {
+	case b.Date != "":
+		return FormatDate(b.Date)
+	case b.Name != "":
+		return b.Name
+	default:
+		return "current"
+	}
+}
+
+// ValidName reports whether name can be used as a build's file or
+// directory name: one path element, not hidden.
+func ValidName(name string) bool {
+	return name != "" && name != ".." && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+// Summary returns the first non-empty line of the build's notes, without
+// any markdown heading marker.
+func (b Build) Summary() string {
+	for _, line := range strings.Split(b.Notes, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "# "))
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Matches reports whether every word of query fuzzily matches the build's
+// date, name, source, notes, file names or one of tags: its letters appear
+// in order, case-insensitively. An empty query matches every build.
+func (b Build) Matches(query string, tags []string) bool {
+	fields := []string{b.Title(), b.Date, b.Name, b.Source, b.Notes}
+	for _, f := range b.Files {
+		fields = append(fields, f.Name)
+	}
+	fields = append(fields, tags...)
+
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		word = strings.TrimPrefix(word, "#")
+		if !slices.ContainsFunc(fields, func(f string) bool { return fuzzy(word, strings.ToLower(f)) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzy reports whether the runes of pattern appear in s in order.
+func fuzzy(pattern, s string) bool {
+	for _, r := range pattern {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// NotesFiles are the build annotation files read from a build directory,
+// in order of preference.
+var NotesFiles = []string{"NOTES.md", "description.txt"}
+
+// maxNotesSize caps how much of a notes file is read.
+const maxNotesSize = 4096
+
+// DirFormat is a build directory naming scheme recognised by the scanner.
+type DirFormat string
+
+const (
+	DirDate    DirFormat = "date"     // 20250102
+	DirISODate DirFormat = "iso-date" // 2025-01-02
+	DirSemver  DirFormat = "semver"   // v1.4.2 or 1.4.2-rc1
+	DirHash    DirFormat = "hash"     // git short hash, e.g. 3f9c2ab
+)
+
+// DirFormats are every supported naming scheme, the scanner's default.
+var DirFormats = []DirFormat{DirDate, DirISODate, DirSemver, DirHash}
+
+var (
+	semverRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?$`)
+	hashRegex   = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+)
+
+// Source is a labelled firmware directory.
+type Source struct {
+	Label string
+	Dir   string
+}
+
+// racyWindow is how recent a directory mtime can be before its listing is
+// not cached: coarse mtimes (FAT, network shares) can hide a second change
+// made within the same tick.
+const racyWindow = 2 * time.Second
+
+// dirListing is the cached content of one directory.
+type dirListing struct {
+	modTime   time.Time
+	files     []File   // files matching the pattern
+	buildDirs []string // subdirectory names in an enabled DirFormat
+	notes     string   // text of the directory's notes file
+	keymap    string   // path of the keymap preview
 }
 
 // Scanner scans firmware directories for UF2 files.
+// Directory listings are cached by mtime, so rescans only re-read
+// directories that gained or lost entries. Files (and notes) rewritten in
+// place keep their cached size (and text) until their directory changes.
 type Scanner struct {
-	firmwareDir string
+	sources     []Source
 	filePattern string
+	dirFormats  []DirFormat
+
+	mu    sync.Mutex
+	cache map[string]dirListing
 }
 
-// NewScanner creates a new firmware scanner.
+// NewScanner creates a new firmware scanner for a single directory.
 func NewScanner(firmwareDir, filePattern string) *Scanner {
+	return NewMultiScanner([]Source{{Dir: firmwareDir}}, filePattern)
+}
+
+// NewMultiScanner creates a scanner that merges builds from several
+// directories, labelling each build with its source.
+func NewMultiScanner(sources []Source, filePattern string) *Scanner {
 	return &Scanner{
-		firmwareDir: firmwareDir,
+		sources:     sources,
 		filePattern: filePattern,
+		dirFormats:  DirFormats,
 	}
 }
 
-// Scan scans for firmware builds and returns them sorted by date (newest first).
-// Supports both dated subdirectories (YYYYMMDD) and flat structure.
+// SetDirFormats sets which build directory naming schemes are recognised.
+// An empty list recognises every format.
+func (s *Scanner) SetDirFormats(formats []DirFormat) {
+	if len(formats) == 0 {
+		formats = DirFormats
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirFormats = formats
+	s.cache = nil
+}
+
+// Scan scans for firmware builds and returns them newest first.
+// Supports build subdirectories in the enabled DirFormats and flat structure.
+// Builds with the same date keep the order of their sources.
 func (s *Scanner) Scan(ctx context.Context) ([]Build, error) {
+	return s.ScanEach(ctx, nil)
+}
+
+// ScanEach scans like Scan, additionally calling found for each build as
+// soon as its directory has been read, in discovery order.
+func (s *Scanner) ScanEach(ctx context.Context, found func(Build)) ([]Build, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if found == nil {
+		found = func(Build) {}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only directories visited by this scan stay cached
+	next := make(map[string]dirListing)
+
+	builds := []Build{}
+	for _, src := range s.sources {
+		srcBuilds, err := s.scanSource(ctx, src, next, found)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, srcBuilds...)
+	}
+	s.cache = next
+
+	SortBuilds(builds)
+	return builds, nil
+}
+
+// SortBuilds sorts builds newest first: dated builds by date, then
+// versioned builds by version, then other named builds (hashes) by
+// directory mtime, with flat builds last. Ties keep their relative order.
+func SortBuilds(builds []Build) {
+	sort.SliceStable(builds, func(i, j int) bool {
+		a, b := builds[i], builds[j]
+		ra, rb := buildRank(a), buildRank(b)
+		if ra != rb {
+			return ra < rb
+		}
+		switch ra {
+		case 0:
+			return a.Date > b.Date
+		case 1:
+			return compareSemver(a.Name, b.Name) > 0
+		case 2:
+			return a.modTime.After(b.modTime)
+		}
+		return false
+	})
+}
+
+// buildRank groups builds for sorting by how their directory is named.
+func buildRank(b Build) int {
+	switch {
+	case b.Date != "":
+		return 0
+	case semverRegex.MatchString(b.Name):
+		return 1
+	case b.Name != "":
+		return 2
+	default:
+		return 3
+	}
+}
 
-	entries, err := os.ReadDir(s.firmwareDir)
+// compareSemver compares two semantic versions, returning -1, 0 or 1.
+// A pre-release sorts before its release.
+func compareSemver(a, b string) int {
+	ma, mb := semverRegex.FindStringSubmatch(a), semverRegex.FindStringSubmatch(b)
+	for i := 1; i <= 3; i++ {
+		na, _ := strconv.Atoi(ma[i])
+		nb, _ := strconv.Atoi(mb[i])
+		if na != nb {
+			return cmp.Compare(na, nb)
+		}
+	}
+	switch pa, pb := ma[4], mb[4]; {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	default:
+		return strings.Compare(pa, pb)
+	}
+}
+
+// scanSource scans one firmware directory for flat and dated builds.
+func (s *Scanner) scanSource(ctx context.Context, src Source, next map[string]dirListing, found func(Build)) ([]Build, error) {
+	listing, err := s.readDir(ctx, src.Dir, next)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []Build{}, nil
+			return nil, nil
 		}
 		return nil, err
 	}
 
 	var builds []Build
 
-	// First, check for UF2 files directly in firmware_dir (flat structure)
-	flatFiles, err := s.scanDirectory(ctx, s.firmwareDir)
-	if err != nil {
-		return nil, err
-	}
+	// First, check for UF2 files directly in the directory (flat structure)
+	flatFiles := listing.files
 	if len(flatFiles) > 0 {
-		builds = append(builds, Build{
-			Date:  "",
-			Path:  s.firmwareDir,
-			Files: flatFiles,
-		})
+		build := Build{
+			Date:   "",
+			Path:   src.Dir,
+			Source: src.Label,
+			Files:  flatFiles,
+			Notes:  listing.notes,
+			Keymap: listing.keymap,
+
+			modTime: listing.modTime,
+		}
+		found(build)
+		builds = append(builds, build)
 	}
 
-	// Then scan dated subdirectories
-	for _, entry := range entries {
+	// Then scan build subdirectories
+	for _, name := range listing.buildDirs {
 		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
 
-		if !entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-
-		// Check if directory name looks like a date (YYYYMMDD)
-		if !isDateDir(name) {
-			continue
-		}
-
-		buildPath := filepath.Join(s.firmwareDir, name)
-		files, err := s.scanDirectory(ctx, buildPath)
+		buildPath := filepath.Join(src.Dir, name)
+		sub, err := s.readDir(ctx, buildPath, next)
 		if err != nil {
 			continue
 		}
+		files := sub.files
 
 		if len(files) > 0 {
-			builds = append(builds, Build{
-				Date:  name,
-				Path:  buildPath,
-				Files: files,
-			})
+			date, _ := parseBuildDir(name, s.dirFormats)
+			build := Build{
+				Date:    date,
+				Name:    name,
+				Path:    buildPath,
+				Source:  src.Label,
+				Files:   files,
+				Notes:   sub.notes,
+				Keymap:  sub.keymap,
+				modTime: sub.modTime,
+			}
+			found(build)
+			builds = append(builds, build)
 		}
 	}
 
-	// Sort by date descending (newest first), flat builds at the end
-	sort.Slice(builds, func(i, j int) bool {
-		// Flat structure (empty date) goes last
-		if builds[i].Date == "" {
-			return false
-		}
-		if builds[j].Date == "" {
-			return true
-		}
-		return builds[i].Date > builds[j].Date
-	})
-
 	return builds, nil
 }
 
-// scanDirectory scans a directory for files matching the pattern.
-func (s *Scanner) scanDirectory(ctx context.Context, dir string) ([]File, error) {
+// readDir lists a directory's matching files and dated subdirectories,
+// reusing the cached listing when the directory mtime is unchanged.
+// The listing is recorded in next for the following scan.
+func (s *Scanner) readDir(ctx context.Context, dir string, next map[string]dirListing) (dirListing, error) {
 	if err := ctx.Err(); err != nil {
-		return nil, err
+		return dirListing{}, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return dirListing{}, err
+	}
+	if cached, ok := s.cache[dir]; ok && cached.modTime.Equal(info.ModTime()) {
+		next[dir] = cached
+		return cached, nil
 	}
 
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, err
+		return dirListing{}, err
 	}
 
-	var files []File
+	listing := dirListing{modTime: info.ModTime(), notes: readNotes(dir, entries)}
 	for _, entry := range entries {
 		if entry.IsDir() {
+			if _, ok := parseBuildDir(entry.Name(), s.dirFormats); ok {
+				listing.buildDirs = append(listing.buildDirs, entry.Name())
+			}
 			continue
 		}
 
+		switch name := entry.Name(); {
+		case name == KeymapSVG:
+			listing.keymap = filepath.Join(dir, name)
+			continue
+		case name == KeymapYAML, isJunk(name), isNotes(name):
+			continue
+		}
 		matched, err := filepath.Match(s.filePattern, entry.Name())
 		if err != nil || !matched {
 			continue
@@ -139,14 +390,84 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) ([]File, error)
 			continue
 		}
 
-		files = append(files, File{
+		listing.files = append(listing.files, File{
 			Name: entry.Name(),
 			Path: filepath.Join(dir, entry.Name()),
 			Size: info.Size(),
 		})
 	}
 
-	return files, nil
+	if time.Since(listing.modTime) > racyWindow {
+		next[dir] = listing
+	}
+	return listing, nil
+}
+
+// isNotes reports whether name is a notes file rather than firmware.
+func isNotes(name string) bool {
+	for _, notes := range NotesFiles {
+		if strings.EqualFold(name, notes) {
+			return true
+		}
+	}
+	return false
+}
+
+// notesFile returns the name of the first notes file among a directory's
+// entries, or "" if it has none.
+func notesFile(entries []os.DirEntry) string {
+	for _, name := range NotesFiles {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(entry.Name(), name) {
+				return entry.Name()
+			}
+		}
+	}
+	return ""
+}
+
+// readNotes returns the trimmed text of a directory's notes file, or "" if
+// it has none.
+func readNotes(dir string, entries []os.DirEntry) string {
+	name := notesFile(entries)
+	if name == "" {
+		return ""
+	}
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxNotesSize))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// AddNote records a one-line note for the build in dir. The note is
+// prepended to the directory's notes file, creating NOTES.md if it has
+// none, so it becomes the build's summary.
+func AddNote(dir, note string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	name := notesFile(entries)
+	if name == "" {
+		name = NotesFiles[0]
+	}
+	path := filepath.Join(dir, name)
+
+	text := strings.TrimSpace(note) + "\n"
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(existing) > 0 {
+		text += "\n" + string(existing)
+	}
+	return os.WriteFile(path, []byte(text), 0644)
 }
 
 // FindLatest returns the most recent build, or nil if none found.
@@ -161,6 +482,52 @@ func (s *Scanner) FindLatest(ctx context.Context) (*Build, error) {
 	return &builds[0], nil
 }
 
+// junkSuffixes are editor swap/backup files and unfinished downloads.
+var junkSuffixes = []string{"~", ".swp", ".swo", ".tmp", ".part", ".crdownload", ".download"}
+
+// isJunk reports whether a file is noise that should never be listed, even
+// when it matches the file pattern: hidden files (.DS_Store, macOS ._
+// resource forks, vim swap files), emacs lock files, editor backups and
+// partial downloads.
+func isJunk(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, suffix := range junkSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBuildDir reports whether name is a build directory in one of
+// formats, returning its date as YYYYMMDD for dated formats.
+func parseBuildDir(name string, formats []DirFormat) (date string, ok bool) {
+	for _, format := range formats {
+		switch format {
+		case DirDate:
+			if isDateDir(name) {
+				return name, true
+			}
+		case DirISODate:
+			if t, err := time.Parse("2006-01-02", name); err == nil {
+				return t.Format("20060102"), true
+			}
+		case DirSemver:
+			if semverRegex.MatchString(name) {
+				return "", true
+			}
+		case DirHash:
+			if hashRegex.MatchString(name) {
+				return "", true
+			}
+		}
+	}
+	return "", false
+}
+
 // isDateDir checks if a string is in YYYYMMDD format.
 func isDateDir(s string) bool {
 	if len(s) != 8 {
@@ -186,6 +553,49 @@ func FormatDate(date string) string {
 	return t.Format("2006-01-02")
 }
 
+// Time returns when the build was made: its date for dated builds, the
+// directory mtime otherwise. It is zero when neither is known.
+func (b Build) Time() time.Time {
+	if b.Date != "" {
+		if t, err := time.ParseInLocation("20060102", b.Date, time.Local); err == nil {
+			return t
+		}
+	}
+	return b.modTime
+}
+
+// AgeDays returns how many calendar days before now t falls, 0 for today
+// or the future.
+func AgeDays(t, now time.Time) int {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if !day.Before(today) {
+		return 0
+	}
+	return int(today.Sub(day).Hours() / 24)
+}
+
+// FormatAge formats how long before now t was as a short relative age:
+// "today", "3d ago", "2mo ago" or "1y ago". A zero t formats as "".
+func FormatAge(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	days := AgeDays(t, now)
+	switch {
+	case days == 0:
+		return "today"
+	case days < 30:
+		return formatInt(int64(days)) + "d ago"
+	case days < 365:
+		return formatInt(int64(days/30)) + "mo ago"
+	default:
+		return formatInt(int64(days/365)) + "y ago"
+	}
+}
+
 // FormatSize formats bytes to human-readable size.
 func FormatSize(bytes int64) string {
 	const unit = 1024
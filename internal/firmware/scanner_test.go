@@ -4,7 +4,9 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestScanner_Scan_DatedDirectories(t *testing.T) {
@@ -46,6 +48,192 @@ func TestScanner_Scan_DatedDirectories(t *testing.T) {
 	}
 }
 
+func TestScanner_Scan_DirFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Hashes are ordered by directory mtime
+	old := time.Now().Add(-time.Hour)
+	dirs := map[string]time.Time{
+		"20250101":   {},
+		"2025-01-15": {},
+		"v1.4.2":     {},
+		"v1.10.0":    {},
+		"1.10.0-rc1": {},
+		"3f9c2ab":    old,
+		"a1b2c3d":    {},
+		"notes":      {},
+	}
+	for name, mtime := range dirs {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !mtime.IsZero() {
+			if err := os.Chtimes(dir, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := NewScanner(tmpDir, "*.uf2").Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	var titles []string
+	for _, b := range builds {
+		titles = append(titles, b.Title())
+	}
+	want := []string{"2025-01-15", "2025-01-01", "v1.10.0", "1.10.0-rc1", "v1.4.2", "a1b2c3d", "3f9c2ab", "current"}
+	if strings.Join(titles, " ") != strings.Join(want, " ") {
+		t.Errorf("builds = %v, want %v", titles, want)
+	}
+	if builds[0].Date != "20250115" {
+		t.Errorf("ISO date = %q, want 20250115", builds[0].Date)
+	}
+}
+
+func TestScanner_SetDirFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"20250101", "v1.4.2", "3f9c2ab"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := NewScanner(tmpDir, "*.uf2")
+	scanner.SetDirFormats([]DirFormat{DirSemver})
+	builds, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds) != 1 || builds[0].Name != "v1.4.2" {
+		t.Errorf("expected only the v1.4.2 build, got %+v", builds)
+	}
+}
+
+func TestScanner_Scan_Notes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	notes := map[string]string{
+		"20250101": "NOTES.md",
+		"20250102": "description.txt",
+		"20250103": "",
+	}
+	for date, notesFile := range notes {
+		dir := filepath.Join(tmpDir, date)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if notesFile != "" {
+			text := "\n# Homerow mod timing test\n\ntapping-term-ms = 180\n"
+			if err := os.WriteFile(filepath.Join(dir, notesFile), []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	builds, err := NewScanner(tmpDir, "*").Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds) != 3 {
+		t.Fatalf("expected 3 builds, got %d", len(builds))
+	}
+
+	for _, b := range builds {
+		want := "Homerow mod timing test"
+		if b.Date == "20250103" {
+			want = ""
+		}
+		if got := b.Summary(); got != want {
+			t.Errorf("%s: Summary() = %q, want %q", b.Date, got, want)
+		}
+		if len(b.Files) != 1 {
+			t.Errorf("%s: notes file listed as firmware: %v", b.Date, b.Files)
+		}
+	}
+	if builds[1].Notes != "# Homerow mod timing test\n\ntapping-term-ms = 180" {
+		t.Errorf("Notes = %q", builds[1].Notes)
+	}
+}
+
+func TestScanner_Scan_Keymap(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "20250101")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"firmware.uf2", KeymapYAML, KeymapSVG} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builds, err := NewScanner(tmpDir, "*").Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds) != 1 {
+		t.Fatalf("expected 1 build, got %d", len(builds))
+	}
+	if builds[0].Keymap != filepath.Join(dir, KeymapSVG) {
+		t.Errorf("Keymap = %q", builds[0].Keymap)
+	}
+	if len(builds[0].Files) != 1 {
+		t.Errorf("keymap preview listed as firmware: %v", builds[0].Files)
+	}
+}
+
+func TestAddNote(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := AddNote(dir, "  first try  "); err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "NOTES.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first try\n" {
+		t.Errorf("NOTES.md = %q", data)
+	}
+
+	// An existing notes file keeps its text below the new note
+	if err := os.Remove(filepath.Join(dir, "NOTES.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "description.txt"), []byte("older text\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddNote(dir, "homerow mod timing test"); err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "description.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "homerow mod timing test\n\nolder text\n" {
+		t.Errorf("description.txt = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NOTES.md")); !os.IsNotExist(err) {
+		t.Error("NOTES.md should not be created next to description.txt")
+	}
+}
+
 func TestScanner_Scan_FlatStructure(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -138,6 +326,50 @@ func TestScanner_Scan_PatternMatching(t *testing.T) {
 	}
 }
 
+func TestScanner_Scan_SkipsJunk(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A flat build with junk around the real files
+	files := []string{
+		"left.uf2", "right.uf2",
+		"._left.uf2", ".DS_Store", ".left.uf2.swp", "right.uf2~",
+		"left.uf2.part", "right.uf2.crdownload", "#left.uf2#",
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, f), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A dated directory holding nothing but junk is not a build
+	junkDir := filepath.Join(tmpDir, "20250102")
+	if err := os.MkdirAll(junkDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"._corne_left.uf2", "corne_left.uf2.part"} {
+		if err := os.WriteFile(filepath.Join(junkDir, f), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := NewScanner(tmpDir, "*.uf2*")
+	builds, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(builds) != 1 {
+		t.Fatalf("expected 1 build, got %d", len(builds))
+	}
+	var names []string
+	for _, f := range builds[0].Files {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "left.uf2" || names[1] != "right.uf2" {
+		t.Errorf("files = %v, want [left.uf2 right.uf2]", names)
+	}
+}
+
 func TestScanner_Scan_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -182,6 +414,155 @@ func TestScanner_Scan_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestScanner_Scan_MultipleSources(t *testing.T) {
+	localDir := t.TempDir()
+	ciDir := t.TempDir()
+
+	// Local has an older and a newer build, CI has one in between plus a flat build
+	for dir, dates := range map[string][]string{
+		localDir: {"20250101", "20250120"},
+		ciDir:    {"20250110", "20250120"},
+	} {
+		for _, date := range dates {
+			buildDir := filepath.Join(dir, date)
+			if err := os.MkdirAll(buildDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(buildDir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(ciDir, "flat.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := NewMultiScanner([]Source{
+		{Label: "local", Dir: localDir},
+		{Label: "ci", Dir: ciDir},
+		{Label: "missing", Dir: filepath.Join(localDir, "nonexistent")},
+	}, "*.uf2")
+	builds, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	expected := []struct{ date, source string }{
+		{"20250120", "local"}, // same date keeps source order
+		{"20250120", "ci"},
+		{"20250110", "ci"},
+		{"20250101", "local"},
+		{"", "ci"},
+	}
+	if len(builds) != len(expected) {
+		t.Fatalf("expected %d builds, got %d", len(expected), len(builds))
+	}
+	for i, want := range expected {
+		if builds[i].Date != want.date || builds[i].Source != want.source {
+			t.Errorf("build %d = %s/%s, want %s/%s", i, builds[i].Source, builds[i].Date, want.source, want.date)
+		}
+	}
+}
+
+func TestScanner_ScanEach_ReportsEveryBuild(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "flat.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, date := range []string{"20250101", "20250115"} {
+		dir := filepath.Join(tmpDir, date)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "firmware.uf2"), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var found []Build
+	builds, err := NewScanner(tmpDir, "*.uf2").ScanEach(context.Background(), func(b Build) {
+		found = append(found, b)
+	})
+	if err != nil {
+		t.Fatalf("ScanEach failed: %v", err)
+	}
+
+	if len(found) != 3 {
+		t.Fatalf("expected 3 found callbacks, got %d", len(found))
+	}
+	if len(builds) != 3 || builds[0].Date != "20250115" || builds[2].Date != "" {
+		t.Errorf("returned builds not sorted newest first with flat last: %+v", builds)
+	}
+}
+
+func TestScanner_Scan_CachesUnchangedDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	buildDir := filepath.Join(tmpDir, "20250101")
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "left.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Age the directories past the racy window so their listings are cached
+	old := time.Now().Add(-time.Hour)
+	for _, dir := range []string{buildDir, tmpDir} {
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := NewScanner(tmpDir, "*.uf2")
+	if _, err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	// Add a file but restore the mtime: the cached listing is reused
+	if err := os.WriteFile(filepath.Join(buildDir, "right.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(buildDir, old, old); err != nil {
+		t.Fatal(err)
+	}
+	builds, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds[0].Files) != 1 {
+		t.Errorf("expected cached listing with 1 file, got %d", len(builds[0].Files))
+	}
+
+	// A changed mtime re-reads just that directory
+	newer := old.Add(time.Minute)
+	if err := os.Chtimes(buildDir, newer, newer); err != nil {
+		t.Fatal(err)
+	}
+	builds, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds[0].Files) != 2 {
+		t.Errorf("expected 2 files after directory changed, got %d", len(builds[0].Files))
+	}
+
+	// New dated directories are picked up once the parent changes
+	if err := os.MkdirAll(filepath.Join(tmpDir, "20250102"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "20250102", "left.uf2"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builds, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(builds) != 2 || builds[0].Date != "20250102" {
+		t.Errorf("expected new build 20250102 first, got %+v", builds)
+	}
+}
+
 func TestScanner_FindLatest(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -266,6 +647,80 @@ func TestFormatDate(t *testing.T) {
 	}
 }
 
+func TestBuildMatches(t *testing.T) {
+	b := Build{
+		Date:   "20250115",
+		Name:   "20250115",
+		Source: "ci",
+		Notes:  "Homerow mod timing test",
+		Files:  []File{{Name: "corne_left.uf2"}, {Name: "corne_right.uf2"}},
+	}
+	tags := []string{"stable"}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"2025-01", true},
+		{"0115", true},
+		{"hrm", true},
+		{"HOMEROW", true},
+		{"crnrght", true},
+		{"#stable", true},
+		{"stbl ci", true},
+		{"stable travel", false},
+		{"2024", false},
+		{"xyz", false},
+	}
+
+	for _, tc := range tests {
+		if got := b.Matches(tc.query, tags); got != tc.want {
+			t.Errorf("Matches(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2025, 3, 15, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		input    time.Time
+		expected string
+	}{
+		{time.Time{}, ""},
+		{time.Date(2025, 3, 15, 0, 0, 0, 0, time.Local), "today"},
+		{time.Date(2025, 3, 16, 0, 0, 0, 0, time.Local), "today"},
+		{time.Date(2025, 3, 14, 23, 0, 0, 0, time.Local), "1d ago"},
+		{time.Date(2025, 3, 12, 0, 0, 0, 0, time.Local), "3d ago"},
+		{time.Date(2025, 1, 10, 0, 0, 0, 0, time.Local), "2mo ago"},
+		{time.Date(2023, 11, 2, 0, 0, 0, 0, time.Local), "1y ago"},
+	}
+
+	for _, tc := range tests {
+		got := FormatAge(tc.input, now)
+		if got != tc.expected {
+			t.Errorf("FormatAge(%v) = %q, want %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestBuildTime(t *testing.T) {
+	dated := Build{Date: "20250115"}
+	if got, want := dated.Time(), time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("dated Time() = %v, want %v", got, want)
+	}
+
+	mtime := time.Date(2025, 2, 1, 12, 0, 0, 0, time.Local)
+	named := Build{Name: "abc1234", modTime: mtime}
+	if got := named.Time(); !got.Equal(mtime) {
+		t.Errorf("named Time() = %v, want directory mtime %v", got, mtime)
+	}
+
+	if got := (Build{}).Time(); !got.IsZero() {
+		t.Errorf("unknown Time() = %v, want zero", got)
+	}
+}
+
 func TestFormatSize(t *testing.T) {
 	tests := []struct {
 		input    int64
@@ -286,3 +741,16 @@ func TestFormatSize(t *testing.T) {
 		}
 	}
 }
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"20250102", "corne_left.uf2", "my build"} {
+		if !ValidName(name) {
+			t.Errorf("ValidName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "..", ".hidden", "a/b", `a\b`} {
+		if ValidName(name) {
+			t.Errorf("ValidName(%q) = true, want false", name)
+		}
+	}
+}
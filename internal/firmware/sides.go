@@ -0,0 +1,177 @@
+package firmware
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RegexPrefix marks a side pattern as a regular expression instead of a glob.
+const RegexPrefix = "re:"
+
+// StudioSuffix marks ZMK Studio-enabled firmware, e.g. corne_left_studio.uf2.
+const StudioSuffix = "_studio"
+
+// IsStudioFirmware reports whether the file name carries the Studio suffix.
+func IsStudioFirmware(name string) bool {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(strings.ToLower(stem), StudioSuffix)
+}
+
+// SideMatcher selects the firmware file for each keyboard side.
+//
+// Precedence for a side:
+//  1. If patterns are configured for the side, the first file matching any
+//     of them wins. Globs are case-insensitive; regexes are used as written.
+//  2. Otherwise, the first file whose name contains the side name
+//     (case-insensitive) wins.
+//  3. If nothing matched and the build has exactly one file, that file is used.
+//
+// When a build holds both regular and Studio-enabled files for a side, the
+// variant selected with SetStudio is preferred.
+type SideMatcher struct {
+	rules  map[string][]sideRule
+	studio bool
+}
+
+// sideRule is a compiled glob or regex pattern.
+type sideRule struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+func (r sideRule) match(name string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(name)
+	}
+	matched, _ := filepath.Match(r.glob, strings.ToLower(name))
+	return matched
+}
+
+// NewSideMatcher compiles per-side patterns. Patterns are globs, or regular
+// expressions when prefixed with "re:". Sides without patterns fall back to
+// substring matching on the side name.
+func NewSideMatcher(patterns map[string][]string) (*SideMatcher, error) {
+	m := &SideMatcher{rules: make(map[string][]sideRule)}
+	for side, list := range patterns {
+		key := strings.ToLower(side)
+		for _, p := range list {
+			rule, err := compileSideRule(p)
+			if err != nil {
+				return nil, fmt.Errorf("side %q: %w", side, err)
+			}
+			m.rules[key] = append(m.rules[key], rule)
+		}
+	}
+	return m, nil
+}
+
+// SetStudio selects whether Studio-enabled or regular firmware is preferred.
+func (m *SideMatcher) SetStudio(studio bool) {
+	m.studio = studio
+}
+
+// ValidateSidePattern reports whether p is a valid glob or "re:" regex.
+func ValidateSidePattern(p string) error {
+	_, err := compileSideRule(p)
+	return err
+}
+
+func compileSideRule(p string) (sideRule, error) {
+	if expr, ok := strings.CutPrefix(p, RegexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return sideRule{}, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		return sideRule{regex: re}, nil
+	}
+	glob := strings.ToLower(p)
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return sideRule{}, fmt.Errorf("invalid glob %q: %w", p, err)
+	}
+	return sideRule{glob: glob}, nil
+}
+
+// matches reports whether the file name belongs to side.
+func (m *SideMatcher) matches(side, name string) bool {
+	key := strings.ToLower(side)
+	if rules, ok := m.rules[key]; ok {
+		for _, r := range rules {
+			if r.match(name) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(strings.ToLower(name), key)
+}
+
+// Match returns the firmware file for side, or nil if none matches.
+func (m *SideMatcher) Match(side string, files []File) *File {
+	var fallback *File
+	for i := range files {
+		if !m.matches(side, files[i].Name) {
+			continue
+		}
+		if IsStudioFirmware(files[i].Name) == m.studio {
+			return &files[i]
+		}
+		if fallback == nil {
+			fallback = &files[i]
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	if len(files) == 1 {
+		return &files[0]
+	}
+	return nil
+}
+
+// SideOf returns the only one of sides that the file name belongs to,
+// or "" if none or several match.
+func (m *SideMatcher) SideOf(sides []string, name string) string {
+	var found string
+	for _, side := range sides {
+		if !m.matches(side, name) {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = side
+	}
+	return found
+}
+
+// Missing returns the sides, in order, that no file matches. Unlike Match,
+// a build's only file does not stand in for a side when it names another.
+func (m *SideMatcher) Missing(sides []string, files []File) []string {
+	var missing []string
+	for _, side := range sides {
+		f := m.Match(side, files)
+		if f == nil || (!m.matches(side, f.Name) && m.SideOf(sides, f.Name) != "") {
+			missing = append(missing, side)
+		}
+	}
+	return missing
+}
+
+// Ambiguous returns the names of files that match more than one of sides.
+func (m *SideMatcher) Ambiguous(sides []string, files []File) []string {
+	var names []string
+	for _, f := range files {
+		count := 0
+		for _, side := range sides {
+			if m.matches(side, f.Name) {
+				count++
+			}
+		}
+		if count > 1 {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,142 @@
+package firmware
+
+import "testing"
+
+func TestSideMatcher_DefaultSubstring(t *testing.T) {
+	matcher, err := NewSideMatcher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []File{{Name: "corne_LEFT.uf2"}, {Name: "corne_right.uf2"}}
+
+	if f := matcher.Match("left", files); f == nil || f.Name != "corne_LEFT.uf2" {
+		t.Errorf("left matched %v, want corne_LEFT.uf2", f)
+	}
+	if f := matcher.Match("right", files); f == nil || f.Name != "corne_right.uf2" {
+		t.Errorf("right matched %v, want corne_right.uf2", f)
+	}
+}
+
+func TestSideMatcher_Patterns(t *testing.T) {
+	matcher, err := NewSideMatcher(map[string][]string{
+		"left":  {"*_l.uf2"},
+		"right": {"re:_r\\.uf2$"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []File{{Name: "corne_left_r.uf2"}, {Name: "corne_L.uf2"}}
+
+	// Configured rules replace substring matching
+	if f := matcher.Match("left", files); f == nil || f.Name != "corne_L.uf2" {
+		t.Errorf("left matched %v, want corne_L.uf2", f)
+	}
+	if f := matcher.Match("right", files); f == nil || f.Name != "corne_left_r.uf2" {
+		t.Errorf("right matched %v, want corne_left_r.uf2", f)
+	}
+}
+
+func TestSideMatcher_SingleFileFallback(t *testing.T) {
+	matcher, _ := NewSideMatcher(nil)
+
+	files := []File{{Name: "corne.uf2"}}
+	if f := matcher.Match("main", files); f == nil || f.Name != "corne.uf2" {
+		t.Errorf("expected single file fallback, got %v", f)
+	}
+
+	files = append(files, File{Name: "reset.uf2"})
+	if f := matcher.Match("main", files); f != nil {
+		t.Errorf("expected no match with several files, got %v", f)
+	}
+}
+
+func TestSideMatcher_Ambiguous(t *testing.T) {
+	matcher, _ := NewSideMatcher(map[string][]string{
+		"right": {"*.uf2"},
+	})
+
+	files := []File{{Name: "corne_left.uf2"}, {Name: "settings_reset.bin"}}
+	ambiguous := matcher.Ambiguous([]string{"left", "right"}, files)
+
+	if len(ambiguous) != 1 || ambiguous[0] != "corne_left.uf2" {
+		t.Errorf("ambiguous = %v, want [corne_left.uf2]", ambiguous)
+	}
+}
+
+func TestSideMatcher_Missing(t *testing.T) {
+	matcher, _ := NewSideMatcher(nil)
+	sides := []string{"left", "right", "dongle"}
+
+	if missing := matcher.Missing(sides, []File{{Name: "corne_left.uf2"}}); len(missing) != 2 {
+		t.Errorf("missing = %v, want [right dongle]: the only file belongs to left", missing)
+	}
+	if missing := matcher.Missing([]string{"main"}, []File{{Name: "zmk.uf2"}}); len(missing) != 0 {
+		t.Errorf("missing = %v, want the only file to stand in for main", missing)
+	}
+
+	files := []File{{Name: "corne_left.uf2"}, {Name: "corne_dongle.uf2"}}
+	if missing := matcher.Missing(sides, files); len(missing) != 1 || missing[0] != "right" {
+		t.Errorf("missing = %v, want [right]", missing)
+	}
+	files = append(files, File{Name: "corne_right.uf2"})
+	if missing := matcher.Missing(sides, files); len(missing) != 0 {
+		t.Errorf("missing = %v, want none", missing)
+	}
+}
+
+func TestSideMatcher_SideOf(t *testing.T) {
+	matcher, _ := NewSideMatcher(map[string][]string{
+		"dongle": {"*_dongle*.uf2"},
+	})
+	sides := []string{"left", "right", "dongle"}
+
+	tests := map[string]string{
+		"corne_right.uf2":         "right",
+		"corne_dongle.uf2":        "dongle",
+		"settings_reset.uf2":      "",
+		"corne_left_dongle.uf2":   "",
+		"Corne_Left-nicenano.uf2": "left",
+	}
+	for name, want := range tests {
+		if got := matcher.SideOf(sides, name); got != want {
+			t.Errorf("SideOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewSideMatcher_InvalidPatterns(t *testing.T) {
+	if _, err := NewSideMatcher(map[string][]string{"left": {"re:("}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := NewSideMatcher(map[string][]string{"left": {"[a-"}}); err == nil {
+		t.Error("expected error for invalid glob")
+	}
+}
+
+func TestSideMatcher_StudioVariant(t *testing.T) {
+	files := []File{
+		{Name: "corne_left.uf2"},
+		{Name: "corne_left_studio.uf2"},
+		{Name: "corne_right.uf2"},
+	}
+
+	m, err := NewSideMatcher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Match("left", files); got == nil || got.Name != "corne_left.uf2" {
+		t.Errorf("regular match = %v, want corne_left.uf2", got)
+	}
+
+	m.SetStudio(true)
+	if got := m.Match("left", files); got == nil || got.Name != "corne_left_studio.uf2" {
+		t.Errorf("studio match = %v, want corne_left_studio.uf2", got)
+	}
+	// No Studio build for the right half: fall back to the regular one
+	if got := m.Match("right", files); got == nil || got.Name != "corne_right.uf2" {
+		t.Errorf("studio fallback = %v, want corne_right.uf2", got)
+	}
+}
@@ -0,0 +1,208 @@
+package firmware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Signature files written next to a build's manifest by each signing method.
+const (
+	MinisignSignature = ManifestName + ".minisig"
+	SSHSignature      = ManifestName + ".sig"
+)
+
+// sshNamespace scopes ssh signatures to kbflash manifests, so a signature
+// the key made for something else cannot pass as one.
+const sshNamespace = "kbflash"
+
+// ErrUnsigned is returned by Verify for firmware without a signed manifest
+// entry.
+var ErrUnsigned = errors.New("firmware is not signed")
+
+// ErrBadSignature is returned by Verify when the manifest's signature is not
+// from a trusted key.
+var ErrBadSignature = errors.New("signature not from a trusted key")
+
+// Signer signs the SHA256SUMS manifest of builds with minisign or
+// ssh-keygen -Y, and verifies the signatures of builds made elsewhere.
+// Signing the manifest covers every firmware file it lists.
+type Signer struct {
+	method  string   // "minisign" or "ssh", "" when signing is off
+	key     string   // secret key file, or an ssh public key held by ssh-agent
+	trusted []string // public keys: minisign's base64 form or ssh authorized_keys lines
+}
+
+// NewSigner creates a signer for method using the secret key file key,
+// which may be empty to only verify, trusting signatures from the trusted
+// public keys.
+func NewSigner(method, key string, trusted []string) *Signer {
+	return &Signer{method: method, key: key, trusted: trusted}
+}
+
+// CanSign reports whether a key to sign with is configured.
+func (s *Signer) CanSign() bool {
+	return s.method != "" && s.key != ""
+}
+
+// signatureName returns the signature file name the method uses.
+func (s *Signer) signatureName() string {
+	if s.method == "ssh" {
+		return SSHSignature
+	}
+	return MinisignSignature
+}
+
+// Sign signs the SHA256SUMS manifest in dir, replacing any signature of an
+// earlier version of it. The key must not need a passphrase typed in: use
+// an unencrypted minisign key, or an ssh key loaded in ssh-agent.
+func (s *Signer) Sign(ctx context.Context, dir string) error {
+	manifest := filepath.Join(dir, ManifestName)
+	sig := filepath.Join(dir, s.signatureName())
+	if err := os.Remove(sig); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch s.method {
+	case "minisign":
+		cmd = exec.CommandContext(ctx, "minisign", "-S", "-s", s.key, "-m", manifest, "-x", sig)
+	case "ssh":
+		cmd = exec.CommandContext(ctx, "ssh-keygen", "-Y", "sign", "-f", s.key, "-n", sshNamespace, manifest)
+	default:
+		return fmt.Errorf("unknown signing method %q", s.method)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("sign %s: %w: %s", ManifestName, err, lastLine(msg))
+		}
+		return fmt.Errorf("sign %s: %w", ManifestName, err)
+	}
+	return nil
+}
+
+// SignBuild records every file in a build in its directory's SHA256SUMS,
+// for builds whose builder wrote none, and signs the manifest.
+func (s *Signer) SignBuild(ctx context.Context, build Build) error {
+	for _, f := range build.Files {
+		if err := UpdateManifest(f.Path); err != nil {
+			return err
+		}
+	}
+	return s.Sign(ctx, build.Path)
+}
+
+// Verify checks that path is listed in its directory's SHA256SUMS with a
+// matching digest, and that the manifest is signed with a trusted key.
+func (s *Signer) Verify(ctx context.Context, path string) error {
+	dir := filepath.Dir(path)
+	name := filepath.Base(path)
+	manifest := filepath.Join(dir, ManifestName)
+	sig := filepath.Join(dir, s.signatureName())
+	if _, err := os.Stat(sig); os.IsNotExist(err) {
+		return fmt.Errorf("%w: no %s next to %s", ErrUnsigned, s.signatureName(), name)
+	}
+
+	if err := s.verifySignature(ctx, manifest, sig); err != nil {
+		return err
+	}
+
+	sums, err := readManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if _, ok := sums[name]; !ok {
+		return fmt.Errorf("%w: %s is not listed in %s", ErrUnsigned, name, ManifestName)
+	}
+	return VerifyManifest(path)
+}
+
+// verifySignature checks sig over manifest against each trusted key.
+func (s *Signer) verifySignature(ctx context.Context, manifest, sig string) error {
+	if len(s.trusted) == 0 {
+		return fmt.Errorf("%w: no trusted keys configured", ErrBadSignature)
+	}
+
+	switch s.method {
+	case "minisign":
+		for _, key := range s.trusted {
+			cmd := exec.CommandContext(ctx, "minisign", "-V", "-q", "-P", key, "-m", manifest, "-x", sig)
+			if err := cmd.Run(); err == nil {
+				return nil
+			} else if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrBadSignature, filepath.Join(filepath.Base(filepath.Dir(manifest)), ManifestName))
+
+	case "ssh":
+		// ssh-keygen checks signers against an allowed_signers file
+		var signers strings.Builder
+		for _, key := range s.trusted {
+			fmt.Fprintf(&signers, "%s namespaces=%q %s\n", sshNamespace, sshNamespace, key)
+		}
+		f, err := os.CreateTemp("", "kbflash-allowed-signers-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.WriteString(signers.String()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, "ssh-keygen", "-Y", "verify", "-f", f.Name(), "-I", sshNamespace, "-n", sshNamespace, "-s", sig)
+		cmd.Stdin = bytes.NewReader(data)
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %s", ErrBadSignature, filepath.Join(filepath.Base(filepath.Dir(manifest)), ManifestName))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown signing method %q", s.method)
+}
+
+// Check returns a check for FlasherOptions.Verify that verifies firmware
+// under any of dirs and lets other files through, or nil when no keys are
+// trusted.
+func (s *Signer) Check(dirs []string) func(ctx context.Context, path string) error {
+	if s.method == "" || len(s.trusted) == 0 || len(dirs) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, path string) error {
+		for _, dir := range dirs {
+			if within(dir, path) {
+				return s.Verify(ctx, path)
+			}
+		}
+		return nil
+	}
+}
+
+// within reports whether path is inside dir.
+func within(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,221 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeMinisign puts a minisign on PATH whose signatures are the signing
+// key's name and the manifest's digest, and which verifies them against
+// "RW" + the key name.
+func fakeMinisign(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/bash
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-S|-V|-q) mode="${mode:-$1}" ;;
+		-s) keyfile="$2"; shift ;;
+		-P) pub="$2"; shift ;;
+		-m) msg="$2"; shift ;;
+		-x) sig="$2"; shift ;;
+	esac
+	shift
+done
+sum="$(sha256sum "$msg" | cut -d' ' -f1)"
+if [ "$mode" = "-S" ]; then
+	[ -f "$keyfile" ] || { echo "Error: key not found"; exit 2; }
+	echo "$(basename "$keyfile") $sum" > "$sig"
+	exit 0
+fi
+[ "$(cat "$sig")" = "${pub#RW} $sum" ] || { echo "Signature verification failed"; exit 1; }
+`
+	if err := os.WriteFile(filepath.Join(dir, "minisign"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// writeBuild writes a build of the given files into root/build and records
+// them in its manifest.
+func writeBuild(t *testing.T, root string, names ...string) string {
+	t.Helper()
+	dir := filepath.Join(root, "build")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("firmware "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := UpdateManifest(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSigner_Minisign(t *testing.T) {
+	fakeMinisign(t)
+	root := t.TempDir()
+	dir := writeBuild(t, root, "corne_left.uf2")
+	os.MkdirAll(filepath.Join(root, "keys"), 0755)
+	os.WriteFile(filepath.Join(root, "keys", "alice"), []byte("secret"), 0600)
+	ctx := context.Background()
+
+	signer := NewSigner("minisign", filepath.Join(root, "keys", "alice"), []string{"RWbob", "RWalice"})
+	if err := signer.Sign(ctx, dir); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, MinisignSignature)); err != nil {
+		t.Fatalf("no signature written: %v", err)
+	}
+	left := filepath.Join(dir, "corne_left.uf2")
+	if err := signer.Verify(ctx, left); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// A build signed by someone else is refused
+	other := NewSigner("minisign", "", []string{"RWbob"})
+	if err := other.Verify(ctx, left); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with another trusted key = %v, want ErrBadSignature", err)
+	}
+
+	// So is a file added after signing, even with a manifest entry
+	right := filepath.Join(dir, "corne_right.uf2")
+	os.WriteFile(right, []byte("firmware"), 0644)
+	if err := signer.Verify(ctx, right); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Verify of an unlisted file = %v, want ErrUnsigned", err)
+	}
+	if err := UpdateManifest(right); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Verify(ctx, right); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify after the manifest changed = %v, want ErrBadSignature", err)
+	}
+
+	// Re-signing covers it, and a swapped file no longer matches its digest
+	if err := signer.Sign(ctx, dir); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := signer.Verify(ctx, right); err != nil {
+		t.Errorf("Verify after re-signing: %v", err)
+	}
+	os.WriteFile(left, []byte("tampered"), 0644)
+	if err := signer.Verify(ctx, left); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Verify of a swapped file = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestSigner_Minisign_Failure(t *testing.T) {
+	fakeMinisign(t)
+	dir := writeBuild(t, t.TempDir(), "corne_left.uf2")
+
+	err := NewSigner("minisign", "/missing.key", nil).Sign(context.Background(), dir)
+	if err == nil || !strings.Contains(err.Error(), "key not found") {
+		t.Errorf("Sign with a missing key = %v, want minisign's error", err)
+	}
+}
+
+func TestSigner_Unsigned(t *testing.T) {
+	dir := writeBuild(t, t.TempDir(), "corne_left.uf2")
+
+	for _, method := range []string{"minisign", "ssh"} {
+		err := NewSigner(method, "", []string{"key"}).Verify(context.Background(), filepath.Join(dir, "corne_left.uf2"))
+		if !errors.Is(err, ErrUnsigned) {
+			t.Errorf("%s: Verify of an unsigned build = %v, want ErrUnsigned", method, err)
+		}
+	}
+}
+
+func TestSigner_SSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	root := t.TempDir()
+	dir := writeBuild(t, root, "corne_left.uf2")
+	keygen := func(name string) (string, string) {
+		key := filepath.Join(root, name)
+		if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", key).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen: %v: %s", err, out)
+		}
+		pub, err := os.ReadFile(key + ".pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, strings.TrimSpace(string(pub))
+	}
+	aliceKey, alicePub := keygen("alice")
+	_, bobPub := keygen("bob")
+	ctx := context.Background()
+
+	signer := NewSigner("ssh", aliceKey, []string{bobPub, alicePub})
+	if err := signer.Sign(ctx, dir); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	left := filepath.Join(dir, "corne_left.uf2")
+	if err := signer.Verify(ctx, left); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := NewSigner("ssh", "", []string{bobPub}).Verify(ctx, left); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with another trusted key = %v, want ErrBadSignature", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, ManifestName), []byte("0000  corne_left.uf2\n"), 0644)
+	if err := signer.Verify(ctx, left); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify of an edited manifest = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestSigner_Check(t *testing.T) {
+	fakeMinisign(t)
+	root := t.TempDir()
+	shared := writeBuild(t, filepath.Join(root, "shared"), "corne_left.uf2")
+	local := writeBuild(t, filepath.Join(root, "local"), "corne_left.uf2")
+	signer := NewSigner("minisign", "", []string{"RWalice"})
+
+	if NewSigner("minisign", "key", nil).Check([]string{root}) != nil {
+		t.Error("Check without trusted keys is not nil")
+	}
+	if signer.Check(nil) != nil {
+		t.Error("Check without sources is not nil")
+	}
+
+	check := signer.Check([]string{filepath.Join(root, "shared")})
+	ctx := context.Background()
+	if err := check(ctx, filepath.Join(shared, "corne_left.uf2")); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("check of an unsigned shared build = %v, want ErrUnsigned", err)
+	}
+	if err := check(ctx, filepath.Join(local, "corne_left.uf2")); err != nil {
+		t.Errorf("check of a local build = %v, want nil", err)
+	}
+}
+
+func TestFlasher_Flash_Verify(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "firmware.uf2")
+	dst := filepath.Join(tmpDir, "device")
+	os.WriteFile(src, []byte("firmware"), 0644)
+	os.Mkdir(dst, 0755)
+
+	flasher := NewFlasherWithOptions(FlasherOptions{
+		Verify: func(ctx context.Context, path string) error { return ErrUnsigned },
+	})
+	result := flasher.Flash(context.Background(), src, dst, nil)
+	if result.Success || !errors.Is(result.Error, ErrUnsigned) {
+		t.Fatalf("Flash = %+v, want refused as unsigned", result)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "firmware.uf2")); !os.IsNotExist(err) {
+		t.Error("unsigned firmware was written to the device")
+	}
+}
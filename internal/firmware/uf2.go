@@ -0,0 +1,141 @@
+package firmware
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// UF2 block layout, see https://github.com/microsoft/uf2
+const (
+	uf2BlockSize   = 512
+	uf2MagicStart0 = 0x0A324655
+	uf2MagicStart1 = 0x9E5D5157
+	uf2MagicEnd    = 0x0AB16F30
+	uf2MaxPayload  = 476
+)
+
+// ErrNotUF2 is returned when data is not a sequence of UF2 blocks.
+var ErrNotUF2 = errors.New("not a UF2 file")
+
+// UF2Block is one decoded 512-byte UF2 block.
+type UF2Block struct {
+	Flags      uint32
+	TargetAddr uint32
+	BlockNo    uint32
+	NumBlocks  uint32
+	Data       []byte // payload only
+}
+
+// ParseUF2 decodes every block in a UF2 image.
+func ParseUF2(data []byte) ([]UF2Block, error) {
+	if len(data) == 0 || len(data)%uf2BlockSize != 0 {
+		return nil, fmt.Errorf("%w: size %d is not a multiple of %d", ErrNotUF2, len(data), uf2BlockSize)
+	}
+
+	blocks := make([]UF2Block, 0, len(data)/uf2BlockSize)
+	for off := 0; off < len(data); off += uf2BlockSize {
+		b := data[off : off+uf2BlockSize]
+		le := binary.LittleEndian
+		if le.Uint32(b[0:]) != uf2MagicStart0 || le.Uint32(b[4:]) != uf2MagicStart1 || le.Uint32(b[508:]) != uf2MagicEnd {
+			return nil, fmt.Errorf("%w: bad magic in block %d", ErrNotUF2, off/uf2BlockSize)
+		}
+		size := le.Uint32(b[16:])
+		if size > uf2MaxPayload {
+			return nil, fmt.Errorf("%w: payload size %d in block %d", ErrNotUF2, size, off/uf2BlockSize)
+		}
+		blocks = append(blocks, UF2Block{
+			Flags:      le.Uint32(b[8:]),
+			TargetAddr: le.Uint32(b[12:]),
+			BlockNo:    le.Uint32(b[20:]),
+			NumBlocks:  le.Uint32(b[24:]),
+			Data:       b[32 : 32+size],
+		})
+	}
+	return blocks, nil
+}
+
+// UF2PayloadSize returns the number of bytes a UF2 file writes to flash.
+func UF2PayloadSize(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	blocks, err := ParseUF2(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	var size int64
+	for _, blk := range blocks {
+		size += int64(len(blk.Data))
+	}
+	return size, nil
+}
+
+// UF2Diff summarises the difference between two UF2 images.
+type UF2Diff struct {
+	BlocksA, BlocksB   int
+	PayloadA, PayloadB int64
+	DifferentBlocks    int // target addresses whose payload differs or exists on one side only
+}
+
+// Identical reports whether both images write the same payload to the same addresses.
+func (d UF2Diff) Identical() bool {
+	return d.DifferentBlocks == 0
+}
+
+// SizeDelta is the payload size of B minus A in bytes.
+func (d UF2Diff) SizeDelta() int64 {
+	return d.PayloadB - d.PayloadA
+}
+
+// DiffUF2 compares the decoded payloads of two UF2 images block by block,
+// keyed by target address so reordered blocks are not counted as changes.
+func DiffUF2(a, b []byte) (UF2Diff, error) {
+	blocksA, err := ParseUF2(a)
+	if err != nil {
+		return UF2Diff{}, err
+	}
+	blocksB, err := ParseUF2(b)
+	if err != nil {
+		return UF2Diff{}, err
+	}
+
+	diff := UF2Diff{BlocksA: len(blocksA), BlocksB: len(blocksB)}
+	byAddr := make(map[uint32][]byte, len(blocksA))
+	for _, blk := range blocksA {
+		byAddr[blk.TargetAddr] = blk.Data
+		diff.PayloadA += int64(len(blk.Data))
+	}
+	for _, blk := range blocksB {
+		diff.PayloadB += int64(len(blk.Data))
+		other, ok := byAddr[blk.TargetAddr]
+		if !ok || string(other) != string(blk.Data) {
+			diff.DifferentBlocks++
+		}
+		delete(byAddr, blk.TargetAddr)
+	}
+	// Addresses only written by A
+	diff.DifferentBlocks += len(byAddr)
+
+	return diff, nil
+}
+
+// DiffUF2Files reads and compares two UF2 files.
+func DiffUF2Files(pathA, pathB string) (UF2Diff, error) {
+	a, err := os.ReadFile(pathA)
+	if err != nil {
+		return UF2Diff{}, err
+	}
+	b, err := os.ReadFile(pathB)
+	if err != nil {
+		return UF2Diff{}, err
+	}
+
+	diff, err := DiffUF2(a, b)
+	if err != nil {
+		return UF2Diff{}, fmt.Errorf("compare %s and %s: %w", pathA, pathB, err)
+	}
+	return diff, nil
+}
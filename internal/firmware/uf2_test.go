@@ -0,0 +1,76 @@
+package firmware
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// makeUF2 builds a UF2 image with one block per payload, at consecutive
+// 256-byte target addresses.
+func makeUF2(payloads ...[]byte) []byte {
+	var data []byte
+	for i, p := range payloads {
+		b := make([]byte, uf2BlockSize)
+		le := binary.LittleEndian
+		le.PutUint32(b[0:], uf2MagicStart0)
+		le.PutUint32(b[4:], uf2MagicStart1)
+		le.PutUint32(b[12:], 0x1000+uint32(i)*256)
+		le.PutUint32(b[16:], uint32(len(p)))
+		le.PutUint32(b[20:], uint32(i))
+		le.PutUint32(b[24:], uint32(len(payloads)))
+		copy(b[32:], p)
+		le.PutUint32(b[508:], uf2MagicEnd)
+		data = append(data, b...)
+	}
+	return data
+}
+
+func TestParseUF2(t *testing.T) {
+	blocks, err := ParseUF2(makeUF2([]byte("abc"), []byte("de")))
+	if err != nil {
+		t.Fatalf("ParseUF2 failed: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[1].TargetAddr != 0x1100 || string(blocks[1].Data) != "de" || blocks[1].NumBlocks != 2 {
+		t.Errorf("unexpected second block: %+v", blocks[1])
+	}
+}
+
+func TestParseUF2_Invalid(t *testing.T) {
+	if _, err := ParseUF2([]byte("not firmware")); !errors.Is(err, ErrNotUF2) {
+		t.Errorf("short input error = %v, want ErrNotUF2", err)
+	}
+	if _, err := ParseUF2(make([]byte, uf2BlockSize)); !errors.Is(err, ErrNotUF2) {
+		t.Errorf("bad magic error = %v, want ErrNotUF2", err)
+	}
+}
+
+func TestDiffUF2(t *testing.T) {
+	a := makeUF2([]byte("one"), []byte("two"), []byte("three"))
+
+	diff, err := DiffUF2(a, a)
+	if err != nil {
+		t.Fatalf("DiffUF2 failed: %v", err)
+	}
+	if !diff.Identical() {
+		t.Errorf("expected identical images, %d blocks differ", diff.DifferentBlocks)
+	}
+
+	b := makeUF2([]byte("one"), []byte("TWO"), []byte("three"), []byte("four"))
+	diff, err = DiffUF2(a, b)
+	if err != nil {
+		t.Fatalf("DiffUF2 failed: %v", err)
+	}
+	if diff.DifferentBlocks != 2 {
+		t.Errorf("DifferentBlocks = %d, want 2", diff.DifferentBlocks)
+	}
+	if diff.BlocksA != 3 || diff.BlocksB != 4 {
+		t.Errorf("blocks = %d/%d, want 3/4", diff.BlocksA, diff.BlocksB)
+	}
+	if diff.SizeDelta() != 4 {
+		t.Errorf("SizeDelta = %d, want 4", diff.SizeDelta())
+	}
+}
@@ -0,0 +1,25 @@
+//go:build darwin
+
+package firmware
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// unmountTimeout bounds diskutil, which can hang when the volume vanishes mid-unmount.
+const unmountTimeout = 5 * time.Second
+
+// unmountVolume unmounts the bootloader volume after the copy so its reboot
+// doesn't raise "Disk Not Ejected Properly". The device often reboots first,
+// so a missing volume or a failed unmount is ignored.
+func unmountVolume(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unmountTimeout)
+	defer cancel()
+	_ = exec.CommandContext(ctx, "diskutil", "unmount", path).Run()
+}
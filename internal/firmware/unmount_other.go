@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package firmware
+
+// unmountVolume is only needed on macOS; elsewhere the bootloader reboot is silent.
+func unmountVolume(path string) {}
@@ -0,0 +1,120 @@
+package firmware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// westProjectRegex matches west's per-project header, e.g. "=== updating zephyr (zephyr):".
+var westProjectRegex = regexp.MustCompile(`^=== updating (\S+)`)
+
+// WestUpdater refreshes the ZMK/Zephyr modules of a west workspace.
+type WestUpdater struct {
+	mode       string // "native" or "docker"
+	image      string
+	workingDir string
+	user       string // docker --user, empty for the image default
+	commandLog func(args []string)
+}
+
+// NewWestUpdater creates an updater that runs `west update` natively or in Docker.
+func NewWestUpdater(mode, image, workingDir string) *WestUpdater {
+	return &WestUpdater{
+		mode:       mode,
+		image:      image,
+		workingDir: workingDir,
+	}
+}
+
+// SetUser sets the user the docker container runs as.
+func (u *WestUpdater) SetUser(user string) {
+	u.user = user
+}
+
+// SetCommandLog sets a function called with the command line before it
+// runs. In Docker mode it is the equivalent docker run command.
+func (u *WestUpdater) SetCommandLog(fn func(args []string)) {
+	u.commandLog = fn
+}
+
+// Update runs `west update` in the working directory.
+// Progress reports the number of projects updated so far in Current;
+// Percent is -1 because west does not announce a total up front.
+func (u *WestUpdater) Update(ctx context.Context, progressFn func(BuildProgress)) BuildResult {
+	if progressFn == nil {
+		progressFn = func(BuildProgress) {}
+	}
+	startTime := time.Now()
+
+	var scanner *bufio.Scanner
+	var wait func() error
+	if u.mode == "docker" {
+		workDir, err := filepath.Abs(u.workingDir)
+		if err != nil {
+			return BuildResult{Success: false, Error: fmt.Errorf("invalid working directory: %w", err)}
+		}
+		run := dockerRun{
+			image:   u.image,
+			cmd:     []string{"west", "update"},
+			workDir: workDir,
+			opts:    DockerRunOptions{User: u.user},
+		}
+		if u.commandLog != nil {
+			u.commandLog(run.args())
+		}
+		cli, err := dockerClient()
+		if err != nil {
+			return BuildResult{Success: false, Error: err}
+		}
+		defer cli.Close()
+		scanner, wait = outputLines(func(w io.Writer) error {
+			return runContainer(ctx, cli, run, w, w)
+		})
+	} else {
+		cmd := exec.CommandContext(ctx, "west", "update")
+		if u.workingDir != "" {
+			cmd.Dir = u.workingDir
+		}
+		if u.commandLog != nil {
+			u.commandLog(cmd.Args)
+		}
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return BuildResult{Success: false, Error: err}
+		}
+		cmd.Stderr = cmd.Stdout
+		if err := cmd.Start(); err != nil {
+			return BuildResult{Success: false, Error: fmt.Errorf("failed to start west: %w", err)}
+		}
+		scanner, wait = bufio.NewScanner(stdout), cmd.Wait
+	}
+
+	var updated int
+	for scanner.Scan() {
+		line := scanner.Text()
+		if matches := westProjectRegex.FindStringSubmatch(line); len(matches) == 2 {
+			updated++
+			progressFn(BuildProgress{
+				Current: updated,
+				Percent: -1,
+				Output:  line,
+				Message: "Updating " + matches[1],
+			})
+		} else {
+			progressFn(BuildProgress{Current: updated, Percent: -1, Output: line})
+		}
+	}
+
+	if err := wait(); err != nil {
+		return BuildResult{Success: false, Error: fmt.Errorf("west update failed: %w", err), Duration: time.Since(startTime)}
+	}
+
+	return BuildResult{Success: true, Duration: time.Since(startTime)}
+}
@@ -0,0 +1,102 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/dhavalsavalia/kbflash/internal/dockertest"
+)
+
+func TestWestUpdater_Update_Native(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+
+	// Fake west CLI that mimics a two-project update
+	script := `#!/bin/bash
+echo "args: $@"
+echo "=== updating zmk (zmk):"
+echo "--- zmk: fetching, need revision main"
+echo "=== updating zephyr (zephyr):"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "west"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	updater := NewWestUpdater("native", "", "")
+	var command []string
+	updater.SetCommandLog(func(args []string) { command = args })
+
+	var messages []string
+	var last BuildProgress
+	result := updater.Update(context.Background(), func(p BuildProgress) {
+		if p.Message != "" {
+			messages = append(messages, p.Message)
+		}
+		last = p
+	})
+
+	if !result.Success {
+		t.Fatalf("Update failed: %v", result.Error)
+	}
+
+	if len(messages) != 2 || messages[0] != "Updating zmk" || messages[1] != "Updating zephyr" {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+	if last.Current != 2 {
+		t.Errorf("projects updated = %d, want 2", last.Current)
+	}
+	if last.Percent != -1 {
+		t.Errorf("percent = %d, want -1", last.Percent)
+	}
+	if len(command) != 2 || command[1] != "update" {
+		t.Errorf("logged command = %v, want west update", command)
+	}
+}
+
+func TestWestUpdater_Update_Docker(t *testing.T) {
+	engine := dockertest.Start(t)
+	engine.Run = func(p *dockertest.Process) int {
+		fmt.Fprintln(p.Stdout, "=== updating zmk (zmk):")
+		return 0
+	}
+
+	// On a new machine west update is the first command; the image is
+	// pulled for it
+	result := NewWestUpdater("docker", "zmk-image", t.TempDir()).Update(context.Background(), func(BuildProgress) {})
+	if !result.Success {
+		t.Fatalf("Update failed: %v", result.Error)
+	}
+	if !slices.Contains(engine.Calls(), "POST /images/create") {
+		t.Errorf("calls = %q, want the missing image pulled", engine.Calls())
+	}
+}
+
+func TestWestUpdater_Update_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+
+	tmpDir := t.TempDir()
+	script := `#!/bin/bash
+echo "FATAL ERROR: no west workspace found"
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "west"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := NewWestUpdater("native", "", "").Update(context.Background(), nil)
+	if result.Success {
+		t.Error("expected Update to fail")
+	}
+}
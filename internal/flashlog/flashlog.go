@@ -0,0 +1,182 @@
+// Package flashlog remembers the firmware last flashed to each side of a
+// keyboard, so flashing the same image again can be caught beforehand, and
+// keeps a copy of the firmware marked known good to go back to.
+package flashlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/statefile"
+)
+
+// Entry is the last firmware flashed to one side.
+type Entry struct {
+	SHA256 string    `json:"sha256"`
+	File   string    `json:"file"` // path the firmware was flashed from
+	Time   time.Time `json:"time"`
+	// Backup is the keymap backup taken before the flash, if any
+	Backup string `json:"backup,omitempty"`
+}
+
+// Log holds the last flash of every side, persisted as JSON.
+type Log struct {
+	path   string
+	backup string           // referenced by the entries Record adds
+	Sides  map[string]Entry `json:"sides"`
+	// Good is the firmware marked known good on each side; File is its
+	// archived copy
+	Good map[string]Entry `json:"good,omitempty"`
+}
+
+// ErrChanged is returned by MarkGood when the file last flashed to a side
+// is gone or no longer what was flashed, as when its build was replaced.
+var ErrChanged = errors.New("firmware changed since it was flashed")
+
+// DefaultPath returns the log file path, flashes.json in the kbflash state
+// directory.
+func DefaultPath() (string, error) {
+	return statefile.Path("flashes.json")
+}
+
+// Key identifies a side of a keyboard.
+func Key(keyboard, side string) string {
+	return keyboard + "/" + side
+}
+
+// New returns an in-memory log that is never saved.
+func New() *Log {
+	return &Log{Sides: make(map[string]Entry), Good: make(map[string]Entry)}
+}
+
+// Load reads the log at path. A missing file is an empty log.
+func Load(path string) (*Log, error) {
+	l := &Log{path: path, Sides: make(map[string]Entry), Good: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return l, fmt.Errorf("cannot parse flash history %s: %w", path, err)
+	}
+	if l.Sides == nil {
+		l.Sides = make(map[string]Entry)
+	}
+	if l.Good == nil {
+		l.Good = make(map[string]Entry)
+	}
+	return l, nil
+}
+
+// Record notes that the file at path was flashed to key.
+func (l *Log) Record(key, path string, at time.Time) error {
+	sum, err := firmware.FileSHA256(path)
+	if err != nil {
+		return err
+	}
+	l.Sides[key] = Entry{SHA256: sum, File: path, Time: at, Backup: l.backup}
+	return nil
+}
+
+// SetBackup makes the flashes recorded from now on reference the keymap
+// backup in dir, as the restore point for them.
+func (l *Log) SetBackup(dir string) {
+	l.backup = dir
+}
+
+// Flashed reports whether the file at path is the firmware last flashed to
+// key, byte for byte. Unreadable files are never reported as flashed.
+func (l *Log) Flashed(key, path string) (Entry, bool) {
+	e, ok := l.Sides[key]
+	if !ok {
+		return Entry{}, false
+	}
+	sum, err := firmware.FileSHA256(path)
+	if err != nil || sum != e.SHA256 {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// MarkGood marks the firmware last flashed to key as known good. The file
+// is copied next to the log, under known-good, so the mark survives its
+// build being cleaned up; in-memory logs keep pointing at the file itself.
+// Returns ErrChanged if the file is no longer what was flashed.
+func (l *Log) MarkGood(key string) (Entry, error) {
+	e, ok := l.Sides[key]
+	if !ok {
+		return Entry{}, fmt.Errorf("nothing flashed to %s", key)
+	}
+	if sum, err := firmware.FileSHA256(e.File); err != nil || sum != e.SHA256 {
+		return Entry{}, fmt.Errorf("%s: %w", e.File, ErrChanged)
+	}
+	good := e
+	if l.path != "" {
+		good.File = filepath.Join(filepath.Dir(l.path), "known-good", filepath.FromSlash(key), filepath.Base(e.File))
+		if err := copyFile(e.File, good.File); err != nil {
+			return Entry{}, err
+		}
+		if old, ok := l.Good[key]; ok && old.File != good.File {
+			os.Remove(old.File)
+		}
+	}
+	l.Good[key] = good
+	return good, nil
+}
+
+// KnownGood returns the firmware marked known good on key, reporting false
+// if there is none or its archived copy no longer matches.
+func (l *Log) KnownGood(key string) (Entry, bool) {
+	e, ok := l.Good[key]
+	if !ok {
+		return Entry{}, false
+	}
+	sum, err := firmware.FileSHA256(e.File)
+	if err != nil || sum != e.SHA256 {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// Save writes the log back to its file, replacing it atomically.
+// In-memory logs are not saved.
+func (l *Log) Save() error {
+	return statefile.SaveJSON(l.path, l)
+}
+
+// copyFile copies src to dst through a temporary file, creating dst's
+// directory
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,166 @@
+package flashlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordAndFlashed(t *testing.T) {
+	dir := t.TempDir()
+	firmware := filepath.Join(dir, "corne_left.uf2")
+	if err := os.WriteFile(firmware, []byte("firmware v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "state", "flashes.json")
+	l, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of missing file failed: %v", err)
+	}
+	key := Key("corne", "left")
+	if _, ok := l.Flashed(key, firmware); ok {
+		t.Fatal("expected nothing flashed before any record")
+	}
+
+	if err := l.Record(key, firmware, time.Now()); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := l.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if e, ok := loaded.Flashed(key, firmware); !ok || e.File != firmware || e.Backup != "" {
+		t.Errorf("Flashed = %+v, %v; want the recorded file without a backup", e, ok)
+	}
+
+	loaded.SetBackup(filepath.Join(dir, "backups", "20250102-150405"))
+	if err := loaded.Record(key, firmware, time.Now()); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if e, _ := loaded.Flashed(key, firmware); e.Backup != filepath.Join(dir, "backups", "20250102-150405") {
+		t.Errorf("Backup = %q, want the keymap backup set before the flash", e.Backup)
+	}
+
+	// A copy elsewhere is the same firmware
+	other := filepath.Join(dir, "copy.uf2")
+	if err := os.WriteFile(other, []byte("firmware v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Flashed(key, other); !ok {
+		t.Error("expected an identical copy to count as flashed")
+	}
+
+	if _, ok := loaded.Flashed(Key("corne", "right"), firmware); ok {
+		t.Error("expected the other side to have nothing flashed")
+	}
+
+	if err := os.WriteFile(firmware, []byte("firmware v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Flashed(key, firmware); ok {
+		t.Error("expected a rebuilt file not to count as flashed")
+	}
+}
+
+func TestLog_MarkGood(t *testing.T) {
+	dir := t.TempDir()
+	firmware := filepath.Join(dir, "build", "corne_left.uf2")
+	if err := os.MkdirAll(filepath.Dir(firmware), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(firmware, []byte("firmware v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "state", "flashes.json")
+	l, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key("corne", "left")
+	if _, err := l.MarkGood(key); err == nil {
+		t.Error("expected an error marking a side with nothing flashed")
+	}
+	if err := l.Record(key, firmware, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	good, err := l.MarkGood(key)
+	if err != nil {
+		t.Fatalf("MarkGood failed: %v", err)
+	}
+	if good.File == firmware {
+		t.Error("expected the firmware to be archived, not referenced")
+	}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archived copy outlives the build
+	if err := os.RemoveAll(filepath.Dir(firmware)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := loaded.KnownGood(key)
+	if !ok {
+		t.Fatal("expected the known good firmware after reload")
+	}
+	if data, err := os.ReadFile(e.File); err != nil || string(data) != "firmware v1" {
+		t.Errorf("archived firmware = %q (%v), want the flashed file", data, err)
+	}
+	if _, ok := loaded.KnownGood(Key("corne", "right")); ok {
+		t.Error("expected the other side to have no known good firmware")
+	}
+
+	// A build replaced since the flash cannot be vouched for
+	if err := os.MkdirAll(filepath.Dir(firmware), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(firmware, []byte("firmware v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.MarkGood(key); !errors.Is(err, ErrChanged) {
+		t.Errorf("MarkGood of a replaced file = %v, want ErrChanged", err)
+	}
+
+	// A damaged archive is not offered
+	if err := os.WriteFile(e.File, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.KnownGood(key); ok {
+		t.Error("expected a damaged archive not to count as known good")
+	}
+}
+
+func TestLog_RecordMissingFile(t *testing.T) {
+	l := New()
+	if err := l.Record("corne/left", filepath.Join(t.TempDir(), "gone.uf2"), time.Now()); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if len(l.Sides) != 0 {
+		t.Errorf("recorded %d sides, want none", len(l.Sides))
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flashes.json")
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Load(path)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if l == nil || l.Sides == nil {
+		t.Error("expected a usable empty log alongside the error")
+	}
+}
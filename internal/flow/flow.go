@@ -0,0 +1,330 @@
+// Package flow sequences flashing a keyboard's sides: wait for the
+// bootloader of each side to connect, flash its files, then move on to the
+// next side. The TUI and headless mode both drive a Flow, feeding it device
+// events and flash results and acting on the events it emits, so they agree
+// on when a side may be flashed.
+package flow
+
+import (
+	"errors"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// State is where a Flow is in its sequence.
+type State int
+
+const (
+	StateIdle              State = iota
+	StateWaitingDisconnect       // Safety: a bootloader is mounted that must be unplugged first
+	StateWaitingDevice
+	StateFlashing
+	StateComplete
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateWaitingDisconnect:
+		return "waiting for disconnect"
+	case StateWaitingDevice:
+		return "waiting for device"
+	case StateFlashing:
+		return "flashing"
+	case StateComplete:
+		return "complete"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Step is one side of a sequence.
+type Step struct {
+	Side string
+	// Files are flashed in order, one per connection, as the bootloader
+	// reboots after each. A step without files is flashed once, by a tool
+	// that builds its own firmware (qmk).
+	Files []string
+}
+
+// EventKind says what an Event reports.
+type EventKind int
+
+const (
+	EventSideStarted    EventKind = iota // Side is next
+	EventWaitDisconnect                  // unplug the mounted bootloader before flashing Side
+	EventWaitDevice                      // connect Side's bootloader
+	EventFlash                           // flash Path to Device now, then call Done
+	EventFileFlashed                     // Path flashed; more of Side's files follow
+	EventSideFlashed                     // Side's last file flashed
+	EventRebooted                        // the bootloader unmounted after flashing Path
+	EventRebootTimeout                   // it is still mounted after device.RebootTimeout
+	EventComplete                        // every side flashed
+	EventFailed                          // the sequence stopped with Err
+)
+
+// Event is emitted by a Flow as its sequence advances.
+type Event struct {
+	Kind   EventKind
+	Side   string
+	Path   string // firmware file, "" for a step without files
+	File   int    // index of Path in the side's files
+	Files  int    // number of the side's files
+	Device string // mount point of the bootloader, for EventFlash
+	Err    error  // for EventFailed
+	Retry  bool   // EventFailed: Retry flashes the file again
+}
+
+// Options configures a Flow.
+type Options struct {
+	// SelfWaiting flashes without watching for the bootloader, for tools
+	// that wait for it themselves (dfu-util, qmk).
+	SelfWaiting bool
+
+	// Ready flashes a bootloader that is already connected when the
+	// sequence starts as the first side, instead of requiring it to be
+	// unplugged first.
+	Ready bool
+
+	// Boards maps sides to their board. A connected bootloader whose
+	// INFO_UF2.TXT names another side's board is refused.
+	Boards map[string]string
+}
+
+// Flow is a flash sequence. It is not safe for concurrent use.
+type Flow struct {
+	steps []Step
+	opts  Options
+	emit  func(Event)
+
+	state     State
+	step      int
+	file      int
+	connected bool
+	device    string
+	rebooting *Event // the flash whose bootloader should unmount
+}
+
+// New creates a sequence flashing steps in order. emit is called with
+// each event as the sequence advances.
+func New(steps []Step, opts Options, emit func(Event)) *Flow {
+	if emit == nil {
+		emit = func(Event) {}
+	}
+	return &Flow{steps: steps, opts: opts, emit: emit}
+}
+
+// State returns where the sequence is.
+func (f *Flow) State() State {
+	return f.state
+}
+
+// Step returns the index of the step being flashed.
+func (f *Flow) Step() int {
+	return f.step
+}
+
+// Side returns the side being flashed, or "" once the sequence is complete.
+func (f *Flow) Side() string {
+	if f.step >= len(f.steps) {
+		return ""
+	}
+	return f.steps[f.step].Side
+}
+
+// Path returns the file being flashed, or "" if there is none.
+func (f *Flow) Path() string {
+	if f.step >= len(f.steps) || f.file >= len(f.steps[f.step].Files) {
+		return ""
+	}
+	return f.steps[f.step].Files[f.file]
+}
+
+// Active reports whether the sequence is waiting for a device or flashing.
+func (f *Flow) Active() bool {
+	switch f.state {
+	case StateWaitingDisconnect, StateWaitingDevice, StateFlashing:
+		return true
+	}
+	return false
+}
+
+// Rebooting reports whether the bootloader of the last flash has yet to
+// unmount, which confirms the device rebooted.
+func (f *Flow) Rebooting() bool {
+	return f.rebooting != nil
+}
+
+// Start begins the sequence with its first step. Connected should be
+// called first if a bootloader is mounted already.
+func (f *Flow) Start() {
+	f.step, f.file = 0, 0
+	f.rebooting = nil
+	if len(f.steps) == 0 {
+		f.complete()
+		return
+	}
+	f.startSide()
+	if f.opts.Ready && f.connected && !f.opts.SelfWaiting {
+		f.flash()
+		return
+	}
+	f.await()
+}
+
+// Connected reports that the bootloader mounted at path, flashing it if
+// the sequence is waiting for it.
+func (f *Flow) Connected(path string) {
+	f.connected = true
+	f.device = path
+	if f.state == StateWaitingDevice {
+		f.flash()
+	}
+}
+
+// Disconnected reports that the bootloader unmounted.
+func (f *Flow) Disconnected() {
+	f.connected = false
+	f.device = ""
+	if f.rebooting != nil {
+		e := *f.rebooting
+		e.Kind = EventRebooted
+		f.rebooting = nil
+		f.emit(e)
+	}
+	if f.state == StateWaitingDisconnect {
+		f.state = StateWaitingDevice
+		f.emit(f.event(EventWaitDevice))
+	}
+}
+
+// RebootTimeout reports that the bootloader of the last flash stayed
+// mounted for device.RebootTimeout, which usually means it didn't take.
+func (f *Flow) RebootTimeout() {
+	if f.rebooting == nil {
+		return
+	}
+	e := *f.rebooting
+	e.Kind = EventRebootTimeout
+	f.rebooting = nil
+	f.emit(e)
+}
+
+// Done reports the result of the flash asked for by EventFlash: nil when
+// it succeeded. The sequence moves on to the next file or side.
+func (f *Flow) Done(err error) {
+	if f.state != StateFlashing {
+		return // cancelled
+	}
+	if err != nil {
+		f.state = StateFailed
+		e := f.event(EventFailed)
+		e.Err = err
+		e.Retry = errors.Is(err, firmware.ErrDeviceRemoved)
+		f.emit(e)
+		return
+	}
+
+	flashed := f.event(EventFileFlashed)
+	if f.file+1 >= max(flashed.Files, 1) {
+		flashed.Kind = EventSideFlashed
+	}
+	f.emit(flashed)
+	if !f.opts.SelfWaiting {
+		// An unmounting volume confirms the device rebooted
+		f.rebooting = &flashed
+		if !f.connected {
+			f.Disconnected()
+		}
+	}
+
+	if flashed.Kind == EventFileFlashed {
+		f.file++
+		f.await()
+		return
+	}
+	f.step++
+	f.file = 0
+	if f.step >= len(f.steps) {
+		f.complete()
+		return
+	}
+	f.startSide()
+	f.await()
+}
+
+// Retry waits for the bootloader again to flash the file that failed,
+// after an EventFailed with Retry set.
+func (f *Flow) Retry() {
+	if f.state != StateFailed {
+		return
+	}
+	f.await()
+}
+
+// Cancel stops the sequence.
+func (f *Flow) Cancel() {
+	f.state = StateIdle
+}
+
+// startSide announces the current step
+func (f *Flow) startSide() {
+	f.emit(f.event(EventSideStarted))
+}
+
+// await waits for the current step's bootloader. Safety: a bootloader
+// still mounted could be the side just flashed, so it must be unplugged
+// before the next one is flashed.
+func (f *Flow) await() {
+	switch {
+	case f.opts.SelfWaiting:
+		f.state = StateFlashing
+		f.emit(f.event(EventFlash))
+	case f.connected:
+		f.state = StateWaitingDisconnect
+		f.emit(f.event(EventWaitDisconnect))
+	default:
+		f.state = StateWaitingDevice
+		f.emit(f.event(EventWaitDevice))
+	}
+}
+
+// flash asks for the current file to be flashed to the connected
+// bootloader, unless it belongs to another side's board
+func (f *Flow) flash() {
+	side := f.steps[f.step].Side
+	if info, err := firmware.ReadBootloaderInfo(f.device); err == nil {
+		if err := firmware.CheckSideBoard(info, side, f.opts.Boards); err != nil {
+			f.state = StateFailed
+			e := f.event(EventFailed)
+			e.Err = err
+			f.emit(e)
+			return
+		}
+	}
+	f.state = StateFlashing
+	e := f.event(EventFlash)
+	e.Device = f.device
+	f.emit(e)
+}
+
+// complete ends the sequence
+func (f *Flow) complete() {
+	f.state = StateComplete
+	f.emit(Event{Kind: EventComplete})
+}
+
+// event describes the current file
+func (f *Flow) event(kind EventKind) Event {
+	step := f.steps[f.step]
+	return Event{
+		Kind:  kind,
+		Side:  step.Side,
+		Path:  f.Path(),
+		File:  f.file,
+		Files: len(step.Files),
+	}
+}
@@ -0,0 +1,242 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// recorder collects a Flow's events as short strings
+type recorder struct {
+	events []string
+	last   Event
+}
+
+func (r *recorder) emit(e Event) {
+	r.last = e
+	names := map[EventKind]string{
+		EventSideStarted:    "start",
+		EventWaitDisconnect: "unplug",
+		EventWaitDevice:     "wait",
+		EventFlash:          "flash",
+		EventFileFlashed:    "file",
+		EventSideFlashed:    "side",
+		EventRebooted:       "rebooted",
+		EventRebootTimeout:  "timeout",
+		EventComplete:       "complete",
+		EventFailed:         "failed",
+	}
+	s := names[e.Kind]
+	if e.Side != "" {
+		s += " " + e.Side
+	}
+	if e.Path != "" {
+		s += " " + e.Path
+	}
+	r.events = append(r.events, s)
+}
+
+// take returns the events since the last call
+func (r *recorder) take() []string {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func expectEvents(t *testing.T, r *recorder, want ...string) {
+	t.Helper()
+	if got := r.take(); !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func split() []Step {
+	return []Step{
+		{Side: "left", Files: []string{"left.uf2"}},
+		{Side: "right", Files: []string{"right.uf2"}},
+	}
+}
+
+func TestFlow_Split(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+
+	f.Start()
+	expectEvents(t, r, "start left left.uf2", "wait left left.uf2")
+	if f.State() != StateWaitingDevice {
+		t.Fatalf("State = %v, want waiting for device", f.State())
+	}
+
+	f.Connected("/media/NICENANO")
+	expectEvents(t, r, "flash left left.uf2")
+	if r.last.Device != "/media/NICENANO" {
+		t.Errorf("Device = %q, want /media/NICENANO", r.last.Device)
+	}
+
+	f.Done(nil)
+	expectEvents(t, r, "side left left.uf2", "start right right.uf2", "unplug right right.uf2")
+	if !f.Rebooting() {
+		t.Error("Rebooting = false after a copy with the volume still mounted")
+	}
+
+	// A second connect before the unplug must not flash the left half again
+	f.Connected("/media/NICENANO")
+	expectEvents(t, r)
+
+	f.Disconnected()
+	expectEvents(t, r, "rebooted left left.uf2", "wait right right.uf2")
+
+	f.Connected("/media/NICENANO")
+	f.Done(nil)
+	f.Disconnected()
+	expectEvents(t, r, "flash right right.uf2", "side right right.uf2", "complete", "rebooted right right.uf2")
+	if f.State() != StateComplete || f.Rebooting() {
+		t.Errorf("State = %v, Rebooting = %v; want complete, false", f.State(), f.Rebooting())
+	}
+}
+
+func TestFlow_ConnectedAtStart(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+	f.Connected("/media/NICENANO")
+	f.Start()
+	expectEvents(t, r, "start left left.uf2", "unplug left left.uf2")
+
+	r = &recorder{}
+	f = New(split(), Options{Ready: true}, r.emit)
+	f.Connected("/media/NICENANO")
+	f.Start()
+	expectEvents(t, r, "start left left.uf2", "flash left left.uf2")
+}
+
+func TestFlow_RebootedBeforeDone(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+	f.Start()
+	f.Connected("/media/NICENANO")
+	r.take()
+
+	// The volume can unmount before the copy reports back
+	f.Disconnected()
+	expectEvents(t, r)
+	f.Done(nil)
+	expectEvents(t, r, "side left left.uf2", "rebooted left left.uf2", "start right right.uf2", "wait right right.uf2")
+}
+
+func TestFlow_RebootTimeout(t *testing.T) {
+	r := &recorder{}
+	f := New(split()[:1], Options{}, r.emit)
+	f.Start()
+	f.Connected("/media/NICENANO")
+	f.Done(nil)
+	r.take()
+
+	f.RebootTimeout()
+	expectEvents(t, r, "timeout left left.uf2")
+	f.RebootTimeout()
+	f.Disconnected()
+	expectEvents(t, r)
+}
+
+func TestFlow_ExtraFiles(t *testing.T) {
+	r := &recorder{}
+	steps := []Step{{Side: "left", Files: []string{"reset.uf2", "left.uf2"}}}
+	f := New(steps, Options{}, r.emit)
+	f.Start()
+	f.Connected("/media/NICENANO")
+	f.Done(nil)
+	expectEvents(t, r, "start left reset.uf2", "wait left reset.uf2", "flash left reset.uf2", "file left reset.uf2", "unplug left left.uf2")
+
+	f.Disconnected()
+	f.Connected("/media/NICENANO")
+	expectEvents(t, r, "rebooted left reset.uf2", "wait left left.uf2", "flash left left.uf2")
+	if r.last.File != 1 || r.last.Files != 2 {
+		t.Errorf("File = %d of %d, want 1 of 2", r.last.File, r.last.Files)
+	}
+}
+
+func TestFlow_SelfWaiting(t *testing.T) {
+	r := &recorder{}
+	steps := []Step{{Side: "left"}, {Side: "right"}}
+	f := New(steps, Options{SelfWaiting: true}, r.emit)
+	f.Start()
+	f.Done(nil)
+	f.Done(nil)
+	expectEvents(t, r, "start left", "flash left", "side left", "start right", "flash right", "side right", "complete")
+	if f.Rebooting() {
+		t.Error("Rebooting = true without a volume to watch")
+	}
+}
+
+func TestFlow_DeviceRemoved(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+	f.Start()
+	f.Connected("/media/NICENANO")
+	f.Disconnected()
+	r.take()
+
+	f.Done(fmt.Errorf("write: %w", firmware.ErrDeviceRemoved))
+	if f.State() != StateFailed || !r.last.Retry {
+		t.Fatalf("State = %v, Retry = %v; want failed, retryable", f.State(), r.last.Retry)
+	}
+	expectEvents(t, r, "failed left left.uf2")
+
+	f.Retry()
+	f.Connected("/media/NICENANO")
+	expectEvents(t, r, "wait left left.uf2", "flash left left.uf2")
+}
+
+func TestFlow_Failed(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+	f.Start()
+	f.Connected("/media/NICENANO")
+	f.Done(errors.New("disk full"))
+	if f.State() != StateFailed || r.last.Retry || r.last.Err == nil {
+		t.Errorf("State = %v, last = %+v; want failed, not retryable", f.State(), r.last)
+	}
+}
+
+func TestFlow_Cancel(t *testing.T) {
+	r := &recorder{}
+	f := New(split(), Options{}, r.emit)
+	f.Start()
+	f.Cancel()
+	f.Connected("/media/NICENANO")
+	f.Done(nil)
+	expectEvents(t, r, "start left left.uf2", "wait left left.uf2")
+	if f.Active() {
+		t.Error("Active = true after Cancel")
+	}
+}
+
+func TestFlow_WrongBoard(t *testing.T) {
+	mount := t.TempDir()
+	info := "UF2 Bootloader 0.6.0\r\nModel: nice!nano\r\nBoard-ID: nRF52840-nicenano\r\n"
+	if err := os.WriteFile(filepath.Join(mount, firmware.InfoFileName), []byte(info), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{}
+	steps := []Step{{Side: "dongle", Files: []string{"dongle.uf2"}}}
+	boards := map[string]string{"left": "nice_nano_v2", "dongle": "xiao_ble"}
+	f := New(steps, Options{Boards: boards}, r.emit)
+	f.Start()
+	f.Connected(mount)
+	if f.State() != StateFailed || r.last.Kind != EventFailed {
+		t.Errorf("State = %v, last = %+v; want the left controller refused", f.State(), r.last)
+	}
+}
+
+func TestFlow_NoSteps(t *testing.T) {
+	r := &recorder{}
+	f := New(nil, Options{}, r.emit)
+	f.Start()
+	expectEvents(t, r, "complete")
+}
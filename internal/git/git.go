@@ -0,0 +1,129 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Status describes the state of a git working tree.
+type Status struct {
+	Branch  string // empty when HEAD is detached
+	Commit  string // short commit hash, empty before the first commit
+	Dirty   bool
+	Changes int // number of changed or untracked paths
+}
+
+// String formats the status as branch@commit with a trailing * when dirty.
+func (s Status) String() string {
+	ref := s.Branch
+	if ref == "" {
+		ref = "detached"
+	}
+	if s.Commit != "" {
+		ref += "@" + s.Commit
+	}
+	if s.Dirty {
+		ref += "*"
+	}
+	return ref
+}
+
+// ErrNotRepository is returned when the directory is not inside a git repository.
+var ErrNotRepository = errors.New("not a git repository")
+
+// GetStatus reads the branch, short commit and dirty state of dir.
+func GetStatus(ctx context.Context, dir string) (Status, error) {
+	if _, err := run(ctx, dir, "rev-parse", "--git-dir"); err != nil {
+		return Status{}, ErrNotRepository
+	}
+
+	var st Status
+	if out, err := run(ctx, dir, "symbolic-ref", "--short", "-q", "HEAD"); err == nil {
+		st.Branch = out
+	}
+	if out, err := run(ctx, dir, "rev-parse", "--short", "HEAD"); err == nil {
+		st.Commit = out
+	}
+
+	out, err := run(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return Status{}, err
+	}
+	if out != "" {
+		st.Dirty = true
+		st.Changes = len(strings.Split(out, "\n"))
+	}
+
+	return st, nil
+}
+
+// CommitAll stages every change in dir and commits it with message.
+func CommitAll(ctx context.Context, dir, message string) error {
+	if _, err := run(ctx, dir, "add", "-A"); err != nil {
+		return err
+	}
+	_, err := run(ctx, dir, "commit", "-m", message)
+	return err
+}
+
+// Push pushes the current branch to its upstream.
+func Push(ctx context.Context, dir string) error {
+	_, err := run(ctx, dir, "push")
+	return err
+}
+
+// ErrDiverged is returned by Pull when the branch cannot be fast-forwarded.
+var ErrDiverged = errors.New("local branch has diverged from upstream; merge or rebase manually")
+
+// PullTimeout bounds a Pull, so an unreachable remote cannot hang it.
+const PullTimeout = 2 * time.Minute
+
+// Pull fast-forwards the current branch from its upstream.
+// Returns ErrDiverged instead of creating a merge commit.
+func Pull(ctx context.Context, dir string) error {
+	ctx, cancel := context.WithTimeout(ctx, PullTimeout)
+	defer cancel()
+	_, err := run(ctx, dir, "pull", "--ff-only")
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("git pull: no answer from the remote after %s", PullTimeout)
+	}
+	if err != nil && (strings.Contains(err.Error(), "fast-forward") || strings.Contains(err.Error(), "diverg")) {
+		return ErrDiverged
+	}
+	return err
+}
+
+// run executes git in dir and returns trimmed stdout.
+// On failure the error includes git's stderr. git never prompts for
+// credentials or host keys, which would fight a TUI for the terminal; it
+// fails instead.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
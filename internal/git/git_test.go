@@ -0,0 +1,200 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a git repository with one commit in a temp directory.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	ctx := context.Background()
+	if _, err := run(ctx, dir, "init", "-q", "-b", "main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "corne.keymap"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAll(ctx, dir, "initial"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGetStatus_Clean(t *testing.T) {
+	dir := initRepo(t)
+
+	st, err := GetStatus(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+
+	if st.Branch != "main" {
+		t.Errorf("branch = %q, want %q", st.Branch, "main")
+	}
+	if st.Commit == "" {
+		t.Error("expected a short commit hash")
+	}
+	if st.Dirty {
+		t.Error("expected clean tree")
+	}
+}
+
+func TestGetStatus_Dirty(t *testing.T) {
+	dir := initRepo(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "corne.keymap"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.conf"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := GetStatus(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+
+	if !st.Dirty {
+		t.Error("expected dirty tree")
+	}
+	if st.Changes != 2 {
+		t.Errorf("changes = %d, want 2", st.Changes)
+	}
+	if got := st.String(); got != "main@"+st.Commit+"*" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestGetStatus_NotRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	_, err := GetStatus(context.Background(), t.TempDir())
+	if err != ErrNotRepository {
+		t.Errorf("expected ErrNotRepository, got: %v", err)
+	}
+}
+
+func TestCommitAll(t *testing.T) {
+	dir := initRepo(t)
+	ctx := context.Background()
+
+	before, _ := GetStatus(ctx, dir)
+	if err := os.WriteFile(filepath.Join(dir, "corne.keymap"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CommitAll(ctx, dir, "Update keymap"); err != nil {
+		t.Fatalf("CommitAll failed: %v", err)
+	}
+
+	after, err := GetStatus(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Dirty {
+		t.Error("expected clean tree after commit")
+	}
+	if after.Commit == before.Commit {
+		t.Error("expected a new commit")
+	}
+}
+
+func TestPush_NoUpstream(t *testing.T) {
+	dir := initRepo(t)
+
+	if err := Push(context.Background(), dir); err == nil {
+		t.Error("expected error pushing without a remote")
+	}
+}
+
+// cloneRepo clones src into a new temp directory.
+func cloneRepo(t *testing.T, src string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "clone")
+	if _, err := run(context.Background(), "", "clone", "-q", src, dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPull_FastForward(t *testing.T) {
+	upstream := initRepo(t)
+	clone := cloneRepo(t, upstream)
+	ctx := context.Background()
+
+	if err := os.WriteFile(filepath.Join(upstream, "corne.keymap"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAll(ctx, upstream, "upstream change"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Pull(ctx, clone); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(clone, "corne.keymap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v2" {
+		t.Errorf("keymap = %q, want pulled %q", data, "v2")
+	}
+}
+
+func TestPull_Diverged(t *testing.T) {
+	upstream := initRepo(t)
+	clone := cloneRepo(t, upstream)
+	ctx := context.Background()
+
+	if err := os.WriteFile(filepath.Join(upstream, "corne.keymap"), []byte("upstream"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAll(ctx, upstream, "upstream change"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(clone, "corne.keymap"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAll(ctx, clone, "local change"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Pull(ctx, clone); err != ErrDiverged {
+		t.Errorf("expected ErrDiverged, got: %v", err)
+	}
+}
+
+func TestPull_NoPrompt(t *testing.T) {
+	// A fake git reports the environment it would prompt in
+	bin := t.TempDir()
+	script := "#!/bin/bash\necho \"prompt=$GIT_TERMINAL_PROMPT ssh=$GIT_SSH_COMMAND\" >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GIT_SSH_COMMAND", "")
+	t.Setenv("GIT_SSH", "")
+
+	err := Pull(context.Background(), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "prompt=0 ssh=ssh -o BatchMode=yes") {
+		t.Errorf("Pull error = %v, want git run without prompts", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package job reads job files: a sequence of kbflash operations, such as
+// building some targets and then flashing some sides, written down once and
+// run headlessly with kbflash job instead of a shell script around several
+// kbflash invocations.
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Actions a step can run.
+const (
+	ActionWestUpdate = "west-update"
+	ActionClean      = "clean"
+	ActionBuild      = "build"
+	ActionFlash      = "flash"
+)
+
+// Actions lists the step actions, in the order they usually run.
+var Actions = []string{ActionWestUpdate, ActionClean, ActionBuild, ActionFlash}
+
+// Job is a job file.
+type Job struct {
+	Keyboard string `toml:"keyboard"` // profile for steps that name none
+	Steps    []Step `toml:"steps"`
+}
+
+// Step is one operation of a job.
+type Step struct {
+	Name     string `toml:"name"` // shown in progress and the summary
+	Action   string `toml:"action"`
+	Keyboard string `toml:"keyboard"` // profile, overriding the job's
+	// Target is the side to clean, build or flash, or "all" (the default)
+	Target string `toml:"target"`
+	// Pristine cleans the target's build files before a build
+	Pristine bool `toml:"pristine"`
+	// AssumeYes answers yes to the questions of a flash, as -y does
+	AssumeYes bool `toml:"assume_yes"`
+	// ContinueOnError runs the next steps even when this one fails
+	ContinueOnError bool `toml:"continue_on_error"`
+}
+
+// Title names the step for progress and the summary.
+func (s Step) Title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	title := s.Action
+	if s.Action != ActionWestUpdate {
+		title += " " + s.Target
+	}
+	if s.Keyboard != "" {
+		title += " (" + s.Keyboard + ")"
+	}
+	return title
+}
+
+// Load reads and checks the job file at path. Steps get the job's keyboard
+// unless they name their own, and target "all" unless they name one.
+func Load(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := toml.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	var j Job
+	if err := dec.Decode(&j); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, column := decodeErr.Position()
+			return nil, fmt.Errorf("invalid job %s:%d:%d: %s", path, line, column, strings.TrimPrefix(decodeErr.Error(), "toml: "))
+		}
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			var keys []string
+			for _, e := range strictErr.Errors {
+				keys = append(keys, strings.Join(e.Key(), "."))
+			}
+			return nil, fmt.Errorf("invalid job %s: unknown key %s", path, strings.Join(keys, ", "))
+		}
+		return nil, fmt.Errorf("invalid job %s: %w", path, err)
+	}
+
+	if len(j.Steps) == 0 {
+		return nil, fmt.Errorf("invalid job %s: no [[steps]]", path)
+	}
+	var errs []error
+	for i := range j.Steps {
+		s := &j.Steps[i]
+		if s.Keyboard == "" {
+			s.Keyboard = j.Keyboard
+		}
+		if s.Target == "" {
+			s.Target = "all"
+		}
+		if !slices.Contains(Actions, s.Action) {
+			errs = append(errs, fmt.Errorf("steps[%d].action must be one of %s, got %q", i, strings.Join(Actions, ", "), s.Action))
+		}
+		if s.Pristine && s.Action != ActionBuild {
+			errs = append(errs, fmt.Errorf("steps[%d].pristine only applies to build steps", i))
+		}
+		if s.AssumeYes && s.Action != ActionFlash {
+			errs = append(errs, fmt.Errorf("steps[%d].assume_yes only applies to flash steps", i))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid job %s: %w", path, err)
+	}
+	return &j, nil
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeJob(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "job.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeJob(t, `
+keyboard = "corne"
+
+[[steps]]
+action = "west-update"
+
+[[steps]]
+action = "build"
+target = "left"
+pristine = true
+
+[[steps]]
+name = "Flash the travel board"
+action = "flash"
+keyboard = "planck"
+assume_yes = true
+continue_on_error = true
+`)
+	j, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(j.Steps) != 3 {
+		t.Fatalf("steps = %+v, want 3", j.Steps)
+	}
+	build := j.Steps[1]
+	if build.Keyboard != "corne" || build.Target != "left" || !build.Pristine {
+		t.Errorf("build step = %+v, want the job's keyboard", build)
+	}
+	if build.Title() != "build left (corne)" {
+		t.Errorf("build title = %q", build.Title())
+	}
+	flash := j.Steps[2]
+	if flash.Keyboard != "planck" || flash.Target != "all" || !flash.AssumeYes || !flash.ContinueOnError {
+		t.Errorf("flash step = %+v, want its own keyboard and every side", flash)
+	}
+	if flash.Title() != "Flash the travel board" {
+		t.Errorf("flash title = %q, want its name", flash.Title())
+	}
+	if got := j.Steps[0].Title(); got != "west-update (corne)" {
+		t.Errorf("west update title = %q", got)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"no steps", `keyboard = "corne"`, "no [[steps]]"},
+		{"unknown action", "[[steps]]\naction = \"deploy\"", `steps[0].action must be one of`},
+		{"unknown key", "[[steps]]\naction = \"build\"\npristene = true", "unknown key steps.pristene"},
+		{"syntax", "[[steps]\naction = \"build\"", "job.toml:1"},
+		{"pristine flash", "[[steps]]\naction = \"flash\"\npristine = true", "pristine only applies to build steps"},
+		{"assume_yes build", "[[steps]]\naction = \"build\"\nassume_yes = true", "assume_yes only applies to flash steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeJob(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
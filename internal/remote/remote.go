@@ -0,0 +1,207 @@
+// Package remote shares builds between machines through a remote artifact
+// cache: an S3 bucket, a WebDAV share or a directory reached over SSH. One
+// machine pushes each build it makes; others pull new builds into a local
+// directory that is scanned like any other firmware source.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// partialPrefix marks a build still being transferred, locally and in the
+// cache. Names starting with a dot are never listed as builds.
+const partialPrefix = ".partial-"
+
+// store is one kind of remote cache. Builds are directories of files,
+// named like the build directories they came from.
+type store interface {
+	// list returns the names of the builds in the cache.
+	list(ctx context.Context) ([]string, error)
+	// upload copies the files of dir into the cache as build name,
+	// replacing any build of that name.
+	upload(ctx context.Context, dir, name string) error
+	// download copies the files of build name into dest, which does not
+	// exist yet.
+	download(ctx context.Context, name, dest string) error
+	// read returns the content of one file of build name, or an error
+	// wrapping fs.ErrNotExist when it has none.
+	read(ctx context.Context, name, file string) ([]byte, error)
+}
+
+// Cache is a remote artifact cache and the local directory its builds are
+// downloaded to.
+type Cache struct {
+	location string // URL without credentials, for messages
+	dir      string
+	store    store
+}
+
+// New opens the cache at rawURL, downloading into dir. The URL is one of
+// s3://bucket/prefix (through the aws CLI), ssh://[user@]host[:port]/path
+// (ssh and scp; /~/path is relative to the home directory), or an http(s)
+// WebDAV URL, whose user and password are sent with basic auth.
+func New(rawURL, dir string) (*Cache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote URL: %w", err)
+	}
+	var s store
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid remote URL %q: no bucket", rawURL)
+		}
+		s = newS3Store(u)
+	case "ssh":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("invalid remote URL %q: want ssh://host/path", rawURL)
+		}
+		s = newSSHStore(u)
+	case "http", "https":
+		s = newWebDAVStore(u)
+	default:
+		return nil, fmt.Errorf("invalid remote URL %q: scheme must be s3, ssh, http or https", rawURL)
+	}
+	return &Cache{location: u.Redacted(), dir: dir, store: s}, nil
+}
+
+// String returns the cache's URL without its password.
+func (c *Cache) String() string {
+	return c.location
+}
+
+// Dir returns the local directory builds are downloaded to.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// List returns the names of the builds in the cache, sorted.
+func (c *Cache) List(ctx context.Context) ([]string, error) {
+	names, err := c.store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var builds []string
+	for _, name := range names {
+		if firmware.ValidName(name) {
+			builds = append(builds, name)
+		}
+	}
+	sort.Strings(builds)
+	return builds, nil
+}
+
+// Pull downloads the builds in the cache that are missing from the local
+// directory, or whose SHA256SUMS differs from the local copy's because the
+// build was made again, and returns their names. Each build is downloaded
+// beside the others and renamed into place, so scans never see half of one.
+func (c *Cache) Pull(ctx context.Context) ([]string, error) {
+	names, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var pulled []string
+	for _, name := range names {
+		fresh, err := c.fresh(ctx, name)
+		if err != nil {
+			return pulled, fmt.Errorf("%s: %w", name, err)
+		}
+		if fresh {
+			continue
+		}
+		if err := c.download(ctx, name); err != nil {
+			return pulled, fmt.Errorf("download %s: %w", name, err)
+		}
+		pulled = append(pulled, name)
+	}
+	return pulled, nil
+}
+
+// fresh reports whether the local copy of build name is up to date.
+func (c *Cache) fresh(ctx context.Context, name string) (bool, error) {
+	local, err := os.ReadFile(filepath.Join(c.dir, name, firmware.ManifestName))
+	if os.IsNotExist(err) {
+		// Builds without a manifest cannot be compared; keep what is there
+		_, err := os.Stat(filepath.Join(c.dir, name))
+		return err == nil, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	remote, err := c.store.read(ctx, name, firmware.ManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(local, remote), nil
+}
+
+// download fetches build name into the local directory, replacing any
+// older copy.
+func (c *Cache) download(ctx context.Context, name string) error {
+	partial := filepath.Join(c.dir, partialPrefix+name)
+	if err := os.RemoveAll(partial); err != nil {
+		return err
+	}
+	if err := c.store.download(ctx, name, partial); err != nil {
+		os.RemoveAll(partial)
+		return err
+	}
+	dest := filepath.Join(c.dir, name)
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(partial, dest)
+}
+
+// Push uploads a build to the cache under its directory name, first
+// recording every firmware file in its SHA256SUMS so other machines can
+// verify and compare it.
+func (c *Cache) Push(ctx context.Context, build firmware.Build) error {
+	for _, f := range build.Files {
+		if err := firmware.UpdateManifest(f.Path); err != nil {
+			return err
+		}
+	}
+	name := filepath.Base(build.Path)
+	if !firmware.ValidName(name) {
+		return fmt.Errorf("cannot upload %s: not a build directory", build.Path)
+	}
+	return c.store.upload(ctx, build.Path, name)
+}
+
+// errNotFound is returned by read for missing remote files.
+var errNotFound = fmt.Errorf("remote file %w", fs.ErrNotExist)
+
+// lastLine returns the last non-empty line of a tool's output, which
+// usually carries its error.
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// commandError describes a failed external command with the last line of
+// its output, which usually says why.
+func commandError(name string, err error, out []byte) error {
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("%s: %w: %s", name, err, lastLine(msg))
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
@@ -0,0 +1,317 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// fakeTools puts scripts on PATH, keyed by command name.
+func fakeTools(t *testing.T, scripts map[string]string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	dir := t.TempDir()
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// fakeS3 puts an aws on PATH that keeps buckets under root.
+func fakeS3(t *testing.T, root string) {
+	fakeTools(t, map[string]string{"aws": `#!/bin/bash
+local() { echo "` + root + `/${1#s3://}"; }
+shift # s3
+cmd="$1"; shift
+args=()
+for a in "$@"; do
+	case "$a" in --*) ;; *) args+=("$a") ;; esac
+done
+case "$cmd" in
+ls)
+	dir="$(local "${args[0]}")"
+	[ -d "$dir" ] || exit 1
+	for d in "$dir"/*/; do [ -d "$d" ] && echo "                           PRE $(basename "$d")/"; done
+	;;
+sync)
+	src="${args[0]}"; dst="${args[1]}"
+	case "$src" in s3://*) src="$(local "$src")" ;; esac
+	case "$dst" in s3://*) dst="$(local "$dst")" ;; esac
+	rm -rf "$dst" && mkdir -p "$dst" && cp -r "$src"/. "$dst"
+	;;
+cp)
+	f="$(local "${args[0]}")"
+	[ -f "$f" ] || { echo "fatal error: An error occurred (404) when calling the HeadObject operation: Key does not exist" >&2; exit 1; }
+	cat "$f"
+	;;
+esac
+`})
+}
+
+// fakeSSH puts an ssh that runs commands locally and an scp that copies
+// locally on PATH, recording the ssh targets in a log. Both fail unless
+// run in batch mode, as they would at a password prompt.
+func fakeSSH(t *testing.T) string {
+	log := filepath.Join(t.TempDir(), "ssh.log")
+	fakeTools(t, map[string]string{
+		"ssh": `#!/bin/bash
+while [ "${1:0:1}" = "-" ]; do
+	[ "$1 $2" = "-o BatchMode=yes" ] && batch=1
+	shift 2
+done
+[ -z "$batch" ] && { echo "ssh would prompt" >&2; exit 255; }
+echo "$1" >> ` + log + `
+bash -c "$2"
+`,
+		"scp": `#!/bin/bash
+args=()
+while [ $# -gt 0 ]; do
+	case "$1" in -o) [ "$2" = BatchMode=yes ] && batch=1; shift ;; -P) shift ;; -*) ;; *) args+=("${1#*:}") ;; esac
+	shift
+done
+[ -z "$batch" ] && { echo "scp would prompt" >&2; exit 1; }
+cp -r "${args[0]}" "${args[1]}"
+`,
+	})
+	return log
+}
+
+// fakeWebDAV serves root over the WebDAV methods the store uses, requiring
+// basic auth as user:password.
+func fakeWebDAV(t *testing.T, root, user, password string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := filepath.Join(root, filepath.FromSlash(r.URL.Path))
+		switch r.Method {
+		case "PROPFIND":
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			response := func(href string, dir bool) string {
+				kind := ""
+				if dir {
+					kind = "<D:collection/>"
+				}
+				return fmt.Sprintf("<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype>%s</D:resourcetype></D:prop></D:propstat></D:response>", href, kind)
+			}
+			body := `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">` + response(r.URL.Path, true)
+			for _, e := range entries {
+				href := strings.TrimSuffix(r.URL.Path, "/") + "/" + url.PathEscape(e.Name())
+				body += response(href, e.IsDir())
+			}
+			fmt.Fprint(w, body+"</D:multistatus>")
+		case "MKCOL":
+			if err := os.Mkdir(path, 0755); err != nil {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			f, err := os.Create(path)
+			if err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			defer f.Close()
+			f.ReadFrom(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			http.ServeFile(w, r, path)
+		case http.MethodDelete:
+			if _, err := os.Stat(path); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			os.RemoveAll(path)
+			w.WriteHeader(http.StatusNoContent)
+		case "MOVE":
+			dest, _ := url.Parse(r.Header.Get("Destination"))
+			target := filepath.Join(root, filepath.FromSlash(dest.Path))
+			if r.Header.Get("Overwrite") == "T" {
+				os.RemoveAll(target)
+			}
+			if err := os.Rename(path, target); err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeBuild writes a dated build of the given files under dir.
+func writeBuild(t *testing.T, dir, name string, files map[string]string) firmware.Build {
+	t.Helper()
+	build := firmware.Build{Name: name, Path: filepath.Join(dir, name)}
+	if err := os.MkdirAll(build.Path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		path := filepath.Join(build.Path, file)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		build.Files = append(build.Files, firmware.File{Name: file, Path: path})
+	}
+	return build
+}
+
+// testRoundTrip pushes a build from one machine and pulls it on another
+func testRoundTrip(t *testing.T, rawURL string) {
+	t.Helper()
+	ctx := context.Background()
+	desktop, err := New(rawURL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	laptop, err := New(rawURL, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := laptop.Pull(ctx); err != nil || len(names) != 0 {
+		t.Fatalf("Pull of an empty cache = %q, %v", names, err)
+	}
+
+	build := writeBuild(t, t.TempDir(), "20250102", map[string]string{
+		"corne_left.uf2":  "left v1",
+		"corne_right.uf2": "right v1",
+	})
+	if err := desktop.Push(ctx, build); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if names, err := desktop.List(ctx); err != nil || !slices.Equal(names, []string{"20250102"}) {
+		t.Fatalf("List = %q, %v; want the pushed build", names, err)
+	}
+
+	names, err := laptop.Pull(ctx)
+	if err != nil || !slices.Equal(names, []string{"20250102"}) {
+		t.Fatalf("Pull = %q, %v; want the pushed build", names, err)
+	}
+	left := filepath.Join(laptop.Dir(), "20250102", "corne_left.uf2")
+	if data, err := os.ReadFile(left); err != nil || string(data) != "left v1" {
+		t.Errorf("pulled left = %q, %v", data, err)
+	}
+	if err := firmware.VerifyManifest(left); err != nil {
+		t.Errorf("pulled build does not match its manifest: %v", err)
+	}
+
+	// Nothing new, nothing pulled
+	if names, err := laptop.Pull(ctx); err != nil || len(names) != 0 {
+		t.Errorf("second Pull = %q, %v; want nothing", names, err)
+	}
+
+	// A rebuild under the same name replaces the pulled copy
+	os.WriteFile(filepath.Join(build.Path, "corne_left.uf2"), []byte("left v2"), 0644)
+	os.WriteFile(filepath.Join(build.Path, "corne_right.uf2"), []byte("right v2"), 0644)
+	if err := desktop.Push(ctx, build); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if names, err := laptop.Pull(ctx); err != nil || len(names) != 1 {
+		t.Fatalf("Pull after a rebuild = %q, %v; want the build again", names, err)
+	}
+	if data, _ := os.ReadFile(left); string(data) != "left v2" {
+		t.Errorf("pulled left after a rebuild = %q, want v2", data)
+	}
+	entries, _ := os.ReadDir(laptop.Dir())
+	if len(entries) != 1 {
+		t.Errorf("local cache has %d entries, want just the build", len(entries))
+	}
+}
+
+func TestCache_S3(t *testing.T) {
+	fakeS3(t, t.TempDir())
+	testRoundTrip(t, "s3://team-firmware/corne")
+}
+
+func TestCache_SSH(t *testing.T) {
+	log := fakeSSH(t)
+	testRoundTrip(t, "ssh://me@desktop:2222"+filepath.ToSlash(t.TempDir())+"/firmware")
+
+	data, _ := os.ReadFile(log)
+	for _, target := range strings.Fields(string(data)) {
+		if target != "me@desktop" {
+			t.Fatalf("ssh target = %q, want me@desktop", target)
+		}
+	}
+}
+
+func TestCache_WebDAV(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "dav"), 0755)
+	srv := fakeWebDAV(t, root, "me", "secret")
+	u, _ := url.Parse(srv.URL)
+	u.User = url.UserPassword("me", "secret")
+	testRoundTrip(t, u.String()+"/dav/corne")
+
+	// The password stays out of messages
+	cache, _ := New(u.String()+"/dav/corne", t.TempDir())
+	if strings.Contains(cache.String(), "secret") {
+		t.Errorf("String() = %q shows the password", cache.String())
+	}
+	u.User = url.UserPassword("me", "wrong")
+	cache, _ = New(u.String()+"/dav/corne", t.TempDir())
+	if _, err := cache.Pull(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Pull with a wrong password = %v, want 401", err)
+	}
+}
+
+func TestCache_PullSkipsPartial(t *testing.T) {
+	root := t.TempDir()
+	fakeS3(t, root)
+	for _, name := range []string{"20250102", ".partial-20250103"} {
+		os.MkdirAll(filepath.Join(root, "bucket", name), 0755)
+		os.WriteFile(filepath.Join(root, "bucket", name, "corne_left.uf2"), []byte("uf2"), 0644)
+	}
+
+	cache, _ := New("s3://bucket", t.TempDir())
+	names, err := cache.Pull(context.Background())
+	if err != nil || !slices.Equal(names, []string{"20250102"}) {
+		t.Errorf("Pull = %q, %v; want only the finished build", names, err)
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"s3:///prefix", "ssh://desktop", "ftp://host/firmware", "desktop:firmware"} {
+		if _, err := New(rawURL, t.TempDir()); err == nil {
+			t.Errorf("New(%q) succeeded", rawURL)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"/srv/firmware": `'/srv/firmware'`,
+		"~/firmware":    `~/'firmware'`,
+		"/it's":         `'/it'\''s'`,
+	}
+	for in, want := range tests {
+		if got := quote(in); got != want {
+			t.Errorf("quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
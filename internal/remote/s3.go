@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// s3Store keeps builds under a bucket prefix, through the aws CLI so its
+// credentials, profiles and endpoint settings (AWS_ENDPOINT_URL for MinIO
+// or R2) apply as they do on the command line.
+type s3Store struct {
+	base string // s3://bucket/prefix/
+}
+
+func newS3Store(u *url.URL) *s3Store {
+	base := "s3://" + u.Host + "/"
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		base += prefix + "/"
+	}
+	return &s3Store{base: base}
+}
+
+func (s *s3Store) list(ctx context.Context) ([]string, error) {
+	out, err := s.aws(ctx, "ls", s.base)
+	if err != nil {
+		// aws s3 ls fails with no output for an empty prefix
+		if strings.TrimSpace(string(out)) == "" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// Builds are listed as common prefixes: "    PRE 20250102/"
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(line), "PRE "); ok {
+			names = append(names, strings.TrimSuffix(name, "/"))
+		}
+	}
+	return names, nil
+}
+
+func (s *s3Store) upload(ctx context.Context, dir, name string) error {
+	_, err := s.aws(ctx, "sync", "--delete", "--no-progress", dir, s.base+name+"/")
+	return err
+}
+
+func (s *s3Store) download(ctx context.Context, name, dest string) error {
+	_, err := s.aws(ctx, "sync", "--no-progress", s.base+name+"/", dest)
+	return err
+}
+
+func (s *s3Store) read(ctx context.Context, name, file string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "aws", "s3", "cp", "--quiet", s.base+name+"/"+file, "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "404") || strings.Contains(stderr.String(), "does not exist") {
+			return nil, errNotFound
+		}
+		return nil, commandError("aws s3 cp", err, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// aws runs an aws s3 subcommand, returning its output.
+func (s *s3Store) aws(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "aws", append([]string{"s3"}, args...)...).CombinedOutput()
+	if err != nil {
+		return out, commandError("aws s3 "+args[0], err, out)
+	}
+	return out, nil
+}
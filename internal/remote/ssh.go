@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// sshStore keeps builds in a directory on another machine, through ssh and
+// scp so the user's ssh config, agent and known hosts apply.
+type sshStore struct {
+	target string // [user@]host
+	port   string // empty for the ssh config's port
+	dir    string // remote directory, ~/ for the login's home
+}
+
+func newSSHStore(u *url.URL) *sshStore {
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	dir := u.Path
+	if rest, ok := strings.CutPrefix(dir, "/~/"); ok {
+		dir = "~/" + rest
+	}
+	return &sshStore{target: target, port: u.Port(), dir: strings.TrimSuffix(dir, "/")}
+}
+
+func (s *sshStore) list(ctx context.Context) ([]string, error) {
+	dir := quote(s.dir)
+	out, err := s.ssh(ctx, "if [ -d "+dir+" ]; then ls -1 "+dir+"; fi")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func (s *sshStore) upload(ctx context.Context, dir, name string) error {
+	// Copy beside the builds and rename, so a pull never gets half a build
+	partial := quote(s.dir + "/" + partialPrefix + name)
+	if _, err := s.ssh(ctx, "mkdir -p "+quote(s.dir)+" && rm -rf "+partial); err != nil {
+		return err
+	}
+	if err := s.scp(ctx, dir, s.target+":"+s.dir+"/"+partialPrefix+name); err != nil {
+		return err
+	}
+	dest := quote(s.dir + "/" + name)
+	_, err := s.ssh(ctx, "rm -rf "+dest+" && mv "+partial+" "+dest)
+	return err
+}
+
+func (s *sshStore) download(ctx context.Context, name, dest string) error {
+	return s.scp(ctx, s.target+":"+s.dir+"/"+name, dest)
+}
+
+func (s *sshStore) read(ctx context.Context, name, file string) ([]byte, error) {
+	path := quote(s.dir + "/" + name + "/" + file)
+	out, err := s.ssh(ctx, "if [ -f "+path+" ]; then cat "+path+"; else exit 3; fi")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		return nil, errNotFound
+	}
+	return out, err
+}
+
+// batchMode makes ssh and scp fail rather than prompt for a password or
+// an unknown host key, which would read the terminal under a running TUI;
+// use keys or an agent.
+var batchMode = []string{"-o", "BatchMode=yes"}
+
+// ssh runs a shell command on the remote machine, returning its stdout.
+func (s *sshStore) ssh(ctx context.Context, command string) ([]byte, error) {
+	args := append([]string(nil), batchMode...)
+	if s.port != "" {
+		args = append(args, "-p", s.port)
+	}
+	cmd := exec.CommandContext(ctx, "ssh", append(args, s.target, command)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, commandError("ssh", err, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// scp copies a directory recursively between the machines.
+func (s *sshStore) scp(ctx context.Context, from, to string) error {
+	args := append([]string{"-q", "-r"}, batchMode...)
+	if s.port != "" {
+		args = append(args, "-P", s.port)
+	}
+	out, err := exec.CommandContext(ctx, "scp", append(args, from, to)...).CombinedOutput()
+	if err != nil {
+		return commandError("scp", err, out)
+	}
+	return nil
+}
+
+// quote quotes a path for the remote shell, leaving a leading ~/ to be
+// expanded.
+func quote(path string) string {
+	prefix := ""
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		prefix, path = "~/", rest
+	}
+	return prefix + "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
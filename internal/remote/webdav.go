@@ -0,0 +1,240 @@
+package remote
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// webdavStore keeps builds in a WebDAV collection (Nextcloud, a NAS, nginx
+// or Apache with dav enabled).
+type webdavStore struct {
+	base     *url.URL // collection URL, ending in /
+	user     string
+	password string
+	client   *http.Client
+}
+
+func newWebDAVStore(u *url.URL) *webdavStore {
+	base := *u
+	base.User = nil
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	s := &webdavStore{base: &base, client: http.DefaultClient}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	return s
+}
+
+// multistatus is the part of a PROPFIND response listing needs.
+type multistatus struct {
+	Responses []struct {
+		Href       string    `xml:"href"`
+		Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+	} `xml:"response"`
+}
+
+// propfind lists the members of the collection at rel, "" for the base:
+// directories and files by name.
+func (s *webdavStore) propfind(ctx context.Context, rel string) (dirs, files []string, err error) {
+	body := strings.NewReader(`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`)
+	resp, err := s.do(ctx, "PROPFIND", rel, body, map[string]string{"Depth": "1", "Content-Type": "application/xml"})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, nil, statusError("PROPFIND", resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, nil, fmt.Errorf("PROPFIND %s: %w", s.url(rel).Redacted(), err)
+	}
+	self := strings.TrimSuffix(s.url(rel).Path, "/")
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSuffix(href.Path, "/")
+		if p == self || path.Dir(p) != self {
+			continue // the collection itself
+		}
+		if r.Collection != nil {
+			dirs = append(dirs, path.Base(p))
+		} else {
+			files = append(files, path.Base(p))
+		}
+	}
+	return dirs, files, nil
+}
+
+func (s *webdavStore) list(ctx context.Context) ([]string, error) {
+	dirs, _, err := s.propfind(ctx, "")
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	return dirs, err
+}
+
+func (s *webdavStore) upload(ctx context.Context, dir, name string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := s.mkcol(ctx, ""); err != nil {
+		return err
+	}
+
+	// Upload beside the builds and move into place, so a pull never gets
+	// half a build
+	partial := partialPrefix + name + "/"
+	if err := s.delete(ctx, partial); err != nil {
+		return err
+	}
+	if err := s.mkcol(ctx, partial); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := s.put(ctx, partial+entry.Name(), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.do(ctx, "MOVE", partial, nil, map[string]string{
+		"Destination": s.url(name + "/").String(),
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError("MOVE", resp)
+	}
+	return nil
+}
+
+func (s *webdavStore) download(ctx context.Context, name, dest string) error {
+	_, files, err := s.propfind(ctx, name+"/")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := s.read(ctx, name, file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dest, file), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *webdavStore) read(ctx context.Context, name, file string) ([]byte, error) {
+	rel := name + "/" + file
+	resp, err := s.do(ctx, http.MethodGet, rel, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("GET", resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// mkcol creates the collection at rel unless it exists.
+func (s *webdavStore) mkcol(ctx context.Context, rel string) error {
+	resp, err := s.do(ctx, "MKCOL", rel, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// 405 Method Not Allowed is the answer for an existing collection
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return statusError("MKCOL", resp)
+	}
+	return nil
+}
+
+// delete removes rel, if it exists.
+func (s *webdavStore) delete(ctx context.Context, rel string) error {
+	resp, err := s.do(ctx, http.MethodDelete, rel, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return statusError("DELETE", resp)
+	}
+	return nil
+}
+
+// put uploads the file at src to rel.
+func (s *webdavStore) put(ctx context.Context, rel, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resp, err := s.do(ctx, http.MethodPut, rel, f, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError("PUT", resp)
+	}
+	return nil
+}
+
+// do sends a request for rel, relative to the base collection.
+func (s *webdavStore) do(ctx context.Context, method, rel string, body io.Reader, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(rel).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	return s.client.Do(req)
+}
+
+// url resolves rel against the base collection.
+func (s *webdavStore) url(rel string) *url.URL {
+	return s.base.ResolveReference(&url.URL{Path: rel})
+}
+
+// statusError describes an unexpected response.
+func statusError(method string, resp *http.Response) error {
+	return fmt.Errorf("%s %s: %s", method, resp.Request.URL.Redacted(), resp.Status)
+}
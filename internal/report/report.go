@@ -0,0 +1,269 @@
+// Package report writes a summary of a flash session (the build used, each
+// file flashed with its hash and timing, and any warnings) as Markdown or
+// JSON, for keeping records of what went onto which board.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// Report formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// Formats lists the supported report formats.
+var Formats = []string{FormatMarkdown, FormatJSON}
+
+// timestampFormat names report files so they sort chronologically.
+const timestampFormat = "20060102-150405"
+
+// Report is the record of one flash session.
+type Report struct {
+	Keyboard string    `json:"keyboard"`
+	Build    Build     `json:"build"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Flashes  []Flash   `json:"flashes"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// Build identifies the firmware build a session flashed.
+type Build struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"`
+	Notes  string `json:"notes,omitempty"` // first line of the build notes
+}
+
+// Flash is one file written to a side's bootloader.
+type Flash struct {
+	Side        string  `json:"side"`
+	File        string  `json:"file,omitempty"` // empty when the qmk CLI flashed the side
+	SHA256      string  `json:"sha256,omitempty"`
+	Destination string  `json:"destination,omitempty"` // file written on the bootloader volume
+	Bytes       int64   `json:"bytes,omitempty"`
+	Seconds     float64 `json:"seconds"`
+}
+
+// New starts a report for a session on keyboard.
+func New(keyboard string) *Report {
+	return &Report{
+		Keyboard: keyboard,
+		Started:  time.Now(),
+		Flashes:  []Flash{},
+	}
+}
+
+// SetBuild records the build the session flashes.
+func (r *Report) SetBuild(b Build) {
+	r.Build = b
+}
+
+// AddFlash records a file flashed with result, hashing it when the flasher
+// did not. An empty path records a side flashed without a local file.
+func (r *Report) AddFlash(side, path string, result firmware.FlashResult, d time.Duration) {
+	f := Flash{
+		Side:        side,
+		File:        path,
+		SHA256:      result.SHA256,
+		Destination: result.Destination,
+		Bytes:       result.BytesWritten,
+		Seconds:     d.Round(time.Millisecond).Seconds(),
+	}
+	if path != "" && f.SHA256 == "" {
+		sum, err := firmware.FileSHA256(path)
+		if err != nil {
+			r.Warn(fmt.Sprintf("cannot hash %s: %v", filepath.Base(path), err))
+		}
+		f.SHA256 = sum
+	}
+	r.Flashes = append(r.Flashes, f)
+}
+
+// Warn records a warning raised during the session.
+func (r *Report) Warn(msg string) {
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// Finish ends the session, failed if err is non-nil.
+func (r *Report) Finish(err error) {
+	r.Finished = time.Now()
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Markdown renders the report as a Markdown document.
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# kbflash report: %s\n\n", r.Keyboard)
+
+	status := "success"
+	if !r.Success {
+		status = "failed: " + r.Error
+	}
+	fmt.Fprintf(&b, "- Started: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Finished: %s\n", r.Finished.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Duration: %s\n", r.Finished.Sub(r.Started).Round(time.Second))
+	fmt.Fprintf(&b, "- Result: %s\n", status)
+
+	if r.Build.Path != "" {
+		fmt.Fprintf(&b, "\n## Build\n\n")
+		fmt.Fprintf(&b, "- Name: %s\n", r.Build.Name)
+		fmt.Fprintf(&b, "- Path: `%s`\n", r.Build.Path)
+		if r.Build.Source != "" {
+			fmt.Fprintf(&b, "- Source: %s\n", r.Build.Source)
+		}
+		if r.Build.Notes != "" {
+			fmt.Fprintf(&b, "- Notes: %s\n", r.Build.Notes)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Flashed\n\n")
+	if len(r.Flashes) == 0 {
+		fmt.Fprintf(&b, "Nothing was flashed.\n")
+	} else {
+		fmt.Fprintf(&b, "| Side | File | Written to | Size | Time | SHA-256 |\n")
+		fmt.Fprintf(&b, "|------|------|------------|------|------|---------|\n")
+		for _, f := range r.Flashes {
+			file, dest, size, sum := "-", "-", "-", "-"
+			if f.File != "" {
+				file = "`" + filepath.Base(f.File) + "`"
+			}
+			if f.Destination != "" {
+				dest = "`" + f.Destination + "`"
+			}
+			if f.Bytes > 0 {
+				size = fmt.Sprintf("%d bytes", f.Bytes)
+			}
+			if f.SHA256 != "" {
+				sum = "`" + f.SHA256 + "`"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %.1fs | %s |\n", f.Side, file, dest, size, f.Seconds, sum)
+		}
+	}
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(&b, "\n## Warnings\n\n")
+		for _, w := range r.Warnings {
+			fmt.Fprintf(&b, "- %s\n", w)
+		}
+	}
+	return b.String()
+}
+
+// Write saves the report in format as a new timestamped file under dir,
+// returning its path.
+func (r *Report) Write(dir, format string) (string, error) {
+	var data []byte
+	ext := ".md"
+	switch format {
+	case FormatJSON:
+		var err error
+		if data, err = json.MarshalIndent(r, "", "  "); err != nil {
+			return "", err
+		}
+		data = append(data, '\n')
+		ext = ".json"
+	case FormatMarkdown, "":
+		data = []byte(r.Markdown())
+	default:
+		return "", fmt.Errorf("unknown report format %q", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create report directory: %w", err)
+	}
+	name := fileName(r.Keyboard) + "-" + r.Started.Format(timestampFormat) + ext
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Batch is the record of flash sessions run one after another, one per
+// keyboard, as by kbflash flash --all-keyboards.
+type Batch struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Success  bool      `json:"success"`
+	Sessions []*Report `json:"sessions"`
+	Skipped  []string  `json:"skipped,omitempty"` // keyboards not flashed when asked
+}
+
+// NewBatch starts a batch of sessions.
+func NewBatch() *Batch {
+	return &Batch{Started: time.Now(), Sessions: []*Report{}}
+}
+
+// Add records a finished session.
+func (b *Batch) Add(r *Report) {
+	b.Sessions = append(b.Sessions, r)
+}
+
+// Skip records a keyboard that was not flashed.
+func (b *Batch) Skip(keyboard string) {
+	b.Skipped = append(b.Skipped, keyboard)
+}
+
+// Failed returns the keyboards whose session failed.
+func (b *Batch) Failed() []string {
+	var failed []string
+	for _, r := range b.Sessions {
+		if !r.Success {
+			failed = append(failed, r.Keyboard)
+		}
+	}
+	return failed
+}
+
+// Finish ends the batch, successful when every session was.
+func (b *Batch) Finish() {
+	b.Finished = time.Now()
+	b.Success = len(b.Failed()) == 0
+}
+
+// Write saves the batch as a new timestamped JSON file under dir,
+// returning its path.
+func (b *Batch) Write(dir string) (string, error) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("cannot create report directory: %w", err)
+	}
+	path := filepath.Join(dir, "all-keyboards-"+b.Started.Format(timestampFormat)+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// fileName makes keyboard safe to use in a file name.
+func fileName(keyboard string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '-'
+		}
+		return r
+	}, keyboard)
+	if name == "" {
+		return "kbflash"
+	}
+	return name
+}
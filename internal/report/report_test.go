@@ -0,0 +1,148 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+func TestReport_WriteMarkdown(t *testing.T) {
+	fw := filepath.Join(t.TempDir(), "corne_left.uf2")
+	if err := os.WriteFile(fw, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New("corne")
+	r.SetBuild(Build{Name: "2026-10-14", Path: "/fw/20261014", Notes: "Homerow mods"})
+	r.AddFlash("left", fw, firmware.FlashResult{Success: true, BytesWritten: 4, Destination: "/media/NICENANO/corne_left.uf2"}, 1500*time.Millisecond)
+	r.AddFlash("right", "", firmware.FlashResult{Success: true}, 2*time.Second)
+	r.Warn("right still mounted after 10s")
+	r.Finish(nil)
+
+	dir := filepath.Join(t.TempDir(), "reports")
+	path, err := r.Write(dir, FormatMarkdown)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "corne-") || filepath.Ext(path) != ".md" {
+		t.Errorf("path = %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"# kbflash report: corne",
+		"- Result: success",
+		"- Notes: Homerow mods",
+		// sha256("test")
+		"| left | `corne_left.uf2` | `/media/NICENANO/corne_left.uf2` | 4 bytes | 1.5s | `9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08` |",
+		"| right | - | - | - | 2.0s | - |",
+		"- right still mounted after 10s",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	r := New("corne")
+	r.AddFlash("left", filepath.Join(t.TempDir(), "missing.uf2"), firmware.FlashResult{}, time.Second)
+	r.Finish(errors.New("timeout waiting for device"))
+
+	path, err := r.Write(t.TempDir(), FormatJSON)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if filepath.Ext(path) != ".json" {
+		t.Errorf("path = %s, want .json", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Report
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if loaded.Success || loaded.Error != "timeout waiting for device" {
+		t.Errorf("loaded = %+v, want a failed session", loaded)
+	}
+	if len(loaded.Flashes) != 1 || loaded.Flashes[0].Side != "left" {
+		t.Errorf("Flashes = %+v", loaded.Flashes)
+	}
+	if len(loaded.Warnings) != 1 || !strings.Contains(loaded.Warnings[0], "cannot hash missing.uf2") {
+		t.Errorf("Warnings = %v, want the hash failure", loaded.Warnings)
+	}
+}
+
+func TestReport_AddFlashKeepsFlasherHash(t *testing.T) {
+	r := New("corne")
+	// The flasher hashed the file before it was removed
+	r.AddFlash("left", filepath.Join(t.TempDir(), "gone.uf2"), firmware.FlashResult{
+		Success:      true,
+		BytesWritten: 4,
+		SHA256:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		Destination:  "/media/NICENANO/gone.uf2",
+	}, time.Second)
+
+	f := r.Flashes[0]
+	if f.SHA256 != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" || f.Destination != "/media/NICENANO/gone.uf2" {
+		t.Errorf("flash = %+v, want the flasher's hash and destination", f)
+	}
+	if len(r.Warnings) != 0 {
+		t.Errorf("Warnings = %v, want none", r.Warnings)
+	}
+}
+
+func TestReport_WriteUnknownFormat(t *testing.T) {
+	r := New("corne")
+	r.Finish(nil)
+	if _, err := r.Write(t.TempDir(), "yaml"); err == nil {
+		t.Error("expected an unknown format error")
+	}
+}
+
+func TestBatch_Write(t *testing.T) {
+	b := NewBatch()
+	corne := New("corne")
+	corne.Finish(nil)
+	b.Add(corne)
+	sofle := New("sofle")
+	sofle.Finish(errors.New("timeout waiting for device"))
+	b.Add(sofle)
+	b.Skip("planck")
+	b.Finish()
+
+	if b.Success || len(b.Failed()) != 1 || b.Failed()[0] != "sofle" {
+		t.Errorf("batch success %v, failed %v; want sofle failed", b.Success, b.Failed())
+	}
+	path, err := b.Write(t.TempDir())
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.HasPrefix(filepath.Base(path), "all-keyboards-") || filepath.Ext(path) != ".json" {
+		t.Errorf("path = %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Batch
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(loaded.Sessions) != 2 || loaded.Sessions[1].Error != "timeout waiting for device" || len(loaded.Skipped) != 1 {
+		t.Errorf("loaded = %+v", loaded)
+	}
+}
@@ -0,0 +1,92 @@
+// Package session saves an in-progress flash sequence so a run interrupted
+// between halves can resume at the remaining sides.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/statefile"
+)
+
+// Session is a flash sequence of one build across a keyboard's sides.
+type Session struct {
+	path     string
+	Keyboard string    `json:"keyboard"`
+	Build    string    `json:"build"` // path of the selected build
+	Sides    []string  `json:"sides"` // every side, in flash order
+	Done     []string  `json:"done"`  // sides flashed so far
+	Started  time.Time `json:"started"`
+}
+
+// DefaultPath returns the session file path, session.json in the kbflash state
+// directory.
+func DefaultPath() (string, error) {
+	return statefile.Path("session.json")
+}
+
+// New starts a session saved at path. An empty path keeps it in memory.
+func New(path, keyboard, build string, sides []string) *Session {
+	return &Session{
+		path:     path,
+		Keyboard: keyboard,
+		Build:    build,
+		Sides:    sides,
+		Started:  time.Now(),
+	}
+}
+
+// Load reads the session at path. It returns nil when there is none.
+func Load(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{path: path}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("cannot parse session %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// MarkDone records that side has been flashed.
+func (s *Session) MarkDone(side string) {
+	if !slices.Contains(s.Done, side) {
+		s.Done = append(s.Done, side)
+	}
+}
+
+// Remaining returns the sides not flashed yet, in order.
+func (s *Session) Remaining() []string {
+	var remaining []string
+	for _, side := range s.Sides {
+		if !slices.Contains(s.Done, side) {
+			remaining = append(remaining, side)
+		}
+	}
+	return remaining
+}
+
+// Save writes the session to its file, replacing it atomically.
+// In-memory sessions are not saved.
+func (s *Session) Save() error {
+	return statefile.SaveJSON(s.path, s)
+}
+
+// Clear removes the session file once the sequence is finished or abandoned.
+func (s *Session) Clear() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
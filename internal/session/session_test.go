@@ -0,0 +1,68 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSession_SaveLoadResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "session.json")
+
+	s, err := Load(path)
+	if err != nil || s != nil {
+		t.Fatalf("Load of missing file = %v, %v; want nil, nil", s, err)
+	}
+
+	s = New(path, "corne", "/fw/20261014", []string{"left", "right", "dongle"})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	s.MarkDone("left")
+	s.MarkDone("left")
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Keyboard != "corne" || loaded.Build != "/fw/20261014" {
+		t.Errorf("loaded = %+v, want corne /fw/20261014", loaded)
+	}
+	if got := loaded.Remaining(); !slices.Equal(got, []string{"right", "dongle"}) {
+		t.Errorf("Remaining = %v, want [right dongle]", got)
+	}
+
+	if err := loaded.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("session file still present after Clear: %v", err)
+	}
+	if err := loaded.Clear(); err != nil {
+		t.Errorf("second Clear failed: %v", err)
+	}
+}
+
+func TestSession_InMemory(t *testing.T) {
+	s := New("", "corne", "/fw/20261014", []string{"left", "right"})
+	if err := s.Save(); err != nil {
+		t.Errorf("Save of in-memory session failed: %v", err)
+	}
+	if err := s.Clear(); err != nil {
+		t.Errorf("Clear of in-memory session failed: %v", err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("expected an error for a corrupt session file")
+	}
+}
@@ -0,0 +1,396 @@
+// Package sim provides simulated hardware and build tooling so the full
+// kbflash flow can be previewed without a keyboard or Docker.
+package sim
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// Default timings for the simulated user and hardware.
+const (
+	DefaultConnectDelay = 3 * time.Second  // unplugged until the user double-taps reset
+	DefaultIdleTimeout  = 10 * time.Second // bootloader left alone before it is unplugged
+	DefaultFlashTime    = 1500 * time.Millisecond
+	DefaultBuildStep    = 150 * time.Millisecond
+)
+
+// VolumeName is the bootloader volume name used by the demo config.
+const VolumeName = "NICENANO"
+
+// Device is a simulated UF2 bootloader. It appears ConnectDelay after being
+// unplugged, disappears when flashed (the keyboard reboots into firmware)
+// and is unplugged again if left idle for IdleTimeout.
+type Device struct {
+	ConnectDelay time.Duration
+	IdleTimeout  time.Duration
+
+	mu        sync.Mutex
+	manual    bool // only Plug, Unplug and flashes change the state
+	connected bool
+	changed   time.Time
+}
+
+// NewDevice creates a disconnected simulated device with default timings.
+func NewDevice() *Device {
+	return &Device{
+		ConnectDelay: DefaultConnectDelay,
+		IdleTimeout:  DefaultIdleTimeout,
+		changed:      time.Now(),
+	}
+}
+
+// NewManualDevice creates a disconnected simulated device that connects
+// and disconnects only when told to with Plug and Unplug, for scripted tests.
+func NewManualDevice() *Device {
+	return &Device{manual: true, changed: time.Now()}
+}
+
+// Plug connects the bootloader, as double-tapping reset does.
+func (d *Device) Plug() {
+	d.set(true)
+}
+
+// Unplug disconnects the bootloader.
+func (d *Device) Unplug() {
+	d.set(false)
+}
+
+func (d *Device) set(connected bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connected = connected
+	d.changed = time.Now()
+}
+
+// Connected reports whether the bootloader volume is currently mounted,
+// advancing the simulated user's actions.
+func (d *Device) Connected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.manual {
+		return d.connected
+	}
+	elapsed := time.Since(d.changed)
+	if d.connected && elapsed >= d.IdleTimeout {
+		d.connected = false
+		d.changed = time.Now()
+	} else if !d.connected && elapsed >= d.ConnectDelay {
+		d.connected = true
+		d.changed = time.Now()
+	}
+	return d.connected
+}
+
+// reboot simulates the bootloader restarting into firmware after a flash.
+func (d *Device) reboot() {
+	d.set(false)
+}
+
+// Detector reports a simulated Device's connection state.
+type Detector struct {
+	device *Device
+}
+
+// event describes the simulated volume, which looks like a nice!nano bootloader.
+func event(volumeName string, connected bool, path string) device.Event {
+	if !connected {
+		return device.Event{Path: path}
+	}
+	return device.Event{
+		Connected: true,
+		Path:      path,
+		Label:     volumeName,
+		FSType:    "vfat",
+		Capacity:  32 << 20,
+		Serial:    "SIM0001",
+	}
+}
+
+// NewDetector creates a detector for the simulated device.
+func NewDetector(d *Device) *Detector {
+	return &Detector{device: d}
+}
+
+// Detect polls the simulated device and emits events on state changes.
+func (d *Detector) Detect(ctx context.Context, volumeName string, pollInterval time.Duration) <-chan device.Event {
+	events := make(chan device.Event)
+
+	go func() {
+		defer close(events)
+
+		path := filepath.Join("/sim", volumeName)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		// Check immediately on start
+		lastConnected := d.device.Connected()
+		select {
+		case events <- event(volumeName, lastConnected, path):
+		case <-ctx.Done():
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				connected := d.device.Connected()
+				if connected != lastConnected {
+					lastConnected = connected
+					select {
+					case events <- event(volumeName, connected, path):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// List returns the simulated volume while it is connected.
+func (d *Detector) List(ctx context.Context) ([]device.DeviceInfo, error) {
+	if !d.device.Connected() {
+		return nil, nil
+	}
+	e := event(VolumeName, true, filepath.Join("/sim", VolumeName))
+	return []device.DeviceInfo{{
+		Path:     e.Path,
+		Label:    e.Label,
+		FSType:   e.FSType,
+		Capacity: e.Capacity,
+		Serial:   e.Serial,
+	}}, nil
+}
+
+// Flasher pretends to copy firmware to a simulated Device.
+type Flasher struct {
+	device   *Device
+	Duration time.Duration
+	Err      error // when set, flashes fail with it halfway through
+}
+
+// NewFlasher creates a flasher for the simulated device.
+func NewFlasher(d *Device) *Flasher {
+	return &Flasher{device: d, Duration: DefaultFlashTime}
+}
+
+// flashSteps is how many progress updates a simulated copy reports.
+const flashSteps = 10
+
+// Flash reports progress over the simulated copy, then reboots the device.
+func (f *Flasher) Flash(ctx context.Context, srcPath, devicePath string, progressFn func(firmware.FlashProgress)) firmware.FlashResult {
+	if progressFn == nil {
+		progressFn = func(firmware.FlashProgress) {}
+	}
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return firmware.FlashResult{Success: false, Error: fmt.Errorf("open source: %w", err)}
+	}
+
+	for i := 1; i <= flashSteps; i++ {
+		select {
+		case <-time.After(f.Duration / flashSteps):
+		case <-ctx.Done():
+			return firmware.FlashResult{Success: false, Error: ctx.Err()}
+		}
+		if f.Err != nil && i > flashSteps/2 {
+			return firmware.FlashResult{Success: false, Error: f.Err}
+		}
+		progressFn(firmware.FlashProgress{
+			Written: info.Size() * int64(i) / flashSteps,
+			Total:   info.Size(),
+			Percent: i * 100 / flashSteps,
+		})
+	}
+
+	sum, err := firmware.FileSHA256(srcPath)
+	if err != nil {
+		return firmware.FlashResult{Success: false, Error: fmt.Errorf("hash source: %w", err)}
+	}
+
+	f.device.reboot()
+	return firmware.FlashResult{
+		Success:      true,
+		BytesWritten: info.Size(),
+		SHA256:       sum,
+		Destination:  filepath.Join(devicePath, filepath.Base(srcPath)),
+	}
+}
+
+// Builder emits ninja-style progress and writes placeholder UF2 files into
+// a dated directory under firmwareDir.
+type Builder struct {
+	firmwareDir string
+	shield      string
+	sides       []string
+	Steps       int
+	StepDelay   time.Duration
+}
+
+// NewBuilder creates a simulated builder.
+func NewBuilder(firmwareDir, shield string, sides []string) *Builder {
+	return &Builder{
+		firmwareDir: firmwareDir,
+		shield:      shield,
+		sides:       sides,
+		Steps:       24,
+		StepDelay:   DefaultBuildStep,
+	}
+}
+
+// Clean does nothing: simulated builds leave no build directories behind.
+func (b *Builder) Clean(ctx context.Context, side string) error {
+	return ctx.Err()
+}
+
+// Build simulates a firmware build for side ("all" builds every side).
+func (b *Builder) Build(ctx context.Context, side string, progressFn func(firmware.BuildProgress)) firmware.BuildResult {
+	if progressFn == nil {
+		progressFn = func(firmware.BuildProgress) {}
+	}
+	startTime := time.Now()
+
+	for i := 1; i <= b.Steps; i++ {
+		select {
+		case <-time.After(b.StepDelay):
+		case <-ctx.Done():
+			return firmware.BuildResult{Success: false, Error: ctx.Err()}
+		}
+		progressFn(firmware.BuildProgress{
+			Current: i,
+			Total:   b.Steps,
+			Percent: firmware.BuildCompiling.Percent(i, b.Steps),
+			Stage:   firmware.BuildCompiling,
+			Output:  fmt.Sprintf("[%d/%d] Building C object zephyr/CMakeFiles/zephyr.dir/sim_%d.c.obj", i, b.Steps, i),
+		})
+	}
+
+	sides := []string{side}
+	if side == "all" {
+		sides = b.sides
+	}
+
+	outputDir := filepath.Join(b.firmwareDir, time.Now().Format("20060102"))
+	var outputPath string
+	for _, s := range sides {
+		path, err := writeFirmware(outputDir, b.shield, s)
+		if err != nil {
+			return firmware.BuildResult{Success: false, Error: err}
+		}
+		outputPath = path
+	}
+
+	return firmware.BuildResult{
+		Success:    true,
+		Duration:   time.Since(startTime),
+		OutputPath: outputPath,
+	}
+}
+
+// Seed populates firmwareDir with a couple of older builds to pick from.
+func Seed(firmwareDir, shield string, sides []string) error {
+	for _, age := range []int{1, 7} {
+		dir := filepath.Join(firmwareDir, time.Now().AddDate(0, 0, -age).Format("20060102"))
+		for _, side := range sides {
+			if _, err := writeFirmware(dir, shield, side); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFirmware writes a placeholder UF2 named like the Docker builder's output.
+func writeFirmware(dir, shield, side string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := shield + ".uf2"
+	if side != "" && side != "main" {
+		name = shield + "_" + side + ".uf2"
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, uf2Image(name, 300), 0644); err != nil {
+		return "", err
+	}
+	if err := firmware.UpdateManifest(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// uf2Image builds a valid UF2 image of n blocks whose payload is derived
+// from seed, sized like a small ZMK image.
+func uf2Image(seed string, n int) []byte {
+	const payload = 256
+	le := binary.LittleEndian
+	data := make([]byte, 0, n*512)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 512)
+		le.PutUint32(b[0:], 0x0A324655)
+		le.PutUint32(b[4:], 0x9E5D5157)
+		le.PutUint32(b[12:], 0x26000+uint32(i)*payload)
+		le.PutUint32(b[16:], payload)
+		le.PutUint32(b[20:], uint32(i))
+		le.PutUint32(b[24:], uint32(n))
+		copy(b[32:32+payload], strings.Repeat(seed, payload/len(seed)+1))
+		le.PutUint32(b[508:], 0x0AB16F30)
+		data = append(data, b...)
+	}
+	return data
+}
+
+// DemoConfig returns a split-keyboard config backed by firmwareDir.
+func DemoConfig(firmwareDir string) *config.Config {
+	return &config.Config{
+		Keyboard: config.KeyboardConfig{
+			Name:  "corne",
+			Type:  "split",
+			Sides: []string{"left", "right"},
+		},
+		Build: config.BuildConfig{
+			Enabled:       true,
+			Mode:          "native",
+			FirmwareDir:   firmwareDir,
+			FilePattern:   config.DefaultFilePattern,
+			Pull:          "never",
+			RetentionDays: config.DefaultRetentionDays,
+			StaleDays:     config.DefaultStaleDays,
+			Shield:        "corne",
+		},
+		Device: config.DeviceConfig{
+			Name:             VolumeName,
+			PollInterval:     config.DefaultPollInterval,
+			IdlePollInterval: config.DefaultIdlePollInterval,
+			Profile:          config.DefaultDeviceProfile,
+		},
+		Flash: config.FlashConfig{
+			Mode:          "copy",
+			FileType:      "uf2",
+			WriteStrategy: "end",
+			SyncEvery:     config.DefaultSyncEvery,
+			MinSize:       config.DefaultMinFirmwareSize,
+		},
+		Backup: config.BackupConfig{
+			Dir:      config.DefaultBackupDir,
+			Patterns: config.DefaultBackupPatterns,
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+func TestDevice_Cycle(t *testing.T) {
+	d := NewDevice()
+	d.ConnectDelay = 20 * time.Millisecond
+	d.IdleTimeout = 20 * time.Millisecond
+
+	if d.Connected() {
+		t.Fatal("device should start disconnected")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !d.Connected() {
+		t.Fatal("device should connect after ConnectDelay")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if d.Connected() {
+		t.Fatal("device should be unplugged after IdleTimeout")
+	}
+}
+
+func TestFlasher_RebootsDevice(t *testing.T) {
+	d := NewDevice()
+	d.ConnectDelay = 0
+	if !d.Connected() {
+		t.Fatal("device should connect immediately with zero delay")
+	}
+	d.ConnectDelay = time.Hour
+
+	src := filepath.Join(t.TempDir(), "fw.uf2")
+	if err := os.WriteFile(src, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlasher(d)
+	f.Duration = time.Millisecond
+	result := f.Flash(context.Background(), src, "/sim/"+VolumeName, nil)
+	if !result.Success {
+		t.Fatalf("Flash failed: %v", result.Error)
+	}
+	if result.BytesWritten != 8 {
+		t.Errorf("BytesWritten = %d, want 8", result.BytesWritten)
+	}
+	if d.Connected() {
+		t.Error("device should disconnect after flashing")
+	}
+}
+
+func TestBuilder_WritesScannableFirmware(t *testing.T) {
+	dir := t.TempDir()
+	b := NewBuilder(dir, "corne", []string{"left", "right"})
+	b.StepDelay = 0
+
+	var updates int
+	result := b.Build(context.Background(), "all", func(firmware.BuildProgress) { updates++ })
+	if !result.Success {
+		t.Fatalf("Build failed: %v", result.Error)
+	}
+	if updates != b.Steps {
+		t.Errorf("progress updates = %d, want %d", updates, b.Steps)
+	}
+
+	builds, err := firmware.NewScanner(dir, "*.uf2").Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 1 || len(builds[0].Files) != 2 {
+		t.Fatalf("scanned builds = %+v, want one build with two files", builds)
+	}
+
+	data, err := os.ReadFile(builds[0].Files[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := firmware.ParseUF2(data); err != nil {
+		t.Errorf("simulated firmware is not valid UF2: %v", err)
+	}
+	if err := firmware.VerifyManifest(builds[0].Files[0].Path); err != nil {
+		t.Errorf("simulated firmware fails its manifest: %v", err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	dir := t.TempDir()
+	if err := Seed(dir, "corne", []string{"left", "right"}); err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := firmware.NewScanner(dir, "*.uf2").Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 2 {
+		t.Errorf("seeded builds = %d, want 2", len(builds))
+	}
+}
+
+func TestManualDevice(t *testing.T) {
+	d := NewManualDevice()
+	if d.Connected() {
+		t.Fatal("device should start disconnected")
+	}
+	d.Plug()
+	time.Sleep(10 * time.Millisecond)
+	if !d.Connected() {
+		t.Fatal("device should stay connected until unplugged")
+	}
+	d.Unplug()
+	if d.Connected() {
+		t.Fatal("device should disconnect when unplugged")
+	}
+}
+
+func TestFlasher_Err(t *testing.T) {
+	d := NewManualDevice()
+	d.Plug()
+	src := filepath.Join(t.TempDir(), "fw.uf2")
+	if err := os.WriteFile(src, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlasher(d)
+	f.Duration = time.Millisecond
+	f.Err = firmware.ErrDeviceRemoved
+	result := f.Flash(context.Background(), src, "/sim/"+VolumeName, nil)
+	if result.Success || result.Error != firmware.ErrDeviceRemoved {
+		t.Errorf("Flash = %+v, want ErrDeviceRemoved", result)
+	}
+	if !d.Connected() {
+		t.Error("a failed flash should not reboot the device")
+	}
+}
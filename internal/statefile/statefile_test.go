@@ -0,0 +1,58 @@
+package statefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	got, err := Path("flashes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/state", "kbflash", "flashes.json"); got != want {
+		t.Errorf("Path = %q, want %q", got, want)
+	}
+
+	home := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", home)
+	got, err = Path("flashes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".local", "state", "kbflash", "flashes.json"); got != want {
+		t.Errorf("Path without XDG_STATE_HOME = %q, want %q", got, want)
+	}
+}
+
+func TestSaveJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kbflash", "tags.json")
+
+	if err := SaveJSON(path, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("SaveJSON failed: %v", err)
+	}
+	if err := SaveJSON(path, map[string]int{"b": 2}); err != nil {
+		t.Fatalf("SaveJSON over an existing file failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"b\": 2\n}"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+
+	// No temporary files are left beside it
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("state directory holds %d files, want 1", len(entries))
+	}
+
+	if err := SaveJSON("", map[string]int{}); err != nil {
+		t.Errorf("SaveJSON without a path = %v, want nothing saved", err)
+	}
+}
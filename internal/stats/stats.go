@@ -0,0 +1,111 @@
+// Package stats records build durations across runs so slow builds stand out.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/statefile"
+)
+
+// maxRuns is how many durations are kept per target.
+const maxRuns = 20
+
+// Run is one successful build.
+type Run struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+}
+
+// History holds recent build durations per target, persisted as JSON.
+type History struct {
+	path    string
+	Targets map[string][]Run `json:"targets"`
+}
+
+// Summary describes the recent builds of one target.
+type Summary struct {
+	Last    time.Duration
+	Average time.Duration // of the runs before Last, zero if there are none
+	Runs    int
+}
+
+// Trend is the change of Last against Average as a percentage.
+// ok is false when there is nothing to compare against.
+func (s Summary) Trend() (percent int, ok bool) {
+	if s.Average <= 0 {
+		return 0, false
+	}
+	return int((s.Last - s.Average) * 100 / s.Average), true
+}
+
+// DefaultPath returns the history file path, builds.json in the kbflash state
+// directory.
+func DefaultPath() (string, error) {
+	return statefile.Path("builds.json")
+}
+
+// Key identifies a build target of a keyboard.
+func Key(keyboard, target string) string {
+	return keyboard + "/" + target
+}
+
+// New returns an in-memory history that is never saved.
+func New() *History {
+	return &History{Targets: make(map[string][]Run)}
+}
+
+// Load reads the history at path. A missing file is an empty history.
+func Load(path string) (*History, error) {
+	h := &History{path: path, Targets: make(map[string][]Run)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return h, fmt.Errorf("cannot parse build history %s: %w", path, err)
+	}
+	if h.Targets == nil {
+		h.Targets = make(map[string][]Run)
+	}
+	return h, nil
+}
+
+// Record adds a build of key, keeping the most recent runs.
+func (h *History) Record(key string, d time.Duration, at time.Time) {
+	runs := append(h.Targets[key], Run{Time: at, Duration: d})
+	if len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+	h.Targets[key] = runs
+}
+
+// Summary returns the last and average durations of key.
+func (h *History) Summary(key string) (Summary, bool) {
+	runs := h.Targets[key]
+	if len(runs) == 0 {
+		return Summary{}, false
+	}
+
+	s := Summary{Last: runs[len(runs)-1].Duration, Runs: len(runs)}
+	if previous := runs[:len(runs)-1]; len(previous) > 0 {
+		var total time.Duration
+		for _, r := range previous {
+			total += r.Duration
+		}
+		s.Average = total / time.Duration(len(previous))
+	}
+	return s, true
+}
+
+// Save writes the history back to its file, replacing it atomically.
+// In-memory histories are not saved.
+func (h *History) Save() error {
+	return statefile.SaveJSON(h.path, h)
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory_RecordAndSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "builds.json")
+	h, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of missing file failed: %v", err)
+	}
+
+	key := Key("corne", "left")
+	if _, ok := h.Summary(key); ok {
+		t.Fatal("expected no summary before any builds")
+	}
+
+	now := time.Now()
+	h.Record(key, 60*time.Second, now)
+	s, _ := h.Summary(key)
+	if _, ok := s.Trend(); ok {
+		t.Error("expected no trend after a single build")
+	}
+
+	h.Record(key, 40*time.Second, now)
+	h.Record(key, 75*time.Second, now)
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	s, ok := loaded.Summary(key)
+	if !ok || s.Runs != 3 || s.Last != 75*time.Second || s.Average != 50*time.Second {
+		t.Errorf("summary = %+v, want 3 runs, last 75s, average 50s", s)
+	}
+	if trend, ok := s.Trend(); !ok || trend != 50 {
+		t.Errorf("trend = %d (ok %v), want 50", trend, ok)
+	}
+}
+
+func TestHistory_KeepsRecentRuns(t *testing.T) {
+	h, _ := Load(filepath.Join(t.TempDir(), "builds.json"))
+	for i := 1; i <= maxRuns+5; i++ {
+		h.Record("corne/left", time.Duration(i)*time.Second, time.Now())
+	}
+
+	runs := h.Targets["corne/left"]
+	if len(runs) != maxRuns {
+		t.Fatalf("kept %d runs, want %d", len(runs), maxRuns)
+	}
+	if runs[0].Duration != 6*time.Second {
+		t.Errorf("oldest kept run = %s, want 6s", runs[0].Duration)
+	}
+}
@@ -0,0 +1,122 @@
+// Package status writes what kbflash is doing to a small file while it
+// runs, for tmux status lines and bars such as Polybar, Waybar or
+// SketchyBar: status.json for scripts, and beside it status.txt holding one
+// line like "building left 43%" to print as is.
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/statefile"
+)
+
+// State is what kbflash is doing.
+type State string
+
+const (
+	Idle     State = "idle"
+	Building State = "building"
+	Updating State = "updating" // west update
+	Waiting  State = "waiting"  // for Side's bootloader, or for the last one to be unplugged
+	Flashing State = "flashing"
+	Complete State = "complete"
+	Failed   State = "failed"
+)
+
+// Status is the content of the status file.
+type Status struct {
+	State    State     `json:"state"`
+	Keyboard string    `json:"keyboard"`
+	Side     string    `json:"side,omitempty"` // side being built or flashed, "all" for a full build
+	Percent  int       `json:"percent"`        // progress of a build or flash
+	Text     string    `json:"text"`           // one-line summary, as in status.txt
+	PID      int       `json:"pid"`            // of the kbflash process, to spot a stale file
+	Updated  time.Time `json:"updated,omitzero"`
+}
+
+// String summarizes the status in a few words: "idle", "building left
+// 43%", "waiting for right", "flashing left 60%", "complete" or "failed".
+func (s Status) String() string {
+	switch s.State {
+	case Building, Flashing:
+		words := []string{string(s.State)}
+		if s.Side != "" {
+			words = append(words, s.Side)
+		}
+		return strings.Join(append(words, strconv.Itoa(s.Percent)+"%"), " ")
+	case Waiting:
+		if s.Side != "" {
+			return "waiting for " + s.Side
+		}
+	}
+	return string(s.State)
+}
+
+// DefaultPath returns the status file path, status.json in the kbflash state
+// directory.
+func DefaultPath() (string, error) {
+	return statefile.Path("status.json")
+}
+
+// File is a status file and the text file beside it. A nil File writes
+// nothing, so callers need not check whether the status file is on.
+type File struct {
+	path string
+	last Status
+	set  bool
+}
+
+// NewFile returns the status file at path, written on the first Set.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// TextPath returns the path of the one-line text file: the JSON file's path
+// with a .txt extension.
+func (f *File) TextPath() string {
+	return strings.TrimSuffix(f.path, filepath.Ext(f.path)) + ".txt"
+}
+
+// Set writes s, unless it is what was written last. Each file is replaced
+// in one rename, so readers never see half of it.
+func (f *File) Set(s Status) error {
+	if f == nil {
+		return nil
+	}
+	s.Text = s.String()
+	s.PID = os.Getpid()
+	s.Updated = time.Time{}
+	if f.set && s == f.last {
+		return nil
+	}
+	f.last, f.set = s, true
+
+	s.Updated = time.Now().UTC().Truncate(time.Second)
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := statefile.Write(f.path, append(data, '\n')); err != nil {
+		return err
+	}
+	return statefile.Write(f.TextPath(), []byte(s.Text+"\n"))
+}
+
+// Remove deletes the files when kbflash exits, so bars stop showing it.
+func (f *File) Remove() error {
+	if f == nil {
+		return nil
+	}
+	f.set = false
+	for _, path := range []string{f.path, f.TextPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
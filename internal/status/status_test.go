@@ -0,0 +1,78 @@
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatus_String(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{Status{State: Idle}, "idle"},
+		{Status{State: Building, Side: "left", Percent: 43}, "building left 43%"},
+		{Status{State: Building, Percent: 7}, "building 7%"},
+		{Status{State: Waiting, Side: "right"}, "waiting for right"},
+		{Status{State: Flashing, Side: "left", Percent: 60}, "flashing left 60%"},
+		{Status{State: Complete}, "complete"},
+	}
+	for _, tt := range tests {
+		if got := tt.status.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestFile_Set(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "status.json")
+	f := NewFile(path)
+	if err := f.Set(Status{State: Flashing, Keyboard: "corne", Side: "left", Percent: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Status
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("status.json is not JSON: %v\n%s", err, data)
+	}
+	if got.State != Flashing || got.Side != "left" || got.Percent != 60 || got.Keyboard != "corne" {
+		t.Errorf("status.json = %+v", got)
+	}
+	if got.PID != os.Getpid() || got.Updated.IsZero() {
+		t.Errorf("status.json lacks the pid or time: %+v", got)
+	}
+	if text, _ := os.ReadFile(f.TextPath()); string(text) != "flashing left 60%\n" {
+		t.Errorf("status.txt = %q", text)
+	}
+
+	// An unchanged status is not written again
+	os.Remove(path)
+	f.Set(Status{State: Flashing, Keyboard: "corne", Side: "left", Percent: 60})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("an unchanged status was written again")
+	}
+
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 0 {
+		t.Errorf("Remove left %d files", len(entries))
+	}
+}
+
+func TestFile_Nil(t *testing.T) {
+	var f *File
+	if err := f.Set(Status{State: Idle}); err != nil {
+		t.Errorf("Set on a nil File = %v", err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Errorf("Remove on a nil File = %v", err)
+	}
+}
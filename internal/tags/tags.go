@@ -0,0 +1,115 @@
+// Package tags labels firmware builds ("stable", "travel-board") across runs.
+package tags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dhavalsavalia/kbflash/internal/statefile"
+)
+
+// Store holds the tags of each build, persisted as JSON.
+type Store struct {
+	path   string
+	Builds map[string][]string `json:"builds"` // sorted tags by absolute build path
+}
+
+// DefaultPath returns the tags file path, tags.json in the kbflash state
+// directory.
+func DefaultPath() (string, error) {
+	return statefile.Path("tags.json")
+}
+
+// New returns an in-memory store that is never saved.
+func New() *Store {
+	return &Store{Builds: make(map[string][]string)}
+}
+
+// Load reads the store at path. A missing file is an empty store.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, Builds: make(map[string][]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return s, fmt.Errorf("cannot parse tags %s: %w", path, err)
+	}
+	if s.Builds == nil {
+		s.Builds = make(map[string][]string)
+	}
+	return s, nil
+}
+
+// Normalize lower-cases a tag and joins its words with dashes, so
+// "Travel Board" and "travel-board" are the same tag.
+func Normalize(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// key identifies a build by its absolute path.
+func key(build string) string {
+	if abs, err := filepath.Abs(build); err == nil {
+		return abs
+	}
+	return build
+}
+
+// For returns the tags of the build at path, sorted.
+func (s *Store) For(build string) []string {
+	return s.Builds[key(build)]
+}
+
+// Has reports whether the build at path has tag.
+func (s *Store) Has(build, tag string) bool {
+	return slices.Contains(s.For(build), tag)
+}
+
+// Toggle adds tag to the build at path, or removes it if already there,
+// reporting whether the build now has the tag.
+func (s *Store) Toggle(build, tag string) bool {
+	k := key(build)
+	tags := s.Builds[k]
+	if i := slices.Index(tags, tag); i >= 0 {
+		tags = slices.Delete(tags, i, i+1)
+		if len(tags) == 0 {
+			delete(s.Builds, k)
+		} else {
+			s.Builds[k] = tags
+		}
+		return false
+	}
+	tags = append(tags, tag)
+	sort.Strings(tags)
+	s.Builds[k] = tags
+	return true
+}
+
+// All returns every tag used by the builds at paths, sorted.
+func (s *Store) All(builds []string) []string {
+	var all []string
+	for _, build := range builds {
+		for _, tag := range s.For(build) {
+			if !slices.Contains(all, tag) {
+				all = append(all, tag)
+			}
+		}
+	}
+	sort.Strings(all)
+	return all
+}
+
+// Save writes the store back to its file, replacing it atomically.
+// In-memory stores are not saved.
+func (s *Store) Save() error {
+	return statefile.SaveJSON(s.path, s)
+}
@@ -0,0 +1,69 @@
+package tags
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStore_ToggleAndSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "tags.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load of missing file failed: %v", err)
+	}
+
+	build := filepath.Join(t.TempDir(), "firmware", "20250102")
+	if !s.Toggle(build, "stable") || !s.Toggle(build, "experiment") {
+		t.Fatal("expected tags to be added")
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := loaded.For(build); !slices.Equal(got, []string{"experiment", "stable"}) {
+		t.Errorf("For = %v, want [experiment stable]", got)
+	}
+	if !loaded.Has(build, "stable") {
+		t.Error("expected the build to have the stable tag")
+	}
+
+	if loaded.Toggle(build, "stable") {
+		t.Error("toggling an existing tag should remove it")
+	}
+	if loaded.Toggle(build, "experiment"); len(loaded.Builds) != 0 {
+		t.Errorf("builds without tags should be dropped, got %v", loaded.Builds)
+	}
+}
+
+func TestStore_All(t *testing.T) {
+	s := New()
+	s.Toggle("a", "travel-board")
+	s.Toggle("a", "stable")
+	s.Toggle("b", "stable")
+	s.Toggle("c", "experiment")
+
+	if got := s.All([]string{"a", "b"}); !slices.Equal(got, []string{"stable", "travel-board"}) {
+		t.Errorf("All = %v, want [stable travel-board]", got)
+	}
+	if err := s.Save(); err != nil {
+		t.Errorf("in-memory Save should be a no-op, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"stable":         "stable",
+		" Travel  Board": "travel-board",
+		"":               "",
+	}
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
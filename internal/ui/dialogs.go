@@ -1,9 +1,12 @@
 package ui
 
 import (
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
 )
 
 // DialogOption represents a dialog button
@@ -16,31 +19,71 @@ const (
 
 // ConfirmDialog renders a confirmation dialog
 type ConfirmDialog struct {
-	title    string
-	message  []string
-	selected DialogOption
-	width    int
-	height   int
+	title        string
+	message      []string
+	selected     DialogOption
+	confirmLabel string
+	hotkey       string   // confirms directly when pressed
+	choices      []string // keys that each confirm a choice of their own
+	chosen       string
+	width        int
+	height       int
 }
 
 // NewConfirmDialog creates a new confirmation dialog
 func NewConfirmDialog(title string, message []string) *ConfirmDialog {
 	return &ConfirmDialog{
-		title:    title,
-		message:  message,
-		selected: DialogCancel, // Default to cancel for safety
+		title:        title,
+		message:      message,
+		selected:     DialogCancel, // Default to cancel for safety
+		confirmLabel: "Yes, proceed",
 	}
 }
 
+// SetConfirm sets the confirm button label and a key that confirms directly
+func (d *ConfirmDialog) SetConfirm(label, hotkey string) {
+	d.confirmLabel = label
+	d.hotkey = hotkey
+}
+
+// Hotkey returns the key that confirms directly, or "" if there is none
+func (d *ConfirmDialog) Hotkey() string {
+	return d.hotkey
+}
+
+// SetChoices replaces the confirm button with keys that each confirm a
+// choice of their own, listed in the message
+func (d *ConfirmDialog) SetChoices(keys []string) {
+	d.choices = keys
+}
+
+// Choose confirms the choice of key, reporting whether key is one
+func (d *ConfirmDialog) Choose(key string) bool {
+	if !slices.Contains(d.choices, key) {
+		return false
+	}
+	d.chosen = key
+	return true
+}
+
+// Chosen returns the key that confirmed the dialog, or "" if it was not
+// confirmed by a choice
+func (d *ConfirmDialog) Chosen() string {
+	return d.chosen
+}
+
 // SetSize sets dialog dimensions
 func (d *ConfirmDialog) SetSize(width, height int) {
 	d.width = width
 	d.height = height
 }
 
-// MoveLeft moves selection left (to confirm)
+// MoveLeft moves selection left (to confirm), unless the dialog is
+// confirmed by choices
 func (d *ConfirmDialog) MoveLeft() {
-	d.selected = DialogConfirm
+	if len(d.choices) == 0 {
+		d.selected = DialogConfirm
+	}
 }
 
 // MoveRight moves selection right (to cancel)
@@ -76,11 +119,14 @@ func (d *ConfirmDialog) View() string {
 		cancelStyle = cancelStyle.Background(ColorPurple).Foreground(lipgloss.Color("0"))
 	}
 
-	buttons := lipgloss.JoinHorizontal(lipgloss.Center,
-		confirmStyle.Render("Yes, proceed"),
-		"  ",
-		cancelStyle.Render("Cancel"),
-	)
+	buttons := cancelStyle.Render("Cancel")
+	if len(d.choices) == 0 {
+		buttons = lipgloss.JoinHorizontal(lipgloss.Center,
+			confirmStyle.Render(d.confirmLabel),
+			"  ",
+			buttons,
+		)
+	}
 	lines = append(lines, buttons)
 
 	content := strings.Join(lines, "\n")
@@ -134,11 +180,195 @@ func FactoryResetDialog() *ConfirmDialog {
 	})
 }
 
+// CommitPushDialog creates the commit & push confirmation dialog
+func CommitPushDialog(changes int) *ConfirmDialog {
+	return NewConfirmDialog("COMMIT & PUSH", []string{
+		"This will:",
+		"  Stage " + formatInt(changes) + " changed file(s)",
+		"  Commit as \"Update keymap\"",
+		"  Push to the upstream branch",
+	})
+}
+
+// CleanupDialog creates the old build cleanup confirmation dialog
+func CleanupDialog(builds int, size int64, days int) *ConfirmDialog {
+	return NewConfirmDialog("CLEAN UP BUILDS", []string{
+		"This will delete:",
+		"  " + formatInt(builds) + " build(s) older than " + formatInt(days) + " days",
+		"  " + firmware.FormatSize(size) + " from the firmware directory",
+	})
+}
+
+// CleanBuildDialog creates the build files clean confirmation dialog.
+// Cleaning all targets in Docker mode also drops the container and caches.
+func CleanBuildDialog(target string, docker bool) *ConfirmDialog {
+	message := []string{"This will delete:"}
+	if target == "all" {
+		message = append(message, "  Every target's build directory")
+		if docker {
+			message = append(message, "  The build container and named", "  volumes such as a ccache")
+		}
+	} else {
+		message = append(message, "  The build directory of "+target)
+	}
+	message = append(message, "", "The next build starts from scratch.")
+	return NewConfirmDialog("CLEAN BUILD FILES", message)
+}
+
+// PullDialog creates the pre-build git pull confirmation dialog
+func PullDialog() *ConfirmDialog {
+	return NewConfirmDialog("PULL ZMK-CONFIG", []string{
+		"Run git pull --ff-only in the",
+		"working directory, then build?",
+		"",
+		"Cancel aborts the build.",
+	})
+}
+
+// PullFailedDialog offers to retry a Docker image pull that failed or timed out
+func PullFailedDialog(image string, timedOut bool) *ConfirmDialog {
+	reason := "The pull of " + image + " failed."
+	if timedOut {
+		reason = "The pull of " + image + " timed out."
+	}
+	message := []string{
+		reason,
+		"",
+		"Layers already pulled are kept,",
+		"so a retry resumes the pull and",
+		"then carries on with the build.",
+	}
+	if timedOut {
+		message = append(message, "", "On a slow connection, raise", "build.docker.pull_timeout.")
+	}
+	d := NewConfirmDialog("IMAGE PULL FAILED", message)
+	d.SetConfirm("Retry (r)", "r")
+	return d
+}
+
+// DeviceRemovedDialog offers a retry after the device vanished mid-flash
+func DeviceRemovedDialog(target string) *ConfirmDialog {
+	d := NewConfirmDialog("DEVICE REMOVED", []string{
+		"The volume disappeared while",
+		"flashing " + target + ":",
+		"  Bootloader rebooted early, or",
+		"  the cable was disconnected",
+		"",
+		"Re-enter the bootloader and",
+		"retry.",
+	})
+	d.SetConfirm("Retry (r)", "r")
+	return d
+}
+
+// ConnectedDialog offers to flash a bootloader that was connected while
+// nothing was running
+func ConnectedDialog(device, build, side string) *ConfirmDialog {
+	d := NewConfirmDialog("BOOTLOADER CONNECTED", []string{
+		device + " connected.",
+		"",
+		"Flash " + build,
+		"to " + side + "?",
+	})
+	d.SetConfirm("Flash (f)", "f")
+	return d
+}
+
+// ConnectedSideDialog offers to flash a bootloader that was connected while
+// nothing was running and does not say which side it is, one key per side
+func ConnectedSideDialog(device, build string, sides []string) *ConfirmDialog {
+	message := []string{
+		device + " connected, but the",
+		"bootloader does not say which",
+		"side it is.",
+		"",
+		"Flash " + build + " to:",
+	}
+	keys := make([]string, len(sides))
+	for i, side := range sides {
+		keys[i] = strconv.Itoa(i + 1)
+		message = append(message, "  "+keys[i]+"  "+side)
+	}
+	d := NewConfirmDialog("BOOTLOADER CONNECTED", message)
+	d.SetChoices(keys)
+	return d
+}
+
+// MissingSidesDialog offers to flash only the sides a build has files for
+func MissingSidesDialog(build string, missing, available []string) *ConfirmDialog {
+	d := NewConfirmDialog("MISSING FIRMWARE", []string{
+		build + " has no file for:",
+		"  " + strings.Join(missing, ", "),
+		"",
+		"Flash " + strings.Join(available, ", ") + " only?",
+	})
+	d.SetConfirm("Flash "+strings.Join(available, ", "), "")
+	return d
+}
+
+// AlreadyFlashedDialog asks before flashing firmware identical to what the
+// flash history says is already on the device
+func AlreadyFlashedDialog(where string) *ConfirmDialog {
+	d := NewConfirmDialog("ALREADY FLASHED", []string{
+		"This exact firmware is already",
+		"on " + where + ".",
+		"",
+		"Flash anyway?",
+	})
+	d.SetConfirm("Flash anyway", "")
+	return d
+}
+
+// RestoreDialog asks to flash the known good firmware, one line per side
+func RestoreDialog(sides []string) *ConfirmDialog {
+	lines := []string{"Flash the known good firmware?", ""}
+	for _, side := range sides {
+		lines = append(lines, "  "+side)
+	}
+	d := NewConfirmDialog("RESTORE KNOWN GOOD", lines)
+	d.SetConfirm("Restore", "")
+	return d
+}
+
+// ResumeDialog offers to finish a flash sequence an earlier run left behind
+func ResumeDialog(build string, done []string, next string) *ConfirmDialog {
+	d := NewConfirmDialog("RESUME FLASH", []string{
+		"kbflash exited while flashing",
+		build + ":",
+		"  Done: " + strings.Join(done, ", "),
+		"",
+		"Resume with " + next + "?",
+	})
+	d.SetConfirm("Resume", "")
+	return d
+}
+
+// KeymapEditedDialog offers to rebuild the targets built from a keymap that
+// was just edited
+func KeymapEditedDialog(keymap string, targets []string) *ConfirmDialog {
+	d := NewConfirmDialog("KEYMAP CHANGED", []string{
+		keymap + " was saved.",
+		"",
+		"Rebuild " + strings.Join(targets, ", ") + "?",
+	})
+	d.SetConfirm("Build (b)", "b")
+	return d
+}
+
 // BuildMenuDialog renders the build target selection menu
 type BuildMenuDialog struct {
 	width   int
 	height  int
 	targets []string // configured build targets (sides)
+
+	// ZMK Studio toggle, shown when the builder supports it
+	studioAvailable bool
+	studio          bool
+
+	durations map[string]string // recent build times by target, "all" included
+
+	// Targets pick what to clean instead of what to build
+	cleaning bool
 }
 
 // NewBuildMenuDialog creates a new build menu dialog
@@ -154,24 +384,79 @@ func (d *BuildMenuDialog) SetSize(width, height int) {
 	d.height = height
 }
 
+// EnableStudio shows the Studio toggle with its initial state
+func (d *BuildMenuDialog) EnableStudio(on bool) {
+	d.studioAvailable = true
+	d.studio = on
+}
+
+// SetStudio updates the Studio toggle state
+func (d *BuildMenuDialog) SetStudio(on bool) {
+	d.studio = on
+}
+
+// SetCleaning switches the menu between building and cleaning targets
+func (d *BuildMenuDialog) SetCleaning(on bool) {
+	d.cleaning = on
+}
+
+// Cleaning reports whether the targets pick what to clean
+func (d *BuildMenuDialog) Cleaning() bool {
+	return d.cleaning
+}
+
+// SetDurations sets the recent build times shown next to each target
+func (d *BuildMenuDialog) SetDurations(durations map[string]string) {
+	d.durations = durations
+}
+
+// targetLine renders a menu entry with its recent build time
+func (d *BuildMenuDialog) targetLine(key, label, target string) string {
+	line := "  " + KeyHintStyle.Render("["+key+"]") + " " + label
+	if duration, ok := d.durations[target]; ok && !d.cleaning {
+		line += "  " + DimStyle.Render(duration)
+	}
+	return line
+}
+
 // View renders the build menu
 func (d *BuildMenuDialog) View() string {
 	var lines []string
 
 	title := AccentStyle.Render("BUILD FIRMWARE")
+	if d.cleaning {
+		title = AccentStyle.Render("CLEAN BUILD FILES")
+	}
 	lines = append(lines, title)
 	lines = append(lines, "")
 
-	// Build options based on configured targets
-	if len(d.targets) > 1 {
-		lines = append(lines, "  "+KeyHintStyle.Render("[a]")+" All targets")
+	// Build options based on configured targets; cleaning all targets also
+	// clears shared caches, so it is offered for a single one too
+	if len(d.targets) > 1 || d.cleaning {
+		lines = append(lines, d.targetLine("a", "All targets", "all"))
 	}
 
 	for i, target := range d.targets {
 		key := string(rune('1' + i))
 		if i < 9 {
-			lines = append(lines, "  "+KeyHintStyle.Render("["+key+"]")+" "+target)
+			lines = append(lines, d.targetLine(key, target, target))
+		}
+	}
+
+	if d.studioAvailable && !d.cleaning {
+		state := DimStyle.Render("off")
+		if d.studio {
+			state = SuccessStyle.Render("on")
 		}
+		lines = append(lines, "")
+		lines = append(lines, "  "+KeyHintStyle.Render("[s]")+" ZMK Studio: "+state)
+	}
+
+	if !d.cleaning {
+		if !d.studioAvailable {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "  "+KeyHintStyle.Render("[c]")+" Clean build files...")
 	}
 
 	lines = append(lines, "")
@@ -180,6 +465,9 @@ func (d *BuildMenuDialog) View() string {
 	content := strings.Join(lines, "\n")
 
 	boxWidth := 28
+	if len(d.durations) > 0 {
+		boxWidth = 44
+	}
 	if boxWidth > d.width-10 {
 		boxWidth = d.width - 10
 	}
@@ -219,3 +507,120 @@ func (d *BuildMenuDialog) View() string {
 func (d *BuildMenuDialog) Targets() []string {
 	return d.targets
 }
+
+// InputDialog asks for one line of text
+type InputDialog struct {
+	width  int
+	height int
+	title  string
+	prompt string
+	hint   string // key hints below the input
+	text   []rune
+}
+
+// NewInputDialog creates an empty text prompt
+func NewInputDialog(title, prompt, hint string) *InputDialog {
+	return &InputDialog{title: title, prompt: prompt, hint: hint}
+}
+
+// NoteDialog asks for a one-line description of a finished build
+func NoteDialog(build string) *InputDialog {
+	return NewInputDialog("BUILD NOTE", "Describe the "+build+" build:", "[enter] Save  [esc] Skip")
+}
+
+// TagDialog asks for a tag to add to or remove from a build
+func TagDialog(build string, tags []string) *InputDialog {
+	prompt := "Tag the " + build + " build:"
+	if len(tags) > 0 {
+		prompt = "Tag the " + build + " build (" + strings.Join(tags, ", ") + "):"
+	}
+	return NewInputDialog("TAG BUILD", prompt, "[enter] Add / remove  [esc] Cancel")
+}
+
+// SetSize sets dialog dimensions
+func (d *InputDialog) SetSize(width, height int) {
+	d.width = width
+	d.height = height
+}
+
+// Insert appends typed or pasted text, dropping line breaks
+func (d *InputDialog) Insert(runes []rune) {
+	for _, r := range runes {
+		if r == '\n' || r == '\r' {
+			r = ' '
+		}
+		d.text = append(d.text, r)
+	}
+}
+
+// Backspace deletes the last character
+func (d *InputDialog) Backspace() {
+	if len(d.text) > 0 {
+		d.text = d.text[:len(d.text)-1]
+	}
+}
+
+// Clear deletes the whole input
+func (d *InputDialog) Clear() {
+	d.text = nil
+}
+
+// Text returns the input without surrounding spaces
+func (d *InputDialog) Text() string {
+	return strings.TrimSpace(string(d.text))
+}
+
+// View renders the prompt
+func (d *InputDialog) View() string {
+	boxWidth := 56
+	if boxWidth > d.width-10 {
+		boxWidth = d.width - 10
+	}
+
+	// Keep the end of a long note, where the cursor is, in view
+	text := string(d.text)
+	if room := boxWidth - 8; room > 0 && len(d.text) > room {
+		text = "…" + string(d.text[len(d.text)-room+1:])
+	}
+
+	var lines []string
+	lines = append(lines, AccentStyle.Render(d.title))
+	lines = append(lines, "")
+	lines = append(lines, d.prompt)
+	lines = append(lines, "")
+	lines = append(lines, "> "+text+AccentStyle.Render("█"))
+	lines = append(lines, "")
+	lines = append(lines, DimStyle.Render(d.hint))
+
+	content := strings.Join(lines, "\n")
+
+	boxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorPurple).
+		Padding(1, 2).
+		Width(boxWidth)
+
+	box := boxStyle.Render(content)
+
+	boxHeight := lipgloss.Height(box)
+	topPadding := (d.height - boxHeight) / 2
+	if topPadding < 0 {
+		topPadding = 0
+	}
+
+	leftPadding := (d.width - boxWidth - 4) / 2
+	if leftPadding < 0 {
+		leftPadding = 0
+	}
+
+	var result []string
+	for i := 0; i < topPadding; i++ {
+		result = append(result, "")
+	}
+
+	for _, line := range strings.Split(box, "\n") {
+		result = append(result, strings.Repeat(" ", leftPadding)+line)
+	}
+
+	return strings.Join(result, "\n")
+}
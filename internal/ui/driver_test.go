@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/sim"
+)
+
+// driverTimeout bounds every wait, so a stuck state machine fails the test
+// instead of hanging it
+const driverTimeout = 5 * time.Second
+
+// driver runs a Model the way tea.Program does, but on the test goroutine:
+// commands run in the background and their messages are delivered to
+// Update only while the test waits, so tests can read the model between
+// steps without racing it.
+type driver struct {
+	t      *testing.T
+	m      *Model
+	msgs   chan tea.Msg
+	done   chan struct{}
+	quit   bool
+	device *sim.Device
+	flash  *sim.Flasher
+	build  *sim.Builder
+}
+
+// newDriver starts the demo split keyboard with a manual simulated device,
+// seeded with a couple of builds. setup may adjust the config and model
+// before Init.
+func newDriver(t *testing.T, setup func(cfg *config.Config)) *driver {
+	t.Helper()
+	// Keep flash history, build stats and tags out of the real home
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+
+	dir := t.TempDir()
+	cfg := sim.DemoConfig(dir)
+	cfg.Build.WorkingDir = t.TempDir()
+	cfg.Device.PollInterval = config.Duration(5 * time.Millisecond)
+	cfg.Device.IdlePollInterval = config.Duration(5 * time.Millisecond)
+	if err := sim.Seed(dir, cfg.Build.Shield, cfg.Keyboard.Sides); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(cfg)
+	}
+
+	d := &driver{
+		t:      t,
+		msgs:   make(chan tea.Msg, 64),
+		done:   make(chan struct{}),
+		device: sim.NewManualDevice(),
+	}
+	d.flash = sim.NewFlasher(d.device)
+	d.flash.Duration = 10 * time.Millisecond
+	d.build = sim.NewBuilder(dir, cfg.Build.Shield, cfg.Keyboard.Sides)
+	d.build.Steps = 3
+	d.build.StepDelay = time.Millisecond
+	d.m = NewModelWith(cfg, Components{
+		Detector: sim.NewDetector(d.device),
+		Builder:  d.build,
+		Flasher:  d.flash,
+	})
+	t.Cleanup(func() { close(d.done) })
+	return d
+}
+
+// start runs Init and waits for the first scan
+func (d *driver) start() {
+	d.t.Helper()
+	// Init comes first, as in tea.Program
+	d.run(d.m.Init())
+	d.send(tea.WindowSizeMsg{Width: 120, Height: 40})
+	d.waitFor("first scan", func(m *Model) bool {
+		return !m.scanning && len(m.firmwarePanel.builds) > 0
+	})
+}
+
+// run executes cmd in the background, queueing the message it returns
+func (d *driver) run(cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	go func() {
+		msg := cmd()
+		select {
+		case d.msgs <- msg:
+		case <-d.done:
+		}
+	}()
+}
+
+// send delivers msg to the model straight away
+func (d *driver) send(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case nil:
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			d.run(cmd)
+		}
+	case tea.QuitMsg:
+		d.quit = true
+	default:
+		_, cmd := d.m.Update(msg)
+		d.run(cmd)
+	}
+}
+
+// press types keys, one key per string ("f", "enter", "esc")
+func (d *driver) press(keys ...string) {
+	for _, key := range keys {
+		var msg tea.KeyMsg
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		}
+		d.send(msg)
+	}
+}
+
+// waitFor delivers messages until cond holds, failing the test after
+// driverTimeout
+func (d *driver) waitFor(what string, cond func(m *Model) bool) {
+	d.t.Helper()
+	deadline := time.After(driverTimeout)
+	for !cond(d.m) {
+		select {
+		case msg := <-d.msgs:
+			d.send(msg)
+		case <-deadline:
+			d.t.Fatalf("timed out waiting for %s; state %v, log:\n%s", what, d.m.state, d.log())
+		}
+	}
+}
+
+// waitState waits for the model to reach state
+func (d *driver) waitState(state AppState) {
+	d.t.Helper()
+	d.waitFor("state "+strconvState(state), func(m *Model) bool { return m.state == state })
+}
+
+// settle delivers the messages arriving within dur, for checking that
+// something does not happen
+func (d *driver) settle(dur time.Duration) {
+	deadline := time.After(dur)
+	for {
+		select {
+		case msg := <-d.msgs:
+			d.send(msg)
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// log returns the log panel's messages, one per line
+func (d *driver) log() string {
+	var lines []string
+	for _, e := range d.m.logPanel.entries {
+		lines = append(lines, e.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// logged reports whether a log message contains text
+func (d *driver) logged(text string) bool {
+	return strings.Contains(d.log(), text)
+}
+
+// strconvState names an AppState for failure messages
+func strconvState(s AppState) string {
+	names := map[AppState]string{
+		StateIdle:              "idle",
+		StateCheckingDocker:    "checking docker",
+		StateBuilding:          "building",
+		StateUpdating:          "updating",
+		StateWaitingDisconnect: "waiting for disconnect",
+		StateWaitingDevice:     "waiting for device",
+		StateFlashing:          "flashing",
+		StateComplete:          "complete",
+	}
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -12,6 +12,9 @@ type HelpOverlay struct {
 	height   int
 	isSplit  bool
 	hasBuild bool
+	hasGit   bool
+	profiles bool // several keyboard profiles to switch between
+	remote   bool // a remote cache to sync builds with
 }
 
 // NewHelpOverlay creates a new help overlay
@@ -28,6 +31,21 @@ func (h *HelpOverlay) SetSize(width, height int) {
 	h.height = height
 }
 
+// SetHasGit toggles git actions in the keybinding list
+func (h *HelpOverlay) SetHasGit(hasGit bool) {
+	h.hasGit = hasGit
+}
+
+// SetHasProfiles toggles the keyboard switch action in the keybinding list
+func (h *HelpOverlay) SetHasProfiles(profiles bool) {
+	h.profiles = profiles
+}
+
+// SetHasRemote toggles the remote sync action in the keybinding list
+func (h *HelpOverlay) SetHasRemote(remote bool) {
+	h.remote = remote
+}
+
 // View renders the help overlay
 func (h *HelpOverlay) View() string {
 	content := h.buildContent()
@@ -80,8 +98,12 @@ func (h *HelpOverlay) buildContent() string {
 	lines = append(lines, DimStyle.Render(strings.Repeat("─", 40)))
 	lines = append(lines, h.keyLine("↑ / k", "Move up"))
 	lines = append(lines, h.keyLine("↓ / j", "Move down"))
+	lines = append(lines, h.keyLine("5j / 5k", "Move by a count"))
+	lines = append(lines, h.keyLine("gg / G", "First / last build"))
+	lines = append(lines, h.keyLine("^d / ^u", "Half a page down / up"))
 	lines = append(lines, h.keyLine("Tab", "Switch panel"))
 	lines = append(lines, h.keyLine("1 / 2 / 3", "Jump to panel"))
+	lines = append(lines, h.keyLine("z", "Toggle single-panel view"))
 	lines = append(lines, "")
 
 	// Actions section
@@ -90,11 +112,35 @@ func (h *HelpOverlay) buildContent() string {
 	lines = append(lines, h.keyLine("Enter", "Select / Confirm"))
 	if h.hasBuild {
 		lines = append(lines, h.keyLine("b", "Build menu"))
+		lines = append(lines, h.keyLine("w", "Run west update"))
 	}
 	lines = append(lines, h.keyLine("f", "Flash selected firmware"))
+	lines = append(lines, h.keyLine("K", "Mark flashed firmware known good"))
+	lines = append(lines, h.keyLine("R", "Restore known good firmware"))
+	lines = append(lines, h.keyLine("d", "Diff against previous build"))
+	lines = append(lines, h.keyLine("v", "Open keymap preview"))
+	if h.hasBuild {
+		lines = append(lines, h.keyLine("e", "Edit keymap, then rebuild"))
+	}
+	lines = append(lines, h.keyLine("t", "Add / remove a build tag"))
+	lines = append(lines, h.keyLine("T", "Filter builds by tag"))
+	lines = append(lines, h.keyLine("/", "Search builds"))
+	lines = append(lines, h.keyLine("x", "Clean up old builds"))
+	if h.remote {
+		lines = append(lines, h.keyLine("u", "Download builds from the remote cache"))
+	}
+	if h.hasBuild {
+		lines = append(lines, h.keyLine("o", "Show / hide build output"))
+	}
 	if h.isSplit {
 		lines = append(lines, h.keyLine("r", "Factory reset"))
 	}
+	if h.hasGit {
+		lines = append(lines, h.keyLine("g", "Commit & push keymap changes"))
+	}
+	if h.profiles {
+		lines = append(lines, h.keyLine("p", "Switch keyboard"))
+	}
 	lines = append(lines, "")
 
 	// General section
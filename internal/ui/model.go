@@ -1,23 +1,57 @@
 package ui
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dhavalsavalia/kbflash/internal/backup"
+	"github.com/dhavalsavalia/kbflash/internal/components"
 	"github.com/dhavalsavalia/kbflash/internal/config"
 	"github.com/dhavalsavalia/kbflash/internal/device"
 	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/flashlog"
+	"github.com/dhavalsavalia/kbflash/internal/flow"
+	"github.com/dhavalsavalia/kbflash/internal/git"
+	"github.com/dhavalsavalia/kbflash/internal/remote"
+	"github.com/dhavalsavalia/kbflash/internal/report"
+	"github.com/dhavalsavalia/kbflash/internal/session"
+	"github.com/dhavalsavalia/kbflash/internal/stats"
+	"github.com/dhavalsavalia/kbflash/internal/status"
+	"github.com/dhavalsavalia/kbflash/internal/tags"
+	"github.com/dhavalsavalia/kbflash/internal/watch"
 )
 
+// sizeKey identifies a version of a firmware file for the size cache
+type sizeKey struct {
+	path string
+	size int64
+}
+
+// sizeEntry is a cached flash capacity check; ok is false for unknown boards
+type sizeEntry struct {
+	report firmware.SizeReport
+	ok     bool
+}
+
 // AppState represents the application state
 type AppState int
 
 const (
 	StateIdle AppState = iota
 	StateBuilding
+	StateCheckingDocker    // docker info running before a build or west update
+	StateUpdating          // west update running
 	StateWaitingDisconnect // Safety: wait for user to unplug device
 	StateWaitingDevice
 	StateFlashing
@@ -31,6 +65,7 @@ const (
 	DeviceDisconnected DeviceStatus = iota
 	DeviceConnected
 	DeviceWaiting
+	DeviceUnreadable // mounted, but without permission to use it
 )
 
 // Model is the main bubbletea model
@@ -42,6 +77,7 @@ type Model struct {
 	// State
 	state        AppState
 	activePanel  Panel
+	compact      bool // show only the active panel, with a tab bar
 	showHelp     bool
 	showDialog   bool
 	deviceStatus DeviceStatus
@@ -54,37 +90,154 @@ type Model struct {
 
 	// Overlays
 	helpOverlay     *HelpOverlay
+	toasts          *Toasts
 	confirmDialog   *ConfirmDialog
 	buildMenuDialog *BuildMenuDialog
 	showBuildMenu   bool
+	confirmAction   func() (tea.Model, tea.Cmd) // run when confirmDialog is accepted
+	devicePrompt    *ConfirmDialog              // confirmDialog while it offers to flash the connected device
+	inputDialog     *InputDialog                // text prompt, nil when hidden
+	inputAction     func(text string) tea.Cmd   // run with the text when inputDialog is accepted
+	builtDir        string                      // output directory of the finished build, "" if unknown
+	builtPending    bool                        // note and keymap preview wait for the finished build's scan
+	runTarget       string                      // kbflash run: side or "all" to build, then flash; "" outside a run
+	cleaning        bool                        // build files are being removed
 
 	// Config-driven components
 	cfg      *config.Config
+	root     *config.Config // config holding every keyboard profile, nil for one keyboard
 	scanner  *firmware.Scanner
 	detector device.Detector
 	builder  firmware.FirmwareBuilder
-	flasher  *firmware.Flasher
+	flasher  firmware.FirmwareFlasher
+	west     *firmware.WestUpdater
+	matcher  *firmware.SideMatcher
+	studio   bool // build and prefer ZMK Studio-enabled firmware
+
+	// QMK mode: the qmk CLI compiles, waits for the bootloader and flashes
+	qmkFlasher    *firmware.QMKFlasher
+	flashProgress chan firmware.QMKProgress
+	flashResult   chan flashCompleteMsg // delivered once flashProgress closes
+	flashCancel   context.CancelFunc
+
+	// DFU mode: dfu-util waits for each side's bootloader and writes its
+	// image, reporting progress like qmk
+	dfuFlasher *firmware.DFUFlasher
+
+	// Working directory git state (nil when not a repository)
+	gitStatus *git.Status
+
+	// Runs the keymap editor with the TUI suspended, tea.ExecProcess
+	execProcess func(*exec.Cmd, tea.ExecCallback) tea.Cmd
+
+	// Rebuilds when the keymap or its config is saved, nil when off
+	watcher      *watch.Watcher
+	watchCancel  context.CancelFunc
+	watchChanges <-chan []string
+	watchPending []string // changes waiting for the current operation to end
+	watchBuild   bool     // the running build was started by the watcher
 
 	// Detection context and channel
 	detectCtx    context.Context
 	detectCancel context.CancelFunc
 	detectEvents <-chan device.Event
+	pollInterval time.Duration // fast while waiting for the device, slow otherwise
+
+	toastTicking bool // a toastTickMsg is pending to expire toasts
+
+	// Docker availability check, then the build or west update waiting on it
+	dockerCancel context.CancelFunc
+	dockerNext   func() (tea.Model, tea.Cmd)
+
+	// Keymap backup running ahead of a flash, then the flash waiting on it
+	backupCancel context.CancelFunc
+	backupNext   func() (tea.Model, tea.Cmd)
+
+	// Cancels the git pull running ahead of a build
+	gitPullCancel context.CancelFunc
 
 	// Build progress channel
 	buildProgress chan firmware.BuildProgress
 
+	// Docker image pull progress channel, its result once closed, and the
+	// layers pulled so far
+	pullProgress chan firmware.PullProgress
+	pullResult   chan imagePulledMsg
+	pullLayers   string
+
+	// Flash copy progress channel
+	copyProgress chan firmware.FlashProgress
+
+	// Firmware scan in progress: builds stream in before the final sorted list
+	scanning  bool
+	scanFound <-chan firmware.Build
+	scanDone  <-chan scanCompleteMsg
+
+	firmwareUsage int64 // bytes used by the firmware directory
+
+	sizeCache map[sizeKey]sizeEntry // flash capacity checks by firmware file
+
+	buildStats *stats.History // recent build durations per target
+	buildNote  string         // duration and trend of the last build this session
+
+	tags         *tags.Store            // build tags shown and filtered in the firmware panel
+	keymapDrawer *firmware.KeymapDrawer // renders keymap previews after builds, nil when off
+
+	// Remote cache builds are shared through, nil when off
+	remote        *remote.Cache
+	remoteErr     error // why the configured cache cannot be used
+	remoteSyncing bool  // a pull from the cache is running
+
+	// Status file for status bars, nil when off
+	statusFile *status.File
+
+	// Flash sequence saved so an interrupted run can resume
+	session       *session.Session
+	sessionPath   string // "" keeps sessions in memory
+	resumeOffered bool   // checked for an interrupted session after the first scan
+
+	flashLog *flashlog.Log // firmware last flashed to each side
+
+	// Record of the flash sequence, written when it ends if report.enabled
+	flashReport *report.Report
+
 	// Operation state
 	buildPercent   int
+	buildStage     firmware.BuildStage
 	buildTarget    string
+	westProjects   int      // projects updated so far by west update
+	westMessage    string   // latest west update step
+	output         []string // tail of the raw build or west update output
+	showOutput     bool     // show output below the progress view
 	flashPercent   int
-	flashTarget    string // current side being flashed
-	flashIndex     int    // index in sides array
+	flashTarget    string     // current side being flashed
+	flashFlow      *flow.Flow // the flash sequence, nil before the first
+	flowCmds       []tea.Cmd  // commands called for by the sequence's events
+	flashStep      flow.Event // the file being flashed
+	resetPath      string     // reset firmware of the last sequence if it was a factory reset
+	rebootSeq      int        // ignores reboot timeouts from earlier flashes
+	pendingKeys    string     // count and/or g typed in the firmware list, awaiting a motion
+	pendingSeq     int        // ignores key timeouts for earlier pending keys
 	startTime      time.Time
+	buildAverage   time.Duration // average time of earlier builds of buildTarget, 0 if none
 	completedSteps []string
 }
 
+// Components overrides the hardware and build tooling a Model talks to.
+// Nil fields fall back to the real implementations for the config.
+type Components struct {
+	Detector device.Detector
+	Builder  firmware.FirmwareBuilder
+	Flasher  firmware.FirmwareFlasher
+}
+
 // NewModel creates a new model from config
 func NewModel(cfg *config.Config) *Model {
+	return NewModelWith(cfg, Components{})
+}
+
+// NewModelWith creates a new model from config using the given components
+func NewModelWith(cfg *config.Config, c Components) *Model {
 	isSplit := cfg.Keyboard.Type == "split"
 	sides := cfg.Keyboard.Sides
 	if len(sides) == 0 {
@@ -94,55 +247,281 @@ func NewModel(cfg *config.Config) *Model {
 			sides = []string{"main"}
 		}
 	}
+	deviceName := cfg.Device.Name
+	if cfg.Flash.Mode == "dfu" {
+		deviceName = "a DFU bootloader"
+	}
 
 	m := &Model{
 		cfg:             cfg,
 		state:           StateIdle,
 		activePanel:     PanelFirmware,
+		compact:         cfg.UI.Compact,
 		deviceStatus:    DeviceDisconnected,
 		firmwarePanel:   NewFirmwarePanel(),
-		statusPanel:     NewStatusPanel(isSplit, cfg.Build.Enabled, cfg.Device.Name, sides),
+		statusPanel:     NewStatusPanel(isSplit, cfg.Build.Enabled, deviceName, sides),
 		logPanel:        NewLogPanel(),
+		toasts:          NewToasts(),
 		helpOverlay:     NewHelpOverlay(isSplit, cfg.Build.Enabled),
 		buildMenuDialog: NewBuildMenuDialog(sides),
-		scanner:         firmware.NewScanner(cfg.Build.FirmwareDir, cfg.Build.FilePattern),
-		detector:        device.New(),
-		flasher:         firmware.NewFlasher(),
+		execProcess:     tea.ExecProcess,
+		scanner:         components.NewScanner(cfg),
+		detector:        components.NewDetector(cfg),
+		flasher:         components.NewFlasher(cfg),
 	}
 
 	if cfg.Build.Enabled {
-		if cfg.Build.Mode == "docker" {
-			m.builder = firmware.NewDockerBuilder(
-				cfg.Build.Image,
-				cfg.Build.Board,
-				cfg.Build.Shield,
-				cfg.Build.WorkingDir,
-				cfg.Build.FirmwareDir,
-			)
-		} else {
-			m.builder = firmware.NewBuilder(cfg.Build.Command, cfg.Build.Args, cfg.Build.WorkingDir)
+		m.builder = components.NewBuilder(cfg)
+		m.west = firmware.NewWestUpdater(cfg.Build.Mode, cfg.Build.Docker.Image, cfg.Build.WorkingDir)
+		m.west.SetUser(firmware.ResolveDockerUser(cfg.Build.Docker.User))
+	}
+
+	matcher, err := firmware.NewSideMatcher(cfg.Keyboard.SidePatterns)
+	if err != nil {
+		m.logPanel.Add(LogError, "Ignoring side patterns: "+err.Error())
+		matcher, _ = firmware.NewSideMatcher(nil)
+	}
+	m.matcher = matcher
+	m.studio = cfg.Build.Studio
+	m.matcher.SetStudio(m.studio)
+	if cfg.Build.Enabled && cfg.Build.Mode == "docker" {
+		m.buildMenuDialog.EnableStudio(m.studio)
+	}
+
+	switch cfg.Flash.Mode {
+	case "qmk":
+		m.qmkFlasher = firmware.NewQMKFlasher(cfg.Flash.QMKKeyboard, cfg.Flash.QMKKeymap, cfg.Build.WorkingDir)
+	case "dfu":
+		m.dfuFlasher = components.NewDFUFlasher(cfg)
+	}
+
+	if c.Detector != nil {
+		m.detector = c.Detector
+	}
+
+	// Injected builders (the simulator) keep their timings out of the history file
+	m.buildStats = stats.New()
+	if cfg.Build.Enabled && c.Builder == nil {
+		if path, err := stats.DefaultPath(); err == nil {
+			history, err := stats.Load(path)
+			if err != nil {
+				m.logPanel.Add(LogWarning, "Ignoring build history: "+err.Error())
+			}
+			m.buildStats = history
+		}
+	}
+	if c.Builder != nil {
+		m.builder = c.Builder
+		m.west = nil // west update only applies to the real build tooling
+	}
+	if c.Flasher != nil {
+		m.flasher = c.Flasher
+	} else if path, err := session.DefaultPath(); err == nil {
+		// Injected flashers (the simulator) have nothing to resume
+		m.sessionPath = path
+	}
+	m.flashLog = flashlog.New()
+	if c.Flasher == nil {
+		if path, err := flashlog.DefaultPath(); err == nil {
+			flashes, err := flashlog.Load(path)
+			if err != nil {
+				m.logPanel.Add(LogWarning, "Ignoring flash history: "+err.Error())
+			}
+			m.flashLog = flashes
+		}
+	}
+
+	if w := cfg.Build.Watch; cfg.Build.Enabled && w.Enabled {
+		m.watcher = watch.New(cfg.Build.WorkingDir, w.Patterns, time.Duration(w.Debounce))
+	}
+
+	if kd := cfg.Build.KeymapDrawer; cfg.Build.Enabled && kd.Enabled {
+		m.keymapDrawer = firmware.NewKeymapDrawer(kd.Mode, kd.Image, cfg.Build.WorkingDir, kd.Keymap)
+		m.keymapDrawer.SetConfig(kd.Config)
+		m.keymapDrawer.SetUser(firmware.ResolveDockerUser(cfg.Build.Docker.User))
+	}
+
+	// Simulated builds live in a temporary directory, so their tags are not kept
+	m.tags = tags.New()
+	if c.Flasher == nil {
+		if path, err := tags.DefaultPath(); err == nil {
+			store, err := tags.Load(path)
+			if err != nil {
+				m.logPanel.Add(LogWarning, "Ignoring build tags: "+err.Error())
+			}
+			m.tags = store
+		}
+	}
+	m.firmwarePanel.SetTags(m.tags.For)
+	m.firmwarePanel.SetStaleDays(cfg.Build.StaleDays)
+
+	if cfg.Build.Remote.URL != "" {
+		m.remote, m.remoteErr = remote.New(cfg.Build.Remote.URL, cfg.Build.Remote.Dir)
+		m.helpOverlay.SetHasRemote(m.remote != nil)
+	}
+
+	if cfg.Status.Enabled {
+		path := cfg.Status.Path
+		if path == "" {
+			path, _ = status.DefaultPath()
+		}
+		if path != "" {
+			m.statusFile = status.NewFile(path)
 		}
 	}
 
 	return m
 }
 
+// SetProfiles enables switching between root's keyboard profiles
+func (m *Model) SetProfiles(root *config.Config) {
+	if len(root.Profiles) > 1 {
+		m.root = root
+	}
+	m.helpOverlay.SetHasProfiles(m.root != nil)
+}
+
+// SetRun builds target (a side or "all") as soon as the model starts and
+// flashes the finished build to it, for kbflash run
+func (m *Model) SetRun(target string) {
+	m.runTarget = target
+	m.resumeOffered = true // the run decides what to flash
+}
+
+// runSides returns the sides a kbflash run flashes
+func (m *Model) runSides() []string {
+	if m.runTarget != "all" {
+		return []string{m.runTarget}
+	}
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	return sides
+}
+
+// runStep returns the kbflash run step in progress, the build being step 1
+// and each side's flash one more, or 0 outside a run
+func (m *Model) runStep() int {
+	if m.runTarget == "" {
+		return 0
+	}
+	switch m.state {
+	case StateCheckingDocker, StateBuilding:
+		return 1
+	case StateWaitingDisconnect, StateWaitingDevice, StateFlashing:
+		return 2 + m.flashFlow.Step()
+	}
+	return 0
+}
+
+// flashRun flashes the build a kbflash run just made to the run's sides
+func (m *Model) flashRun(build *firmware.Build) (tea.Model, tea.Cmd) {
+	sides := m.runSides()
+	if build == nil || !m.firmwarePanel.Select(build.Path) {
+		m.notifyFailure("Cannot find the new build to flash")
+		return m, nil
+	}
+	if missing := m.matcher.Missing(sides, build.Files); len(missing) > 0 {
+		m.notifyFailure("No firmware file for " + strings.Join(missing, ", ") + " in " + build.Title())
+		return m, nil
+	}
+	return m.confirmReflash(sides, func() (tea.Model, tea.Cmd) {
+		return m.awaitFirstSide(sides)
+	})
+}
+
 // Init initializes the model
 func (m *Model) Init() tea.Cmd {
 	m.logPanel.Add(LogInfo, "Started - "+m.cfg.Keyboard.Name)
+	for _, w := range m.cfg.Warnings {
+		m.logPanel.Add(LogWarning, w)
+	}
 
-	// Scan for firmware
-	ctx := context.Background()
-	builds, err := m.scanner.Scan(ctx)
-	if err != nil {
-		m.logPanel.Add(LogError, "Scan failed: "+err.Error())
-	} else {
-		m.firmwarePanel.SetBuilds(builds)
-		m.logPanel.Add(LogInfo, "Found "+formatInt(len(builds))+" build(s)")
+	m.refreshGitStatus()
+
+	// Scan in the background so large or network firmware dirs don't
+	// delay the first frame
+	scan := m.startScan()
+	if m.remoteErr != nil {
+		m.logPanel.Add(LogWarning, "Remote cache off: "+m.remoteErr.Error())
+	}
+	scan = tea.Batch(scan, m.syncRemote())
+	if m.runTarget != "" {
+		_, build := m.startBuild(m.runTarget)
+		scan = tea.Batch(scan, build)
+	}
+	if m.watcher != nil {
+		scan = tea.Batch(scan, m.startWatch())
+	}
+
+	// qmk mode may run without a bootloader volume to watch
+	if m.cfg.Device.Name == "" {
+		return scan
 	}
 
 	// Start device detection
-	return m.startDetection()
+	m.pollInterval = time.Duration(m.cfg.Device.IdlePollInterval)
+	return tea.Batch(scan, m.startDetection())
+}
+
+// startScan scans the firmware sources in the background, streaming each
+// build into the firmware panel as it is found
+func (m *Model) startScan() tea.Cmd {
+	if m.scanning {
+		return nil
+	}
+	m.scanning = true
+	m.firmwarePanel.SetLoading(true)
+
+	found := make(chan firmware.Build)
+	done := make(chan scanCompleteMsg, 1)
+	m.scanFound = found
+	m.scanDone = done
+
+	scanner := m.scanner
+	dir := m.cfg.Build.FirmwareDir
+	go func() {
+		ctx := context.Background()
+		builds, err := scanner.ScanEach(ctx, func(b firmware.Build) {
+			found <- b
+		})
+		var usage int64
+		if err == nil {
+			usage, _ = firmware.DirSize(ctx, dir)
+		}
+		done <- scanCompleteMsg{builds: builds, usage: usage, err: err}
+		close(found)
+	}()
+
+	return tea.Batch(
+		m.listenForScan(),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// listenForScan waits for the next scanned build, then the scan result
+func (m *Model) listenForScan() tea.Cmd {
+	found, done := m.scanFound, m.scanDone
+	return func() tea.Msg {
+		if build, ok := <-found; ok {
+			return scanBuildMsg{build: build}
+		}
+		return <-done
+	}
+}
+
+// refreshGitStatus re-reads the working directory's git state
+func (m *Model) refreshGitStatus() {
+	st, err := git.GetStatus(context.Background(), m.cfg.Build.WorkingDir)
+	if err != nil {
+		m.gitStatus = nil
+	} else {
+		m.gitStatus = &st
+	}
+	m.helpOverlay.SetHasGit(m.gitStatus != nil)
 }
 
 // startDetection starts the device detection loop
@@ -153,17 +532,73 @@ func (m *Model) startDetection() tea.Cmd {
 	}
 
 	m.detectCtx, m.detectCancel = context.WithCancel(context.Background())
-	pollInterval := time.Duration(m.cfg.Device.PollInterval)
-	m.detectEvents = m.detector.Detect(m.detectCtx, m.cfg.Device.Name, pollInterval)
+	m.detectEvents = m.detector.Detect(m.detectCtx, m.cfg.Device.Name, m.pollInterval)
 
 	return m.listenForNextEvent()
 }
 
+// syncPollInterval restarts detection when the state calls for a different
+// poll interval: fast while waiting for the device, slow otherwise.
+func (m *Model) syncPollInterval() tea.Cmd {
+	if m.detectCancel == nil {
+		return nil
+	}
+
+	interval := time.Duration(m.cfg.Device.IdlePollInterval)
+	if m.state == StateWaitingDisconnect || m.state == StateWaitingDevice {
+		interval = time.Duration(m.cfg.Device.PollInterval)
+	}
+	if interval == m.pollInterval {
+		return nil
+	}
+
+	m.pollInterval = interval
+	return m.startDetection()
+}
+
 // deviceEventMsg wraps device events
 type deviceEventMsg struct {
 	event device.Event
 }
 
+// watchChangedMsg delivers files the watcher saw change
+type watchChangedMsg struct {
+	files []string
+}
+
+// keymapEditedMsg reports the editor opened on the keymap exited, with the
+// keymap as it was before
+type keymapEditedMsg struct {
+	path   string
+	before []byte
+	err    error
+}
+
+// scanBuildMsg delivers a build found by an in-progress scan
+type scanBuildMsg struct {
+	build firmware.Build
+}
+
+// scanCompleteMsg carries the final sorted scan result
+type scanCompleteMsg struct {
+	builds []firmware.Build
+	usage  int64
+	err    error
+}
+
+// cleanDoneMsg reports build files cleaned for target
+type cleanDoneMsg struct {
+	target string
+	err    error
+}
+
+// cleanupDoneMsg for old build cleanup completion
+type cleanupDoneMsg struct {
+	removed int
+	freed   int64
+	err     error
+}
+
 // tickMsg for spinner animation
 type tickMsg struct{}
 
@@ -177,13 +612,190 @@ type buildCompleteMsg struct {
 	result firmware.BuildResult
 }
 
+// pullProgressMsg for Docker image pull progress updates
+type pullProgressMsg struct {
+	progress firmware.PullProgress
+}
+
+// imagePulledMsg reports that the Docker image is ready to build target
+type imagePulledMsg struct {
+	target string
+	err    error
+}
+
+// keymapDrawnMsg reports a rendered keymap preview
+type keymapDrawnMsg struct {
+	path string
+	err  error
+}
+
+// remoteSyncedMsg reports the builds downloaded from the remote cache
+type remoteSyncedMsg struct {
+	names []string
+	err   error
+}
+
+// remotePushedMsg reports a build uploaded to the remote cache
+type remotePushedMsg struct {
+	title string
+	err   error
+}
+
+// noteSavedMsg reports a build note written to its notes file
+type noteSavedMsg struct {
+	err error
+}
+
+// copyProgressMsg for flash copy progress updates
+type copyProgressMsg struct {
+	progress firmware.FlashProgress
+}
+
 // flashCompleteMsg for flash completion
 type flashCompleteMsg struct {
-	result firmware.FlashResult
+	result   firmware.FlashResult
+	path     string // file copied, empty for qmk
+	duration time.Duration
+}
+
+// rebootTimeoutMsg fires when a flashed device may still be mounted
+type rebootTimeoutMsg struct {
+	seq int
+}
+
+// keyTimeoutMsg fires when pending keys were not followed by a motion in time
+type keyTimeoutMsg struct {
+	seq int
+}
+
+// toastTickMsg expires toasts that have been shown long enough
+type toastTickMsg struct{}
+
+// dockerCheckMsg reports whether Docker is running
+type dockerCheckMsg struct {
+	err error
+}
+
+// backupDoneMsg reports the keymap backup taken before a flash
+type backupDoneMsg struct {
+	dir string
+	err error
+}
+
+// westCompleteMsg for west update completion
+type westCompleteMsg struct {
+	result firmware.BuildResult
+}
+
+// gitDoneMsg for git commit/push completion
+type gitDoneMsg struct {
+	err error
+}
+
+// gitPullMsg for pre-build git pull completion
+type gitPullMsg struct {
+	target string
+	err    error
+}
+
+// qmkProgressMsg for qmk flash output
+type qmkProgressMsg struct {
+	progress firmware.QMKProgress
 }
 
 // Update handles messages
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	prevState := m.state
+	model, cmd := m.update(msg)
+	// In compact mode, follow a starting operation to the status panel
+	if m.compact && prevState == StateIdle && m.state != StateIdle && m.activePanel == PanelFirmware {
+		m.activePanel = PanelStatus
+	}
+	if m.activePanel != PanelLog {
+		m.logPanel.ClearHighlight()
+	}
+	if pollCmd := m.syncPollInterval(); pollCmd != nil {
+		cmd = tea.Batch(cmd, pollCmd)
+	}
+	// A run ends once neither its build nor its flash is in progress
+	if m.runTarget != "" && m.state == StateIdle && !m.showDialog && !m.builtPending {
+		m.runTarget = ""
+	}
+	if len(m.watchPending) > 0 {
+		cmd = tea.Batch(cmd, m.startWatchBuild())
+	}
+	if !m.toasts.Empty() && !m.toastTicking {
+		m.toastTicking = true
+		cmd = tea.Batch(cmd, toastTick())
+	}
+	m.writeStatus()
+	return model, cmd
+}
+
+// writeStatus updates the status file with what the model is doing
+func (m *Model) writeStatus() {
+	if m.statusFile == nil {
+		return
+	}
+	st := status.Status{State: status.Idle, Keyboard: m.cfg.Keyboard.Name}
+	switch m.state {
+	case StateBuilding, StateCheckingDocker:
+		st.State, st.Side, st.Percent = status.Building, m.buildTarget, m.buildPercent
+	case StateUpdating:
+		st.State = status.Updating
+	case StateWaitingDisconnect, StateWaitingDevice:
+		st.State, st.Side = status.Waiting, m.flashTarget
+	case StateFlashing:
+		st.State, st.Side, st.Percent = status.Flashing, m.flashTarget, m.flashPercent
+	case StateComplete:
+		st.State = status.Complete
+	case StateIdle:
+		if m.flashFlow != nil && m.flashFlow.State() == flow.StateFailed {
+			st.State, st.Side = status.Failed, m.flashTarget
+		}
+	}
+	if err := m.statusFile.Set(st); err != nil {
+		m.logPanel.Add(LogWarning, "Status file off: "+err.Error())
+		m.statusFile = nil
+	}
+}
+
+// quit stops watching for the device and removes the status file
+func (m *Model) quit() tea.Cmd {
+	if m.detectCancel != nil {
+		m.detectCancel()
+	}
+	if m.watchCancel != nil {
+		m.watchCancel()
+	}
+	m.statusFile.Remove()
+	m.statusFile = nil
+	return tea.Quit
+}
+
+// toastTick schedules the next check for expired toasts
+func toastTick() tea.Cmd {
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg {
+		return toastTickMsg{}
+	})
+}
+
+// notify logs msg and shows it as a toast, for events worth noticing
+// without watching the log
+func (m *Model) notify(level LogLevel, msg string) {
+	m.logPanel.Add(level, msg)
+	m.toasts.Push(level, msg)
+}
+
+// notifyFailure notifies of a failed build or flash, focusing the log panel
+// with the error highlighted until focus moves elsewhere
+func (m *Model) notifyFailure(msg string) {
+	m.notify(LogError, msg)
+	m.logPanel.Highlight()
+	m.activePanel = PanelLog
+}
+
+func (m *Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -194,81 +806,381 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		return m.handleKey(msg)
 
+	case toastTickMsg:
+		m.toasts.Expire(time.Now())
+		if m.toasts.Empty() {
+			m.toastTicking = false
+			return m, nil
+		}
+		return m, toastTick()
+
 	case deviceEventMsg:
+		// Restarting detection re-sends the current state; only log changes
 		if msg.event.Connected {
+			if m.deviceStatus != DeviceConnected {
+				m.notify(LogSuccess, "Device connected at "+msg.event.Path)
+				if details := deviceDetails(msg.event); details != "" {
+					m.logPanel.Add(LogInfo, "Volume: "+details)
+				}
+			}
+			connected := m.deviceStatus != DeviceConnected
 			m.deviceStatus = DeviceConnected
 			m.devicePath = msg.event.Path
-			m.logPanel.Add(LogSuccess, "Device connected")
-			if m.state == StateWaitingDevice {
-				return m.startFlash()
+			m.statusPanel.SetDevice(deviceDetails(msg.event))
+			if connected && m.state == StateIdle {
+				m.offerFlash()
+			}
+			if m.flashFlow != nil {
+				path := msg.event.Path
+				cmd := m.driveFlow(func() { m.flashFlow.Connected(path) })
+				return m, tea.Batch(cmd, m.listenForNextEvent())
 			}
 		} else {
+			rebooting := m.flashFlow != nil && m.flashFlow.Rebooting()
+			switch {
+			case msg.event.Err != nil:
+				if m.deviceStatus != DeviceUnreadable {
+					m.notify(LogError, msg.event.Err.Error())
+				}
+			case !rebooting && m.deviceStatus != DeviceDisconnected:
+				m.logPanel.Add(LogInfo, "Device disconnected")
+			}
 			m.deviceStatus = DeviceDisconnected
+			if msg.event.Err != nil {
+				m.deviceStatus = DeviceUnreadable
+			}
 			m.devicePath = ""
-			m.logPanel.Add(LogInfo, "Device disconnected")
-			// Safety: if waiting for disconnect, transition to waiting for connect
-			if m.state == StateWaitingDisconnect {
-				m.state = StateWaitingDevice
-				m.logPanel.Add(LogInfo, "Now connect "+m.flashTarget+" half...")
+			m.statusPanel.SetDevice("")
+			if m.showDialog && m.confirmDialog == m.devicePrompt {
+				m.showDialog = false
+				m.confirmDialog = nil
+			}
+			if m.flashFlow != nil {
+				return m, tea.Batch(m.driveFlow(m.flashFlow.Disconnected), m.listenForNextEvent())
 			}
 		}
 		// Continue listening for events
 		return m, m.listenForNextEvent()
 
 	case buildProgressMsg:
-		m.buildPercent = msg.progress.Percent
+		if msg.progress.Output != "" {
+			m.addOutput(msg.progress.Output)
+		}
+		if m.state == StateUpdating {
+			m.westProjects = msg.progress.Current
+			if msg.progress.Message != "" {
+				m.westMessage = msg.progress.Message
+			}
+		} else {
+			m.buildStage = msg.progress.Stage
+			if msg.progress.Percent >= 0 {
+				m.buildPercent = msg.progress.Percent
+			}
+		}
 		// Continue listening for more progress
 		return m, m.listenForBuildProgress()
 
+	case copyProgressMsg:
+		if m.state == StateFlashing {
+			m.flashPercent = msg.progress.Percent
+			if m.flashStep.Files > 1 {
+				// Spread the side's files over one bar
+				m.flashPercent = (m.flashStep.File*100 + msg.progress.Percent) / m.flashStep.Files
+			}
+		}
+		return m, m.listenForCopyProgress()
+
+	case dockerCheckMsg:
+		if m.state != StateCheckingDocker {
+			return m, nil // cancelled
+		}
+		next := m.dockerNext
+		m.dockerCancel()
+		m.dockerCancel = nil
+		m.dockerNext = nil
+		m.state = StateIdle
+		if msg.err != nil {
+			m.notifyFailure(msg.err.Error())
+			return m, nil
+		}
+		return next()
+
+	case backupDoneMsg:
+		if m.backupNext == nil {
+			return m, nil // cancelled
+		}
+		next := m.backupNext
+		m.backupCancel()
+		m.backupCancel = nil
+		m.backupNext = nil
+		if msg.err != nil {
+			m.notifyFailure("Backup failed: " + msg.err.Error())
+			return m, nil
+		}
+		m.logPanel.Add(LogInfo, "Keymap backed up to "+msg.dir)
+		m.flashLog.SetBackup(msg.dir)
+		return next()
+
+	case pullProgressMsg:
+		if m.pullProgress == nil {
+			return m, nil // the pull has finished
+		}
+		if msg.progress.Line != "" {
+			m.addOutput(msg.progress.Line)
+		}
+		m.pullLayers = msg.progress.Summary()
+		m.buildPercent = firmware.BuildPreparing.Percent(msg.progress.Done, msg.progress.Layers)
+		return m, m.listenForPullProgress()
+
+	case imagePulledMsg:
+		m.pullProgress = nil
+		m.pullResult = nil
+		m.pullLayers = ""
+		if msg.err != nil {
+			return m.pullFailed(msg.target, msg.err)
+		}
+		return m, m.buildImage(msg.target)
+
 	case buildCompleteMsg:
 		if msg.result.Success {
-			m.logPanel.Add(LogSuccess, "Build complete")
+			m.logWarnings(msg.result.Warnings)
+			m.notify(LogSuccess, "Build complete"+m.recordBuildTime(time.Since(m.startTime))+formatWarnings(len(msg.result.Warnings)))
+			if msg.result.OutputPath != "" {
+				m.logImageSize(msg.result.OutputPath, m.cfg.Build.BoardFor(m.buildTarget))
+			}
 			m.buildPercent = 100
-			// Refresh firmware list
-			ctx := context.Background()
-			builds, _ := m.scanner.Scan(ctx)
-			m.firmwarePanel.SetBuilds(builds)
-			m.state = StateIdle
-		} else {
-			m.logPanel.Add(LogError, "Build failed: "+msg.result.Error.Error())
 			m.state = StateIdle
+			m.refreshGitStatus()
+			m.builtPending = true
+			m.builtDir = ""
+			if msg.result.OutputPath != "" {
+				m.builtDir = filepath.Dir(msg.result.OutputPath)
+			}
+			// Refresh firmware list
+			return m, m.startScan()
 		}
+		m.notifyFailure("Build failed: " + msg.result.Error.Error())
+		m.state = StateIdle
+		m.watchBuild = false
 		return m, nil
 
-	case flashCompleteMsg:
-		if msg.result.Success {
-			m.logPanel.Add(LogSuccess, m.flashTarget+" flashed")
-			m.completedSteps = append(m.completedSteps, m.flashTarget+" flashed")
+	case scanBuildMsg:
+		m.firmwarePanel.AddBuild(msg.build)
+		return m, m.listenForScan()
 
-			// Check if we need to flash more sides
-			sides := m.cfg.Keyboard.Sides
-			if len(sides) == 0 {
-				sides = []string{"main"}
+	case scanCompleteMsg:
+		m.scanning = false
+		m.firmwarePanel.SetLoading(false)
+		if msg.err != nil {
+			m.logPanel.Add(LogError, "Scan failed: "+msg.err.Error())
+			m.builtPending = false
+			return m, nil
+		}
+		m.firmwarePanel.SetBuilds(msg.builds)
+		m.firmwareUsage = msg.usage
+		m.logPanel.Add(LogInfo, "Found "+formatInt(len(msg.builds))+" build(s)")
+		var cmd tea.Cmd
+		if m.builtPending {
+			m.builtPending = false
+			b := m.finishedBuild(msg.builds)
+			if b != nil {
+				cmd = tea.Batch(m.drawKeymap(b.Path), m.pushRemote(*b))
 			}
-
-			m.flashIndex++
-			if m.flashIndex < len(sides) {
-				// Safety: require disconnect before flashing next side
-				m.flashTarget = sides[m.flashIndex]
-				m.state = StateWaitingDisconnect
-				m.logPanel.Add(LogWarning, "Unplug device, then connect "+m.flashTarget)
-				return m, nil
+			if m.runTarget != "" {
+				// A run flashes straight away; the note can wait
+				_, flash := m.flashRun(b)
+				return m, tea.Batch(cmd, flash)
 			}
+			if b != nil && m.watchBuild {
+				// Hands-free: no note prompt, the build is marked instead
+				m.firmwarePanel.SetReady(b.Path)
+				m.firmwarePanel.Select(b.Path)
+				m.notify(LogSuccess, "New build ready: "+b.Title())
+			} else if b != nil {
+				m.promptNote(*b)
+			}
+			m.watchBuild = false
+		}
+		if !m.resumeOffered {
+			m.resumeOffered = true
+			m.offerResume()
+		}
+		return m, cmd
 
-			// All done
-			m.state = StateComplete
-			m.logPanel.Add(LogSuccess, "Flash complete")
-		} else {
-			m.logPanel.Add(LogError, "Flash failed: "+msg.result.Error.Error())
-			m.state = StateIdle
+	case keymapDrawnMsg:
+		if msg.err != nil {
+			m.notify(LogWarning, "Keymap preview failed: "+msg.err.Error())
+			return m, nil
 		}
-		return m, nil
+		m.logPanel.Add(LogSuccess, "Keymap preview: "+msg.path)
+		return m, m.startScan()
 
-	case tickMsg:
-		return m, tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
-			return tickMsg{}
-		})
-	}
+	case remoteSyncedMsg:
+		m.remoteSyncing = false
+		for _, name := range msg.names {
+			m.logPanel.Add(LogSuccess, "Downloaded remote build "+name)
+		}
+		if msg.err != nil {
+			m.notify(LogWarning, "Remote cache: "+msg.err.Error())
+		}
+		if len(msg.names) == 0 {
+			return m, nil
+		}
+		return m, m.startScan()
+
+	case remotePushedMsg:
+		if msg.err != nil {
+			m.notify(LogWarning, "Upload failed: "+msg.err.Error())
+			return m, nil
+		}
+		m.logPanel.Add(LogSuccess, "Uploaded "+msg.title+" to the remote cache")
+		return m, nil
+
+	case watchChangedMsg:
+		for _, file := range msg.files {
+			if !slices.Contains(m.watchPending, file) {
+				m.watchPending = append(m.watchPending, file)
+			}
+		}
+		return m, m.listenForWatch()
+
+	case keymapEditedMsg:
+		m.keymapEdited(msg)
+		return m, nil
+
+	case noteSavedMsg:
+		if msg.err != nil {
+			m.logPanel.Add(LogError, "Cannot save build note: "+msg.err.Error())
+			return m, nil
+		}
+		m.logPanel.Add(LogSuccess, "Saved build note")
+		return m, m.startScan()
+
+	case cleanDoneMsg:
+		m.cleaning = false
+		if msg.err != nil {
+			m.notifyFailure("Clean failed: " + msg.err.Error())
+			return m, nil
+		}
+		m.logPanel.Add(LogSuccess, "Cleaned build files for "+msg.target)
+		return m, nil
+
+	case cleanupDoneMsg:
+		if msg.removed > 0 {
+			m.logPanel.Add(LogSuccess, "Removed "+formatInt(msg.removed)+" old build(s), freed "+firmware.FormatSize(msg.freed))
+		}
+		if msg.err != nil {
+			m.logPanel.Add(LogError, "Cleanup failed: "+msg.err.Error())
+		}
+		return m, m.startScan()
+
+	case westCompleteMsg:
+		if msg.result.Success {
+			m.notify(LogSuccess, "west update complete ("+formatInt(m.westProjects)+" projects)")
+		} else {
+			m.notifyFailure(msg.result.Error.Error())
+		}
+		m.state = StateIdle
+		return m, nil
+
+	case gitDoneMsg:
+		if msg.err != nil {
+			m.logPanel.Add(LogError, msg.err.Error())
+		} else {
+			m.logPanel.Add(LogSuccess, "Keymap changes committed and pushed")
+		}
+		m.refreshGitStatus()
+		return m, nil
+
+	case gitPullMsg:
+		if m.gitPullCancel == nil {
+			return m, nil // cancelled
+		}
+		m.gitPullCancel()
+		m.gitPullCancel = nil
+		if msg.err != nil {
+			m.notifyFailure("Pull failed: " + msg.err.Error())
+			m.state = StateIdle
+			return m, nil
+		}
+		m.logPanel.Add(LogSuccess, "zmk-config up to date")
+		return m.runBuild(msg.target)
+
+	case qmkProgressMsg:
+		if m.flashCancel == nil {
+			// Cancelled; drain remaining output without changing state
+			return m, m.listenForQMKProgress()
+		}
+		if msg.progress.Output != "" {
+			m.addOutput(msg.progress.Output)
+		}
+		switch msg.progress.Stage {
+		case firmware.QMKCompiling:
+			m.state = StateBuilding
+			m.buildStage = firmware.BuildCompiling
+			m.buildTarget = m.flashTarget
+		case firmware.QMKWaitingDevice:
+			if m.state != StateWaitingDevice {
+				m.logPanel.Add(LogInfo, "Reset "+m.flashTarget+" to enter bootloader...")
+			}
+			m.state = StateWaitingDevice
+		case firmware.QMKFlashing:
+			m.state = StateFlashing
+			if msg.progress.Percent >= 0 {
+				m.flashPercent = msg.progress.Percent
+			}
+		}
+		return m, m.listenForQMKProgress()
+
+	case flashCompleteMsg:
+		if m.flashCancel != nil {
+			m.flashCancel()
+			m.flashCancel = nil
+		}
+		if !msg.result.Success && m.state == StateIdle {
+			// Cancelled by the user; already logged
+			return m, nil
+		}
+		if msg.result.Success && m.flashReport != nil {
+			m.flashReport.AddFlash(m.flashTarget, msg.path, msg.result, msg.duration)
+		}
+		if msg.result.Success && msg.path != "" {
+			m.recordFlash(m.flashStep.Side, msg.path)
+		}
+		var err error
+		if !msg.result.Success {
+			err = msg.result.Error
+			if m.qmkFlasher != nil || m.dfuFlasher != nil {
+				m.logOutputTail()
+			}
+		}
+		cmd := m.driveFlow(func() { m.flashFlow.Done(err) })
+		if m.flashFlow.Rebooting() {
+			cmd = tea.Batch(cmd, m.awaitReboot())
+		}
+		return m, cmd
+
+	case rebootTimeoutMsg:
+		if msg.seq == m.rebootSeq && m.flashFlow != nil {
+			return m, m.driveFlow(m.flashFlow.RebootTimeout)
+		}
+		return m, nil
+
+	case keyTimeoutMsg:
+		if msg.seq == m.pendingSeq && m.pendingKeys != "" {
+			keys := m.pendingKeys
+			m.pendingKeys = ""
+			if m.state == StateIdle && !m.showDialog && !m.showBuildMenu && !m.showHelp && m.inputDialog == nil {
+				m.fallbackKeys(keys)
+			}
+		}
+		return m, nil
+
+	case tickMsg:
+		return m, tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		})
+	}
 
 	return m, nil
 }
@@ -288,25 +1200,33 @@ func (m *Model) listenForNextEvent() tea.Cmd {
 }
 
 func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Text prompts take every key but ctrl+c as text
+	if m.inputDialog != nil && msg.String() != "ctrl+c" {
+		return m.handleInputKey(msg)
+	}
+	if m.firmwarePanel.Searching() && !m.showDialog && msg.String() != "ctrl+c" {
+		return m.handleSearchKey(msg)
+	}
+
 	// Global keys
 	switch msg.String() {
 	case "ctrl+c":
-		if m.detectCancel != nil {
-			m.detectCancel()
-		}
-		return m, tea.Quit
+		return m, m.quit()
 	case "q":
 		if !m.showDialog && !m.showBuildMenu && (m.state == StateIdle || m.state == StateComplete) {
-			if m.detectCancel != nil {
-				m.detectCancel()
-			}
-			return m, tea.Quit
+			return m, m.quit()
 		}
 	case "?":
 		if m.state == StateIdle {
 			m.showHelp = !m.showHelp
 		}
 		return m, nil
+	case "z":
+		if !m.showDialog && !m.showBuildMenu && !m.showHelp {
+			m.compact = !m.compact
+			m.updatePanelSizes()
+			return m, nil
+		}
 	case "esc":
 		if m.showHelp {
 			m.showHelp = false
@@ -321,7 +1241,36 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.confirmDialog = nil
 			return m, nil
 		}
+		if m.state == StateCheckingDocker {
+			m.dockerCancel()
+			m.dockerCancel = nil
+			m.dockerNext = nil
+			m.state = StateIdle
+			m.logPanel.Add(LogInfo, "Cancelled")
+			return m, nil
+		}
+		if m.gitPullCancel != nil {
+			m.gitPullCancel()
+			m.gitPullCancel = nil
+			m.state = StateIdle
+			m.logPanel.Add(LogInfo, "Cancelled")
+			return m, nil
+		}
+		if m.backupNext != nil {
+			m.backupCancel()
+			m.backupCancel = nil
+			m.backupNext = nil
+			m.logPanel.Add(LogInfo, "Cancelled")
+			return m, nil
+		}
 		if m.state == StateWaitingDisconnect || m.state == StateWaitingDevice {
+			if m.flashCancel != nil {
+				m.flashCancel()
+				m.flashCancel = nil
+			}
+			m.flashFlow.Cancel()
+			m.endSession()
+			m.finishReport(errors.New("cancelled"))
 			m.state = StateIdle
 			m.logPanel.Add(LogInfo, "Cancelled")
 			return m, nil
@@ -331,6 +1280,10 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.completedSteps = nil
 			return m, nil
 		}
+		if m.state == StateIdle && m.firmwarePanel.Query() != "" {
+			m.firmwarePanel.SetQuery("")
+			return m, nil
+		}
 	}
 
 	// Build menu keys
@@ -340,15 +1293,23 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	// Dialog keys
 	if m.showDialog && m.confirmDialog != nil {
+		if key := m.confirmDialog.Hotkey(); key != "" && msg.String() == key && m.confirmAction != nil {
+			m.showDialog = false
+			return m.confirmAction()
+		}
+		if m.confirmDialog.Choose(msg.String()) && m.confirmAction != nil {
+			m.showDialog = false
+			return m.confirmAction()
+		}
 		switch msg.String() {
 		case "left", "h":
 			m.confirmDialog.MoveLeft()
 		case "right", "l":
 			m.confirmDialog.MoveRight()
 		case "enter":
-			if m.confirmDialog.Selected() == DialogConfirm {
+			if m.confirmDialog.Selected() == DialogConfirm && m.confirmAction != nil {
 				m.showDialog = false
-				return m.startFactoryReset()
+				return m.confirmAction()
 			}
 			m.showDialog = false
 			m.confirmDialog = nil
@@ -361,6 +1322,12 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	// Raw output toggles while a build or west update runs
+	if msg.String() == "o" && (m.state == StateBuilding || m.state == StateUpdating) {
+		m.showOutput = !m.showOutput
+		return m, nil
+	}
+
 	// State-specific keys
 	switch m.state {
 	case StateIdle:
@@ -370,25 +1337,467 @@ func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.state = StateIdle
 			m.completedSteps = nil
 		}
+	default:
+		if m.focusKey(msg.String()) {
+			return m, nil
+		}
+		// Say why instead of silently dropping actions mid-operation
+		if action, ok := actionKeys[msg.String()]; ok {
+			m.guardIdle(action)
+		}
+	}
+
+	return m, nil
+}
+
+// focusKey moves focus for tab and the panel number keys, reporting whether
+// key was one of them
+func (m *Model) focusKey(key string) bool {
+	switch key {
+	case "tab":
+		m.activePanel = (m.activePanel + 1) % 3
+	case "1":
+		m.activePanel = PanelFirmware
+	case "2":
+		m.activePanel = PanelStatus
+	case "3":
+		m.activePanel = PanelLog
+	default:
+		return false
+	}
+	return true
+}
+
+// actionKeys maps idle keys that start an operation to their description
+var actionKeys = map[string]string{
+	"b": "build",
+	"w": "run west update",
+	"f": "flash",
+	"r": "factory reset",
+	"x": "clean up builds",
+	"g": "commit and push",
+	"e": "edit the keymap",
+	"K": "mark firmware known good",
+	"R": "restore known good firmware",
+	"p": "switch keyboards",
+}
+
+// operation describes the running build, flash or factory reset, or ""
+// when nothing is running
+func (m *Model) operation() string {
+	if m.cleaning {
+		return "cleaning build files"
+	}
+	if m.backupNext != nil {
+		return "backing up the keymap"
+	}
+	switch m.state {
+	case StateCheckingDocker:
+		return "checking Docker"
+	case StateBuilding:
+		if m.flashCancel != nil {
+			return "flashing" // qmk compiles as part of its flash
+		}
+		return "building"
+	case StateUpdating:
+		return "running west update"
+	case StateWaitingDisconnect, StateWaitingDevice, StateFlashing:
+		if m.resetPath != "" {
+			return "running a factory reset"
+		}
+		return "flashing"
+	}
+	return ""
+}
+
+// guardIdle logs and returns false if action would overlap a running operation
+func (m *Model) guardIdle(action string) bool {
+	if op := m.operation(); op != "" {
+		m.logPanel.Add(LogWarning, "Cannot "+action+" while "+op)
+		return false
+	}
+	return true
+}
+
+// finishedBuild returns the build just made: the builder's output
+// directory, or the newest build when it did not say
+func (m *Model) finishedBuild(builds []firmware.Build) *firmware.Build {
+	for i := range builds {
+		if m.builtDir == "" || builds[i].Path == m.builtDir {
+			return &builds[i]
+		}
+	}
+	return nil
+}
+
+// promptNote asks for a one-line description of a finished build
+func (m *Model) promptNote(build firmware.Build) {
+	dir := build.Path
+	m.showInput(NoteDialog(build.Title()), func(note string) tea.Cmd {
+		if note == "" {
+			return nil
+		}
+		return func() tea.Msg {
+			return noteSavedMsg{err: firmware.AddNote(dir, note)}
+		}
+	})
+}
+
+// drawKeymap renders the keymap preview into a finished build's directory
+func (m *Model) drawKeymap(dir string) tea.Cmd {
+	if m.keymapDrawer == nil {
+		return nil
+	}
+	m.logPanel.Add(LogInfo, "Rendering keymap preview...")
+	drawer := m.keymapDrawer
+	return func() tea.Msg {
+		path, err := drawer.Draw(context.Background(), dir)
+		return keymapDrawnMsg{path: path, err: err}
+	}
+}
+
+// remoteTimeout bounds a sync with the remote cache, so an unreachable one
+// is reported instead of syncing forever
+const remoteTimeout = 2 * time.Minute
+
+// syncRemote downloads builds made on other machines from the remote
+// cache in the background
+func (m *Model) syncRemote() tea.Cmd {
+	if m.remote == nil || m.remoteSyncing {
+		return nil
+	}
+	m.remoteSyncing = true
+	m.logPanel.Add(LogInfo, "Checking "+m.remote.String()+" for new builds...")
+	cache := m.remote
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+		defer cancel()
+		names, err := cache.Pull(ctx)
+		return remoteSyncedMsg{names: names, err: err}
+	}
+}
+
+// pushRemote uploads a finished build to the remote cache when uploads are
+// on and the build was made here
+func (m *Model) pushRemote(build firmware.Build) tea.Cmd {
+	if m.remote == nil || !m.cfg.Build.Remote.Upload || (build.Source != "" && build.Source != "local") {
+		return nil
+	}
+	m.logPanel.Add(LogInfo, "Uploading "+build.Title()+" to the remote cache...")
+	cache := m.remote
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+		defer cancel()
+		return remotePushedMsg{title: build.Title(), err: cache.Push(ctx, build)}
+	}
+}
+
+// openKeymap opens the selected build's keymap preview in the system viewer
+func (m *Model) openKeymap() {
+	build := m.firmwarePanel.Selected()
+	if build == nil || build.Keymap == "" {
+		m.logPanel.Add(LogWarning, "No keymap preview for this build")
+		return
+	}
+	if err := openFile(build.Keymap); err != nil {
+		m.logPanel.Add(LogError, "Cannot open keymap preview: "+err.Error())
+	}
+}
+
+// editKeymap suspends the TUI and opens $VISUAL or $EDITOR on the keymap
+func (m *Model) editKeymap() tea.Cmd {
+	path := m.cfg.Build.KeymapPath()
+	if path == "" {
+		m.logPanel.Add(LogWarning, "No keymap to edit: set build.shield or build.keymap_drawer.keymap")
+		return nil
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		m.logPanel.Add(LogError, "Cannot read keymap: "+err.Error())
+		return nil
+	}
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Dir = m.cfg.Build.WorkingDir
+	return m.execProcess(cmd, func(err error) tea.Msg {
+		return keymapEditedMsg{path: path, before: before, err: err}
+	})
+}
+
+// editorCommand returns the user's editor and its arguments, from $VISUAL
+// or $EDITOR, falling back to vi (notepad on Windows)
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// keymapEdited logs what the editor changed and offers to rebuild the
+// targets built from the keymap
+func (m *Model) keymapEdited(msg keymapEditedMsg) {
+	if msg.err != nil {
+		m.logPanel.Add(LogError, "Editor failed: "+msg.err.Error())
+	}
+	after, err := os.ReadFile(msg.path)
+	if err != nil {
+		m.logPanel.Add(LogError, "Cannot read keymap: "+err.Error())
+		return
+	}
+	name := filepath.Base(msg.path)
+	if bytes.Equal(after, msg.before) {
+		m.logPanel.Add(LogInfo, name+" unchanged")
+		return
+	}
+	m.logPanel.Add(LogSuccess, "Saved "+name)
+	m.refreshGitStatus()
+
+	// The watcher rebuilds by itself
+	if m.builder == nil || m.state != StateIdle || m.watcher != nil {
+		return
+	}
+	targets := m.cfg.Build.KeymapTargets(m.buildMenuDialog.Targets())
+	if len(targets) == 0 {
+		return
+	}
+	target := m.rebuildTarget(targets)
+	m.confirmDialog = KeymapEditedDialog(name, targets)
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) { return m.startBuild(target) }
+	m.showDialog = true
+}
+
+// rebuildTarget returns the build target covering targets: one side, or
+// all of them, as a build runs one target or every one
+func (m *Model) rebuildTarget(targets []string) string {
+	if len(targets) == 1 && len(m.buildMenuDialog.Targets()) > 1 {
+		return targets[0]
+	}
+	return "all"
+}
+
+// startWatch starts watching the working directory for saved changes
+func (m *Model) startWatch() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.watchCancel = cancel
+	m.watchChanges = m.watcher.Changes(ctx)
+	m.logPanel.Add(LogInfo, "Watching "+strings.Join(m.cfg.Build.Watch.Patterns, ", ")+" for changes")
+	return m.listenForWatch()
+}
+
+// listenForWatch waits for the watcher's next change
+func (m *Model) listenForWatch() tea.Cmd {
+	changes := m.watchChanges
+	return func() tea.Msg {
+		for files := range changes {
+			return watchChangedMsg{files: files}
+		}
+		return nil
+	}
+}
+
+// startWatchBuild rebuilds for the pending changes once nothing else is
+// running. Only a keymap change limits the build to the sides built from
+// it. The zmk-config is built as it is on disk, without a pull.
+func (m *Model) startWatchBuild() tea.Cmd {
+	if m.state != StateIdle || m.showDialog || m.showBuildMenu || m.inputDialog != nil || m.builtPending {
+		return nil
+	}
+	files := m.watchPending
+	m.watchPending = nil
+
+	targets := m.buildMenuDialog.Targets()
+	if keymap := m.cfg.Build.KeymapPath(); keymap != "" {
+		rel, err := filepath.Rel(m.cfg.Build.WorkingDir, keymap)
+		if err == nil && len(files) == 1 && files[0] == filepath.ToSlash(rel) {
+			targets = m.cfg.Build.KeymapTargets(targets)
+		}
+	}
+	if len(targets) == 0 {
+		m.logPanel.Add(LogInfo, "Changed: "+strings.Join(files, ", ")+" (no target built from it)")
+		return nil
+	}
+	target := m.rebuildTarget(targets)
+	m.logPanel.Add(LogInfo, "Changed: "+strings.Join(files, ", ")+", rebuilding "+target)
+	m.watchBuild = true
+	_, cmd := m.checkDocker(func() (tea.Model, tea.Cmd) {
+		return m.runBuild(target)
+	})
+	return cmd
+}
+
+// openFile opens path with the platform's default application
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// promptTag asks for a tag to toggle on the selected build
+func (m *Model) promptTag() {
+	build := m.firmwarePanel.Selected()
+	if build == nil {
+		m.logPanel.Add(LogWarning, "No build selected")
+		return
+	}
+	path, title := build.Path, build.Title()
+	m.showInput(TagDialog(title, m.tags.For(path)), func(text string) tea.Cmd {
+		tag := tags.Normalize(text)
+		if tag == "" {
+			return nil
+		}
+		if m.tags.Toggle(path, tag) {
+			m.logPanel.Add(LogSuccess, "Tagged "+title+" #"+tag)
+		} else {
+			m.logPanel.Add(LogInfo, "Removed #"+tag+" from "+title)
+		}
+		if err := m.tags.Save(); err != nil {
+			m.logPanel.Add(LogWarning, "Cannot save tags: "+err.Error())
+		}
+		// Re-apply the filter to the changed tags, dropping it once no
+		// build has the tag so the list is not left empty
+		filter := m.firmwarePanel.Filter()
+		if !slices.Contains(m.tags.All(m.buildPaths()), filter) {
+			filter = ""
+		}
+		m.firmwarePanel.SetFilter(filter)
+		return nil
+	})
+}
+
+// cycleTagFilter shows only builds with the next tag in use, then all builds
+func (m *Model) cycleTagFilter() {
+	all := m.tags.All(m.buildPaths())
+	if len(all) == 0 {
+		m.logPanel.Add(LogInfo, "No tagged builds (t tags the selected build)")
+		return
+	}
+	next := all[0]
+	if i := slices.Index(all, m.firmwarePanel.Filter()); i >= 0 {
+		next = ""
+		if i+1 < len(all) {
+			next = all[i+1]
+		}
+	}
+	m.firmwarePanel.SetFilter(next)
+	if next == "" {
+		m.logPanel.Add(LogInfo, "Showing all builds")
+	} else {
+		m.logPanel.Add(LogInfo, "Showing builds tagged #"+next)
+	}
+}
+
+// buildPaths returns the paths of every scanned build
+func (m *Model) buildPaths() []string {
+	var paths []string
+	for _, b := range m.firmwarePanel.Builds() {
+		paths = append(paths, b.Path)
+	}
+	return paths
+}
+
+// showInput opens a text prompt; action runs with the text on enter
+func (m *Model) showInput(d *InputDialog, action func(text string) tea.Cmd) {
+	m.inputDialog = d
+	m.inputDialog.SetSize(m.width, m.height)
+	m.inputAction = action
+}
+
+func (m *Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		text, action := m.inputDialog.Text(), m.inputAction
+		m.inputDialog = nil
+		m.inputAction = nil
+		return m, action(text)
+	case tea.KeyEsc:
+		m.inputDialog = nil
+		m.inputAction = nil
+	case tea.KeyBackspace:
+		m.inputDialog.Backspace()
+	case tea.KeyCtrlU:
+		m.inputDialog.Clear()
+	case tea.KeySpace:
+		m.inputDialog.Insert([]rune{' '})
+	case tea.KeyRunes:
+		m.inputDialog.Insert(msg.Runes)
 	}
+	return m, nil
+}
 
+// handleSearchKey edits the firmware search as it is typed, filtering the
+// list on every key. Enter keeps the filter, esc clears it.
+func (m *Model) handleSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	panel := m.firmwarePanel
+	query := []rune(panel.Query())
+	switch msg.Type {
+	case tea.KeyEnter:
+		panel.SetSearching(false)
+	case tea.KeyEsc:
+		panel.SetSearching(false)
+		panel.SetQuery("")
+	case tea.KeyUp, tea.KeyCtrlP:
+		panel.MoveUp()
+	case tea.KeyDown, tea.KeyCtrlN:
+		panel.MoveDown()
+	case tea.KeyBackspace:
+		if len(query) > 0 {
+			panel.SetQuery(string(query[:len(query)-1]))
+		}
+	case tea.KeyCtrlU:
+		panel.SetQuery("")
+	case tea.KeySpace:
+		panel.SetQuery(string(query) + " ")
+	case tea.KeyRunes:
+		panel.SetQuery(string(query) + string(msg.Runes))
+	}
 	return m, nil
 }
 
 func (m *Model) handleBuildMenuKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	targets := m.buildMenuDialog.Targets()
 
+	start := m.startBuild
+	if m.buildMenuDialog.Cleaning() {
+		start = m.promptClean
+	}
+
 	switch msg.String() {
 	case "a":
-		if len(targets) > 1 {
+		if len(targets) > 1 || m.buildMenuDialog.Cleaning() {
 			m.showBuildMenu = false
-			return m.startBuild("all")
+			return start("all")
 		}
 	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
 		idx := int(msg.String()[0] - '1')
 		if idx < len(targets) {
 			m.showBuildMenu = false
-			return m.startBuild(targets[idx])
+			return start(targets[idx])
+		}
+	case "c":
+		m.buildMenuDialog.SetCleaning(true)
+	case "s":
+		// Studio builds are only wired into the Docker builder
+		if _, ok := m.builder.(*firmware.DockerBuilder); ok {
+			m.studio = !m.studio
+			m.buildMenuDialog.SetStudio(m.studio)
+			m.matcher.SetStudio(m.studio)
 		}
 	case "esc":
 		m.showBuildMenu = false
@@ -397,6 +1806,12 @@ func (m *Model) handleBuildMenuKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) handleIdleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.activePanel == PanelFirmware {
+		if handled, cmd := m.handleListKey(msg.String()); handled {
+			return m, cmd
+		}
+	}
+
 	switch msg.String() {
 	// Navigation
 	case "up", "k":
@@ -407,23 +1822,26 @@ func (m *Model) handleIdleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.activePanel == PanelFirmware {
 			m.firmwarePanel.MoveDown()
 		}
-	case "tab":
-		m.activePanel = (m.activePanel + 1) % 3
-	case "1":
-		m.activePanel = PanelFirmware
-	case "2":
-		m.activePanel = PanelStatus
-	case "3":
-		m.activePanel = PanelLog
+	case "tab", "1", "2", "3":
+		m.focusKey(msg.String())
 
 	// Actions
 	case "b":
 		if m.cfg.Build.Enabled {
 			m.showBuildMenu = true
+			m.buildMenuDialog.SetCleaning(false)
 			m.buildMenuDialog.SetSize(m.width, m.height)
+			m.buildMenuDialog.SetDurations(m.buildDurations())
 		}
 		return m, nil
+	case "w":
+		if m.west != nil {
+			return m.startWestUpdate()
+		}
 	case "f", "enter":
+		if m.qmkFlasher != nil {
+			return m.startQMKFlash()
+		}
 		if m.firmwarePanel.Selected() != nil {
 			return m.prepareFlash()
 		}
@@ -432,167 +1850,1448 @@ func (m *Model) handleIdleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.cfg.Keyboard.Type == "split" {
 			m.confirmDialog = FactoryResetDialog()
 			m.confirmDialog.SetSize(m.width, m.height)
+			m.confirmAction = m.startFactoryReset
+			m.showDialog = true
+		}
+	case "p":
+		if m.root != nil {
+			return switchKeyboard(m), nil
+		}
+	case "d":
+		m.diffSelected()
+	case "v":
+		m.openKeymap()
+	case "e":
+		return m, m.editKeymap()
+	case "t":
+		m.promptTag()
+	case "T":
+		m.cycleTagFilter()
+	case "/":
+		m.activePanel = PanelFirmware
+		m.firmwarePanel.SetSearching(true)
+	case "x":
+		return m.promptCleanup()
+	case "g":
+		m.promptCommitPush()
+	case "K":
+		m.markKnownGood()
+	case "R":
+		return m.promptRestore()
+	case "u":
+		return m, m.syncRemote()
+	}
+
+	return m, nil
+}
+
+// keyTimeout is how long a count or g waits for the rest of a motion
+const keyTimeout = time.Second
+
+// handleListKey handles vim-style movement in the firmware list: a count
+// before j/k (5j), gg and G (or 12G to jump to a build), and ctrl+d/ctrl+u
+// to move half a panel. Digits and g wait keyTimeout for the rest of the
+// motion, then fall back to their own bindings.
+func (m *Model) handleListKey(key string) (bool, tea.Cmd) {
+	prefix := m.pendingKeys
+	digits := strings.TrimSuffix(prefix, "g")
+	afterG := digits != prefix
+	count, err := strconv.Atoi(digits)
+	if err != nil {
+		count = 1
+	}
+
+	isDigit := len(key) == 1 && key[0] >= '0' && key[0] <= '9'
+	switch {
+	case isDigit && !afterG && (digits != "" || key != "0"):
+		return true, m.pendKeys(prefix + key)
+	case key == "g" && !afterG:
+		return true, m.pendKeys(prefix + key)
+	}
+
+	m.pendingKeys = ""
+	panel := m.firmwarePanel
+	switch {
+	case key == "g": // gg
+		panel.MoveTo(count - 1)
+		return true, nil
+	case afterG:
+	case key == "j", key == "down":
+		panel.MoveBy(count)
+		return true, nil
+	case key == "k", key == "up":
+		panel.MoveBy(-count)
+		return true, nil
+	case key == "G":
+		if digits == "" {
+			count = panel.Len()
+		}
+		panel.MoveTo(count - 1)
+		return true, nil
+	case key == "ctrl+d":
+		panel.MoveBy(count * panel.PageSize())
+		return true, nil
+	case key == "ctrl+u":
+		panel.MoveBy(-count * panel.PageSize())
+		return true, nil
+	}
+
+	// Not a motion: the pending keys keep their own meaning and the key is
+	// handled as usual, unless that opened a dialog
+	m.fallbackKeys(prefix)
+	return m.showDialog, nil
+}
+
+// pendKeys holds keys that may start a motion until keyTimeout passes
+func (m *Model) pendKeys(keys string) tea.Cmd {
+	m.pendingKeys = keys
+	m.pendingSeq++
+	seq := m.pendingSeq
+	return tea.Tick(keyTimeout, func(time.Time) tea.Msg {
+		return keyTimeoutMsg{seq: seq}
+	})
+}
+
+// fallbackKeys runs the bindings of a lone pending key no motion followed:
+// 2 and 3 jump to their panel, g offers to commit and push
+func (m *Model) fallbackKeys(keys string) {
+	switch keys {
+	case "2":
+		m.activePanel = PanelStatus
+	case "3":
+		m.activePanel = PanelLog
+	case "g":
+		m.promptCommitPush()
+	}
+}
+
+// promptCommitPush offers to commit and push uncommitted keymap changes
+func (m *Model) promptCommitPush() {
+	if m.gitStatus != nil && m.gitStatus.Dirty {
+		m.confirmDialog = CommitPushDialog(m.gitStatus.Changes)
+		m.confirmDialog.SetSize(m.width, m.height)
+		m.confirmAction = m.startGitCommitPush
+		m.showDialog = true
+	}
+}
+
+// diffSelected logs, per side, whether the selected build's firmware differs
+// from the next older build
+func (m *Model) diffSelected() {
+	build := m.firmwarePanel.Selected()
+	older := m.firmwarePanel.Older()
+	if build == nil || older == nil {
+		m.logPanel.Add(LogInfo, "No older build to compare with")
+		return
+	}
+
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+
+	olderName := older.Title()
+	for _, side := range sides {
+		a := m.matcher.Match(side, older.Files)
+		b := m.matcher.Match(side, build.Files)
+		if a == nil || b == nil {
+			m.logPanel.Add(LogWarning, side+": missing in one of the builds")
+			continue
+		}
+
+		diff, err := firmware.DiffUF2Files(a.Path, b.Path)
+		if err != nil {
+			m.logPanel.Add(LogError, side+": "+err.Error())
+			continue
+		}
+		if diff.Identical() {
+			m.logPanel.Add(LogInfo, side+": identical to "+olderName)
+			continue
+		}
+		m.logPanel.Add(LogInfo, side+": "+formatInt(diff.DifferentBlocks)+"/"+formatInt(diff.BlocksB)+
+			" blocks differ from "+olderName+" ("+formatSizeDelta(diff.SizeDelta())+")")
+	}
+}
+
+// promptCleanup offers to delete dated builds older than the retention period
+func (m *Model) promptCleanup() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("clean up builds") {
+		return m, nil
+	}
+	days := m.cfg.Build.RetentionDays
+	cutoff := time.Now().AddDate(0, 0, -days)
+	expired := firmware.ExpiredBuilds(m.firmwarePanel.Builds(), m.cfg.Build.FirmwareDir, cutoff)
+	if len(expired) == 0 {
+		m.logPanel.Add(LogInfo, "No builds older than "+formatInt(days)+" days")
+		return m, nil
+	}
+
+	var size int64
+	for _, b := range expired {
+		for _, f := range b.Files {
+			size += f.Size
+		}
+	}
+
+	m.confirmDialog = CleanupDialog(len(expired), size, days)
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) {
+		return m, func() tea.Msg {
+			removed, freed, err := firmware.RemoveBuilds(context.Background(), expired)
+			return cleanupDoneMsg{removed: removed, freed: freed, err: err}
+		}
+	}
+	m.showDialog = true
+	return m, nil
+}
+
+// promptClean offers to remove the build files of target, or of every
+// target for "all", for when incremental builds get into a bad state
+func (m *Model) promptClean(target string) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("clean build files") {
+		return m, nil
+	}
+	if m.builder == nil {
+		m.logPanel.Add(LogError, "Build not enabled in config")
+		return m, nil
+	}
+
+	m.confirmDialog = CleanBuildDialog(target, m.cfg.Build.Mode == "docker")
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) {
+		return m.checkDocker(func() (tea.Model, tea.Cmd) {
+			m.cleaning = true
+			m.logPanel.Add(LogInfo, "Cleaning build files for "+target+"...")
+			builder := m.builder
+			return m, func() tea.Msg {
+				return cleanDoneMsg{target: target, err: builder.Clean(context.Background(), target)}
+			}
+		})
+	}
+	m.showDialog = true
+	return m, nil
+}
+
+func (m *Model) startBuild(target string) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("build") {
+		return m, nil
+	}
+	if m.builder == nil {
+		m.logPanel.Add(LogError, "Build not enabled in config")
+		return m, nil
+	}
+
+	return m.checkDocker(func() (tea.Model, tea.Cmd) {
+		return m.pullAndBuild(target)
+	})
+}
+
+// checkDocker runs next once Docker is confirmed running, checking in the
+// background since a starting daemon can take seconds to answer. Outside
+// docker mode next runs straight away.
+func (m *Model) checkDocker(next func() (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	if m.cfg.Build.Mode != "docker" {
+		return next()
+	}
+
+	var ctx context.Context
+	ctx, m.dockerCancel = context.WithCancel(context.Background())
+	m.dockerNext = next
+	m.state = StateCheckingDocker
+	m.logPanel.Add(LogInfo, "Checking Docker...")
+
+	return m, tea.Batch(
+		func() tea.Msg {
+			return dockerCheckMsg{err: firmware.CheckDocker(ctx)}
+		},
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// pullAndBuild builds target, first pulling the working directory when
+// build.pull asks for it
+func (m *Model) pullAndBuild(target string) (tea.Model, tea.Cmd) {
+	if m.gitStatus != nil {
+		switch m.cfg.Build.Pull {
+		case "always":
+			return m.startGitPull(target)
+		case "ask":
+			m.confirmDialog = PullDialog()
+			m.confirmDialog.SetSize(m.width, m.height)
+			m.confirmAction = func() (tea.Model, tea.Cmd) {
+				return m.startGitPull(target)
+			}
+			m.showDialog = true
+			return m, nil
+		}
+	}
+
+	return m.runBuild(target)
+}
+
+// startGitPull fast-forwards the working directory, then builds target
+func (m *Model) startGitPull(target string) (tea.Model, tea.Cmd) {
+	dir := m.cfg.Build.WorkingDir
+	m.state = StateBuilding
+	m.buildPercent = 0
+	m.buildStage = firmware.BuildPreparing
+	m.buildTarget = target
+	m.logPanel.Add(LogInfo, "Pulling zmk-config...")
+
+	var ctx context.Context
+	ctx, m.gitPullCancel = context.WithCancel(context.Background())
+	return m, tea.Batch(
+		func() tea.Msg {
+			return gitPullMsg{target: target, err: git.Pull(ctx, dir)}
+		},
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// runBuild starts the build for target
+func (m *Model) runBuild(target string) (tea.Model, tea.Cmd) {
+	m.refreshGitStatus()
+	if m.gitStatus != nil && m.gitStatus.Dirty {
+		m.logPanel.Add(LogWarning, "Building from uncommitted changes ("+m.gitStatus.String()+")")
+	}
+
+	m.state = StateBuilding
+	m.buildPercent = 0
+	m.buildStage = firmware.BuildPreparing
+	m.buildTarget = target
+	m.buildAverage = 0
+	if summary, ok := m.buildStats.Summary(stats.Key(m.cfg.Keyboard.Name, target)); ok {
+		m.buildAverage = summary.Average
+	}
+	m.output = nil
+	m.startTime = time.Now()
+	label := target
+	if dockerBuilder, ok := m.builder.(*firmware.DockerBuilder); ok {
+		dockerBuilder.SetStudio(m.studio)
+		if m.studio {
+			label += " (Studio)"
+		}
+	}
+	m.logPanel.Add(LogInfo, "Building: "+label)
+
+	// For Docker mode, ensure image is pulled first
+	if dockerBuilder, ok := m.builder.(*firmware.DockerBuilder); ok {
+		return m, m.pullImage(dockerBuilder, target)
+	}
+	return m, m.buildImage(target)
+}
+
+// pullImage pulls the Docker image if it is missing, then builds target
+func (m *Model) pullImage(builder *firmware.DockerBuilder, target string) tea.Cmd {
+	m.pullProgress = make(chan firmware.PullProgress, 10)
+	m.pullResult = make(chan imagePulledMsg, 1)
+	progress, result := m.pullProgress, m.pullResult
+	return tea.Batch(
+		func() tea.Msg {
+			err := builder.EnsureImage(context.Background(), func(p firmware.PullProgress) {
+				if p.Line != "" {
+					progress <- p
+					return
+				}
+				// Byte counts can be dropped; the next one catches up
+				select {
+				case progress <- p:
+				default:
+				}
+			})
+			// Delivered by the listener after the last progress
+			result <- imagePulledMsg{target: target, err: err}
+			close(progress)
+			return nil
+		},
+		m.listenForPullProgress(),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// pullFailed offers to retry a failed image pull, carrying on with the
+// build of target once it succeeds
+func (m *Model) pullFailed(target string, err error) (tea.Model, tea.Cmd) {
+	m.state = StateIdle
+	m.notifyFailure("Image pull failed: " + err.Error())
+	m.confirmDialog = PullFailedDialog(m.cfg.Build.Docker.Image, errors.Is(err, firmware.ErrPullTimeout))
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) {
+		return m.runBuild(target)
+	}
+	m.showDialog = true
+	return m, nil
+}
+
+// buildImage builds target once any Docker image is ready
+func (m *Model) buildImage(target string) tea.Cmd {
+	// Create progress channel
+	m.buildProgress = make(chan firmware.BuildProgress, 10)
+
+	ctx := context.Background()
+	return tea.Batch(
+		func() tea.Msg {
+			result := m.builder.Build(ctx, target, func(p firmware.BuildProgress) {
+				// Send progress to channel (non-blocking)
+				select {
+				case m.buildProgress <- p:
+				default:
+				}
+			})
+			close(m.buildProgress)
+			return buildCompleteMsg{result: result}
+		},
+		m.listenForBuildProgress(),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// deviceDetails summarises a connected volume, e.g. "NICENANO, vfat, 32 MB, serial 1A2B"
+func deviceDetails(e device.Event) string {
+	var parts []string
+	if e.Label != "" {
+		parts = append(parts, e.Label)
+	}
+	if e.FSType != "" {
+		parts = append(parts, e.FSType)
+	}
+	if e.Capacity > 0 {
+		parts = append(parts, firmware.FormatSize(e.Capacity))
+	}
+	if e.Serial != "" {
+		parts = append(parts, "serial "+e.Serial)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// slowBuildPercent is how much slower than average a build must be to warn
+const slowBuildPercent = 50
+
+// recordBuildTime saves the duration of the current build target and returns
+// it with its trend against previous builds, e.g. " in 1m12s, +24% vs avg"
+func (m *Model) recordBuildTime(d time.Duration) string {
+	key := stats.Key(m.cfg.Keyboard.Name, m.buildTarget)
+	m.buildStats.Record(key, d, time.Now())
+	if err := m.buildStats.Save(); err != nil {
+		m.logPanel.Add(LogWarning, "Cannot save build history: "+err.Error())
+	}
+
+	text := " in " + d.Round(time.Second).String()
+	summary, _ := m.buildStats.Summary(key)
+	if trend, ok := summary.Trend(); ok {
+		sign := "+"
+		if trend < 0 {
+			sign = ""
+		}
+		text += ", " + sign + strconv.Itoa(trend) + "% vs avg " + summary.Average.Round(time.Second).String()
+		if trend >= slowBuildPercent {
+			m.logPanel.Add(LogWarning, "Build was much slower than usual (ccache lost or west update?)")
+		}
+	}
+	m.buildNote = text
+	return text
+}
+
+// buildDurations returns the last and average build time of each target for
+// the build menu
+func (m *Model) buildDurations() map[string]string {
+	durations := make(map[string]string)
+	for _, target := range append([]string{"all"}, m.buildMenuDialog.Targets()...) {
+		summary, ok := m.buildStats.Summary(stats.Key(m.cfg.Keyboard.Name, target))
+		if !ok {
+			continue
+		}
+		text := summary.Last.Round(time.Second).String()
+		if summary.Average > 0 {
+			text += " (avg " + summary.Average.Round(time.Second).String() + ")"
+		}
+		durations[target] = text
+	}
+	return durations
+}
+
+// logImageSize reports a built image's size against its board's flash capacity
+func (m *Model) logImageSize(path, board string) {
+	report, ok, err := firmware.CheckImageSize(path, board)
+	switch {
+	case err != nil:
+		m.logPanel.Add(LogWarning, "Cannot check firmware size: "+err.Error())
+	case !ok:
+	case report.Exceeds():
+		m.logPanel.Add(LogError, "Firmware does not fit "+board+": "+report.String())
+	case report.NearLimit():
+		m.logPanel.Add(LogWarning, "Firmware is close to the "+board+" flash limit: "+report.String())
+	default:
+		m.logPanel.Add(LogInfo, "Firmware size: "+report.String())
+	}
+}
+
+// sideSizes checks each side's firmware in build against its board's flash
+// capacity. Files are read once per version; unknown boards are left out.
+func (m *Model) sideSizes(build *firmware.Build) map[string]firmware.SizeReport {
+	if build == nil || m.qmkFlasher != nil {
+		return nil
+	}
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	if m.sizeCache == nil {
+		m.sizeCache = make(map[sizeKey]sizeEntry)
+	}
+
+	reports := make(map[string]firmware.SizeReport)
+	for _, side := range sides {
+		file := m.matcher.Match(side, build.Files)
+		if file == nil {
+			continue
+		}
+		key := sizeKey{path: file.Path, size: file.Size}
+		entry, cached := m.sizeCache[key]
+		if !cached {
+			report, ok, err := firmware.CheckImageSize(file.Path, m.cfg.Build.BoardFor(side))
+			entry = sizeEntry{report: report, ok: ok && err == nil}
+			m.sizeCache[key] = entry
+		}
+		if entry.ok {
+			reports[side] = entry.report
+		}
+	}
+	return reports
+}
+
+// maxLoggedWarnings keeps a noisy build from pushing everything else out of the log.
+const maxLoggedWarnings = 20
+
+// logWarnings adds compiler warnings from a build to the log panel
+func (m *Model) logWarnings(warnings []string) {
+	for i, w := range warnings {
+		if i == maxLoggedWarnings {
+			m.logPanel.Add(LogWarning, "... and "+formatInt(len(warnings)-i)+" more warnings")
+			break
+		}
+		m.logPanel.Add(LogWarning, w)
+	}
+}
+
+// formatWarnings returns the warning count suffix for build messages
+func formatWarnings(n int) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return " (1 warning)"
+	}
+	return " (" + formatInt(n) + " warnings)"
+}
+
+// startWestUpdate refreshes the west workspace modules
+func (m *Model) startWestUpdate() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("run west update") {
+		return m, nil
+	}
+	return m.checkDocker(m.runWestUpdate)
+}
+
+// runWestUpdate runs west update, streaming progress to the model
+func (m *Model) runWestUpdate() (tea.Model, tea.Cmd) {
+	m.state = StateUpdating
+	m.westProjects = 0
+	m.westMessage = ""
+	m.output = nil
+	m.startTime = time.Now()
+	m.logPanel.Add(LogInfo, "Running west update...")
+
+	m.buildProgress = make(chan firmware.BuildProgress, 10)
+	progress := m.buildProgress
+
+	ctx := context.Background()
+	return m, tea.Batch(
+		func() tea.Msg {
+			result := m.west.Update(ctx, func(p firmware.BuildProgress) {
+				select {
+				case progress <- p:
+				default:
+				}
+			})
+			close(progress)
+			return westCompleteMsg{result: result}
+		},
+		m.listenForBuildProgress(),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// maxOutputLines is how much raw build output is kept for the output view
+const maxOutputLines = 200
+
+// addOutput records a line of raw build, west update, qmk or dfu-util
+// output
+func (m *Model) addOutput(line string) {
+	m.output = append(m.output, line)
+	if len(m.output) > maxOutputLines {
+		m.output = m.output[len(m.output)-maxOutputLines:]
+	}
+}
+
+// failedOutputLines is how much of a failed qmk or dfu-util run's output
+// is copied to the log
+const failedOutputLines = 10
+
+// logOutputTail copies the last lines of raw output to the log, where a
+// failure's cause stays visible once the progress view is gone
+func (m *Model) logOutputTail() {
+	for _, line := range m.output[max(0, len(m.output)-failedOutputLines):] {
+		m.logPanel.Add(LogInfo, line)
+	}
+}
+
+// listenForBuildProgress listens for build progress updates
+func (m *Model) listenForBuildProgress() tea.Cmd {
+	return func() tea.Msg {
+		if m.buildProgress == nil {
+			return nil
+		}
+		progress, ok := <-m.buildProgress
+		if !ok {
+			return nil
+		}
+		return buildProgressMsg{progress: progress}
+	}
+}
+
+func (m *Model) prepareFlash() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("flash") {
+		return m, nil
+	}
+	m.firmwarePanel.SetReady("")
+	build := m.firmwarePanel.Selected()
+	if build == nil || len(build.Files) == 0 {
+		m.logPanel.Add(LogError, "No firmware files found")
+		return m, nil
+	}
+
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+
+	// Rather than failing halfway, offer the sides the build has files for
+	if missing := m.matcher.Missing(sides, build.Files); len(missing) > 0 {
+		var available []string
+		for _, side := range sides {
+			if !slices.Contains(missing, side) {
+				available = append(available, side)
+			}
+		}
+		if len(available) == 0 {
+			m.logPanel.Add(LogError, "No firmware file for "+strings.Join(missing, ", "))
+			return m, nil
+		}
+		m.confirmDialog = MissingSidesDialog(build.Title(), missing, available)
+		m.confirmDialog.SetSize(m.width, m.height)
+		m.confirmAction = func() (tea.Model, tea.Cmd) {
+			return m.confirmReflash(available, func() (tea.Model, tea.Cmd) {
+				return m.awaitFirstSide(available)
+			})
+		}
+		m.showDialog = true
+		return m, nil
+	}
+
+	return m.confirmReflash(sides, func() (tea.Model, tea.Cmd) {
+		return m.awaitFirstSide(sides)
+	})
+}
+
+// confirmReflash asks before flashing the selected build to sides that
+// already run this exact firmware, and runs flash straight away otherwise
+func (m *Model) confirmReflash(sides []string, flash func() (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	flashed := m.alreadyFlashed(sides)
+	if len(flashed) == 0 {
+		return flash()
+	}
+	where := "the keyboard"
+	if m.cfg.Keyboard.Type == "split" {
+		where = "the " + strings.Join(flashed, " and ") + " half"
+		if len(flashed) > 1 {
+			where += "ves"
+		}
+	}
+	m.confirmDialog = AlreadyFlashedDialog(where)
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = flash
+	m.showDialog = true
+	return m, nil
+}
+
+// alreadyFlashed returns the sides whose last flash was byte for byte the
+// file the selected build would flash last to them
+func (m *Model) alreadyFlashed(sides []string) []string {
+	build := m.firmwarePanel.Selected()
+	if build == nil {
+		return nil
+	}
+	var flashed []string
+	for _, side := range sides {
+		file := m.matcher.Match(side, build.Files)
+		if file == nil {
+			continue
+		}
+		files := m.cfg.Flash.FilesFor(side, file.Path)
+		if _, ok := m.flashLog.Flashed(flashlog.Key(m.cfg.Keyboard.Name, side), files[len(files)-1]); ok {
+			flashed = append(flashed, side)
+		}
+	}
+	return flashed
+}
+
+// recordFlash notes path as the firmware now on side
+func (m *Model) recordFlash(side, path string) {
+	err := m.flashLog.Record(flashlog.Key(m.cfg.Keyboard.Name, side), path, time.Now())
+	if err == nil {
+		err = m.flashLog.Save()
+	}
+	if err != nil {
+		m.logPanel.Add(LogWarning, "Cannot save flash history: "+err.Error())
+	}
+}
+
+// configuredSides returns the keyboard's sides, "main" for a keyboard
+// without any
+func (m *Model) configuredSides() []string {
+	if len(m.cfg.Keyboard.Sides) == 0 {
+		return []string{"main"}
+	}
+	return m.cfg.Keyboard.Sides
+}
+
+// markKnownGood marks the firmware last flashed to each side as known good,
+// archiving it for restoreKnownGood
+func (m *Model) markKnownGood() {
+	if !m.guardIdle("mark firmware known good") {
+		return
+	}
+	marked := false
+	for _, side := range m.configuredSides() {
+		key := flashlog.Key(m.cfg.Keyboard.Name, side)
+		if _, ok := m.flashLog.Sides[key]; !ok {
+			continue
+		}
+		e, err := m.flashLog.MarkGood(key)
+		if err != nil {
+			m.logPanel.Add(LogWarning, "Cannot mark "+side+" known good: "+err.Error())
+			continue
+		}
+		m.logPanel.Add(LogSuccess, "Marked "+filepath.Base(e.File)+" known good on "+side)
+		marked = true
+	}
+	if !marked {
+		m.logPanel.Add(LogWarning, "Nothing flashed to mark known good")
+		return
+	}
+	if err := m.flashLog.Save(); err != nil {
+		m.logPanel.Add(LogWarning, "Cannot save flash history: "+err.Error())
+	}
+}
+
+// promptRestore asks to flash every side back to its known good firmware
+func (m *Model) promptRestore() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("restore known good firmware") {
+		return m, nil
+	}
+	if m.qmkFlasher != nil {
+		m.logPanel.Add(LogError, "qmk builds while it flashes, so there is no known good file to restore")
+		return m, nil
+	}
+	var sides, lines []string
+	for _, side := range m.configuredSides() {
+		e, ok := m.flashLog.KnownGood(flashlog.Key(m.cfg.Keyboard.Name, side))
+		if !ok {
+			continue
+		}
+		sides = append(sides, side)
+		lines = append(lines, side+": "+filepath.Base(e.File)+" ("+e.Time.Format("2006-01-02")+")")
+	}
+	if len(sides) == 0 {
+		m.logPanel.Add(LogWarning, "No known good firmware; press K after a good flash")
+		return m, nil
+	}
+	m.confirmDialog = RestoreDialog(lines)
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) {
+		return m.restoreKnownGood(sides)
+	}
+	m.showDialog = true
+	return m, nil
+}
+
+// restoreKnownGood flashes the archived known good firmware to sides,
+// whatever the firmware list holds. Only the firmware itself is flashed,
+// not the flash.files extras.
+func (m *Model) restoreKnownGood(sides []string) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("restore known good firmware") {
+		return m, nil
+	}
+	return m.backupKeymap(func() (tea.Model, tea.Cmd) {
+		return m.runRestore(sides)
+	})
+}
+
+// runRestore flashes the known good firmware of sides once any keymap
+// backup is taken
+func (m *Model) runRestore(sides []string) (tea.Model, tea.Cmd) {
+	var steps []flow.Step
+	for _, side := range sides {
+		e, ok := m.flashLog.KnownGood(flashlog.Key(m.cfg.Keyboard.Name, side))
+		if !ok {
+			m.logPanel.Add(LogError, "Known good firmware for "+side+" is gone")
+			return m, nil
+		}
+		steps = append(steps, flow.Step{Side: side, Files: []string{e.File}})
+	}
+	build := &firmware.Build{Name: "known good", Path: filepath.Dir(steps[0].Files[0])}
+	if !m.prepareSteps(build, steps) {
+		return m, nil
+	}
+	m.logPanel.Add(LogInfo, "Restoring known good firmware")
+	m.newFlow(steps, false)
+	return m, m.startFlow()
+}
+
+// awaitFirstSide starts flashing the selected build to sides, waiting for
+// the first side's bootloader to connect
+func (m *Model) awaitFirstSide(sides []string) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("flash") {
+		return m, nil
+	}
+	return m.backupKeymap(func() (tea.Model, tea.Cmd) {
+		if !m.beginFlash(sides, false) {
+			return m, nil
+		}
+		return m, m.startFlow()
+	})
+}
+
+// beginFlash starts a flash sequence of the selected build to sides, in
+// order. With ready, a bootloader already connected is flashed as the
+// first side. Returns false if it cannot start.
+func (m *Model) beginFlash(sides []string, ready bool) bool {
+	if !m.guardIdle("flash") {
+		return false
+	}
+	build := m.firmwarePanel.Selected()
+	if build == nil || len(build.Files) == 0 {
+		m.logPanel.Add(LogError, "No firmware files found")
+		return false
+	}
+
+	steps, ok := m.flowSteps(build, sides)
+	if !ok || !m.prepareSteps(build, steps) {
+		return false
+	}
+
+	for _, name := range m.matcher.Ambiguous(sides, build.Files) {
+		m.logPanel.Add(LogWarning, name+" matches more than one side")
+		m.reportWarning(name + " matches more than one side")
+	}
+
+	m.session = session.New(m.sessionPath, m.cfg.Keyboard.Name, build.Path, sides)
+	m.saveSession()
+	m.newFlow(steps, ready)
+	return true
+}
+
+// prepareSteps checks the files of steps and starts the report of flashing
+// them from build. Returns false if they cannot be flashed.
+func (m *Model) prepareSteps(build *firmware.Build, steps []flow.Step) bool {
+	var paths []string
+	for _, step := range steps {
+		paths = append(paths, step.Files...)
+	}
+	if !m.checkFiles(paths) {
+		return false
+	}
+
+	m.completedSteps = nil
+	m.resetPath = ""
+	m.startTime = time.Now()
+	m.startReport(build)
+	return true
+}
+
+// flowSteps returns the files of build to flash to each of sides.
+// Returns false if a side has none.
+func (m *Model) flowSteps(build *firmware.Build, sides []string) ([]flow.Step, bool) {
+	steps := make([]flow.Step, 0, len(sides))
+	for _, side := range sides {
+		file := m.matcher.Match(side, build.Files)
+		if file == nil {
+			m.logPanel.Add(LogError, "No firmware file for "+side)
+			return nil, false
+		}
+		// Extra files for this side are flashed in order, one per connection
+		steps = append(steps, flow.Step{Side: side, Files: m.cfg.Flash.FilesFor(side, file.Path)})
+	}
+	return steps, true
+}
+
+// newFlow sets up the flash sequence of steps, its events driving the model
+func (m *Model) newFlow(steps []flow.Step, ready bool) {
+	m.flashFlow = flow.New(steps, flow.Options{
+		SelfWaiting: m.qmkFlasher != nil || m.dfuFlasher != nil,
+		Ready:       ready,
+		Boards:      m.cfg.Build.Boards(m.cfg.Keyboard.Sides),
+	}, m.flowEvent)
+	if m.deviceStatus == DeviceConnected {
+		m.flashFlow.Connected(m.devicePath)
+	}
+}
+
+// startFlow starts the flash sequence set up by newFlow
+func (m *Model) startFlow() tea.Cmd {
+	return tea.Batch(
+		m.driveFlow(m.flashFlow.Start),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// driveFlow feeds the flash sequence with fn, returning the commands its
+// events called for
+func (m *Model) driveFlow(fn func()) tea.Cmd {
+	fn()
+	cmds := m.flowCmds
+	m.flowCmds = nil
+	return tea.Batch(cmds...)
+}
+
+// flowEvent acts on an event of the flash sequence
+func (m *Model) flowEvent(e flow.Event) {
+	switch e.Kind {
+	case flow.EventSideStarted:
+		m.flashTarget = m.targetName(e.Side)
+
+	case flow.EventWaitDisconnect:
+		m.state = StateWaitingDisconnect
+		if e.File > 0 {
+			m.logPanel.Add(LogWarning, "Reconnect "+m.flashTarget+" for "+filepath.Base(e.Path))
+		} else {
+			m.logPanel.Add(LogWarning, "Unplug device, then connect "+m.connectName())
+		}
+
+	case flow.EventWaitDevice:
+		if m.state == StateWaitingDisconnect {
+			m.logPanel.Add(LogInfo, "Now connect "+m.flashTarget+" half...")
+		} else {
+			m.logPanel.Add(LogInfo, "Connect "+m.connectName()+" and double-tap reset...")
+		}
+		m.state = StateWaitingDevice
+
+	case flow.EventFlash:
+		m.flashStep = e
+		m.flashPercent = 0
+		if m.qmkFlasher == nil && m.dfuFlasher == nil {
+			m.state = StateFlashing
+			m.logPanel.Add(LogInfo, "Flashing "+m.flashTarget)
+		}
+		if e.Files > 1 {
+			m.logPanel.Add(LogInfo, "File "+strconv.Itoa(e.File+1)+"/"+strconv.Itoa(e.Files)+": "+filepath.Base(e.Path))
+		}
+		switch {
+		case m.qmkFlasher != nil:
+			m.flowCmds = append(m.flowCmds, m.runQMKFlash())
+		case m.dfuFlasher != nil:
+			m.flowCmds = append(m.flowCmds, m.runDFUFlash(e.Path))
+		default:
+			m.flowCmds = append(m.flowCmds, m.copyFirmware(context.Background(), e.Path, e.Device))
+		}
+
+	case flow.EventFileFlashed:
+		m.logPanel.Add(LogSuccess, filepath.Base(e.Path)+" flashed")
+
+	case flow.EventSideFlashed:
+		m.logPanel.Add(LogSuccess, m.flashTarget+" flashed")
+		m.completedSteps = append(m.completedSteps, m.flashTarget+" flashed")
+		if m.session != nil {
+			m.session.MarkDone(e.Side)
+			m.saveSession()
+		}
+
+	case flow.EventRebooted:
+		m.logPanel.Add(LogSuccess, "Device rebooted")
+		// Files before the last of a side reboot back into the bootloader
+		if e.File+1 >= e.Files {
+			m.completedSteps = append(m.completedSteps, m.targetName(e.Side)+" rebooted")
+		}
+		if m.state == StateComplete {
+			m.finishReport(nil)
+		}
+
+	case flow.EventRebootTimeout:
+		warning := m.targetName(e.Side) + " still mounted after " + device.RebootTimeout.String() + "; the flash may not have taken"
+		m.notify(LogWarning, warning)
+		m.reportWarning(warning)
+		if m.state == StateComplete {
+			m.finishReport(nil)
+		}
+
+	case flow.EventComplete:
+		m.state = StateComplete
+		m.endSession()
+		m.notify(LogSuccess, "Flash complete")
+		// Otherwise the report waits for the last reboot, to record its warning
+		if !m.flashFlow.Rebooting() {
+			m.finishReport(nil)
+		}
+
+	case flow.EventFailed:
+		m.state = StateIdle
+		if e.Retry {
+			m.notifyFailure("Device removed while flashing " + m.flashTarget)
+			m.reportWarning("Device removed while flashing " + m.flashTarget)
+			m.confirmDialog = DeviceRemovedDialog(m.flashTarget)
+			m.confirmDialog.SetSize(m.width, m.height)
+			m.confirmAction = func() (tea.Model, tea.Cmd) {
+				return m, m.driveFlow(m.flashFlow.Retry)
+			}
 			m.showDialog = true
+			return
 		}
+		m.notifyFailure("Flash failed: " + e.Err.Error())
+		m.finishReport(e.Err)
 	}
+}
 
-	return m, nil
+// targetName names side as the flash sequence shows it
+func (m *Model) targetName(side string) string {
+	if m.resetPath != "" {
+		return side + " (reset)"
+	}
+	return side
 }
 
-func (m *Model) startBuild(target string) (tea.Model, tea.Cmd) {
-	if m.builder == nil {
-		m.logPanel.Add(LogError, "Build not enabled in config")
-		return m, nil
+// connectName names what to connect for the current side
+func (m *Model) connectName() string {
+	if m.cfg.Keyboard.Type != "split" {
+		return "keyboard"
 	}
+	return m.flashTarget
+}
 
-	// For Docker mode, check Docker is available first
-	if m.cfg.Build.Mode == "docker" {
-		ctx := context.Background()
-		if err := firmware.CheckDocker(ctx); err != nil {
-			m.logPanel.Add(LogError, err.Error())
-			return m, nil
+// checkFiles refuses to start flashing when a file could not be firmware,
+// before anyone unplugs a keyboard for it
+func (m *Model) checkFiles(paths []string) bool {
+	for _, path := range paths {
+		if err := firmware.CheckFirmwareFile(path, m.cfg.Flash.Extension(), m.cfg.Flash.MinSize); err != nil {
+			m.notifyFailure("Cannot flash: " + err.Error())
+			return false
 		}
 	}
+	return true
+}
 
-	m.state = StateBuilding
-	m.buildPercent = 0
-	m.buildTarget = target
-	m.startTime = time.Now()
-	m.logPanel.Add(LogInfo, "Building: "+target)
+// offerFlash asks to flash the selected build to a bootloader connected
+// while nothing was running, naming the side its board belongs to
+func (m *Model) offerFlash() {
+	if m.qmkFlasher != nil || m.dfuFlasher != nil || m.showDialog || m.showBuildMenu || m.showHelp || m.inputDialog != nil {
+		return
+	}
+	build := m.firmwarePanel.Selected()
+	if build == nil || len(build.Files) == 0 {
+		return
+	}
 
-	// Create progress channel
-	m.buildProgress = make(chan firmware.BuildProgress, 10)
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	side := sides[0]
+	if len(sides) > 1 {
+		side = ""
+		if info, err := firmware.ReadBootloaderInfo(m.devicePath); err == nil {
+			side = firmware.SideOfBoard(info, sides, m.cfg.Build.Boards(sides))
+		}
+	}
 
-	ctx := context.Background()
-	return m, tea.Batch(
-		func() tea.Msg {
-			// For Docker mode, ensure image is pulled first
-			if dockerBuilder, ok := m.builder.(*firmware.DockerBuilder); ok {
-				if err := dockerBuilder.EnsureImage(ctx, func(msg string) {
-					select {
-					case m.buildProgress <- firmware.BuildProgress{Percent: 0, Message: msg}:
-					default:
-					}
-				}); err != nil {
-					return buildCompleteMsg{result: firmware.BuildResult{Success: false, Error: err}}
-				}
+	missing := m.matcher.Missing(sides, build.Files)
+	var available []string
+	for _, s := range sides {
+		if !slices.Contains(missing, s) {
+			available = append(available, s)
+		}
+	}
+	if len(available) == 0 || side != "" && slices.Contains(missing, side) {
+		return // nothing to offer for this side
+	}
+
+	// The connected side first, then the later sides the build has files for
+	sequence := func(side string) []string {
+		seq := []string{side}
+		for _, s := range sides[slices.Index(sides, side)+1:] {
+			if !slices.Contains(missing, s) {
+				seq = append(seq, s)
 			}
+		}
+		return seq
+	}
+	flash := func(side string) (tea.Model, tea.Cmd) {
+		seq := sequence(side)
+		return m.confirmReflash(seq, func() (tea.Model, tea.Cmd) {
+			return m.flashConnected(seq)
+		})
+	}
 
-			result := m.builder.Build(ctx, target, func(p firmware.BuildProgress) {
-				// Send progress to channel (non-blocking)
-				select {
-				case m.buildProgress <- p:
-				default:
-				}
-			})
-			close(m.buildProgress)
-			return buildCompleteMsg{result: result}
-		},
-		m.listenForBuildProgress(),
-		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
-			return tickMsg{}
-		}),
-	)
+	if side != "" {
+		m.confirmDialog = ConnectedDialog(m.cfg.Device.Name, build.Title(), side)
+		m.confirmAction = func() (tea.Model, tea.Cmd) { return flash(side) }
+	} else {
+		// Both halves of a split often share a board, so the bootloader
+		// cannot tell them apart; the user says which is connected
+		dialog := ConnectedSideDialog(m.cfg.Device.Name, build.Title(), available)
+		m.confirmDialog = dialog
+		m.confirmAction = func() (tea.Model, tea.Cmd) {
+			i, _ := strconv.Atoi(dialog.Chosen())
+			return flash(available[i-1])
+		}
+	}
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.devicePrompt = m.confirmDialog
+	m.showDialog = true
 }
 
-// listenForBuildProgress listens for build progress updates
-func (m *Model) listenForBuildProgress() tea.Cmd {
-	return func() tea.Msg {
-		if m.buildProgress == nil {
-			return nil
+// flashConnected flashes the first of sides to the bootloader already
+// connected, then continues the sequence with the rest
+func (m *Model) flashConnected(sides []string) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("flash") {
+		return m, nil
+	}
+	return m.backupKeymap(func() (tea.Model, tea.Cmd) {
+		// The bootloader may have gone while the backup ran
+		if m.deviceStatus != DeviceConnected {
+			m.logPanel.Add(LogWarning, "Device disconnected; press f to flash")
+			return m, nil
 		}
-		progress, ok := <-m.buildProgress
-		if !ok {
-			return nil
+		if !m.beginFlash(sides, true) {
+			return m, nil
 		}
-		return buildProgressMsg{progress: progress}
+		return m, m.startFlow()
+	})
+}
+
+// backupKeymap archives keymap sources in the background when backups are
+// enabled, then runs next. The flash history of next references the
+// backup. A failed backup does not run next.
+func (m *Model) backupKeymap(next func() (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	if !m.cfg.Backup.Enabled {
+		return next()
+	}
+
+	var ctx context.Context
+	ctx, m.backupCancel = context.WithCancel(context.Background())
+	m.backupNext = next
+	m.logPanel.Add(LogInfo, "Backing up keymap...")
+
+	cfg := m.cfg
+	return m, func() tea.Msg {
+		dir, err := backup.Archive(ctx, cfg.Build.WorkingDir, cfg.Backup.Patterns, cfg.Backup.Dir, time.Now())
+		return backupDoneMsg{dir: dir, err: err}
 	}
 }
 
-func (m *Model) prepareFlash() (tea.Model, tea.Cmd) {
+// offerResume asks to finish a flash sequence an earlier run was
+// interrupted in, discarding sessions that can no longer be resumed
+func (m *Model) offerResume() {
+	if m.sessionPath == "" || m.qmkFlasher != nil {
+		return
+	}
+	s, err := session.Load(m.sessionPath)
+	if err != nil {
+		m.logPanel.Add(LogWarning, "Ignoring interrupted flash: "+err.Error())
+		return
+	}
+	if s == nil || s.Keyboard != m.cfg.Keyboard.Name {
+		return // another keyboard profile's session is left for it
+	}
+
+	remaining := s.Remaining()
+	if len(remaining) == 0 || !m.firmwarePanel.Select(s.Build) {
+		s.Clear()
+		return
+	}
+
 	build := m.firmwarePanel.Selected()
-	if build == nil || len(build.Files) == 0 {
-		m.logPanel.Add(LogError, "No firmware files found")
-		return m, nil
+	label := "the " + build.Title() + " build"
+	m.confirmDialog = ResumeDialog(label, s.Done, remaining[0])
+	m.confirmDialog.SetSize(m.width, m.height)
+	m.confirmAction = func() (tea.Model, tea.Cmd) {
+		return m.resumeFlash(s)
 	}
+	m.showDialog = true
+}
 
-	m.completedSteps = nil
-	m.flashIndex = 0
+// resumeFlash continues an interrupted flash sequence at its first remaining side
+func (m *Model) resumeFlash(s *session.Session) (tea.Model, tea.Cmd) {
+	if !m.guardIdle("resume flash") {
+		return m, nil
+	}
+	if !m.firmwarePanel.Select(s.Build) {
+		m.logPanel.Add(LogError, "Build of the interrupted flash is gone")
+		s.Clear()
+		return m, nil
+	}
 
 	sides := m.cfg.Keyboard.Sides
 	if len(sides) == 0 {
 		sides = []string{"main"}
 	}
+	remaining := s.Remaining()
+	if !slices.Contains(sides, remaining[0]) {
+		m.logPanel.Add(LogError, remaining[0]+" is no longer a configured side")
+		s.Clear()
+		return m, nil
+	}
+	build := m.firmwarePanel.Selected()
+	steps, ok := m.flowSteps(build, remaining)
+	if !ok {
+		s.Clear()
+		return m, nil
+	}
 
-	m.flashTarget = sides[0]
+	m.completedSteps = nil
+	for _, side := range s.Done {
+		m.completedSteps = append(m.completedSteps, side+" flashed")
+	}
+	m.resetPath = ""
 	m.startTime = time.Now()
+	m.startReport(build)
+	m.session = s
+	m.logPanel.Add(LogInfo, "Resuming flash at "+remaining[0])
+	m.newFlow(steps, false)
+	return m, m.startFlow()
+}
 
-	// Safety: always require disconnect-reconnect cycle to prevent flashing wrong side
-	targetName := m.flashTarget
-	if m.cfg.Keyboard.Type != "split" {
-		targetName = "keyboard"
+// saveSession persists the flash sequence, warning if it cannot be resumed
+func (m *Model) saveSession() {
+	if err := m.session.Save(); err != nil {
+		m.logPanel.Add(LogWarning, "Cannot save flash progress: "+err.Error())
 	}
+}
 
-	if m.deviceStatus == DeviceConnected {
-		// Device is connected - require disconnect first
-		m.state = StateWaitingDisconnect
-		m.logPanel.Add(LogWarning, "Unplug device, then connect "+targetName)
-	} else {
-		// Device already disconnected - wait for correct side to connect
-		m.state = StateWaitingDevice
-		m.logPanel.Add(LogInfo, "Connect "+targetName+" and double-tap reset...")
+// endSession forgets the flash sequence once it is finished or cancelled
+func (m *Model) endSession() {
+	if m.session == nil {
+		return
+	}
+	if err := m.session.Clear(); err != nil {
+		m.logPanel.Add(LogWarning, "Cannot clear flash progress: "+err.Error())
 	}
+	m.session = nil
+}
 
-	return m, tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
-		return tickMsg{}
+// awaitReboot gives the bootloader volume device.RebootTimeout to unmount
+// after a copy, which confirms the device rebooted
+func (m *Model) awaitReboot() tea.Cmd {
+	m.rebootSeq++
+	seq := m.rebootSeq
+	return tea.Tick(device.RebootTimeout, func(time.Time) tea.Msg {
+		return rebootTimeoutMsg{seq: seq}
 	})
 }
 
-func (m *Model) startFlash() (tea.Model, tea.Cmd) {
-	build := m.firmwarePanel.Selected()
-	if build == nil {
-		return m, nil
+// startReport begins recording a flash sequence of build (nil for qmk,
+// which builds as it flashes)
+func (m *Model) startReport(build *firmware.Build) {
+	m.finishReport(nil) // a sequence still awaiting its last reboot
+	m.flashReport = report.New(m.cfg.Keyboard.Name)
+	if build != nil {
+		m.flashReport.SetBuild(report.Build{
+			Name:   build.Title(),
+			Path:   build.Path,
+			Source: build.Source,
+			Notes:  build.Summary(),
+		})
 	}
+}
 
-	m.state = StateFlashing
-	m.flashPercent = 0
-	m.logPanel.Add(LogInfo, "Flashing "+m.flashTarget)
-
-	// Find the firmware file for this target
-	var filePath string
-	target := strings.ToLower(m.flashTarget)
-	for _, f := range build.Files {
-		fname := strings.ToLower(f.Name)
-		if strings.Contains(fname, target) {
-			filePath = f.Path
-			break
-		}
+// reportWarning records a warning in the flash sequence's report
+func (m *Model) reportWarning(msg string) {
+	if m.flashReport != nil {
+		m.flashReport.Warn(msg)
 	}
+}
 
-	// If no target-specific file found and only one file, use it
-	if filePath == "" && len(build.Files) == 1 {
-		filePath = build.Files[0].Path
+// finishReport ends the flash sequence's report, writing it when enabled
+func (m *Model) finishReport(err error) {
+	rep := m.flashReport
+	if rep == nil {
+		return
+	}
+	m.flashReport = nil
+	if !m.cfg.Report.Enabled {
+		return
 	}
+	rep.Finish(err)
+	path, werr := rep.Write(m.cfg.Report.Dir, m.cfg.Report.Format)
+	if werr != nil {
+		m.notify(LogWarning, "Cannot write report: "+werr.Error())
+		return
+	}
+	m.logPanel.Add(LogInfo, "Report written to "+path)
+}
 
-	if filePath == "" {
-		m.logPanel.Add(LogError, "No firmware file for "+m.flashTarget)
-		m.state = StateIdle
+// startQMKFlash flashes every configured side with the qmk CLI
+func (m *Model) startQMKFlash() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("flash") {
 		return m, nil
 	}
+	return m.backupKeymap(m.beginQMKFlash)
+}
 
-	ctx := context.Background()
-	return m, tea.Batch(
+// beginQMKFlash starts the qmk flash sequence once any keymap backup is
+// taken
+func (m *Model) beginQMKFlash() (tea.Model, tea.Cmd) {
+	m.completedSteps = nil
+	m.resetPath = ""
+	m.session = nil // qmk waits for each bootloader itself; nothing to resume
+
+	sides := m.cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	// qmk builds the firmware it flashes, so the steps have no files
+	steps := make([]flow.Step, len(sides))
+	for i, side := range sides {
+		steps[i] = flow.Step{Side: side}
+	}
+
+	m.startTime = time.Now()
+	m.startReport(nil)
+	m.newFlow(steps, false)
+	return m, m.startFlow()
+}
+
+// runQMKFlash runs `qmk flash` for the current flash target
+func (m *Model) runQMKFlash() tea.Cmd {
+	m.state = StateBuilding
+	m.buildPercent = 0
+	m.buildStage = firmware.BuildCompiling
+	m.buildTarget = m.flashTarget
+	m.flashPercent = 0
+	m.output = nil
+	m.logPanel.Add(LogInfo, "qmk flash: "+m.flashTarget)
+
+	var ctx context.Context
+	ctx, m.flashCancel = context.WithCancel(context.Background())
+	m.flashProgress = make(chan firmware.QMKProgress, 10)
+	m.flashResult = make(chan flashCompleteMsg, 1)
+	progress, done := m.flashProgress, m.flashResult
+
+	return tea.Batch(
+		func() tea.Msg {
+			start := time.Now()
+			result := m.qmkFlasher.Flash(ctx, func(p firmware.QMKProgress) {
+				// Stage changes must not be dropped, so block unless cancelled
+				select {
+				case progress <- p:
+				case <-ctx.Done():
+				}
+			})
+			// Delivered by the listener after the last output
+			done <- flashCompleteMsg{result: result, duration: time.Since(start)}
+			close(progress)
+			return nil
+		},
+		m.listenForQMKProgress(),
+		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+			return tickMsg{}
+		}),
+	)
+}
+
+// runDFUFlash writes path to the current target with dfu-util, which
+// waits for the bootloader itself
+func (m *Model) runDFUFlash(path string) tea.Cmd {
+	m.state = StateWaitingDevice
+	m.flashPercent = 0
+	m.output = nil
+	m.logPanel.Add(LogInfo, "Put "+m.flashTarget+" into DFU mode...")
+
+	var ctx context.Context
+	ctx, m.flashCancel = context.WithCancel(context.Background())
+	m.flashProgress = make(chan firmware.QMKProgress, 10)
+	m.flashResult = make(chan flashCompleteMsg, 1)
+	progress, done := m.flashProgress, m.flashResult
+
+	return tea.Batch(
 		func() tea.Msg {
-			result := m.flasher.Flash(ctx, filePath, m.devicePath)
-			return flashCompleteMsg{result: result}
+			start := time.Now()
+			result := m.dfuFlasher.Flash(ctx, path, func(p firmware.QMKProgress) {
+				select {
+				case progress <- p:
+				case <-ctx.Done():
+				}
+			})
+			done <- flashCompleteMsg{result: result, path: path, duration: time.Since(start)}
+			close(progress)
+			return nil
 		},
+		m.listenForQMKProgress(),
 		tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
 			return tickMsg{}
 		}),
 	)
 }
 
+// listenForQMKProgress listens for qmk flash or dfu-util output, then the
+// flash's result
+func (m *Model) listenForQMKProgress() tea.Cmd {
+	progress, done := m.flashProgress, m.flashResult
+	return func() tea.Msg {
+		if progress == nil {
+			return nil
+		}
+		p, ok := <-progress
+		if !ok {
+			return <-done
+		}
+		return qmkProgressMsg{progress: p}
+	}
+}
+
+// startGitCommitPush commits all working directory changes and pushes them
+func (m *Model) startGitCommitPush() (tea.Model, tea.Cmd) {
+	dir := m.cfg.Build.WorkingDir
+	m.logPanel.Add(LogInfo, "Committing keymap changes...")
+
+	return m, func() tea.Msg {
+		ctx := context.Background()
+		if err := git.CommitAll(ctx, dir, "Update keymap"); err != nil {
+			return gitDoneMsg{err: err}
+		}
+		return gitDoneMsg{err: git.Push(ctx, dir)}
+	}
+}
+
 func (m *Model) startFactoryReset() (tea.Model, tea.Cmd) {
+	if !m.guardIdle("factory reset") {
+		return m, nil
+	}
+	if m.dfuFlasher != nil {
+		m.logPanel.Add(LogError, "Factory reset needs a UF2 bootloader (flash.mode = \"copy\")")
+		return m, nil
+	}
 	build := m.firmwarePanel.Selected()
 	if build == nil {
 		return m, nil
@@ -612,48 +3311,109 @@ func (m *Model) startFactoryReset() (tea.Model, tea.Cmd) {
 		m.logPanel.Add(LogError, "No reset firmware found")
 		return m, nil
 	}
+	if !m.checkFiles([]string{resetPath}) {
+		return m, nil
+	}
 
 	m.completedSteps = nil
-	m.flashIndex = 0
+	m.resetPath = resetPath
+	m.session = nil // factory resets are not resumed
 	sides := m.cfg.Keyboard.Sides
 	if len(sides) == 0 {
 		sides = []string{"left", "right"}
 	}
-	m.flashTarget = sides[0] + " (reset)"
+	steps := make([]flow.Step, len(sides))
+	for i, side := range sides {
+		steps[i] = flow.Step{Side: side, Files: []string{resetPath}}
+	}
 	m.startTime = time.Now()
+	m.startReport(build)
 	m.logPanel.Add(LogWarning, "Factory reset started")
 
-	if m.deviceStatus == DeviceConnected {
-		m.state = StateFlashing
-		ctx := context.Background()
-		return m, m.flashReset(ctx, resetPath)
-	}
+	// A bootloader connected already is reset straight away
+	m.newFlow(steps, true)
+	return m, m.startFlow()
+}
 
-	m.state = StateWaitingDevice
-	return m, nil
+// copyFirmware copies path to the bootloader at devicePath, streaming
+// progress to the model
+func (m *Model) copyFirmware(ctx context.Context, path, devicePath string) tea.Cmd {
+	m.copyProgress = make(chan firmware.FlashProgress, 10)
+	progress := m.copyProgress
+
+	return tea.Batch(
+		func() tea.Msg {
+			start := time.Now()
+			result := m.flasher.Flash(ctx, path, devicePath, func(p firmware.FlashProgress) {
+				select {
+				case progress <- p:
+				default:
+				}
+			})
+			close(progress)
+			return flashCompleteMsg{result: result, path: path, duration: time.Since(start)}
+		},
+		m.listenForCopyProgress(),
+	)
 }
 
-func (m *Model) flashReset(ctx context.Context, resetPath string) tea.Cmd {
+// listenForPullProgress listens for image pull progress updates, returning
+// the pull's result once they end
+func (m *Model) listenForPullProgress() tea.Cmd {
+	progress, result := m.pullProgress, m.pullResult
 	return func() tea.Msg {
-		result := m.flasher.Flash(ctx, resetPath, m.devicePath)
-		return flashCompleteMsg{result: result}
+		if progress == nil {
+			return nil
+		}
+		p, ok := <-progress
+		if !ok {
+			return <-result
+		}
+		return pullProgressMsg{progress: p}
 	}
 }
 
-func (m *Model) updatePanelSizes() {
-	contentHeight := m.height - 4
+// listenForCopyProgress listens for flash copy progress updates
+func (m *Model) listenForCopyProgress() tea.Cmd {
+	progress := m.copyProgress
+	return func() tea.Msg {
+		if progress == nil {
+			return nil
+		}
+		p, ok := <-progress
+		if !ok {
+			return nil
+		}
+		return copyProgressMsg{progress: p}
+	}
+}
 
-	leftWidth := m.width * 30 / 100
-	centerWidth := m.width * 40 / 100
-	rightWidth := m.width - leftWidth - centerWidth - 6
+// panelSizes returns the width of each panel, indexed by Panel, and their
+// shared height. In compact mode each panel fills the screen below the tab bar.
+func (m *Model) panelSizes() ([3]int, int) {
+	height := m.height - 6
+	if m.compact {
+		width := m.width - 2
+		return [3]int{width, width, width}, height - 1
+	}
+	left := m.width * 30 / 100
+	center := m.width * 40 / 100
+	return [3]int{left, center, m.width - left - center - 6}, height
+}
+
+func (m *Model) updatePanelSizes() {
+	widths, contentHeight := m.panelSizes()
 
-	m.firmwarePanel.SetSize(leftWidth, contentHeight)
-	m.statusPanel.SetSize(centerWidth, contentHeight)
-	m.logPanel.SetSize(rightWidth, contentHeight)
+	m.firmwarePanel.SetSize(widths[PanelFirmware], contentHeight)
+	m.statusPanel.SetSize(widths[PanelStatus], contentHeight)
+	m.logPanel.SetSize(widths[PanelLog], contentHeight)
 	m.helpOverlay.SetSize(m.width, m.height)
 	if m.confirmDialog != nil {
 		m.confirmDialog.SetSize(m.width, m.height)
 	}
+	if m.inputDialog != nil {
+		m.inputDialog.SetSize(m.width, m.height)
+	}
 }
 
 // View renders the UI
@@ -680,12 +3440,23 @@ func (m *Model) View() string {
 	if m.showDialog && m.confirmDialog != nil {
 		return m.confirmDialog.View()
 	}
+	if m.inputDialog != nil {
+		return m.inputDialog.View()
+	}
 
-	return s.String()
+	// Toasts sit over the panels, just below the header
+	return m.toasts.Overlay(s.String(), m.width, lipgloss.Height(m.renderHeader()))
 }
 
 func (m *Model) renderHeader() string {
 	title := TitleStyle.Render("KB " + strings.ToUpper(m.cfg.Keyboard.Name))
+	if m.gitStatus != nil {
+		gitStyle := DimStyle
+		if m.gitStatus.Dirty {
+			gitStyle = WarningStyle
+		}
+		title += "  " + gitStyle.Render("⎇ "+m.gitStatus.String())
+	}
 
 	// Device status
 	var statusIcon, statusText string
@@ -696,6 +3467,9 @@ func (m *Model) renderHeader() string {
 	case DeviceWaiting:
 		statusIcon = WarningStyle.Render(StatusWaiting)
 		statusText = m.cfg.Device.Name + " Waiting..."
+	case DeviceUnreadable:
+		statusIcon = ErrorStyle.Render(StatusDisconnected)
+		statusText = m.cfg.Device.Name + " Unreadable"
 	default:
 		statusIcon = DimStyle.Render(StatusDisconnected)
 		statusText = m.cfg.Device.Name + " Disconnected"
@@ -721,20 +3495,20 @@ func (m *Model) renderHeader() string {
 }
 
 func (m *Model) renderPanels() string {
-	leftWidth := m.width * 30 / 100
-	centerWidth := m.width * 40 / 100
-	rightWidth := m.width - leftWidth - centerWidth - 6
-
-	contentHeight := m.height - 6
+	widths, contentHeight := m.panelSizes()
+	leftWidth, centerWidth, rightWidth := widths[PanelFirmware], widths[PanelStatus], widths[PanelLog]
 
 	// Firmware panel
 	firmwareStyle := PanelStyle.Width(leftWidth).Height(contentHeight)
 	if m.activePanel == PanelFirmware {
 		firmwareStyle = ActivePanelStyle.Width(leftWidth).Height(contentHeight)
 	}
-	firmwareTitle := " Firmware "
+	firmwareTitle := AccentStyle.Render(" Firmware ")
+	if m.firmwareUsage > 0 {
+		firmwareTitle += DimStyle.Render(firmware.FormatSize(m.firmwareUsage))
+	}
 	firmwareContent := m.firmwarePanel.View()
-	firmwarePanel := firmwareStyle.Render(AccentStyle.Render(firmwareTitle) + "\n\n" + firmwareContent)
+	firmwarePanel := firmwareStyle.Render(firmwareTitle + "\n\n" + firmwareContent)
 
 	// Status panel
 	statusStyle := PanelStyle.Width(centerWidth).Height(contentHeight)
@@ -742,36 +3516,45 @@ func (m *Model) renderPanels() string {
 		statusStyle = ActivePanelStyle.Width(centerWidth).Height(contentHeight)
 	}
 	statusTitle := " Status "
+	if step := m.runStep(); step > 0 {
+		statusTitle = " Run " + formatInt(step) + "/" + formatInt(1+len(m.runSides())) + " "
+	}
 	var statusContent string
 	switch m.state {
 	case StateIdle:
-		statusContent = m.statusPanel.ViewIdle(m.firmwarePanel.Selected())
+		build := m.firmwarePanel.Selected()
+		statusContent = m.statusPanel.ViewIdle(build, m.sideSizes(build))
+	case StateCheckingDocker:
+		statusContent = m.statusPanel.ViewCheckingDocker()
 	case StateBuilding:
-		statusContent = m.statusPanel.ViewBuilding(m.buildPercent, m.buildTarget)
+		stage := m.buildStage.String()
+		if m.pullLayers != "" {
+			stage = "Pulling image, " + m.pullLayers
+		}
+		statusContent = m.statusPanel.ViewBuilding(m.buildPercent, m.buildTarget, stage, time.Since(m.startTime), m.buildAverage)
+		if m.showOutput {
+			statusContent = m.statusPanel.ViewOutput(statusContent, m.output)
+		}
+	case StateUpdating:
+		statusContent = m.statusPanel.ViewUpdating(m.westProjects, m.westMessage, time.Since(m.startTime))
+		if m.showOutput {
+			statusContent = m.statusPanel.ViewOutput(statusContent, m.output)
+		}
 	case StateWaitingDisconnect:
-		statusContent = m.statusPanel.ViewWaitingDisconnect(m.flashTarget)
+		statusContent = m.statusPanel.ViewWaitingDisconnect(m.flashTarget, time.Since(m.startTime))
 	case StateWaitingDevice:
-		statusContent = m.statusPanel.ViewWaiting(m.flashTarget)
+		statusContent = m.statusPanel.ViewWaiting(m.flashTarget, time.Since(m.startTime))
 	case StateFlashing:
-		build := m.firmwarePanel.Selected()
 		filename := ""
-		if build != nil && len(build.Files) > 0 {
-			// Find matching file
-			target := strings.ToLower(m.flashTarget)
-			for _, f := range build.Files {
-				if strings.Contains(strings.ToLower(f.Name), target) {
-					filename = f.Name
-					break
-				}
-			}
-			if filename == "" && len(build.Files) == 1 {
-				filename = build.Files[0].Name
-			}
+		if m.qmkFlasher != nil {
+			filename = m.cfg.Flash.QMKKeyboard + ":" + m.cfg.Flash.QMKKeymap
+		} else if m.flashStep.Path != "" {
+			filename = filepath.Base(m.flashStep.Path)
 		}
-		statusContent = m.statusPanel.ViewFlashing(m.flashPercent, filename, m.flashTarget)
+		statusContent = m.statusPanel.ViewFlashing(m.flashPercent, filename, m.flashTarget, time.Since(m.startTime))
 	case StateComplete:
 		duration := time.Since(m.startTime)
-		statusContent = m.statusPanel.ViewComplete(duration, m.completedSteps)
+		statusContent = m.statusPanel.ViewComplete(duration, m.completedSteps, m.buildNote)
 	}
 	statusPanel := statusStyle.Render(AccentStyle.Render(statusTitle) + "\n\n" + statusContent)
 
@@ -784,28 +3567,63 @@ func (m *Model) renderPanels() string {
 	logContent := m.logPanel.View()
 	logPanel := logStyle.Render(AccentStyle.Render(logTitle) + "\n\n" + logContent)
 
+	if m.compact {
+		panels := [3]string{firmwarePanel, statusPanel, logPanel}
+		return m.renderTabs() + "\n" + panels[m.activePanel]
+	}
 	return lipgloss.JoinHorizontal(lipgloss.Top, firmwarePanel, statusPanel, logPanel)
 }
 
+// renderTabs renders the compact mode tab bar, highlighting the active panel
+func (m *Model) renderTabs() string {
+	var tabs []string
+	for i, name := range []string{"Firmware", "Status", "Log"} {
+		tab := " " + strconv.Itoa(i+1) + " " + name + " "
+		if Panel(i) == m.activePanel {
+			tabs = append(tabs, SelectedStyle.Render(tab))
+		} else {
+			tabs = append(tabs, DimStyle.Render(tab))
+		}
+	}
+	return " " + strings.Join(tabs, DimStyle.Render("│"))
+}
+
 func (m *Model) renderFooter() string {
 	var hints []string
 
 	switch m.state {
 	case StateIdle:
+		if m.firmwarePanel.Searching() {
+			hints = []string{"Type to filter", "↑/↓ Navigate", "Enter Keep", "Esc Clear"}
+			break
+		}
 		hints = []string{
 			"j/k Navigate",
 			"Enter Select",
 		}
 		if m.cfg.Build.Enabled {
-			hints = append(hints, "b Build")
+			hints = append(hints, "b Build", "w West update")
+		}
+		hints = append(hints, "f Flash", "/ Filter", "t Tag", "x Clean")
+		if m.remote != nil {
+			hints = append(hints, "u Sync")
 		}
-		hints = append(hints, "f Flash")
 		if m.cfg.Keyboard.Type == "split" {
 			hints = append(hints, "r Reset")
 		}
+		if m.gitStatus != nil && m.gitStatus.Dirty {
+			hints = append(hints, "g Commit")
+		}
+		if m.root != nil {
+			hints = append(hints, "p Keyboard")
+		}
 		hints = append(hints, "q Quit")
+	case StateCheckingDocker:
+		hints = []string{"Checking Docker...", "Esc Cancel"}
 	case StateBuilding:
-		hints = []string{"Building..."}
+		hints = []string{"Building...", m.outputHint()}
+	case StateUpdating:
+		hints = []string{"Updating west modules...", m.outputHint()}
 	case StateWaitingDisconnect:
 		hints = []string{"Unplug device to continue", "Esc Cancel"}
 	case StateWaitingDevice:
@@ -816,9 +3634,14 @@ func (m *Model) renderFooter() string {
 		hints = []string{"Enter Continue", "q Quit"}
 	}
 
-	left := DimStyle.Render(strings.Join(hints, "   "))
 	right := DimStyle.Render("? Help")
 
+	// Drop trailing hints that would wrap a narrow terminal
+	for len(hints) > 1 && lipgloss.Width(strings.Join(hints, "   "))+lipgloss.Width(right)+3 > m.width {
+		hints = hints[:len(hints)-1]
+	}
+	left := DimStyle.Render(strings.Join(hints, "   "))
+
 	spacing := m.width - lipgloss.Width(left) - lipgloss.Width(right) - 2
 	if spacing < 1 {
 		spacing = 1
@@ -827,6 +3650,22 @@ func (m *Model) renderFooter() string {
 	return " " + left + strings.Repeat(" ", spacing) + right
 }
 
+// outputHint is the footer hint for the o key while building
+func (m *Model) outputHint() string {
+	if m.showOutput {
+		return "o Hide output"
+	}
+	return "o Show output"
+}
+
+// formatSizeDelta formats a byte delta with an explicit sign
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + firmware.FormatSize(-delta)
+	}
+	return "+" + firmware.FormatSize(delta)
+}
+
 func formatInt(n int) string {
 	if n == 0 {
 		return "0"
@@ -0,0 +1,653 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/dockertest"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/flashlog"
+	"github.com/moby/moby/api/types/jsonstream"
+)
+
+// flashed waits until side's flash completes
+func (d *driver) flashed(side string) {
+	d.t.Helper()
+	d.waitFor(side+" flashed", func(m *Model) bool {
+		return slices.Contains(m.completedSteps, side+" flashed")
+	})
+}
+
+func TestModel_FlashSplit(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+
+	d.press("f")
+	d.waitState(StateWaitingDevice)
+	if d.m.flashTarget != "left" {
+		t.Fatalf("flashTarget = %q, want left first", d.m.flashTarget)
+	}
+
+	d.device.Plug()
+	d.flashed("left")
+
+	// The flash reboots the left half; the right one is next
+	d.waitState(StateWaitingDevice)
+	if d.m.flashTarget != "right" {
+		t.Fatalf("flashTarget = %q, want right", d.m.flashTarget)
+	}
+	d.device.Plug()
+	d.waitState(StateComplete)
+	d.waitFor("the last reboot", func(m *Model) bool {
+		return slices.Contains(m.completedSteps, "right rebooted")
+	})
+
+	want := []string{"left flashed", "left rebooted", "right flashed", "right rebooted"}
+	if !slices.Equal(d.m.completedSteps, want) {
+		t.Errorf("completedSteps = %q, want %q", d.m.completedSteps, want)
+	}
+	build := d.m.firmwarePanel.Selected()
+	for _, side := range []string{"left", "right"} {
+		file := d.m.matcher.Match(side, build.Files)
+		if _, ok := d.m.flashLog.Flashed(flashlog.Key(d.m.cfg.Keyboard.Name, side), file.Path); !ok {
+			t.Errorf("flash history has no %s flash of %s", side, file.Name)
+		}
+	}
+
+	d.press("enter")
+	if d.m.state != StateIdle {
+		t.Errorf("state after enter = %s, want idle", strconvState(d.m.state))
+	}
+}
+
+func TestModel_FlashBackup(t *testing.T) {
+	var workDir string
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Backup.Enabled = true
+		cfg.Backup.Dir = filepath.Join(t.TempDir(), "backups")
+		cfg.Backup.Patterns = []string{"config/*.keymap"}
+		workDir = cfg.Build.WorkingDir
+	})
+	if err := os.MkdirAll(filepath.Join(workDir, "config"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "config", "corne.keymap"), []byte("/ {};"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d.start()
+
+	// The backup runs in the background; the flash waits for it
+	d.press("f")
+	if d.m.state != StateIdle || d.m.operation() != "backing up the keymap" {
+		t.Fatalf("state after f = %s (%q), want idle while backing up", strconvState(d.m.state), d.m.operation())
+	}
+	d.waitState(StateWaitingDevice)
+	if !d.logged("Keymap backed up to") {
+		t.Fatalf("flash started without a backup; log:\n%s", d.log())
+	}
+
+	d.device.Plug()
+	d.flashed("left")
+	e := d.m.flashLog.Sides[flashlog.Key(d.m.cfg.Keyboard.Name, "left")]
+	if e.Backup == "" {
+		t.Fatal("flash history does not reference the backup")
+	}
+	if _, err := os.Stat(filepath.Join(e.Backup, "config", "corne.keymap")); err != nil {
+		t.Errorf("backup referenced by the flash history: %v", err)
+	}
+}
+
+func TestModel_UnplugFirst(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+
+	// A bootloader connected while idle is offered, not flashed
+	d.device.Plug()
+	d.waitFor("the connected offer", func(m *Model) bool {
+		return m.showDialog && m.confirmDialog == m.devicePrompt
+	})
+	d.press("esc")
+
+	// Safety: f never flashes the bootloader already connected
+	d.press("f")
+	d.waitState(StateWaitingDisconnect)
+	d.settle(50 * time.Millisecond)
+	if d.m.state != StateWaitingDisconnect || d.logged("Flashing") {
+		t.Fatalf("flashed without a reconnect; log:\n%s", d.log())
+	}
+
+	d.device.Unplug()
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.flashed("left")
+}
+
+func TestModel_FlashConnected(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+
+	d.device.Plug()
+	d.waitFor("the connected offer", func(m *Model) bool {
+		return m.showDialog && m.confirmDialog == m.devicePrompt
+	})
+
+	// The simulated bootloader does not say which side it is, so kbflash
+	// asks instead of guessing
+	d.press("f")
+	d.settle(50 * time.Millisecond)
+	if !d.m.showDialog || d.logged("Flashing") {
+		t.Fatalf("flashed a side kbflash guessed; log:\n%s", d.log())
+	}
+	d.press("1")
+	d.flashed("left")
+	d.waitState(StateWaitingDevice)
+	if d.m.flashTarget != "right" {
+		t.Errorf("flashTarget = %q, want right after the connected left", d.m.flashTarget)
+	}
+}
+
+func TestModel_Run(t *testing.T) {
+	d := newDriver(t, nil)
+	d.m.SetRun("all")
+	d.start()
+
+	d.waitState(StateWaitingDevice)
+	if !d.logged("Build complete") {
+		t.Fatalf("flash started before the build finished; log:\n%s", d.log())
+	}
+	if step := d.m.runStep(); step != 2 {
+		t.Errorf("runStep = %d, want 2 for the first side", step)
+	}
+	built := d.m.firmwarePanel.Selected()
+	if built == nil || built.Path != d.m.builtDir {
+		t.Errorf("selected build = %v, want the new build in %s", built, d.m.builtDir)
+	}
+
+	d.device.Plug()
+	d.flashed("left")
+	d.waitState(StateWaitingDevice)
+	if step := d.m.runStep(); step != 3 {
+		t.Errorf("runStep = %d, want 3 for the second side", step)
+	}
+	d.device.Plug()
+	d.waitState(StateComplete)
+}
+
+func TestModel_CancelWaiting(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+
+	d.press("f")
+	d.waitState(StateWaitingDevice)
+	d.press("esc")
+	if d.m.state != StateIdle || !d.logged("Cancelled") {
+		t.Fatalf("state after esc = %s, want idle", strconvState(d.m.state))
+	}
+
+	d.device.Plug()
+	d.settle(50 * time.Millisecond)
+	if d.m.state != StateIdle || d.logged("Flashing") {
+		t.Errorf("a cancelled flash went ahead; log:\n%s", d.log())
+	}
+}
+
+func TestModel_DeviceRemoved(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+	d.flash.Err = firmware.ErrDeviceRemoved
+
+	d.press("f")
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.waitFor("the device removed dialog", func(m *Model) bool {
+		return m.showDialog && m.confirmDialog != nil && m.confirmDialog.Hotkey() == "r"
+	})
+	if d.m.state != StateIdle {
+		t.Errorf("state = %s, want idle while the dialog is up", strconvState(d.m.state))
+	}
+
+	// Retry flashes the same side once it is reconnected
+	d.flash.Err = nil
+	d.press("r")
+	d.waitState(StateWaitingDisconnect)
+	d.device.Unplug()
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.flashed("left")
+}
+
+func TestModel_FactoryReset(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+	build := d.m.firmwarePanel.Selected()
+	reset := firmware.File{Name: "settings_reset.uf2", Path: build.Files[0].Path}
+	d.m.firmwarePanel.builds[d.m.firmwarePanel.selected].Files = append(build.Files, reset)
+
+	d.press("r")
+	d.press("enter") // the dialog defaults to cancel
+	if d.m.state != StateIdle {
+		t.Fatalf("state = %s, want idle after cancelling the reset", strconvState(d.m.state))
+	}
+
+	d.press("r")
+	d.m.confirmDialog.MoveLeft()
+	d.press("enter")
+	d.waitState(StateWaitingDevice)
+	if d.m.flashTarget != "left (reset)" {
+		t.Errorf("flashTarget = %q, want left (reset)", d.m.flashTarget)
+	}
+	d.device.Plug()
+	d.flashed("left (reset)")
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.waitState(StateComplete)
+	if d.m.session != nil {
+		t.Error("a factory reset left a session to resume")
+	}
+}
+
+func TestModel_RestoreKnownGood(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+	flashes, err := flashlog.Load(filepath.Join(t.TempDir(), "flashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.m.flashLog = flashes
+
+	d.press("R")
+	if d.m.showDialog || !d.logged("No known good firmware") {
+		t.Fatalf("R with nothing marked: dialog %v, log:\n%s", d.m.showDialog, d.log())
+	}
+
+	d.press("f")
+	d.device.Plug()
+	d.flashed("left")
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.waitState(StateComplete)
+	d.press("enter")
+	d.press("K")
+	if !d.logged("known good on left") || !d.logged("known good on right") {
+		t.Fatalf("K did not mark both sides:\n%s", d.log())
+	}
+
+	// The archive outlives the build it came from
+	build := d.m.firmwarePanel.Selected()
+	if err := os.RemoveAll(build.Path); err != nil {
+		t.Fatal(err)
+	}
+	d.press("R")
+	if !d.m.showDialog {
+		t.Fatal("R did not ask before restoring")
+	}
+	d.m.confirmDialog.MoveLeft()
+	d.press("enter")
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.flashed("left")
+	d.waitState(StateWaitingDevice)
+	d.device.Plug()
+	d.waitState(StateComplete)
+
+	for _, side := range []string{"left", "right"} {
+		key := flashlog.Key(d.m.cfg.Keyboard.Name, side)
+		good, _ := d.m.flashLog.KnownGood(key)
+		if got := d.m.flashLog.Sides[key].File; got != good.File {
+			t.Errorf("%s flashed from %s, want the known good %s", side, got, good.File)
+		}
+	}
+}
+
+func TestModel_PullRetry(t *testing.T) {
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Build.Mode = "docker"
+	})
+	d.start()
+
+	// Fake Docker daemon whose first pull fails partway and second succeeds
+	engine := dockertest.Start(t)
+	pulls := 0
+	engine.Pull = func(ctx context.Context, image string, send func(jsonstream.Message)) error {
+		pulls++
+		send(jsonstream.Message{ID: "a1b2c3d4e5f6", Status: "Pull complete"})
+		if pulls == 1 {
+			send(jsonstream.Message{ID: "0123456789ab", Status: "Downloading", Progress: &jsonstream.Progress{Current: 1 << 20, Total: 4 << 20}})
+			return errors.New("unexpected EOF")
+		}
+		send(jsonstream.Message{ID: "0123456789ab", Status: "Pull complete"})
+		return nil
+	}
+	engine.Run = func(p *dockertest.Process) int {
+		dir := filepath.Join(p.Container.Mount("/workdir"), "build", "left", "zephyr")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "zmk.uf2"), []byte("uf2"), 0644)
+		return 0
+	}
+	d.m.builder = firmware.NewDockerBuilder("zmk-image", d.m.cfg.Build.Board, d.m.cfg.Build.Shield, d.m.cfg.Build.WorkingDir, d.m.cfg.Build.FirmwareDir)
+
+	_, cmd := d.m.startBuild("left")
+	d.run(cmd)
+	d.waitFor("the retry dialog", func(m *Model) bool {
+		return m.showDialog && m.confirmDialog != nil && m.confirmDialog.Hotkey() == "r"
+	})
+	if !d.logged("Image pull failed") {
+		t.Errorf("the failed pull was not logged; log:\n%s", d.log())
+	}
+
+	// The retry resumes the pull and goes on to build
+	d.press("r")
+	d.waitFor("the build", func(m *Model) bool {
+		return m.state == StateIdle && d.logged("Build complete")
+	})
+	if !slices.Contains(d.m.output, "0123456789ab: Pull complete") {
+		t.Errorf("output = %q, want the retried pull's layers", d.m.output)
+	}
+}
+
+func TestModel_CleanBuild(t *testing.T) {
+	d := newDriver(t, nil)
+	d.start()
+	workDir := d.m.cfg.Build.WorkingDir
+	for _, side := range []string{"left", "right"} {
+		if err := os.MkdirAll(filepath.Join(workDir, "build", side), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.m.builder = firmware.NewBuilder("west", []string{"build", "-d", "build/{{side}}"}, workDir)
+
+	d.press("b", "c", "1")
+	if !d.m.showDialog || d.m.confirmDialog == nil {
+		t.Fatal("cleaning left asked for no confirmation")
+	}
+	d.m.confirmDialog.MoveLeft()
+	d.press("enter")
+	d.waitFor("the clean", func(m *Model) bool { return d.logged("Cleaned build files for left") })
+
+	if _, err := os.Stat(filepath.Join(workDir, "build", "left")); !os.IsNotExist(err) {
+		t.Error("build/left was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "build", "right")); err != nil {
+		t.Error("cleaning left removed build/right")
+	}
+
+	// The menu builds again the next time it opens
+	d.press("b")
+	if d.m.buildMenuDialog.Cleaning() {
+		t.Error("the build menu reopened in clean mode")
+	}
+}
+
+func TestModel_QMKFlashOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	bin := t.TempDir()
+	script := `#!/bin/bash
+echo "Compiling: keyboards/crkbd/keymaps/default/keymap.c"
+echo "keymap.c:12:5: error: 'KC_NOPE' undeclared"
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(bin, "qmk"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Flash.Mode = "qmk"
+		cfg.Flash.QMKKeyboard = "crkbd/rev1"
+		cfg.Flash.QMKKeymap = "default"
+	})
+	d.start()
+	d.press("f")
+	d.waitFor("the failed flash", func(m *Model) bool { return d.logged("exit status 1") })
+
+	// The compiler's error reaches the output panel and the log
+	if !slices.Contains(d.m.output, "keymap.c:12:5: error: 'KC_NOPE' undeclared") {
+		t.Errorf("output = %q, want the qmk compile output", d.m.output)
+	}
+	if !d.logged("error: 'KC_NOPE' undeclared") {
+		t.Errorf("log lacks the compile error:\n%s", d.log())
+	}
+}
+
+func TestModel_CancelGitPull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	// A remote that never answers
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte("#!/bin/bash\n[ \"$1\" = pull ] && exec sleep 30\nexit 128\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	d := newDriver(t, nil)
+	d.start()
+	_, cmd := d.m.startGitPull("left")
+	d.run(cmd)
+	if d.m.state != StateBuilding {
+		t.Fatalf("state = %s, want building while pulling", strconvState(d.m.state))
+	}
+
+	d.press("esc")
+	if d.m.state != StateIdle || !d.logged("Cancelled") {
+		t.Fatalf("state after esc = %s, want idle", strconvState(d.m.state))
+	}
+	d.settle(100 * time.Millisecond)
+	if d.m.state != StateIdle || d.logged("Building") {
+		t.Errorf("the cancelled pull went on to build; log:\n%s", d.log())
+	}
+}
+
+func TestModel_RemoteSync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	// Fake aws CLI keeping the bucket in a directory, holding a build made
+	// on another machine
+	bucket := t.TempDir()
+	other := filepath.Join(bucket, "20250301")
+	os.MkdirAll(other, 0755)
+	for _, name := range []string{"corne_left.uf2", "corne_right.uf2"} {
+		os.WriteFile(filepath.Join(other, name), []byte("uf2"), 0644)
+		firmware.UpdateManifest(filepath.Join(other, name))
+	}
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "aws"), []byte(`#!/bin/bash
+args=()
+for a in "${@:3}"; do
+	case "$a" in --*) ;; s3://bucket/*) args+=("`+bucket+`/${a#s3://bucket/}") ;; *) args+=("$a") ;; esac
+done
+case "$2" in
+ls) for d in "${args[0]}"*/; do [ -d "$d" ] && echo "PRE $(basename "$d")/"; done ;;
+sync) rm -rf "${args[1]}" && mkdir -p "${args[1]}" && cp -r "${args[0]}"/. "${args[1]}" ;;
+cp) cat "${args[0]}" ;;
+esac
+`), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	remoteDir := t.TempDir()
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Build.Remote = config.RemoteConfig{URL: "s3://bucket", Upload: true, Dir: remoteDir}
+		cfg.Build.Sources = append(cfg.Build.Sources, config.FirmwareSource{Label: config.RemoteSourceLabel, Dir: remoteDir})
+	})
+	d.start()
+
+	// The other machine's build is downloaded and listed on startup
+	d.waitFor("the remote build", func(m *Model) bool {
+		return slices.ContainsFunc(m.firmwarePanel.builds, func(b firmware.Build) bool {
+			return b.Source == config.RemoteSourceLabel && b.Name == "20250301"
+		})
+	})
+	if !d.logged("Downloaded remote build 20250301") {
+		t.Errorf("the download was not logged; log:\n%s", d.log())
+	}
+
+	// A build made here is uploaded
+	_, cmd := d.m.startBuild("left")
+	d.run(cmd)
+	d.waitFor("the upload", func(m *Model) bool {
+		return d.logged("Uploaded") || d.logged("Upload failed")
+	})
+	if !d.logged("Uploaded") {
+		t.Fatalf("the build was not uploaded; log:\n%s", d.log())
+	}
+	entries, _ := os.ReadDir(bucket)
+	if len(entries) != 2 {
+		t.Errorf("bucket has %d builds, want the local build beside the remote one", len(entries))
+	}
+}
+
+func TestModel_StatusFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Status = config.StatusConfig{Enabled: true, Path: path}
+	})
+	text := filepath.Join(filepath.Dir(path), "status.txt")
+	d.start()
+	if data, _ := os.ReadFile(text); string(data) != "idle\n" {
+		t.Errorf("status.txt = %q, want idle", data)
+	}
+
+	d.press("f")
+	d.waitState(StateWaitingDevice)
+	if data, _ := os.ReadFile(text); string(data) != "waiting for left\n" {
+		t.Errorf("status.txt = %q, want waiting for left", data)
+	}
+
+	d.press("esc")
+	d.waitState(StateIdle)
+	d.press("q")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("quitting left the status file")
+	}
+}
+
+func TestModel_EditKeymap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows")
+	}
+	var keymap string
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Build.KeymapDrawer.Keymap = "config/corne.keymap"
+		keymap = filepath.Join(cfg.Build.WorkingDir, "config", "corne.keymap")
+	})
+	if err := os.MkdirAll(filepath.Dir(keymap), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keymap, []byte("/ { keymap { }; };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	editor := filepath.Join(bin, "editor")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\necho '// edited' >> \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+	// The driver has no terminal to hand over, so the editor just runs
+	d.m.execProcess = func(c *exec.Cmd, fn tea.ExecCallback) tea.Cmd {
+		return func() tea.Msg { return fn(c.Run()) }
+	}
+	d.start()
+
+	d.press("e")
+	d.waitFor("the rebuild prompt", func(m *Model) bool { return m.showDialog })
+	if data, _ := os.ReadFile(keymap); !strings.Contains(string(data), "// edited") {
+		t.Fatalf("keymap = %q, want the editor's change", data)
+	}
+	if !d.logged("Saved corne.keymap") {
+		t.Errorf("the edit was not logged; log:\n%s", d.log())
+	}
+	// Both halves are built from the keymap
+	d.press("b")
+	d.waitState(StateBuilding)
+	if d.m.buildTarget != "all" {
+		t.Errorf("rebuilding %q, want all", d.m.buildTarget)
+	}
+	d.waitFor("the build", func(m *Model) bool { return m.state != StateBuilding })
+
+	// Quitting the editor without saving offers nothing
+	t.Setenv("EDITOR", "true")
+	d.press("esc")
+	d.waitState(StateIdle)
+	d.press("e")
+	d.waitFor("the editor", func(m *Model) bool { return d.logged("corne.keymap unchanged") })
+	if d.m.showDialog {
+		t.Error("an unchanged keymap offered a rebuild")
+	}
+}
+
+func TestModel_WatchRebuilds(t *testing.T) {
+	var keymap string
+	d := newDriver(t, func(cfg *config.Config) {
+		cfg.Build.KeymapDrawer.Keymap = "config/corne.keymap"
+		cfg.Build.Watch = config.WatchConfig{
+			Enabled:  true,
+			Patterns: config.DefaultWatchPatterns,
+			Debounce: config.Duration(10 * time.Millisecond),
+		}
+		keymap = filepath.Join(cfg.Build.WorkingDir, "config", "corne.keymap")
+		if err := os.MkdirAll(filepath.Dir(keymap), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keymap, []byte("/ { };\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	d.m.watcher.SetInterval(5 * time.Millisecond)
+	d.start()
+
+	if err := os.WriteFile(keymap, []byte("/ { keymap { }; };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.waitFor("the rebuild", func(m *Model) bool { return d.logged("New build ready") })
+	if !d.logged("Changed: config/corne.keymap, rebuilding all") {
+		t.Errorf("the change was not logged; log:\n%s", d.log())
+	}
+	selected := d.m.firmwarePanel.Selected()
+	if selected == nil || d.m.firmwarePanel.ready != selected.Path {
+		t.Fatalf("the new build is not selected and marked ready")
+	}
+	if !strings.Contains(d.m.firmwarePanel.View(), "new build ready") {
+		t.Error("the firmware panel does not show the new build")
+	}
+	if d.m.inputDialog != nil {
+		t.Error("a watched build asked for a note")
+	}
+
+	// Flashing it clears the mark
+	d.press("f")
+	d.waitState(StateWaitingDevice)
+	if d.m.firmwarePanel.ready != "" {
+		t.Error("the flashed build is still marked ready")
+	}
+}
+
+func TestFirmwarePanel_NotesWidth(t *testing.T) {
+	p := NewFirmwarePanel()
+	p.SetSize(50, 10)
+	p.SetBuilds([]firmware.Build{{Name: "20250102", Path: "/fw/20250102", Notes: strings.Repeat("键盘固件", 20)}})
+
+	// Wide notes are cut on display width, never inside a character
+	line := strings.Split(p.View(), "\n")[0]
+	if w := ansi.StringWidth(line); w > 50 {
+		t.Errorf("build line is %d columns wide, want at most 50: %q", w, ansi.Strip(line))
+	}
+	if !utf8.ValidString(line) || !strings.Contains(line, "…") {
+		t.Errorf("notes not truncated cleanly: %q", ansi.Strip(line))
+	}
+}
@@ -2,10 +2,13 @@ package ui
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/dhavalsavalia/kbflash/internal/firmware"
 )
 
@@ -36,6 +39,8 @@ type LogEntry struct {
 	Time    time.Time
 	Message string
 	Level   LogLevel
+
+	highlighted bool // the failure the log panel was focused for
 }
 
 // LogLevel for log entries
@@ -50,10 +55,21 @@ const (
 
 // FirmwarePanel renders the firmware list
 type FirmwarePanel struct {
-	builds   []firmware.Build
+	all      []firmware.Build // every scanned build
+	builds   []firmware.Build // builds shown, those with the filter tag
 	selected int
+	offset   int // first build shown when the list is taller than the panel
 	height   int
 	width    int
+	loading  bool // a scan is in progress
+
+	staleDays int    // builds older than this many days are flagged, 0 for never
+	ready     string // path of a build the watcher made that is not flashed yet
+
+	tagsOf    func(path string) []string // tags of a build, nil for none
+	filter    string                     // only show builds with this tag, "" for all
+	query     string                     // only show builds matching this search, "" for all
+	searching bool                       // the search query is being typed
 }
 
 // NewFirmwarePanel creates a new firmware panel
@@ -65,15 +81,152 @@ func NewFirmwarePanel() *FirmwarePanel {
 
 // SetBuilds updates the firmware builds list
 func (p *FirmwarePanel) SetBuilds(builds []firmware.Build) {
-	p.builds = builds
-	if p.selected >= len(builds) {
-		p.selected = len(builds) - 1
+	p.all = builds
+	p.refilter("")
+}
+
+// SetTags sets how build tags are looked up
+func (p *FirmwarePanel) SetTags(tagsOf func(path string) []string) {
+	p.tagsOf = tagsOf
+}
+
+// SetReady marks the build at path as a new build ready to flash, or
+// clears the mark for ""
+func (p *FirmwarePanel) SetReady(path string) {
+	p.ready = path
+}
+
+// SetStaleDays sets the age in days past which builds are flagged as stale
+func (p *FirmwarePanel) SetStaleDays(days int) {
+	p.staleDays = days
+}
+
+// SetFilter shows only builds tagged tag, or every build for "".
+// The selection stays on the selected build when it is still shown.
+func (p *FirmwarePanel) SetFilter(tag string) {
+	var selectedPath string
+	if sel := p.Selected(); sel != nil {
+		selectedPath = sel.Path
+	}
+	p.filter = tag
+	p.refilter(selectedPath)
+}
+
+// Filter returns the tag builds are filtered by, "" when showing all
+func (p *FirmwarePanel) Filter() string {
+	return p.filter
+}
+
+// SetQuery shows only builds matching query (see firmware.Build.Matches),
+// or every build for "". The selection stays on the selected build when it
+// is still shown.
+func (p *FirmwarePanel) SetQuery(query string) {
+	var selectedPath string
+	if sel := p.Selected(); sel != nil {
+		selectedPath = sel.Path
+	}
+	p.query = query
+	p.refilter(selectedPath)
+}
+
+// Query returns the search builds are filtered by, "" when showing all
+func (p *FirmwarePanel) Query() string {
+	return p.query
+}
+
+// SetSearching shows or hides the cursor of the search being typed
+func (p *FirmwarePanel) SetSearching(searching bool) {
+	p.searching = searching
+}
+
+// Searching reports whether the search query is being typed
+func (p *FirmwarePanel) Searching() bool {
+	return p.searching
+}
+
+// tags returns the tags of the build at path
+func (p *FirmwarePanel) tags(path string) []string {
+	if p.tagsOf == nil {
+		return nil
+	}
+	return p.tagsOf(path)
+}
+
+// refilter rebuilds the shown builds from all of them, moving the selection
+// to selectedPath when it is shown and keeping it in range otherwise
+func (p *FirmwarePanel) refilter(selectedPath string) {
+	p.builds = p.all
+	if p.filter != "" || p.query != "" {
+		p.builds = nil
+		for _, b := range p.all {
+			tags := p.tags(b.Path)
+			if p.filter != "" && !slices.Contains(tags, p.filter) {
+				continue
+			}
+			if b.Matches(p.query, tags) {
+				p.builds = append(p.builds, b)
+			}
+		}
+	}
+
+	if selectedPath != "" && p.Select(selectedPath) {
+		return
+	}
+	if p.selected >= len(p.builds) {
+		p.selected = len(p.builds) - 1
 	}
 	if p.selected < 0 {
 		p.selected = 0
 	}
 }
 
+// AddBuild inserts or replaces (by path) a build found by an in-progress
+// scan, keeping the list sorted. A selection at the top stays on the newest
+// build; otherwise it follows the build the user picked.
+func (p *FirmwarePanel) AddBuild(build firmware.Build) {
+	var selectedPath string
+	if sel := p.Selected(); sel != nil && p.selected > 0 {
+		selectedPath = sel.Path
+	}
+
+	replaced := false
+	for i := range p.all {
+		if p.all[i].Path == build.Path {
+			p.all[i] = build
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		p.all = append(p.all, build)
+	}
+	firmware.SortBuilds(p.all)
+	p.refilter(selectedPath)
+}
+
+// SetLoading shows or hides the scanning indicator
+func (p *FirmwarePanel) SetLoading(loading bool) {
+	p.loading = loading
+}
+
+// Builds returns every scanned build, including those filtered out
+func (p *FirmwarePanel) Builds() []firmware.Build {
+	return p.all
+}
+
+// Len returns how many builds are listed
+func (p *FirmwarePanel) Len() int {
+	return len(p.builds)
+}
+
+// Older returns the build listed after the selection (the next older one)
+func (p *FirmwarePanel) Older() *firmware.Build {
+	if p.selected+1 >= len(p.builds) {
+		return nil
+	}
+	return &p.builds[p.selected+1]
+}
+
 // Selected returns the selected build
 func (p *FirmwarePanel) Selected() *firmware.Build {
 	if len(p.builds) == 0 {
@@ -82,18 +235,40 @@ func (p *FirmwarePanel) Selected() *firmware.Build {
 	return &p.builds[p.selected]
 }
 
+// Select moves the selection to the build at path, reporting whether it is listed
+func (p *FirmwarePanel) Select(path string) bool {
+	for i := range p.builds {
+		if p.builds[i].Path == path {
+			p.selected = i
+			return true
+		}
+	}
+	return false
+}
+
 // MoveUp moves selection up
 func (p *FirmwarePanel) MoveUp() {
-	if p.selected > 0 {
-		p.selected--
-	}
+	p.MoveBy(-1)
 }
 
 // MoveDown moves selection down
 func (p *FirmwarePanel) MoveDown() {
-	if p.selected < len(p.builds)-1 {
-		p.selected++
-	}
+	p.MoveBy(1)
+}
+
+// MoveBy moves selection n builds down, or up when n is negative
+func (p *FirmwarePanel) MoveBy(n int) {
+	p.MoveTo(p.selected + n)
+}
+
+// MoveTo selects the build at index i, clamped to the list
+func (p *FirmwarePanel) MoveTo(i int) {
+	p.selected = max(0, min(i, len(p.builds)-1))
+}
+
+// PageSize returns how many builds ctrl+d and ctrl+u move: half the panel
+func (p *FirmwarePanel) PageSize() int {
+	return max(1, (p.height-2)/2)
 }
 
 // SetSize sets the panel dimensions
@@ -104,21 +279,70 @@ func (p *FirmwarePanel) SetSize(width, height int) {
 
 // View renders the firmware panel content
 func (p *FirmwarePanel) View() string {
-	if len(p.builds) == 0 {
+	if len(p.all) == 0 {
+		if p.loading {
+			spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
+			return AccentStyle.Render("  " + spinner + " Scanning...")
+		}
 		return DimStyle.Render("  No firmware found")
 	}
 
-	var lines []string
+	var header []string
+	if p.filter != "" || p.query != "" || p.searching {
+		var filters []string
+		if p.filter != "" {
+			filters = append(filters, "#"+p.filter)
+		}
+		if p.query != "" || p.searching {
+			search := "/" + p.query
+			if p.searching {
+				search += "▏"
+			}
+			filters = append(filters, search)
+		}
+		header = append(header, AccentStyle.Render("  "+strings.Join(filters, " "))+DimStyle.Render(fmt.Sprintf(" (%d/%d)", len(p.builds), len(p.all))))
+		if len(p.builds) == 0 {
+			header = append(header, DimStyle.Render("  No matching builds"))
+		}
+	}
+	var footer []string
+	if p.loading {
+		spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
+		footer = append(footer, DimStyle.Render("  "+spinner+" scanning..."))
+	}
+
+	// The title and blank line above the list take two lines
+	room := p.height - 2 - len(header) - len(footer)
+
+	lines := append(header, p.visibleRows(p.rows(), room)...)
+	return strings.Join(append(lines, footer...), "\n")
+}
+
+// rows renders the lines of each build: one line, plus its files when selected
+func (p *FirmwarePanel) rows() [][]string {
+	rows := make([][]string, len(p.builds))
+	now := time.Now()
 	for i, build := range p.builds {
+		var lines []string
+
 		prefix := "  "
 		if i == p.selected {
 			prefix = "> "
 		}
 
-		// Format date or show "flat" for flat structure
-		dateStr := firmware.FormatDate(build.Date)
-		if build.Date == "" {
-			dateStr = "current"
+		dateStr := build.Title()
+
+		// Relative age, flagged once the build is older than the threshold
+		age := ""
+		if built := build.Time(); !built.IsZero() {
+			if p.staleDays > 0 && firmware.AgeDays(built, now) > p.staleDays {
+				if i != p.selected {
+					dateStr = DimStyle.Render(dateStr)
+				}
+				age = WarningStyle.Render(" " + firmware.FormatAge(built, now) + " !")
+			} else {
+				age = DimStyle.Render(" " + firmware.FormatAge(built, now))
+			}
 		}
 
 		// Status indicator - show file count
@@ -127,10 +351,32 @@ func (p *FirmwarePanel) View() string {
 			status = SuccessStyle.Render(fmt.Sprintf(" (%d)", len(build.Files)))
 		}
 
-		line := prefix + dateStr + status
+		// Source label when several firmware dirs are merged
+		source := ""
+		if build.Source != "" {
+			source = DimStyle.Render(" [" + build.Source + "]")
+		}
+
+		// Tags, e.g. #stable
+		for _, tag := range p.tags(build.Path) {
+			source += AccentStyle.Render(" #" + tag)
+		}
+		if build.Path == p.ready {
+			source += SuccessStyle.Render(" ● new build ready")
+		}
+
+		line := prefix + dateStr + age + status + source
 		if i == p.selected {
 			line = SelectedStyle.Render(line)
 		}
+
+		// First line of the build's notes, cut to the panel width
+		if summary := build.Summary(); summary != "" {
+			room := p.width - lipgloss.Width(line) - 4
+			if room > 3 {
+				line += DimStyle.Render("  " + ansi.Truncate(summary, room, "…"))
+			}
+		}
 		lines = append(lines, line)
 
 		// Show files for selected build
@@ -145,9 +391,52 @@ func (p *FirmwarePanel) View() string {
 				lines = append(lines, DimStyle.Render(fileLine))
 			}
 		}
+		rows[i] = lines
 	}
+	return rows
+}
 
-	return strings.Join(lines, "\n")
+// visibleRows returns the rows that fit in room lines, scrolled to keep the
+// selected build in view, with a marker line for builds above and below
+func (p *FirmwarePanel) visibleRows(rows [][]string, room int) []string {
+	height := func(from, to int) int {
+		n := 0
+		for _, row := range rows[from:to] {
+			n += len(row)
+		}
+		return n
+	}
+
+	if room <= 0 || height(0, len(rows)) <= room {
+		p.offset = 0
+		return slices.Concat(rows...)
+	}
+
+	// Leave a line for each scroll marker
+	room = max(1, room-2)
+	p.offset = min(p.offset, p.selected)
+	for p.offset < p.selected && height(p.offset, p.selected+1) > room {
+		p.offset++
+	}
+	for p.offset > 0 && height(p.offset-1, len(rows)) <= room {
+		p.offset--
+	}
+
+	var lines []string
+	end := p.offset
+	for ; end < len(rows) && len(lines) < room; end++ {
+		lines = append(lines, rows[end]...)
+	}
+	lines = lines[:min(len(lines), room)]
+
+	above, below := "", ""
+	if p.offset > 0 {
+		above = DimStyle.Render(fmt.Sprintf("  ↑ %d more", p.offset))
+	}
+	if end < len(rows) {
+		below = DimStyle.Render(fmt.Sprintf("  ↓ %d more", len(rows)-end))
+	}
+	return append(append([]string{above}, lines...), below)
 }
 
 // StatusPanel renders the status/operation display
@@ -158,6 +447,12 @@ type StatusPanel struct {
 	hasBuild   bool
 	deviceName string
 	sides      []string
+	device     string // details of the connected volume, empty when none
+}
+
+// SetDevice sets the connected volume details shown while idle and flashing
+func (p *StatusPanel) SetDevice(details string) {
+	p.device = details
 }
 
 // NewStatusPanel creates a new status panel
@@ -176,8 +471,9 @@ func (p *StatusPanel) SetSize(width, height int) {
 	p.height = height
 }
 
-// ViewIdle renders idle state
-func (p *StatusPanel) ViewIdle(build *firmware.Build) string {
+// ViewIdle renders idle state, with each side's firmware size against its
+// board's flash capacity when known
+func (p *StatusPanel) ViewIdle(build *firmware.Build, sizes map[string]firmware.SizeReport) string {
 	var lines []string
 
 	boxWidth := p.width - 8
@@ -196,18 +492,46 @@ func (p *StatusPanel) ViewIdle(build *firmware.Build) string {
 
 	if build != nil {
 		lines = append(lines, "")
-		dateStr := firmware.FormatDate(build.Date)
-		if build.Date == "" {
-			dateStr = "current"
+		dateStr := build.Title()
+		if build.Source != "" {
+			dateStr += " [" + build.Source + "]"
 		}
 		lines = append(lines, DimStyle.Render("Selected: ")+dateStr)
+		if p.device != "" {
+			lines = append(lines, DimStyle.Render("Device: ")+p.device)
+		}
+		if build.Keymap != "" {
+			lines = append(lines, DimStyle.Render("Keymap: ")+filepath.Base(build.Keymap)+DimStyle.Render("  v to open"))
+		}
+
+		for _, side := range p.sides {
+			report, ok := sizes[side]
+			if !ok {
+				continue
+			}
+			style := DimStyle
+			if report.Exceeds() {
+				style = ErrorStyle
+			} else if report.NearLimit() {
+				style = WarningStyle
+			}
+			lines = append(lines, style.Render(side+": "+report.String()))
+		}
+
+		// The build's notes in full
+		if build.Notes != "" {
+			lines = append(lines, "")
+			notes := lipgloss.NewStyle().Width(boxWidth).Render(build.Notes)
+			lines = append(lines, DimStyle.Render(notes))
+		}
 	}
 
 	return strings.Join(lines, "\n")
 }
 
-// ViewBuilding renders building state
-func (p *StatusPanel) ViewBuilding(percent int, target string) string {
+// ViewBuilding renders building state with the current stage label and the
+// time elapsed against the target's average build time, if known
+func (p *StatusPanel) ViewBuilding(percent int, target, stage string, elapsed, average time.Duration) string {
 	var lines []string
 
 	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
@@ -218,13 +542,79 @@ func (p *StatusPanel) ViewBuilding(percent int, target string) string {
 	lines = append(lines, AccentStyle.Render(spinner+" "+title))
 	lines = append(lines, "")
 	lines = append(lines, RenderProgressBar(percent, p.width-10))
+	if stage != "" {
+		lines = append(lines, DimStyle.Render(stage+"..."))
+	}
+	timer := "Elapsed " + formatElapsed(elapsed)
+	if average > 0 {
+		timer += " (avg " + formatElapsed(average) + ")"
+	}
+	lines = append(lines, DimStyle.Render(timer))
 	lines = append(lines, "")
 
 	return strings.Join(lines, "\n")
 }
 
+// ViewCheckingDocker renders the Docker check before a build or west update
+func (p *StatusPanel) ViewCheckingDocker() string {
+	var lines []string
+
+	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
+
+	lines = append(lines, "")
+	lines = append(lines, AccentStyle.Render(spinner+" CHECKING DOCKER"))
+	lines = append(lines, "")
+	lines = append(lines, DimStyle.Render("Waiting for the Docker daemon..."))
+	lines = append(lines, "")
+
+	return strings.Join(lines, "\n")
+}
+
+// ViewUpdating renders west update progress
+func (p *StatusPanel) ViewUpdating(projects int, message string, elapsed time.Duration) string {
+	var lines []string
+
+	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
+
+	lines = append(lines, "")
+	lines = append(lines, AccentStyle.Render(spinner+" WEST UPDATE"))
+	lines = append(lines, "")
+	lines = append(lines, fmt.Sprintf("Projects updated: %d", projects))
+	if message != "" {
+		lines = append(lines, DimStyle.Render(message))
+	}
+	lines = append(lines, DimStyle.Render("Elapsed "+formatElapsed(elapsed)))
+	lines = append(lines, "")
+
+	return strings.Join(lines, "\n")
+}
+
+// ViewOutput renders a progress view with the tail of the raw build output
+// below it, as many lines as fit in the panel
+func (p *StatusPanel) ViewOutput(view string, output []string) string {
+	lines := strings.Split(view, "\n")
+	lines = append(lines, AccentStyle.Render("Output")+DimStyle.Render("  o to hide"))
+
+	room := p.height - 2 - len(lines)
+	if room < 1 {
+		room = 1
+	}
+	if len(output) > room {
+		output = output[len(output)-room:]
+	}
+	if len(output) == 0 {
+		lines = append(lines, DimStyle.Render("No output yet"))
+	}
+	for _, line := range output {
+		line = strings.ReplaceAll(ansi.Strip(line), "\t", "    ")
+		lines = append(lines, DimStyle.Render(ansi.Truncate(line, p.width-2, "…")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // ViewWaitingDisconnect renders waiting for disconnect state (safety flow)
-func (p *StatusPanel) ViewWaitingDisconnect(target string) string {
+func (p *StatusPanel) ViewWaitingDisconnect(target string, elapsed time.Duration) string {
 	var lines []string
 
 	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
@@ -240,12 +630,13 @@ func (p *StatusPanel) ViewWaitingDisconnect(target string) string {
 	lines = append(lines, "")
 	lines = append(lines, "")
 	lines = append(lines, DimStyle.Render(centerText("Waiting for disconnect...", p.width)))
+	lines = append(lines, DimStyle.Render(centerText("Elapsed "+formatElapsed(elapsed), p.width)))
 
 	return strings.Join(lines, "\n")
 }
 
 // ViewWaiting renders waiting for device state
-func (p *StatusPanel) ViewWaiting(target string) string {
+func (p *StatusPanel) ViewWaiting(target string, elapsed time.Duration) string {
 	var lines []string
 
 	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
@@ -261,12 +652,13 @@ func (p *StatusPanel) ViewWaiting(target string) string {
 	lines = append(lines, "")
 	lines = append(lines, "")
 	lines = append(lines, DimStyle.Render("Looking for "+p.deviceName+"..."))
+	lines = append(lines, DimStyle.Render("Elapsed "+formatElapsed(elapsed)))
 
 	return strings.Join(lines, "\n")
 }
 
 // ViewFlashing renders flashing in progress
-func (p *StatusPanel) ViewFlashing(percent int, filename, target string) string {
+func (p *StatusPanel) ViewFlashing(percent int, filename, target string, elapsed time.Duration) string {
 	var lines []string
 
 	spinner := SpinnerFrames[(time.Now().UnixMilli()/100)%int64(len(SpinnerFrames))]
@@ -277,6 +669,10 @@ func (p *StatusPanel) ViewFlashing(percent int, filename, target string) string
 	lines = append(lines, RenderProgressBar(percent, p.width-10))
 	lines = append(lines, "")
 	lines = append(lines, fmt.Sprintf("Copying: %s", filename))
+	if p.device != "" {
+		lines = append(lines, DimStyle.Render("Device: "+p.device))
+	}
+	lines = append(lines, DimStyle.Render("Elapsed "+formatElapsed(elapsed)))
 	lines = append(lines, "")
 
 	// Flash checklist for split keyboards
@@ -305,8 +701,9 @@ func (p *StatusPanel) ViewFlashing(percent int, filename, target string) string
 	return strings.Join(lines, "\n")
 }
 
-// ViewComplete renders completion summary
-func (p *StatusPanel) ViewComplete(duration time.Duration, steps []string) string {
+// ViewComplete renders completion summary; buildNote describes the build
+// made this session, if any
+func (p *StatusPanel) ViewComplete(duration time.Duration, steps []string, buildNote string) string {
 	var lines []string
 
 	lines = append(lines, "")
@@ -319,6 +716,9 @@ func (p *StatusPanel) ViewComplete(duration time.Duration, steps []string) strin
 
 	lines = append(lines, "")
 	lines = append(lines, fmt.Sprintf("  Duration: %s", duration.Round(time.Second)))
+	if buildNote != "" {
+		lines = append(lines, DimStyle.Render("  Build:"+buildNote))
+	}
 	lines = append(lines, "")
 	if p.isSplit {
 		lines = append(lines, DimStyle.Render("Test both halves to verify."))
@@ -355,6 +755,21 @@ func (p *LogPanel) Add(level LogLevel, msg string) {
 	}
 }
 
+// Highlight marks the latest entry, unmarking any earlier one
+func (p *LogPanel) Highlight() {
+	p.ClearHighlight()
+	if len(p.entries) > 0 {
+		p.entries[len(p.entries)-1].highlighted = true
+	}
+}
+
+// ClearHighlight unmarks the highlighted entry
+func (p *LogPanel) ClearHighlight() {
+	for i := range p.entries {
+		p.entries[i].highlighted = false
+	}
+}
+
 // Clear clears all entries
 func (p *LogPanel) Clear() {
 	p.entries = nil
@@ -405,6 +820,10 @@ func (p *LogPanel) View() string {
 			msg = msg[:maxMsgLen-3] + "..."
 		}
 
+		if entry.highlighted {
+			lines = append(lines, timestamp+ErrorStyle.Render(" ▶")+msgStyle.Bold(true).Render(msg))
+			continue
+		}
 		lines = append(lines, timestamp+"  "+msgStyle.Render(msg))
 	}
 
@@ -412,6 +831,16 @@ func (p *LogPanel) View() string {
 }
 
 // Helper functions
+
+// formatElapsed formats a running time as m:ss, or h:mm:ss past an hour
+func formatElapsed(d time.Duration) string {
+	s := int(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
 func centerText(text string, width int) string {
 	textLen := lipgloss.Width(text)
 	if textLen >= width {
@@ -0,0 +1,196 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+)
+
+// KeyboardSelector picks the keyboard profile to work with. Choosing a
+// profile replaces it with a fresh Model built for that keyboard.
+type KeyboardSelector struct {
+	root     *config.Config
+	names    []string
+	selected int
+	width    int
+	height   int
+	previous *Model // model to return to on Esc, nil at startup
+}
+
+// NewKeyboardSelector creates a selector over root's profiles
+func NewKeyboardSelector(root *config.Config) *KeyboardSelector {
+	return &KeyboardSelector{
+		root:  root,
+		names: root.ProfileNames(),
+	}
+}
+
+// switchKeyboard opens the selector from a running model, on its profile
+func switchKeyboard(m *Model) *KeyboardSelector {
+	s := NewKeyboardSelector(m.root)
+	s.previous = m
+	s.width = m.width
+	s.height = m.height
+	for i, name := range s.names {
+		if s.root.Profiles[name] == m.cfg {
+			s.selected = i
+		}
+	}
+	return s
+}
+
+// Init initializes the selector
+func (s *KeyboardSelector) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles navigation and selection
+func (s *KeyboardSelector) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width = msg.Width
+		s.height = msg.Height
+		if s.previous != nil {
+			s.previous.Update(msg)
+		}
+		return s, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q":
+			if s.previous != nil {
+				return s, s.previous.quit()
+			}
+			return s, tea.Quit
+		case "esc":
+			if s.previous != nil {
+				return s.previous, nil
+			}
+		case "up", "k":
+			if s.selected > 0 {
+				s.selected--
+			}
+		case "down", "j":
+			if s.selected < len(s.names)-1 {
+				s.selected++
+			}
+		case "enter":
+			return s.choose()
+		default:
+			// Number keys jump straight to a profile
+			if k := msg.String(); len(k) == 1 && k[0] >= '1' && k[0] <= '9' {
+				if i := int(k[0] - '1'); i < len(s.names) {
+					s.selected = i
+					return s.choose()
+				}
+			}
+		}
+		return s, nil
+	}
+
+	// Keep the model we came from running (device events, spinner ticks)
+	if s.previous != nil {
+		_, cmd := s.previous.Update(msg)
+		return s, cmd
+	}
+	return s, nil
+}
+
+// choose builds a Model for the selected profile and hands over to it
+func (s *KeyboardSelector) choose() (tea.Model, tea.Cmd) {
+	cfg := s.root.Profiles[s.names[s.selected]]
+	if s.previous != nil {
+		if s.previous.cfg == cfg {
+			return s.previous, nil
+		}
+		// Stop the old keyboard's device polling and file watching
+		if s.previous.detectCancel != nil {
+			s.previous.detectCancel()
+		}
+		if s.previous.watchCancel != nil {
+			s.previous.watchCancel()
+		}
+	}
+
+	m := NewModel(cfg)
+	m.SetProfiles(s.root)
+	width, height := s.width, s.height
+	return m, tea.Batch(m.Init(), func() tea.Msg {
+		return tea.WindowSizeMsg{Width: width, Height: height}
+	})
+}
+
+// View renders the profile list
+func (s *KeyboardSelector) View() string {
+	if s.width == 0 || s.height == 0 {
+		return "Loading..."
+	}
+
+	var lines []string
+	lines = append(lines, AccentStyle.Render("SELECT KEYBOARD"))
+	lines = append(lines, "")
+
+	for i, name := range s.names {
+		cfg := s.root.Profiles[name]
+		key := "   "
+		if i < 9 {
+			key = KeyHintStyle.Render("[" + string(rune('1'+i)) + "]")
+		}
+		line := key + " " + name
+		if cfg.Keyboard.Name != name {
+			line += DimStyle.Render(" (" + cfg.Keyboard.Name + ")")
+		}
+		if i == s.selected {
+			line = SelectedStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "")
+	if s.previous != nil {
+		lines = append(lines, DimStyle.Render("  [enter] Select  [esc] Back"))
+	} else {
+		lines = append(lines, DimStyle.Render("  [enter] Select  [q] Quit"))
+	}
+
+	content := strings.Join(lines, "\n")
+
+	boxWidth := 36
+	if boxWidth > s.width-10 {
+		boxWidth = s.width - 10
+	}
+
+	boxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorPurple).
+		Padding(1, 2).
+		Width(boxWidth)
+
+	box := boxStyle.Render(content)
+
+	boxHeight := lipgloss.Height(box)
+	topPadding := (s.height - boxHeight) / 2
+	if topPadding < 0 {
+		topPadding = 0
+	}
+
+	leftPadding := (s.width - boxWidth - 4) / 2
+	if leftPadding < 0 {
+		leftPadding = 0
+	}
+
+	var result []string
+	for i := 0; i < topPadding; i++ {
+		result = append(result, "")
+	}
+
+	for _, line := range strings.Split(box, "\n") {
+		result = append(result, strings.Repeat(" ", leftPadding)+line)
+	}
+
+	return strings.Join(result, "\n")
+}
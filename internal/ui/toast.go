@@ -0,0 +1,113 @@
+package ui
+
+import (
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// ToastDuration is how long a toast stays on screen.
+const ToastDuration = 4 * time.Second
+
+// maxToasts caps the stack; the oldest toast makes way for a new one.
+const maxToasts = 3
+
+// toastWidth is the widest a toast box gets, borders included.
+const toastWidth = 40
+
+// Toast is a short-lived notification drawn over the panels.
+type Toast struct {
+	Level   LogLevel
+	Message string
+	expires time.Time
+}
+
+// Toasts is the stack of toasts in the top-right corner, newest first.
+type Toasts struct {
+	items []Toast
+}
+
+// NewToasts creates an empty toast stack.
+func NewToasts() *Toasts {
+	return &Toasts{}
+}
+
+// Push shows msg for ToastDuration.
+func (t *Toasts) Push(level LogLevel, msg string) {
+	t.items = append([]Toast{{Level: level, Message: msg, expires: time.Now().Add(ToastDuration)}}, t.items...)
+	if len(t.items) > maxToasts {
+		t.items = t.items[:maxToasts]
+	}
+}
+
+// Expire removes toasts shown for ToastDuration by now.
+func (t *Toasts) Expire(now time.Time) {
+	kept := t.items[:0]
+	for _, toast := range t.items {
+		if now.Before(toast.expires) {
+			kept = append(kept, toast)
+		}
+	}
+	t.items = kept
+}
+
+// Empty reports whether no toasts are showing.
+func (t *Toasts) Empty() bool {
+	return len(t.items) == 0
+}
+
+// Overlay draws the toasts over the top-right corner of view, starting at
+// row top, for a screen width columns wide.
+func (t *Toasts) Overlay(view string, width, top int) string {
+	if t.Empty() {
+		return view
+	}
+	boxWidth := min(toastWidth, width/2)
+	if boxWidth < 12 {
+		return view // too narrow to be readable
+	}
+
+	var boxes []string
+	for _, toast := range t.items {
+		style := InfoStyle
+		switch toast.Level {
+		case LogSuccess:
+			style = SuccessStyle
+		case LogWarning:
+			style = WarningStyle
+		case LogError:
+			style = ErrorStyle
+		}
+		box := lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(style.GetForeground()).
+			Padding(0, 1).
+			Width(boxWidth - 2).
+			Render(style.Render(ansi.Truncate(toast.Message, (boxWidth-4)*2, "…")))
+		boxes = append(boxes, box)
+	}
+	stack := strings.Split(lipgloss.JoinVertical(lipgloss.Right, boxes...), "\n")
+
+	lines := strings.Split(view, "\n")
+	for i, row := range stack {
+		y := top + i
+		if y >= len(lines) {
+			break
+		}
+		x := width - lipgloss.Width(row) - 1
+		lines[y] = overlayLine(lines[y], row, x)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// overlayLine replaces line's cells from column x with over.
+func overlayLine(line, over string, x int) string {
+	left := ansi.Truncate(line, x, "")
+	if pad := x - ansi.StringWidth(left); pad > 0 {
+		left += strings.Repeat(" ", pad)
+	}
+	right := ansi.TruncateLeft(line, x+ansi.StringWidth(over), "")
+	return left + over + right
+}
@@ -0,0 +1,119 @@
+// Package watch polls files in a zmk-config checkout for changes, so the
+// TUI can rebuild the firmware when the keymap is saved. Polling, like
+// device detection, works the same on every platform and on network
+// filesystems.
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// DefaultInterval is how often the watched files are checked.
+const DefaultInterval = 500 * time.Millisecond
+
+// Watcher reports changes to the files matching its patterns.
+type Watcher struct {
+	dir      string
+	patterns []string
+	interval time.Duration
+	debounce time.Duration
+}
+
+// New returns a watcher for the files in dir matching patterns, globs
+// relative to dir. Changes are reported once the files have been quiet for
+// debounce.
+func New(dir string, patterns []string, debounce time.Duration) *Watcher {
+	return &Watcher{dir: dir, patterns: patterns, interval: DefaultInterval, debounce: debounce}
+}
+
+// SetInterval sets how often the files are checked.
+func (w *Watcher) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// fileState is what a change is told by: a save that keeps the size still
+// moves the modification time.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Changes sends the files, relative to the directory, that were written,
+// created or removed since the last send. A burst of writes, such as an
+// editor saving through a temporary file or a git checkout, is sent once
+// it has been quiet for the debounce. The channel is closed when ctx is
+// done.
+func (w *Watcher) Changes(ctx context.Context) <-chan []string {
+	changes := make(chan []string)
+	// Files are compared with how they were when Changes returned
+	prev := w.snapshot()
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		changed := make(map[string]bool)
+		var last time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cur := w.snapshot()
+			for name, st := range cur {
+				if old, ok := prev[name]; !ok || !old.modTime.Equal(st.modTime) || old.size != st.size {
+					changed[name], last = true, time.Now()
+				}
+			}
+			for name := range prev {
+				if _, ok := cur[name]; !ok {
+					changed[name], last = true, time.Now()
+				}
+			}
+			prev = cur
+
+			if len(changed) == 0 || time.Since(last) < w.debounce {
+				continue
+			}
+			names := make([]string, 0, len(changed))
+			for name := range changed {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			select {
+			case changes <- names:
+				changed = make(map[string]bool)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes
+}
+
+// snapshot stats the files matching the patterns
+func (w *Watcher) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, pattern := range w.patterns {
+		// Patterns are validated by config, so Glob cannot fail
+		matches, _ := filepath.Glob(filepath.Join(w.dir, pattern))
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(w.dir, path)
+			if err != nil {
+				continue
+			}
+			files[filepath.ToSlash(rel)] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func next(t *testing.T, changes <-chan []string) []string {
+	t.Helper()
+	select {
+	case names := <-changes:
+		return names
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+	return nil
+}
+
+func TestWatcher_Changes(t *testing.T) {
+	dir := t.TempDir()
+	keymap := filepath.Join(dir, "config", "corne.keymap")
+	write(t, keymap, "/ { };")
+	write(t, filepath.Join(dir, "README.md"), "zmk-config")
+
+	w := New(dir, []string{"config/*.keymap", "config/*.conf"}, 30*time.Millisecond)
+	w.SetInterval(5 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := w.Changes(ctx)
+
+	// Several saves in a row are one change
+	write(t, keymap, "/ { keymap { }; };")
+	time.Sleep(10 * time.Millisecond)
+	write(t, filepath.Join(dir, "config", "corne.conf"), "CONFIG_ZMK_SLEEP=y")
+	write(t, filepath.Join(dir, "README.md"), "unwatched")
+	if got := next(t, changes); !slices.Equal(got, []string{"config/corne.conf", "config/corne.keymap"}) {
+		t.Errorf("changes = %v, want the keymap and conf", got)
+	}
+
+	if err := os.Remove(keymap); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, changes); !slices.Equal(got, []string{"config/corne.keymap"}) {
+		t.Errorf("changes = %v, want the removed keymap", got)
+	}
+
+	cancel()
+	for range changes {
+	}
+}
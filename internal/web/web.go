@@ -0,0 +1,655 @@
+// Package web serves a small dashboard for flashing from a browser: the
+// firmware list, the bootloader's state and a flash button. Flashing runs
+// the same flow.Flow sequence as the TUI and headless mode, so a side is
+// only flashed once the previous bootloader has been unplugged and its
+// board matches.
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/backup"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/device"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/flashlog"
+	"github.com/dhavalsavalia/kbflash/internal/flow"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// maxLog is how many log entries the dashboard keeps.
+const maxLog = 200
+
+// tokenCookie carries the access token after the first visit.
+const tokenCookie = "kbflash_token"
+
+// Components are the parts the server drives. Detector, Flasher and
+// Scanner are required; DFU is set in dfu flash mode, where dfu-util waits
+// for each bootloader itself.
+type Components struct {
+	Detector device.Detector
+	Flasher  firmware.FirmwareFlasher
+	DFU      *firmware.DFUFlasher
+	Scanner  *firmware.Scanner
+	Flashes  *flashlog.Log // history of flashed files, in memory when nil
+}
+
+// Server is the dashboard's HTTP handler and the flash sequence it runs.
+type Server struct {
+	cfg      *config.Config
+	sides    []string
+	detector device.Detector
+	flasher  firmware.FirmwareFlasher
+	dfu      *firmware.DFUFlasher
+	scanner  *firmware.Scanner
+	matcher  *firmware.SideMatcher
+	flashes  *flashlog.Log
+	token    string
+	mux      *http.ServeMux
+
+	mu         sync.Mutex
+	builds     []firmware.Build
+	scanning   bool
+	connected  bool
+	device     string
+	unreadable string // why a mounted bootloader cannot be used
+	seq        *flow.Flow
+	backingUp  bool   // a flash waits for its keymap backup
+	flashing   string // title of the build being flashed
+	prompt     string // what the user should do next
+	percent    int
+	retry      bool               // the failed file can be flashed again
+	cancel     context.CancelFunc // stops the copy in progress
+	reboot     *time.Timer        // reports a flashed bootloader that stays mounted
+	log        []Entry
+}
+
+// Entry is a line of the dashboard's log.
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"` // info, success, warning or error
+	Text  string    `json:"text"`
+}
+
+// NewServer creates a dashboard for cfg's keyboard.
+func NewServer(cfg *config.Config, c Components) (*Server, error) {
+	if cfg.Flash.Mode == "qmk" {
+		return nil, errors.New("the web dashboard does not support flash.mode = \"qmk\"")
+	}
+	matcher, err := firmware.NewSideMatcher(cfg.Keyboard.SidePatterns)
+	if err != nil {
+		return nil, err
+	}
+	matcher.SetStudio(cfg.Build.Studio)
+	sides := cfg.Keyboard.Sides
+	if len(sides) == 0 {
+		sides = []string{"main"}
+	}
+	flashes := c.Flashes
+	if flashes == nil {
+		flashes = flashlog.New()
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		sides:    sides,
+		detector: c.Detector,
+		flasher:  c.Flasher,
+		dfu:      c.DFU,
+		scanner:  c.Scanner,
+		matcher:  matcher,
+		flashes:  flashes,
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /api/state", s.handleState)
+	s.mux.HandleFunc("POST /api/flash", s.handleFlash)
+	s.mux.HandleFunc("POST /api/cancel", s.handleCancel)
+	s.mux.HandleFunc("POST /api/retry", s.handleRetry)
+	s.mux.HandleFunc("POST /api/rescan", s.handleRescan)
+	return s, nil
+}
+
+// SetToken requires token on every request, given once as ?token= and
+// remembered in a cookie. Used when the dashboard is reachable from other
+// machines; "" allows every request.
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// Start scans for firmware and watches for the bootloader until ctx is done.
+func (s *Server) Start(ctx context.Context) {
+	s.rescan(ctx)
+	if s.dfu != nil {
+		return
+	}
+	events := s.detector.Detect(ctx, s.cfg.Device.Name, time.Duration(s.cfg.Device.PollInterval))
+	go func() {
+		for event := range events {
+			s.deviceEvent(event)
+		}
+	}()
+}
+
+// ServeHTTP serves the dashboard and its API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && !s.authorize(w, r) {
+		http.Error(w, "forbidden: open the URL kbflash printed, with its token", http.StatusForbidden)
+		return
+	}
+	// Without a token only this machine can connect, but a DNS-rebound
+	// name makes another site's page same-origin with the dashboard; only
+	// the names this machine is reached by are served
+	if s.token == "" && !IsLoopback(requestHost(r)) {
+		http.Error(w, "forbidden: open the dashboard at localhost or 127.0.0.1", http.StatusForbidden)
+		return
+	}
+	// Cross-site forms cannot send JSON without a preflight, so this keeps
+	// other pages in the browser from starting a flash
+	if r.Method == http.MethodPost && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "requests must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorize checks the request's token, remembering a valid ?token= in a
+// cookie
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if token := r.URL.Query().Get("token"); token != "" && s.validToken(token) {
+		http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		return true
+	}
+	cookie, err := r.Cookie(tokenCookie)
+	return err == nil && s.validToken(cookie.Value)
+}
+
+func (s *Server) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// IsLoopback reports whether host only accepts connections from this machine
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requestHost returns the host the request was addressed to, without port
+func requestHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return strings.Trim(r.Host, "[]")
+}
+
+// State is what the dashboard shows, as returned by GET /api/state.
+type State struct {
+	Keyboard string      `json:"keyboard"`
+	Sides    []string    `json:"sides"`
+	Device   DeviceState `json:"device"`
+	Scanning bool        `json:"scanning"`
+	Builds   []BuildInfo `json:"builds"`
+	Flash    FlashState  `json:"flash"`
+	Log      []Entry     `json:"log"`
+}
+
+// DeviceState describes the bootloader.
+type DeviceState struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Path      string `json:"path,omitempty"`
+	// Unreadable explains why a mounted bootloader cannot be used
+	Unreadable string `json:"unreadable,omitempty"`
+}
+
+// BuildInfo describes a build in the firmware list.
+type BuildInfo struct {
+	Title  string   `json:"title"`
+	Path   string   `json:"path"`
+	Source string   `json:"source,omitempty"`
+	Notes  string   `json:"notes,omitempty"`
+	Age    string   `json:"age,omitempty"`
+	Stale  bool     `json:"stale,omitempty"`
+	Files  []string `json:"files"`
+}
+
+// FlashState describes the flash sequence.
+type FlashState struct {
+	State   string `json:"state"`
+	Active  bool   `json:"active"`
+	Build   string `json:"build,omitempty"`
+	Side    string `json:"side,omitempty"`
+	File    string `json:"file,omitempty"`
+	Percent int    `json:"percent"`
+	Prompt  string `json:"prompt,omitempty"`
+	Retry   bool   `json:"retry,omitempty"` // the failed file can be flashed again
+}
+
+// State returns what the dashboard shows.
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	st := State{
+		Keyboard: s.cfg.Keyboard.Name,
+		Sides:    s.sides,
+		Device:   DeviceState{Name: s.cfg.Device.Name, Connected: s.connected, Path: s.device, Unreadable: s.unreadable},
+		Scanning: s.scanning,
+		Builds:   []BuildInfo{},
+		Flash:    FlashState{State: flow.StateIdle.String()},
+		Log:      append([]Entry{}, s.log...),
+	}
+	if s.dfu != nil {
+		st.Device.Name = "DFU bootloader"
+	}
+	for _, b := range s.builds {
+		info := BuildInfo{Title: b.Title(), Path: b.Path, Source: b.Source, Notes: b.Summary(), Files: []string{}}
+		if built := b.Time(); !built.IsZero() {
+			info.Age = firmware.FormatAge(built, now)
+			info.Stale = firmware.AgeDays(built, now) > s.cfg.Build.StaleDays
+		}
+		for _, f := range b.Files {
+			info.Files = append(info.Files, f.Name)
+		}
+		st.Builds = append(st.Builds, info)
+	}
+	if s.seq != nil {
+		st.Flash = FlashState{
+			State:   s.seq.State().String(),
+			Active:  s.seq.Active(),
+			Build:   s.flashing,
+			Side:    s.seq.Side(),
+			File:    filepath.Base(s.seq.Path()),
+			Percent: s.percent,
+			Prompt:  s.prompt,
+		}
+		if st.Flash.File == "." {
+			st.Flash.File = ""
+		}
+		st.Flash.Retry = s.retry
+	}
+	return st
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.State())
+}
+
+// FlashRequest asks for a build to be flashed, as sent to POST /api/flash.
+type FlashRequest struct {
+	Build   string `json:"build"`   // path of the build
+	Side    string `json:"side"`    // side to flash, "" or "all" for every side
+	Confirm bool   `json:"confirm"` // flash despite the warnings
+}
+
+// FlashResponse answers a FlashRequest. Without Confirm, a build that
+// needs a second look is not flashed and its warnings are returned.
+type FlashResponse struct {
+	Started  bool     `json:"started"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (s *Server) handleFlash(w http.ResponseWriter, r *http.Request) {
+	var req FlashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	resp, status, err := s.Flash(req)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Flash starts flashing a build, after the checks the TUI makes: every
+// side has a file, the files are firmware, and stale builds, images too
+// large for the board or firmware already on a side need Confirm. The
+// returned status suits an HTTP response when err is set.
+func (s *Server) Flash(req FlashRequest) (FlashResponse, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backingUp || s.seq != nil && s.seq.Active() {
+		return FlashResponse{}, http.StatusConflict, errors.New("a flash is already running")
+	}
+	i := slices.IndexFunc(s.builds, func(b firmware.Build) bool { return b.Path == req.Build })
+	if i < 0 {
+		return FlashResponse{}, http.StatusNotFound, fmt.Errorf("no build at %s", req.Build)
+	}
+	build := s.builds[i]
+	sides := s.sides
+	if req.Side != "" && req.Side != "all" {
+		if !slices.Contains(s.sides, req.Side) {
+			return FlashResponse{}, http.StatusBadRequest, fmt.Errorf("unknown side %q, expected all or one of %s", req.Side, strings.Join(s.sides, ", "))
+		}
+		sides = []string{req.Side}
+	}
+
+	// Fail before flashing anything rather than halfway through
+	if missing := s.matcher.Missing(sides, build.Files); len(missing) > 0 {
+		return FlashResponse{}, http.StatusBadRequest, fmt.Errorf("no firmware file for %s in %s", strings.Join(missing, ", "), build.Title())
+	}
+	var steps []flow.Step
+	var warnings []string
+	if built := build.Time(); !built.IsZero() {
+		if days := firmware.AgeDays(built, time.Now()); days > s.cfg.Build.StaleDays {
+			warnings = append(warnings, fmt.Sprintf("%s is %d days old", build.Title(), days))
+		}
+	}
+	for _, name := range s.matcher.Ambiguous(sides, build.Files) {
+		warnings = append(warnings, name+" matches more than one side")
+	}
+	for _, side := range sides {
+		path := s.matcher.Match(side, build.Files).Path
+		files := s.cfg.Flash.FilesFor(side, path)
+		for _, file := range files {
+			if err := firmware.CheckFirmwareFile(file, s.cfg.Flash.Extension(), s.cfg.Flash.MinSize); err != nil {
+				return FlashResponse{}, http.StatusBadRequest, fmt.Errorf("cannot flash %s: %w", side, err)
+			}
+		}
+		if size, ok, err := firmware.CheckImageSize(path, s.cfg.Build.BoardFor(side)); err == nil && ok && size.Exceeds() {
+			warnings = append(warnings, fmt.Sprintf("%s firmware is larger than the %s flash (%s)", side, s.cfg.Build.BoardFor(side), size))
+		}
+		if last, ok := s.flashes.Flashed(flashlog.Key(s.cfg.Keyboard.Name, side), files[len(files)-1]); ok {
+			warnings = append(warnings, fmt.Sprintf("This exact firmware is already on %s (flashed %s)", side, last.Time.Format("2006-01-02 15:04")))
+		}
+		steps = append(steps, flow.Step{Side: side, Files: files})
+	}
+	if len(warnings) > 0 && !req.Confirm {
+		return FlashResponse{Warnings: warnings}, http.StatusOK, nil
+	}
+
+	// The flash history references the backup as the restore point. The
+	// archive is taken without the lock, so the state keeps updating;
+	// backingUp keeps another flash from starting meanwhile.
+	var backupDir string
+	if s.cfg.Backup.Enabled {
+		s.add("info", "Backing up keymap...")
+		s.backingUp = true
+		s.mu.Unlock()
+		dir, err := backup.Archive(context.Background(), s.cfg.Build.WorkingDir, s.cfg.Backup.Patterns, s.cfg.Backup.Dir, time.Now())
+		s.mu.Lock()
+		s.backingUp = false
+		if err != nil {
+			return FlashResponse{}, http.StatusInternalServerError, fmt.Errorf("backup keymap: %w", err)
+		}
+		s.add("info", "Keymap backed up to "+dir)
+		backupDir = dir
+	}
+	s.flashes.SetBackup(backupDir)
+
+	s.add("info", "Flashing "+build.Title()+" to "+strings.Join(sides, ", "))
+	for _, w := range warnings {
+		s.add("warning", w)
+	}
+	s.flashing = build.Title()
+	s.percent = 0
+	s.prompt = ""
+	s.retry = false
+	// Safety: a bootloader already mounted has to be unplugged first, as it
+	// could be any side
+	s.seq = flow.New(steps, flow.Options{
+		SelfWaiting: s.dfu != nil,
+		Boards:      s.cfg.Build.Boards(s.sides),
+	}, s.flowEvent)
+	if s.connected {
+		s.seq.Connected(s.device)
+	}
+	s.seq.Start()
+	return FlashResponse{Started: true}, http.StatusOK, nil
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s.Cancel()
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// Cancel stops the flash sequence, and the copy if one is running.
+func (s *Server) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seq == nil || !s.seq.Active() {
+		return
+	}
+	s.seq.Cancel()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.prompt = ""
+	s.add("warning", "Flash cancelled")
+}
+
+func (s *Server) handleRetry(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seq == nil || s.seq.State() != flow.StateFailed {
+		writeError(w, http.StatusConflict, errors.New("no failed flash to retry"))
+		return
+	}
+	s.retry = false
+	s.seq.Retry()
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) handleRescan(w http.ResponseWriter, r *http.Request) {
+	go s.rescan(context.Background())
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// rescan lists the builds again
+func (s *Server) rescan(ctx context.Context) {
+	s.mu.Lock()
+	if s.scanning {
+		s.mu.Unlock()
+		return
+	}
+	s.scanning = true
+	s.mu.Unlock()
+
+	builds, err := s.scanner.Scan(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanning = false
+	if err != nil {
+		s.add("error", "Cannot scan firmware: "+err.Error())
+		return
+	}
+	s.builds = builds
+	if len(builds) == 0 {
+		s.add("warning", "No firmware found in "+s.cfg.Build.FirmwareDir)
+	}
+}
+
+// deviceEvent feeds a detector event to the flash sequence
+func (s *Server) deviceEvent(event device.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Err != nil {
+		if msg := event.Err.Error(); msg != s.unreadable {
+			s.add("error", msg)
+			s.unreadable = msg
+		}
+	} else if event.Connected {
+		s.unreadable = ""
+	}
+	if event.Connected && event.Path != "" {
+		s.connected, s.device = true, event.Path
+		s.add("info", s.cfg.Device.Name+" connected at "+event.Path)
+		if s.seq != nil {
+			s.seq.Connected(event.Path)
+		}
+	} else if !event.Connected && s.connected {
+		s.connected, s.device = false, ""
+		s.add("info", s.cfg.Device.Name+" disconnected")
+		if s.seq != nil {
+			s.seq.Disconnected()
+		}
+	}
+}
+
+// flowEvent acts on an event of the flash sequence. Called with mu held.
+func (s *Server) flowEvent(e flow.Event) {
+	switch e.Kind {
+	case flow.EventSideStarted:
+		s.add("info", "Next: "+e.Side)
+
+	case flow.EventWaitDisconnect:
+		// A flashed bootloader unmounts as it reboots
+		if e.File > 0 {
+			s.prompt = "Reconnect " + e.Side + " for " + filepath.Base(e.Path)
+		} else if !s.seq.Rebooting() {
+			s.prompt = "Unplug " + s.cfg.Device.Name + ", then connect " + e.Side
+		}
+
+	case flow.EventWaitDevice:
+		s.prompt = "Connect " + e.Side + " and double-tap reset"
+		if e.File > 0 {
+			s.prompt = "Waiting for " + e.Side + " to reconnect"
+		}
+
+	case flow.EventFlash:
+		s.prompt = ""
+		s.percent = 0
+		if s.dfu != nil {
+			s.prompt = "Put " + e.Side + " into DFU mode"
+		}
+		if e.Files > 1 {
+			s.add("info", fmt.Sprintf("File %d/%d: %s", e.File+1, e.Files, filepath.Base(e.Path)))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		go s.flash(ctx, s.seq, e)
+
+	case flow.EventFileFlashed:
+		s.add("success", filepath.Base(e.Path)+" flashed")
+
+	case flow.EventSideFlashed:
+		s.add("success", e.Side+" flashed")
+
+	case flow.EventRebooted:
+		s.add("success", "Device rebooted")
+
+	case flow.EventRebootTimeout:
+		s.add("warning", fmt.Sprintf("%s still mounted after %s; the flash may not have taken", s.cfg.Device.Name, device.RebootTimeout))
+		if s.seq.State() == flow.StateWaitingDisconnect {
+			s.prompt = "Unplug " + s.cfg.Device.Name + ", then connect " + s.seq.Side()
+		}
+
+	case flow.EventComplete:
+		s.prompt = ""
+		s.add("success", "Flash complete")
+
+	case flow.EventFailed:
+		s.prompt = ""
+		if e.Retry {
+			s.retry = true
+			s.prompt = "Re-enter the bootloader of " + e.Side + " and retry"
+			s.add("error", "Device removed while flashing "+e.Side)
+			return
+		}
+		s.add("error", "Flash failed: "+e.Err.Error())
+	}
+}
+
+// flash writes the file seq asked for and reports the result to it
+func (s *Server) flash(ctx context.Context, seq *flow.Flow, e flow.Event) {
+	progress := func(percent int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Progress is spread across the side's files
+		s.percent = (e.File*100 + percent) / max(e.Files, 1)
+	}
+	var result firmware.FlashResult
+	if s.dfu != nil {
+		result = s.dfu.Flash(ctx, e.Path, func(p firmware.QMKProgress) {
+			if p.Percent >= 0 {
+				progress(p.Percent)
+			}
+		})
+	} else {
+		result = s.flasher.Flash(ctx, e.Path, e.Device, func(p firmware.FlashProgress) {
+			progress(p.Percent)
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq != s.seq || seq.State() != flow.StateFlashing {
+		return // cancelled
+	}
+	s.cancel = nil
+	if !result.Success {
+		seq.Done(fmt.Errorf("flash failed: %w", result.Error))
+		return
+	}
+	s.record(e.Side, e.Path)
+	seq.Done(nil)
+	if seq.Rebooting() {
+		if s.reboot != nil {
+			s.reboot.Stop()
+		}
+		s.reboot = time.AfterFunc(device.RebootTimeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			seq.RebootTimeout()
+		})
+	}
+}
+
+// record notes path as the firmware now on side. Called with mu held.
+func (s *Server) record(side, path string) {
+	err := s.flashes.Record(flashlog.Key(s.cfg.Keyboard.Name, side), path, time.Now())
+	if err == nil {
+		err = s.flashes.Save()
+	}
+	if err != nil {
+		s.add("warning", "Cannot save flash history: "+err.Error())
+	}
+}
+
+// add appends to the log. Called with mu held.
+func (s *Server) add(level, text string) {
+	s.log = append(s.log, Entry{Time: time.Now(), Level: level, Text: text})
+	if len(s.log) > maxLog {
+		s.log = s.log[len(s.log)-maxLog:]
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
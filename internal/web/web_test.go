@@ -0,0 +1,281 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+	"github.com/dhavalsavalia/kbflash/internal/flashlog"
+	"github.com/dhavalsavalia/kbflash/internal/sim"
+)
+
+// testServer serves a dashboard for the simulated split keyboard, whose
+// bootloader connects only when plugged
+func testServer(t *testing.T) (*Server, *sim.Device, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := sim.DemoConfig(dir)
+	cfg.Device.PollInterval = config.Duration(5 * time.Millisecond)
+	if err := sim.Seed(dir, cfg.Build.Shield, cfg.Keyboard.Sides); err != nil {
+		t.Fatal(err)
+	}
+
+	dev := sim.NewManualDevice()
+	flasher := sim.NewFlasher(dev)
+	flasher.Duration = 10 * time.Millisecond
+	s, err := NewServer(cfg, Components{
+		Detector: sim.NewDetector(dev),
+		Flasher:  flasher,
+		Scanner:  firmware.NewScanner(dir, cfg.Build.FilePattern),
+		Flashes:  flashlog.New(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s.Start(ctx)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, dev, srv
+}
+
+// waitFor polls the server's state until cond holds
+func waitFor(t *testing.T, s *Server, what string, cond func(State) bool) State {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.State()
+		if cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s; state: %+v", what, st.Flash)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// post sends body as JSON, decoding the response into out
+func post(t *testing.T, client *http.Client, url string, body, out any) int {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func logged(st State, text string) bool {
+	for _, e := range st.Log {
+		if strings.Contains(e.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServer_FlashSplit(t *testing.T) {
+	s, dev, srv := testServer(t)
+	st := waitFor(t, s, "the scan", func(st State) bool { return len(st.Builds) == 2 })
+	newest := st.Builds[0].Path
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "<title>kbflash</title>") {
+		t.Errorf("GET / did not serve the dashboard")
+	}
+
+	var flash FlashResponse
+	if code := post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: newest}, &flash); code != http.StatusOK || !flash.Started {
+		t.Fatalf("POST /api/flash = %d %+v, want started", code, flash)
+	}
+	waitFor(t, s, "left", func(st State) bool {
+		return st.Flash.State == "waiting for device" && st.Flash.Side == "left"
+	})
+	var failed struct{ Error string }
+	if code := post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: newest}, &failed); code != http.StatusConflict {
+		t.Errorf("a second flash = %d %q, want a conflict", code, failed.Error)
+	}
+
+	// The simulated bootloader unmounts as it reboots after each flash
+	dev.Plug()
+	waitFor(t, s, "right", func(st State) bool {
+		return st.Flash.State == "waiting for device" && st.Flash.Side == "right"
+	})
+	dev.Plug()
+	st = waitFor(t, s, "the flash", func(st State) bool { return st.Flash.State == "complete" })
+	for _, text := range []string{"left flashed", "right flashed", "Flash complete"} {
+		if !logged(st, text) {
+			t.Errorf("%q was not logged; log: %+v", text, st.Log)
+		}
+	}
+
+	// Flashing the same build again asks first
+	flash = FlashResponse{}
+	post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: newest, Side: "left"}, &flash)
+	if flash.Started || len(flash.Warnings) != 1 || !strings.Contains(flash.Warnings[0], "already on left") {
+		t.Fatalf("flashing again = %+v, want a warning", flash)
+	}
+	post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: newest, Side: "left", Confirm: true}, &flash)
+	if !flash.Started {
+		t.Fatalf("a confirmed flash = %+v, want started", flash)
+	}
+	waitFor(t, s, "left", func(st State) bool { return st.Flash.Side == "left" && st.Flash.Active })
+}
+
+func TestServer_FlashBackup(t *testing.T) {
+	s, dev, srv := testServer(t)
+	st := waitFor(t, s, "the scan", func(st State) bool { return len(st.Builds) == 2 })
+	workDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workDir, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "config", "corne.keymap"), []byte("/ {};"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Build.WorkingDir = workDir
+	s.cfg.Backup = config.BackupConfig{Enabled: true, Dir: filepath.Join(t.TempDir(), "backups"), Patterns: []string{"config/*.keymap"}}
+
+	var flash FlashResponse
+	if code := post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: st.Builds[0].Path, Side: "left"}, &flash); code != http.StatusOK || !flash.Started {
+		t.Fatalf("POST /api/flash = %d %+v, want started", code, flash)
+	}
+	dev.Plug()
+	waitFor(t, s, "the flash", func(st State) bool { return st.Flash.State == "complete" })
+
+	// The flash history references the backup as the restore point
+	s.mu.Lock()
+	e := s.flashes.Sides[flashlog.Key(s.cfg.Keyboard.Name, "left")]
+	s.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(e.Backup, "config", "corne.keymap")); e.Backup == "" || err != nil {
+		t.Errorf("flash history backup = %q (%v), want the keymap backup", e.Backup, err)
+	}
+}
+
+func TestServer_UnplugFirst(t *testing.T) {
+	s, dev, srv := testServer(t)
+	dev.Plug()
+	st := waitFor(t, s, "the device", func(st State) bool { return st.Device.Connected && len(st.Builds) > 0 })
+
+	// A mounted bootloader could be either side, so it is not flashed
+	post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: st.Builds[0].Path}, nil)
+	st = waitFor(t, s, "the unplug prompt", func(st State) bool { return st.Flash.State == "waiting for disconnect" })
+	if !strings.HasPrefix(st.Flash.Prompt, "Unplug") {
+		t.Errorf("prompt = %q, want to unplug", st.Flash.Prompt)
+	}
+
+	post(t, srv.Client(), srv.URL+"/api/cancel", nil, nil)
+	st = waitFor(t, s, "the cancel", func(st State) bool { return !st.Flash.Active })
+	if logged(st, "left flashed") {
+		t.Error("the mounted bootloader was flashed")
+	}
+}
+
+func TestServer_RejectsForms(t *testing.T) {
+	s, _, srv := testServer(t)
+	st := waitFor(t, s, "the scan", func(st State) bool { return len(st.Builds) > 0 })
+
+	// A cross-site form post cannot start a flash
+	resp, err := http.Post(srv.URL+"/api/flash", "application/x-www-form-urlencoded", strings.NewReader("build="+st.Builds[0].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("form post = %d, want 415", resp.StatusCode)
+	}
+	if code := post(t, srv.Client(), srv.URL+"/api/flash", FlashRequest{Build: "/elsewhere"}, nil); code != http.StatusNotFound {
+		t.Errorf("flashing an unknown build = %d, want 404", code)
+	}
+}
+
+func TestServer_RejectsRebinding(t *testing.T) {
+	s, _, srv := testServer(t)
+	st := waitFor(t, s, "the scan", func(st State) bool { return len(st.Builds) > 0 })
+
+	// A page on a name rebound to 127.0.0.1 is same-origin with the
+	// dashboard, but its requests carry that name
+	body, _ := json.Marshal(FlashRequest{Build: st.Builds[0].Path})
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/flash", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "rebind.example:7878"
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("rebound post = %d, want 403", resp.StatusCode)
+	}
+	if s.State().Flash.Active {
+		t.Error("a rebound page started a flash")
+	}
+
+	for _, host := range []string{"localhost:7878", "[::1]:7878"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/state", nil)
+		req.Host = host
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("state via %s = %d, want 200", host, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	s, _, srv := testServer(t)
+	s.SetToken("secret")
+
+	get := func(client *http.Client, url string) int {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get(srv.Client(), srv.URL+"/api/state"); code != http.StatusForbidden {
+		t.Errorf("without the token = %d, want 403", code)
+	}
+	if code := get(srv.Client(), srv.URL+"/?token=wrong"); code != http.StatusForbidden {
+		t.Errorf("with a wrong token = %d, want 403", code)
+	}
+
+	// The token in the printed URL is remembered for the API calls
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	if code := get(client, srv.URL+"/?token=secret"); code != http.StatusOK {
+		t.Errorf("with the token = %d, want 200", code)
+	}
+	if code := get(client, srv.URL+"/api/state"); code != http.StatusOK {
+		t.Errorf("with the cookie = %d, want 200", code)
+	}
+}
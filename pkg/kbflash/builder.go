@@ -0,0 +1,82 @@
+package kbflash
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/components"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// BuildProgress reports how far a build has got.
+type BuildProgress struct {
+	Percent int    // overall progress, 0-100
+	Stage   string // e.g. "Compiling"
+	Line    string // line of build output the update is for, if any
+}
+
+// BuildResult describes a finished build.
+type BuildResult struct {
+	Dir      string // directory the firmware was written to, empty if unknown
+	Duration time.Duration
+	Warnings []string // distinct compiler warnings
+}
+
+// Builder builds firmware with the configured native command or in Docker.
+type Builder struct {
+	cfg     *config.Config
+	builder firmware.FirmwareBuilder
+}
+
+// NewBuilder creates a builder for cfg's build section.
+func NewBuilder(cfg *Config) *Builder {
+	c := cfg.cfg
+	return &Builder{cfg: c, builder: components.NewBuilder(c)}
+}
+
+// Build builds the firmware for side, or every side for "all". In Docker
+// mode the image is pulled first if it is missing. progress, which may be
+// nil, is called as the build advances.
+func (b *Builder) Build(ctx context.Context, side string, progress func(BuildProgress)) (BuildResult, error) {
+	if progress == nil {
+		progress = func(BuildProgress) {}
+	}
+
+	if docker, ok := b.builder.(*firmware.DockerBuilder); ok {
+		if err := firmware.CheckDocker(ctx); err != nil {
+			return BuildResult{}, err
+		}
+		err := docker.EnsureImage(ctx, func(p firmware.PullProgress) {
+			progress(BuildProgress{
+				Percent: firmware.BuildPreparing.Percent(p.Done, p.Layers),
+				Stage:   firmware.BuildPreparing.String(),
+				Line:    p.Line,
+			})
+		})
+		if err != nil {
+			return BuildResult{}, err
+		}
+	}
+
+	result := b.builder.Build(ctx, side, func(p firmware.BuildProgress) {
+		progress(BuildProgress{Percent: p.Percent, Stage: p.Stage.String(), Line: p.Output})
+	})
+	if !result.Success {
+		return BuildResult{}, fmt.Errorf("build failed: %w", result.Error)
+	}
+	built := BuildResult{Duration: result.Duration, Warnings: result.Warnings}
+	if result.OutputPath != "" {
+		built.Dir = filepath.Dir(result.OutputPath)
+	}
+	return built, nil
+}
+
+// Clean removes the build directory of side, or of every side for "all",
+// so the next build starts from scratch. In Docker mode "all" also removes
+// the long-lived container and named volumes such as a ccache.
+func (b *Builder) Clean(ctx context.Context, side string) error {
+	return b.builder.Clean(ctx, side)
+}
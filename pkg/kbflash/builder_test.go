@@ -0,0 +1,49 @@
+package kbflash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuilder_Native(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "build.sh")
+	content := `#!/bin/bash
+echo "[1/2] Building C object main.c.obj"
+echo "[2/2] Linking zephyr.elf"
+`
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, dir, fmt.Sprintf(`
+command = %q
+args = ["{{side}}"]
+`, script))
+
+	var updates []BuildProgress
+	_, err := NewBuilder(cfg).Build(context.Background(), "left", func(p BuildProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if len(updates) == 0 {
+		t.Fatal("no progress reported")
+	}
+	last := updates[len(updates)-1]
+	if last.Stage != "Compiling" || last.Line != "[2/2] Linking zephyr.elf" {
+		t.Errorf("last progress = %+v", last)
+	}
+}
+
+func TestBuilder_Failure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadTestConfig(t, dir, `command = "false"`)
+
+	if _, err := NewBuilder(cfg).Build(context.Background(), "left", nil); err == nil {
+		t.Error("expected error for failing build command")
+	}
+}
@@ -0,0 +1,97 @@
+package kbflash
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/components"
+	"github.com/dhavalsavalia/kbflash/internal/device"
+)
+
+// Device is a mounted removable volume, such as a UF2 bootloader, filled in
+// as far as the platform can tell; zero values are unknown.
+type Device struct {
+	Path     string // mount point
+	Label    string
+	FSType   string
+	Capacity int64  // bytes
+	Serial   string // USB serial number
+}
+
+// ErrUnreadable is wrapped by DeviceEvent.Err when the bootloader is
+// mounted but this user may not read or write it.
+var ErrUnreadable = device.ErrUnreadable
+
+// DeviceEvent reports the configured bootloader appearing or going away.
+type DeviceEvent struct {
+	Connected bool
+	Device
+	// Err is set, with Connected false, when the bootloader is mounted but
+	// cannot be used; it wraps ErrUnreadable and says what to do about it
+	Err error
+}
+
+// Detector finds bootloader volumes in the configured mount paths.
+type Detector struct {
+	detector     device.Detector
+	name         string
+	pollInterval time.Duration
+}
+
+// NewDetector creates a detector for cfg's device section, detecting on
+// device.host when one is set.
+func NewDetector(cfg *Config) *Detector {
+	c := cfg.cfg
+	return &Detector{
+		detector:     components.NewDetector(c),
+		name:         c.Device.Name,
+		pollInterval: time.Duration(c.Device.PollInterval),
+	}
+}
+
+// List returns the removable volumes mounted right now.
+func (d *Detector) List(ctx context.Context) ([]Device, error) {
+	infos, err := d.detector.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]Device, len(infos))
+	for i, info := range infos {
+		devices[i] = Device{
+			Path:     info.Path,
+			Label:    info.Label,
+			FSType:   info.FSType,
+			Capacity: info.Capacity,
+			Serial:   info.Serial,
+		}
+	}
+	return devices, nil
+}
+
+// Watch polls for the configured bootloader volume, sending its current
+// state first and then each change. The channel is closed when ctx is done.
+func (d *Detector) Watch(ctx context.Context) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+	go func() {
+		defer close(events)
+		for e := range d.detector.Detect(ctx, d.name, d.pollInterval) {
+			event := DeviceEvent{
+				Connected: e.Connected,
+				Device: Device{
+					Path:     e.Path,
+					Label:    e.Label,
+					FSType:   e.FSType,
+					Capacity: e.Capacity,
+					Serial:   e.Serial,
+				},
+				Err: e.Err,
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
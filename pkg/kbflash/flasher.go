@@ -0,0 +1,81 @@
+package kbflash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dhavalsavalia/kbflash/internal/components"
+	"github.com/dhavalsavalia/kbflash/internal/config"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// ErrDeviceRemoved is returned by Flasher.Flash when the bootloader volume
+// went away before the copy finished.
+var ErrDeviceRemoved = firmware.ErrDeviceRemoved
+
+// FlashProgress reports how much of the firmware has been written.
+type FlashProgress struct {
+	Written int64 // bytes, 0 when the flashing tool only reports a percentage
+	Total   int64
+	Percent int
+}
+
+// FlashResult describes a finished flash.
+type FlashResult struct {
+	BytesWritten int64
+	SHA256       string // hex digest of the firmware file
+	Destination  string // file written on the device, empty in dfu mode
+}
+
+// Flasher writes firmware files to the keyboard as the config's flash.mode
+// says: copied to the bootloader volume, or written with dfu-util.
+type Flasher struct {
+	cfg *config.Config
+}
+
+// NewFlasher creates a flasher for cfg's flash and device sections. Copy
+// mode flashes on device.host when one is set.
+func NewFlasher(cfg *Config) *Flasher {
+	return &Flasher{cfg: cfg.cfg}
+}
+
+// Flash writes the firmware file at path to the bootloader mounted at
+// devicePath (unused in dfu mode, where dfu-util finds the bootloader).
+// The file is checked first, so a wrong or truncated file is refused
+// before anything is written. progress, which may be nil, is called as
+// the write advances. qmk mode, which builds and flashes in one step with
+// the qmk CLI, is not supported.
+func (f *Flasher) Flash(ctx context.Context, path, devicePath string, progress func(FlashProgress)) (FlashResult, error) {
+	if progress == nil {
+		progress = func(FlashProgress) {}
+	}
+	c := f.cfg
+	if c.Flash.Mode == "qmk" {
+		return FlashResult{}, errors.New("flash.mode = \"qmk\" flashes with the qmk CLI; use copy or dfu mode")
+	}
+	if err := firmware.CheckFirmwareFile(path, c.Flash.Extension(), c.Flash.MinSize); err != nil {
+		return FlashResult{}, err
+	}
+
+	var result firmware.FlashResult
+	if c.Flash.Mode == "dfu" {
+		result = components.NewDFUFlasher(c).Flash(ctx, path, func(p firmware.QMKProgress) {
+			if p.Percent >= 0 {
+				progress(FlashProgress{Percent: p.Percent})
+			}
+		})
+	} else {
+		result = components.NewFlasher(c).Flash(ctx, path, devicePath, func(p firmware.FlashProgress) {
+			progress(FlashProgress{Written: p.Written, Total: p.Total, Percent: p.Percent})
+		})
+	}
+	if !result.Success {
+		return FlashResult{}, fmt.Errorf("flash failed: %w", result.Error)
+	}
+	return FlashResult{
+		BytesWritten: result.BytesWritten,
+		SHA256:       result.SHA256,
+		Destination:  result.Destination,
+	}, nil
+}
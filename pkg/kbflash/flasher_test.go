@@ -0,0 +1,68 @@
+package kbflash
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlasher_Copy(t *testing.T) {
+	dir := t.TempDir()
+	writeFirmware(t, dir, "corne_left.uf2")
+	mount := filepath.Join(t.TempDir(), "NICENANO")
+	if err := os.Mkdir(mount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, dir, "")
+
+	var last FlashProgress
+	result, err := NewFlasher(cfg).Flash(context.Background(), filepath.Join(dir, "corne_left.uf2"), mount, func(p FlashProgress) {
+		last = p
+	})
+	if err != nil {
+		t.Fatalf("Flash() error = %v", err)
+	}
+	if result.BytesWritten != 8192 {
+		t.Errorf("BytesWritten = %d, want 8192", result.BytesWritten)
+	}
+	if last.Percent != 100 || last.Written != 8192 {
+		t.Errorf("last progress = %+v, want all 8192 bytes", last)
+	}
+	if result.Destination != filepath.Join(mount, "corne_left.uf2") {
+		t.Errorf("Destination = %q", result.Destination)
+	}
+	written, err := os.ReadFile(result.Destination)
+	if err != nil || !bytes.Equal(written, make([]byte, 8192)) {
+		t.Errorf("firmware not copied to the device: %v", err)
+	}
+}
+
+func TestFlasher_RejectsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFirmware(t, dir, "corne_left.bin")
+	mount := t.TempDir()
+	cfg := loadTestConfig(t, dir, "")
+
+	if _, err := NewFlasher(cfg).Flash(context.Background(), filepath.Join(dir, "corne_left.bin"), mount, nil); err == nil {
+		t.Fatal("expected error for a .bin file in uf2 copy mode")
+	}
+	if entries, _ := os.ReadDir(mount); len(entries) != 0 {
+		t.Errorf("rejected file was written to the device: %v", entries)
+	}
+}
+
+func TestFlasher_QMKMode(t *testing.T) {
+	dir := t.TempDir()
+	writeFirmware(t, dir, "corne_left.uf2")
+	cfg := loadTestConfig(t, dir, `
+[flash]
+mode = "qmk"
+qmk_keyboard = "crkbd/rev1"
+`)
+
+	if _, err := NewFlasher(cfg).Flash(context.Background(), filepath.Join(dir, "corne_left.uf2"), t.TempDir(), nil); err == nil {
+		t.Error("expected error in qmk mode")
+	}
+}
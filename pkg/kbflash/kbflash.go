@@ -0,0 +1,80 @@
+// Package kbflash lets other Go programs, such as editor plugins or tools
+// managing many keyboards, scan, build, detect and flash keyboard firmware
+// the way the kbflash command does, configured by the same config file.
+//
+// The types here are kbflash's public API and stay compatible across
+// releases; the packages under internal may change at any time.
+//
+//	cfg, err := kbflash.LoadConfig("", "")
+//	if err != nil {
+//		return err
+//	}
+//	build, err := kbflash.NewScanner(cfg).Latest(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for dev := range kbflash.NewDetector(cfg).Watch(ctx) {
+//		if dev.Connected {
+//			_, err := kbflash.NewFlasher(cfg).Flash(ctx, build.Sides["left"].Path, dev.Path, nil)
+//			return err
+//		}
+//	}
+package kbflash
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/dhavalsavalia/kbflash/internal/config"
+)
+
+// Config is a loaded and validated kbflash config for one keyboard.
+type Config struct {
+	cfg *config.Config
+}
+
+// LoadConfig reads the config file at path, found as the kbflash command
+// finds it when path is empty ($KBFLASH_CONFIG, config.kbflash.toml, then
+// ~/.config/kbflash/config.toml). keyboard names the profile to use in a
+// config with several keyboards; empty selects the first.
+func LoadConfig(path, keyboard string) (*Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Profiles) == 0 {
+		if keyboard != "" && keyboard != cfg.Keyboard.Name {
+			return nil, fmt.Errorf("no keyboard profile %q: config defines no [profiles]", keyboard)
+		}
+		return &Config{cfg: cfg}, nil
+	}
+	if keyboard == "" {
+		keyboard = cfg.ProfileNames()[0]
+	}
+	profile, err := cfg.Profile(keyboard)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{cfg: profile}, nil
+}
+
+// Keyboard returns the keyboard's name.
+func (c *Config) Keyboard() string {
+	return c.cfg.Keyboard.Name
+}
+
+// Sides returns the keyboard's sides in flashing order, e.g. left and right.
+func (c *Config) Sides() []string {
+	return slices.Clone(c.cfg.Keyboard.Sides)
+}
+
+// DeviceName returns the bootloader volume label the Detector watches for.
+func (c *Config) DeviceName() string {
+	return c.cfg.Device.Name
+}
+
+// Warnings returns problems the config loaded with anyway, such as renamed
+// keys, for the caller to show.
+func (c *Config) Warnings() []string {
+	return slices.Clone(c.cfg.Warnings)
+}
@@ -0,0 +1,95 @@
+package kbflash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig writes a split-keyboard config whose firmware_dir is
+// firmwareDir, with extra appended to its build table, and loads it.
+func loadTestConfig(t *testing.T, firmwareDir, extra string) *Config {
+	t.Helper()
+	content := fmt.Sprintf(`
+[keyboard]
+name = "corne"
+sides = ["left", "right"]
+
+[device]
+name = "NICENANO"
+
+[build]
+firmware_dir = %q
+%s`, firmwareDir, extra)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	return cfg
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg := loadTestConfig(t, t.TempDir(), "")
+	if cfg.Keyboard() != "corne" {
+		t.Errorf("Keyboard() = %q, want corne", cfg.Keyboard())
+	}
+	if sides := cfg.Sides(); strings.Join(sides, ",") != "left,right" {
+		t.Errorf("Sides() = %v, want [left right]", sides)
+	}
+	if cfg.DeviceName() != "NICENANO" {
+		t.Errorf("DeviceName() = %q, want NICENANO", cfg.DeviceName())
+	}
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[device]
+name = "NICENANO"
+
+[profiles.corne.keyboard]
+sides = ["left", "right"]
+
+[profiles.planck.device]
+name = "PLANCK"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Keyboard() != "corne" {
+		t.Errorf("Keyboard() = %q, want the first profile, corne", cfg.Keyboard())
+	}
+
+	cfg, err = LoadConfig(path, "planck")
+	if err != nil {
+		t.Fatalf("LoadConfig(planck) error = %v", err)
+	}
+	if cfg.DeviceName() != "PLANCK" {
+		t.Errorf("DeviceName() = %q, want PLANCK", cfg.DeviceName())
+	}
+
+	if _, err := LoadConfig(path, "lily"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[keyboard]\nname = \"corne\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path, ""); err == nil {
+		t.Error("expected error for config without device.name")
+	}
+}
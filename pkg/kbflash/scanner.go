@@ -0,0 +1,99 @@
+package kbflash
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dhavalsavalia/kbflash/internal/components"
+	"github.com/dhavalsavalia/kbflash/internal/firmware"
+)
+
+// ErrNoFirmware is returned by Scanner.Latest when no build is found.
+var ErrNoFirmware = errors.New("no firmware found")
+
+// File is a firmware file in a build.
+type File struct {
+	Name string
+	Path string
+	Size int64 // bytes
+}
+
+// Build is a directory of firmware files, as the firmware list shows it.
+type Build struct {
+	Title  string    // date, directory name, or "current" for a flat firmware dir
+	Dir    string    // directory holding the files
+	Time   time.Time // date the directory is named for, else its modification time
+	Source string    // label of the build.sources entry, empty for firmware_dir alone
+	Notes  string    // text of the build's notes file, if any
+	Files  []File
+
+	// Sides maps each of the keyboard's sides to its file, for sides that
+	// have one, picked as the kbflash command picks them.
+	Sides map[string]File
+}
+
+// Scanner finds builds in the configured firmware directories.
+type Scanner struct {
+	scanner *firmware.Scanner
+	matcher *firmware.SideMatcher
+	sides   []string
+}
+
+// NewScanner creates a scanner for cfg's firmware_dir and build.sources.
+func NewScanner(cfg *Config) *Scanner {
+	c := cfg.cfg
+	scanner := components.NewScanner(c)
+
+	// Side patterns are validated by config, so this cannot fail
+	matcher, _ := firmware.NewSideMatcher(c.Keyboard.SidePatterns)
+	matcher.SetStudio(c.Build.Studio)
+	return &Scanner{scanner: scanner, matcher: matcher, sides: c.Keyboard.Sides}
+}
+
+// Scan returns every build, newest first.
+func (s *Scanner) Scan(ctx context.Context) ([]Build, error) {
+	found, err := s.scanner.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	builds := make([]Build, len(found))
+	for i, b := range found {
+		builds[i] = s.build(b)
+	}
+	return builds, nil
+}
+
+// Latest returns the newest build, or ErrNoFirmware if there is none.
+func (s *Scanner) Latest(ctx context.Context) (Build, error) {
+	builds, err := s.Scan(ctx)
+	if err != nil {
+		return Build{}, err
+	}
+	if len(builds) == 0 {
+		return Build{}, ErrNoFirmware
+	}
+	return builds[0], nil
+}
+
+// build converts a scanned build, matching its files to sides.
+func (s *Scanner) build(b firmware.Build) Build {
+	build := Build{
+		Title:  b.Title(),
+		Dir:    b.Path,
+		Time:   b.Time(),
+		Source: b.Source,
+		Notes:  b.Notes,
+		Files:  make([]File, len(b.Files)),
+		Sides:  make(map[string]File),
+	}
+	for i, f := range b.Files {
+		build.Files[i] = File{Name: f.Name, Path: f.Path, Size: f.Size}
+	}
+	for _, side := range s.sides {
+		if f := s.matcher.Match(side, b.Files); f != nil {
+			build.Sides[side] = File{Name: f.Name, Path: f.Path, Size: f.Size}
+		}
+	}
+	return build
+}
@@ -0,0 +1,66 @@
+package kbflash
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFirmware(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 8192), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanner_Latest(t *testing.T) {
+	dir := t.TempDir()
+	writeFirmware(t, filepath.Join(dir, "20240101"), "corne_left.uf2", "corne_right.uf2")
+	writeFirmware(t, filepath.Join(dir, "20250301"), "corne_left.uf2", "corne_right.uf2")
+	cfg := loadTestConfig(t, dir, "")
+
+	scanner := NewScanner(cfg)
+	builds, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(builds) != 2 {
+		t.Fatalf("Scan() found %d builds, want 2", len(builds))
+	}
+
+	latest, err := scanner.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if latest.Dir != filepath.Join(dir, "20250301") {
+		t.Errorf("Latest().Dir = %q, want the 20250301 build", latest.Dir)
+	}
+	if latest.Time.Year() != 2025 || latest.Time.Month() != 3 {
+		t.Errorf("Latest().Time = %v, want 2025-03-01", latest.Time)
+	}
+	if len(latest.Files) != 2 {
+		t.Errorf("Latest().Files = %v, want two files", latest.Files)
+	}
+	for _, side := range []string{"left", "right"} {
+		want := filepath.Join(dir, "20250301", "corne_"+side+".uf2")
+		if got := latest.Sides[side].Path; got != want {
+			t.Errorf("Latest().Sides[%s].Path = %q, want %q", side, got, want)
+		}
+	}
+}
+
+func TestScanner_LatestEmpty(t *testing.T) {
+	cfg := loadTestConfig(t, t.TempDir(), "")
+
+	_, err := NewScanner(cfg).Latest(context.Background())
+	if !errors.Is(err, ErrNoFirmware) {
+		t.Errorf("Latest() error = %v, want ErrNoFirmware", err)
+	}
+}